@@ -0,0 +1,136 @@
+package httpmodule
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+// AccessLogFormat is the layout of access log lines
+type AccessLogFormat int
+
+const (
+	// Apache's common log format
+	CommonLog AccessLogFormat = iota
+	// Apache's combined log format: common plus Referer and User-Agent
+	CombinedLog
+	// One JSON object per line
+	JSONLog
+)
+
+// Format of the timestamp in common and combined log lines
+const commonLogTimeFormat = "02/Jan/2006:15:04:05 -0700"
+
+// AccessLogEntry describes a request the server handled
+type AccessLogEntry struct {
+	Time       time.Time     `json:"time"`
+	RemoteAddr string        `json:"remote_addr"`
+	User       string        `json:"user,omitempty"`
+	Method     string        `json:"method"`
+	Target     string        `json:"uri"`
+	Protocol   string        `json:"protocol"`
+	Host       string        `json:"host,omitempty"`
+	Status     int           `json:"status"`
+	Bytes      int64         `json:"bytes"`
+	Duration   time.Duration `json:"-"`
+	Referer    string        `json:"referer,omitempty"`
+	UserAgent  string        `json:"user_agent,omitempty"`
+}
+
+// AccessLogOptions controls what AccessLog records and where
+type AccessLogOptions struct {
+	// Destination for log lines; nil writes none
+	Out    io.Writer
+	Format AccessLogFormat
+
+	// Called with every entry, to feed a structured logger or metrics
+	Record func(entry AccessLogEntry)
+
+	// Source of time for timestamps and latency; nil uses the real clock
+	Clock Clock
+}
+
+// AccessLog returns middleware that records every request once its response
+// has been written: who asked, for what, the status, the body size, and how
+// long it took
+func AccessLog(options AccessLogOptions) Middleware {
+	clock := clockOrReal(options.Clock)
+	var mu sync.Mutex
+	return func(next Handler) Handler {
+		return HandlerFunc(func(w ResponseWriter, req *ServerRequest) {
+			start := clock.Now()
+			sw := &statusWriter{ResponseWriter: w}
+			next.ServeHTTP(sw, req)
+
+			entry := AccessLogEntry{
+				Time:       start,
+				RemoteAddr: req.RemoteAddr,
+				User:       basicAuthUser(headerValue(req.Headers, "Authorization")),
+				Method:     req.Method,
+				Target:     req.Target,
+				Protocol:   req.Protocol,
+				Host:       req.Host,
+				Status:     sw.status,
+				Bytes:      sw.written,
+				Duration:   clock.Now().Sub(start),
+				Referer:    headerValue(req.Headers, "Referer"),
+				UserAgent:  headerValue(req.Headers, "User-Agent"),
+			}
+			if host, _, err := net.SplitHostPort(entry.RemoteAddr); err == nil {
+				entry.RemoteAddr = host
+			}
+			if entry.Status == 0 {
+				entry.Status = 200
+			}
+
+			if options.Record != nil {
+				options.Record(entry)
+			}
+			if options.Out != nil {
+				line := entry.Format(options.Format)
+				mu.Lock()
+				io.WriteString(options.Out, line)
+				mu.Unlock()
+			}
+		})
+	}
+}
+
+// Format renders the entry as a log line, including the trailing newline
+func (entry AccessLogEntry) Format(format AccessLogFormat) string {
+	if format == JSONLog {
+		data, _ := json.Marshal(struct {
+			AccessLogEntry
+			DurationMS float64 `json:"duration_ms"`
+		}{entry, float64(entry.Duration) / float64(time.Millisecond)})
+		return string(data) + "\n"
+	}
+
+	bytes := "-"
+	if entry.Bytes > 0 {
+		bytes = fmt.Sprint(entry.Bytes)
+	}
+	line := fmt.Sprintf("%s - %s [%s] \"%s %s %s\" %d %s",
+		orDash(entry.RemoteAddr), orDash(entry.User), entry.Time.Format(commonLogTimeFormat),
+		entry.Method, entry.Target, entry.Protocol, entry.Status, bytes)
+	if format == CombinedLog {
+		line += fmt.Sprintf(" %q %q", orDash(entry.Referer), orDash(entry.UserAgent))
+	}
+	return line + "\n"
+}
+
+// basicAuthUser returns the user name in a Basic Authorization header, or ""
+func basicAuthUser(authorization string) string {
+	user, _, _ := parseBasicAuth(authorization)
+	return user
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
@@ -0,0 +1,74 @@
+package httpmodule
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"testing"
+	"time"
+)
+
+// TestAccessLog tests the common, combined, and JSON formats.
+func TestAccessLog(t *testing.T) {
+	clock := NewFakeClock(time.Date(2024, 3, 4, 5, 6, 7, 0, time.FixedZone("", -7*3600)))
+	handler := HandlerFunc(func(w ResponseWriter, req *ServerRequest) {
+		clock.Advance(25 * time.Millisecond)
+		w.WriteHeader(201)
+		io.WriteString(w, "created")
+	})
+	request := func() *ServerRequest {
+		return &ServerRequest{
+			Method:     "POST",
+			Target:     "/items?draft=1",
+			Protocol:   "HTTP/1.1",
+			Host:       "example.com",
+			RemoteAddr: "192.0.2.7:51234",
+			Headers: map[string]string{
+				"Authorization": "Basic ZnJhbms6c2VjcmV0",
+				"Referer":       "https://example.com/",
+				"User-Agent":    "test/1.0",
+			},
+		}
+	}
+
+	tests := []struct {
+		format AccessLogFormat
+		want   string
+	}{
+		{CommonLog, "192.0.2.7 - frank [04/Mar/2024:05:06:07 -0700] \"POST /items?draft=1 HTTP/1.1\" 201 7\n"},
+		{CombinedLog, "192.0.2.7 - frank [04/Mar/2024:05:06:07 -0700] \"POST /items?draft=1 HTTP/1.1\" 201 7 \"https://example.com/\" \"test/1.0\"\n"},
+	}
+	for _, test := range tests {
+		var out bytes.Buffer
+		AccessLog(AccessLogOptions{Out: &out, Format: test.format, Clock: clock})(handler).ServeHTTP(newResponseRecorder(), request())
+		if out.String() != test.want {
+			t.Errorf("Expected %q, got %q.", test.want, out.String())
+		}
+	}
+
+	var out bytes.Buffer
+	var recorded AccessLogEntry
+	AccessLog(AccessLogOptions{Out: &out, Format: JSONLog, Clock: clock, Record: func(entry AccessLogEntry) {
+		recorded = entry
+	}})(handler).ServeHTTP(newResponseRecorder(), request())
+	var decoded map[string]any
+	if err := json.Unmarshal(out.Bytes(), &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if decoded["status"] != 201.0 || decoded["bytes"] != 7.0 || decoded["duration_ms"] != 25.0 || decoded["user"] != "frank" || decoded["uri"] != "/items?draft=1" {
+		t.Error("Expected the JSON entry, got", out.String())
+	}
+	if recorded.Duration != 25*time.Millisecond || recorded.Status != 201 {
+		t.Error("Expected the entry to be passed to Record, got", recorded)
+	}
+}
+
+// TestAccessLogDefaults tests logging a handler that writes nothing.
+func TestAccessLogDefaults(t *testing.T) {
+	var out bytes.Buffer
+	handler := AccessLog(AccessLogOptions{Out: &out, Clock: NewFakeClock(time.Unix(0, 0).UTC())})(HandlerFunc(func(w ResponseWriter, req *ServerRequest) {}))
+	handler.ServeHTTP(newResponseRecorder(), &ServerRequest{Method: "GET", Target: "/", Protocol: "HTTP/1.0", Headers: map[string]string{}})
+	if want := "- - - [01/Jan/1970:00:00:00 +0000] \"GET / HTTP/1.0\" 200 -\n"; out.String() != want {
+		t.Errorf("Expected %q, got %q.", want, out.String())
+	}
+}
@@ -0,0 +1,430 @@
+package httpmodule
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rsa"
+	_ "crypto/sha256" // for crypto.SHA256
+	_ "crypto/sha512" // for crypto.SHA384 and crypto.SHA512
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+)
+
+// Keys for values the authentication middleware puts in request contexts
+type authContextKey int
+
+const (
+	authUserKey authContextKey = iota
+	jwtClaimsKey
+)
+
+// BasicAuth returns the credentials of a request's Basic Authorization header
+func (req *ServerRequest) BasicAuth() (user, password string, ok bool) {
+	return parseBasicAuth(headerValue(req.Headers, "Authorization"))
+}
+
+func parseBasicAuth(authorization string) (user, password string, ok bool) {
+	scheme, credentials, ok := strings.Cut(authorization, " ")
+	if !ok || !strings.EqualFold(scheme, "Basic") {
+		return "", "", false
+	}
+	decoded, err := base64.StdEncoding.DecodeString(strings.TrimSpace(credentials))
+	if err != nil {
+		return "", "", false
+	}
+	return strings.Cut(string(decoded), ":")
+}
+
+// BasicAuth returns middleware that only lets requests through with Basic
+// credentials check accepts, answering the rest with 401 and a challenge
+// for realm. The user name is available to handlers from AuthUser.
+func BasicAuth(realm string, check func(user, password string) bool) Middleware {
+	challenge := fmt.Sprintf(`Basic realm=%q, charset="UTF-8"`, realm)
+	return func(next Handler) Handler {
+		return HandlerFunc(func(w ResponseWriter, req *ServerRequest) {
+			user, password, ok := req.BasicAuth()
+			if !ok || !check(user, password) {
+				w.Header()["WWW-Authenticate"] = challenge
+				w.WriteHeader(401)
+				return
+			}
+			next.ServeHTTP(w, req.WithContext(context.WithValue(req.Context(), authUserKey, user)))
+		})
+	}
+}
+
+// BasicAuthUsers returns a check for BasicAuth that accepts the user names
+// and passwords in users, comparing passwords in constant time
+func BasicAuthUsers(users map[string]string) func(user, password string) bool {
+	return func(user, password string) bool {
+		expected, ok := users[user]
+		match := subtle.ConstantTimeCompare([]byte(expected), []byte(password)) == 1
+		return ok && match
+	}
+}
+
+// AuthUser returns the user BasicAuth authenticated the request as, or the
+// subject of its token for JWTAuth, or "" if neither did
+func AuthUser(req *ServerRequest) string {
+	if user, ok := req.Context().Value(authUserKey).(string); ok {
+		return user
+	}
+	if claims, ok := JWTClaimsFromContext(req.Context()); ok {
+		return claims.String("sub")
+	}
+	return ""
+}
+
+// JWTClaims are the claims of a validated JSON Web Token. Numbers are
+// json.Number.
+type JWTClaims map[string]any
+
+// String returns a claim that is a string, or ""
+func (claims JWTClaims) String(name string) string {
+	s, _ := claims[name].(string)
+	return s
+}
+
+// JWTClaimsFromContext returns the claims JWTAuth validated for a request
+func JWTClaimsFromContext(ctx context.Context) (JWTClaims, bool) {
+	claims, ok := ctx.Value(jwtClaimsKey).(JWTClaims)
+	return claims, ok
+}
+
+// JWTOptions controls which tokens ValidateJWT and JWTAuth accept
+type JWTOptions struct {
+	// Verification keys by key ID ("kid"): []byte for HMAC, *rsa.PublicKey,
+	// *ecdsa.PublicKey, or ed25519.PublicKey. A token without a key ID
+	// is checked against the only key, if there is just one.
+	Keys map[string]any
+
+	// Looks up keys instead of Keys, for key sets that change, such as one
+	// refreshed from a JWKS endpoint
+	KeyFunc func(kid, alg string) (any, error)
+
+	// Signing algorithms to accept, such as "RS256"; nil accepts any the key
+	// suits. "none" is never accepted.
+	Algorithms []string
+
+	// Required "iss" claim, if not empty
+	Issuer string
+
+	// Audience that must be in the "aud" claim, if not empty
+	Audience string
+
+	// Allowance for clock skew when checking "exp" and "nbf"
+	Leeway time.Duration
+
+	// Source of time for expiry checks; nil uses the real clock
+	Clock Clock
+
+	// Realm named in challenges JWTAuth sends
+	Realm string
+}
+
+// JWTAuth returns middleware that only lets requests through with a valid
+// bearer token, answering the rest with 401 and a challenge. The token's
+// claims are in the request context for JWTClaimsFromContext.
+func JWTAuth(options JWTOptions) Middleware {
+	return func(next Handler) Handler {
+		return HandlerFunc(func(w ResponseWriter, req *ServerRequest) {
+			scheme, token, _ := strings.Cut(headerValue(req.Headers, "Authorization"), " ")
+			if !strings.EqualFold(scheme, "Bearer") || strings.TrimSpace(token) == "" {
+				w.Header()["WWW-Authenticate"] = fmt.Sprintf("Bearer realm=%q", options.Realm)
+				w.WriteHeader(401)
+				return
+			}
+			claims, err := ValidateJWT(strings.TrimSpace(token), options)
+			if err != nil {
+				w.Header()["WWW-Authenticate"] = fmt.Sprintf("Bearer realm=%q, error=\"invalid_token\", error_description=%q", options.Realm, err.Error())
+				w.WriteHeader(401)
+				return
+			}
+			next.ServeHTTP(w, req.WithContext(context.WithValue(req.Context(), jwtClaimsKey, claims)))
+		})
+	}
+}
+
+// ValidateJWT checks a compact JSON Web Token's signature and its exp, nbf,
+// iss, and aud claims, returning its claims if it is valid
+func ValidateJWT(token string, options JWTOptions) (JWTClaims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, errors.New("malformed token")
+	}
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeJWTPart(parts[0], &header); err != nil {
+		return nil, fmt.Errorf("malformed token header: %v", err)
+	}
+	if header.Alg == "" || strings.EqualFold(header.Alg, "none") {
+		return nil, errors.New("unsigned token")
+	}
+	if options.Algorithms != nil && !containsString(options.Algorithms, header.Alg) {
+		return nil, fmt.Errorf("algorithm %s not allowed", header.Alg)
+	}
+
+	key, err := options.key(header.Kid, header.Alg)
+	if err != nil {
+		return nil, err
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, errors.New("malformed token signature")
+	}
+	if err := verifyJWTSignature(header.Alg, key, parts[0]+"."+parts[1], signature); err != nil {
+		return nil, err
+	}
+
+	var claims JWTClaims
+	if err := decodeJWTPart(parts[1], &claims); err != nil {
+		return nil, fmt.Errorf("malformed token claims: %v", err)
+	}
+	if err := options.checkClaims(claims); err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
+
+// key finds the key a token names
+func (options *JWTOptions) key(kid, alg string) (any, error) {
+	if options.KeyFunc != nil {
+		return options.KeyFunc(kid, alg)
+	}
+	if key, ok := options.Keys[kid]; ok {
+		return key, nil
+	}
+	if kid == "" && len(options.Keys) == 1 {
+		for _, key := range options.Keys {
+			return key, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown key %q", kid)
+}
+
+// checkClaims checks the registered claims options cares about
+func (options *JWTOptions) checkClaims(claims JWTClaims) error {
+	now := clockOrReal(options.Clock).Now()
+	if exp, ok, err := numericDate(claims, "exp"); err != nil {
+		return err
+	} else if ok && !now.Before(exp.Add(options.Leeway)) {
+		return errors.New("token expired")
+	}
+	if nbf, ok, err := numericDate(claims, "nbf"); err != nil {
+		return err
+	} else if ok && now.Add(options.Leeway).Before(nbf) {
+		return errors.New("token not valid yet")
+	}
+
+	if options.Issuer != "" && claims.String("iss") != options.Issuer {
+		return errors.New("token from the wrong issuer")
+	}
+	if options.Audience != "" {
+		var audiences []string
+		switch aud := claims["aud"].(type) {
+		case string:
+			audiences = []string{aud}
+		case []any:
+			for _, a := range aud {
+				if s, ok := a.(string); ok {
+					audiences = append(audiences, s)
+				}
+			}
+		}
+		if !containsString(audiences, options.Audience) {
+			return errors.New("token for the wrong audience")
+		}
+	}
+	return nil
+}
+
+// numericDate reads a claim holding seconds since the epoch
+func numericDate(claims JWTClaims, name string) (time.Time, bool, error) {
+	value, ok := claims[name]
+	if !ok {
+		return time.Time{}, false, nil
+	}
+	number, ok := value.(json.Number)
+	if !ok {
+		return time.Time{}, false, fmt.Errorf("malformed %s claim", name)
+	}
+	seconds, err := number.Float64()
+	if err != nil {
+		return time.Time{}, false, fmt.Errorf("malformed %s claim", name)
+	}
+	return time.Unix(0, int64(seconds*float64(time.Second))), true, nil
+}
+
+// verifyJWTSignature checks signature over signed with key, which must be of
+// the type alg calls for, so an RSA public key can't be used as an HMAC secret
+func verifyJWTSignature(alg string, key any, signed string, signature []byte) error {
+	invalid := errors.New("invalid token signature")
+	var hash crypto.Hash
+	if alg != "EdDSA" {
+		hashes := map[string]crypto.Hash{"256": crypto.SHA256, "384": crypto.SHA384, "512": crypto.SHA512}
+		var ok bool
+		if len(alg) == 5 {
+			hash, ok = hashes[alg[2:]]
+		}
+		if !ok {
+			return fmt.Errorf("unsupported algorithm %s", alg)
+		}
+	}
+	digest := func() []byte {
+		h := hash.New()
+		h.Write([]byte(signed))
+		return h.Sum(nil)
+	}
+
+	switch {
+	case strings.HasPrefix(alg, "HS"):
+		secret, ok := key.([]byte)
+		if !ok {
+			return fmt.Errorf("key does not suit %s", alg)
+		}
+		mac := hmac.New(hash.New, secret)
+		mac.Write([]byte(signed))
+		if !hmac.Equal(mac.Sum(nil), signature) {
+			return invalid
+		}
+	case strings.HasPrefix(alg, "RS"), strings.HasPrefix(alg, "PS"):
+		public, ok := key.(*rsa.PublicKey)
+		if !ok {
+			return fmt.Errorf("key does not suit %s", alg)
+		}
+		var err error
+		if alg[0] == 'R' {
+			err = rsa.VerifyPKCS1v15(public, hash, digest(), signature)
+		} else {
+			err = rsa.VerifyPSS(public, hash, digest(), signature, nil)
+		}
+		if err != nil {
+			return invalid
+		}
+	case strings.HasPrefix(alg, "ES"):
+		// Each algorithm names its curve, which fixes the signature at two
+		// halves of the curve's size: 32, 48, or 66 bytes
+		curves := map[string]elliptic.Curve{"ES256": elliptic.P256(), "ES384": elliptic.P384(), "ES512": elliptic.P521()}
+		public, ok := key.(*ecdsa.PublicKey)
+		if !ok || curves[alg] == nil || public.Curve != curves[alg] {
+			return fmt.Errorf("key does not suit %s", alg)
+		}
+		size := (public.Curve.Params().BitSize + 7) / 8
+		if len(signature) != 2*size {
+			return invalid
+		}
+		r := new(big.Int).SetBytes(signature[:size])
+		s := new(big.Int).SetBytes(signature[size:])
+		if !ecdsa.Verify(public, digest(), r, s) {
+			return invalid
+		}
+	case alg == "EdDSA":
+		public, ok := key.(ed25519.PublicKey)
+		if !ok {
+			return fmt.Errorf("key does not suit %s", alg)
+		}
+		if !ed25519.Verify(public, []byte(signed), signature) {
+			return invalid
+		}
+	default:
+		return fmt.Errorf("unsupported algorithm %s", alg)
+	}
+	return nil
+}
+
+// decodeJWTPart decodes a base64url JSON part of a token into v
+func decodeJWTPart(part string, v any) error {
+	data, err := base64.RawURLEncoding.DecodeString(part)
+	if err != nil {
+		return err
+	}
+	decoder := json.NewDecoder(strings.NewReader(string(data)))
+	decoder.UseNumber()
+	return decoder.Decode(v)
+}
+
+// ParseJWKS reads a JSON Web Key Set into keys by key ID for JWTOptions.
+// RSA, EC (P-256, P-384, P-521), OKP (Ed25519), and oct keys are supported;
+// others are skipped.
+func ParseJWKS(data []byte) (map[string]any, error) {
+	var set struct {
+		Keys []struct {
+			Kty string `json:"kty"`
+			Kid string `json:"kid"`
+			Use string `json:"use"`
+			Crv string `json:"crv"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+			X   string `json:"x"`
+			Y   string `json:"y"`
+			K   string `json:"k"`
+		} `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &set); err != nil {
+		return nil, fmt.Errorf("malformed key set: %v", err)
+	}
+
+	keys := make(map[string]any, len(set.Keys))
+	for _, jwk := range set.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		field := func(s string) *big.Int {
+			b, err := base64.RawURLEncoding.DecodeString(s)
+			if err != nil || len(b) == 0 {
+				return nil
+			}
+			return new(big.Int).SetBytes(b)
+		}
+		switch jwk.Kty {
+		case "RSA":
+			n, e := field(jwk.N), field(jwk.E)
+			if n == nil || e == nil || !e.IsInt64() {
+				return nil, fmt.Errorf("malformed RSA key %q", jwk.Kid)
+			}
+			keys[jwk.Kid] = &rsa.PublicKey{N: n, E: int(e.Int64())}
+		case "EC":
+			curves := map[string]elliptic.Curve{"P-256": elliptic.P256(), "P-384": elliptic.P384(), "P-521": elliptic.P521()}
+			curve, ok := curves[jwk.Crv]
+			x, y := field(jwk.X), field(jwk.Y)
+			if !ok || x == nil || y == nil || !curve.IsOnCurve(x, y) {
+				return nil, fmt.Errorf("malformed EC key %q", jwk.Kid)
+			}
+			keys[jwk.Kid] = &ecdsa.PublicKey{Curve: curve, X: x, Y: y}
+		case "OKP":
+			x, err := base64.RawURLEncoding.DecodeString(jwk.X)
+			if jwk.Crv != "Ed25519" || err != nil || len(x) != ed25519.PublicKeySize {
+				return nil, fmt.Errorf("malformed OKP key %q", jwk.Kid)
+			}
+			keys[jwk.Kid] = ed25519.PublicKey(x)
+		case "oct":
+			k, err := base64.RawURLEncoding.DecodeString(jwk.K)
+			if err != nil || len(k) == 0 {
+				return nil, fmt.Errorf("malformed oct key %q", jwk.Kid)
+			}
+			keys[jwk.Kid] = k
+		}
+	}
+	return keys, nil
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,257 @@
+package httpmodule
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+)
+
+// signJWT builds a token for claims signed with alg and key.
+func signJWT(t *testing.T, alg, kid string, key any, claims map[string]any) string {
+	header, _ := json.Marshal(map[string]string{"alg": alg, "kid": kid, "typ": "JWT"})
+	payload, _ := json.Marshal(claims)
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(signed))
+
+	var signature []byte
+	var err error
+	switch k := key.(type) {
+	case []byte:
+		mac := hmac.New(sha256.New, k)
+		mac.Write([]byte(signed))
+		signature = mac.Sum(nil)
+	case *rsa.PrivateKey:
+		signature, err = rsa.SignPKCS1v15(rand.Reader, k, crypto.SHA256, digest[:])
+	case *ecdsa.PrivateKey:
+		var r, s *big.Int
+		r, s, err = ecdsa.Sign(rand.Reader, k, digest[:])
+		signature = make([]byte, 64)
+		r.FillBytes(signature[:32])
+		s.FillBytes(signature[32:])
+	case ed25519.PrivateKey:
+		signature = ed25519.Sign(k, []byte(signed))
+	case nil:
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+// TestBasicAuth tests challenging and admitting requests with Basic credentials.
+func TestBasicAuth(t *testing.T) {
+	handler := BasicAuth("admin area", BasicAuthUsers(map[string]string{"ada": "secret"}))(HandlerFunc(func(w ResponseWriter, req *ServerRequest) {
+		w.Write([]byte("hello " + AuthUser(req)))
+	}))
+	credentials := func(user, password string) map[string]string {
+		return map[string]string{"Authorization": "Basic " + base64.StdEncoding.EncodeToString([]byte(user+":"+password))}
+	}
+
+	rec := serve(handler, "GET", "/")
+	if rec.status != 401 || rec.headers["WWW-Authenticate"] != `Basic realm="admin area", charset="UTF-8"` {
+		t.Error("Expected a challenge, got", rec.status, rec.headers)
+	}
+	if rec := serveWith(handler, "GET", "/", credentials("ada", "wrong")); rec.status != 401 {
+		t.Error("Expected a wrong password to be refused, got", rec.status)
+	}
+	if rec := serveWith(handler, "GET", "/", credentials("bob", "")); rec.status != 401 {
+		t.Error("Expected an unknown user to be refused, got", rec.status)
+	}
+	if rec := serveWith(handler, "GET", "/", credentials("ada", "secret")); rec.status != 200 || string(rec.body) != "hello ada" {
+		t.Error("Expected ada to be let in, got", rec.status, string(rec.body))
+	}
+}
+
+// TestValidateJWT tests signatures for each key type and the registered claims.
+func TestValidateJWT(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	edPublic, edKey, _ := ed25519.GenerateKey(rand.Reader)
+	secret := []byte("shared secret")
+	options := JWTOptions{
+		Keys: map[string]any{
+			"hmac": secret,
+			"rsa":  &rsaKey.PublicKey,
+			"ec":   &ecKey.PublicKey,
+			"ed":   edPublic,
+		},
+		Issuer:   "https://issuer.example",
+		Audience: "api",
+		Leeway:   time.Minute,
+		Clock:    NewFakeClock(now),
+	}
+	valid := map[string]any{"sub": "ada", "iss": "https://issuer.example", "aud": []string{"web", "api"}, "exp": now.Unix() + 60}
+
+	for _, test := range []struct {
+		alg, kid string
+		key      any
+	}{
+		{"HS256", "hmac", secret},
+		{"RS256", "rsa", rsaKey},
+		{"ES256", "ec", ecKey},
+		{"EdDSA", "ed", edKey},
+	} {
+		claims, err := ValidateJWT(signJWT(t, test.alg, test.kid, test.key, valid), options)
+		if err != nil || claims.String("sub") != "ada" {
+			t.Errorf("Expected a valid %s token, got %v, %v.", test.alg, claims, err)
+		}
+	}
+
+	with := func(name string, value any) map[string]any {
+		claims := map[string]any{}
+		for k, v := range valid {
+			claims[k] = v
+		}
+		if value == nil {
+			delete(claims, name)
+		} else {
+			claims[name] = value
+		}
+		return claims
+	}
+	tampered := signJWT(t, "HS256", "hmac", secret, valid)
+	tampered = tampered[:len(tampered)-2] + "AA"
+	rsaPublicBytes := rsaKey.PublicKey.N.Bytes()
+
+	for name, token := range map[string]string{
+		"expired":            signJWT(t, "HS256", "hmac", secret, with("exp", now.Unix()-61)),
+		"not yet valid":      signJWT(t, "HS256", "hmac", secret, with("nbf", now.Unix()+61)),
+		"wrong issuer":       signJWT(t, "HS256", "hmac", secret, with("iss", "https://evil.example")),
+		"wrong audience":     signJWT(t, "HS256", "hmac", secret, with("aud", "web")),
+		"missing audience":   signJWT(t, "HS256", "hmac", secret, with("aud", nil)),
+		"unsigned":           signJWT(t, "none", "hmac", nil, valid),
+		"unknown key":        signJWT(t, "HS256", "other", secret, valid),
+		"tampered":           tampered,
+		"algorithm mismatch": signJWT(t, "HS256", "rsa", rsaPublicBytes, valid),
+		"malformed":          "not.a.token.at.all",
+	} {
+		if _, err := ValidateJWT(token, options); err == nil {
+			t.Errorf("Expected the %s token to be rejected.", name)
+		}
+	}
+
+	if _, err := ValidateJWT(signJWT(t, "HS256", "hmac", secret, with("exp", now.Unix()-30)), options); err != nil {
+		t.Error("Expected the leeway to cover a token just expired, got", err)
+	}
+	options.Algorithms = []string{"RS256"}
+	if _, err := ValidateJWT(signJWT(t, "HS256", "hmac", secret, valid), options); err == nil {
+		t.Error("Expected an algorithm outside the list to be rejected.")
+	}
+}
+
+// TestJWTECDSAKeys tests that ES algorithms only accept keys on their own
+// curve and signatures of exactly that curve's size.
+func TestJWTECDSAKeys(t *testing.T) {
+	sign := func(key *ecdsa.PrivateKey, hash crypto.Hash, size int) []byte {
+		h := hash.New()
+		h.Write([]byte("signed"))
+		r, s, err := ecdsa.Sign(rand.Reader, key, h.Sum(nil))
+		if err != nil {
+			t.Fatal(err)
+		}
+		signature := make([]byte, 2*size)
+		r.FillBytes(signature[:size])
+		s.FillBytes(signature[size:])
+		return signature
+	}
+	p256, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	p384, _ := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	p521, _ := ecdsa.GenerateKey(elliptic.P521(), rand.Reader)
+
+	for _, test := range []struct {
+		alg  string
+		key  *ecdsa.PrivateKey
+		hash crypto.Hash
+		size int
+	}{
+		{"ES256", p256, crypto.SHA256, 32},
+		{"ES384", p384, crypto.SHA384, 48},
+		{"ES512", p521, crypto.SHA512, 66},
+	} {
+		if err := verifyJWTSignature(test.alg, &test.key.PublicKey, "signed", sign(test.key, test.hash, test.size)); err != nil {
+			t.Errorf("Expected a valid %s signature, got %v.", test.alg, err)
+		}
+	}
+
+	for name, test := range map[string]struct {
+		alg       string
+		key       *ecdsa.PrivateKey
+		signature []byte
+	}{
+		"ES384 with a P-256 key": {"ES384", p256, sign(p256, crypto.SHA384, 32)},
+		"ES256 with a P-384 key": {"ES256", p384, sign(p384, crypto.SHA256, 48)},
+		"ES512 with a P-384 key": {"ES512", p384, sign(p384, crypto.SHA512, 48)},
+		"ES256 padded signature": {"ES256", p256, sign(p256, crypto.SHA256, 33)},
+		"ES384 short signature":  {"ES384", p384, sign(p384, crypto.SHA384, 48)[1:]},
+		"ES512 padded signature": {"ES512", p521, append(sign(p521, crypto.SHA512, 66), 0)},
+	} {
+		if err := verifyJWTSignature(test.alg, &test.key.PublicKey, "signed", test.signature); err == nil {
+			t.Errorf("Expected %s to be rejected.", name)
+		}
+	}
+}
+
+// TestJWTAuth tests the middleware's challenges and the claims it passes on.
+func TestJWTAuth(t *testing.T) {
+	secret := []byte("shared secret")
+	handler := JWTAuth(JWTOptions{Keys: map[string]any{"": secret}, Realm: "api"})(HandlerFunc(func(w ResponseWriter, req *ServerRequest) {
+		claims, _ := JWTClaimsFromContext(req.Context())
+		w.Write([]byte(AuthUser(req) + " " + claims.String("role")))
+	}))
+
+	rec := serve(handler, "GET", "/")
+	if rec.status != 401 || rec.headers["WWW-Authenticate"] != `Bearer realm="api"` {
+		t.Error("Expected a challenge, got", rec.status, rec.headers)
+	}
+	rec = serveWith(handler, "GET", "/", map[string]string{"Authorization": "Bearer " + signJWT(t, "HS256", "", []byte("wrong"), map[string]any{})})
+	if rec.status != 401 || !strings.Contains(rec.headers["WWW-Authenticate"], `error="invalid_token"`) {
+		t.Error("Expected an invalid_token challenge, got", rec.status, rec.headers)
+	}
+	token := signJWT(t, "HS256", "", secret, map[string]any{"sub": "ada", "role": "admin"})
+	rec = serveWith(handler, "GET", "/", map[string]string{"Authorization": "Bearer " + token})
+	if rec.status != 200 || string(rec.body) != "ada admin" {
+		t.Error("Expected the claims to reach the handler, got", rec.status, string(rec.body))
+	}
+}
+
+// TestParseJWKS tests reading RSA, EC, and symmetric keys from a key set.
+func TestParseJWKS(t *testing.T) {
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	b64 := func(b []byte) string { return base64.RawURLEncoding.EncodeToString(b) }
+	set, _ := json.Marshal(map[string]any{"keys": []map[string]string{
+		{"kty": "RSA", "kid": "r1", "use": "sig", "n": b64(rsaKey.N.Bytes()), "e": b64(big.NewInt(int64(rsaKey.E)).Bytes())},
+		{"kty": "EC", "kid": "e1", "crv": "P-256", "x": b64(ecKey.X.Bytes()), "y": b64(ecKey.Y.Bytes())},
+		{"kty": "oct", "kid": "s1", "k": b64([]byte("secret"))},
+		{"kty": "RSA", "kid": "enc", "use": "enc", "n": "AQAB", "e": "AQAB"},
+	}})
+
+	keys, err := ParseJWKS(set)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 3 {
+		t.Error("Expected three signing keys, got", len(keys))
+	}
+	if _, err := ValidateJWT(signJWT(t, "RS256", "r1", rsaKey, map[string]any{}), JWTOptions{Keys: keys}); err != nil {
+		t.Error("Expected the RSA key to verify, got", err)
+	}
+	if _, err := ValidateJWT(signJWT(t, "ES256", "e1", ecKey, map[string]any{}), JWTOptions{Keys: keys}); err != nil {
+		t.Error("Expected the EC key to verify, got", err)
+	}
+	if _, err := ParseJWKS([]byte(`{"keys":[{"kty":"EC","crv":"P-256","x":"AQ","y":"AQ"}]}`)); err == nil {
+		t.Error("Expected an error for a point off the curve.")
+	}
+}
@@ -0,0 +1,133 @@
+package httpmodule
+
+import (
+	"io"
+	"sync"
+	"time"
+)
+
+// Largest piece of a transfer sent or read between waits on a limiter
+const maxThrottleChunk = 32 << 10
+
+// BandwidthLimiter caps the rate bytes move through it. One set on HttpClient
+// is shared by all of its requests, limiting them together; one per request
+// limits just that transfer. A limiter can be shared between several clients.
+type BandwidthLimiter struct {
+	// Source of time for pacing; nil uses the real clock
+	Clock Clock
+
+	mu     sync.Mutex
+	rate   int64
+	tokens float64
+	last   time.Time
+}
+
+// NewBandwidthLimiter returns a limiter allowing bytesPerSecond on average;
+// zero or less lets bytes through unlimited
+func NewBandwidthLimiter(bytesPerSecond int64) *BandwidthLimiter {
+	return &BandwidthLimiter{rate: bytesPerSecond}
+}
+
+// SetRate changes the limit, such as to give way during office hours; zero or
+// less lets bytes through unlimited
+func (l *BandwidthLimiter) SetRate(bytesPerSecond int64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.rate = bytesPerSecond
+	l.tokens = 0
+	l.last = time.Time{}
+}
+
+// Rate returns the limit in bytes per second
+func (l *BandwidthLimiter) Rate() int64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.rate
+}
+
+// chunk returns how many bytes to move before waiting again: a tenth of a
+// second's worth, so transfers stay smooth rather than bursting
+func (l *BandwidthLimiter) chunk() int {
+	rate := l.Rate()
+	switch {
+	case rate <= 0 || rate/10 > maxThrottleChunk:
+		return maxThrottleChunk
+	case rate < 10:
+		return 1
+	}
+	return int(rate / 10)
+}
+
+// wait accounts for n bytes, blocking until the rate allows them. Bytes are
+// taken on credit, so a limiter shared by several transfers divides the rate
+// between them rather than letting each go at full speed.
+func (l *BandwidthLimiter) wait(n int) {
+	clock := clockOrReal(l.Clock)
+	l.mu.Lock()
+	if l.rate <= 0 {
+		l.mu.Unlock()
+		return
+	}
+	now := clock.Now()
+	if !l.last.IsZero() {
+		l.tokens += now.Sub(l.last).Seconds() * float64(l.rate)
+	}
+	// At most a tenth of a second's worth saved up from idle time
+	if burst := float64(l.rate) / 10; l.tokens > burst {
+		l.tokens = burst
+	}
+	l.last = now
+	l.tokens -= float64(n)
+	delay := time.Duration(-l.tokens / float64(l.rate) * float64(time.Second))
+	l.mu.Unlock()
+
+	if delay > 0 {
+		<-clock.After(delay)
+	}
+}
+
+// throttledWriter writes through limits, waiting before each chunk
+type throttledWriter struct {
+	w      io.Writer
+	limits []*BandwidthLimiter
+}
+
+func (tw *throttledWriter) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		n := throttleChunk(tw.limits, len(p))
+		for _, l := range tw.limits {
+			l.wait(n)
+		}
+		m, err := tw.w.Write(p[:n])
+		written += m
+		if err != nil {
+			return written, err
+		}
+		p = p[n:]
+	}
+	return written, nil
+}
+
+// throttleChunk returns how much of size to move at once under limits
+func throttleChunk(limits []*BandwidthLimiter, size int) int {
+	for _, l := range limits {
+		if c := l.chunk(); c < size {
+			size = c
+		}
+	}
+	return size
+}
+
+// bandwidthLimits returns the limiters req's transfer goes through: the
+// client's and the request's own, if any
+func (client *HttpClient) bandwidthLimits(req *HttpRequest) []*BandwidthLimiter {
+	var limits []*BandwidthLimiter
+	if client.BandwidthLimit != nil {
+		limits = append(limits, client.BandwidthLimit)
+	}
+	if req.BandwidthLimit != nil {
+		limits = append(limits, req.BandwidthLimit)
+	}
+	return limits
+}
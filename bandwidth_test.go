@@ -0,0 +1,106 @@
+package httpmodule
+
+import (
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestBandwidthLimiterWait tests that bytes over the rate wait for time to pass.
+func TestBandwidthLimiterWait(t *testing.T) {
+	clock := NewFakeClock(time.Unix(1700000000, 0))
+	limiter := NewBandwidthLimiter(1000)
+	limiter.Clock = clock
+
+	done := make(chan struct{})
+	go func() {
+		limiter.wait(500)
+		close(done)
+	}()
+	for clock.Waiters() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	clock.Advance(400 * time.Millisecond)
+	select {
+	case <-done:
+		t.Fatal("Expected 500 bytes at 1000 a second to take half a second.")
+	case <-time.After(20 * time.Millisecond):
+	}
+	clock.Advance(100 * time.Millisecond)
+	<-done
+
+	// Idle time only saves up a tenth of a second's worth
+	clock.Advance(time.Hour)
+	limiter.wait(100)
+	if clock.Waiters() != 0 {
+		t.Error("Expected a small transfer after a pause not to wait.")
+	}
+
+	limiter.SetRate(0)
+	limiter.wait(1 << 30)
+	if limiter.Rate() != 0 || clock.Waiters() != 0 {
+		t.Error("Expected no wait without a limit.")
+	}
+}
+
+// TestBandwidthLimiterChunk tests the size of the pieces transfers move in.
+func TestBandwidthLimiterChunk(t *testing.T) {
+	tests := []struct {
+		rate  int64
+		chunk int
+	}{
+		{0, maxThrottleChunk},
+		{5, 1},
+		{1000, 100},
+		{1 << 30, maxThrottleChunk},
+	}
+	for _, test := range tests {
+		if chunk := NewBandwidthLimiter(test.rate).chunk(); chunk != test.chunk {
+			t.Errorf("Expected chunks of %d at %d bytes a second, got %d.", test.chunk, test.rate, chunk)
+		}
+	}
+}
+
+// TestClientBandwidthLimit tests that client and request limits pace transfers.
+func TestClientBandwidthLimit(t *testing.T) {
+	payload := strings.Repeat("x", 40<<10)
+	_, addr := startServer(t, HandlerFunc(func(w ResponseWriter, req *ServerRequest) {
+		io.Copy(io.Discard, req.Body)
+		w.Write([]byte(payload))
+	}))
+	client := New()
+	client.Transport = loopbackTransport(t, client, addr)
+
+	start := time.Now()
+	if _, err := client.Get("http://"+addr+"/", nil); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed > 150*time.Millisecond {
+		t.Fatal("Expected an unlimited request to be quick, took", elapsed)
+	}
+
+	client.BandwidthLimit = NewBandwidthLimiter(100 << 10)
+	start = time.Now()
+	response, err := client.Get("http://"+addr+"/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed < 300*time.Millisecond {
+		t.Error("Expected 40 KiB at 100 KiB a second to take about 0.4s, took", elapsed)
+	}
+	if response.Body != payload {
+		t.Error("Expected the whole body.")
+	}
+
+	// A request's own limit paces both the upload and the response
+	client.BandwidthLimit = nil
+	start = time.Now()
+	_, err = client.do(&HttpRequest{Method: "POST", URL: "http://" + addr + "/", Body: payload[:20<<10], BandwidthLimit: NewBandwidthLimiter(50 << 10)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed < 600*time.Millisecond {
+		t.Error("Expected 60 KiB at 50 KiB a second to take about 1.2s, took", elapsed)
+	}
+}
@@ -0,0 +1,86 @@
+package httpmodule
+
+import (
+	"context"
+	"sync"
+)
+
+// Number of requests DoBatch runs at once when BatchOptions.Concurrency is zero
+const defaultBatchConcurrency = 4
+
+type BatchOptions struct {
+	// Maximum number of requests in flight at once; zero means 4
+	Concurrency int
+
+	// Stop starting new requests after the first failure and return that error.
+	// Otherwise every request is attempted and failures are reported per result.
+	FailFast bool
+}
+
+type BatchResult struct {
+	Response *HttpResponse
+	Err      error
+}
+
+// DoBatch sends requests through a bounded pool of workers. Results are returned
+// in the same order as requests. Requests that were never started because ctx
+// was cancelled, or because an earlier request failed in fail-fast mode, carry
+// the corresponding error in their result.
+func (client *HttpClient) DoBatch(ctx context.Context, requests []*HttpRequest, opts BatchOptions) ([]BatchResult, error) {
+	concurrency := opts.Concurrency
+	if concurrency <= 0 {
+		concurrency = defaultBatchConcurrency
+	}
+	if concurrency > len(requests) {
+		concurrency = len(requests)
+	}
+
+	// Requests in flight only answer to the caller's ctx; failing fast just
+	// stops new ones, and responses outlive the call
+	parent := ctx
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	results := make([]BatchResult, len(requests))
+	var firstErr error
+	var errOnce sync.Once
+
+	// Workers pull indexes so each result lands in its request's slot
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for index := range indexes {
+				if err := ctx.Err(); err != nil {
+					results[index].Err = err
+					continue
+				}
+				req := requests[index]
+				if req.ctx == nil {
+					req = req.WithContext(parent)
+				}
+				response, err := client.do(req)
+				results[index] = BatchResult{Response: response, Err: err}
+				if err != nil && opts.FailFast {
+					errOnce.Do(func() {
+						firstErr = err
+						cancel()
+					})
+				}
+			}
+		}()
+	}
+
+	for index := range requests {
+		indexes <- index
+	}
+	close(indexes)
+	wg.Wait()
+
+	if firstErr != nil {
+		return results, firstErr
+	}
+	return results, ctx.Err()
+}
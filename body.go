@@ -0,0 +1,299 @@
+package httpmodule
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"hash"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Unread bodies up to this size are drained on Close so the connection can be
+// reused; anything bigger is cheaper to abandon along with the connection
+const maxDrainSize = 256 << 10
+
+// bodyReader decodes a message body as it is read, according to the framing
+// announced in the headers: chunked, Content-Length, or until EOF.
+type bodyReader struct {
+	reader  *bufio.Reader
+	chunked bool
+	strict  bool
+
+	// Bytes left in the current chunk or in the body; -1 reads until EOF
+	remaining int64
+
+	// Set once a chunk has been read, so the CRLF after it gets consumed
+	inChunk bool
+
+	err error
+}
+
+func newBodyReader(reader *bufio.Reader, headers map[string]string, strict bool) (*bodyReader, error) {
+	// Check for "Transfer-Encoding: chunked"
+	if isChunked(headers) {
+		return &bodyReader{reader: reader, chunked: true, strict: strict}, nil
+	}
+
+	// Check for "Content-Length" header
+	if contentLength, ok := lookupHeader(headers, "Content-Length"); ok {
+		length, err := strconv.ParseInt(contentLength, 10, 64)
+		if err != nil || length < 0 {
+			return nil, protocolError("invalid Content-Length header")
+		}
+		return &bodyReader{reader: reader, remaining: length, strict: strict}, nil
+	}
+
+	// If neither header is present, read until EOF (not recommended for real-world use)
+	return &bodyReader{reader: reader, remaining: -1, strict: strict}, nil
+}
+
+// isChunked reports whether chunked is the final transfer coding, which is
+// what decides the framing when several codings are listed
+func isChunked(headers map[string]string) bool {
+	codings := headerValue(headers, "Transfer-Encoding")
+	if codings == "" {
+		return false
+	}
+	last := codings[strings.LastIndexByte(codings, ',')+1:]
+	return strings.EqualFold(strings.TrimSpace(last), "chunked")
+}
+
+func (body *bodyReader) Read(p []byte) (int, error) {
+	if body.err != nil {
+		return 0, body.err
+	}
+	if body.chunked && body.remaining == 0 {
+		if err := body.nextChunk(); err != nil {
+			body.err = err
+			return 0, err
+		}
+	}
+	if body.remaining == 0 {
+		body.err = io.EOF
+		return 0, io.EOF
+	}
+
+	if body.remaining > 0 && int64(len(p)) > body.remaining {
+		p = p[:body.remaining]
+	}
+	n, err := body.reader.Read(p)
+	if body.remaining > 0 {
+		body.remaining -= int64(n)
+		if err == io.EOF {
+			if body.remaining > 0 {
+				err = io.ErrUnexpectedEOF
+			} else {
+				// The body is complete; report EOF on the next call
+				err = nil
+			}
+		}
+	}
+	if err != nil {
+		body.err = err
+	}
+	return n, err
+}
+
+// nextChunk reads the next chunk header. It returns io.EOF after the last chunk
+// and its trailers have been consumed.
+func (body *bodyReader) nextChunk() error {
+	if body.inChunk {
+		// Read trailing CRLF after chunk; lenient parsing skips whatever is there
+		line, err := body.reader.ReadSlice('\n')
+		if body.strict && string(line) != "\r\n" {
+			if err == io.EOF {
+				return io.ErrUnexpectedEOF
+			}
+			return protocolError("malformed chunk: missing CR LF after chunk data")
+		}
+	}
+
+	// Read chunk size
+	sizeLine, err := body.reader.ReadSlice('\n')
+	if err != nil {
+		if err == io.EOF {
+			return io.ErrUnexpectedEOF
+		}
+		if err == bufio.ErrBufferFull {
+			return protocolError("invalid chunk size")
+		}
+		return err
+	}
+	if body.strict && !bytes.HasSuffix(sizeLine, []byte("\r\n")) {
+		return protocolError("malformed chunk: missing CR LF after chunk size")
+	}
+
+	// Drop chunk extensions, which carry nothing we use
+	if semicolon := bytes.IndexByte(sizeLine, ';'); semicolon >= 0 {
+		sizeLine = sizeLine[:semicolon]
+	}
+
+	// Convert chunk size from hex to int64
+	size, ok := parseHex(bytes.TrimSpace(sizeLine))
+	if !ok {
+		return protocolError("invalid chunk size")
+	}
+
+	// Check for last chunk
+	if size == 0 {
+		// Read trailing headers after last chunk
+		for {
+			line, err := body.reader.ReadSlice('\n')
+			if err != nil && err != io.EOF && err != bufio.ErrBufferFull {
+				return err
+			}
+			if string(line) == "\r\n" {
+				break
+			}
+			if err == io.EOF {
+				if body.strict {
+					return io.ErrUnexpectedEOF
+				}
+				break
+			}
+		}
+		return io.EOF
+	}
+
+	body.remaining = size
+	body.inChunk = true
+	return nil
+}
+
+// parseHex parses a chunk size. Sizes that don't fit in an int64 are rejected
+// rather than wrapping around.
+func parseHex(b []byte) (int64, bool) {
+	if len(b) == 0 || len(b) > 15 {
+		return 0, false
+	}
+	var n int64
+	for _, c := range b {
+		switch {
+		case c >= '0' && c <= '9':
+			n = n<<4 | int64(c-'0')
+		case c >= 'a' && c <= 'f':
+			n = n<<4 | int64(c-'a'+10)
+		case c >= 'A' && c <= 'F':
+			n = n<<4 | int64(c-'A'+10)
+		default:
+			return 0, false
+		}
+	}
+	return n, true
+}
+
+// deferredBody is the part of a response that hasn't been read yet. release
+// hands the connection back once the body is finished with; reuse is false when
+// the body wasn't consumed cleanly and the connection has to be closed.
+type deferredBody struct {
+	*bodyReader
+	release func(reuse bool)
+
+	// Fed every byte of the body as it is read, after decoding
+	hashes []hash.Hash
+
+	// Undoes the body's Content-Encoding; nil reads it as it is
+	decoder io.Reader
+
+	// Pace reading the body
+	limits []*BandwidthLimiter
+
+	// The request's context, whose error replaces the one reading fails with
+	// once it is cancelled
+	ctx context.Context
+
+	// Reports the bytes read, if the request asked for progress
+	progress *transferMeter
+}
+
+func (body *deferredBody) Read(p []byte) (int, error) {
+	var n int
+	var err error
+	if body.decoder != nil {
+		n, err = body.decoder.Read(p)
+	} else {
+		n, err = body.readRaw(p)
+	}
+	for _, h := range body.hashes {
+		h.Write(p[:n])
+	}
+	return n, err
+}
+
+// readRaw reads the body as it came off the wire, before any decoding
+func (body *deferredBody) readRaw(p []byte) (int, error) {
+	if len(body.limits) > 0 {
+		p = p[:throttleChunk(body.limits, len(p))]
+	}
+	n, err := body.bodyReader.Read(p)
+	for _, l := range body.limits {
+		l.wait(n)
+	}
+	body.progress.add(n)
+	if err != nil && err != io.EOF && body.ctx != nil {
+		err = contextError(body.ctx, err)
+	}
+	return n, err
+}
+
+func (body *deferredBody) finish(reuse bool) {
+	if body.release != nil {
+		body.release(reuse)
+		body.release = nil
+	}
+}
+
+// ReadBody reads the rest of a deferred body into Body and releases the
+// connection. For responses that were read in full it just returns Body.
+func (response *HttpResponse) ReadBody() (string, error) {
+	if response.body == nil {
+		return response.Body, nil
+	}
+
+	// Read body into a pooled buffer; it only becomes a string once, below
+	buf := getBuffer()
+	defer putBuffer(buf)
+	_, err := io.Copy(buf, response.body)
+	response.body.finish(err == nil)
+	response.body = nil
+	if err != nil {
+		return "", err
+	}
+
+	response.Body = buf.String()
+	return response.Body, nil
+}
+
+// BodyStream returns the body as a stream. A deferred body is read straight
+// from the connection, decoded as Body would be, and the connection is kept
+// until the stream is closed; a body already read is read from Body.
+func (response *HttpResponse) BodyStream() io.ReadCloser {
+	if response.body == nil {
+		return io.NopCloser(strings.NewReader(response.Body))
+	}
+	return &responseBody{response}
+}
+
+// Close discards any unread part of a deferred body so the connection can go
+// back to the pool. It is safe to call on any response, any number of times.
+func (response *HttpResponse) Close() error {
+	if response.body == nil {
+		return nil
+	}
+	body := response.body
+	response.body = nil
+
+	_, err := io.CopyN(io.Discard, body, maxDrainSize)
+	if err == io.EOF {
+		body.finish(true)
+		return nil
+	}
+	// Either the body was too big to drain or the connection broke
+	body.finish(false)
+	if err == nil {
+		return nil
+	}
+	return err
+}
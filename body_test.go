@@ -0,0 +1,173 @@
+package httpmodule
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"hash"
+	"io"
+	"strings"
+	"testing"
+)
+
+// TestBodyReaderChunked tests decoding a chunked body with trailers.
+func TestBodyReaderChunked(t *testing.T) {
+	raw := "5\r\nhello\r\n7\r\n, world\r\n0\r\nX-Trailer: 1\r\n\r\nNEXT"
+	reader := bufio.NewReader(strings.NewReader(raw))
+	body, err := newBodyReader(reader, map[string]string{"Transfer-Encoding": "chunked"}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := io.ReadAll(body)
+	if err != nil {
+		t.Error("Expected nil error.", err)
+	}
+	if string(decoded) != "hello, world" {
+		t.Errorf("Expected decoded body, got %q.", decoded)
+	}
+
+	// The reader must be positioned right after the message
+	rest, _ := io.ReadAll(reader)
+	if string(rest) != "NEXT" {
+		t.Errorf("Expected remaining bytes to be untouched, got %q.", rest)
+	}
+}
+
+// TestBodyReaderTruncated tests that a body cut short is reported as an error.
+func TestBodyReaderTruncated(t *testing.T) {
+	tests := []struct {
+		raw     string
+		headers map[string]string
+	}{
+		{"hel", map[string]string{"Content-Length": "5"}},
+		{"5\r\nhel", map[string]string{"Transfer-Encoding": "chunked"}},
+		{"5\r\nhello\r\n", map[string]string{"Transfer-Encoding": "chunked"}},
+	}
+	for _, test := range tests {
+		body, err := newBodyReader(bufio.NewReader(strings.NewReader(test.raw)), test.headers, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := io.ReadAll(body); err != io.ErrUnexpectedEOF {
+			t.Errorf("Expected unexpected EOF for %q, got %v.", test.raw, err)
+		}
+	}
+}
+
+// TestDeferredBody tests reading a response whose body is deferred.
+func TestDeferredBody(t *testing.T) {
+	raw := "HTTP/1.1 200 OK\r\nContent-Length: 5\r\n\r\nhello"
+	response, keepAlive, err := readResponseHead(bufio.NewReader(strings.NewReader(raw)), "GET", ParseOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !keepAlive {
+		t.Error("Expected keep-alive for a delimited HTTP/1.1 body.")
+	}
+
+	released := false
+	response.body.release = func(reuse bool) { released = reuse }
+	if response.Body != "" {
+		t.Error("Expected empty Body before ReadBody.")
+	}
+	body, err := response.ReadBody()
+	if err != nil || body != "hello" || response.Body != "hello" {
+		t.Error("Expected body to be read.", body, err)
+	}
+	if !released {
+		t.Error("Expected the connection to be released for reuse.")
+	}
+}
+
+// TestDeferredBodyClose tests that Close drains the body and releases the connection.
+func TestDeferredBodyClose(t *testing.T) {
+	raw := "HTTP/1.1 200 OK\r\nTransfer-Encoding: chunked\r\n\r\n3\r\nabc\r\n0\r\n\r\n"
+	response, _, err := readResponseHead(bufio.NewReader(strings.NewReader(raw)), "GET", ParseOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	released := false
+	response.body.release = func(reuse bool) { released = reuse }
+	if err := response.Close(); err != nil {
+		t.Error("Expected nil error.", err)
+	}
+	if !released {
+		t.Error("Expected the connection to be released for reuse.")
+	}
+}
+
+// TestDeferredBodyHashes tests that registered hashes see the body as it is read.
+func TestDeferredBodyHashes(t *testing.T) {
+	raw := "HTTP/1.1 200 OK\r\nTransfer-Encoding: chunked\r\n\r\n3\r\nabc\r\n3\r\ndef\r\n0\r\n\r\n"
+	response, _, err := readResponseHead(bufio.NewReader(strings.NewReader(raw)), "GET", ParseOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := sha256.New()
+	response.body.hashes = []hash.Hash{h}
+	if _, err := response.ReadBody(); err != nil {
+		t.Fatal(err)
+	}
+	expected := sha256.Sum256([]byte("abcdef"))
+	if !bytes.Equal(h.Sum(nil), expected[:]) {
+		t.Error("Expected hash of the decoded body.")
+	}
+}
+
+// TestBodyStream tests reading a response body as a stream.
+func TestBodyStream(t *testing.T) {
+	raw := "HTTP/1.1 200 OK\r\nTransfer-Encoding: chunked\r\n\r\n5\r\nhello\r\n7\r\n, world\r\n0\r\n\r\n"
+	response, _, err := readResponseHead(bufio.NewReader(strings.NewReader(raw)), "GET", ParseOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	released := false
+	response.body.release = func(reuse bool) { released = reuse }
+
+	stream := response.BodyStream()
+	first := make([]byte, 5)
+	if _, err := io.ReadFull(stream, first); err != nil || string(first) != "hello" {
+		t.Errorf("Expected the start of the body, got %q, %v", first, err)
+	}
+	if released {
+		t.Error("Expected the connection to be kept while the stream is open.")
+	}
+	rest, err := io.ReadAll(stream)
+	if err != nil || string(rest) != ", world" {
+		t.Errorf("Expected the rest of the body, got %q, %v", rest, err)
+	}
+	stream.Close()
+	if !released {
+		t.Error("Expected closing the stream to release the connection.")
+	}
+
+	// A body that was read in full streams from Body
+	read := &HttpResponse{Body: "done"}
+	if body, _ := io.ReadAll(read.BodyStream()); string(body) != "done" {
+		t.Errorf("Expected Body as a stream, got %q", body)
+	}
+}
+
+// TestGetStream tests that GetStream leaves the body on the connection.
+func TestGetStream(t *testing.T) {
+	payload := strings.Repeat("x", 1<<20)
+	_, addr := startServer(t, HandlerFunc(func(w ResponseWriter, req *ServerRequest) {
+		w.Write([]byte(payload))
+	}))
+	client := New()
+	client.HostOverrides = map[string]string{"stream.test": addr}
+
+	response, err := client.GetStream("http://stream.test/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response.Body != "" {
+		t.Error("Expected the body not to be read up front.")
+	}
+	stream := response.BodyStream()
+	n, err := io.Copy(io.Discard, stream)
+	if err != nil || n != int64(len(payload)) {
+		t.Error("Expected the whole body from the stream, got", n, err)
+	}
+	stream.Close()
+}
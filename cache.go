@@ -0,0 +1,457 @@
+package httpmodule
+
+import (
+	"container/list"
+	"net/http"
+	neturl "net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ResponseCache keeps responses to GET requests and answers repeats of them
+// as RFC 9111 allows: fresh entries are returned without contacting the
+// server, and stale ones are revalidated with If-None-Match or
+// If-Modified-Since, a 304 answer returning the stored body. Freshness comes
+// from Cache-Control's max-age, or Expires, or failing both a tenth of the
+// time since Last-Modified. Bodies of responses it stores are read in full,
+// so it suits API responses rather than large downloads.
+type ResponseCache struct {
+	// Where entries are kept; nil keeps them in memory without bound
+	Store CacheStore
+
+	// Behave as a cache shared between users, such as a proxy's: responses
+	// marked private aren't stored, s-maxage is honoured, and responses to
+	// requests carrying Authorization are only stored when marked public
+	Shared bool
+
+	// Source of time for working out freshness; nil uses the client's clock
+	Clock Clock
+
+	once sync.Once
+}
+
+// CacheStore holds a ResponseCache's entries by key. It must be safe for
+// concurrent use.
+type CacheStore interface {
+	Get(key string) (*CachedResponse, bool)
+	Set(key string, entry *CachedResponse)
+	Delete(key string)
+}
+
+// CachedResponse is a response held by a ResponseCache
+type CachedResponse struct {
+	Protocol   string
+	StatusCode int
+	Status     string
+	Headers    map[string]string
+	Body       string
+
+	// When the request was sent and when its response arrived, for working
+	// out the response's age
+	RequestTime  time.Time
+	ResponseTime time.Time
+
+	// Values the request had for the headers named in the response's Vary,
+	// by lowercase name; a request must have the same ones to be answered
+	Vary map[string]string
+}
+
+// NewResponseCache returns a cache keeping entries in store, or in memory
+// without bound when store is nil
+func NewResponseCache(store CacheStore) *ResponseCache {
+	return &ResponseCache{Store: store}
+}
+
+// Statuses whose responses may be stored without explicit freshness
+// information (RFC 9110, section 15.1)
+var heuristicallyCacheable = map[int]bool{
+	200: true, 203: true, 204: true, 300: true, 301: true, 308: true,
+	404: true, 405: true, 410: true, 414: true, 501: true,
+}
+
+// withCache wraps transport to answer requests from the cache and fill it
+func (cache *ResponseCache) withCache(transport Transport, clock Clock) Transport {
+	cache.once.Do(func() {
+		if cache.Store == nil {
+			cache.Store = NewMemoryCacheStore(0)
+		}
+	})
+	if cache.Clock != nil {
+		clock = cache.Clock
+	}
+	clock = clockOrReal(clock)
+	return RoundTripFunc(func(req *HttpRequest) (*HttpResponse, error) {
+		key := cacheKey(req.URL)
+		if req.Method != "GET" || req.BodyReader != nil || req.Body != "" {
+			response, err := transport.RoundTrip(req)
+			if err == nil && !safeMethod(req.Method) && response.StatusCode < 400 {
+				// Requests that change the resource invalidate what is stored for it
+				cache.Store.Delete(key)
+			}
+			return response, err
+		}
+
+		reqControl := parseCacheControl(headerValue(req.Headers, "Cache-Control"))
+		if len(reqControl) == 0 && strings.EqualFold(headerValue(req.Headers, "Pragma"), "no-cache") {
+			reqControl["no-cache"] = ""
+		}
+		if _, ok := reqControl["no-store"]; ok {
+			return transport.RoundTrip(req)
+		}
+		if headerValue(req.Headers, "If-None-Match") != "" || headerValue(req.Headers, "If-Modified-Since") != "" {
+			// The caller is revalidating its own copy
+			return transport.RoundTrip(req)
+		}
+		if headerValue(req.Headers, "Range") != "" {
+			// Parts of a resource are neither served from nor stored as the whole
+			return transport.RoundTrip(req)
+		}
+
+		entry, ok := cache.Store.Get(key)
+		if ok && !entry.varyMatches(req) {
+			entry, ok = nil, false
+		}
+		if ok && !cache.mustRevalidate(entry, reqControl, clock.Now()) {
+			return entry.response(clock.Now()), nil
+		}
+		if _, onlyIfCached := reqControl["only-if-cached"]; onlyIfCached {
+			return &HttpResponse{StatusCode: 504, Status: "Gateway Timeout", Headers: map[string]string{}}, nil
+		}
+
+		outgoing := req
+		if ok {
+			outgoing = req.Clone()
+			if etag := headerValue(entry.Headers, "ETag"); etag != "" {
+				outgoing.setHeader("If-None-Match", etag)
+			}
+			if modified := headerValue(entry.Headers, "Last-Modified"); modified != "" {
+				outgoing.setHeader("If-Modified-Since", modified)
+			}
+		}
+		requestTime := clock.Now()
+		response, err := transport.RoundTrip(outgoing)
+		if err != nil {
+			return nil, err
+		}
+		responseTime := clock.Now()
+
+		if ok && response.StatusCode == 304 {
+			response.Close()
+			entry = entry.freshened(response.Headers, requestTime, responseTime)
+			cache.Store.Set(key, entry)
+			return entry.response(clock.Now()), nil
+		}
+		if !cache.storable(req, response) {
+			cache.Store.Delete(key)
+			return response, nil
+		}
+		if _, err := response.ReadBody(); err != nil {
+			return nil, err
+		}
+		cache.Store.Set(key, &CachedResponse{
+			Protocol:     response.Protocol,
+			StatusCode:   response.StatusCode,
+			Status:       response.Status,
+			Headers:      copyHeaders(response.Headers),
+			Body:         response.Body,
+			RequestTime:  requestTime,
+			ResponseTime: responseTime,
+			Vary:         varyValues(req, response.Headers),
+		})
+		return response, nil
+	})
+}
+
+// storable reports whether response to req may be stored (RFC 9111, section 3)
+func (cache *ResponseCache) storable(req *HttpRequest, response *HttpResponse) bool {
+	if response.StatusCode == 206 {
+		// A partial response would be served in place of the whole resource
+		return false
+	}
+	control := parseCacheControl(headerValue(response.Headers, "Cache-Control"))
+	if _, ok := control["no-store"]; ok {
+		return false
+	}
+	if strings.TrimSpace(headerValue(response.Headers, "Vary")) == "*" {
+		return false
+	}
+	_, public := control["public"]
+	if cache.Shared {
+		if _, ok := control["private"]; ok {
+			return false
+		}
+		if headerValue(req.Headers, "Authorization") != "" {
+			_, sMaxAge := control["s-maxage"]
+			_, mustRevalidate := control["must-revalidate"]
+			if !public && !sMaxAge && !mustRevalidate {
+				return false
+			}
+		}
+	}
+	_, explicit := control["max-age"]
+	if _, ok := control["s-maxage"]; ok && cache.Shared {
+		explicit = true
+	}
+	if headerValue(response.Headers, "Expires") != "" {
+		explicit = true
+	}
+	if !heuristicallyCacheable[response.StatusCode] && !public && !explicit {
+		return false
+	}
+	// Without freshness or a validator the entry could never be used
+	return explicit || headerValue(response.Headers, "ETag") != "" || headerValue(response.Headers, "Last-Modified") != ""
+}
+
+// safeMethod reports whether method only retrieves, leaving stored responses valid
+func safeMethod(method string) bool {
+	switch method {
+	case "GET", "HEAD", "OPTIONS", "TRACE":
+		return true
+	}
+	return false
+}
+
+// mustRevalidate reports whether entry has to be checked with the server
+// before it is used, being stale or the request asking for it to be
+func (cache *ResponseCache) mustRevalidate(entry *CachedResponse, reqControl map[string]string, now time.Time) bool {
+	if _, ok := reqControl["no-cache"]; ok {
+		return true
+	}
+	control := parseCacheControl(headerValue(entry.Headers, "Cache-Control"))
+	if _, ok := control["no-cache"]; ok {
+		return true
+	}
+	if cache.Shared {
+		if _, ok := control["private"]; ok {
+			return true
+		}
+	}
+
+	age := entry.age(now)
+	lifetime := cache.freshnessLifetime(entry, control)
+	if maxAge, ok := deltaSeconds(reqControl, "max-age"); ok && maxAge < lifetime {
+		lifetime = maxAge
+	}
+	if minFresh, ok := deltaSeconds(reqControl, "min-fresh"); ok {
+		age += minFresh
+	}
+	return age >= lifetime
+}
+
+// freshnessLifetime returns how long entry stays fresh after it was
+// generated (RFC 9111, section 4.2.1)
+func (cache *ResponseCache) freshnessLifetime(entry *CachedResponse, control map[string]string) time.Duration {
+	if cache.Shared {
+		if lifetime, ok := deltaSeconds(control, "s-maxage"); ok {
+			return lifetime
+		}
+	}
+	if lifetime, ok := deltaSeconds(control, "max-age"); ok {
+		return lifetime
+	}
+	date, hasDate := parseHTTPDate(headerValue(entry.Headers, "Date"))
+	if !hasDate {
+		date = entry.ResponseTime
+	}
+	if expires := headerValue(entry.Headers, "Expires"); expires != "" {
+		// An invalid date, such as "0", means already expired
+		if t, ok := parseHTTPDate(expires); ok && t.After(date) {
+			return t.Sub(date)
+		}
+		return 0
+	}
+	if _, public := control["public"]; heuristicallyCacheable[entry.StatusCode] || public {
+		if modified, ok := parseHTTPDate(headerValue(entry.Headers, "Last-Modified")); ok && modified.Before(date) {
+			return date.Sub(modified) / 10
+		}
+	}
+	return 0
+}
+
+// age returns how old entry is at now (RFC 9111, section 4.2.3)
+func (entry *CachedResponse) age(now time.Time) time.Duration {
+	var apparent time.Duration
+	if date, ok := parseHTTPDate(headerValue(entry.Headers, "Date")); ok && entry.ResponseTime.After(date) {
+		apparent = entry.ResponseTime.Sub(date)
+	}
+	corrected := entry.ResponseTime.Sub(entry.RequestTime)
+	if seconds, err := strconv.ParseInt(strings.TrimSpace(headerValue(entry.Headers, "Age")), 10, 64); err == nil && seconds > 0 {
+		corrected += time.Duration(seconds) * time.Second
+	}
+	initial := apparent
+	if corrected > initial {
+		initial = corrected
+	}
+	return initial + now.Sub(entry.ResponseTime)
+}
+
+// response returns a response built from entry, with its Age at now
+func (entry *CachedResponse) response(now time.Time) *HttpResponse {
+	headers := copyHeaders(entry.Headers)
+	deleteHeader(headers, "Age")
+	headers["Age"] = strconv.FormatInt(int64(entry.age(now)/time.Second), 10)
+	return &HttpResponse{
+		Protocol:   entry.Protocol,
+		StatusCode: entry.StatusCode,
+		Status:     entry.Status,
+		Headers:    headers,
+		Body:       entry.Body,
+	}
+}
+
+// freshened returns a copy of entry updated with the headers of a 304
+// response that revalidated it (RFC 9111, section 4.3.4)
+func (entry *CachedResponse) freshened(headers map[string]string, requestTime, responseTime time.Time) *CachedResponse {
+	updated := *entry
+	updated.Headers = copyHeaders(entry.Headers)
+	for k, v := range headers {
+		switch http.CanonicalHeaderKey(k) {
+		case "Content-Length", "Content-Encoding", "Transfer-Encoding", "Connection", "Keep-Alive":
+			// These describe the 304 itself, not the stored body
+			continue
+		}
+		deleteHeader(updated.Headers, k)
+		updated.Headers[k] = v
+	}
+	updated.RequestTime = requestTime
+	updated.ResponseTime = responseTime
+	return &updated
+}
+
+// varyMatches reports whether req has the header values entry was stored for
+func (entry *CachedResponse) varyMatches(req *HttpRequest) bool {
+	for name, value := range entry.Vary {
+		if headerValue(req.Headers, name) != value {
+			return false
+		}
+	}
+	return true
+}
+
+// varyValues returns the values req has for the headers the response's Vary
+// names
+func varyValues(req *HttpRequest, headers map[string]string) map[string]string {
+	vary := headerValue(headers, "Vary")
+	if vary == "" {
+		return nil
+	}
+	values := make(map[string]string)
+	for _, name := range strings.Split(vary, ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name != "" {
+			values[name] = headerValue(req.Headers, name)
+		}
+	}
+	return values
+}
+
+// cacheKey returns the key entries for url are stored under: the URL
+// without its fragment
+func cacheKey(url string) string {
+	if u, err := neturl.Parse(url); err == nil {
+		u.Fragment, u.RawFragment = "", ""
+		return u.String()
+	}
+	return url
+}
+
+// parseCacheControl returns the directives in a Cache-Control value by
+// lowercase name, with their arguments unquoted
+func parseCacheControl(value string) map[string]string {
+	directives := make(map[string]string)
+	for _, part := range strings.Split(value, ",") {
+		name, arg, _ := strings.Cut(strings.TrimSpace(part), "=")
+		if name == "" {
+			continue
+		}
+		directives[strings.ToLower(name)] = strings.Trim(arg, `"`)
+	}
+	return directives
+}
+
+// deltaSeconds returns the number of seconds a directive gives as a duration
+func deltaSeconds(directives map[string]string, name string) (time.Duration, bool) {
+	arg, ok := directives[name]
+	if !ok {
+		return 0, false
+	}
+	seconds, err := strconv.ParseInt(arg, 10, 64)
+	if err != nil || seconds < 0 {
+		// An invalid max-age means the response is stale
+		return 0, true
+	}
+	if seconds > int64(1<<31) {
+		seconds = 1 << 31
+	}
+	return time.Duration(seconds) * time.Second, true
+}
+
+func copyHeaders(headers map[string]string) map[string]string {
+	copied := make(map[string]string, len(headers))
+	for k, v := range headers {
+		copied[k] = v
+	}
+	return copied
+}
+
+// MemoryCacheStore is a CacheStore in memory that holds up to a set number
+// of entries, dropping the least recently used ones to make room
+type MemoryCacheStore struct {
+	mu         sync.Mutex
+	maxEntries int
+	entries    map[string]*list.Element
+	order      *list.List // most recently used first
+}
+
+type memoryCacheItem struct {
+	key   string
+	entry *CachedResponse
+}
+
+// NewMemoryCacheStore returns a store holding up to maxEntries entries, or
+// any number when it is zero
+func NewMemoryCacheStore(maxEntries int) *MemoryCacheStore {
+	return &MemoryCacheStore{
+		maxEntries: maxEntries,
+		entries:    make(map[string]*list.Element),
+		order:      list.New(),
+	}
+}
+
+func (store *MemoryCacheStore) Get(key string) (*CachedResponse, bool) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	element, ok := store.entries[key]
+	if !ok {
+		return nil, false
+	}
+	store.order.MoveToFront(element)
+	return element.Value.(*memoryCacheItem).entry, true
+}
+
+func (store *MemoryCacheStore) Set(key string, entry *CachedResponse) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	if element, ok := store.entries[key]; ok {
+		element.Value.(*memoryCacheItem).entry = entry
+		store.order.MoveToFront(element)
+		return
+	}
+	store.entries[key] = store.order.PushFront(&memoryCacheItem{key: key, entry: entry})
+	if store.maxEntries > 0 && store.order.Len() > store.maxEntries {
+		oldest := store.order.Back()
+		store.order.Remove(oldest)
+		delete(store.entries, oldest.Value.(*memoryCacheItem).key)
+	}
+}
+
+func (store *MemoryCacheStore) Delete(key string) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	if element, ok := store.entries[key]; ok {
+		store.order.Remove(element)
+		delete(store.entries, key)
+	}
+}
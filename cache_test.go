@@ -0,0 +1,230 @@
+package httpmodule
+
+import (
+	"fmt"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// startCacheServer serves handler's headers with a Date from clock and
+// counts the requests that reach it
+func startCacheServer(t *testing.T, clock *FakeClock, handler func(w ResponseWriter, req *ServerRequest)) (string, *int32) {
+	var hits int32
+	_, addr := startServer(t, HandlerFunc(func(w ResponseWriter, req *ServerRequest) {
+		atomic.AddInt32(&hits, 1)
+		w.Header()["Date"] = clock.Now().UTC().Format(http.TimeFormat)
+		handler(w, req)
+	}))
+	return "http://" + addr, &hits
+}
+
+// TestResponseCache tests serving fresh entries and revalidating stale ones.
+func TestResponseCache(t *testing.T) {
+	clock := NewFakeClock(time.Now().Truncate(time.Second))
+	url, hits := startCacheServer(t, clock, func(w ResponseWriter, req *ServerRequest) {
+		w.Header()["Cache-Control"] = "max-age=60"
+		w.Header()["ETag"] = `"v1"`
+		if req.Headers["If-None-Match"] == `"v1"` {
+			w.WriteHeader(304)
+			return
+		}
+		w.Write([]byte("cached body"))
+	})
+	client := New()
+	client.Clock = clock
+	client.Cache = NewResponseCache(nil)
+
+	get := func(want int32) *HttpResponse {
+		t.Helper()
+		response, err := client.Get(url+"/resource", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if response.StatusCode != 200 || response.Body != "cached body" {
+			t.Errorf("Expected the cached body, got %d %q", response.StatusCode, response.Body)
+		}
+		if got := atomic.LoadInt32(hits); got != want {
+			t.Errorf("Expected %d requests to reach the server, got %d", want, got)
+		}
+		return response
+	}
+
+	get(1)
+	clock.Advance(30 * time.Second)
+	if response := get(1); response.Headers["Age"] != "30" {
+		t.Error("Expected an Age of 30, got", response.Headers["Age"])
+	}
+	clock.Advance(31 * time.Second)
+	if response := get(2); response.Headers["Age"] != "0" {
+		t.Error("Expected the revalidated entry to be new, got Age", response.Headers["Age"])
+	}
+	get(2)
+
+	if _, err := client.Get(url+"/resource", map[string]string{"Cache-Control": "no-cache"}); err != nil {
+		t.Fatal(err)
+	}
+	get(3)
+
+	if _, err := client.Post(url+"/resource", "change", nil); err != nil {
+		t.Fatal(err)
+	}
+	get(5)
+}
+
+// TestResponseCacheLastModified tests heuristic freshness and revalidating with If-Modified-Since.
+func TestResponseCacheLastModified(t *testing.T) {
+	clock := NewFakeClock(time.Now().Truncate(time.Second))
+	modified := clock.Now().Add(-100 * time.Second).UTC().Format(http.TimeFormat)
+	url, hits := startCacheServer(t, clock, func(w ResponseWriter, req *ServerRequest) {
+		w.Header()["Last-Modified"] = modified
+		if req.Headers["If-Modified-Since"] == modified {
+			w.WriteHeader(304)
+			return
+		}
+		w.Write([]byte("page"))
+	})
+	client := New()
+	client.Clock = clock
+	client.Cache = NewResponseCache(nil)
+
+	for i, step := range []struct {
+		advance time.Duration
+		hits    int32
+	}{{0, 1}, {5 * time.Second, 1}, {15 * time.Second, 2}} {
+		clock.Advance(step.advance)
+		response, err := client.Get(url, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if response.Body != "page" || atomic.LoadInt32(hits) != step.hits {
+			t.Errorf("Expected %d requests to reach the server by request %d, got %d with %q", step.hits, i+1, atomic.LoadInt32(hits), response.Body)
+		}
+	}
+}
+
+// TestResponseCacheNotStored tests responses and requests the cache leaves alone.
+func TestResponseCacheNotStored(t *testing.T) {
+	clock := NewFakeClock(time.Now().Truncate(time.Second))
+	url, hits := startCacheServer(t, clock, func(w ResponseWriter, req *ServerRequest) {
+		switch req.Path {
+		case "/no-store":
+			w.Header()["Cache-Control"] = "no-store, max-age=60"
+		case "/private":
+			w.Header()["Cache-Control"] = "private, max-age=60"
+		case "/vary":
+			w.Header()["Cache-Control"] = "max-age=60"
+			w.Header()["Vary"] = "Accept"
+		}
+		fmt.Fprintf(w, "%s %s", req.Path, req.Headers["Accept"])
+	})
+
+	for _, test := range []struct {
+		path    string
+		shared  bool
+		headers []map[string]string
+		hits    int32
+	}{
+		{"/no-store", false, []map[string]string{nil, nil}, 2},
+		{"/private", false, []map[string]string{nil, nil}, 1},
+		{"/private", true, []map[string]string{nil, nil}, 2},
+		{"/vary", false, []map[string]string{{"Accept": "a"}, {"Accept": "a"}, {"Accept": "b"}}, 2},
+		{"/vary", false, []map[string]string{nil, {"Cache-Control": "no-store"}}, 2},
+	} {
+		atomic.StoreInt32(hits, 0)
+		client := New()
+		client.Clock = clock
+		client.Cache = &ResponseCache{Shared: test.shared}
+		for _, headers := range test.headers {
+			response, err := client.Get(url+test.path, headers)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if accept := headers["Accept"]; accept != "" && response.Body != "/vary "+accept {
+				t.Errorf("Expected the response for %s, got %q", accept, response.Body)
+			}
+		}
+		if got := atomic.LoadInt32(hits); got != test.hits {
+			t.Errorf("Expected %d requests to reach the server for %s (shared %v), got %d", test.hits, test.path, test.shared, got)
+		}
+	}
+}
+
+// TestResponseCacheRanges tests that range requests and partial responses bypass the cache.
+func TestResponseCacheRanges(t *testing.T) {
+	clock := NewFakeClock(time.Now().Truncate(time.Second))
+	url, hits := startCacheServer(t, clock, func(w ResponseWriter, req *ServerRequest) {
+		w.Header()["Cache-Control"] = "max-age=60"
+		if req.Headers["Range"] == "bytes=0-1" {
+			w.Header()["Content-Range"] = "bytes 0-1/5"
+			w.WriteHeader(206)
+			w.Write([]byte("he"))
+			return
+		}
+		w.Write([]byte("hello"))
+	})
+	client := New()
+	client.Clock = clock
+	client.Cache = NewResponseCache(nil)
+
+	if response, err := client.Get(url+"/", map[string]string{"Range": "bytes=0-1"}); err != nil || response.StatusCode != 206 || response.Body != "he" {
+		t.Fatal("Expected the range, got", response, err)
+	}
+	if response, err := client.Get(url+"/", nil); err != nil || response.StatusCode != 200 || response.Body != "hello" {
+		t.Error("Expected the whole resource rather than the stored range, got", response, err)
+	}
+	// The whole resource is stored, but a range is still asked of the server
+	if response, err := client.Get(url+"/", map[string]string{"Range": "bytes=0-1"}); err != nil || response.StatusCode != 206 {
+		t.Error("Expected the range from the server, got", response, err)
+	}
+	if got := atomic.LoadInt32(hits); got != 3 {
+		t.Error("Expected every request to reach the server, got", got)
+	}
+	if response, err := client.Get(url+"/", nil); err != nil || response.Body != "hello" || atomic.LoadInt32(hits) != 3 {
+		t.Error("Expected the whole resource from the cache, got", response, err)
+	}
+
+	// A 206 to a request without Range isn't stored either
+	client.Transport = RoundTripFunc(func(req *HttpRequest) (*HttpResponse, error) {
+		return &HttpResponse{StatusCode: 206, Status: "Partial Content", Headers: map[string]string{"Cache-Control": "max-age=60", "Content-Range": "bytes 0-1/5"}, Body: "he"}, nil
+	})
+	client.Cache = NewResponseCache(nil)
+	client.Get("http://example.com/", nil)
+	if _, ok := client.Cache.Store.Get(cacheKey("http://example.com/")); ok {
+		t.Error("Expected the 206 not to be stored")
+	}
+}
+
+// TestResponseCacheOnlyIfCached tests answering 504 when nothing is stored.
+func TestResponseCacheOnlyIfCached(t *testing.T) {
+	client := New()
+	client.Transport = RoundTripFunc(func(req *HttpRequest) (*HttpResponse, error) {
+		t.Error("Expected no request to be sent")
+		return nil, fmt.Errorf("unexpected request")
+	})
+	client.Cache = NewResponseCache(nil)
+	response, err := client.Get("http://example.com/", map[string]string{"Cache-Control": "only-if-cached"})
+	if err != nil || response.StatusCode != 504 {
+		t.Error("Expected a 504, got", response, err)
+	}
+}
+
+// TestMemoryCacheStore tests dropping the least recently used entry.
+func TestMemoryCacheStore(t *testing.T) {
+	store := NewMemoryCacheStore(2)
+	store.Set("a", &CachedResponse{Body: "a"})
+	store.Set("b", &CachedResponse{Body: "b"})
+	store.Get("a")
+	store.Set("c", &CachedResponse{Body: "c"})
+	if _, ok := store.Get("b"); ok {
+		t.Error("Expected b to be dropped")
+	}
+	if entry, ok := store.Get("a"); !ok || entry.Body != "a" {
+		t.Error("Expected a to be kept")
+	}
+	store.Delete("a")
+	if _, ok := store.Get("a"); ok {
+		t.Error("Expected a to be deleted")
+	}
+}
@@ -0,0 +1,59 @@
+package httpmodule
+
+import "encoding/base64"
+
+// basicAuthorization returns the Authorization value for Basic credentials
+func basicAuthorization(user, password string) string {
+	return "Basic " + base64.StdEncoding.EncodeToString([]byte(user+":"+password))
+}
+
+// SetBasicAuth sends user and password with every request, as a Basic
+// Authorization header, unless a request sets its own. Like the rest of
+// DefaultHeaders, it should be set before the client is in use. Dumps that
+// mask secrets, such as curl commands, cassettes, and HAR archives, hide
+// Authorization headers.
+func (client *HttpClient) SetBasicAuth(user, password string) {
+	client.setDefaultHeader("Authorization", basicAuthorization(user, password))
+}
+
+// SetBearerToken sends token with every request, as a Bearer Authorization
+// header, unless a request sets its own. See SetBasicAuth.
+func (client *HttpClient) SetBearerToken(token string) {
+	client.setDefaultHeader("Authorization", "Bearer "+token)
+}
+
+func (client *HttpClient) setDefaultHeader(key, value string) {
+	if client.DefaultHeaders == nil {
+		client.DefaultHeaders = make(map[string]string)
+	}
+	deleteHeader(client.DefaultHeaders, key)
+	client.DefaultHeaders[key] = value
+}
+
+// SetBasicAuth sets the request's Authorization header to Basic credentials
+func (req *HttpRequest) SetBasicAuth(user, password string) {
+	req.setHeader("Authorization", basicAuthorization(user, password))
+}
+
+// SetBearerToken sets the request's Authorization header to a Bearer token
+func (req *HttpRequest) SetBearerToken(token string) {
+	req.setHeader("Authorization", "Bearer "+token)
+}
+
+func (req *HttpRequest) setHeader(key, value string) {
+	if req.Headers == nil {
+		req.Headers = make(map[string]string)
+	}
+	deleteHeader(req.Headers, key)
+	req.Headers[key] = value
+}
+
+// BasicAuth sets the Authorization header to Basic credentials
+func (b *RequestBuilder) BasicAuth(user, password string) *RequestBuilder {
+	return b.Header("Authorization", basicAuthorization(user, password))
+}
+
+// BearerToken sets the Authorization header to a Bearer token
+func (b *RequestBuilder) BearerToken(token string) *RequestBuilder {
+	return b.Header("Authorization", "Bearer "+token)
+}
@@ -0,0 +1,55 @@
+package httpmodule
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+// TestClientAuth tests the Authorization headers set for the client and for single requests.
+func TestClientAuth(t *testing.T) {
+	_, addr := startServer(t, HandlerFunc(func(w ResponseWriter, req *ServerRequest) {
+		if user, password, ok := req.BasicAuth(); ok {
+			w.Write([]byte("basic " + user + " " + password))
+			return
+		}
+		w.Write([]byte(headerValue(req.Headers, "Authorization")))
+	}))
+	url := "http://" + addr + "/"
+	client := New()
+
+	client.SetBasicAuth("alice", "p@ss:word")
+	if response, err := client.Get(url, nil); err != nil || response.Body != "basic alice p@ss:word" {
+		t.Error("Expected the client's Basic credentials, got", response, err)
+	}
+	client.DefaultHeaders["authorization"] = "stale"
+	client.SetBearerToken("t0ken")
+	if response, err := client.Get(url, nil); err != nil || response.Body != "Bearer t0ken" {
+		t.Error("Expected the client's token to replace the credentials, got", response, err)
+	}
+
+	req := &HttpRequest{Method: "GET", URL: url}
+	req.SetBasicAuth("bob", "secret")
+	if response, err := client.Do(req); err != nil || response.Body != "basic bob secret" {
+		t.Error("Expected the request's credentials to win, got", response, err)
+	}
+	response, err := client.NewRequest("GET", url).BearerToken("other").Send(context.Background())
+	if err != nil || response.Body != "Bearer other" {
+		t.Error("Expected the builder's token, got", response, err)
+	}
+
+	req.SetBearerToken("abc")
+	if curl := (CurlOptions{MaskSecrets: true}).Command(req); strings.Contains(curl, "abc") {
+		t.Error("Expected the token to be masked, got", curl)
+	}
+	recorder := NewHARRecorder(client.NetworkTransport())
+	recorder.MaskSecrets = true
+	if _, err := recorder.RoundTrip(req); err != nil {
+		t.Fatal(err)
+	}
+	for _, header := range recorder.HAR().Log.Entries[0].Request.Headers {
+		if header.Name == "Authorization" && header.Value != redactedValue {
+			t.Error("Expected the archived token to be masked, got", header.Value)
+		}
+	}
+}
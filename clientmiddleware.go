@@ -0,0 +1,22 @@
+package httpmodule
+
+// ClientMiddleware wraps the transport of a client's requests with behaviour
+// that runs around each one, such as adding headers, logging, or signing. It
+// sees every request that goes out, redirects and retries included, after
+// the cookie jar has added its cookies.
+type ClientMiddleware func(next Transport) Transport
+
+// Use adds middleware to every request the client sends. Middleware added
+// first runs first, on the outside. Set it up before sending requests; Use
+// isn't safe to call while requests are in flight.
+func (client *HttpClient) Use(middleware ...ClientMiddleware) {
+	client.middleware = append(client.middleware, middleware...)
+}
+
+// withMiddleware wraps transport in the client's middleware
+func (client *HttpClient) withMiddleware(transport Transport) Transport {
+	for i := len(client.middleware) - 1; i >= 0; i-- {
+		transport = client.middleware[i](transport)
+	}
+	return transport
+}
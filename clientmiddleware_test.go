@@ -0,0 +1,58 @@
+package httpmodule
+
+import (
+	"testing"
+)
+
+// TestClientMiddleware tests that middleware wraps every request in order.
+func TestClientMiddleware(t *testing.T) {
+	var trace []string
+	tag := func(name string) ClientMiddleware {
+		return func(next Transport) Transport {
+			return RoundTripFunc(func(req *HttpRequest) (*HttpResponse, error) {
+				trace = append(trace, name+" "+req.URL)
+				headers := map[string]string{"Authorization": "Bearer token"}
+				for k, v := range req.Headers {
+					headers[k] = v
+				}
+				withAuth := *req
+				withAuth.Headers = headers
+				response, err := next.RoundTrip(&withAuth)
+				if err == nil {
+					trace = append(trace, name+" done")
+				}
+				return response, err
+			})
+		}
+	}
+
+	client := New()
+	client.Transport = RoundTripFunc(func(req *HttpRequest) (*HttpResponse, error) {
+		if req.URL == "http://example.com/old" {
+			return &HttpResponse{StatusCode: 301, Headers: map[string]string{"Location": "/new"}}, nil
+		}
+		return &HttpResponse{StatusCode: 200, Headers: map[string]string{}, Body: req.Headers["Authorization"]}, nil
+	})
+	client.Use(tag("outer"), tag("inner"))
+
+	response, err := client.Get("http://example.com/old", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response.Body != "Bearer token" {
+		t.Error("Expected the middleware's header to reach the transport, got", response.Body)
+	}
+	want := []string{
+		"outer http://example.com/old", "inner http://example.com/old", "inner done", "outer done",
+		"outer http://example.com/new", "inner http://example.com/new", "inner done", "outer done",
+	}
+	if len(trace) != len(want) {
+		t.Fatalf("Expected %q, got %q", want, trace)
+	}
+	for i := range want {
+		if trace[i] != want[i] {
+			t.Errorf("Expected %q, got %q", want, trace)
+			break
+		}
+	}
+}
@@ -0,0 +1,40 @@
+package httpmodule
+
+import (
+	"testing"
+	"time"
+)
+
+// TestFakeClock tests that After channels fire only once the clock is advanced far enough.
+func TestFakeClock(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	clock := NewFakeClock(start)
+	short := clock.After(time.Second)
+	long := clock.After(time.Minute)
+
+	clock.Advance(999 * time.Millisecond)
+	select {
+	case <-short:
+		t.Error("Expected no tick before the deadline.")
+	default:
+	}
+
+	clock.Advance(time.Millisecond)
+	select {
+	case now := <-short:
+		if !now.Equal(start.Add(time.Second)) {
+			t.Error("Expected the tick to carry the current fake time.", now)
+		}
+	default:
+		t.Error("Expected a tick at the deadline.")
+	}
+	if clock.Waiters() != 1 {
+		t.Errorf("Expected 1 pending waiter, got %d.", clock.Waiters())
+	}
+
+	clock.Advance(time.Hour)
+	<-long
+	if !clock.Now().Equal(start.Add(time.Hour + time.Second)) {
+		t.Error("Expected Now to reflect every advance.", clock.Now())
+	}
+}
@@ -0,0 +1,271 @@
+// Command httpc sends an HTTP request with httpmodule's client and prints the
+// response, taking curl's most common options:
+//
+//	httpc [-X method] [-H 'Name: value']... [-d data] [-o file] [-i] [-k] [-x proxy] [-v] url
+//
+// JSON responses written to the terminal are pretty-printed unless -raw is
+// given. With -v the request and response heads go to standard error as they
+// are sent and received.
+package main
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"mime"
+	neturl "net/url"
+	"os"
+	"sort"
+	"strings"
+
+	"httpmodule"
+)
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
+
+// headerFlags collects repeated -H options
+type headerFlags []string
+
+func (h *headerFlags) String() string {
+	return strings.Join(*h, ", ")
+}
+
+func (h *headerFlags) Set(value string) error {
+	if !strings.Contains(value, ":") {
+		return fmt.Errorf("header %q isn't Name: value", value)
+	}
+	*h = append(*h, value)
+	return nil
+}
+
+// run carries out the command line args, returning the exit status: 0 on
+// success, 1 when the request fails, 2 for bad usage, and 22 for an error
+// status with -fail, as curl does
+func run(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("httpc", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	var (
+		method, data, output, proxy string
+		headers                     headerFlags
+		include, insecure, verbose  bool
+		raw, fail                   bool
+	)
+	flags.StringVar(&method, "X", "", "request `method`; GET, or POST with -d")
+	flags.StringVar(&method, "request", "", "same as -X")
+	flags.Var(&headers, "H", "request `header` as 'Name: value'; may be repeated")
+	flags.Var(&headers, "header", "same as -H")
+	flags.StringVar(&data, "d", "", "request body; @file reads it from file, @- from standard input")
+	flags.StringVar(&data, "data", "", "same as -d")
+	flags.StringVar(&output, "o", "", "write the body to `file` instead of standard output")
+	flags.StringVar(&output, "output", "", "same as -o")
+	flags.BoolVar(&include, "i", false, "print the response status and headers before the body")
+	flags.BoolVar(&include, "include", false, "same as -i")
+	flags.BoolVar(&insecure, "k", false, "skip verifying the server's certificate")
+	flags.BoolVar(&insecure, "insecure", false, "same as -k")
+	flags.StringVar(&proxy, "x", "", "send the request through proxy `url`")
+	flags.StringVar(&proxy, "proxy", "", "same as -x")
+	flags.BoolVar(&verbose, "v", false, "dump the request and response heads to standard error")
+	flags.BoolVar(&verbose, "verbose", false, "same as -v")
+	flags.BoolVar(&raw, "raw", false, "print JSON responses as received rather than indented")
+	flags.BoolVar(&fail, "fail", false, "exit with status 22 when the server answers 400 or above")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() != 1 {
+		fmt.Fprintln(stderr, "usage: httpc [options] url")
+		flags.PrintDefaults()
+		return 2
+	}
+	url := flags.Arg(0)
+	if !strings.Contains(url, "://") {
+		url = "http://" + url
+	}
+
+	client := httpmodule.New()
+	if insecure {
+		client.TLSConfig = &tls.Config{InsecureSkipVerify: true}
+	}
+	if proxy != "" {
+		proxyURL, err := neturl.Parse(proxy)
+		if err != nil || proxyURL.Host == "" {
+			fmt.Fprintf(stderr, "httpc: invalid proxy %q\n", proxy)
+			return 2
+		}
+		client.Proxy = httpmodule.ProxyURL(proxyURL)
+	}
+	if verbose {
+		client.Logger = &wireLogger{w: stderr}
+		client.LogVerbose = true
+	}
+
+	req := &httpmodule.HttpRequest{Method: strings.ToUpper(method), URL: url, Headers: map[string]string{}}
+	for _, header := range headers {
+		name, value, _ := strings.Cut(header, ":")
+		req.Headers[strings.TrimSpace(name)] = strings.TrimSpace(value)
+	}
+	if flagSet(flags, "d", "data") {
+		body, err := readData(data, stdin)
+		if err != nil {
+			fmt.Fprintln(stderr, "httpc:", err)
+			return 2
+		}
+		req.Body = body
+		if req.Method == "" {
+			req.Method = "POST"
+		}
+		if !hasHeader(req.Headers, "Content-Type") {
+			req.Headers["Content-Type"] = "application/x-www-form-urlencoded"
+		}
+	}
+	if req.Method == "" {
+		req.Method = "GET"
+	}
+
+	response, err := client.DoStream(req)
+	if err != nil {
+		fmt.Fprintln(stderr, "httpc:", err)
+		return 1
+	}
+	defer response.Close()
+	if include {
+		writeHead(stdout, response)
+	}
+	if err := writeBody(stdout, output, response, !raw); err != nil {
+		fmt.Fprintln(stderr, "httpc:", err)
+		return 1
+	}
+	if fail && response.StatusCode >= 400 {
+		return 22
+	}
+	return 0
+}
+
+// flagSet reports whether any of names was given on the command line
+func flagSet(flags *flag.FlagSet, names ...string) bool {
+	set := false
+	flags.Visit(func(f *flag.Flag) {
+		for _, name := range names {
+			if f.Name == name {
+				set = true
+			}
+		}
+	})
+	return set
+}
+
+// readData returns the body -d gives: the text itself, or a file's contents
+// for @file
+func readData(data string, stdin io.Reader) (string, error) {
+	switch {
+	case data == "@-":
+		body, err := io.ReadAll(stdin)
+		return string(body), err
+	case strings.HasPrefix(data, "@"):
+		body, err := os.ReadFile(data[1:])
+		return string(body), err
+	}
+	return data, nil
+}
+
+func hasHeader(headers map[string]string, key string) bool {
+	for k := range headers {
+		if strings.EqualFold(k, key) {
+			return true
+		}
+	}
+	return false
+}
+
+// writeHead writes the status line and headers of response, sorted by name
+func writeHead(w io.Writer, response *httpmodule.HttpResponse) {
+	fmt.Fprintf(w, "%s %d %s\n", response.Protocol, response.StatusCode, response.Status)
+	keys := make([]string, 0, len(response.Headers))
+	for k := range response.Headers {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		// Headers keeps one cookie; Header has every one the server set
+		values := []string{response.Headers[k]}
+		if strings.EqualFold(k, "Set-Cookie") {
+			values = response.Header().Values(k)
+		}
+		for _, v := range values {
+			fmt.Fprintf(w, "%s: %s\n", k, v)
+		}
+	}
+	fmt.Fprintln(w)
+}
+
+// writeBody writes the body of response to the file output, or to w when
+// output is empty, indenting JSON for w if pretty is set
+func writeBody(w io.Writer, output string, response *httpmodule.HttpResponse, pretty bool) error {
+	body := response.BodyStream()
+	defer body.Close()
+	if output != "" {
+		f, err := os.Create(output)
+		if err != nil {
+			return err
+		}
+		if _, err := io.Copy(f, body); err != nil {
+			f.Close()
+			return err
+		}
+		return f.Close()
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(response.Header().Get("Content-Type"))
+	if !pretty || mediaType != "application/json" && !strings.HasSuffix(mediaType, "+json") {
+		_, err := io.Copy(w, body)
+		return err
+	}
+	data, err := io.ReadAll(body)
+	if err != nil {
+		return err
+	}
+	var indented bytes.Buffer
+	if json.Indent(&indented, data, "", "  ") != nil {
+		// Not valid JSON after all, so leave it as it is
+		_, err := w.Write(data)
+		return err
+	}
+	indented.WriteByte('\n')
+	_, err = indented.WriteTo(w)
+	return err
+}
+
+// wireLogger writes the client's log to standard error as curl -v does: the
+// wire dump as it is, and everything else as "*" lines
+type wireLogger struct {
+	w io.Writer
+}
+
+func (l *wireLogger) Debug(msg string, keysAndValues ...any) {
+	if strings.HasPrefix(msg, "> ") || strings.HasPrefix(msg, "< ") {
+		fmt.Fprintln(l.w, msg)
+		return
+	}
+	l.note(msg, keysAndValues)
+}
+
+func (l *wireLogger) Info(msg string, keysAndValues ...any) {
+	l.note(msg, keysAndValues)
+}
+
+func (l *wireLogger) Warn(msg string, keysAndValues ...any) {
+	l.note(msg, keysAndValues)
+}
+
+func (l *wireLogger) note(msg string, keysAndValues []any) {
+	var b strings.Builder
+	b.WriteString("* " + msg)
+	for i := 0; i+1 < len(keysAndValues); i += 2 {
+		fmt.Fprintf(&b, " %v=%v", keysAndValues[i], keysAndValues[i+1])
+	}
+	fmt.Fprintln(l.w, b.String())
+}
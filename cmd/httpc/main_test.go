@@ -0,0 +1,101 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"httpmodule"
+)
+
+// startServer serves a handler echoing the request and answering JSON paths with JSON.
+func startServer(t *testing.T) *httpmodule.TestServer {
+	ts := httpmodule.NewTestServer(httpmodule.HandlerFunc(func(w httpmodule.ResponseWriter, req *httpmodule.ServerRequest) {
+		body, _ := io.ReadAll(req.Body)
+		switch req.Path {
+		case "/json":
+			w.Header()["Content-Type"] = "application/json"
+			w.Write([]byte(`{"name":"httpc","tags":["a"]}`))
+		case "/missing":
+			w.WriteHeader(404)
+		default:
+			w.Header()["X-Test"] = req.Headers["X-Test"]
+			w.Write([]byte(req.Method + " " + req.Headers["Content-Type"] + " " + string(body)))
+		}
+	}))
+	t.Cleanup(ts.Close)
+	return ts
+}
+
+// httpc runs the command with args and returns its status and output.
+func httpc(t *testing.T, stdin string, args ...string) (int, string, string) {
+	var stdout, stderr bytes.Buffer
+	status := run(args, strings.NewReader(stdin), &stdout, &stderr)
+	return status, stdout.String(), stderr.String()
+}
+
+// TestRun tests sending requests built from the command line.
+func TestRun(t *testing.T) {
+	ts := startServer(t)
+
+	if status, out, _ := httpc(t, "", ts.URL+"/"); status != 0 || out != "GET  " {
+		t.Errorf("Expected a GET, got %d %q", status, out)
+	}
+	if status, out, _ := httpc(t, "", "-d", "a=1", ts.URL+"/"); status != 0 || out != "POST application/x-www-form-urlencoded a=1" {
+		t.Errorf("Expected a form POST, got %d %q", status, out)
+	}
+	if _, out, _ := httpc(t, "from stdin", "-X", "put", "-H", "Content-Type: text/plain", "-d", "@-", ts.URL+"/"); out != "PUT text/plain from stdin" {
+		t.Errorf("Expected a PUT of standard input, got %q", out)
+	}
+	if _, out, _ := httpc(t, "", "-i", "-H", "X-Test: yes", ts.URL+"/"); !strings.HasPrefix(out, "HTTP/1.1 200 OK\n") || !strings.Contains(out, "\nX-Test: yes\n\nGET  ") {
+		t.Errorf("Expected the head before the body, got %q", out)
+	}
+
+	if _, out, _ := httpc(t, "", ts.URL+"/json"); out != "{\n  \"name\": \"httpc\",\n  \"tags\": [\n    \"a\"\n  ]\n}\n" {
+		t.Errorf("Expected indented JSON, got %q", out)
+	}
+	if _, out, _ := httpc(t, "", "-raw", ts.URL+"/json"); out != `{"name":"httpc","tags":["a"]}` {
+		t.Errorf("Expected the JSON as sent, got %q", out)
+	}
+
+	path := filepath.Join(t.TempDir(), "out.json")
+	if status, out, _ := httpc(t, "", "-o", path, ts.URL+"/json"); status != 0 || out != "" {
+		t.Errorf("Expected nothing on standard output, got %d %q", status, out)
+	}
+	if data, _ := os.ReadFile(path); string(data) != `{"name":"httpc","tags":["a"]}` {
+		t.Errorf("Expected the body in the file, got %q", data)
+	}
+}
+
+// TestRunVerbose tests dumping the exchange to standard error.
+func TestRunVerbose(t *testing.T) {
+	ts := startServer(t)
+	_, _, errOut := httpc(t, "", "-v", "-H", "X-Test: yes", ts.URL+"/path")
+	for _, want := range []string{"> GET /path HTTP/1.1\n", "> X-Test: yes\n", "< HTTP/1.1 200 OK\n", "* request finished"} {
+		if !strings.Contains(errOut, want) {
+			t.Errorf("Expected %q in the dump, got %s", want, errOut)
+		}
+	}
+}
+
+// TestRunFailures tests the exit status of failed and refused requests.
+func TestRunFailures(t *testing.T) {
+	ts := startServer(t)
+	if status, _, _ := httpc(t, "", ts.URL+"/missing"); status != 0 {
+		t.Error("Expected success for an error status without -fail, got", status)
+	}
+	if status, _, _ := httpc(t, "", "-fail", ts.URL+"/missing"); status != 22 {
+		t.Error("Expected 22 for an error status with -fail, got", status)
+	}
+	if status, _, errOut := httpc(t, "", "-H", "no colon", ts.URL); status != 2 || errOut == "" {
+		t.Error("Expected a usage error, got", status, errOut)
+	}
+
+	ts.Close()
+	if status, _, errOut := httpc(t, "", ts.URL+"/"); status != 1 || !strings.HasPrefix(errOut, "httpc: ") {
+		t.Error("Expected a failed request, got", status, errOut)
+	}
+}
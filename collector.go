@@ -0,0 +1,133 @@
+package httpmodule
+
+import (
+	neturl "net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Collector receives measurements of a client's requests, to be recorded in
+// whatever metrics library the caller uses; Metrics.ClientCollector records
+// them in Prometheus form. Its methods are called on the goroutines sending
+// requests, so they must be safe for concurrent use and should be quick.
+type Collector interface {
+	// RequestDone is called once for each request the client sends, after
+	// its redirects and retries, when the response headers are in or the
+	// request has failed
+	RequestDone(sample RequestSample)
+
+	// Retried is called each time a request is about to be tried again
+	Retried(host, method string)
+
+	// IdleConns is called when the number of idle keep-alive connections the
+	// client holds for origin, such as "https://example.com", changes
+	IdleConns(origin string, idle int)
+}
+
+// RequestSample describes one request for a Collector
+type RequestSample struct {
+	// Host of the request's URL, and its method, or "OTHER" for
+	// nonstandard ones so they can't create labels without bound
+	Host   string
+	Method string
+
+	// Status of the final response, or zero when the request failed
+	StatusCode int
+
+	// Why the request failed, if it did
+	Err error
+
+	// From sending the request to its response headers arriving, retries
+	// and redirects included
+	Duration time.Duration
+
+	// Number of times the request was sent, retries included
+	Attempts int
+}
+
+// StatusClass returns the class of the sample's status, such as "2xx", or
+// "error" when the request failed
+func (sample RequestSample) StatusClass() string {
+	if sample.Err != nil || sample.StatusCode < 100 || sample.StatusCode > 599 {
+		return "error"
+	}
+	return strconv.Itoa(sample.StatusCode/100) + "xx"
+}
+
+// ClientCollector returns a Collector that records client requests in the
+// registry: http_client_requests_total by host, method, and status class,
+// http_client_request_duration_seconds and http_client_retries_total by
+// host and method, and http_client_idle_connections by origin
+func (m *Metrics) ClientCollector() Collector {
+	return &metricsCollector{
+		requests: m.Counter("http_client_requests_total", "Requests sent, by host, method, and status class.", "host", "method", "status"),
+		duration: m.Histogram("http_client_request_duration_seconds", "Time until response headers arrived, by host and method.", nil, "host", "method"),
+		retries:  m.Counter("http_client_retries_total", "Requests tried again, by host and method.", "host", "method"),
+		idle:     m.Gauge("http_client_idle_connections", "Idle keep-alive connections held, by origin.", "origin"),
+	}
+}
+
+type metricsCollector struct {
+	requests *Counter
+	duration *Histogram
+	retries  *Counter
+	idle     *Gauge
+}
+
+func (c *metricsCollector) RequestDone(sample RequestSample) {
+	c.requests.Inc(sample.Host, sample.Method, sample.StatusClass())
+	c.duration.Observe(sample.Duration.Seconds(), sample.Host, sample.Method)
+}
+
+func (c *metricsCollector) Retried(host, method string) {
+	c.retries.Inc(host, method)
+}
+
+func (c *metricsCollector) IdleConns(origin string, idle int) {
+	c.idle.Set(float64(idle), origin)
+}
+
+// collectRequest reports a request that took since start and ended in
+// response or err to the client's Collector, if it has one
+func (client *HttpClient) collectRequest(req *HttpRequest, start time.Time, response *HttpResponse, err error) {
+	if client.Collector == nil {
+		return
+	}
+	sample := RequestSample{
+		Host:     metricHost(req.URL),
+		Method:   metricMethod(req.Method),
+		Err:      err,
+		Duration: clockOrReal(client.Clock).Now().Sub(start),
+	}
+	if response != nil {
+		sample.StatusCode = response.StatusCode
+		sample.Attempts = response.Attempts
+	}
+	client.Collector.RequestDone(sample)
+}
+
+// collectRetry reports req being tried again to the client's Collector, if
+// it has one
+func (client *HttpClient) collectRetry(req *HttpRequest) {
+	if client.Collector != nil {
+		client.Collector.Retried(metricHost(req.URL), metricMethod(req.Method))
+	}
+}
+
+// collectIdle reports the idle connections pool holds for key to the
+// client's Collector, if it has one
+func (client *HttpClient) collectIdle(pool *connPool, key string) {
+	if client.Collector != nil {
+		client.Collector.IdleConns(key, pool.idleCount(key))
+	}
+}
+
+// metricHost returns the host of url, without a port, for labelling metrics
+func metricHost(url string) string {
+	parsed, err := neturl.Parse(url)
+	if err != nil {
+		return ""
+	}
+	return strings.ToLower(parsed.Hostname())
+}
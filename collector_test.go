@@ -0,0 +1,100 @@
+package httpmodule
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// recordingCollector keeps what a client reports to it
+type recordingCollector struct {
+	mu      sync.Mutex
+	samples []RequestSample
+	retries int
+	idle    map[string]int
+}
+
+func (c *recordingCollector) RequestDone(sample RequestSample) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.samples = append(c.samples, sample)
+}
+
+func (c *recordingCollector) Retried(host, method string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.retries++
+}
+
+func (c *recordingCollector) IdleConns(origin string, idle int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.idle[origin] = idle
+}
+
+// TestCollector tests the samples, retries, and pool sizes a client reports.
+func TestCollector(t *testing.T) {
+	_, addr := startServer(t, HandlerFunc(func(w ResponseWriter, req *ServerRequest) {
+		w.Write([]byte("ok"))
+	}))
+	collector := &recordingCollector{idle: make(map[string]int)}
+	client := New()
+	client.Collector = collector
+
+	if _, err := client.Get("http://"+addr+"/", nil); err != nil {
+		t.Fatal(err)
+	}
+	if collector.idle["http://"+addr] != 1 {
+		t.Error("Expected one idle connection, got", collector.idle)
+	}
+	sample := collector.samples[0]
+	if sample.Host != "127.0.0.1" || sample.Method != "GET" || sample.StatusCode != 200 || sample.StatusClass() != "2xx" || sample.Attempts != 1 || sample.Duration <= 0 {
+		t.Errorf("Expected a sample of the request, got %+v", sample)
+	}
+
+	if _, err := client.Get("http://"+addr+"/", nil); err != nil {
+		t.Fatal(err)
+	}
+	client.CloseIdleConnections()
+	if collector.idle["http://"+addr] != 0 || len(collector.samples) != 2 {
+		t.Error("Expected the pool emptied, got", collector.idle)
+	}
+
+	client = New()
+	client.Collector = collector
+	client.Transport = &flakyTransport{outcomes: []int{0, 0, 0}}
+	client.Retry = &RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond, RetryNonIdempotent: true}
+	_, err := client.Do(&HttpRequest{Method: "PURGE", URL: "http://Example.com:8080/"})
+	sample = collector.samples[2]
+	if collector.retries != 2 || sample.StatusClass() != "error" || !errors.Is(sample.Err, err) || sample.Host != "example.com" || sample.Method != "OTHER" {
+		t.Errorf("Expected a failed sample after 2 retries, got %+v after %d", sample, collector.retries)
+	}
+}
+
+// TestMetricsClientCollector tests recording client requests in a registry.
+func TestMetricsClientCollector(t *testing.T) {
+	metrics := NewMetrics()
+	client := New()
+	client.Collector = metrics.ClientCollector()
+	client.Transport = &flakyTransport{outcomes: []int{503}}
+	client.Retry = &RetryPolicy{BaseDelay: time.Millisecond}
+	if _, err := client.Get("http://api.example.com/", nil); err != nil {
+		t.Fatal(err)
+	}
+	client.Collector.IdleConns("https://api.example.com", 2)
+
+	var b strings.Builder
+	metrics.WriteTo(&b)
+	for _, want := range []string{
+		`http_client_requests_total{host="api.example.com",method="GET",status="2xx"} 1`,
+		`http_client_request_duration_seconds_count{host="api.example.com",method="GET"} 1`,
+		`http_client_retries_total{host="api.example.com",method="GET"} 1`,
+		`http_client_idle_connections{origin="https://api.example.com"} 2`,
+	} {
+		if !strings.Contains(b.String(), want) {
+			t.Errorf("Expected %s in:\n%s", want, b.String())
+		}
+	}
+}
@@ -0,0 +1,190 @@
+package httpmodule
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"net/http"
+	neturl "net/url"
+	"strings"
+)
+
+// With NetHTTPCompatible set, the client's observable behaviour matches a
+// zero http.Client using http.DefaultTransport, as checked request by request
+// by TestNetHTTPCompatible:
+//
+//   - Only User-Agent "Go-http-client/1.1" is sent by default, plus
+//     "Accept-Encoding: gzip" when the caller hasn't chosen an encoding, the
+//     request isn't HEAD, and it has no Range header.
+//   - gzip responses to that implicit Accept-Encoding are decompressed, and
+//     their Content-Encoding and Content-Length headers removed.
+//   - Redirects are followed, with a Referer header, until 10 requests have
+//     been made. 301, 302, and 303 drop the body and turn any method but GET
+//     and HEAD into GET; 307 and 308 resend the request as it was. Credentials
+//     and cookies are dropped once redirected to a host that isn't the
+//     original one or a subdomain of it.
+//   - Content-Length is left off empty requests other than POST, PUT, and PATCH.
+//   - Cookies aren't stored between requests unless Jar is set, as the default
+//     client has no jar.
+//   - Proxies are taken from HTTP_PROXY, HTTPS_PROXY, and NO_PROXY with
+//     ProxyFromEnvironment unless Proxy is set.
+
+// Headers sent with every request in compatible mode unless overridden
+var compatBuiltinHeaders = [...]struct{ key, value string }{
+	{"User-Agent", "Go-http-client/1.1"},
+}
+
+// Requests net/http makes for one call, redirects included, before giving up
+const maxCompatRequests = 10
+
+// compatRoundTrip sends req through transport the way net/http would
+func (client *HttpClient) compatRoundTrip(transport Transport, req *HttpRequest) (*HttpResponse, error) {
+	current := req
+	stripSensitive := false
+	for sent := 1; ; sent++ {
+		response, err := client.compatSend(transport, current)
+		if err != nil {
+			return nil, err
+		}
+
+		next, err := compatRedirect(req, current, response, &stripSensitive)
+		if err != nil || next == nil {
+			return response, err
+		}
+		response.Close()
+		if sent == maxCompatRequests {
+			op := req.Method[:1] + strings.ToLower(req.Method[1:])
+			return nil, fmt.Errorf("%s %q: stopped after %d redirects", op, current.URL, maxCompatRequests)
+		}
+		current = next
+	}
+}
+
+// compatSend sends a single request, asking for and undoing gzip compression
+func (client *HttpClient) compatSend(transport Transport, req *HttpRequest) (*HttpResponse, error) {
+	requestedGzip := false
+	if !client.isOverridden("Accept-Encoding", req.Headers) && req.Method != "HEAD" && headerValue(req.Headers, "Range") == "" && !req.keepEncoding {
+		requestedGzip = true
+		headers := make(map[string]string, len(req.Headers)+1)
+		for k, v := range req.Headers {
+			headers[k] = v
+		}
+		headers["Accept-Encoding"] = "gzip"
+		withGzip := *req
+		withGzip.Headers = headers
+		req = &withGzip
+	}
+
+	response, err := transport.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	if !requestedGzip || !strings.EqualFold(response.Header().Get("Content-Encoding"), "gzip") {
+		return response, nil
+	}
+
+	body, err := response.ReadBody()
+	if err != nil {
+		return nil, err
+	}
+	if body != "" {
+		zr, err := gzip.NewReader(strings.NewReader(body))
+		if err != nil {
+			return nil, fmt.Errorf("failed to decompress response: %v", err)
+		}
+		var buf bytes.Buffer
+		if _, err := io.Copy(&buf, zr); err != nil {
+			return nil, fmt.Errorf("failed to decompress response: %v", err)
+		}
+		response.Body = buf.String()
+	}
+	deleteHeader(response.Headers, "Content-Encoding")
+	deleteHeader(response.Headers, "Content-Length")
+	return response, nil
+}
+
+// compatRedirect returns the request to follow response with, or nil when the
+// response isn't a redirect to follow. Headers are copied from the original
+// request; once a redirect leaves the original domain, sensitive ones stay
+// stripped for the rest of the chain.
+func compatRedirect(original, current *HttpRequest, response *HttpResponse, stripSensitive *bool) (*HttpRequest, error) {
+	method, includeBody := current.Method, true
+	switch response.StatusCode {
+	case 301, 302, 303:
+		includeBody = false
+		if method != "GET" && method != "HEAD" {
+			method = "GET"
+		}
+	case 307, 308:
+		// A streamed body has been used up and can't go with the redirect
+		if original.BodyReader != nil {
+			return nil, nil
+		}
+	default:
+		return nil, nil
+	}
+	location := headerValue(response.Headers, "Location")
+	if location == "" {
+		return nil, nil
+	}
+
+	base, err := neturl.Parse(current.URL)
+	if err != nil {
+		return nil, err
+	}
+	target, err := base.Parse(location)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse Location header %q: %v", location, err)
+	}
+
+	next := &HttpRequest{
+		Method:         method,
+		URL:            target.String(),
+		Headers:        make(map[string]string, len(original.Headers)+1),
+		BodyHashes:     original.BodyHashes,
+		ResponseHashes: original.ResponseHashes,
+		BandwidthLimit: original.BandwidthLimit,
+		ctx:            current.ctx,
+		keepEncoding:   original.keepEncoding,
+	}
+	if includeBody {
+		next.Body = original.Body
+	}
+
+	originalURL, err := neturl.Parse(original.URL)
+	if err != nil || originalURL.Host != target.Host && !isDomainOrSubdomain(target.Hostname(), originalURL.Hostname()) {
+		*stripSensitive = true
+	}
+	for k, v := range original.Headers {
+		switch http.CanonicalHeaderKey(k) {
+		case "Authorization", "Www-Authenticate", "Cookie", "Cookie2", "Proxy-Authorization", "Proxy-Authenticate":
+			if *stripSensitive {
+				continue
+			}
+		case "Content-Encoding", "Content-Language", "Content-Location", "Content-Type":
+			if !includeBody {
+				continue
+			}
+		}
+		next.Headers[k] = v
+	}
+
+	// Referer names the previous URL, without credentials, unless that would
+	// leak an https URL over http
+	if base.Scheme == "https" && target.Scheme == "http" {
+		return next, nil
+	}
+	if headerValue(original.Headers, "Referer") == "" {
+		referer := *base
+		referer.User = nil
+		next.Headers["Referer"] = referer.String()
+	}
+	return next, nil
+}
+
+// isDomainOrSubdomain reports whether sub is parent or a subdomain of it
+func isDomainOrSubdomain(sub, parent string) bool {
+	sub, parent = strings.ToLower(sub), strings.ToLower(parent)
+	return sub == parent || strings.HasSuffix(sub, "."+parent)
+}
@@ -0,0 +1,217 @@
+package httpmodule
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	neturl "net/url"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// compatHandler serves the scenarios of the differential tests and logs every
+// request it sees, with the server's own address replaced by BASE.
+type compatHandler struct {
+	log []string
+}
+
+func (h *compatHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	base := "http://" + r.Host
+	body, _ := io.ReadAll(r.Body)
+	keys := make([]string, 0, len(r.Header))
+	for k := range r.Header {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var headers []string
+	for _, k := range keys {
+		headers = append(headers, k+"="+strings.ReplaceAll(strings.Join(r.Header[k], ","), base, "BASE"))
+	}
+	h.log = append(h.log, fmt.Sprintf("%s %s %q %s", r.Method, r.URL.Path, body, strings.Join(headers, " ")))
+
+	switch {
+	case r.URL.Path == "/gzip":
+		w.Header().Set("Content-Type", "text/plain")
+		if strings.Contains(r.Header.Get("Accept-Encoding"), "gzip") {
+			var buf bytes.Buffer
+			zw := gzip.NewWriter(&buf)
+			io.WriteString(zw, "compressed hello")
+			zw.Close()
+			w.Header().Set("Content-Encoding", "gzip")
+			w.Write(buf.Bytes())
+			return
+		}
+		io.WriteString(w, "plain hello")
+	case strings.HasPrefix(r.URL.Path, "/redirect/"):
+		var code int
+		fmt.Sscanf(r.URL.Path, "/redirect/%d", &code)
+		w.Header().Set("Location", "/final")
+		w.WriteHeader(code)
+	case r.URL.Path == "/loop":
+		http.Redirect(w, r, "/loop", http.StatusFound)
+	case r.URL.Path == "/no-location":
+		w.WriteHeader(http.StatusFound)
+	default:
+		fmt.Fprintf(w, "%s %s", r.Method, body)
+	}
+}
+
+// compatOutcome is what a caller observes from one request.
+type compatOutcome struct {
+	status  int
+	body    string
+	headers string
+	failed  bool
+	log     []string
+}
+
+// TestNetHTTPCompatible checks compatible mode against net/http's default
+// client, request by request, from both the caller's and the server's side.
+func TestNetHTTPCompatible(t *testing.T) {
+	tests := []struct {
+		method, path, body string
+		headers            map[string]string
+	}{
+		{"GET", "/plain", "", nil},
+		{"GET", "/gzip", "", nil},
+		{"GET", "/gzip", "", map[string]string{"Accept-Encoding": "identity"}},
+		{"HEAD", "/gzip", "", nil},
+		{"GET", "/gzip", "", map[string]string{"Range": "bytes=0-3"}},
+		{"DELETE", "/plain", "", nil},
+		{"POST", "/plain", "", nil},
+		{"POST", "/redirect/301", "data", map[string]string{"Content-Type": "text/plain", "Authorization": "Bearer t"}},
+		{"POST", "/redirect/302", "data", map[string]string{"Content-Type": "text/plain"}},
+		{"PUT", "/redirect/303", "data", map[string]string{"Content-Type": "text/plain"}},
+		{"POST", "/redirect/307", "data", map[string]string{"Content-Type": "text/plain", "Authorization": "Bearer t"}},
+		{"PUT", "/redirect/308", "data", nil},
+		{"GET", "/redirect/302", "", map[string]string{"Referer": "http://origin.example/"}},
+		{"GET", "/loop", "", nil},
+		{"GET", "/no-location", "", nil},
+	}
+
+	for _, test := range tests {
+		name := test.method + " " + test.path
+		want := netHTTPOutcome(t, test.method, test.path, test.body, test.headers)
+		got := compatOutcomeFor(t, test.method, test.path, test.body, test.headers)
+
+		if got.failed != want.failed || got.status != want.status || got.body != want.body || got.headers != want.headers {
+			t.Errorf("%s: expected status %d, body %q, headers %s, failed %v; got %d, %q, %s, %v",
+				name, want.status, want.body, want.headers, want.failed, got.status, got.body, got.headers, got.failed)
+		}
+		if strings.Join(got.log, "\n") != strings.Join(want.log, "\n") {
+			t.Errorf("%s: expected the server to see\n%s\ngot\n%s", name, strings.Join(want.log, "\n"), strings.Join(got.log, "\n"))
+		}
+	}
+}
+
+// netHTTPOutcome sends a request with net/http's default client.
+func netHTTPOutcome(t *testing.T, method, path, body string, headers map[string]string) compatOutcome {
+	handler := &compatHandler{}
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	var reader io.Reader
+	if body != "" {
+		reader = strings.NewReader(body)
+	}
+	req, err := http.NewRequest(method, server.URL+path, reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	outcome := compatOutcome{}
+	response, err := (&http.Client{}).Do(req)
+	if err != nil {
+		outcome.failed = true
+	} else {
+		data, _ := io.ReadAll(response.Body)
+		response.Body.Close()
+		outcome.status, outcome.body = response.StatusCode, string(data)
+		outcome.headers = fmt.Sprint(response.Header.Get("Content-Encoding"), "|", response.Header.Get("Content-Length"))
+	}
+	outcome.log = handler.log
+	return outcome
+}
+
+// compatOutcomeFor sends a request with a compatible client over pipes.
+func compatOutcomeFor(t *testing.T, method, path, body string, headers map[string]string) compatOutcome {
+	handler := &compatHandler{}
+	client := New()
+	client.NetHTTPCompatible = true
+	transport := client.PipeTransport(handler)
+	defer transport.Close()
+	client.Transport = transport
+
+	outcome := compatOutcome{}
+	response, err := client.do(&HttpRequest{Method: method, URL: "http://example.com" + path, Headers: headers, Body: body})
+	if err != nil {
+		outcome.failed = true
+	} else {
+		outcome.status, outcome.body = response.StatusCode, response.Body
+		outcome.headers = fmt.Sprint(response.Headers["Content-Encoding"], "|", response.Headers["Content-Length"])
+	}
+	outcome.log = handler.log
+	return outcome
+}
+
+// TestNetHTTPCompatibleCrossHost tests that credentials don't follow redirects to other hosts.
+func TestNetHTTPCompatibleCrossHost(t *testing.T) {
+	var seen []string
+	client := New()
+	client.NetHTTPCompatible = true
+	client.Transport = RoundTripFunc(func(req *HttpRequest) (*HttpResponse, error) {
+		seen = append(seen, req.URL+" "+req.Headers["Authorization"])
+		switch req.URL {
+		case "https://example.com/a":
+			return &HttpResponse{StatusCode: 302, Headers: map[string]string{"Location": "https://api.example.com/b"}}, nil
+		case "https://api.example.com/b":
+			return &HttpResponse{StatusCode: 302, Headers: map[string]string{"Location": "https://other.test/c"}}, nil
+		case "https://other.test/c":
+			return &HttpResponse{StatusCode: 302, Headers: map[string]string{"Location": "https://example.com/d"}}, nil
+		}
+		return &HttpResponse{StatusCode: 200}, nil
+	})
+
+	if _, err := client.Get("https://example.com/a", map[string]string{"Authorization": "secret"}); err != nil {
+		t.Fatal(err)
+	}
+	want := "https://example.com/a secret|https://api.example.com/b secret|https://other.test/c |https://example.com/d "
+	if got := strings.Join(seen, "|"); got != want {
+		t.Error("Expected credentials to be kept for subdomains only, got", got)
+	}
+}
+
+// TestNetHTTPCompatibleProxy tests taking the proxy from the environment unless Proxy is set.
+func TestNetHTTPCompatibleProxy(t *testing.T) {
+	_, proxyAddr := startServer(t, HandlerFunc(func(w ResponseWriter, req *ServerRequest) {
+		io.WriteString(w, "proxied "+req.Target)
+	}))
+	_, direct := startServer(t, HandlerFunc(func(w ResponseWriter, req *ServerRequest) {
+		io.WriteString(w, "direct "+req.Target)
+	}))
+	t.Setenv("HTTP_PROXY", "http://"+proxyAddr)
+	t.Setenv("NO_PROXY", "")
+	t.Setenv("REQUEST_METHOD", "")
+
+	client := New()
+	client.NetHTTPCompatible = true
+	response, err := client.Get("http://upstream.test/path", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response.Body != "proxied http://upstream.test/path" {
+		t.Error("Expected the request sent through HTTP_PROXY, got", response.Body)
+	}
+
+	client.Proxy = func(req *HttpRequest) (*neturl.URL, error) { return nil, nil }
+	client.HostOverrides = map[string]string{"upstream.test": direct}
+	if response, err := client.Get("http://upstream.test/path", nil); err != nil || response.Body != "direct /path" {
+		t.Error("Expected Proxy to take precedence over the environment, got", response, err)
+	}
+}
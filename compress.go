@@ -0,0 +1,274 @@
+package httpmodule
+
+import (
+	"bufio"
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Smallest body Compress compresses when CompressOptions doesn't set one
+const defaultCompressMinSize = 1024
+
+// Media types Compress compresses when CompressOptions doesn't list any
+var defaultCompressibleTypes = []string{
+	"text/*",
+	"application/json",
+	"application/javascript",
+	"application/xml",
+	"application/wasm",
+	"image/svg+xml",
+}
+
+// CompressOptions controls which responses Compress compresses
+type CompressOptions struct {
+	// Compression level for gzip and deflate; zero means the default
+	Level int
+
+	// Bodies shorter than this are sent as they are; zero means 1 KB
+	MinSize int
+
+	// Media types to compress, such as "application/json", or "text/*" for
+	// a whole family; nil means common text formats
+	ContentTypes []string
+}
+
+// Compress returns middleware that compresses response bodies with gzip or
+// deflate, whichever the client prefers in Accept-Encoding. Brotli is not
+// offered, as the standard library has no encoder for it. Responses that are
+// already encoded, partial, or too short are left alone. Compressed responses
+// lose their Content-Length and have their ETag made weak, and every response
+// of a compressible type gets Vary: Accept-Encoding.
+func Compress(options CompressOptions) Middleware {
+	if options.MinSize == 0 {
+		options.MinSize = defaultCompressMinSize
+	}
+	if options.ContentTypes == nil {
+		options.ContentTypes = defaultCompressibleTypes
+	}
+	return func(next Handler) Handler {
+		return HandlerFunc(func(w ResponseWriter, req *ServerRequest) {
+			if req.Method == "HEAD" {
+				next.ServeHTTP(w, req)
+				return
+			}
+			cw := &compressWriter{
+				ResponseWriter: w,
+				options:        &options,
+				encoding:       negotiateEncoding(headerValue(req.Headers, "Accept-Encoding")),
+			}
+			next.ServeHTTP(cw, req)
+			cw.close()
+		})
+	}
+}
+
+// negotiateEncoding picks gzip or deflate from an Accept-Encoding header,
+// honouring q-values, or "" if the client accepts neither
+func negotiateEncoding(accept string) string {
+	best, bestQ := "", 0.0
+	wildcard := -1.0
+	qualities := map[string]float64{}
+	for _, part := range strings.Split(accept, ",") {
+		coding, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		coding = strings.ToLower(strings.TrimSpace(coding))
+		q := 1.0
+		if value, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if parsed, err := strconv.ParseFloat(value, 64); err == nil {
+				q = parsed
+			}
+		}
+		if coding == "*" {
+			wildcard = q
+		} else if coding != "" {
+			qualities[coding] = q
+		}
+	}
+	for _, coding := range []string{"gzip", "deflate"} {
+		q, ok := qualities[coding]
+		if !ok {
+			q = wildcard
+		}
+		if q > bestQ {
+			best, bestQ = coding, q
+		}
+	}
+	return best
+}
+
+// compressWriter holds back the start of a response until it knows whether
+// the body is worth compressing, then either compresses or passes it through
+type compressWriter struct {
+	ResponseWriter
+	options  *CompressOptions
+	encoding string
+
+	status  int
+	buf     []byte
+	decided bool
+	encoder io.WriteCloser
+}
+
+func (cw *compressWriter) WriteHeader(statusCode int) {
+	if cw.decided || cw.status != 0 {
+		return
+	}
+	cw.status = statusCode
+	if statusCode/100 == 1 || statusCode == 204 || statusCode == 304 {
+		cw.decide(false)
+	}
+}
+
+func (cw *compressWriter) Write(p []byte) (int, error) {
+	if cw.status == 0 {
+		cw.status = 200
+	}
+	if !cw.decided {
+		cw.buf = append(cw.buf, p...)
+		if len(cw.buf) < cw.options.MinSize {
+			return len(p), nil
+		}
+		if err := cw.decide(true); err != nil {
+			return 0, err
+		}
+		return len(p), nil
+	}
+	if cw.encoder != nil {
+		return cw.encoder.Write(p)
+	}
+	return cw.ResponseWriter.Write(p)
+}
+
+// Flush sends what has been written so far, deciding on compression early if
+// it has to
+func (cw *compressWriter) Flush() {
+	if !cw.decided {
+		if cw.status == 0 {
+			cw.status = 200
+		}
+		cw.decide(true)
+	}
+	if flusher, ok := cw.encoder.(interface{ Flush() error }); ok {
+		flusher.Flush()
+	}
+	if flusher, ok := cw.ResponseWriter.(Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+func (cw *compressWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := cw.ResponseWriter.(Hijacker)
+	if !ok || cw.decided {
+		return nil, nil, errHijacked
+	}
+	cw.decided = true
+	return hijacker.Hijack()
+}
+
+// decide sends the head, compressing the body if the response qualifies.
+// enough is set when the body is known to be at least the minimum size.
+func (cw *compressWriter) decide(enough bool) error {
+	cw.decided = true
+	headers := cw.ResponseWriter.Header()
+
+	contentType := headerValue(headers, "Content-Type")
+	if contentType == "" && len(cw.buf) > 0 {
+		// Sniff it now, as the server would, so the check below can use it
+		contentType = http.DetectContentType(cw.buf)
+		headers["Content-Type"] = contentType
+	}
+	eligible := cw.status == 200 && headerValue(headers, "Content-Encoding") == "" && cw.compressible(contentType)
+	if eligible {
+		addVary(headers, "Accept-Encoding")
+	}
+
+	if eligible && enough && cw.encoding != "" {
+		deleteHeader(headers, "Content-Length")
+		headers["Content-Encoding"] = cw.encoding
+		if etag := headerValue(headers, "ETag"); strings.HasPrefix(etag, "\"") {
+			deleteHeader(headers, "ETag")
+			headers["ETag"] = "W/" + etag
+		}
+		cw.ResponseWriter.WriteHeader(cw.status)
+
+		var err error
+		if cw.encoding == "gzip" {
+			cw.encoder, err = gzip.NewWriterLevel(cw.ResponseWriter, cw.level())
+		} else {
+			cw.encoder, err = zlib.NewWriterLevel(cw.ResponseWriter, cw.level())
+		}
+		if err != nil {
+			return err
+		}
+	} else if cw.status != 0 {
+		cw.ResponseWriter.WriteHeader(cw.status)
+	}
+
+	buf := cw.buf
+	cw.buf = nil
+	if len(buf) == 0 {
+		return nil
+	}
+	if cw.encoder != nil {
+		_, err := cw.encoder.Write(buf)
+		return err
+	}
+	_, err := cw.ResponseWriter.Write(buf)
+	return err
+}
+
+// close finishes the response once the handler has returned
+func (cw *compressWriter) close() {
+	if !cw.decided {
+		cw.decide(false)
+	}
+	if cw.encoder != nil {
+		cw.encoder.Close()
+	}
+}
+
+func (cw *compressWriter) level() int {
+	if cw.options.Level == 0 {
+		return gzip.DefaultCompression
+	}
+	return cw.options.Level
+}
+
+// compressible reports whether contentType is one of the configured types
+func (cw *compressWriter) compressible(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	for _, pattern := range cw.options.ContentTypes {
+		if family, ok := strings.CutSuffix(pattern, "/*"); ok {
+			if strings.HasPrefix(mediaType, family+"/") {
+				return true
+			}
+		} else if mediaType == pattern {
+			return true
+		}
+	}
+	return false
+}
+
+// addVary adds field to the Vary header unless it is already listed
+func addVary(headers map[string]string, field string) {
+	vary := headerValue(headers, "Vary")
+	for _, existing := range strings.Split(vary, ",") {
+		if strings.EqualFold(strings.TrimSpace(existing), field) {
+			return
+		}
+	}
+	deleteHeader(headers, "Vary")
+	if vary == "" {
+		headers["Vary"] = field
+	} else {
+		headers["Vary"] = vary + ", " + field
+	}
+}
@@ -0,0 +1,123 @@
+package httpmodule
+
+import (
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// TestNegotiateEncoding tests choosing a coding from Accept-Encoding.
+func TestNegotiateEncoding(t *testing.T) {
+	tests := map[string]string{
+		"gzip, deflate, br":      "gzip",
+		"deflate":                "deflate",
+		"gzip;q=0.5, deflate":    "deflate",
+		"GZIP":                   "gzip",
+		"gzip;q=0":               "",
+		"*":                      "gzip",
+		"*;q=0.1, gzip;q=0":      "deflate",
+		"br":                     "",
+		"":                       "",
+		"identity, gzip;q=0.001": "gzip",
+	}
+	for accept, want := range tests {
+		if got := negotiateEncoding(accept); got != want {
+			t.Errorf("%q: expected %q, got %q.", accept, want, got)
+		}
+	}
+}
+
+// TestCompress tests which responses get compressed.
+func TestCompress(t *testing.T) {
+	long := strings.Repeat("compress me ", 200)
+	respond := func(contentType, body string, status int) Handler {
+		return Compress(CompressOptions{})(HandlerFunc(func(w ResponseWriter, req *ServerRequest) {
+			if contentType != "" {
+				w.Header()["Content-Type"] = contentType
+			}
+			w.Header()["ETag"] = "\"v1\""
+			w.WriteHeader(status)
+			io.WriteString(w, body)
+		}))
+	}
+	gzipRequest := map[string]string{"Accept-Encoding": "gzip"}
+
+	rec := serveWith(respond("text/plain", long, 200), "GET", "/", gzipRequest)
+	if rec.headers["Content-Encoding"] != "gzip" || rec.headers["Vary"] != "Accept-Encoding" || rec.headers["ETag"] != "W/\"v1\"" {
+		t.Fatal("Expected a gzipped response, got", rec.headers)
+	}
+	reader, err := gzip.NewReader(strings.NewReader(string(rec.body)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := io.ReadAll(reader); string(data) != long || len(rec.body) >= len(long) {
+		t.Error("Expected the body to round trip and shrink.", len(rec.body))
+	}
+
+	rec = serveWith(respond("application/json; charset=utf-8", long, 200), "GET", "/", map[string]string{"Accept-Encoding": "deflate"})
+	reader2, err := zlib.NewReader(strings.NewReader(string(rec.body)))
+	if rec.headers["Content-Encoding"] != "deflate" || err != nil {
+		t.Fatal("Expected a deflated response, got", rec.headers, err)
+	}
+	if data, _ := io.ReadAll(reader2); string(data) != long {
+		t.Error("Expected the deflated body to round trip.")
+	}
+
+	// Sniffed types count too
+	if rec := serveWith(respond("", long, 200), "GET", "/", gzipRequest); rec.headers["Content-Encoding"] != "gzip" {
+		t.Error("Expected a sniffed text body to be compressed, got", rec.headers)
+	}
+
+	tests := []struct {
+		name    string
+		handler Handler
+		headers map[string]string
+		vary    string
+	}{
+		{"short body", respond("text/plain", "short", 200), gzipRequest, "Accept-Encoding"},
+		{"image", respond("image/png", long, 200), gzipRequest, ""},
+		{"no Accept-Encoding", respond("text/plain", long, 200), map[string]string{}, "Accept-Encoding"},
+		{"not modified", respond("text/plain", "", 304), gzipRequest, ""},
+		{"partial", respond("text/plain", long, 206), gzipRequest, ""},
+	}
+	for _, test := range tests {
+		rec := serveWith(test.handler, "GET", "/", test.headers)
+		if rec.headers["Content-Encoding"] != "" || rec.headers["Vary"] != test.vary {
+			t.Errorf("%s: expected an uncompressed response, got %v.", test.name, rec.headers)
+		}
+	}
+
+	already := Compress(CompressOptions{})(HandlerFunc(func(w ResponseWriter, req *ServerRequest) {
+		w.Header()["Content-Type"] = "text/plain"
+		w.Header()["Content-Encoding"] = "br"
+		io.WriteString(w, long)
+	}))
+	if rec := serveWith(already, "GET", "/", gzipRequest); rec.headers["Content-Encoding"] != "br" || string(rec.body) != long {
+		t.Error("Expected an encoded body to be left alone, got", rec.headers)
+	}
+}
+
+// TestCompressServer tests compressed responses over the wire, including streamed ones.
+func TestCompressServer(t *testing.T) {
+	srv, addr := startServer(t, HandlerFunc(func(w ResponseWriter, req *ServerRequest) {
+		w.Header()["Content-Type"] = "text/event-stream"
+		io.WriteString(w, "data: one\n\n")
+		w.(Flusher).Flush()
+		io.WriteString(w, "data: two\n\n")
+	}))
+	srv.Use(Compress(CompressOptions{ContentTypes: []string{"text/event-stream"}}))
+
+	// net/http asks for gzip and decompresses transparently
+	response, err := http.Get("http://" + addr + "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(response.Body)
+	response.Body.Close()
+	if !response.Uncompressed || string(body) != "data: one\n\ndata: two\n\n" {
+		t.Error("Expected a transparently decompressed stream, got", response.Uncompressed, string(body))
+	}
+}
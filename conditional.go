@@ -0,0 +1,48 @@
+package httpmodule
+
+import (
+	"net/http"
+	"time"
+)
+
+// NotModified is the error the conditional GETs return when the server
+// answers 304: the caller's copy is still current. ETag and LastModified are
+// the validators the server sent with it, if any, to use next time.
+type NotModified struct {
+	ETag         string
+	LastModified time.Time
+	Response     *HttpResponse
+}
+
+func (e *NotModified) Error() string {
+	return "not modified"
+}
+
+// GetIfNoneMatch gets url unless it still has the entity tag etag, as
+// returned in an earlier response's ETag header, in which case it returns a
+// *NotModified error
+func (client *HttpClient) GetIfNoneMatch(url, etag string) (*HttpResponse, error) {
+	return client.getConditional(url, "If-None-Match", etag)
+}
+
+// GetIfModifiedSince gets url unless it hasn't changed since t, such as an
+// earlier response's Last-Modified time, in which case it returns a
+// *NotModified error
+func (client *HttpClient) GetIfModifiedSince(url string, t time.Time) (*HttpResponse, error) {
+	return client.getConditional(url, "If-Modified-Since", t.UTC().Format(http.TimeFormat))
+}
+
+func (client *HttpClient) getConditional(url, header, value string) (*HttpResponse, error) {
+	response, err := client.Get(url, map[string]string{header: value})
+	if err != nil {
+		return nil, err
+	}
+	if response.StatusCode != 304 {
+		return response, nil
+	}
+	notModified := &NotModified{ETag: headerValue(response.Headers, "ETag"), Response: response}
+	if modified, ok := parseHTTPDate(headerValue(response.Headers, "Last-Modified")); ok {
+		notModified.LastModified = modified
+	}
+	return nil, notModified
+}
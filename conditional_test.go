@@ -0,0 +1,43 @@
+package httpmodule
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+)
+
+// TestConditionalGet tests getting changed resources and reporting unchanged ones.
+func TestConditionalGet(t *testing.T) {
+	modified := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	_, addr := startServer(t, HandlerFunc(func(w ResponseWriter, req *ServerRequest) {
+		w.Header()["ETag"] = `"v2"`
+		w.Header()["Last-Modified"] = modified.Format(http.TimeFormat)
+		since, _ := parseHTTPDate(req.Headers["If-Modified-Since"])
+		if req.Headers["If-None-Match"] == `"v2"` || !since.IsZero() && !since.Before(modified) {
+			w.WriteHeader(304)
+			return
+		}
+		w.Write([]byte("current"))
+	}))
+	client := New()
+	url := "http://" + addr + "/"
+
+	response, err := client.GetIfNoneMatch(url, `"v1"`)
+	if err != nil || response.Body != "current" {
+		t.Fatal("Expected the changed resource, got", response, err)
+	}
+	_, err = client.GetIfNoneMatch(url, `"v2"`)
+	var notModified *NotModified
+	if !errors.As(err, &notModified) || notModified.ETag != `"v2"` || !notModified.LastModified.Equal(modified) || notModified.Response.StatusCode != 304 {
+		t.Error("Expected NotModified, got", err)
+	}
+
+	response, err = client.GetIfModifiedSince(url, modified.Add(-time.Hour))
+	if err != nil || response.Body != "current" {
+		t.Fatal("Expected the changed resource, got", response, err)
+	}
+	if _, err = client.GetIfModifiedSince(url, modified.In(time.FixedZone("EST", -5*3600))); !errors.As(err, &notModified) {
+		t.Error("Expected NotModified, got", err)
+	}
+}
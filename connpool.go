@@ -0,0 +1,260 @@
+package httpmodule
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+// Number of idle connections kept per host when MaxIdleConnsPerHost is zero
+const defaultMaxIdleConnsPerHost = 2
+
+// errConnDropped is returned when a connection is closed before any part of the
+// response arrives, which is how servers reap idle keep-alive connections
+var errConnDropped = errors.New("connection closed before response was received")
+
+// persistConn is a connection that can carry several requests in turn. The
+// reader stays attached to it so buffered bytes are never lost between requests.
+type persistConn struct {
+	conn   net.Conn
+	reader *bufio.Reader
+
+	// Pace the request being sent, if any
+	limits []*BandwidthLimiter
+
+	// Body of the request being sent, when it is streamed
+	stream *bodyStream
+
+	// Limit on waiting for the response headers, or zero for none
+	headerTimeout time.Duration
+
+	// Set once watch has cut the connection off
+	cancelled atomic.Bool
+
+	// Follows the request being sent, if any
+	trace *roundTripTrace
+}
+
+func newPersistConn(conn net.Conn) *persistConn {
+	return &persistConn{
+		conn:   conn,
+		reader: getReader(conn),
+	}
+}
+
+// exchange sends a serialized request and reads the head of its response
+func (pc *persistConn) exchange(head *bytes.Buffer, body []byte, opts ParseOptions) (*HttpResponse, bool, error) {
+	var w io.Writer = pc.conn
+	if len(pc.limits) > 0 {
+		w = &throttledWriter{w: pc.conn, limits: pc.limits}
+	}
+	err := writeRequest(w, head, body)
+	if err != nil {
+		pc.trace.wroteRequest(err)
+		return nil, false, fmt.Errorf("failed to send request: %v: %w", err, errConnDropped)
+	}
+	if pc.stream != nil {
+		if err := pc.stream.writeTo(w); err != nil {
+			pc.trace.wroteRequest(err)
+			return nil, false, fmt.Errorf("failed to send request: %v", err)
+		}
+	}
+	pc.trace.wroteRequest(nil)
+
+	var deadline time.Time
+	if pc.headerTimeout > 0 {
+		deadline = time.Now().Add(pc.headerTimeout)
+		pc.conn.SetReadDeadline(deadline)
+		defer pc.clearReadDeadline()
+	}
+
+	// Wait for the first byte so a closed connection can be told apart from a
+	// malformed response
+	if _, err := pc.reader.Peek(1); err != nil {
+		if err == io.EOF || errors.Is(err, net.ErrClosed) || isConnReset(err) {
+			return nil, false, errConnDropped
+		}
+		if isTimeout(err) && !deadline.IsZero() {
+			return nil, false, &TimeoutError{Op: "awaiting response headers", Err: err}
+		}
+		return nil, false, fmt.Errorf("failed to read response: %v", err)
+	}
+	pc.trace.gotFirstByte()
+
+	response, keepAlive, err := readResponseHead(pc.reader, requestMethod(head.Bytes()), opts)
+	if err != nil {
+		if !deadline.IsZero() && !time.Now().Before(deadline) {
+			// Header lines cut off by the deadline look malformed
+			return nil, false, &TimeoutError{Op: "awaiting response headers"}
+		}
+		var protoErr *ProtocolError
+		if !errors.As(err, &protoErr) {
+			err = &ProtocolError{Err: err}
+		}
+		return nil, false, err
+	}
+	return response, keepAlive, nil
+}
+
+// watch makes reads and writes on the connection fail once ctx is done. stop
+// ends the watch and reports whether it had already cut the connection off,
+// leaving it unfit for reuse.
+func (pc *persistConn) watch(ctx context.Context) (stop func() bool) {
+	if ctx.Done() == nil {
+		return func() bool { return false }
+	}
+	done := make(chan struct{})
+	exited := make(chan bool, 1)
+	go func() {
+		select {
+		case <-ctx.Done():
+			// A deadline in the past wakes up anything blocked on the connection
+			pc.cancelled.Store(true)
+			pc.conn.SetDeadline(time.Unix(1, 0))
+			exited <- true
+		case <-done:
+			exited <- false
+		}
+	}()
+
+	var once sync.Once
+	var cancelled bool
+	return func() bool {
+		once.Do(func() {
+			close(done)
+			cancelled = <-exited
+		})
+		return cancelled
+	}
+}
+
+// clearReadDeadline lifts the read deadline set for the response headers,
+// unless watch has cut the connection off in the meantime
+func (pc *persistConn) clearReadDeadline() {
+	pc.conn.SetReadDeadline(time.Time{})
+	if pc.cancelled.Load() {
+		pc.conn.SetDeadline(time.Unix(1, 0))
+	}
+}
+
+// requestMethod returns the method at the start of a serialized request
+func requestMethod(head []byte) string {
+	if i := bytes.IndexByte(head, ' '); i >= 0 {
+		return internString(head[:i])
+	}
+	return ""
+}
+
+func (pc *persistConn) close() {
+	pc.conn.Close()
+	putReader(pc.reader)
+	pc.reader = nil
+}
+
+// isConnReset reports whether err came from the peer resetting the connection
+func isConnReset(err error) bool {
+	return errors.Is(err, syscall.ECONNRESET)
+}
+
+// connPool holds idle keep-alive connections keyed by scheme and host
+type connPool struct {
+	mu   sync.Mutex
+	idle map[string][]*persistConn
+}
+
+func poolKey(useTLS bool, host string) string {
+	if useTLS {
+		return "https://" + host
+	}
+	return "http://" + host
+}
+
+// get returns the most recently used idle connection for key, or nil
+func (pool *connPool) get(key string) *persistConn {
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+
+	conns := pool.idle[key]
+	if len(conns) == 0 {
+		return nil
+	}
+	conn := conns[len(conns)-1]
+	conns[len(conns)-1] = nil
+	pool.idle[key] = conns[:len(conns)-1]
+	return conn
+}
+
+// put stores conn for reuse, closing it instead if key already has max idle connections
+func (pool *connPool) put(key string, conn *persistConn, max int) {
+	pool.mu.Lock()
+	if pool.idle == nil {
+		pool.idle = make(map[string][]*persistConn)
+	}
+	if len(pool.idle[key]) < max {
+		pool.idle[key] = append(pool.idle[key], conn)
+		conn = nil
+	}
+	pool.mu.Unlock()
+
+	if conn != nil {
+		conn.close()
+	}
+}
+
+// idleCount returns the number of idle connections held for key
+func (pool *connPool) idleCount(key string) int {
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+	return len(pool.idle[key])
+}
+
+// idleKeys returns the keys idle connections are held under
+func (pool *connPool) idleKeys() []string {
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+	keys := make([]string, 0, len(pool.idle))
+	for key := range pool.idle {
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+// closeAll closes every idle connection
+func (pool *connPool) closeAll() {
+	pool.mu.Lock()
+	idle := pool.idle
+	pool.idle = nil
+	pool.mu.Unlock()
+
+	for _, conns := range idle {
+		for _, conn := range conns {
+			conn.close()
+		}
+	}
+}
+
+func (client *HttpClient) maxIdleConnsPerHost() int {
+	if client.MaxIdleConnsPerHost > 0 {
+		return client.MaxIdleConnsPerHost
+	}
+	return defaultMaxIdleConnsPerHost
+}
+
+// CloseIdleConnections closes any keep-alive connections the client is holding
+// on to. Connections in use by in-flight requests are not affected.
+func (client *HttpClient) CloseIdleConnections() {
+	keys := client.pool.idleKeys()
+	client.pool.closeAll()
+	for _, key := range keys {
+		client.collectIdle(&client.pool, key)
+	}
+	client.h2.closeIdle()
+}
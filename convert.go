@@ -0,0 +1,137 @@
+package httpmodule
+
+import (
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// FromHTTPRequest converts a net/http request, reading and closing its body.
+// Repeated header values are joined with commas, and a Host that differs from
+// the URL's is kept as a Host header. Requests received by a server, whose URL
+// is only a path, get an absolute URL built from Host.
+func FromHTTPRequest(req *http.Request) (*HttpRequest, error) {
+	url := *req.URL
+	if !url.IsAbs() {
+		url.Scheme = "http"
+		if req.TLS != nil {
+			url.Scheme = "https"
+		}
+		url.Host = req.Host
+	}
+	converted := &HttpRequest{
+		Method:  req.Method,
+		URL:     url.String(),
+		Headers: make(map[string]string, len(req.Header)+1),
+	}
+	if converted.Method == "" {
+		converted.Method = "GET"
+	}
+	for k, v := range req.Header {
+		converted.Headers[k] = strings.Join(v, ", ")
+	}
+	if req.Host != "" && req.Host != url.Host {
+		converted.Headers["Host"] = req.Host
+	}
+
+	if req.Body != nil {
+		body, err := io.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		converted.Body = string(body)
+	}
+	return converted, nil
+}
+
+// ToHTTPResponse converts response to a net/http response whose Request is
+// req, which may be nil. A body that hasn't been read yet is streamed, and
+// closing it releases the connection as HttpResponse.Close does.
+func ToHTTPResponse(response *HttpResponse, req *http.Request) *http.Response {
+	converted := &http.Response{
+		Status:        strconv.Itoa(response.StatusCode) + " " + response.Status,
+		StatusCode:    response.StatusCode,
+		Proto:         response.Protocol,
+		Header:        make(http.Header, len(response.Headers)),
+		ContentLength: -1,
+		Request:       req,
+	}
+	var ok bool
+	converted.ProtoMajor, converted.ProtoMinor, ok = http.ParseHTTPVersion(response.Protocol)
+	if !ok {
+		converted.ProtoMajor, converted.ProtoMinor = 1, 1
+	}
+	for k, values := range response.Header() {
+		for _, v := range values {
+			converted.Header.Add(k, v)
+		}
+	}
+	if n, err := strconv.ParseInt(converted.Header.Get("Content-Length"), 10, 64); err == nil && n >= 0 {
+		converted.ContentLength = n
+	}
+	if isChunked(response.Headers) {
+		converted.TransferEncoding = []string{"chunked"}
+		converted.Header.Del("Transfer-Encoding")
+	}
+
+	if response.body != nil {
+		converted.Body = &responseBody{response}
+	} else {
+		converted.Body = io.NopCloser(strings.NewReader(response.Body))
+	}
+	return converted
+}
+
+// ToHTTPRequest converts req to a net/http request
+func ToHTTPRequest(req *HttpRequest) (*http.Request, error) {
+	var body io.Reader
+	if req.Body != "" {
+		body = strings.NewReader(req.Body)
+	}
+	converted, err := http.NewRequest(req.Method, req.URL, body)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range req.Headers {
+		if http.CanonicalHeaderKey(k) == "Host" {
+			converted.Host = v
+			continue
+		}
+		converted.Header.Set(k, v)
+	}
+	return converted, nil
+}
+
+// FromHTTPResponse converts a net/http response, reading and closing its body.
+// Repeated header values are joined with commas in Headers and kept apart in
+// Header.
+func FromHTTPResponse(response *http.Response) (*HttpResponse, error) {
+	converted := &HttpResponse{
+		Protocol:   response.Proto,
+		StatusCode: response.StatusCode,
+		Status:     strings.TrimSpace(strings.TrimPrefix(response.Status, strconv.Itoa(response.StatusCode))),
+		Headers:    make(map[string]string, len(response.Header)),
+		header:     Header(response.Header.Clone()),
+	}
+	if converted.Protocol == "" {
+		converted.Protocol = "HTTP/1.1"
+	}
+	if converted.Status == "" {
+		converted.Status = statusText(response.StatusCode)
+	}
+	for k, v := range response.Header {
+		converted.Headers[k] = strings.Join(v, ", ")
+	}
+
+	if response.Body != nil {
+		body, err := io.ReadAll(response.Body)
+		response.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		converted.Body = string(body)
+	}
+	return converted, nil
+}
@@ -0,0 +1,82 @@
+package httpmodule
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// TestFromHTTPRequest tests converting outgoing and incoming net/http requests.
+func TestFromHTTPRequest(t *testing.T) {
+	req, _ := http.NewRequest("POST", "https://example.com/items?x=1", strings.NewReader("body"))
+	req.Header.Add("Accept", "text/plain")
+	req.Header.Add("Accept", "text/html")
+	converted, err := FromHTTPRequest(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if converted.Method != "POST" || converted.URL != "https://example.com/items?x=1" || converted.Body != "body" {
+		t.Error("Expected method, URL, and body to carry over.", converted)
+	}
+	if converted.Headers["Accept"] != "text/plain, text/html" {
+		t.Error("Expected repeated headers to be joined, got", converted.Headers["Accept"])
+	}
+	if _, ok := converted.Headers["Host"]; ok {
+		t.Error("Expected no Host header when it matches the URL.")
+	}
+
+	// Server-side requests only carry a path
+	incoming := httptest.NewRequest("GET", "/status", nil)
+	converted, err = FromHTTPRequest(incoming)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if converted.URL != "http://example.com/status" {
+		t.Error("Expected an absolute URL, got", converted.URL)
+	}
+}
+
+// TestToHTTPRequest tests converting a request to net/http.
+func TestToHTTPRequest(t *testing.T) {
+	converted, err := ToHTTPRequest(&HttpRequest{
+		Method:  "PUT",
+		URL:     "http://example.com/a",
+		Headers: map[string]string{"host": "virtual.example.com", "x-id": "7"},
+		Body:    "data",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(converted.Body)
+	if converted.Method != "PUT" || converted.Host != "virtual.example.com" || converted.Header.Get("X-Id") != "7" || string(body) != "data" {
+		t.Error("Expected the request to carry over.", converted)
+	}
+}
+
+// TestHTTPResponseConversion tests converting responses in both directions.
+func TestHTTPResponseConversion(t *testing.T) {
+	recorder := httptest.NewRecorder()
+	recorder.Header().Set("Content-Type", "text/plain")
+	recorder.WriteHeader(http.StatusTeapot)
+	io.WriteString(recorder, "short and stout")
+
+	converted, err := FromHTTPResponse(recorder.Result())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if converted.StatusCode != 418 || converted.Status != "I'm a teapot" || converted.Protocol != "HTTP/1.1" {
+		t.Error("Expected the status to carry over.", converted.StatusCode, converted.Status, converted.Protocol)
+	}
+	if converted.Headers["Content-Type"] != "text/plain" || converted.Body != "short and stout" {
+		t.Error("Expected headers and body to carry over.", converted)
+	}
+
+	back := ToHTTPResponse(converted, nil)
+	body, _ := io.ReadAll(back.Body)
+	back.Body.Close()
+	if back.Status != "418 I'm a teapot" || back.Header.Get("Content-Type") != "text/plain" || string(body) != "short and stout" {
+		t.Error("Expected the response to convert back.", back.Status, back.Header, string(body))
+	}
+}
@@ -0,0 +1,67 @@
+package httpmodule
+
+import (
+	"net/http"
+	"net/http/cookiejar"
+	neturl "net/url"
+	"strings"
+)
+
+// NewCookieJar returns an in-memory jar for HttpClient.Jar. It follows the
+// rules browsers do: cookies are scoped by Domain and Path, expire by Expires
+// or Max-Age, and Secure ones only go over https. Without a public suffix
+// list a site can set a cookie for a whole registry domain such as co.uk; use
+// cookiejar.New with one where that matters.
+func NewCookieJar() http.CookieJar {
+	jar, _ := cookiejar.New(nil)
+	return jar
+}
+
+// withCookies wraps transport so each request carries the jar's cookies for
+// its URL and each response's Set-Cookie headers go into the jar
+func withCookies(jar http.CookieJar, transport Transport) Transport {
+	return RoundTripFunc(func(req *HttpRequest) (*HttpResponse, error) {
+		u, err := neturl.Parse(req.URL)
+		if err != nil {
+			return transport.RoundTrip(req)
+		}
+		if cookies := jar.Cookies(u); len(cookies) > 0 {
+			pairs := make([]string, 0, len(cookies)+1)
+			if existing := headerValue(req.Headers, "Cookie"); existing != "" {
+				pairs = append(pairs, existing)
+			}
+			for _, cookie := range cookies {
+				pairs = append(pairs, cookie.Name+"="+cookie.Value)
+			}
+			headers := make(map[string]string, len(req.Headers)+1)
+			for k, v := range req.Headers {
+				headers[k] = v
+			}
+			deleteHeader(headers, "Cookie")
+			headers["Cookie"] = strings.Join(pairs, "; ")
+			withJar := *req
+			withJar.Headers = headers
+			req = &withJar
+		}
+
+		response, err := transport.RoundTrip(req)
+		if err != nil {
+			return nil, err
+		}
+		if cookies := responseCookies(response); len(cookies) > 0 {
+			jar.SetCookies(u, cookies)
+		}
+		return response, nil
+	})
+}
+
+// responseCookies parses the response's Set-Cookie headers, skipping any that
+// are malformed
+func responseCookies(response *HttpResponse) []*http.Cookie {
+	values := response.Header().Values("Set-Cookie")
+	if len(values) == 0 {
+		return nil
+	}
+	header := http.Header{"Set-Cookie": values}
+	return (&http.Response{Header: header}).Cookies()
+}
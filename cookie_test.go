@@ -0,0 +1,55 @@
+package httpmodule
+
+import (
+	"testing"
+)
+
+// TestCookieJar tests that cookies set by responses go out with later requests.
+func TestCookieJar(t *testing.T) {
+	_, addr := startServer(t, HandlerFunc(func(w ResponseWriter, req *ServerRequest) {
+		switch req.Path {
+		case "/login":
+			w.Header()["Set-Cookie"] = "session=abc; Path=/; HttpOnly\n" +
+				"admin=yes; Path=/admin\n" +
+				"token=secret; Secure\n" +
+				"old=1; Expires=Thu, 01 Jan 1970 00:00:00 GMT"
+			w.Header()["Location"] = "/home"
+			w.WriteHeader(302)
+		case "/logout":
+			w.Header()["Set-Cookie"] = "session=; Path=/; Max-Age=0"
+		default:
+			w.Write([]byte(req.Headers["Cookie"]))
+		}
+	}))
+	client := New()
+	client.HostOverrides = map[string]string{"cookies.test": addr}
+	client.Jar = NewCookieJar()
+
+	// The redirect after login already carries the new session
+	response, err := client.Get("http://cookies.test/login", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response.Body != "session=abc" {
+		t.Errorf("Expected only the session cookie on /home, got %q", response.Body)
+	}
+
+	response, err = client.Get("http://cookies.test/admin/users", map[string]string{"Cookie": "theme=dark"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response.Body != "theme=dark; admin=yes; session=abc" {
+		t.Errorf("Expected the path-scoped cookie too, after the caller's own, got %q", response.Body)
+	}
+
+	if _, err := client.Get("http://cookies.test/logout", nil); err != nil {
+		t.Fatal(err)
+	}
+	response, err = client.Get("http://cookies.test/home", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response.Body != "" {
+		t.Errorf("Expected the session to be deleted, got %q", response.Body)
+	}
+}
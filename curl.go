@@ -0,0 +1,77 @@
+package httpmodule
+
+import (
+	"sort"
+	"strings"
+)
+
+// CurlOptions controls how requests are rendered as curl commands
+type CurlOptions struct {
+	// Replace the values of secret headers, as the recorder does, so the
+	// command can be shared safely
+	MaskSecrets bool
+
+	// Proxy URL passed with --proxy
+	Proxy string
+
+	// Add --insecure to skip certificate verification
+	Insecure bool
+}
+
+// AsCurl returns a curl command line that sends req, for reproducing requests
+// outside the program. Only the request's own headers are included, not the
+// client's defaults.
+func (req *HttpRequest) AsCurl() string {
+	return CurlOptions{}.Command(req)
+}
+
+// Command returns a curl command line that sends req
+func (opts CurlOptions) Command(req *HttpRequest) string {
+	var b strings.Builder
+	b.WriteString("curl")
+
+	method := strings.ToUpper(req.Method)
+	switch {
+	case method == "HEAD":
+		b.WriteString(" --head")
+	case method == "" || method == "GET" && req.Body == "" || method == "POST" && req.Body != "":
+		// curl's default for the request
+	default:
+		b.WriteString(" -X " + shellQuote(method))
+	}
+
+	keys := make([]string, 0, len(req.Headers))
+	for k := range req.Headers {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		v := req.Headers[k]
+		if opts.MaskSecrets && isSecretHeader(k) {
+			v = redactedValue
+		}
+		b.WriteString(" -H " + shellQuote(k+": "+v))
+	}
+
+	if req.Body != "" {
+		b.WriteString(" --data-raw " + shellQuote(req.Body))
+	}
+	if opts.Proxy != "" {
+		b.WriteString(" --proxy " + shellQuote(opts.Proxy))
+	}
+	if opts.Insecure {
+		b.WriteString(" --insecure")
+	}
+	b.WriteString(" " + shellQuote(req.URL))
+	return b.String()
+}
+
+// shellQuote quotes s for a POSIX shell when it contains anything special
+func shellQuote(s string) string {
+	if s != "" && strings.IndexFunc(s, func(r rune) bool {
+		return !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || strings.ContainsRune("-_./:=@%+,", r))
+	}) < 0 {
+		return s
+	}
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
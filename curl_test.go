@@ -0,0 +1,37 @@
+package httpmodule
+
+import (
+	"testing"
+)
+
+// TestAsCurl tests rendering requests as curl commands.
+func TestAsCurl(t *testing.T) {
+	tests := []struct {
+		req  *HttpRequest
+		want string
+	}{
+		{&HttpRequest{Method: "GET", URL: "https://example.com/a"}, "curl https://example.com/a"},
+		{&HttpRequest{Method: "HEAD", URL: "https://example.com/a"}, "curl --head https://example.com/a"},
+		{&HttpRequest{Method: "POST", URL: "https://example.com/a", Body: `{"it's":1}`}, `curl --data-raw '{"it'\''s":1}' https://example.com/a`},
+		{&HttpRequest{Method: "DELETE", URL: "https://example.com/a?x=1&y=2"}, "curl -X DELETE 'https://example.com/a?x=1&y=2'"},
+		{
+			&HttpRequest{Method: "PUT", URL: "https://example.com/a", Headers: map[string]string{"X-B": "2", "Content-Type": "text/plain"}, Body: "hi"},
+			"curl -X PUT -H 'Content-Type: text/plain' -H 'X-B: 2' --data-raw hi https://example.com/a",
+		},
+	}
+	for _, test := range tests {
+		if got := test.req.AsCurl(); got != test.want {
+			t.Errorf("Expected %s, got %s", test.want, got)
+		}
+	}
+}
+
+// TestCurlOptions tests masking and proxy and TLS flags.
+func TestCurlOptions(t *testing.T) {
+	req := &HttpRequest{Method: "GET", URL: "https://example.com/", Headers: map[string]string{"Authorization": "Bearer secret"}}
+	got := CurlOptions{MaskSecrets: true, Proxy: "http://proxy:8080", Insecure: true}.Command(req)
+	want := "curl -H 'Authorization: REDACTED' --proxy http://proxy:8080 --insecure https://example.com/"
+	if got != want {
+		t.Errorf("Expected %s, got %s", want, got)
+	}
+}
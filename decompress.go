@@ -0,0 +1,108 @@
+package httpmodule
+
+import (
+	"bufio"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// decompressResponse undoes a gzip or deflate Content-Encoding on response's
+// body, and removes the Content-Encoding and Content-Length headers that
+// described the compressed form. Other encodings are left alone.
+func decompressResponse(response *HttpResponse) {
+	encoding := strings.ToLower(strings.TrimSpace(headerValue(response.Headers, "Content-Encoding")))
+	if encoding != "gzip" && encoding != "x-gzip" && encoding != "deflate" {
+		return
+	}
+	if response.body != nil {
+		response.body.decoder = &contentDecoder{encoding: encoding, raw: &rawBody{body: response.body}}
+	} else if response.Body != "" {
+		// Decoded as a deferred body would be, so ReadBody reports bad data
+		framed, _ := newBodyReader(bufio.NewReader(strings.NewReader(response.Body)), map[string]string{}, false)
+		body := &deferredBody{bodyReader: framed}
+		body.decoder = &contentDecoder{encoding: encoding, raw: &rawBody{body: body}}
+		response.Body = ""
+		response.body = body
+	}
+	deleteHeader(response.Headers, "Content-Encoding")
+	deleteHeader(response.Headers, "Content-Length")
+}
+
+// rawBody reads a deferred body as it came off the wire, remembering the
+// last error so it can be told apart from the decompressor's own
+type rawBody struct {
+	body *deferredBody
+	err  error
+}
+
+func (r *rawBody) Read(p []byte) (int, error) {
+	n, err := r.body.readRaw(p)
+	r.err = err
+	return n, err
+}
+
+// contentDecoder decompresses a body as it is read. The decompressor is set up
+// on the first read, since gzip reads its header straight away.
+type contentDecoder struct {
+	encoding string
+	raw      *rawBody
+	buffered *bufio.Reader
+	reader   io.Reader
+}
+
+func (d *contentDecoder) Read(p []byte) (int, error) {
+	if d.reader == nil {
+		d.buffered = bufio.NewReader(d.raw)
+		buffered := d.buffered
+		if _, err := buffered.Peek(1); err != nil {
+			// An empty body stays empty
+			return 0, err
+		}
+		if d.encoding == "deflate" {
+			// Some servers send raw deflate data without the zlib wrapper
+			// the standard calls for
+			if header, err := buffered.Peek(2); err == nil && header[0]&0x0f == 8 && (uint16(header[0])<<8|uint16(header[1]))%31 == 0 {
+				zr, err := zlib.NewReader(buffered)
+				if err != nil {
+					return 0, d.wrap(err)
+				}
+				d.reader = zr
+			} else {
+				d.reader = flate.NewReader(buffered)
+			}
+		} else {
+			zr, err := gzip.NewReader(buffered)
+			if err != nil {
+				return 0, d.wrap(err)
+			}
+			d.reader = zr
+		}
+	}
+
+	n, err := d.reader.Read(p)
+	if err == io.EOF {
+		// Consume whatever follows the compressed data so the connection
+		// is left at the end of the body
+		if _, drainErr := io.Copy(io.Discard, d.buffered); drainErr != nil {
+			return n, drainErr
+		}
+		return n, err
+	}
+	if err != nil {
+		err = d.wrap(err)
+	}
+	return n, err
+}
+
+// wrap explains an error from the decompressor; errors reading the body
+// itself, such as a cancelled request's, are passed on as they are
+func (d *contentDecoder) wrap(err error) error {
+	if err == d.raw.err {
+		return err
+	}
+	return fmt.Errorf("failed to decompress response: %v", err)
+}
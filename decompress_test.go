@@ -0,0 +1,86 @@
+package httpmodule
+
+import (
+	"bytes"
+	"compress/flate"
+	"crypto/sha256"
+	"hash"
+	"strings"
+	"testing"
+)
+
+// TestDecompressResponse tests that compressed responses arrive decoded.
+func TestDecompressResponse(t *testing.T) {
+	text := strings.Repeat("hello, compressed world\n", 200)
+	compressed := Compress(CompressOptions{})(HandlerFunc(func(w ResponseWriter, req *ServerRequest) {
+		w.Header()["Content-Type"] = "text/plain"
+		w.Write([]byte(text))
+	}))
+	_, addr := startServer(t, HandlerFunc(func(w ResponseWriter, req *ServerRequest) {
+		switch req.Path {
+		case "/raw-deflate":
+			var buf bytes.Buffer
+			fw, _ := flate.NewWriter(&buf, flate.DefaultCompression)
+			fw.Write([]byte(text))
+			fw.Close()
+			w.Header()["Content-Encoding"] = "deflate"
+			w.Write(buf.Bytes())
+		case "/corrupt":
+			w.Header()["Content-Encoding"] = "gzip"
+			w.Write([]byte("not gzip at all"))
+		default:
+			compressed.ServeHTTP(w, req)
+		}
+	}))
+	client := New()
+	client.HostOverrides = map[string]string{"compressed.test": addr}
+
+	for _, encoding := range []string{"gzip", "deflate"} {
+		response, err := client.Get("http://compressed.test/", map[string]string{"Accept-Encoding": encoding})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if response.Body != text {
+			t.Errorf("Expected the %s body decoded, got %d bytes.", encoding, len(response.Body))
+		}
+		if response.Headers["Content-Encoding"] != "" || response.Headers["Content-Length"] != "" {
+			t.Error("Expected the compressed form's headers removed, got", response.Headers)
+		}
+	}
+
+	response, err := client.Get("http://compressed.test/raw-deflate", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response.Body != text {
+		t.Error("Expected deflate data without the zlib wrapper decoded.")
+	}
+
+	if _, err := client.Get("http://compressed.test/corrupt", nil); err == nil || !strings.Contains(err.Error(), "decompress") {
+		t.Error("Expected corrupt data to fail to decompress, got", err)
+	}
+
+	// Deferred bodies are decoded as they are read, and hashed decoded
+	client.DeferBody = true
+	sum := sha256.New()
+	response, err = client.Do(&HttpRequest{Method: "GET", URL: "http://compressed.test/", ResponseHashes: []hash.Hash{sum}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if body, err := response.ReadBody(); err != nil || body != text {
+		t.Error("Expected the deferred body decoded, got", len(body), err)
+	}
+	if want := sha256.Sum256([]byte(text)); !bytes.Equal(sum.Sum(nil), want[:]) {
+		t.Error("Expected the hash of the decoded body.")
+	}
+
+	client.DeferBody = false
+	client.DisableDecompression = true
+	response, err = client.Get("http://compressed.test/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response.Headers["Content-Encoding"] != "gzip" || response.Body == text {
+		t.Error("Expected the body as sent with decompression disabled.")
+	}
+}
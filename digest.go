@@ -0,0 +1,198 @@
+package httpmodule
+
+import (
+	"bytes"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"strings"
+)
+
+// Hashes digests can be checked with, by normalized algorithm name
+var digestHashes = map[string]func() hash.Hash{
+	"sha-256": sha256.New,
+	"sha-512": sha512.New,
+	"sha-1":   sha1.New,
+	"md5":     md5.New,
+}
+
+// Digest is the expected hash of a file
+type Digest struct {
+	// Lowercase algorithm name: "sha-256", "sha-512", "sha-1", or "md5"
+	Algorithm string
+	Value     []byte
+}
+
+// ParseDigest parses a digest as package indexes and HTTP headers give them:
+// "sha256:<hex>", "sha-256=<base64>" as in the Digest header, or
+// "sha-256=:<base64>:" as in Repr-Digest
+func ParseDigest(s string) (Digest, error) {
+	s = strings.TrimSpace(s)
+	if name, value, found := strings.Cut(s, ":"); found && !strings.Contains(name, "=") {
+		algorithm, err := digestAlgorithm(name)
+		if err != nil {
+			return Digest{}, err
+		}
+		sum, err := hex.DecodeString(value)
+		if err != nil {
+			return Digest{}, fmt.Errorf("invalid hex digest: %v", err)
+		}
+		return newDigest(algorithm, sum)
+	}
+	name, value, found := strings.Cut(s, "=")
+	if !found {
+		return Digest{}, fmt.Errorf("malformed digest %q", s)
+	}
+	algorithm, err := digestAlgorithm(name)
+	if err != nil {
+		return Digest{}, err
+	}
+	if inner, ok := strings.CutPrefix(value, ":"); ok {
+		value = strings.TrimSuffix(inner, ":")
+	}
+	sum, err := base64.StdEncoding.DecodeString(value)
+	if err != nil {
+		return Digest{}, fmt.Errorf("invalid base64 digest: %v", err)
+	}
+	return newDigest(algorithm, sum)
+}
+
+// digestAlgorithm normalizes an algorithm name such as "SHA256" or "sha-256"
+func digestAlgorithm(name string) (string, error) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if strings.HasPrefix(name, "sha") && !strings.HasPrefix(name, "sha-") {
+		name = "sha-" + name[3:]
+	}
+	if _, ok := digestHashes[name]; !ok {
+		return "", fmt.Errorf("unsupported digest algorithm %q", name)
+	}
+	return name, nil
+}
+
+// newDigest checks sum is the right length for algorithm
+func newDigest(algorithm string, sum []byte) (Digest, error) {
+	if size := digestHashes[algorithm]().Size(); len(sum) != size {
+		return Digest{}, fmt.Errorf("%s digest is %d bytes, want %d", algorithm, len(sum), size)
+	}
+	return Digest{Algorithm: algorithm, Value: sum}, nil
+}
+
+func (digest Digest) String() string {
+	return digest.Algorithm + ":" + hex.EncodeToString(digest.Value)
+}
+
+// DigestMismatchError is returned when a downloaded file doesn't have the
+// digest it was expected to. The file has been removed.
+type DigestMismatchError struct {
+	Path     string
+	Expected Digest
+	Actual   []byte
+}
+
+func (e *DigestMismatchError) Error() string {
+	return fmt.Sprintf("download failed: %s has %s digest %x, expected %x", e.Path, e.Expected.Algorithm, e.Actual, e.Expected.Value)
+}
+
+// headerDigests returns the digests of the whole file a response declares in
+// Repr-Digest or Digest, and in Content-MD5 when the body is the whole file.
+// Unsupported or malformed ones are ignored.
+func headerDigests(response *HttpResponse) []Digest {
+	var digests []Digest
+	for _, name := range []string{"Repr-Digest", "Digest"} {
+		for _, part := range strings.Split(headerValue(response.Headers, name), ",") {
+			if digest, err := ParseDigest(part); err == nil {
+				digests = append(digests, digest)
+			}
+		}
+	}
+	if response.StatusCode == 200 {
+		if value := headerValue(response.Headers, "Content-MD5"); value != "" {
+			if digest, err := ParseDigest("md5=" + value); err == nil {
+				digests = append(digests, digest)
+			}
+		}
+	}
+	return digests
+}
+
+// digestVerifier checks a download against its expected digests, hashing it
+// as it streams in when it arrives in order, and from disk otherwise
+type digestVerifier struct {
+	expected []Digest
+	hashes   []hash.Hash
+
+	// Set once every byte of the file has gone through hashes
+	streamed bool
+}
+
+func newDigestVerifier(expected []Digest) *digestVerifier {
+	return &digestVerifier{expected: append([]Digest(nil), expected...)}
+}
+
+// expect adds digests the server declared
+func (v *digestVerifier) expect(digests []Digest) {
+	v.expected = append(v.expected, digests...)
+}
+
+// stream returns body hashed on its way through, after the first written
+// bytes already in file
+func (v *digestVerifier) stream(file *os.File, written int64, body io.Reader) (io.Reader, error) {
+	if len(v.expected) == 0 {
+		return body, nil
+	}
+	v.reset()
+	w := v.writer()
+	if _, err := io.Copy(w, io.NewSectionReader(file, 0, written)); err != nil {
+		return nil, err
+	}
+	v.streamed = true
+	return io.TeeReader(body, w), nil
+}
+
+// verify checks the file at path, downloaded for dest, hashing it from disk
+// unless it was streamed
+func (v *digestVerifier) verify(path, dest string) error {
+	if len(v.expected) == 0 {
+		return nil
+	}
+	if !v.streamed || len(v.hashes) != len(v.expected) {
+		file, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		v.reset()
+		if _, err := io.Copy(v.writer(), file); err != nil {
+			return err
+		}
+	}
+	for i, digest := range v.expected {
+		if sum := v.hashes[i].Sum(nil); !bytes.Equal(sum, digest.Value) {
+			return &DigestMismatchError{Path: dest, Expected: digest, Actual: sum}
+		}
+	}
+	return nil
+}
+
+func (v *digestVerifier) reset() {
+	v.hashes = v.hashes[:0]
+	for _, digest := range v.expected {
+		v.hashes = append(v.hashes, digestHashes[digest.Algorithm]())
+	}
+	v.streamed = false
+}
+
+func (v *digestVerifier) writer() io.Writer {
+	writers := make([]io.Writer, len(v.hashes))
+	for i, h := range v.hashes {
+		writers[i] = h
+	}
+	return io.MultiWriter(writers...)
+}
@@ -0,0 +1,101 @@
+package httpmodule
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+// TestParseDigest tests the forms digests are written in.
+func TestParseDigest(t *testing.T) {
+	sum := sha256.Sum256([]byte("hello"))
+	b64 := base64.StdEncoding.EncodeToString(sum[:])
+	for _, s := range []string{
+		"sha256:" + hex.EncodeToString(sum[:]),
+		"SHA-256:" + hex.EncodeToString(sum[:]),
+		"sha-256=" + b64,
+		" SHA-256=:" + b64 + ": ",
+	} {
+		digest, err := ParseDigest(s)
+		if err != nil {
+			t.Errorf("Expected %q to parse, got %v.", s, err)
+			continue
+		}
+		if digest.Algorithm != "sha-256" || string(digest.Value) != string(sum[:]) {
+			t.Errorf("Expected the SHA-256 of hello from %q, got %v.", s, digest)
+		}
+	}
+	for _, s := range []string{"", "crc32:00000000", "sha256:zz", "sha-256=!!", "md5:" + hex.EncodeToString(sum[:])} {
+		if _, err := ParseDigest(s); err == nil {
+			t.Errorf("Expected an error for %q.", s)
+		}
+	}
+}
+
+// TestDownloaderVerify tests checking downloads against expected digests.
+func TestDownloaderVerify(t *testing.T) {
+	payload := testPayload(200 << 10)
+	sum := sha256.Sum256(payload)
+	good := Digest{Algorithm: "sha-256", Value: sum[:]}
+	ds := startDownloadServer(t, fstest.MapFS{"pkg.bin": {Data: payload, ModTime: time.Unix(1700000000, 0)}})
+	url := "http://" + ds.addr + "/pkg.bin"
+	dir := t.TempDir()
+
+	for _, segments := range []int{1, 3} {
+		d := ds.downloader(t)
+		d.Segments = segments
+		d.CheckpointInterval = 16 << 10
+		dest := filepath.Join(dir, "ok.bin")
+		ds.cutNext(70 << 10)
+		d.Download(url, dest, good)
+		if _, err := d.Download(url, dest, good); err != nil {
+			t.Error("Expected the resumed file to verify with", segments, "segments, got", err)
+		}
+	}
+
+	d := ds.downloader(t)
+	dest := filepath.Join(dir, "bad.bin")
+	wrong := md5.Sum([]byte("something else"))
+	_, err := d.Download(url, dest, good, Digest{Algorithm: "md5", Value: wrong[:]})
+	var mismatch *DigestMismatchError
+	if !errors.As(err, &mismatch) || mismatch.Expected.Algorithm != "md5" || mismatch.Path != dest {
+		t.Fatal("Expected an MD5 mismatch, got", err)
+	}
+	if actual := md5.Sum(payload); string(mismatch.Actual) != string(actual[:]) {
+		t.Error("Expected the actual digest in the error.")
+	}
+	if _, err := os.Stat(dest); !os.IsNotExist(err) {
+		t.Error("Expected the corrupt file to be removed, got", err)
+	}
+}
+
+// TestDownloaderHeaderDigest tests checking downloads against digests the server declares.
+func TestDownloaderHeaderDigest(t *testing.T) {
+	payload := []byte("package contents")
+	sum := sha256.Sum256(payload)
+	declared := "sha-256=:" + base64.StdEncoding.EncodeToString(sum[:]) + ":"
+	_, addr := startServer(t, HandlerFunc(func(w ResponseWriter, req *ServerRequest) {
+		w.Header()["Repr-Digest"] = declared
+		w.Write(payload)
+	}))
+	d := NewDownloader(nil)
+	d.Client.Transport = loopbackTransport(t, d.Client, addr)
+	dest := filepath.Join(t.TempDir(), "pkg.bin")
+
+	if _, err := d.Download("http://"+addr+"/", dest); err != nil {
+		t.Fatal(err)
+	}
+	payload = []byte("tampered contents")
+	_, err := d.Download("http://"+addr+"/", dest)
+	var mismatch *DigestMismatchError
+	if !errors.As(err, &mismatch) {
+		t.Error("Expected the declared digest to be checked, got", err)
+	}
+}
@@ -0,0 +1,163 @@
+package httpmodule
+
+import (
+	"context"
+	"net"
+	"sync"
+	"time"
+)
+
+// DNSCache remembers resolved addresses per host so that repeated dials to the
+// same name don't pay for a lookup every time. Failed lookups are cached too,
+// for NegativeTTL, so an unresolvable name doesn't hammer the resolver.
+type DNSCache struct {
+	// Resolve looks up host and reports how long the answer may be cached. A
+	// zero TTL means the resolver doesn't know, and DefaultTTL is used. When nil
+	// the Resolve of the client dialing is used, or failing that the system
+	// resolver; it doesn't expose record TTLs, so its answers are always cached
+	// for DefaultTTL.
+	Resolve func(ctx context.Context, host string) (addrs []string, ttl time.Duration, err error)
+
+	// TTL used when the resolver doesn't report one
+	DefaultTTL time.Duration
+
+	// Bounds applied to every positive TTL; zero disables the bound
+	MinTTL time.Duration
+	MaxTTL time.Duration
+
+	// How long a failed lookup is remembered; zero disables negative caching
+	NegativeTTL time.Duration
+
+	// Source of time for expiring entries; nil uses the real clock
+	Clock Clock
+
+	mu      sync.Mutex
+	entries map[string]*dnsEntry
+}
+
+type dnsEntry struct {
+	addrs   []string
+	err     error
+	expires time.Time
+
+	// Set when the lookup ended because its caller gave up
+	abandoned bool
+
+	// Closed once the lookup filling this entry has finished
+	ready chan struct{}
+}
+
+// NewDNSCache returns a cache with defaults suited to most clients
+func NewDNSCache() *DNSCache {
+	return &DNSCache{
+		DefaultTTL:  30 * time.Second,
+		MinTTL:      5 * time.Second,
+		MaxTTL:      10 * time.Minute,
+		NegativeTTL: 5 * time.Second,
+	}
+}
+
+// LookupHost returns the addresses for host, resolving it only if there is no
+// unexpired entry. Concurrent lookups of the same host share a single query.
+func (cache *DNSCache) LookupHost(ctx context.Context, host string) ([]string, error) {
+	return cache.lookup(ctx, host, nil)
+}
+
+// lookup is LookupHost, resolving with resolve when the cache has no Resolve
+// of its own
+func (cache *DNSCache) lookup(ctx context.Context, host string, resolve resolveFunc) ([]string, error) {
+	// IP literals never need resolving
+	if net.ParseIP(host) != nil {
+		return []string{host}, nil
+	}
+
+	cache.mu.Lock()
+	if cache.entries == nil {
+		cache.entries = make(map[string]*dnsEntry)
+	}
+	entry, ok := cache.entries[host]
+	if ok {
+		select {
+		case <-entry.ready:
+			if clockOrReal(cache.Clock).Now().Before(entry.expires) {
+				cache.mu.Unlock()
+				return entry.addrs, entry.err
+			}
+			ok = false
+		default:
+			// Another caller is resolving this host right now
+		}
+	}
+	if !ok {
+		entry = &dnsEntry{ready: make(chan struct{})}
+		cache.entries[host] = entry
+		cache.mu.Unlock()
+		cache.fill(ctx, host, entry, resolve)
+		return entry.addrs, entry.err
+	}
+	cache.mu.Unlock()
+
+	select {
+	case <-entry.ready:
+		if entry.abandoned && ctx.Err() == nil {
+			// The caller doing the lookup gave up, not this one
+			return cache.lookup(ctx, host, resolve)
+		}
+		return entry.addrs, entry.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// fill resolves host into entry and wakes up anyone waiting on it
+func (cache *DNSCache) fill(ctx context.Context, host string, entry *dnsEntry, resolve resolveFunc) {
+	defer close(entry.ready)
+
+	if cache.Resolve != nil {
+		resolve = cache.Resolve
+	}
+	if resolve == nil {
+		resolve = systemResolve
+	}
+	addrs, ttl, err := resolve(ctx, host)
+	now := clockOrReal(cache.Clock).Now()
+	if err != nil {
+		entry.err = err
+		entry.expires = now.Add(cache.NegativeTTL)
+		if ctx.Err() != nil {
+			// Our caller gave up; that says nothing about the name itself
+			entry.expires = time.Time{}
+			entry.abandoned = true
+		}
+		return
+	}
+
+	if ttl <= 0 {
+		ttl = cache.DefaultTTL
+	}
+	if cache.MinTTL > 0 && ttl < cache.MinTTL {
+		ttl = cache.MinTTL
+	}
+	if cache.MaxTTL > 0 && ttl > cache.MaxTTL {
+		ttl = cache.MaxTTL
+	}
+	entry.addrs = addrs
+	entry.expires = now.Add(ttl)
+}
+
+// resolveFunc looks up host, reporting how long the answer may be cached
+type resolveFunc = func(ctx context.Context, host string) (addrs []string, ttl time.Duration, err error)
+
+// systemResolve looks up host with the system resolver, which doesn't say
+// how long its answers last
+func systemResolve(ctx context.Context, host string) ([]string, time.Duration, error) {
+	addrs, err := net.DefaultResolver.LookupHost(ctx, host)
+	return addrs, 0, err
+}
+
+// Flush drops every cached entry
+func (cache *DNSCache) Flush() {
+	cache.mu.Lock()
+	cache.entries = nil
+	cache.mu.Unlock()
+}
@@ -0,0 +1,196 @@
+package httpmodule
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// TestDNSCacheHonorsTTL tests that answers are reused until their TTL expires.
+func TestDNSCacheHonorsTTL(t *testing.T) {
+	lookups := 0
+	clock := NewFakeClock(time.Now())
+	cache := &DNSCache{
+		Clock: clock,
+		Resolve: func(ctx context.Context, host string) ([]string, time.Duration, error) {
+			lookups++
+			return []string{"10.0.0.1"}, time.Minute, nil
+		},
+	}
+
+	for i := 0; i < 3; i++ {
+		addrs, err := cache.LookupHost(context.Background(), "example.com")
+		if err != nil || len(addrs) != 1 || addrs[0] != "10.0.0.1" {
+			t.Error("Expected cached address.", addrs, err)
+		}
+	}
+	if lookups != 1 {
+		t.Errorf("Expected 1 lookup, got %d.", lookups)
+	}
+
+	clock.Advance(time.Minute)
+	cache.LookupHost(context.Background(), "example.com")
+	if lookups != 2 {
+		t.Errorf("Expected a new lookup after the TTL expired, got %d lookups.", lookups)
+	}
+}
+
+// TestDNSCacheBoundsTTL tests that MaxTTL caps the TTL reported by the resolver.
+func TestDNSCacheBoundsTTL(t *testing.T) {
+	cache := &DNSCache{
+		MaxTTL: time.Minute,
+		Resolve: func(ctx context.Context, host string) ([]string, time.Duration, error) {
+			return []string{"10.0.0.1"}, 24 * time.Hour, nil
+		},
+	}
+	cache.LookupHost(context.Background(), "example.com")
+	if expires := time.Until(cache.entries["example.com"].expires); expires > time.Minute {
+		t.Errorf("Expected TTL capped at a minute, got %v.", expires)
+	}
+}
+
+// TestDNSCacheNegative tests that failed lookups are cached for NegativeTTL.
+func TestDNSCacheNegative(t *testing.T) {
+	lookups := 0
+	cache := &DNSCache{
+		NegativeTTL: time.Minute,
+		Resolve: func(ctx context.Context, host string) ([]string, time.Duration, error) {
+			lookups++
+			return nil, 0, errors.New("no such host")
+		},
+	}
+	for i := 0; i < 2; i++ {
+		if _, err := cache.LookupHost(context.Background(), "missing.example"); err == nil {
+			t.Error("Expected lookup error.")
+		}
+	}
+	if lookups != 1 {
+		t.Errorf("Expected 1 lookup, got %d.", lookups)
+	}
+}
+
+// TestDNSCacheIPLiteral tests that IP addresses bypass the resolver.
+func TestDNSCacheIPLiteral(t *testing.T) {
+	cache := &DNSCache{
+		Resolve: func(ctx context.Context, host string) ([]string, time.Duration, error) {
+			t.Error("Expected no lookup for an IP literal.")
+			return nil, 0, nil
+		},
+	}
+	addrs, err := cache.LookupHost(context.Background(), "127.0.0.1")
+	if err != nil || len(addrs) != 1 || addrs[0] != "127.0.0.1" {
+		t.Error("Expected the literal back.", addrs, err)
+	}
+}
+
+// TestDNSCacheAbandonedLookup tests that a caller waiting on a shared lookup
+// isn't failed when the caller doing it gives up.
+func TestDNSCacheAbandonedLookup(t *testing.T) {
+	started := make(chan struct{})
+	var lookups int32
+	cache := &DNSCache{
+		Resolve: func(ctx context.Context, host string) ([]string, time.Duration, error) {
+			if atomic.AddInt32(&lookups, 1) == 1 {
+				close(started)
+				<-ctx.Done()
+				return nil, 0, ctx.Err()
+			}
+			return []string{"10.0.0.1"}, time.Minute, nil
+		},
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	first := make(chan error, 1)
+	go func() {
+		_, err := cache.LookupHost(ctx, "example.com")
+		first <- err
+	}()
+	<-started
+	second := make(chan []string, 1)
+	go func() {
+		addrs, err := cache.LookupHost(context.Background(), "example.com")
+		if err != nil {
+			t.Error("Expected the waiting caller to resolve the host itself, got", err)
+		}
+		second <- addrs
+	}()
+	// Give the second caller time to start waiting on the shared lookup
+	time.Sleep(20 * time.Millisecond)
+	cancel()
+
+	if err := <-first; !errors.Is(err, context.Canceled) {
+		t.Error("Expected the first caller to be cancelled, got", err)
+	}
+	if addrs := <-second; len(addrs) != 1 || addrs[0] != "10.0.0.1" {
+		t.Error("Expected the address from a fresh lookup, got", addrs)
+	}
+	if n := atomic.LoadInt32(&lookups); n != 2 {
+		t.Errorf("Expected 2 lookups, got %d.", n)
+	}
+}
+
+// stubResolver answers every name with one address, counting lookups.
+type stubResolver struct {
+	addr    string
+	lookups int32
+}
+
+func (r *stubResolver) LookupHost(ctx context.Context, host string) ([]string, error) {
+	atomic.AddInt32(&r.lookups, 1)
+	return []string{r.addr}, nil
+}
+
+// TestClientDNSCacheDefault tests that clients cache lookups out of the box,
+// through a custom Resolve too, and that a Resolver is used as it is.
+func TestClientDNSCacheDefault(t *testing.T) {
+	_, addr := startServer(t, echoHandler)
+	host, port, _ := net.SplitHostPort(addr)
+	url := "http://backend.test:" + port + "/"
+
+	var lookups int32
+	client := New()
+	client.Resolve = func(ctx context.Context, name string) ([]string, time.Duration, error) {
+		atomic.AddInt32(&lookups, 1)
+		return []string{host}, 0, nil
+	}
+	for i := 0; i < 2; i++ {
+		if _, err := client.Get(url, nil); err != nil {
+			t.Fatal(err)
+		}
+		// A new connection, and so a new dial, for each request
+		client.CloseIdleConnections()
+	}
+	if n := atomic.LoadInt32(&lookups); n != 1 {
+		t.Errorf("Expected 1 lookup across both requests, got %d.", n)
+	}
+
+	// A cache without a Resolve of its own goes through the client's
+	atomic.StoreInt32(&lookups, 0)
+	client.DNSCache = NewDNSCache()
+	if _, err := client.Get(url, nil); err != nil || atomic.LoadInt32(&lookups) != 1 {
+		t.Error("Expected DNSCache to resolve through Resolve, got", err, atomic.LoadInt32(&lookups))
+	}
+	client.CloseIdleConnections()
+
+	resolver := &stubResolver{addr: host}
+	client.Resolver = resolver
+	for i := 0; i < 2; i++ {
+		if _, err := client.Get(url, nil); err != nil {
+			t.Fatal(err)
+		}
+		client.CloseIdleConnections()
+	}
+	if n := atomic.LoadInt32(&resolver.lookups); n != 2 {
+		t.Errorf("Expected the Resolver used for every dial, got %d lookups.", n)
+	}
+}
+
+// The resolvers the package provides can all stand in as a client's Resolver
+var (
+	_ Resolver = (*DNSCache)(nil)
+	_ Resolver = (*DoHResolver)(nil)
+	_ Resolver = (*DoTResolver)(nil)
+)
@@ -0,0 +1,12 @@
+// Package httpmodule is an HTTP client and server written over plain
+// connections: HttpClient speaks HTTP/1.1 itself, with its own connection
+// pool, and Server parses and answers HTTP/1.1 requests itself.
+//
+// HTTP/2 is not implemented natively. When a server chooses h2 through ALPN,
+// or a client asks a Server for h2 or h2c, the framing, HPACK, flow control,
+// and stream multiplexing are left to the standard library's HTTP/2 client
+// and server, running over connections this package has dialed or accepted.
+// Everything layered above the transport, such as redirects, retries,
+// cookies, caching, middleware, and logging, works the same on both
+// protocols; see HttpClient.HTTP2 and Server.DisableHTTP2.
+package httpmodule
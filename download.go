@@ -0,0 +1,460 @@
+package httpmodule
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Bytes written between checkpoints when Downloader doesn't set an interval
+const defaultCheckpointInterval = 1 << 20
+
+// Suffix of the sidecar file a download's progress is recorded in
+const checkpointSuffix = ".download"
+
+// Suffix of the file a download is written to until it is complete
+const partialSuffix = ".part"
+
+// Downloader fetches URLs into files. Data goes to a partial file beside the
+// destination, which is renamed into place once complete and verified, so
+// the destination is never seen half written. Progress is recorded in a
+// checkpoint file beside it too, so a transfer that fails part way can be
+// resumed by calling Download again: the rest is requested with Range, and
+// If-Range makes sure it comes from the same version of the file, starting
+// over if the file has changed on the server.
+type Downloader struct {
+	Client *HttpClient
+
+	// Headers added to every request, such as credentials
+	Headers map[string]string
+
+	// Bytes written between checkpoints; zero means 1 MiB
+	CheckpointInterval int64
+
+	// Number of ranges to fetch at once for large files from servers that
+	// accept ranges; zero or one fetches in a single stream
+	Segments int
+
+	// Called with the progress of each download every ProgressInterval
+	// while data arrives, and once more when it completes; calls for one
+	// download are never concurrent
+	Progress func(DownloadProgress)
+
+	// Time between progress reports; zero means half a second
+	ProgressInterval time.Duration
+
+	// Permissions of finished files; zero keeps those of the file being
+	// replaced, or 0644 for a new one
+	FileMode os.FileMode
+
+	// Set finished files' modification time from Last-Modified
+	PreserveModTime bool
+
+	// Flush finished files and their directory entry to disk before
+	// returning, so they survive a crash
+	Sync bool
+
+	// Time DownloadMirrors waits for mirrors to answer before ranking them;
+	// zero means five seconds
+	MirrorProbeTimeout time.Duration
+
+	// Times progress reports and mirror probes; nil uses the real clock
+	Clock Clock
+}
+
+// NewDownloader returns a Downloader that sends requests through client, or a
+// new client if nil
+func NewDownloader(client *HttpClient) *Downloader {
+	if client == nil {
+		client = New()
+	}
+	return &Downloader{Client: client}
+}
+
+// DownloadFile fetches url into the file at path with a Downloader using the
+// client. If an earlier call for the same URL was interrupted, the transfer
+// resumes from the bytes already on disk, provided the file on the server
+// hasn't changed since.
+func (client *HttpClient) DownloadFile(url, path string) (*DownloadResult, error) {
+	return NewDownloader(client).Download(url, path)
+}
+
+// DownloadResult describes a finished download
+type DownloadResult struct {
+	// Size of the file
+	Size int64
+
+	// Bytes carried over from an earlier, interrupted attempt
+	Resumed int64
+
+	// Number of ranges fetched at once; 1 for a single stream
+	Segments int
+
+	// URL the file was last fetched from, which for DownloadMirrors is the
+	// mirror that finished it
+	Source string
+
+	// Headers of the last response
+	Headers map[string]string
+}
+
+// checkpoint is what is known about a partly downloaded file, saved beside it
+type checkpoint struct {
+	URL          string `json:"url"`
+	ETag         string `json:"etag,omitempty"`
+	LastModified string `json:"last_modified,omitempty"`
+
+	// Mirror the validators came from, if not URL
+	Source string `json:"source,omitempty"`
+
+	// Length of the whole file, or -1 if the server didn't say
+	Size int64 `json:"size"`
+
+	// Bytes of the file known to be on disk
+	Written int64 `json:"written"`
+
+	// Ranges of a segmented download, which has no single Written
+	Segments []*segment `json:"segments,omitempty"`
+}
+
+// Download fetches url into the file at dest, resuming an earlier attempt
+// if dest has a checkpoint for the same URL. With Segments set, large files
+// are fetched in parallel ranges, falling back to a single stream when the
+// server doesn't accept ranges.
+//
+// The file is checked against the expected digests, and any the server
+// declares in Repr-Digest, Digest, or Content-MD5. If one doesn't match,
+// the file is removed and a *DigestMismatchError returned.
+func (d *Downloader) Download(url, dest string, expected ...Digest) (*DownloadResult, error) {
+	return d.download(url, url, dest, expected)
+}
+
+// download fetches url into dest, carrying on from the checkpoint recorded
+// under key, which differs from url when url is one of several mirrors
+func (d *Downloader) download(key, url, dest string, expected []Digest) (*DownloadResult, error) {
+	state := d.loadCheckpoint(key, dest)
+	verifier := newDigestVerifier(expected)
+	var result *DownloadResult
+	var err error
+	if len(state.Segments) > 0 || (d.Segments > 1 && state.Written == 0) {
+		result, err = d.downloadSegmented(url, dest, state, verifier)
+		if err == errSegmentsUnusable {
+			result, err = d.downloadStream(url, dest, &checkpoint{URL: key, Size: -1}, verifier)
+		}
+	} else {
+		result, err = d.downloadStream(url, dest, state, verifier)
+	}
+	if err != nil {
+		return nil, err
+	}
+	partial := dest + partialSuffix
+	if err := verifier.verify(partial, dest); err != nil {
+		os.Remove(partial)
+		os.Remove(dest + checkpointSuffix)
+		return nil, err
+	}
+	if err := d.install(partial, dest, result.Headers); err != nil {
+		return nil, err
+	}
+	result.Source = url
+	return result, nil
+}
+
+// install moves the finished download at partial into place at dest
+func (d *Downloader) install(partial, dest string, headers map[string]string) error {
+	mode := d.FileMode
+	if mode == 0 {
+		mode = 0644
+		if info, err := os.Stat(dest); err == nil {
+			mode = info.Mode().Perm()
+		}
+	}
+	if err := os.Chmod(partial, mode); err != nil {
+		return err
+	}
+	if d.PreserveModTime {
+		if modified, err := time.Parse(httpDateFormat, headerValue(headers, "Last-Modified")); err == nil {
+			if err := os.Chtimes(partial, modified, modified); err != nil {
+				return err
+			}
+		}
+	}
+	if d.Sync {
+		if err := syncPath(partial); err != nil {
+			return err
+		}
+	}
+	if err := os.Rename(partial, dest); err != nil {
+		return err
+	}
+	if d.Sync {
+		// Makes the rename itself durable
+		return syncPath(filepath.Dir(dest))
+	}
+	return nil
+}
+
+// syncPath flushes the file or directory at path to disk
+func syncPath(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	return file.Sync()
+}
+
+// downloadStream fetches url in a single response, or the rest of it after
+// what state says is on disk
+func (d *Downloader) downloadStream(url, dest string, state *checkpoint, verifier *digestVerifier) (*DownloadResult, error) {
+	file, err := os.OpenFile(dest+partialSuffix, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	// Anything past the checkpoint may not have reached the disk intact
+	if info, err := file.Stat(); err != nil || info.Size() < state.Written {
+		state = &checkpoint{URL: state.URL, Size: -1}
+	}
+	if err := file.Truncate(state.Written); err != nil {
+		return nil, err
+	}
+
+	response, err := d.request(url, state)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Close()
+
+	resumed := int64(0)
+	switch {
+	case response.StatusCode == 206 && state.Written > 0:
+		start, _, total, ok := parseContentRange(headerValue(response.Headers, "Content-Range"))
+		if !ok || start != state.Written || (state.Size >= 0 && total != state.Size) {
+			return nil, fmt.Errorf("download failed: server sent an unexpected range %q", headerValue(response.Headers, "Content-Range"))
+		}
+		resumed = state.Written
+	case response.StatusCode == 416 && state.Written > 0:
+		// Asking for the rest of a file that is already complete
+		_, _, total, ok := parseContentRange(headerValue(response.Headers, "Content-Range"))
+		if ok && total == state.Written {
+			os.Remove(dest + checkpointSuffix)
+			return &DownloadResult{Size: total, Resumed: total, Segments: 1, Headers: response.Headers}, nil
+		}
+		os.Remove(dest + checkpointSuffix)
+		file.Truncate(0)
+		return nil, errors.New("download failed: server rejected the resume range; the partial file was discarded")
+	case response.StatusCode == 200:
+		// A full response: the server ignored the range or the file changed
+		state = &checkpoint{URL: state.URL, Size: -1}
+		if err := file.Truncate(0); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("download failed: %d %s", response.StatusCode, response.Status)
+	}
+
+	state.ETag = headerValue(response.Headers, "ETag")
+	state.LastModified = headerValue(response.Headers, "Last-Modified")
+	state.Source = ""
+	if url != state.URL {
+		state.Source = url
+	}
+	if response.StatusCode == 206 {
+		_, _, state.Size, _ = parseContentRange(headerValue(response.Headers, "Content-Range"))
+	} else if n, err := strconv.ParseInt(headerValue(response.Headers, "Content-Length"), 10, 64); err == nil {
+		state.Size = n
+	}
+
+	if _, err := file.Seek(state.Written, io.SeekStart); err != nil {
+		return nil, err
+	}
+	verifier.expect(headerDigests(response))
+	body, err := verifier.stream(file, state.Written, responseStream(response))
+	if err != nil {
+		return nil, err
+	}
+	meter := d.newProgressMeter(state.Written, state.Size)
+	if err := d.copyBody(file, body, state, dest, meter); err != nil {
+		d.saveCheckpoint(file, state, dest)
+		return nil, err
+	}
+	if state.Size >= 0 && state.Written != state.Size {
+		d.saveCheckpoint(file, state, dest)
+		return nil, fmt.Errorf("download failed: got %d of %d bytes", state.Written, state.Size)
+	}
+
+	os.Remove(dest + checkpointSuffix)
+	meter.finish()
+	return &DownloadResult{Size: state.Written, Resumed: resumed, Segments: 1, Headers: response.Headers}, nil
+}
+
+// request asks for url, or for the rest of it when state has some of it
+func (d *Downloader) request(url string, state *checkpoint) (*HttpResponse, error) {
+	rangeSpec, validator := "", ""
+	if state.Written > 0 {
+		var ok bool
+		if validator, ok = state.resumable(url); ok {
+			rangeSpec = fmt.Sprintf("bytes=%d-", state.Written)
+		} else {
+			// Nothing to tell whether the file changed, so start again
+			state.Written = 0
+		}
+	}
+	return d.send("GET", url, rangeSpec, validator)
+}
+
+// send sends a request for url with the downloader's headers, asking for
+// rangeSpec, if set, provided the file still matches validator
+func (d *Downloader) send(method, url, rangeSpec, validator string) (*HttpResponse, error) {
+	headers := make(map[string]string, len(d.Headers)+2)
+	for k, v := range d.Headers {
+		headers[k] = v
+	}
+	if rangeSpec != "" {
+		headers["Range"] = rangeSpec
+		if validator != "" {
+			headers["If-Range"] = validator
+		}
+	}
+
+	// The client follows redirects, retries, and so on as for any request,
+	// but leaves the body encoded as the ranges are
+	return d.Client.DoStream(&HttpRequest{Method: method, URL: url, Headers: headers, keepEncoding: true})
+}
+
+// validator returns what If-Range should carry to resume the file, which has
+// to change whenever the content does: a strong ETag, or failing that the
+// modification time
+func (state *checkpoint) validator() string {
+	if state.ETag != "" && !strings.HasPrefix(state.ETag, "W/") {
+		return state.ETag
+	}
+	return state.LastModified
+}
+
+// resumable returns the validator for resuming the file from url, and
+// whether it can be resumed there at all. A mirror's validators are its own,
+// so on switching mirrors all there is to go on is the size, which the
+// range the new mirror sends has to match.
+func (state *checkpoint) resumable(url string) (validator string, ok bool) {
+	source := state.Source
+	if source == "" {
+		source = state.URL
+	}
+	if source != url {
+		return "", state.Size >= 0
+	}
+	validator = state.validator()
+	return validator, validator != ""
+}
+
+// copyBody writes body to file, checkpointing and reporting progress as it goes
+func (d *Downloader) copyBody(file *os.File, body io.Reader, state *checkpoint, dest string, meter *progressMeter) error {
+	interval := d.CheckpointInterval
+	if interval <= 0 {
+		interval = defaultCheckpointInterval
+	}
+	sinceCheckpoint := int64(0)
+	buf := make([]byte, 32<<10)
+	for {
+		n, err := body.Read(buf)
+		if n > 0 {
+			if _, werr := file.Write(buf[:n]); werr != nil {
+				return werr
+			}
+			state.Written += int64(n)
+			meter.add(int64(n))
+			sinceCheckpoint += int64(n)
+			if sinceCheckpoint >= interval {
+				sinceCheckpoint = 0
+				if cerr := d.saveCheckpoint(file, state, dest); cerr != nil {
+					return cerr
+				}
+			}
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// loadCheckpoint returns the progress recorded for url at dest, or a fresh
+// start if there is none or it is for another URL
+func (d *Downloader) loadCheckpoint(url, dest string) *checkpoint {
+	fresh := &checkpoint{URL: url, Size: -1}
+	data, err := os.ReadFile(dest + checkpointSuffix)
+	if err != nil {
+		return fresh
+	}
+	var state checkpoint
+	if json.Unmarshal(data, &state) != nil || state.URL != url || state.Written < 0 {
+		return fresh
+	}
+	return &state
+}
+
+// saveCheckpoint records state once the data it describes is on disk
+func (d *Downloader) saveCheckpoint(file *os.File, state *checkpoint, dest string) error {
+	if err := file.Sync(); err != nil {
+		return err
+	}
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(dest+checkpointSuffix, data, 0644)
+}
+
+// responseStream returns the unread body of a response, whether or not the
+// transport deferred it
+func responseStream(response *HttpResponse) io.Reader {
+	if response.body != nil {
+		return response.body
+	}
+	return strings.NewReader(response.Body)
+}
+
+// parseContentRange parses "bytes first-last/total", where total may be "*",
+// or "bytes */total". Unknown parts are -1.
+func parseContentRange(value string) (first, last, total int64, ok bool) {
+	spec, found := strings.CutPrefix(strings.TrimSpace(value), "bytes ")
+	if !found {
+		return 0, 0, 0, false
+	}
+	span, size, found := strings.Cut(spec, "/")
+	if !found {
+		return 0, 0, 0, false
+	}
+	total = -1
+	if size != "*" {
+		n, err := strconv.ParseInt(size, 10, 64)
+		if err != nil || n < 0 {
+			return 0, 0, 0, false
+		}
+		total = n
+	}
+	if span == "*" {
+		return -1, -1, total, true
+	}
+	from, to, found := strings.Cut(span, "-")
+	if !found {
+		return 0, 0, 0, false
+	}
+	first, err1 := strconv.ParseInt(from, 10, 64)
+	last, err2 := strconv.ParseInt(to, 10, 64)
+	if err1 != nil || err2 != nil || first < 0 || last < first || (total >= 0 && last >= total) {
+		return 0, 0, 0, false
+	}
+	return first, last, total, true
+}
@@ -0,0 +1,417 @@
+package httpmodule
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+// downloadServer serves files and can cut the next response short.
+type downloadServer struct {
+	files fstest.MapFS
+	addr  string
+
+	mu        sync.Mutex
+	cutAt     int64
+	noRanges  bool
+	headDelay time.Duration
+	ranges    []string
+}
+
+// cutWriter aborts the response once limit bytes of body have been written.
+type cutWriter struct {
+	ResponseWriter
+	limit int64
+}
+
+func (w *cutWriter) Write(p []byte) (int, error) {
+	if int64(len(p)) < w.limit {
+		w.limit -= int64(len(p))
+		return w.ResponseWriter.Write(p)
+	}
+	w.ResponseWriter.Write(p[:w.limit])
+	w.ResponseWriter.(Flusher).Flush()
+	panic(ErrAbortHandler)
+}
+
+// noRangesWriter hides that the server accepts ranges.
+type noRangesWriter struct {
+	ResponseWriter
+}
+
+func (w *noRangesWriter) WriteHeader(statusCode int) {
+	deleteHeader(w.Header(), "Accept-Ranges")
+	w.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (w *noRangesWriter) Write(p []byte) (int, error) {
+	w.WriteHeader(200)
+	return w.ResponseWriter.Write(p)
+}
+
+// startDownloadServer serves files on a loopback port.
+func startDownloadServer(t *testing.T, files fstest.MapFS) *downloadServer {
+	ds := &downloadServer{files: files}
+	fsrv := &FileServer{Root: files}
+	_, ds.addr = startServer(t, HandlerFunc(func(w ResponseWriter, req *ServerRequest) {
+		ds.mu.Lock()
+		cut := int64(0)
+		if req.Method == "GET" {
+			cut = ds.cutAt
+			ds.cutAt = 0
+			ds.ranges = append(ds.ranges, headerValue(req.Headers, "Range"))
+		}
+		noRanges := ds.noRanges
+		headDelay := ds.headDelay
+		ds.mu.Unlock()
+		if req.Method == "HEAD" {
+			time.Sleep(headDelay)
+		}
+		if noRanges {
+			deleteHeader(req.Headers, "Range")
+			w = &noRangesWriter{ResponseWriter: w}
+		}
+		if cut > 0 {
+			w = &cutWriter{ResponseWriter: w, limit: cut}
+		}
+		fsrv.ServeHTTP(w, req)
+		// Sends the headers of a HEAD response through noRangesWriter
+		w.WriteHeader(200)
+	}))
+	return ds
+}
+
+// cutNext makes the next response stop after n bytes of body.
+func (ds *downloadServer) cutNext(n int64) {
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+	ds.cutAt = n
+}
+
+// downloader returns a Downloader whose requests reach the server.
+func (ds *downloadServer) downloader(t *testing.T) *Downloader {
+	d := NewDownloader(nil)
+	d.Client.Transport = loopbackTransport(t, d.Client, ds.addr)
+	return d
+}
+
+// testPayload returns n bytes that differ from position to position.
+func testPayload(n int) []byte {
+	data := make([]byte, n)
+	for i := range data {
+		data[i] = byte(i*7 + i/251)
+	}
+	return data
+}
+
+// TestDownloaderResume tests resuming an interrupted download from its checkpoint.
+func TestDownloaderResume(t *testing.T) {
+	payload := testPayload(200 << 10)
+	ds := startDownloadServer(t, fstest.MapFS{"big.bin": {Data: payload, ModTime: time.Unix(1700000000, 0)}})
+	d := ds.downloader(t)
+	d.CheckpointInterval = 16 << 10
+	dest := filepath.Join(t.TempDir(), "big.bin")
+	url := "http://" + ds.addr + "/big.bin"
+
+	ds.cutNext(90 << 10)
+	if _, err := d.Download(url, dest); err == nil {
+		t.Fatal("Expected the cut transfer to fail.")
+	}
+	if _, err := os.Stat(dest + checkpointSuffix); err != nil {
+		t.Fatal("Expected a checkpoint after the failure, got", err)
+	}
+
+	result, err := d.Download(url, dest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Resumed < 64<<10 || result.Size != int64(len(payload)) {
+		t.Error("Expected the second attempt to resume, got", result.Resumed, result.Size)
+	}
+	if data, _ := os.ReadFile(dest); !bytes.Equal(data, payload) {
+		t.Error("Expected the resumed file to match.")
+	}
+	if _, err := os.Stat(dest + checkpointSuffix); !os.IsNotExist(err) {
+		t.Error("Expected the checkpoint to be removed, got", err)
+	}
+	if ds.ranges[0] != "" || ds.ranges[1] == "" {
+		t.Error("Expected only the second request to ask for a range, got", ds.ranges)
+	}
+}
+
+// TestDownloadFile tests the client's helper resuming a download cut short.
+func TestDownloadFile(t *testing.T) {
+	payload := testPayload(100 << 10)
+	ds := startDownloadServer(t, fstest.MapFS{"f.bin": {Data: payload, ModTime: time.Unix(1700000000, 0)}})
+	dest := filepath.Join(t.TempDir(), "f.bin")
+	client := New()
+
+	ds.cutNext(40 << 10)
+	if _, err := client.DownloadFile("http://"+ds.addr+"/f.bin", dest); err == nil {
+		t.Fatal("Expected the cut transfer to fail.")
+	}
+	result, err := client.DownloadFile("http://"+ds.addr+"/f.bin", dest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := os.ReadFile(dest); !bytes.Equal(data, payload) || result.Resumed == 0 {
+		t.Error("Expected the download resumed and complete, got", result.Resumed, len(data))
+	}
+}
+
+// TestDownloadFileRedirect tests following a redirect to the file, which is
+// saved as it was sent.
+func TestDownloadFileRedirect(t *testing.T) {
+	var compressed bytes.Buffer
+	zw := gzip.NewWriter(&compressed)
+	zw.Write(testPayload(10 << 10))
+	zw.Close()
+	_, addr := startServer(t, HandlerFunc(func(w ResponseWriter, req *ServerRequest) {
+		if req.Path == "/latest" {
+			w.Header()["Location"] = "/releases/v2.tar.gz"
+			w.WriteHeader(302)
+			return
+		}
+		w.Header()["Content-Encoding"] = "gzip"
+		w.Header()["Content-Length"] = strconv.Itoa(compressed.Len())
+		w.Write(compressed.Bytes())
+	}))
+	dest := filepath.Join(t.TempDir(), "v2.tar.gz")
+
+	result, err := New().DownloadFile("http://"+addr+"/latest", dest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := os.ReadFile(dest); !bytes.Equal(data, compressed.Bytes()) || result.Size != int64(compressed.Len()) {
+		t.Error("Expected the redirected file as sent, got", len(data), result.Size)
+	}
+}
+
+// TestDownloaderChangedFile tests that a file changed between attempts is fetched afresh.
+func TestDownloaderChangedFile(t *testing.T) {
+	payload := testPayload(100 << 10)
+	files := fstest.MapFS{"f.bin": {Data: payload, ModTime: time.Unix(1700000000, 0)}}
+	ds := startDownloadServer(t, files)
+	d := ds.downloader(t)
+	d.CheckpointInterval = 8 << 10
+	dest := filepath.Join(t.TempDir(), "f.bin")
+	url := "http://" + ds.addr + "/f.bin"
+
+	ds.cutNext(50 << 10)
+	d.Download(url, dest)
+
+	changed := testPayload(120 << 10)
+	changed[0] = 'X'
+	files["f.bin"] = &fstest.MapFile{Data: changed, ModTime: time.Unix(1800000000, 0)}
+	result, err := d.Download(url, dest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Resumed != 0 {
+		t.Error("Expected nothing to be kept from the old version, got", result.Resumed)
+	}
+	if data, _ := os.ReadFile(dest); !bytes.Equal(data, changed) {
+		t.Error("Expected the new version of the file.")
+	}
+}
+
+// TestDownloaderErrors tests failed responses.
+func TestDownloaderErrors(t *testing.T) {
+	ds := startDownloadServer(t, fstest.MapFS{})
+	d := ds.downloader(t)
+	if _, err := d.Download("http://"+ds.addr+"/missing", filepath.Join(t.TempDir(), "x")); err == nil {
+		t.Error("Expected an error for a 404.")
+	}
+}
+
+// TestDownloaderSegmented tests fetching a file in parallel ranges.
+func TestDownloaderSegmented(t *testing.T) {
+	payload := testPayload(300<<10 + 123)
+	ds := startDownloadServer(t, fstest.MapFS{"big.bin": {Data: payload, ModTime: time.Unix(1700000000, 0)}})
+	d := ds.downloader(t)
+	d.Segments = 4
+	dest := filepath.Join(t.TempDir(), "big.bin")
+
+	result, err := d.Download("http://"+ds.addr+"/big.bin", dest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Segments != 4 || result.Size != int64(len(payload)) {
+		t.Error("Expected 4 segments for the whole file, got", result.Segments, result.Size)
+	}
+	if data, _ := os.ReadFile(dest); !bytes.Equal(data, payload) {
+		t.Error("Expected the segmented file to match.")
+	}
+	if len(ds.ranges) != 4 {
+		t.Error("Expected one request per segment, got", ds.ranges)
+	}
+	for _, r := range ds.ranges {
+		if r == "" {
+			t.Error("Expected every request to ask for a range, got", ds.ranges)
+		}
+	}
+	if _, err := os.Stat(dest + checkpointSuffix); !os.IsNotExist(err) {
+		t.Error("Expected the checkpoint to be removed, got", err)
+	}
+}
+
+// TestDownloaderSegmentedResume tests resuming a segmented download after one range fails.
+func TestDownloaderSegmentedResume(t *testing.T) {
+	payload := testPayload(256 << 10)
+	ds := startDownloadServer(t, fstest.MapFS{"big.bin": {Data: payload, ModTime: time.Unix(1700000000, 0)}})
+	d := ds.downloader(t)
+	d.Segments = 2
+	d.CheckpointInterval = 16 << 10
+	dest := filepath.Join(t.TempDir(), "big.bin")
+	url := "http://" + ds.addr + "/big.bin"
+
+	ds.cutNext(40 << 10)
+	if _, err := d.Download(url, dest); err == nil {
+		t.Fatal("Expected the cut transfer to fail.")
+	}
+	if _, err := os.Stat(dest + checkpointSuffix); err != nil {
+		t.Fatal("Expected a checkpoint after the failure, got", err)
+	}
+
+	ds.ranges = nil
+	result, err := d.Download(url, dest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Resumed < 32<<10 || result.Segments != 2 {
+		t.Error("Expected the second attempt to resume the segments, got", result.Resumed, result.Segments)
+	}
+	if data, _ := os.ReadFile(dest); !bytes.Equal(data, payload) {
+		t.Error("Expected the resumed file to match.")
+	}
+	requested := int64(0)
+	for _, r := range ds.ranges {
+		var first, last int64
+		if _, err := fmt.Sscanf(r, "bytes=%d-%d", &first, &last); err != nil {
+			t.Fatal("Expected a closed range, got", r)
+		}
+		requested += last - first + 1
+	}
+	if requested+result.Resumed != int64(len(payload)) {
+		t.Error("Expected only the missing parts to be fetched again, got", ds.ranges)
+	}
+}
+
+// TestDownloaderSegmentedFallback tests falling back to a single stream.
+func TestDownloaderSegmentedFallback(t *testing.T) {
+	payload := testPayload(256 << 10)
+	ds := startDownloadServer(t, fstest.MapFS{
+		"big.bin":   {Data: payload, ModTime: time.Unix(1700000000, 0)},
+		"small.bin": {Data: payload[:1000], ModTime: time.Unix(1700000000, 0)},
+	})
+	d := ds.downloader(t)
+	d.Segments = 4
+	dir := t.TempDir()
+
+	result, err := d.Download("http://"+ds.addr+"/small.bin", filepath.Join(dir, "small.bin"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Segments != 1 {
+		t.Error("Expected a small file in a single stream, got", result.Segments)
+	}
+
+	ds.noRanges = true
+	ds.ranges = nil
+	result, err = d.Download("http://"+ds.addr+"/big.bin", filepath.Join(dir, "big.bin"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Segments != 1 || len(ds.ranges) != 1 || ds.ranges[0] != "" {
+		t.Error("Expected a single request without ranges, got", result.Segments, ds.ranges)
+	}
+	if data, _ := os.ReadFile(filepath.Join(dir, "big.bin")); !bytes.Equal(data, payload) {
+		t.Error("Expected the file to match.")
+	}
+}
+
+// TestDownloaderAtomic tests that the destination only ever holds a whole file.
+func TestDownloaderAtomic(t *testing.T) {
+	payload := testPayload(100 << 10)
+	modTime := time.Unix(1700000000, 0)
+	ds := startDownloadServer(t, fstest.MapFS{"f.bin": {Data: payload, ModTime: modTime}})
+	d := ds.downloader(t)
+	d.CheckpointInterval = 8 << 10
+	d.PreserveModTime = true
+	d.Sync = true
+	dest := filepath.Join(t.TempDir(), "f.bin")
+	url := "http://" + ds.addr + "/f.bin"
+	if err := os.WriteFile(dest, []byte("old version"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	ds.cutNext(50 << 10)
+	if _, err := d.Download(url, dest); err == nil {
+		t.Fatal("Expected the cut transfer to fail.")
+	}
+	if data, _ := os.ReadFile(dest); string(data) != "old version" {
+		t.Error("Expected the old file untouched by a failed download, got", len(data), "bytes")
+	}
+	if info, err := os.Stat(dest + partialSuffix); err != nil || info.Size() == 0 {
+		t.Error("Expected the partial file beside it, got", err)
+	}
+
+	if _, err := d.Download(url, dest); err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(dest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := os.ReadFile(dest); !bytes.Equal(data, payload) {
+		t.Error("Expected the new version in place.")
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Error("Expected the replaced file's permissions to be kept, got", info.Mode())
+	}
+	if !info.ModTime().Equal(modTime) {
+		t.Error("Expected the modification time from Last-Modified, got", info.ModTime())
+	}
+	if _, err := os.Stat(dest + partialSuffix); !os.IsNotExist(err) {
+		t.Error("Expected no partial file left, got", err)
+	}
+
+	d.FileMode = 0640
+	d.PreserveModTime = false
+	fresh := filepath.Join(filepath.Dir(dest), "fresh.bin")
+	if _, err := d.Download(url, fresh); err != nil {
+		t.Fatal(err)
+	}
+	if info, _ := os.Stat(fresh); info.Mode().Perm() != 0640 || info.ModTime().Equal(modTime) {
+		t.Error("Expected the configured permissions and the current time, got", info.Mode(), info.ModTime())
+	}
+}
+
+// TestParseContentRange tests Content-Range parsing.
+func TestParseContentRange(t *testing.T) {
+	tests := []struct {
+		value              string
+		first, last, total int64
+		ok                 bool
+	}{
+		{"bytes 0-9/100", 0, 9, 100, true},
+		{"bytes 10-19/*", 10, 19, -1, true},
+		{"bytes */100", -1, -1, 100, true},
+		{"bytes 5-4/100", 0, 0, 0, false},
+		{"bytes 0-100/100", 0, 0, 0, false},
+		{"items 0-9/100", 0, 0, 0, false},
+	}
+	for _, test := range tests {
+		first, last, total, ok := parseContentRange(test.value)
+		if ok != test.ok || (ok && (first != test.first || last != test.last || total != test.total)) {
+			t.Errorf("Expected %d-%d/%d %v for %q, got %d-%d/%d %v.", test.first, test.last, test.total, test.ok, test.value, first, last, total, ok)
+		}
+	}
+}
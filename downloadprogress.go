@@ -0,0 +1,123 @@
+package httpmodule
+
+import (
+	"sync"
+	"time"
+)
+
+// Time between progress reports when Downloader doesn't set an interval
+const defaultProgressInterval = 500 * time.Millisecond
+
+// DownloadProgress is a snapshot of a transfer, passed to Downloader's
+// Progress callback
+type DownloadProgress struct {
+	// Bytes of the file on disk, including any resumed from an earlier attempt
+	Done int64
+
+	// Length of the whole file, or -1 if the server didn't say
+	Total int64
+
+	// Bytes per second since the last report
+	Rate float64
+
+	// Bytes per second since this attempt started, not counting resumed bytes
+	AverageRate float64
+
+	// Time since this attempt started
+	Elapsed time.Duration
+
+	// Estimated time left at the average rate, or -1 if unknown
+	ETA time.Duration
+
+	// Set on the last report, once the file is complete
+	Finished bool
+}
+
+// progressMeter tracks the bytes of one download and reports them to the
+// Downloader's callback, one call at a time
+type progressMeter struct {
+	report   func(DownloadProgress)
+	clock    Clock
+	interval time.Duration
+
+	mu       sync.Mutex
+	start    time.Time
+	resumed  int64
+	done     int64
+	total    int64
+	lastTime time.Time
+	lastDone int64
+}
+
+// newProgressMeter starts measuring a download of total bytes, done of which
+// are already on disk, or returns nil if d has no Progress callback
+func (d *Downloader) newProgressMeter(done, total int64) *progressMeter {
+	if d.Progress == nil {
+		return nil
+	}
+	interval := d.ProgressInterval
+	if interval <= 0 {
+		interval = defaultProgressInterval
+	}
+	clock := clockOrReal(d.Clock)
+	now := clock.Now()
+	return &progressMeter{
+		report:   d.Progress,
+		clock:    clock,
+		interval: interval,
+		start:    now,
+		resumed:  done,
+		done:     done,
+		total:    total,
+		lastTime: now,
+		lastDone: done,
+	}
+}
+
+// add counts n more bytes written, reporting if the interval has passed
+func (m *progressMeter) add(n int64) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.done += n
+	if now := m.clock.Now(); now.Sub(m.lastTime) >= m.interval {
+		m.send(now, false)
+	}
+}
+
+// finish reports the completed download
+func (m *progressMeter) finish() {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.send(m.clock.Now(), true)
+}
+
+func (m *progressMeter) send(now time.Time, finished bool) {
+	progress := DownloadProgress{
+		Done:     m.done,
+		Total:    m.total,
+		Elapsed:  now.Sub(m.start),
+		ETA:      -1,
+		Finished: finished,
+	}
+	if since := now.Sub(m.lastTime).Seconds(); since > 0 {
+		progress.Rate = float64(m.done-m.lastDone) / since
+	}
+	if elapsed := progress.Elapsed.Seconds(); elapsed > 0 {
+		progress.AverageRate = float64(m.done-m.resumed) / elapsed
+	}
+	switch {
+	case finished:
+		progress.ETA = 0
+	case m.total >= 0 && progress.AverageRate > 0:
+		progress.ETA = time.Duration(float64(m.total-m.done) / progress.AverageRate * float64(time.Second))
+	}
+	m.lastTime = now
+	m.lastDone = m.done
+	m.report(progress)
+}
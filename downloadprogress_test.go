@@ -0,0 +1,94 @@
+package httpmodule
+
+import (
+	"path/filepath"
+	"sync"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+// TestProgressMeter tests the rates and estimates in progress reports.
+func TestProgressMeter(t *testing.T) {
+	clock := NewFakeClock(time.Unix(1700000000, 0))
+	var reports []DownloadProgress
+	d := &Downloader{Clock: clock, ProgressInterval: time.Second, Progress: func(p DownloadProgress) {
+		reports = append(reports, p)
+	}}
+
+	meter := d.newProgressMeter(1000, 11000)
+	meter.add(500)
+	if len(reports) != 0 {
+		t.Fatal("Expected no report before the interval, got", reports)
+	}
+	clock.Advance(time.Second)
+	meter.add(1500)
+	clock.Advance(time.Second)
+	meter.add(4000)
+	if len(reports) != 2 {
+		t.Fatal("Expected a report per interval, got", reports)
+	}
+
+	last := reports[1]
+	if last.Done != 7000 || last.Total != 11000 || last.Elapsed != 2*time.Second {
+		t.Error("Expected 7000 of 11000 bytes after 2s, got", last)
+	}
+	if last.Rate != 4000 || last.AverageRate != 3000 {
+		t.Error("Expected rates of 4000 and 3000 bytes a second, got", last.Rate, last.AverageRate)
+	}
+	if want := 4000 * time.Second / 3000; last.ETA != want {
+		t.Error("Expected an ETA of", want, "got", last.ETA)
+	}
+
+	meter.finish()
+	if final := reports[2]; !final.Finished || final.ETA != 0 {
+		t.Error("Expected a finished report, got", final)
+	}
+
+	unknown := d.newProgressMeter(0, -1)
+	clock.Advance(time.Second)
+	unknown.add(10)
+	if reports[3].ETA != -1 {
+		t.Error("Expected no ETA without a total, got", reports[3].ETA)
+	}
+
+	none := &Downloader{}
+	if none.newProgressMeter(0, 10) != nil {
+		t.Error("Expected no meter without a callback.")
+	}
+}
+
+// TestDownloaderProgress tests progress reports from both kinds of download.
+func TestDownloaderProgress(t *testing.T) {
+	payload := testPayload(256 << 10)
+	ds := startDownloadServer(t, fstest.MapFS{"big.bin": {Data: payload, ModTime: time.Unix(1700000000, 0)}})
+
+	for _, segments := range []int{1, 4} {
+		d := ds.downloader(t)
+		d.Segments = segments
+		d.ProgressInterval = time.Nanosecond
+		var mu sync.Mutex
+		var reports []DownloadProgress
+		d.Progress = func(p DownloadProgress) {
+			mu.Lock()
+			defer mu.Unlock()
+			reports = append(reports, p)
+		}
+
+		if _, err := d.Download("http://"+ds.addr+"/big.bin", filepath.Join(t.TempDir(), "big.bin")); err != nil {
+			t.Fatal(err)
+		}
+		if len(reports) < 2 {
+			t.Fatal("Expected several reports, got", reports)
+		}
+		for i := 1; i < len(reports); i++ {
+			if reports[i].Done < reports[i-1].Done {
+				t.Error("Expected progress to only go up, got", reports[i-1].Done, reports[i].Done)
+			}
+		}
+		final := reports[len(reports)-1]
+		if !final.Finished || final.Done != int64(len(payload)) || final.Total != int64(len(payload)) {
+			t.Error("Expected a finished report for the whole file with", segments, "segments, got", final)
+		}
+	}
+}
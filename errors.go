@@ -0,0 +1,105 @@
+package httpmodule
+
+import (
+	"errors"
+	"fmt"
+	"net"
+)
+
+// DialError reports a failure to connect to a server, including looking up
+// its address and getting through a proxy to it. Nothing was sent, so the
+// request can always be tried again.
+type DialError struct {
+	Host string
+	Err  error
+}
+
+func (e *DialError) Error() string {
+	return fmt.Sprintf("failed to connect to %s: %v", e.Host, e.Err)
+}
+
+func (e *DialError) Unwrap() error {
+	return e.Err
+}
+
+// TLSError reports a failed TLS handshake, such as one with a server whose
+// certificate isn't trusted
+type TLSError struct {
+	Host string
+	Err  error
+}
+
+func (e *TLSError) Error() string {
+	return fmt.Sprintf("TLS handshake with %s failed: %v", e.Host, e.Err)
+}
+
+func (e *TLSError) Unwrap() error {
+	return e.Err
+}
+
+// TimeoutError reports that a limit the client sets ran out during Op, such
+// as "dial". A deadline on the request's own context is reported as
+// context.DeadlineExceeded instead.
+type TimeoutError struct {
+	Op  string
+	Err error
+}
+
+func (e *TimeoutError) Error() string {
+	if e.Err == nil {
+		return e.Op + " timed out"
+	}
+	return fmt.Sprintf("%s timed out: %v", e.Op, e.Err)
+}
+
+func (e *TimeoutError) Unwrap() error {
+	return e.Err
+}
+
+// Timeout reports true, as net.Error's Timeout does for timeouts
+func (e *TimeoutError) Timeout() bool {
+	return true
+}
+
+// ProtocolError reports a response that breaks HTTP's rules, such as a
+// malformed status line or chunk. Its message is that of Err.
+type ProtocolError struct {
+	Err error
+}
+
+func (e *ProtocolError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *ProtocolError) Unwrap() error {
+	return e.Err
+}
+
+// protocolError returns a ProtocolError with message as its text
+func protocolError(message string) error {
+	return &ProtocolError{Err: errors.New(message)}
+}
+
+// StatusError reports a response whose status is outside 2xx; see CheckStatus
+type StatusError struct {
+	Response *HttpResponse
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("unexpected status %d %s", e.Response.StatusCode, e.Response.Status)
+}
+
+// CheckStatus returns a *StatusError carrying response when its status is
+// outside 2xx, and nil otherwise
+func (response *HttpResponse) CheckStatus() error {
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		return &StatusError{Response: response}
+	}
+	return nil
+}
+
+// isTimeout reports whether err is a network timeout
+func isTimeout(err error) bool {
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
@@ -0,0 +1,71 @@
+package httpmodule
+
+import (
+	"errors"
+	"net"
+	"path/filepath"
+	"testing"
+)
+
+// TestErrorTypes tests that failures can be told apart with errors.As.
+func TestErrorTypes(t *testing.T) {
+	client := New()
+
+	_, err := client.Get("http://"+deadAddr(t)+"/", nil)
+	var dialErr *DialError
+	if !errors.As(err, &dialErr) {
+		t.Error("Expected a DialError for a refused connection, got", err)
+	}
+
+	client.HostOverrides = map[string]string{"missing.test": "no-such-host.invalid:80"}
+	_, err = client.Get("http://missing.test/", nil)
+	var dnsErr *net.DNSError
+	if !errors.As(err, &dialErr) || !errors.As(err, &dnsErr) {
+		t.Error("Expected a DialError wrapping the DNS failure, got", err)
+	}
+
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	writeTestCert(t, certFile, keyFile, "server", "untrusted.test")
+	addr := startTLSServer(t, HandlerFunc(func(w ResponseWriter, req *ServerRequest) {}), nil, certFile, keyFile)
+	client.HostOverrides = map[string]string{"untrusted.test": addr}
+	client.Retry = &RetryPolicy{}
+	_, err = client.Get("https://untrusted.test/", nil)
+	var tlsErr *TLSError
+	if !errors.As(err, &tlsErr) || tlsErr.Host != "untrusted.test" || errors.As(err, &dialErr) {
+		t.Error("Expected a TLSError for an untrusted certificate, got", err)
+	}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			conn.Write([]byte("NOT HTTP AT ALL\r\n\r\n"))
+			conn.Close()
+		}
+	}()
+	_, err = client.Get("http://"+listener.Addr().String()+"/", nil)
+	var protoErr *ProtocolError
+	if !errors.As(err, &protoErr) {
+		t.Error("Expected a ProtocolError for a malformed response, got", err)
+	}
+}
+
+// TestCheckStatus tests the StatusError returned for a failed status.
+func TestCheckStatus(t *testing.T) {
+	response := &HttpResponse{StatusCode: 503, Status: "Service Unavailable"}
+	var statusErr *StatusError
+	if err := response.CheckStatus(); !errors.As(err, &statusErr) || statusErr.Response != response {
+		t.Error("Expected a StatusError carrying the response, got", err)
+	}
+	if err := (&HttpResponse{StatusCode: 204}).CheckStatus(); err != nil {
+		t.Error("Expected no error for 204, got", err)
+	}
+}
@@ -0,0 +1,243 @@
+package httpmodule
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"mime"
+	neturl "net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Wait before reconnecting to an event stream until the server sets one
+const defaultEventRetry = 3 * time.Second
+
+// EventSource follows a stream of server-sent events (text/event-stream),
+// as a browser's EventSource does: events are parsed as they arrive, and a
+// stream that ends or breaks is reconnected to after a wait, asking with
+// Last-Event-ID to carry on after the last event seen.
+type EventSource struct {
+	Client *HttpClient
+
+	URL string
+
+	// Headers sent with each connection, such as credentials
+	Headers map[string]string
+
+	// ID of the last event received, sent as Last-Event-ID on connecting;
+	// set it beforehand to resume after an event already seen. It changes
+	// as events arrive, so read it only once Listen has returned.
+	LastEventID string
+
+	// Wait before reconnecting, until the server sets one with a retry
+	// field; zero means 3 seconds
+	Retry time.Duration
+
+	// Source of time for the waits; nil uses the real clock
+	Clock Clock
+}
+
+// NewEventSource returns an EventSource for the events at url. Connections
+// last as long as the stream does, so a client Timeout cuts each one short.
+func (client *HttpClient) NewEventSource(url string, headers map[string]string) *EventSource {
+	return &EventSource{Client: client, URL: url, Headers: headers}
+}
+
+// Listen connects and calls handle with each event until ctx is done,
+// returning its error, or handle returns an error, which is returned. Events
+// of the default type have an empty Event. A server that answers 204 No
+// Content is telling the client to stop, and Listen returns nil. Any other
+// status but 200 is returned as a *StatusError, and a response that isn't an
+// event stream as a *ProtocolError.
+func (source *EventSource) Listen(ctx context.Context, handle func(SSEEvent) error) error {
+	if _, err := neturl.Parse(source.URL); err != nil {
+		return err
+	}
+	clock := clockOrReal(source.Clock)
+	for {
+		retry, err := source.listen(ctx, handle)
+		if err != nil || retry == 0 {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-clock.After(retry):
+		}
+	}
+}
+
+// Events is Listen delivering events on a channel, which is closed when it
+// stops. The error Listen returned is then sent on the second channel.
+func (source *EventSource) Events(ctx context.Context) (<-chan SSEEvent, <-chan error) {
+	events := make(chan SSEEvent)
+	errc := make(chan error, 1)
+	go func() {
+		defer close(events)
+		errc <- source.Listen(ctx, func(event SSEEvent) error {
+			select {
+			case events <- event:
+				return nil
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		})
+	}()
+	return events, errc
+}
+
+// listen makes one connection and hands its events to handle. It returns
+// the wait before reconnecting, or zero and the error to stop with.
+func (source *EventSource) listen(ctx context.Context, handle func(SSEEvent) error) (time.Duration, error) {
+	headers := make(map[string]string, len(source.Headers)+3)
+	for k, v := range source.Headers {
+		headers[k] = v
+	}
+	headers = withHeader(headers, "Accept", "text/event-stream")
+	// no-store rather than no-cache, so a response cache passes the stream
+	// straight through instead of reading it to store
+	headers = withHeader(headers, "Cache-Control", "no-store")
+	if source.LastEventID != "" {
+		headers = withHeader(headers, "Last-Event-ID", source.LastEventID)
+	}
+
+	client := source.Client
+	if client == nil {
+		client = New()
+	}
+	response, err := client.DoStream((&HttpRequest{Method: "GET", URL: source.URL, Headers: headers}).WithContext(ctx))
+	if err != nil {
+		if ctx.Err() != nil {
+			return 0, ctx.Err()
+		}
+		// Network errors are reconnected after, as for a broken stream
+		return source.retry(), nil
+	}
+	defer response.Close()
+	switch {
+	case response.StatusCode == 204:
+		return 0, nil
+	case response.StatusCode != 200:
+		response.ReadBody()
+		return 0, &StatusError{Response: response}
+	}
+	if mediaType, _, _ := mime.ParseMediaType(headerValue(response.Headers, "Content-Type")); mediaType != "text/event-stream" {
+		return 0, protocolError("expected text/event-stream, got " + headerValue(response.Headers, "Content-Type"))
+	}
+
+	body := response.BodyStream()
+	defer body.Close()
+	reader := &eventReader{reader: bufio.NewReader(body), lastID: source.LastEventID}
+	for {
+		event, err := reader.next()
+		source.LastEventID = reader.lastID
+		if reader.retry > 0 {
+			source.Retry = reader.retry
+		}
+		if err != nil {
+			if ctx.Err() != nil {
+				return 0, ctx.Err()
+			}
+			return source.retry(), nil
+		}
+		if err := handle(event); err != nil {
+			return 0, err
+		}
+	}
+}
+
+func (source *EventSource) retry() time.Duration {
+	if source.Retry > 0 {
+		return source.Retry
+	}
+	return defaultEventRetry
+}
+
+// eventReader parses events from a text/event-stream body
+type eventReader struct {
+	reader *bufio.Reader
+
+	// ID of the last event, kept from one event to the next
+	lastID string
+
+	// Reconnection time last set by the stream
+	retry time.Duration
+
+	// Set after a CR, as an LF straight after it ends the same line
+	skipLF bool
+}
+
+// next returns the next event. An event cut off by the end of the stream is
+// dropped, as only a blank line completes one.
+func (r *eventReader) next() (SSEEvent, error) {
+	var event SSEEvent
+	var data strings.Builder
+	hasData := false
+	for {
+		line, err := r.readLine()
+		if err != nil {
+			return SSEEvent{}, err
+		}
+		if line == "" {
+			if !hasData {
+				event = SSEEvent{}
+				continue
+			}
+			event.ID = r.lastID
+			event.Data = strings.TrimSuffix(data.String(), "\n")
+			return event, nil
+		}
+		if line[0] == ':' {
+			continue
+		}
+
+		field, value, _ := strings.Cut(line, ":")
+		value = strings.TrimPrefix(value, " ")
+		switch field {
+		case "event":
+			event.Event = value
+		case "data":
+			data.WriteString(value)
+			data.WriteByte('\n')
+			hasData = true
+		case "id":
+			if !strings.Contains(value, "\x00") {
+				r.lastID = value
+			}
+		case "retry":
+			if ms, err := strconv.ParseInt(value, 10, 64); err == nil && strings.Trim(value, "0123456789") == "" {
+				r.retry = time.Duration(ms) * time.Millisecond
+				event.Retry = r.retry
+			}
+		}
+	}
+}
+
+// readLine returns the next line without its ending, which may be CRLF, LF,
+// or CR alone
+func (r *eventReader) readLine() (string, error) {
+	var line []byte
+	for {
+		c, err := r.reader.ReadByte()
+		if err != nil {
+			if err == io.EOF && len(line) > 0 {
+				err = io.ErrUnexpectedEOF
+			}
+			return "", err
+		}
+		skipLF := r.skipLF
+		r.skipLF = false
+		switch {
+		case c == '\n' && skipLF:
+			continue
+		case c == '\n':
+			return string(line), nil
+		case c == '\r':
+			r.skipLF = true
+			return string(line), nil
+		}
+		line = append(line, c)
+	}
+}
@@ -0,0 +1,130 @@
+package httpmodule
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// TestEventReader tests parsing fields, line endings, and incomplete events.
+func TestEventReader(t *testing.T) {
+	stream := ": comment\n\nid: 1\nevent: update\ndata: first\ndata:second\r\n\r\n" +
+		"data: cr only\rretry: 250\r\rid\ndata\n\nid: bad\x00\nretry: 1s\ndata: kept id\n\ndata: cut off"
+	reader := &eventReader{reader: bufio.NewReader(strings.NewReader(stream))}
+	var events []SSEEvent
+	for {
+		event, err := reader.next()
+		if err != nil {
+			if err != io.ErrUnexpectedEOF {
+				t.Error("Expected the cut off event to end the stream early, got", err)
+			}
+			break
+		}
+		events = append(events, event)
+	}
+	want := []SSEEvent{
+		{ID: "1", Event: "update", Data: "first\nsecond"},
+		{ID: "1", Data: "cr only", Retry: 250 * time.Millisecond},
+		{Data: ""},
+		{Data: "kept id"},
+	}
+	if !reflect.DeepEqual(events, want) {
+		t.Errorf("Expected %+v, got %+v", want, events)
+	}
+	if reader.retry != 250*time.Millisecond {
+		t.Error("Expected the valid retry to be kept, got", reader.retry)
+	}
+}
+
+// TestEventSource tests following a stream across reconnections.
+func TestEventSource(t *testing.T) {
+	var mu sync.Mutex
+	var lastIDs []string
+	_, addr := startServer(t, HandlerFunc(func(w ResponseWriter, req *ServerRequest) {
+		mu.Lock()
+		lastIDs = append(lastIDs, req.Headers["Last-Event-ID"])
+		connection := len(lastIDs)
+		mu.Unlock()
+		switch connection {
+		case 1:
+			stream, _ := NewEventStream(w, req)
+			stream.Send(SSEEvent{ID: "1", Data: "one", Retry: 10 * time.Millisecond})
+			stream.Send(SSEEvent{ID: "2", Event: "update", Data: "two"})
+		case 2:
+			stream, _ := NewEventStream(w, req)
+			stream.Send(SSEEvent{ID: "3", Data: "three"})
+		default:
+			w.WriteHeader(204)
+		}
+	}))
+
+	source := New().NewEventSource("http://"+addr+"/events", nil)
+	var events []SSEEvent
+	err := source.Listen(context.Background(), func(event SSEEvent) error {
+		events = append(events, event)
+		return nil
+	})
+	if err != nil {
+		t.Fatal("Expected the stream to stop on 204, got", err)
+	}
+	want := []SSEEvent{
+		{ID: "1", Data: "one", Retry: 10 * time.Millisecond},
+		{ID: "2", Event: "update", Data: "two"},
+		{ID: "3", Data: "three"},
+	}
+	if !reflect.DeepEqual(events, want) {
+		t.Errorf("Expected %+v, got %+v", want, events)
+	}
+	if !reflect.DeepEqual(lastIDs, []string{"", "2", "3"}) || source.LastEventID != "3" {
+		t.Error("Expected each connection to resume after the last event, got", lastIDs, source.LastEventID)
+	}
+}
+
+// TestEventSourceEvents tests delivering events on a channel until cancelled.
+func TestEventSourceEvents(t *testing.T) {
+	_, addr := startServer(t, HandlerFunc(func(w ResponseWriter, req *ServerRequest) {
+		stream, _ := NewEventStream(w, req)
+		stream.Send(SSEEvent{Data: "hello"})
+		<-req.Context().Done()
+	}))
+	ctx, cancel := context.WithCancel(context.Background())
+	events, errc := New().NewEventSource("http://"+addr+"/", nil).Events(ctx)
+	if event := <-events; event.Data != "hello" {
+		t.Error("Expected the event on the channel, got", event)
+	}
+	cancel()
+	for range events {
+	}
+	if err := <-errc; !errors.Is(err, context.Canceled) {
+		t.Error("Expected the cancellation, got", err)
+	}
+}
+
+// TestEventSourceErrors tests stopping on responses that aren't event streams.
+func TestEventSourceErrors(t *testing.T) {
+	_, addr := startServer(t, HandlerFunc(func(w ResponseWriter, req *ServerRequest) {
+		if req.Path == "/missing" {
+			w.WriteHeader(404)
+			return
+		}
+		w.Write([]byte("not events"))
+	}))
+	client := New()
+
+	err := client.NewEventSource("http://"+addr+"/missing", nil).Listen(context.Background(), func(SSEEvent) error { return nil })
+	var statusErr *StatusError
+	if !errors.As(err, &statusErr) || statusErr.Response.StatusCode != 404 {
+		t.Error("Expected a StatusError, got", err)
+	}
+	err = client.NewEventSource("http://"+addr+"/", nil).Listen(context.Background(), func(SSEEvent) error { return nil })
+	var protocolErr *ProtocolError
+	if !errors.As(err, &protocolErr) {
+		t.Error("Expected a ProtocolError, got", err)
+	}
+}
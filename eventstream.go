@@ -0,0 +1,149 @@
+package httpmodule
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SSEEvent is a server-sent event. Only Data is required; Retry tells the
+// client how long to wait before reconnecting.
+type SSEEvent struct {
+	ID    string
+	Event string
+	Data  string
+	Retry time.Duration
+}
+
+// EventStream writes server-sent events (text/event-stream) to a response,
+// flushing each one as soon as it is written
+type EventStream struct {
+	// ID of the last event the client saw before reconnecting, from its
+	// Last-Event-ID header, so the stream can resume after it
+	LastEventID string
+
+	// Source of time for heartbeats; nil uses the real clock
+	Clock Clock
+
+	w       ResponseWriter
+	flusher Flusher
+
+	mu   sync.Mutex
+	err  error
+	stop chan struct{}
+	done chan struct{}
+}
+
+// NewEventStream starts an event stream in response to req. The response
+// must support flushing, as the server's does.
+func NewEventStream(w ResponseWriter, req *ServerRequest) (*EventStream, error) {
+	flusher, ok := w.(Flusher)
+	if !ok {
+		return nil, errors.New("response does not support flushing")
+	}
+	headers := w.Header()
+	headers["Content-Type"] = "text/event-stream"
+	headers["Cache-Control"] = "no-cache"
+	// Stops proxies such as nginx from holding events back
+	headers["X-Accel-Buffering"] = "no"
+	w.WriteHeader(200)
+	flusher.Flush()
+
+	return &EventStream{
+		LastEventID: headerValue(req.Headers, "Last-Event-ID"),
+		w:           w,
+		flusher:     flusher,
+	}, nil
+}
+
+// Send writes an event and flushes it to the client
+func (stream *EventStream) Send(event SSEEvent) error {
+	if strings.ContainsAny(event.ID, "\r\n\x00") || strings.ContainsAny(event.Event, "\r\n") {
+		return errors.New("event ID and type must be a single line")
+	}
+
+	var b strings.Builder
+	if event.ID != "" {
+		b.WriteString("id: " + event.ID + "\n")
+	}
+	if event.Event != "" {
+		b.WriteString("event: " + event.Event + "\n")
+	}
+	if event.Retry > 0 {
+		b.WriteString("retry: " + strconv.FormatInt(event.Retry.Milliseconds(), 10) + "\n")
+	}
+	data := strings.ReplaceAll(strings.ReplaceAll(event.Data, "\r\n", "\n"), "\r", "\n")
+	for _, line := range strings.Split(data, "\n") {
+		b.WriteString("data: " + line + "\n")
+	}
+	b.WriteString("\n")
+	return stream.write(b.String())
+}
+
+// Comment writes a comment line, which clients ignore
+func (stream *EventStream) Comment(text string) error {
+	var b strings.Builder
+	for _, line := range strings.Split(text, "\n") {
+		b.WriteString(": " + line + "\n")
+	}
+	b.WriteString("\n")
+	return stream.write(b.String())
+}
+
+// Heartbeat sends a comment every interval until Close is called, so that
+// proxies and clients don't give up on a quiet stream
+func (stream *EventStream) Heartbeat(interval time.Duration) {
+	stream.mu.Lock()
+	defer stream.mu.Unlock()
+	if stream.stop != nil {
+		return
+	}
+	stream.stop = make(chan struct{})
+	stream.done = make(chan struct{})
+
+	clock := clockOrReal(stream.Clock)
+	go func() {
+		defer close(stream.done)
+		for {
+			select {
+			case <-stream.stop:
+				return
+			case <-clock.After(interval):
+				if stream.Comment("heartbeat") != nil {
+					return
+				}
+			}
+		}
+	}()
+}
+
+// Close stops the heartbeat, if any. It must be called before the handler
+// returns when Heartbeat was used.
+func (stream *EventStream) Close() {
+	stream.mu.Lock()
+	stop, done := stream.stop, stream.done
+	stream.stop = nil
+	stream.mu.Unlock()
+	if stop != nil {
+		close(stop)
+		<-done
+	}
+}
+
+// write sends s and flushes it, remembering the first failure, which usually
+// means the client has gone
+func (stream *EventStream) write(s string) error {
+	stream.mu.Lock()
+	defer stream.mu.Unlock()
+	if stream.err != nil {
+		return stream.err
+	}
+	if _, err := stream.w.Write([]byte(s)); err != nil {
+		stream.err = err
+		return err
+	}
+	stream.flusher.Flush()
+	return nil
+}
@@ -0,0 +1,98 @@
+package httpmodule
+
+import (
+	"bufio"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestEventStream tests the event format and per-event flushing.
+func TestEventStream(t *testing.T) {
+	rec := newResponseRecorder()
+	req := &ServerRequest{Method: "GET", Headers: map[string]string{"Last-Event-ID": "41"}}
+	stream, err := NewEventStream(rec, req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stream.LastEventID != "41" || rec.headers["Content-Type"] != "text/event-stream" || rec.flushes != 1 {
+		t.Error("Expected the stream to start with its headers flushed, got", stream.LastEventID, rec.headers, rec.flushes)
+	}
+
+	stream.Send(SSEEvent{ID: "42", Event: "update", Data: "line one\nline two", Retry: 3 * time.Second})
+	stream.Send(SSEEvent{Data: "plain"})
+	stream.Comment("keep going")
+	want := "id: 42\nevent: update\nretry: 3000\ndata: line one\ndata: line two\n\ndata: plain\n\n: keep going\n\n"
+	if string(rec.body) != want || rec.flushes != 4 {
+		t.Errorf("Expected %q flushed per event, got %q after %d flushes.", want, rec.body, rec.flushes)
+	}
+
+	if err := stream.Send(SSEEvent{ID: "bad\nid", Data: "x"}); err == nil {
+		t.Error("Expected an error for a multi-line ID.")
+	}
+	if _, err := NewEventStream(struct{ ResponseWriter }{rec}, req); err == nil {
+		t.Error("Expected an error for a response that can't flush.")
+	}
+}
+
+// TestEventStreamHeartbeat tests heartbeat comments on a quiet stream.
+func TestEventStreamHeartbeat(t *testing.T) {
+	clock := NewFakeClock(time.Unix(0, 0))
+	rec := newResponseRecorder()
+	stream, _ := NewEventStream(rec, &ServerRequest{Headers: map[string]string{}})
+	stream.Clock = clock
+	stream.Heartbeat(15 * time.Second)
+
+	for i := 0; i < 2; i++ {
+		for clock.Waiters() == 0 {
+			time.Sleep(time.Millisecond)
+		}
+		clock.Advance(15 * time.Second)
+	}
+	for clock.Waiters() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	stream.Close()
+	if string(rec.body) != ": heartbeat\n\n: heartbeat\n\n" {
+		t.Error("Expected two heartbeats, got", string(rec.body))
+	}
+}
+
+// TestEventStreamServer tests events arriving one at a time over the wire.
+func TestEventStreamServer(t *testing.T) {
+	next := make(chan struct{})
+	_, addr := startServer(t, HandlerFunc(func(w ResponseWriter, req *ServerRequest) {
+		stream, err := NewEventStream(w, req)
+		if err != nil {
+			return
+		}
+		for i := 1; i <= 2; i++ {
+			<-next
+			stream.Send(SSEEvent{ID: strings.Repeat("x", i), Data: "event"})
+		}
+	}))
+
+	response, err := http.Get("http://" + addr + "/events")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer response.Body.Close()
+	if response.Header.Get("Content-Type") != "text/event-stream" {
+		t.Error("Expected an event stream, got", response.Header)
+	}
+	reader := bufio.NewReader(response.Body)
+	for _, id := range []string{"x", "xx"} {
+		next <- struct{}{}
+		line, _ := reader.ReadString('\n')
+		if line != "id: "+id+"\n" {
+			t.Error("Expected the event as soon as it was sent, got", line)
+		}
+		reader.ReadString('\n')
+		reader.ReadString('\n')
+	}
+	if rest, _ := io.ReadAll(reader); len(rest) != 0 {
+		t.Error("Expected the stream to end, got", string(rest))
+	}
+}
@@ -0,0 +1,182 @@
+package httpmodule
+
+import (
+	"bufio"
+	"math/rand"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// FaultInjector is a Transport decorator that makes requests fail in the ways
+// real networks and servers do, at configurable probabilities, so code built on
+// the client can be tested against them. Each probability is between 0 and 1
+// and is rolled independently for every request.
+type FaultInjector struct {
+	// Transport the surviving requests are sent through
+	Next Transport
+
+	// Restricts faults to requests it matches; nil injects into every request
+	Only Matcher
+
+	// Delay added before the request is forwarded
+	Latency            time.Duration
+	LatencyProbability float64
+
+	// Fail the request with a connection reset instead of forwarding it
+	ResetProbability float64
+
+	// Cut the response body short, so reading it fails with io.ErrUnexpectedEOF
+	TruncateProbability float64
+
+	// Re-frame the response body as chunks with a corrupt size line
+	MalformedChunkProbability float64
+
+	// Start a burst of ServerErrorBurst consecutive responses with status
+	// ServerErrorStatus (503 when zero) without forwarding the requests
+	ServerErrorProbability float64
+	ServerErrorBurst       int
+	ServerErrorStatus      int
+
+	// Source of time for latency; nil uses the real clock
+	Clock Clock
+
+	mu          sync.Mutex
+	rand        *rand.Rand
+	burstLeft   int
+	injectCount map[string]int
+}
+
+// NewFaultInjector returns an injector forwarding to next whose random choices
+// are derived from seed, so a failing run can be reproduced
+func NewFaultInjector(next Transport, seed int64) *FaultInjector {
+	return &FaultInjector{
+		Next: next,
+		rand: rand.New(rand.NewSource(seed)),
+	}
+}
+
+// roll reports whether an event with probability p happens
+func (injector *FaultInjector) roll(p float64) bool {
+	if p <= 0 {
+		return false
+	}
+	injector.mu.Lock()
+	defer injector.mu.Unlock()
+	if injector.rand == nil {
+		injector.rand = rand.New(rand.NewSource(time.Now().UnixNano()))
+	}
+	return injector.rand.Float64() < p
+}
+
+// count records that a fault of the given kind was injected
+func (injector *FaultInjector) count(kind string) {
+	injector.mu.Lock()
+	defer injector.mu.Unlock()
+	if injector.injectCount == nil {
+		injector.injectCount = make(map[string]int)
+	}
+	injector.injectCount[kind]++
+}
+
+// Injected returns how many faults of each kind ("latency", "reset",
+// "truncate", "malformed_chunk", "server_error") have been injected so far
+func (injector *FaultInjector) Injected() map[string]int {
+	injector.mu.Lock()
+	defer injector.mu.Unlock()
+	counts := make(map[string]int, len(injector.injectCount))
+	for k, v := range injector.injectCount {
+		counts[k] = v
+	}
+	return counts
+}
+
+func (injector *FaultInjector) RoundTrip(req *HttpRequest) (*HttpResponse, error) {
+	if injector.Only != nil && !injector.Only.Match(req) {
+		return injector.Next.RoundTrip(req)
+	}
+
+	if injector.Latency > 0 && injector.roll(injector.LatencyProbability) {
+		injector.count("latency")
+		<-clockOrReal(injector.Clock).After(injector.Latency)
+	}
+
+	if injector.roll(injector.ResetProbability) {
+		injector.count("reset")
+		return nil, &net.OpError{Op: "read", Net: "tcp", Err: os.NewSyscallError("read", syscall.ECONNRESET)}
+	}
+
+	if injector.serverError() {
+		injector.count("server_error")
+		status := injector.ServerErrorStatus
+		if status == 0 {
+			status = 503
+		}
+		return &HttpResponse{
+			Protocol:   "HTTP/1.1",
+			StatusCode: status,
+			Status:     statusText(status),
+			Headers:    map[string]string{"Content-Length": "0"},
+		}, nil
+	}
+
+	response, err := injector.Next.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+
+	truncate := injector.roll(injector.TruncateProbability)
+	malformed := !truncate && injector.roll(injector.MalformedChunkProbability)
+	if !truncate && !malformed {
+		return response, nil
+	}
+
+	// Both faults replace the body, so read the real one first
+	body, err := response.ReadBody()
+	if err != nil {
+		return nil, err
+	}
+	response.Body = ""
+	var raw string
+	headers := map[string]string{}
+	if truncate {
+		injector.count("truncate")
+		headers["Content-Length"] = strconv.Itoa(len(body) + 1)
+		raw = body[:len(body)/2]
+	} else {
+		injector.count("malformed_chunk")
+		headers["Transfer-Encoding"] = "chunked"
+		raw = strconv.FormatInt(int64(len(body)), 16) + "\r\n" + body + "\r\nnot-a-size\r\n"
+	}
+	framed, _ := newBodyReader(bufio.NewReader(strings.NewReader(raw)), headers, false)
+	response.body = &deferredBody{bodyReader: framed}
+	return response, nil
+}
+
+// serverError reports whether this request is part of a 5xx burst, starting a
+// new burst when the dice say so
+func (injector *FaultInjector) serverError() bool {
+	injector.mu.Lock()
+	if injector.burstLeft > 0 {
+		injector.burstLeft--
+		injector.mu.Unlock()
+		return true
+	}
+	injector.mu.Unlock()
+
+	if !injector.roll(injector.ServerErrorProbability) {
+		return false
+	}
+	burst := injector.ServerErrorBurst
+	if burst < 1 {
+		burst = 1
+	}
+	injector.mu.Lock()
+	injector.burstLeft = burst - 1
+	injector.mu.Unlock()
+	return true
+}
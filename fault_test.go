@@ -0,0 +1,108 @@
+package httpmodule
+
+import (
+	"errors"
+	"io"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// newFaultClient returns a client whose requests go through injector to a transport answering "hello world".
+func newFaultClient(injector *FaultInjector) *HttpClient {
+	injector.Next = RoundTripFunc(func(req *HttpRequest) (*HttpResponse, error) {
+		return &HttpResponse{Protocol: "HTTP/1.1", StatusCode: 200, Status: "OK", Body: "hello world"}, nil
+	})
+	client := New()
+	client.Transport = injector
+	return client
+}
+
+// TestFaultInjectorReset tests that resets surface as connection reset errors.
+func TestFaultInjectorReset(t *testing.T) {
+	injector := NewFaultInjector(nil, 1)
+	injector.ResetProbability = 1
+	client := newFaultClient(injector)
+
+	_, err := client.Get("https://example.com", nil)
+	if !errors.Is(err, syscall.ECONNRESET) {
+		t.Error("Expected a connection reset.", err)
+	}
+	if injector.Injected()["reset"] != 1 {
+		t.Error("Expected resets to be counted.", injector.Injected())
+	}
+}
+
+// TestFaultInjectorBodies tests truncated and malformed bodies.
+func TestFaultInjectorBodies(t *testing.T) {
+	injector := NewFaultInjector(nil, 1)
+	injector.TruncateProbability = 1
+	client := newFaultClient(injector)
+	if _, err := client.Get("https://example.com", nil); err != io.ErrUnexpectedEOF {
+		t.Error("Expected a truncated body.", err)
+	}
+
+	injector.TruncateProbability = 0
+	injector.MalformedChunkProbability = 1
+	if _, err := client.Get("https://example.com", nil); err == nil || err.Error() != "invalid chunk size" {
+		t.Error("Expected a chunk framing error.", err)
+	}
+}
+
+// TestFaultInjectorServerErrorBurst tests that a burst returns consecutive 5xx responses.
+func TestFaultInjectorServerErrorBurst(t *testing.T) {
+	injector := NewFaultInjector(nil, 1)
+	injector.ServerErrorProbability = 1
+	injector.ServerErrorBurst = 3
+	client := newFaultClient(injector)
+
+	for i := 0; i < 3; i++ {
+		response, err := client.Get("https://example.com", nil)
+		if err != nil || response.StatusCode != 503 {
+			t.Error("Expected 503 during the burst.", response, err)
+		}
+		injector.ServerErrorProbability = 0
+	}
+	response, err := client.Get("https://example.com", nil)
+	if err != nil || response.StatusCode != 200 {
+		t.Error("Expected the burst to be over.", response, err)
+	}
+}
+
+// TestFaultInjectorLatency tests that latency waits on the injector's clock.
+func TestFaultInjectorLatency(t *testing.T) {
+	clock := NewFakeClock(time.Now())
+	injector := NewFaultInjector(nil, 1)
+	injector.Latency = time.Second
+	injector.LatencyProbability = 1
+	injector.Clock = clock
+	client := newFaultClient(injector)
+
+	done := make(chan error)
+	go func() {
+		_, err := client.Get("https://example.com", nil)
+		done <- err
+	}()
+	for clock.Waiters() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	clock.Advance(time.Second)
+	if err := <-done; err != nil {
+		t.Error("Expected the delayed request to succeed.", err)
+	}
+}
+
+// TestFaultInjectorOnly tests restricting faults to matching requests.
+func TestFaultInjectorOnly(t *testing.T) {
+	injector := NewFaultInjector(nil, 1)
+	injector.ResetProbability = 1
+	injector.Only = MatchPath(`^/flaky`)
+	client := newFaultClient(injector)
+
+	if _, err := client.Get("https://example.com/stable", nil); err != nil {
+		t.Error("Expected unmatched requests to pass through.", err)
+	}
+	if _, err := client.Get("https://example.com/flaky", nil); !errors.Is(err, syscall.ECONNRESET) {
+		t.Error("Expected a connection reset for matching requests.", err)
+	}
+}
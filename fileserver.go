@@ -0,0 +1,425 @@
+package httpmodule
+
+import (
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"io/fs"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	neturl "net/url"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Most ranges a single request may ask for before the whole file is sent instead
+const maxRanges = 32
+
+// FileServer is a Handler that serves files from a directory tree, answering
+// conditional requests from each file's ETag and modification time and
+// byte-range requests with 206 responses
+type FileServer struct {
+	Root fs.FS
+
+	// Prefix of request paths to remove before looking files up, such as "/static"
+	StripPrefix string
+
+	// Answer requests for directories without an index.html with a listing
+	// of their contents, rather than 404
+	ListDirectories bool
+}
+
+// NewFileServer returns a FileServer for the files under dir
+func NewFileServer(dir string) *FileServer {
+	return &FileServer{Root: os.DirFS(dir)}
+}
+
+func (fsrv *FileServer) ServeHTTP(w ResponseWriter, req *ServerRequest) {
+	if req.Method != "GET" && req.Method != "HEAD" {
+		w.Header()["Allow"] = "GET, HEAD"
+		w.WriteHeader(405)
+		return
+	}
+	if !strings.HasPrefix(req.Path, fsrv.StripPrefix) {
+		w.WriteHeader(404)
+		return
+	}
+	name := strings.TrimPrefix(path.Clean("/"+strings.TrimPrefix(req.Path, fsrv.StripPrefix)), "/")
+	if name == "" {
+		name = "."
+	}
+
+	file, info, err := fsrv.open(name)
+	if err != nil {
+		fileError(w, err)
+		return
+	}
+	defer file.Close()
+
+	if info.IsDir() {
+		if !strings.HasSuffix(req.Path, "/") {
+			location := req.Path + "/"
+			if len(req.Query) > 0 {
+				location += "?" + req.Query.Encode()
+			}
+			w.Header()["Location"] = location
+			w.WriteHeader(301)
+			return
+		}
+		index, indexInfo, err := fsrv.open(path.Join(name, "index.html"))
+		if err == nil && !indexInfo.IsDir() {
+			defer index.Close()
+			serveContent(w, req, index, indexInfo)
+			return
+		}
+		if index != nil {
+			index.Close()
+		}
+		if !fsrv.ListDirectories {
+			w.WriteHeader(404)
+			return
+		}
+		listDirectory(w, req, file)
+		return
+	}
+	serveContent(w, req, file, info)
+}
+
+// open opens name in the root along with its details
+func (fsrv *FileServer) open(name string) (fs.File, fs.FileInfo, error) {
+	file, err := fsrv.Root.Open(name)
+	if err != nil {
+		return nil, nil, err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, nil, err
+	}
+	return file, info, nil
+}
+
+// fileError answers with the status for a failure to open a file
+func fileError(w ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, fs.ErrNotExist), errors.Is(err, fs.ErrInvalid):
+		w.WriteHeader(404)
+	case errors.Is(err, fs.ErrPermission):
+		w.WriteHeader(403)
+	default:
+		w.WriteHeader(500)
+	}
+}
+
+// listDirectory answers with an HTML list of a directory's entries
+func listDirectory(w ResponseWriter, req *ServerRequest, dir fs.File) {
+	reader, ok := dir.(fs.ReadDirFile)
+	if !ok {
+		w.WriteHeader(500)
+		return
+	}
+	entries, err := reader.ReadDir(-1)
+	if err != nil {
+		w.WriteHeader(500)
+		return
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "<!doctype html>\n<title>%s</title>\n<pre>\n", html.EscapeString(req.Path))
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() {
+			name += "/"
+		}
+		link := neturl.URL{Path: name}
+		fmt.Fprintf(&b, "<a href=\"%s\">%s</a>\n", html.EscapeString(link.String()), html.EscapeString(name))
+	}
+	b.WriteString("</pre>\n")
+
+	w.Header()["Content-Type"] = "text/html; charset=utf-8"
+	w.Header()["Content-Length"] = strconv.Itoa(b.Len())
+	io.WriteString(w, b.String())
+}
+
+// serveContent answers a GET or HEAD request for a regular file, honouring
+// conditional and range headers
+func serveContent(w ResponseWriter, req *ServerRequest, file fs.File, info fs.FileInfo) {
+	modTime := info.ModTime().UTC().Truncate(time.Second)
+	size := info.Size()
+	etag := fmt.Sprintf("\"%x-%x\"", size, info.ModTime().UnixNano())
+
+	headers := w.Header()
+	headers["ETag"] = etag
+	if !modTime.IsZero() {
+		headers["Last-Modified"] = modTime.Format(httpDateFormat)
+	}
+	headers["Accept-Ranges"] = "bytes"
+
+	if status := checkPreconditions(req, etag, modTime); status != 0 {
+		if status == 304 {
+			delete(headers, "Accept-Ranges")
+		}
+		w.WriteHeader(status)
+		return
+	}
+
+	contentType := mime.TypeByExtension(path.Ext(info.Name()))
+	if contentType == "" {
+		// Sniff the start of the file, then go back to serve all of it
+		buf := make([]byte, 512)
+		n, _ := io.ReadFull(file, buf)
+		contentType = http.DetectContentType(buf[:n])
+		seeker, ok := file.(io.Seeker)
+		if !ok {
+			// The sniffed bytes can't be unread, so no ranges either
+			headers["Content-Type"] = contentType
+			headers["Content-Length"] = strconv.FormatInt(size, 10)
+			delete(headers, "Accept-Ranges")
+			if req.Method == "GET" {
+				w.Write(buf[:n])
+				io.Copy(w, file)
+			}
+			return
+		}
+		if _, err := seeker.Seek(0, io.SeekStart); err != nil {
+			w.WriteHeader(500)
+			return
+		}
+	}
+	if _, ok := headers["Content-Type"]; !ok {
+		headers["Content-Type"] = contentType
+	}
+
+	rangeHeader := headerValue(req.Headers, "Range")
+	seeker, seekable := file.(io.ReadSeeker)
+	if rangeHeader == "" || !seekable || !ifRangeHolds(req, etag, modTime) {
+		headers["Content-Length"] = strconv.FormatInt(size, 10)
+		if req.Method == "GET" {
+			io.Copy(w, file)
+		}
+		return
+	}
+
+	ranges, err := parseRange(rangeHeader, size)
+	if err != nil {
+		headers["Content-Range"] = fmt.Sprintf("bytes */%d", size)
+		w.WriteHeader(416)
+		return
+	}
+	if len(ranges) == 0 || len(ranges) > maxRanges {
+		headers["Content-Length"] = strconv.FormatInt(size, 10)
+		if req.Method == "GET" {
+			io.Copy(w, file)
+		}
+		return
+	}
+
+	if len(ranges) == 1 {
+		r := ranges[0]
+		headers["Content-Range"] = r.contentRange(size)
+		headers["Content-Length"] = strconv.FormatInt(r.length, 10)
+		w.WriteHeader(206)
+		if req.Method == "GET" {
+			if _, err := seeker.Seek(r.start, io.SeekStart); err == nil {
+				io.CopyN(w, seeker, r.length)
+			}
+		}
+		return
+	}
+
+	// Several ranges go in a multipart body, whose length is worked out
+	// beforehand by writing the part headers alone
+	var counter countingWriter
+	mw := multipart.NewWriter(&counter)
+	for _, r := range ranges {
+		mw.CreatePart(r.mimeHeader(contentType, size))
+		counter.n += r.length
+	}
+	mw.Close()
+
+	headers["Content-Type"] = "multipart/byteranges; boundary=" + mw.Boundary()
+	headers["Content-Length"] = strconv.FormatInt(counter.n, 10)
+	w.WriteHeader(206)
+	if req.Method != "GET" {
+		return
+	}
+	mw = multipart.NewWriter(w)
+	mw.SetBoundary(headers["Content-Type"][len("multipart/byteranges; boundary="):])
+	for _, r := range ranges {
+		part, err := mw.CreatePart(r.mimeHeader(contentType, size))
+		if err != nil {
+			return
+		}
+		if _, err := seeker.Seek(r.start, io.SeekStart); err != nil {
+			return
+		}
+		if _, err := io.CopyN(part, seeker, r.length); err != nil {
+			return
+		}
+	}
+	mw.Close()
+}
+
+// checkPreconditions evaluates the conditional headers in the order RFC 9110
+// gives, returning 304 or 412 when the request should not be served, or 0
+func checkPreconditions(req *ServerRequest, etag string, modTime time.Time) int {
+	if match := headerValue(req.Headers, "If-Match"); match != "" {
+		if !etagListMatches(match, etag, false) {
+			return 412
+		}
+	} else if since, ok := parseHTTPDate(headerValue(req.Headers, "If-Unmodified-Since")); ok {
+		if modTime.After(since) {
+			return 412
+		}
+	}
+
+	if noneMatch := headerValue(req.Headers, "If-None-Match"); noneMatch != "" {
+		if etagListMatches(noneMatch, etag, true) {
+			return 304
+		}
+	} else if since, ok := parseHTTPDate(headerValue(req.Headers, "If-Modified-Since")); ok {
+		if !modTime.IsZero() && !modTime.After(since) {
+			return 304
+		}
+	}
+	return 0
+}
+
+// ifRangeHolds reports whether a range request's If-Range, if any, still
+// matches the file, so that only part of it may be sent
+func ifRangeHolds(req *ServerRequest, etag string, modTime time.Time) bool {
+	ifRange := headerValue(req.Headers, "If-Range")
+	if ifRange == "" {
+		return true
+	}
+	if strings.HasPrefix(ifRange, "\"") {
+		return ifRange == etag
+	}
+	date, ok := parseHTTPDate(ifRange)
+	return ok && modTime.Equal(date)
+}
+
+// etagListMatches reports whether a comma-separated list of entity tags, or
+// "*", includes etag. Weak comparison ignores the W/ prefix.
+func etagListMatches(list, etag string, weak bool) bool {
+	if strings.TrimSpace(list) == "*" {
+		return true
+	}
+	for _, candidate := range strings.Split(list, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if weak {
+			candidate = strings.TrimPrefix(candidate, "W/")
+		}
+		if candidate == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// parseHTTPDate parses the date format of Last-Modified and its relatives
+func parseHTTPDate(value string) (time.Time, bool) {
+	if value == "" {
+		return time.Time{}, false
+	}
+	t, err := http.ParseTime(value)
+	return t, err == nil
+}
+
+// byteRange is part of a file, as asked for in a Range header
+type byteRange struct {
+	start, length int64
+}
+
+func (r byteRange) contentRange(size int64) string {
+	return fmt.Sprintf("bytes %d-%d/%d", r.start, r.start+r.length-1, size)
+}
+
+func (r byteRange) mimeHeader(contentType string, size int64) map[string][]string {
+	return map[string][]string{
+		"Content-Range": {r.contentRange(size)},
+		"Content-Type":  {contentType},
+	}
+}
+
+// errUnsatisfiableRange is returned when none of the ranges asked for overlap the file
+var errUnsatisfiableRange = errors.New("no requested range overlaps the content")
+
+// parseRange parses a Range header such as "bytes=0-99,-50" against a file of
+// size bytes. A header it doesn't understand yields no ranges, meaning the
+// whole file should be sent, as RFC 9110 allows.
+func parseRange(header string, size int64) ([]byteRange, error) {
+	spec, ok := strings.CutPrefix(header, "bytes=")
+	if !ok {
+		return nil, nil
+	}
+	var ranges []byteRange
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		first, last, ok := strings.Cut(part, "-")
+		if !ok {
+			return nil, nil
+		}
+		first, last = strings.TrimSpace(first), strings.TrimSpace(last)
+
+		var r byteRange
+		if first == "" {
+			// A suffix range, the last n bytes
+			n, err := strconv.ParseInt(last, 10, 64)
+			if err != nil || n < 0 {
+				return nil, nil
+			}
+			if n == 0 || size == 0 {
+				continue
+			}
+			if n > size {
+				n = size
+			}
+			r = byteRange{start: size - n, length: n}
+		} else {
+			start, err := strconv.ParseInt(first, 10, 64)
+			if err != nil || start < 0 {
+				return nil, nil
+			}
+			end := size - 1
+			if last != "" {
+				end, err = strconv.ParseInt(last, 10, 64)
+				if err != nil || end < start {
+					return nil, nil
+				}
+				if end >= size {
+					end = size - 1
+				}
+			}
+			if start >= size {
+				continue
+			}
+			r = byteRange{start: start, length: end - start + 1}
+		}
+		ranges = append(ranges, r)
+	}
+	if len(ranges) == 0 {
+		return nil, errUnsatisfiableRange
+	}
+	return ranges, nil
+}
+
+// countingWriter counts the bytes written to it and discards them
+type countingWriter struct {
+	n int64
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	w.n += int64(len(p))
+	return len(p), nil
+}
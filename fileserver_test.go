@@ -0,0 +1,146 @@
+package httpmodule
+
+import (
+	"io"
+	"mime"
+	"mime/multipart"
+	"strconv"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+// newTestFileServer serves a small tree of files.
+func newTestFileServer() *FileServer {
+	modTime := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	return &FileServer{Root: fstest.MapFS{
+		"app.js":            {Data: []byte("console.log(1)"), ModTime: modTime},
+		"data.bin":          {Data: []byte("0123456789"), ModTime: modTime},
+		"docs/index.html":   {Data: []byte("<h1>docs</h1>"), ModTime: modTime},
+		"build/a.txt":       {Data: []byte("a"), ModTime: modTime},
+		"build/sub/b.txt":   {Data: []byte("b"), ModTime: modTime},
+		"build/<script>.md": {Data: []byte("c"), ModTime: modTime},
+	}}
+}
+
+// TestFileServer tests serving files, index pages, and listings.
+func TestFileServer(t *testing.T) {
+	fsrv := newTestFileServer()
+
+	rec := serve(fsrv, "GET", "/app.js")
+	if rec.status != 200 || string(rec.body) != "console.log(1)" || !strings.Contains(rec.headers["Content-Type"], "javascript") {
+		t.Error("Expected the file with its type, got", rec.status, rec.headers, string(rec.body))
+	}
+	if rec.headers["Last-Modified"] != "Tue, 02 Jan 2024 03:04:05 GMT" || rec.headers["ETag"] == "" || rec.headers["Content-Length"] != "14" {
+		t.Error("Expected validators and a length, got", rec.headers)
+	}
+	if rec := serve(fsrv, "HEAD", "/app.js"); rec.status != 200 || len(rec.body) != 0 || rec.headers["Content-Length"] != "14" {
+		t.Error("Expected a bodiless HEAD response, got", rec.status, rec.headers, string(rec.body))
+	}
+	if rec := serve(fsrv, "GET", "/docs/"); string(rec.body) != "<h1>docs</h1>" {
+		t.Error("Expected the index page, got", string(rec.body))
+	}
+	if rec := serve(fsrv, "GET", "/docs"); rec.status != 301 || rec.headers["Location"] != "/docs/" {
+		t.Error("Expected a redirect to the directory, got", rec.status, rec.headers)
+	}
+	if rec := serve(fsrv, "GET", "/build/"); rec.status != 404 {
+		t.Error("Expected 404 for a directory without listings, got", rec.status)
+	}
+	if rec := serve(fsrv, "GET", "/../../etc/passwd"); rec.status != 404 {
+		t.Error("Expected paths to stay inside the root, got", rec.status)
+	}
+	if rec := serve(fsrv, "POST", "/app.js"); rec.status != 405 || rec.headers["Allow"] != "GET, HEAD" {
+		t.Error("Expected 405, got", rec.status, rec.headers)
+	}
+
+	fsrv.ListDirectories = true
+	fsrv.StripPrefix = "/static"
+	rec = serve(fsrv, "GET", "/static/build/")
+	want := "<a href=\"%3Cscript%3E.md\">&lt;script&gt;.md</a>\n<a href=\"a.txt\">a.txt</a>\n<a href=\"sub/\">sub/</a>\n"
+	if rec.status != 200 || !strings.Contains(string(rec.body), want) {
+		t.Error("Expected an escaped listing, got", rec.status, string(rec.body))
+	}
+}
+
+// TestFileServerConditional tests answering conditional requests.
+func TestFileServerConditional(t *testing.T) {
+	fsrv := newTestFileServer()
+	etag := serve(fsrv, "GET", "/app.js").headers["ETag"]
+
+	tests := []struct {
+		headers map[string]string
+		status  int
+	}{
+		{map[string]string{"If-None-Match": etag}, 304},
+		{map[string]string{"If-None-Match": "W/" + etag + ", \"other\""}, 304},
+		{map[string]string{"If-None-Match": "\"other\""}, 200},
+		{map[string]string{"If-Modified-Since": "Tue, 02 Jan 2024 03:04:05 GMT"}, 304},
+		{map[string]string{"If-Modified-Since": "Mon, 01 Jan 2024 00:00:00 GMT"}, 200},
+		{map[string]string{"If-None-Match": "\"other\"", "If-Modified-Since": "Tue, 02 Jan 2024 03:04:05 GMT"}, 200},
+		{map[string]string{"If-Match": "\"other\""}, 412},
+		{map[string]string{"If-Match": etag}, 200},
+		{map[string]string{"If-Unmodified-Since": "Mon, 01 Jan 2024 00:00:00 GMT"}, 412},
+	}
+	for _, test := range tests {
+		if rec := serveWith(fsrv, "GET", "/app.js", test.headers); rec.status != test.status {
+			t.Errorf("%v: expected %d, got %d.", test.headers, test.status, rec.status)
+		}
+	}
+}
+
+// TestFileServerRange tests byte-range requests.
+func TestFileServerRange(t *testing.T) {
+	fsrv := newTestFileServer()
+	get := func(headers map[string]string) *responseRecorder {
+		return serveWith(fsrv, "GET", "/data.bin", headers)
+	}
+
+	tests := []struct {
+		rangeHeader, body, contentRange string
+	}{
+		{"bytes=2-4", "234", "bytes 2-4/10"},
+		{"bytes=7-", "789", "bytes 7-9/10"},
+		{"bytes=-2", "89", "bytes 8-9/10"},
+		{"bytes=5-100", "56789", "bytes 5-9/10"},
+	}
+	for _, test := range tests {
+		rec := get(map[string]string{"Range": test.rangeHeader})
+		if rec.status != 206 || string(rec.body) != test.body || rec.headers["Content-Range"] != test.contentRange {
+			t.Errorf("%s: expected %q, got %d %q %v.", test.rangeHeader, test.body, rec.status, rec.body, rec.headers)
+		}
+	}
+
+	if rec := get(map[string]string{"Range": "bytes=20-30"}); rec.status != 416 || rec.headers["Content-Range"] != "bytes */10" {
+		t.Error("Expected 416 for an unsatisfiable range, got", rec.status, rec.headers)
+	}
+	if rec := get(map[string]string{"Range": "items=1-2"}); rec.status != 200 || string(rec.body) != "0123456789" {
+		t.Error("Expected the whole file for an unknown unit, got", rec.status, string(rec.body))
+	}
+	if rec := get(map[string]string{"Range": "bytes=0-1", "If-Range": "\"stale\""}); rec.status != 200 {
+		t.Error("Expected the whole file when If-Range doesn't match, got", rec.status)
+	}
+	etag := get(nil).headers["ETag"]
+	if rec := get(map[string]string{"Range": "bytes=0-1", "If-Range": etag}); rec.status != 206 {
+		t.Error("Expected a range when If-Range matches, got", rec.status)
+	}
+
+	rec := get(map[string]string{"Range": "bytes=0-1,8-"})
+	mediaType, params, _ := mime.ParseMediaType(rec.headers["Content-Type"])
+	if rec.status != 206 || mediaType != "multipart/byteranges" || rec.headers["Content-Length"] != strconv.Itoa(len(rec.body)) {
+		t.Fatal("Expected a multipart response with its length, got", rec.status, rec.headers, len(rec.body))
+	}
+	reader := multipart.NewReader(strings.NewReader(string(rec.body)), params["boundary"])
+	var parts []string
+	for {
+		part, err := reader.NextPart()
+		if err != nil {
+			break
+		}
+		data, _ := io.ReadAll(part)
+		parts = append(parts, part.Header.Get("Content-Range")+" "+string(data))
+	}
+	if strings.Join(parts, ", ") != "bytes 0-1/10 01, bytes 8-9/10 89" {
+		t.Error("Expected both ranges, got", parts)
+	}
+}
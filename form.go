@@ -0,0 +1,259 @@
+package httpmodule
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"mime"
+	"mime/multipart"
+	neturl "net/url"
+	"strconv"
+	"strings"
+)
+
+// Largest urlencoded form body ParseForm reads
+const maxFormSize = 10 << 20
+
+// Memory FormValue and FormFile let multipart uploads use before spilling to disk
+const defaultMultipartMemory = 32 << 20
+
+// BodyError is a request body a handler couldn't parse, with the status to
+// answer it with: 400 for malformed bodies, 413 for oversized ones, and 415
+// for the wrong media type
+type BodyError struct {
+	Status int
+	Err    error
+}
+
+func (e *BodyError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *BodyError) Unwrap() error {
+	return e.Err
+}
+
+// ErrBodyTooLarge is returned when a request body is longer than allowed
+var ErrBodyTooLarge = errors.New("request body too large")
+
+func bodyError(status int, format string, args ...any) error {
+	return &BodyError{Status: status, Err: fmt.Errorf(format, args...)}
+}
+
+// ParseForm fills Form with the query parameters and, for POST, PUT, and
+// PATCH requests with an urlencoded body, the body's fields, which also go in
+// PostForm. Body values come first in Form. It is safe to call more than once.
+func (req *ServerRequest) ParseForm() error {
+	if req.Form != nil {
+		return nil
+	}
+	req.PostForm = neturl.Values{}
+	mediaType := req.mediaType()
+	if mediaType == "application/x-www-form-urlencoded" && (req.Method == "POST" || req.Method == "PUT" || req.Method == "PATCH") {
+		data, err := readLimited(req.Body, maxFormSize)
+		if err != nil {
+			return err
+		}
+		req.PostForm, err = neturl.ParseQuery(string(data))
+		if err != nil {
+			return bodyError(400, "malformed form body: %v", err)
+		}
+	}
+
+	req.Form = make(neturl.Values, len(req.PostForm)+len(req.Query))
+	for k, v := range req.PostForm {
+		req.Form[k] = append(req.Form[k], v...)
+	}
+	for k, v := range req.Query {
+		req.Form[k] = append(req.Form[k], v...)
+	}
+	return nil
+}
+
+// ParseMultipartForm parses a multipart/form-data body into MultipartForm,
+// keeping up to maxMemory bytes of file contents in memory and spilling the
+// rest to temporary files, which the server removes once the handler
+// returns. Bodies longer than maxSize are rejected, unless it is zero. Text
+// fields are added to Form and PostForm as well.
+func (req *ServerRequest) ParseMultipartForm(maxMemory, maxSize int64) error {
+	if req.MultipartForm != nil {
+		return nil
+	}
+	if req.mediaType() != "multipart/form-data" {
+		return bodyError(415, "not a multipart/form-data request")
+	}
+	_, params, _ := mime.ParseMediaType(headerValue(req.Headers, "Content-Type"))
+	if params["boundary"] == "" {
+		return bodyError(400, "multipart body without a boundary")
+	}
+
+	body := limitBody(req.Body, maxSize)
+	form, err := multipart.NewReader(body, params["boundary"]).ReadForm(maxMemory)
+	if err != nil {
+		if errors.Is(err, ErrBodyTooLarge) {
+			return &BodyError{Status: 413, Err: ErrBodyTooLarge}
+		}
+		return bodyError(400, "malformed multipart body: %v", err)
+	}
+	req.MultipartForm = form
+
+	if err := req.ParseForm(); err != nil {
+		return err
+	}
+	for k, v := range form.Value {
+		req.PostForm[k] = append(req.PostForm[k], v...)
+		req.Form[k] = append(v[:len(v):len(v)], req.Form[k]...)
+	}
+	return nil
+}
+
+// FormValue returns the first value of a form field from the body or query,
+// parsing the form if needed. Parse errors are ignored; call ParseForm or
+// ParseMultipartForm to see them.
+func (req *ServerRequest) FormValue(key string) string {
+	if req.Form == nil {
+		if req.mediaType() == "multipart/form-data" {
+			req.ParseMultipartForm(defaultMultipartMemory, 0)
+		}
+		req.ParseForm()
+	}
+	return req.Form.Get(key)
+}
+
+// FormFile returns the first file uploaded in a multipart form field,
+// parsing the form if needed
+func (req *ServerRequest) FormFile(key string) (multipart.File, *multipart.FileHeader, error) {
+	if req.MultipartForm == nil {
+		if err := req.ParseMultipartForm(defaultMultipartMemory, 0); err != nil {
+			return nil, nil, err
+		}
+	}
+	files := req.MultipartForm.File[key]
+	if len(files) == 0 {
+		return nil, nil, fmt.Errorf("no file uploaded in field %q", key)
+	}
+	file, err := files[0].Open()
+	if err != nil {
+		return nil, nil, err
+	}
+	return file, files[0], nil
+}
+
+// DecodeJSON decodes a JSON body into v strictly: the Content-Type must be
+// JSON, fields v doesn't have are rejected, and nothing may follow the value.
+// Bodies longer than maxSize are rejected, unless it is zero. Errors are
+// *BodyError, carrying the status to answer with.
+func (req *ServerRequest) DecodeJSON(v any, maxSize int64) error {
+	mediaType := req.mediaType()
+	if mediaType != "application/json" && !strings.HasSuffix(mediaType, "+json") {
+		return bodyError(415, "expected a JSON body, got %q", headerValue(req.Headers, "Content-Type"))
+	}
+	body := limitBody(req.Body, maxSize)
+
+	decoder := json.NewDecoder(body)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(v); err != nil {
+		if errors.Is(err, ErrBodyTooLarge) {
+			return &BodyError{Status: 413, Err: ErrBodyTooLarge}
+		}
+		if err == io.EOF {
+			return bodyError(400, "empty JSON body")
+		}
+		return bodyError(400, "malformed JSON body: %v", err)
+	}
+	if _, err := decoder.Token(); err != io.EOF {
+		if errors.Is(err, ErrBodyTooLarge) {
+			return &BodyError{Status: 413, Err: ErrBodyTooLarge}
+		}
+		return bodyError(400, "malformed JSON body: unexpected data after the value")
+	}
+	return nil
+}
+
+// QueryInt returns a query parameter as an integer, or def if it is absent
+func (req *ServerRequest) QueryInt(key string, def int) (int, error) {
+	value := req.Query.Get(key)
+	if value == "" {
+		return def, nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		return def, fmt.Errorf("query parameter %q is not an integer: %q", key, value)
+	}
+	return n, nil
+}
+
+// QueryBool returns a query parameter as a boolean, or def if it is absent.
+// A parameter given without a value, as in "?verbose", is true.
+func (req *ServerRequest) QueryBool(key string, def bool) (bool, error) {
+	values, ok := req.Query[key]
+	if !ok {
+		return def, nil
+	}
+	if len(values) == 0 || values[0] == "" {
+		return true, nil
+	}
+	b, err := strconv.ParseBool(values[0])
+	if err != nil {
+		return def, fmt.Errorf("query parameter %q is not a boolean: %q", key, values[0])
+	}
+	return b, nil
+}
+
+// mediaType returns the request's Content-Type without parameters, lower case
+func (req *ServerRequest) mediaType() string {
+	mediaType, _, _ := mime.ParseMediaType(headerValue(req.Headers, "Content-Type"))
+	return mediaType
+}
+
+// readLimited reads all of r, failing with a 413 BodyError past max bytes
+func readLimited(r io.Reader, max int64) ([]byte, error) {
+	var buf bytes.Buffer
+	_, err := io.Copy(&buf, limitBody(r, max))
+	if errors.Is(err, ErrBodyTooLarge) {
+		return nil, &BodyError{Status: 413, Err: ErrBodyTooLarge}
+	}
+	if err != nil {
+		return nil, bodyError(400, "failed to read body: %v", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// limitBody caps r at max bytes, or not at all if max is zero. A nil r reads
+// as empty.
+func limitBody(r io.Reader, max int64) io.Reader {
+	if max <= 0 {
+		max = math.MaxInt64
+	}
+	return &limitedBody{reader: r, remaining: max}
+}
+
+// limitedBody reads from reader until remaining runs out, then fails with
+// ErrBodyTooLarge rather than the silent EOF of io.LimitReader
+type limitedBody struct {
+	reader    io.Reader
+	remaining int64
+}
+
+func (body *limitedBody) Read(p []byte) (int, error) {
+	if body.reader == nil {
+		return 0, io.EOF
+	}
+	if body.remaining <= 0 {
+		// Only an error if there was more to read
+		var probe [1]byte
+		if n, _ := body.reader.Read(probe[:]); n > 0 {
+			return 0, ErrBodyTooLarge
+		}
+		return 0, io.EOF
+	}
+	if int64(len(p)) > body.remaining {
+		p = p[:body.remaining]
+	}
+	n, err := body.reader.Read(p)
+	body.remaining -= int64(n)
+	return n, err
+}
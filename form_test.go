@@ -0,0 +1,159 @@
+package httpmodule
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"mime/multipart"
+	neturl "net/url"
+	"strings"
+	"testing"
+)
+
+// bodyRequest builds a POST request with a body and content type.
+func bodyRequest(contentType, body string) *ServerRequest {
+	return &ServerRequest{
+		Method:  "POST",
+		Query:   neturl.Values{"page": {"2"}, "name": {"query"}},
+		Headers: map[string]string{"Content-Type": contentType},
+		Body:    strings.NewReader(body),
+	}
+}
+
+// bodyStatus returns the status a BodyError carries, or 0.
+func bodyStatus(err error) int {
+	var bodyErr *BodyError
+	if errors.As(err, &bodyErr) {
+		return bodyErr.Status
+	}
+	return 0
+}
+
+// TestParseForm tests merging urlencoded body fields with the query.
+func TestParseForm(t *testing.T) {
+	req := bodyRequest("application/x-www-form-urlencoded", "name=body&tag=a&tag=b")
+	if err := req.ParseForm(); err != nil {
+		t.Fatal(err)
+	}
+	if got := req.Form["name"]; len(got) != 2 || got[0] != "body" || got[1] != "query" {
+		t.Error("Expected body values before query values, got", got)
+	}
+	if req.PostForm.Get("page") != "" || len(req.PostForm["tag"]) != 2 {
+		t.Error("Expected PostForm to hold only body fields, got", req.PostForm)
+	}
+	if req.FormValue("page") != "2" {
+		t.Error("Expected FormValue to see query fields, got", req.FormValue("page"))
+	}
+
+	get := &ServerRequest{Method: "GET", Query: neturl.Values{"q": {"go"}}, Headers: map[string]string{}}
+	if get.FormValue("q") != "go" {
+		t.Error("Expected a GET form to come from the query.")
+	}
+
+	big := bodyRequest("application/x-www-form-urlencoded", "a="+strings.Repeat("x", maxFormSize))
+	if err := big.ParseForm(); bodyStatus(err) != 413 {
+		t.Error("Expected 413 for an oversized form, got", err)
+	}
+	bad := bodyRequest("application/x-www-form-urlencoded", "a=%zz")
+	if err := bad.ParseForm(); bodyStatus(err) != 400 {
+		t.Error("Expected 400 for a malformed form, got", err)
+	}
+}
+
+// TestParseMultipartForm tests fields, uploads spilled to disk, and the size limit.
+func TestParseMultipartForm(t *testing.T) {
+	var buf bytes.Buffer
+	mw := multipart.NewWriter(&buf)
+	mw.WriteField("title", "report")
+	part, _ := mw.CreateFormFile("upload", "data.bin")
+	part.Write(bytes.Repeat([]byte("z"), 4096))
+	mw.Close()
+	contentType := mw.FormDataContentType()
+
+	req := bodyRequest(contentType, buf.String())
+	if err := req.ParseMultipartForm(1024, 0); err != nil {
+		t.Fatal(err)
+	}
+	defer req.MultipartForm.RemoveAll()
+	if req.FormValue("title") != "report" || req.PostForm.Get("title") != "report" || req.FormValue("page") != "2" {
+		t.Error("Expected text fields in Form and PostForm, got", req.Form)
+	}
+	file, header, err := req.FormFile("upload")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := io.ReadAll(file)
+	file.Close()
+	if header.Filename != "data.bin" || len(data) != 4096 {
+		t.Error("Expected the uploaded file, got", header.Filename, len(data))
+	}
+	if _, _, err := req.FormFile("missing"); err == nil {
+		t.Error("Expected an error for a field without a file.")
+	}
+
+	limited := bodyRequest(contentType, buf.String())
+	if err := limited.ParseMultipartForm(1024, 1000); bodyStatus(err) != 413 {
+		t.Error("Expected 413 past the size limit, got", err)
+	}
+	plain := bodyRequest("text/plain", "hello")
+	if err := plain.ParseMultipartForm(1024, 0); bodyStatus(err) != 415 {
+		t.Error("Expected 415 for a body that isn't multipart, got", err)
+	}
+}
+
+// TestDecodeJSON tests strict decoding and the errors it reports.
+func TestDecodeJSON(t *testing.T) {
+	type user struct {
+		Name string `json:"name"`
+	}
+
+	var u user
+	if err := bodyRequest("application/json; charset=utf-8", `{"name":"ada"}`).DecodeJSON(&u, 0); err != nil || u.Name != "ada" {
+		t.Error("Expected the body to decode, got", u, err)
+	}
+	if err := bodyRequest("application/problem+json", `{"name":"ada"}`).DecodeJSON(&u, 0); err != nil {
+		t.Error("Expected +json types to be accepted, got", err)
+	}
+
+	tests := []struct {
+		contentType, body string
+		maxSize           int64
+		status            int
+	}{
+		{"text/plain", `{"name":"ada"}`, 0, 415},
+		{"application/json", `{"name":"ada","admin":true}`, 0, 400},
+		{"application/json", `{"name":"ada"} {"name":"bob"}`, 0, 400},
+		{"application/json", `{"name":`, 0, 400},
+		{"application/json", ``, 0, 400},
+		{"application/json", `{"name":"` + strings.Repeat("a", 100) + `"}`, 50, 413},
+	}
+	for _, test := range tests {
+		err := bodyRequest(test.contentType, test.body).DecodeJSON(&u, test.maxSize)
+		if bodyStatus(err) != test.status {
+			t.Errorf("Expected %d for %q, got %v.", test.status, test.body, err)
+		}
+	}
+}
+
+// TestQueryHelpers tests typed query parameters and their defaults.
+func TestQueryHelpers(t *testing.T) {
+	req := &ServerRequest{Query: neturl.Values{"page": {"3"}, "bad": {"x"}, "verbose": {""}, "dry": {"false"}}}
+	if n, err := req.QueryInt("page", 1); n != 3 || err != nil {
+		t.Error("Expected page 3, got", n, err)
+	}
+	if n, err := req.QueryInt("size", 20); n != 20 || err != nil {
+		t.Error("Expected the default size, got", n, err)
+	}
+	if _, err := req.QueryInt("bad", 1); err == nil {
+		t.Error("Expected an error for a non-integer.")
+	}
+	if b, _ := req.QueryBool("verbose", false); !b {
+		t.Error("Expected a bare parameter to be true.")
+	}
+	if b, _ := req.QueryBool("dry", true); b {
+		t.Error("Expected dry=false to be false.")
+	}
+	if _, err := req.QueryBool("bad", false); err == nil {
+		t.Error("Expected an error for a non-boolean.")
+	}
+}
@@ -0,0 +1,191 @@
+package httpmodule
+
+import (
+	"io"
+	"log"
+	"net"
+	neturl "net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ForwardProxy is a Handler for clients configured to use it as their HTTP
+// proxy. Absolute-form requests ("GET http://host/path") are forwarded through
+// an HttpClient and CONNECT requests are answered by tunnelling bytes to the
+// host named. Only hosts on the allow-list can be reached; everything else
+// gets 403.
+type ForwardProxy struct {
+	// Hosts that may be reached, each "example.com", "*.example.com" for any
+	// subdomain, or either with a ":port" to allow only that port. An empty
+	// list allows nothing.
+	Allow []string
+
+	// Client plain requests are forwarded with; nil uses a new client
+	Client *HttpClient
+
+	// Opens tunnels for CONNECT; nil dials TCP with a 30 second timeout
+	Dial func(network, addr string) (net.Conn, error)
+
+	// Destination for forwarding errors; nil uses the standard logger
+	ErrorLog *log.Logger
+
+	once   sync.Once
+	client *HttpClient
+}
+
+func (proxy *ForwardProxy) ServeHTTP(w ResponseWriter, req *ServerRequest) {
+	if req.Method == "CONNECT" {
+		if !proxy.Allowed(req.Host, "443") {
+			w.WriteHeader(403)
+			return
+		}
+		proxy.tunnel(w, req)
+		return
+	}
+
+	target, err := neturl.Parse(req.Target)
+	if err != nil || !target.IsAbs() || target.Host == "" {
+		// Origin-form requests are meant for a server, not a proxy
+		w.WriteHeader(400)
+		return
+	}
+	if target.Scheme != "http" {
+		w.WriteHeader(400)
+		return
+	}
+	if !proxy.Allowed(target.Host, "80") {
+		w.WriteHeader(403)
+		return
+	}
+
+	headers := make(map[string]string, len(req.Headers)+1)
+	for k, v := range req.Headers {
+		headers[k] = v
+	}
+	removeHopHeaders(headers)
+	deleteHeader(headers, "Content-Length")
+	if headerValue(headers, "Accept-Encoding") == "" {
+		headers["Accept-Encoding"] = "identity"
+	}
+	out := &HttpRequest{Method: req.Method, URL: target.String(), Headers: headers}
+	if req.Body != nil {
+		body, err := io.ReadAll(req.Body)
+		if err != nil {
+			w.WriteHeader(400)
+			return
+		}
+		out.Body = string(body)
+	}
+
+	reverse := &ReverseProxy{Client: proxy.httpClient(), ErrorLog: proxy.ErrorLog}
+	reverse.forward(w, req, out)
+}
+
+// Allowed reports whether hostport is on the allow-list. defaultPort is used
+// when hostport has no port.
+func (proxy *ForwardProxy) Allowed(hostport, defaultPort string) bool {
+	host, port, err := net.SplitHostPort(hostport)
+	if err != nil {
+		host, port = hostport, defaultPort
+	}
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+
+	for _, entry := range proxy.Allow {
+		pattern, entryPort, err := net.SplitHostPort(entry)
+		if err != nil {
+			pattern, entryPort = entry, ""
+		}
+		if entryPort != "" && entryPort != port {
+			continue
+		}
+		pattern = strings.ToLower(pattern)
+		if suffix, ok := strings.CutPrefix(pattern, "*."); ok {
+			if strings.HasSuffix(host, "."+suffix) {
+				return true
+			}
+		} else if host == pattern {
+			return true
+		}
+	}
+	return false
+}
+
+// tunnel answers a CONNECT request by joining the client's connection to one
+// opened to the target
+func (proxy *ForwardProxy) tunnel(w ResponseWriter, req *ServerRequest) {
+	hijacker, ok := w.(Hijacker)
+	if !ok {
+		w.WriteHeader(501)
+		return
+	}
+
+	dial := proxy.Dial
+	if dial == nil {
+		dial = (&net.Dialer{Timeout: 30 * time.Second}).Dial
+	}
+	upstream, err := dial("tcp", req.Host)
+	if err != nil {
+		proxy.logf("httpmodule: forward proxy failed to connect to %s: %v", req.Host, err)
+		w.WriteHeader(502)
+		return
+	}
+
+	conn, rw, err := hijacker.Hijack()
+	if err != nil {
+		upstream.Close()
+		w.WriteHeader(500)
+		return
+	}
+	if _, err := conn.Write([]byte("HTTP/1.1 200 Connection Established\r\n\r\n")); err != nil {
+		conn.Close()
+		upstream.Close()
+		return
+	}
+
+	// Each direction ends when its source does; the other is told by
+	// closing the write half, so both finish before the connections close
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		io.Copy(upstream, rw.Reader)
+		closeWrite(upstream)
+	}()
+	go func() {
+		defer wg.Done()
+		io.Copy(conn, upstream)
+		closeWrite(conn)
+	}()
+	wg.Wait()
+	conn.Close()
+	upstream.Close()
+}
+
+// closeWrite shuts down the sending side of conn, or all of it if that can't
+// be done alone
+func closeWrite(conn net.Conn) {
+	if c, ok := conn.(interface{ CloseWrite() error }); ok {
+		c.CloseWrite()
+		return
+	}
+	conn.Close()
+}
+
+func (proxy *ForwardProxy) httpClient() *HttpClient {
+	if proxy.Client != nil {
+		return proxy.Client
+	}
+	proxy.once.Do(func() {
+		proxy.client = New()
+	})
+	return proxy.client
+}
+
+func (proxy *ForwardProxy) logf(format string, args ...any) {
+	if proxy.ErrorLog != nil {
+		proxy.ErrorLog.Printf(format, args...)
+		return
+	}
+	log.Printf(format, args...)
+}
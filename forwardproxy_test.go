@@ -0,0 +1,120 @@
+package httpmodule
+
+import (
+	"bufio"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	neturl "net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestForwardProxyAllowed tests matching hosts against the allow-list.
+func TestForwardProxyAllowed(t *testing.T) {
+	proxy := &ForwardProxy{Allow: []string{"api.example.com", "*.internal.test", "git.example.com:443"}}
+	tests := []struct {
+		hostport string
+		want     bool
+	}{
+		{"api.example.com:443", true},
+		{"API.example.com.", true},
+		{"example.com", false},
+		{"db.internal.test:5432", true},
+		{"a.b.internal.test", true},
+		{"internal.test", false},
+		{"git.example.com:443", true},
+		{"git.example.com:22", false},
+		{"git.example.com", false},
+	}
+	for _, test := range tests {
+		if got := proxy.Allowed(test.hostport, "80"); got != test.want {
+			t.Errorf("%s: expected %v, got %v.", test.hostport, test.want, got)
+		}
+	}
+	if (&ForwardProxy{}).Allowed("example.com", "80") {
+		t.Error("Expected an empty allow-list to allow nothing.")
+	}
+}
+
+// TestForwardProxyConnect tests tunnelling to an allowed host.
+func TestForwardProxyConnect(t *testing.T) {
+	echo, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer echo.Close()
+	go func() {
+		conn, err := echo.Accept()
+		if err != nil {
+			return
+		}
+		io.Copy(conn, conn)
+		conn.Close()
+	}()
+
+	proxy := &ForwardProxy{Allow: []string{"127.0.0.1"}, ErrorLog: log.New(io.Discard, "", 0)}
+	_, addr := startServer(t, proxy)
+
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	// Bytes sent right behind the request must make it through the tunnel
+	io.WriteString(conn, "CONNECT "+echo.Addr().String()+" HTTP/1.1\r\nHost: "+echo.Addr().String()+"\r\n\r\nping")
+	reader := bufio.NewReader(conn)
+	status, _ := reader.ReadString('\n')
+	if status != "HTTP/1.1 200 Connection Established\r\n" {
+		t.Fatal("Expected the tunnel to be established, got", status)
+	}
+	reader.ReadString('\n')
+	io.WriteString(conn, "pong")
+	conn.(*net.TCPConn).CloseWrite()
+	data, _ := io.ReadAll(reader)
+	if string(data) != "pingpong" {
+		t.Error("Expected the echo through the tunnel, got", string(data))
+	}
+
+	denied := rawExchange(t, addr, "CONNECT example.com:443 HTTP/1.1\r\nHost: example.com:443\r\nConnection: close\r\n\r\n")
+	if !strings.HasPrefix(denied, "HTTP/1.1 403 ") {
+		t.Error("Expected a host off the allow-list to be refused, got", denied)
+	}
+}
+
+// TestForwardProxyHTTP tests forwarding absolute-form requests.
+func TestForwardProxyHTTP(t *testing.T) {
+	_, upstream := startServer(t, HandlerFunc(func(w ResponseWriter, req *ServerRequest) {
+		io.WriteString(w, req.Method+" "+req.Target+" auth="+req.Headers["Proxy-Authorization"])
+	}))
+	proxy := &ForwardProxy{Allow: []string{"127.0.0.1"}, Client: New()}
+	proxy.Client.Transport = loopbackTransport(t, proxy.Client, upstream)
+	_, addr := startServer(t, proxy)
+
+	proxyURL, _ := neturl.Parse("http://user:secret@" + addr)
+	client := &http.Client{Transport: &http.Transport{Proxy: http.ProxyURL(proxyURL)}}
+	defer client.CloseIdleConnections()
+
+	response, err := client.Get("http://" + upstream + "/path")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(response.Body)
+	response.Body.Close()
+	if response.StatusCode != 200 || string(body) != "GET /path auth=" {
+		t.Error("Expected the request forwarded without proxy credentials, got", response.StatusCode, string(body))
+	}
+
+	response, err = client.Get("http://localhost.test/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	response.Body.Close()
+	if response.StatusCode != 403 {
+		t.Error("Expected a host off the allow-list to be refused, got", response.StatusCode)
+	}
+}
@@ -0,0 +1,100 @@
+package httpmodule
+
+import (
+	"bytes"
+	"fmt"
+	neturl "net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Environment variable that makes AssertGolden rewrite golden files instead of comparing
+const updateGoldenEnv = "UPDATE_GOLDEN"
+
+// SnapshotRequest serializes req exactly as the client would send it, then
+// normalizes it for comparison: header lines are sorted, since their order on
+// the wire isn't stable, and secret headers are masked.
+func (client *HttpClient) SnapshotRequest(req *HttpRequest) ([]byte, error) {
+	if req.URL == "" {
+		return nil, fmt.Errorf("method and url cannot be empty")
+	}
+	parsedURL, err := neturl.Parse(req.URL)
+	if err != nil {
+		return nil, err
+	}
+
+	head := getBuffer()
+	defer putBuffer(head)
+	err = client.writeRequestHead(head, req.Method, parsedURL, int64(len(req.Body)), req.Headers)
+	if err != nil {
+		return nil, err
+	}
+
+	lines := strings.Split(strings.TrimSuffix(head.String(), "\r\n\r\n"), "\r\n")
+	return normalizeSnapshot(lines[0], lines[1:], req.Body), nil
+}
+
+// SnapshotResponse serializes response in the same normalized form
+func SnapshotResponse(response *HttpResponse) []byte {
+	statusLine := response.Protocol + " " + strconv.Itoa(response.StatusCode) + " " + response.Status
+	lines := make([]string, 0, len(response.Headers))
+	for k, v := range response.Headers {
+		lines = append(lines, k+": "+v)
+	}
+	return normalizeSnapshot(statusLine, lines, response.Body)
+}
+
+// normalizeSnapshot sorts and masks header lines and reassembles the message.
+// Line endings are plain LF so golden files stay readable and diffable.
+func normalizeSnapshot(firstLine string, headerLines []string, body string) []byte {
+	masked := make([]string, len(headerLines))
+	for i, line := range headerLines {
+		masked[i] = line
+		key, _, _ := strings.Cut(line, ":")
+		if isSecretHeader(strings.TrimSpace(key)) {
+			masked[i] = key + ": " + redactedValue
+		}
+	}
+	sort.Strings(masked)
+
+	var buf bytes.Buffer
+	buf.WriteString(firstLine)
+	buf.WriteByte('\n')
+	for _, line := range masked {
+		buf.WriteString(line)
+		buf.WriteByte('\n')
+	}
+	buf.WriteByte('\n')
+	buf.WriteString(body)
+	return buf.Bytes()
+}
+
+// AssertGolden compares got against the golden file at path and reports a
+// mismatch through t. Setting UPDATE_GOLDEN=1 in the environment writes got to
+// the file instead, creating directories as needed.
+func AssertGolden(t TestingT, path string, got []byte) {
+	t.Helper()
+
+	if os.Getenv(updateGoldenEnv) != "" {
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Errorf("golden: %v", err)
+			return
+		}
+		if err := os.WriteFile(path, got, 0o644); err != nil {
+			t.Errorf("golden: %v", err)
+		}
+		return
+	}
+
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Errorf("golden: %v (run with %s=1 to create it)", err, updateGoldenEnv)
+		return
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("golden: %s does not match\n--- want\n%s\n--- got\n%s", path, want, got)
+	}
+}
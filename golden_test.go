@@ -0,0 +1,33 @@
+package httpmodule
+
+import (
+	"testing"
+)
+
+// TestSnapshotRequest tests the wire form of a request against a golden file.
+func TestSnapshotRequest(t *testing.T) {
+	client := New()
+	client.DefaultHeaders["X-Client"] = "tests"
+	snapshot, err := client.SnapshotRequest(&HttpRequest{
+		Method:  "POST",
+		URL:     "https://api.example.com/v1/items",
+		Headers: map[string]string{"Authorization": "Bearer secret", "Content-Type": "application/json"},
+		Body:    `{"name":"widget"}`,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	AssertGolden(t, "testdata/golden/post_request.golden", snapshot)
+}
+
+// TestSnapshotResponse tests the normalized form of a response against a golden file.
+func TestSnapshotResponse(t *testing.T) {
+	response := &HttpResponse{
+		Protocol:   "HTTP/1.1",
+		StatusCode: 201,
+		Status:     "Created",
+		Headers:    map[string]string{"Set-Cookie": "session=secret", "Content-Type": "application/json", "Location": "/v1/items/7"},
+		Body:       `{"id":7}`,
+	}
+	AssertGolden(t, "testdata/golden/created_response.golden", SnapshotResponse(response))
+}
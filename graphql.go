@@ -0,0 +1,152 @@
+package httpmodule
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// GraphQLClient sends queries and mutations to a GraphQL endpoint using the
+// standard JSON envelope
+type GraphQLClient struct {
+	Client   *HttpClient
+	Endpoint string
+
+	// Headers sent with every operation, such as Authorization
+	Headers map[string]string
+
+	// Send only the SHA-256 hash of each query, as in Apollo's automatic
+	// persisted queries, and fall back to the full query when the server
+	// doesn't know the hash yet
+	PersistedQueries bool
+}
+
+// GraphQLError is one entry of the errors list in a GraphQL response
+type GraphQLError struct {
+	Message   string `json:"message"`
+	Locations []struct {
+		Line   int `json:"line"`
+		Column int `json:"column"`
+	} `json:"locations,omitempty"`
+	Path       []any          `json:"path,omitempty"`
+	Extensions map[string]any `json:"extensions,omitempty"`
+}
+
+// GraphQLErrors is returned when a response carries errors. Any data that came
+// with them has still been decoded.
+type GraphQLErrors []GraphQLError
+
+func (errs GraphQLErrors) Error() string {
+	messages := make([]string, len(errs))
+	for i, e := range errs {
+		messages[i] = e.Message
+	}
+	return "graphql: " + strings.Join(messages, "; ")
+}
+
+// NewGraphQLClient returns a GraphQL client posting to endpoint
+func NewGraphQLClient(client *HttpClient, endpoint string) *GraphQLClient {
+	return &GraphQLClient{Client: client, Endpoint: endpoint}
+}
+
+// Query runs a query and decodes its data into out, when not nil
+func (gql *GraphQLClient) Query(ctx context.Context, query string, variables map[string]any, out any) error {
+	return gql.execute(ctx, query, variables, out)
+}
+
+// Mutate runs a mutation and decodes its data into out, when not nil
+func (gql *GraphQLClient) Mutate(ctx context.Context, mutation string, variables map[string]any, out any) error {
+	return gql.execute(ctx, mutation, variables, out)
+}
+
+type graphQLRequest struct {
+	Query      string         `json:"query,omitempty"`
+	Variables  map[string]any `json:"variables,omitempty"`
+	Extensions map[string]any `json:"extensions,omitempty"`
+}
+
+type graphQLResponse struct {
+	Data   json.RawMessage `json:"data"`
+	Errors GraphQLErrors   `json:"errors"`
+}
+
+func (gql *GraphQLClient) execute(ctx context.Context, query string, variables map[string]any, out any) error {
+	envelope := graphQLRequest{Query: query, Variables: variables}
+	if gql.PersistedQueries {
+		hash := sha256.Sum256([]byte(query))
+		envelope.Query = ""
+		envelope.Extensions = map[string]any{
+			"persistedQuery": map[string]any{"version": 1, "sha256Hash": hex.EncodeToString(hash[:])},
+		}
+	}
+
+	result, err := gql.post(ctx, envelope)
+	if err != nil {
+		return err
+	}
+	if gql.PersistedQueries && isPersistedQueryNotFound(result.Errors) {
+		// Register the query under its hash by sending it in full once
+		envelope.Query = query
+		result, err = gql.post(ctx, envelope)
+		if err != nil {
+			return err
+		}
+	}
+
+	if out != nil && len(result.Data) > 0 && string(result.Data) != "null" {
+		if err := json.Unmarshal(result.Data, out); err != nil {
+			return fmt.Errorf("graphql: failed to decode data: %v", err)
+		}
+	}
+	if len(result.Errors) > 0 {
+		return result.Errors
+	}
+	return nil
+}
+
+// post sends one envelope and decodes the response
+func (gql *GraphQLClient) post(ctx context.Context, envelope graphQLRequest) (*graphQLResponse, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	body, err := json.Marshal(envelope)
+	if err != nil {
+		return nil, fmt.Errorf("graphql: failed to encode request: %v", err)
+	}
+	headers := map[string]string{"Content-Type": "application/json", "Accept": "application/json"}
+	for k, v := range gql.Headers {
+		headers[k] = v
+	}
+
+	response, err := gql.Client.do(&HttpRequest{Method: "POST", URL: gql.Endpoint, Headers: headers, Body: string(body)})
+	if err != nil {
+		return nil, err
+	}
+
+	// Servers may report errors with a 4xx status, so try the body first
+	var result graphQLResponse
+	decodeErr := json.Unmarshal([]byte(response.Body), &result)
+	if decodeErr == nil && (result.Data != nil || len(result.Errors) > 0) {
+		return &result, nil
+	}
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		return nil, fmt.Errorf("graphql: unexpected status %d %s", response.StatusCode, response.Status)
+	}
+	if decodeErr != nil {
+		return nil, fmt.Errorf("graphql: failed to decode response: %v", decodeErr)
+	}
+	return &result, nil
+}
+
+// isPersistedQueryNotFound reports whether the server asked for the full query
+func isPersistedQueryNotFound(errs GraphQLErrors) bool {
+	for _, e := range errs {
+		if e.Message == "PersistedQueryNotFound" || e.Extensions["code"] == "PERSISTED_QUERY_NOT_FOUND" {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,79 @@
+package httpmodule
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+// TestGraphQLQuery tests the request envelope and decoding of data and errors.
+func TestGraphQLQuery(t *testing.T) {
+	mock := NewMockTransport(t)
+	mock.On("POST", `/graphql$`).
+		Where(And(MatchHeader("Authorization", "Bearer t"), MatchJSON("variables.id", 7), MatchJSON("query", "query($id: Int!) { user(id: $id) { name } }"))).
+		Respond(200, `{"data":{"user":{"name":"alice"}}}`)
+	mock.On("POST", `/graphql$`).
+		Where(MatchJSON("query", "mutation { fail }")).
+		Respond(200, `{"data":{"fail":null},"errors":[{"message":"not allowed","path":["fail"]}]}`)
+	client := New()
+	client.Transport = mock
+	gql := NewGraphQLClient(client, "https://api.example.com/graphql")
+	gql.Headers = map[string]string{"Authorization": "Bearer t"}
+
+	var out struct{ User struct{ Name string } }
+	err := gql.Query(context.Background(), "query($id: Int!) { user(id: $id) { name } }", map[string]any{"id": 7}, &out)
+	if err != nil || out.User.Name != "alice" {
+		t.Error("Expected the decoded data.", out, err)
+	}
+
+	gql.Headers = nil
+	err = gql.Mutate(context.Background(), "mutation { fail }", nil, nil)
+	var errs GraphQLErrors
+	if !errors.As(err, &errs) || len(errs) != 1 || errs[0].Message != "not allowed" {
+		t.Error("Expected GraphQL errors, got", err)
+	}
+}
+
+// TestGraphQLPersistedQueries tests falling back to the full query for unknown hashes.
+func TestGraphQLPersistedQueries(t *testing.T) {
+	const hash = "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824"
+	mock := NewMockTransport(t)
+	mock.Strict = true
+	mock.On("POST", `/graphql$`).
+		Where(And(MatchJSON("extensions.persistedQuery.sha256Hash", hash), Not(MatchJSON("query", "hello")))).
+		Respond(200, `{"errors":[{"message":"PersistedQueryNotFound"}]}`).
+		Times(1)
+	mock.On("POST", `/graphql$`).
+		Where(And(MatchJSON("extensions.persistedQuery.sha256Hash", hash), MatchJSON("query", "hello"))).
+		Respond(200, `{"data":{"hello":"world"}}`).
+		Times(1)
+	client := New()
+	client.Transport = mock
+	gql := NewGraphQLClient(client, "https://api.example.com/graphql")
+	gql.PersistedQueries = true
+
+	var out map[string]string
+	if err := gql.Query(context.Background(), "hello", nil, &out); err != nil || out["hello"] != "world" {
+		t.Error("Expected the query to be registered and answered.", out, err)
+	}
+}
+
+// TestGraphQLStatus tests non-GraphQL error responses and cancelled contexts.
+func TestGraphQLStatus(t *testing.T) {
+	mock := NewMockTransport(t)
+	mock.On("POST", `/graphql$`).Respond(502, "bad gateway")
+	client := New()
+	client.Transport = mock
+	gql := NewGraphQLClient(client, "https://api.example.com/graphql")
+
+	if err := gql.Query(context.Background(), "{ a }", nil, nil); err == nil || !strings.Contains(err.Error(), "502") {
+		t.Error("Expected a status error, got", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := gql.Query(ctx, "{ a }", nil, nil); !errors.Is(err, context.Canceled) {
+		t.Error("Expected the cancellation error, got", err)
+	}
+}
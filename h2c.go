@@ -0,0 +1,212 @@
+package httpmodule
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/tls"
+	"encoding/base64"
+	"errors"
+	"io"
+	"net"
+	neturl "net/url"
+	"strings"
+	"time"
+)
+
+// The bytes every HTTP/2 connection starts with, from the client
+const http2Preface = "PRI * HTTP/2.0\r\n\r\nSM\r\n\r\n"
+
+// HTTP/2 frame types and flags needed to pass on an upgraded request
+const (
+	http2FrameHeaders      = 0x1
+	http2FrameSettings     = 0x4
+	http2FrameContinuation = 0x9
+
+	http2FlagEndStream  = 0x1
+	http2FlagEndHeaders = 0x4
+
+	// Largest frame payload a peer must accept before settings say otherwise
+	http2MaxFrameSize = 16384
+)
+
+// offersH2C reports whether conn may switch to h2c, HTTP/2 without TLS
+func (srv *Server) offersH2C(conn net.Conn) bool {
+	_, isTLS := conn.(*tls.Conn)
+	return !srv.DisableHTTP2 && !isTLS
+}
+
+// canServeH2C reports whether this build can serve h2c to the client on
+// conn, which asked for it, logging the first time it can't
+func (srv *Server) canServeH2C(conn net.Conn) bool {
+	if !h2cSupported {
+		srv.h2cWarning.Do(func() {
+			srv.logf("httpmodule: %s asked for h2c, which needs Go 1.24 or later; serving HTTP/1.1 only", conn.RemoteAddr())
+		})
+	}
+	return h2cSupported
+}
+
+// hasHTTP2Preface reports whether the client opened with the HTTP/2 preface,
+// having been told by other means that the server speaks h2c. Only as much as
+// matches the preface so far is waited for, so an HTTP/1 request shorter than
+// it is never held up.
+func hasHTTP2Preface(reader *bufio.Reader) bool {
+	for n := 1; n <= len(http2Preface); n++ {
+		peeked, err := reader.Peek(n)
+		if err != nil || peeked[n-1] != http2Preface[n-1] {
+			return false
+		}
+	}
+	return true
+}
+
+// wantsH2C reports whether req asks to switch to h2c with Upgrade, in a way
+// the server takes up. Requests with bodies stay on HTTP/1.1, as RFC 9113
+// allows, since the body would have to be sent on as HTTP/2 frames.
+func wantsH2C(req *ServerRequest) bool {
+	if req.Protocol != "HTTP/1.1" || req.Method == "CONNECT" ||
+		!headerContainsToken(req.Headers, "Upgrade", "h2c") ||
+		!headerContainsToken(req.Headers, "Connection", "Upgrade") ||
+		!headerContainsToken(req.Headers, "Connection", "HTTP2-Settings") {
+		return false
+	}
+	settings, ok := lookupHeader(req.Headers, "HTTP2-Settings")
+	if !ok || strings.Contains(settings, ",") {
+		return false
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(strings.TrimSpace(settings), "="))
+	if err != nil || len(payload)%6 != 0 {
+		return false
+	}
+	body := req.Body.(*serverBody)
+	return !body.chunked && body.remaining == 0
+}
+
+// upgradeH2C switches conn to h2c for req, which wantsH2C accepted. Its
+// response goes out on stream 1, so the request is passed to the HTTP/2
+// server as if the client had sent it there, just after its preface. The
+// settings in HTTP2-Settings are left for the SETTINGS frame the client must
+// send anyway.
+func (srv *Server) upgradeH2C(conn net.Conn, reader *bufio.Reader, writer *bufio.Writer, req *ServerRequest) {
+	writer.WriteString("HTTP/1.1 101 Switching Protocols\r\nConnection: Upgrade\r\nUpgrade: h2c\r\n\r\n")
+	if writer.Flush() != nil {
+		return
+	}
+	conn.SetWriteDeadline(time.Time{})
+	setReadDeadline(conn, srv.readHeaderTimeout())
+	start, err := readClientPreface(reader)
+	conn.SetReadDeadline(time.Time{})
+	if err != nil {
+		return
+	}
+	upgraded := io.MultiReader(bytes.NewReader(start), bytes.NewReader(http2RequestFrames(req)), reader)
+	srv.serveHTTP2(conn, upgraded)
+}
+
+// readClientPreface reads the preface and the SETTINGS frame that must follow
+// it, returning them as they were sent
+func readClientPreface(reader *bufio.Reader) ([]byte, error) {
+	start := make([]byte, len(http2Preface)+9)
+	if _, err := io.ReadFull(reader, start); err != nil {
+		return nil, err
+	}
+	frame := start[len(http2Preface):]
+	if string(start[:len(http2Preface)]) != http2Preface || frame[3] != http2FrameSettings {
+		return nil, errors.New("missing HTTP/2 client preface")
+	}
+	length := int(frame[0])<<16 | int(frame[1])<<8 | int(frame[2])
+	if length > http2MaxFrameSize {
+		return nil, errors.New("HTTP/2 SETTINGS frame too large")
+	}
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(reader, payload); err != nil {
+		return nil, err
+	}
+	return append(start, payload...), nil
+}
+
+// http2RequestFrames encodes req's head as HEADERS and CONTINUATION frames
+// on stream 1, ending the stream. Every field is sent as an HPACK literal
+// without indexing, which needs no dynamic table or Huffman coding.
+func http2RequestFrames(req *ServerRequest) []byte {
+	path := req.Target
+	if target, err := neturl.Parse(path); err == nil && target.IsAbs() {
+		path = target.RequestURI()
+	}
+	block := appendHPACKField(nil, ":method", req.Method)
+	block = appendHPACKField(block, ":scheme", "http")
+	block = appendHPACKField(block, ":authority", req.Host)
+	block = appendHPACKField(block, ":path", path)
+	for k, v := range req.Headers {
+		if strings.EqualFold(k, "Host") || strings.EqualFold(k, "HTTP2-Settings") ||
+			strings.EqualFold(k, "TE") && v != "trailers" || isConnectionSpecific(k) {
+			continue
+		}
+		for _, value := range strings.Split(v, "\n") {
+			block = appendHPACKField(block, strings.ToLower(k), value)
+		}
+	}
+
+	var frames []byte
+	frameType, flags := byte(http2FrameHeaders), byte(http2FlagEndStream)
+	for {
+		n := len(block)
+		if n > http2MaxFrameSize {
+			n = http2MaxFrameSize
+		}
+		if n == len(block) {
+			flags |= http2FlagEndHeaders
+		}
+		frames = append(frames, byte(n>>16), byte(n>>8), byte(n), frameType, flags, 0, 0, 0, 1)
+		frames = append(frames, block[:n]...)
+		block = block[n:]
+		if len(block) == 0 {
+			return frames
+		}
+		frameType, flags = http2FrameContinuation, 0
+	}
+}
+
+func isConnectionSpecific(name string) bool {
+	for _, header := range connectionSpecificHeaders {
+		if strings.EqualFold(name, header) {
+			return true
+		}
+	}
+	return false
+}
+
+// appendHPACKField appends a literal header field without indexing, with a
+// new name
+func appendHPACKField(b []byte, name, value string) []byte {
+	b = append(b, 0)
+	b = appendHPACKInt(b, len(name))
+	b = append(b, name...)
+	b = appendHPACKInt(b, len(value))
+	return append(b, value...)
+}
+
+// appendHPACKInt appends n with a 7-bit prefix, as string lengths are
+// encoded when Huffman coding isn't used
+func appendHPACKInt(b []byte, n int) []byte {
+	const limit = 1<<7 - 1
+	if n < limit {
+		return append(b, byte(n))
+	}
+	b = append(b, limit)
+	for n -= limit; n >= 0x80; n >>= 7 {
+		b = append(b, byte(n)|0x80)
+	}
+	return append(b, byte(n))
+}
+
+// readerConn is a connection whose reads come from reader, which holds what
+// was read from it before it changed hands
+type readerConn struct {
+	net.Conn
+	reader io.Reader
+}
+
+func (c *readerConn) Read(p []byte) (int, error) {
+	return c.reader.Read(p)
+}
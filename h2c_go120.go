@@ -0,0 +1,11 @@
+//go:build !go1.24
+
+package httpmodule
+
+import "net/http"
+
+// Before Go 1.24 the standard library only serves HTTP/2 over TLS, so
+// cleartext connections stay on HTTP/1.1
+const h2cSupported = false
+
+func allowH2C(h2 *http.Server) {}
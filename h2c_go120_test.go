@@ -0,0 +1,10 @@
+//go:build !go1.24
+
+package httpmodule
+
+import "net/http"
+
+// h2cClient is never called before Go 1.24, as the tests that need it skip.
+func h2cClient() *http.Client {
+	return nil
+}
@@ -0,0 +1,16 @@
+//go:build go1.24
+
+package httpmodule
+
+import "net/http"
+
+// The standard library serves HTTP/2 without TLS from Go 1.24
+const h2cSupported = true
+
+// allowH2C lets h2 take connections that open with the HTTP/2 preface in the
+// clear, as well as TLS ones that negotiated h2
+func allowH2C(h2 *http.Server) {
+	h2.Protocols = new(http.Protocols)
+	h2.Protocols.SetHTTP2(true)
+	h2.Protocols.SetUnencryptedHTTP2(true)
+}
@@ -0,0 +1,13 @@
+//go:build go1.24
+
+package httpmodule
+
+import "net/http"
+
+// h2cClient returns a standard library client that speaks HTTP/2 in the
+// clear from the start, with prior knowledge.
+func h2cClient() *http.Client {
+	protocols := new(http.Protocols)
+	protocols.SetUnencryptedHTTP2(true)
+	return &http.Client{Transport: &http.Transport{Protocols: protocols}}
+}
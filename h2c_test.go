@@ -0,0 +1,177 @@
+package httpmodule
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestServeH2CPriorKnowledge tests serving clients that open with the HTTP/2 preface.
+func TestServeH2CPriorKnowledge(t *testing.T) {
+	if !h2cSupported {
+		t.Skip("serving h2c needs Go 1.24 or later")
+	}
+	_, addr := startServer(t, HandlerFunc(func(w ResponseWriter, req *ServerRequest) {
+		body, _ := io.ReadAll(req.Body)
+		w.Header()["X-Seen"] = req.Protocol + " " + req.Method + " " + req.Path + " " + req.Headers["X-Test"]
+		w.Write(body)
+	}))
+
+	client := h2cClient()
+	defer client.CloseIdleConnections()
+	for i := 0; i < 2; i++ {
+		req, _ := http.NewRequest("POST", "http://"+addr+"/echo", strings.NewReader("hello"))
+		req.Header.Set("X-Test", "yes")
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if resp.Proto != "HTTP/2.0" || string(body) != "hello" || resp.Header.Get("X-Seen") != "HTTP/2.0 POST /echo yes" {
+			t.Error("Expected the request served over h2c, got", resp.Proto, string(body), resp.Header.Get("X-Seen"))
+		}
+	}
+
+	// HTTP/1.1 clients on the same listener are unaffected
+	if response := rawExchange(t, addr, "GET /echo HTTP/1.1\r\nHost: x\r\nConnection: close\r\n\r\n"); !strings.HasPrefix(response, "HTTP/1.1 200 OK\r\n") {
+		t.Error("Expected an HTTP/1.1 response, got", response)
+	}
+}
+
+// TestServeH2CUpgrade tests switching to h2c with Upgrade and answering the request on stream 1.
+func TestServeH2CUpgrade(t *testing.T) {
+	if !h2cSupported {
+		t.Skip("serving h2c needs Go 1.24 or later")
+	}
+	seen := make(chan string, 1)
+	_, addr := startServer(t, HandlerFunc(func(w ResponseWriter, req *ServerRequest) {
+		seen <- req.Protocol + " " + req.Method + " " + req.Target + " " + req.Host + " " + req.Headers["X-Test"]
+		w.Write([]byte("upgraded"))
+	}))
+
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	conn.Write([]byte("GET /path?q=1 HTTP/1.1\r\nHost: example.com\r\nX-Test: yes\r\n" +
+		"Connection: Upgrade, HTTP2-Settings\r\nUpgrade: h2c\r\nHTTP2-Settings: AAMAAABkAAQAAP__\r\n\r\n"))
+	reader := bufio.NewReader(conn)
+	status, _ := reader.ReadString('\n')
+	if status != "HTTP/1.1 101 Switching Protocols\r\n" {
+		t.Fatalf("Expected 101, got %q", status)
+	}
+	for {
+		if line, err := reader.ReadString('\n'); err != nil || line == "\r\n" {
+			break
+		}
+	}
+
+	conn.Write([]byte(http2Preface + "\x00\x00\x00\x04\x00\x00\x00\x00\x00"))
+	if got := <-seen; got != "HTTP/2.0 GET /path?q=1 example.com yes" {
+		t.Errorf("Expected the upgraded request served as HTTP/2, got %q", got)
+	}
+	var headers bool
+	var body []byte
+	for {
+		head := make([]byte, 9)
+		if _, err := io.ReadFull(reader, head); err != nil {
+			t.Fatal(err)
+		}
+		payload := make([]byte, int(head[0])<<16|int(head[1])<<8|int(head[2]))
+		if _, err := io.ReadFull(reader, payload); err != nil {
+			t.Fatal(err)
+		}
+		if binary.BigEndian.Uint32(head[5:])&0x7fffffff != 1 {
+			continue
+		}
+		switch head[3] {
+		case http2FrameHeaders:
+			headers = true
+		case 0x0:
+			body = append(body, payload...)
+		}
+		if head[4]&http2FlagEndStream != 0 {
+			break
+		}
+	}
+	if !headers || string(body) != "upgraded" {
+		t.Errorf("Expected the response on stream 1, got headers=%v body=%q", headers, body)
+	}
+}
+
+// TestServeH2CDeclined tests staying on HTTP/1.1 when h2c is disabled or the request has a body.
+func TestServeH2CDeclined(t *testing.T) {
+	handler := HandlerFunc(func(w ResponseWriter, req *ServerRequest) {
+		body, _ := io.ReadAll(req.Body)
+		w.Write([]byte(req.Protocol + " " + string(body)))
+	})
+	upgrade := "Connection: Upgrade, HTTP2-Settings, close\r\nUpgrade: h2c\r\nHTTP2-Settings: \r\n"
+
+	_, addr := startServer(t, handler)
+	response := rawExchange(t, addr, "POST / HTTP/1.1\r\nHost: x\r\nContent-Length: 4\r\n"+upgrade+"\r\nbody")
+	if !strings.HasPrefix(response, "HTTP/1.1 200 OK\r\n") || !strings.HasSuffix(response, "HTTP/1.1 body") {
+		t.Error("Expected a request with a body to stay on HTTP/1.1, got", response)
+	}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := &Server{DisableHTTP2: true, Handler: handler}
+	go srv.Serve(listener)
+	defer srv.Close()
+	response = rawExchange(t, listener.Addr().String(), "GET / HTTP/1.1\r\nHost: x\r\n"+upgrade+"\r\n")
+	if !strings.HasPrefix(response, "HTTP/1.1 200 OK\r\n") {
+		t.Error("Expected Upgrade to be ignored with DisableHTTP2, got", response)
+	}
+
+	if !h2cSupported {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, "GET", "http://"+listener.Addr().String()+"/", nil)
+	if resp, err := h2cClient().Do(req); err == nil {
+		resp.Body.Close()
+		t.Error("Expected the HTTP/2 preface to be refused with DisableHTTP2, got", resp.Proto)
+	}
+}
+
+// TestServeH2CUnsupported tests answering h2c requests with HTTP/1.1, logged
+// once, when the server is built with a Go that can't serve h2c.
+func TestServeH2CUnsupported(t *testing.T) {
+	if h2cSupported {
+		t.Skip("h2c is served with Go 1.24 or later")
+	}
+	var logged strings.Builder
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := &Server{ErrorLog: log.New(&logged, "", 0), Handler: HandlerFunc(func(w ResponseWriter, req *ServerRequest) {
+		w.Write([]byte(req.Protocol))
+	})}
+	go srv.Serve(listener)
+	defer srv.Close()
+
+	upgrade := "GET / HTTP/1.1\r\nHost: x\r\nConnection: Upgrade, HTTP2-Settings, close\r\nUpgrade: h2c\r\nHTTP2-Settings: \r\n\r\n"
+	for i := 0; i < 2; i++ {
+		if response := rawExchange(t, listener.Addr().String(), upgrade); !strings.HasSuffix(response, "\r\n\r\nHTTP/1.1") {
+			t.Error("Expected the request served over HTTP/1.1, got", response)
+		}
+	}
+	srv.Close()
+	if n := strings.Count(logged.String(), "needs Go 1.24"); n != 1 {
+		t.Errorf("Expected h2c being unavailable logged once, got %q", logged.String())
+	}
+}
@@ -0,0 +1,355 @@
+package httpmodule
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	neturl "net/url"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// HAR is an HTTP Archive 1.2 document, the format browsers export captured
+// sessions in
+type HAR struct {
+	Log HARLog `json:"log"`
+}
+
+type HARLog struct {
+	Version string     `json:"version"`
+	Creator HARCreator `json:"creator"`
+	Entries []HAREntry `json:"entries"`
+}
+
+type HARCreator struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+type HAREntry struct {
+	StartedDateTime time.Time   `json:"startedDateTime"`
+	Time            float64     `json:"time"`
+	Request         HARRequest  `json:"request"`
+	Response        HARResponse `json:"response"`
+	Cache           struct{}    `json:"cache"`
+	Timings         HARTimings  `json:"timings"`
+}
+
+type HARRequest struct {
+	Method      string         `json:"method"`
+	URL         string         `json:"url"`
+	HTTPVersion string         `json:"httpVersion"`
+	Cookies     []HARNameValue `json:"cookies"`
+	Headers     []HARNameValue `json:"headers"`
+	QueryString []HARNameValue `json:"queryString"`
+	PostData    *HARPostData   `json:"postData,omitempty"`
+	HeadersSize int            `json:"headersSize"`
+	BodySize    int            `json:"bodySize"`
+}
+
+type HARResponse struct {
+	Status      int            `json:"status"`
+	StatusText  string         `json:"statusText"`
+	HTTPVersion string         `json:"httpVersion"`
+	Cookies     []HARNameValue `json:"cookies"`
+	Headers     []HARNameValue `json:"headers"`
+	Content     HARContent     `json:"content"`
+	RedirectURL string         `json:"redirectURL"`
+	HeadersSize int            `json:"headersSize"`
+	BodySize    int            `json:"bodySize"`
+}
+
+type HARNameValue struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type HARPostData struct {
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text"`
+}
+
+type HARContent struct {
+	Size     int    `json:"size"`
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text,omitempty"`
+	Encoding string `json:"encoding,omitempty"`
+}
+
+// HARTimings are in milliseconds; -1 marks a phase that wasn't measured
+type HARTimings struct {
+	Blocked float64 `json:"blocked"`
+	DNS     float64 `json:"dns"`
+	Connect float64 `json:"connect"`
+	Send    float64 `json:"send"`
+	Wait    float64 `json:"wait"`
+	Receive float64 `json:"receive"`
+	SSL     float64 `json:"ssl"`
+}
+
+// HARRecorder is a Transport decorator that records every exchange passing
+// through it as a HAR entry. Wait time runs until the response headers arrive
+// and receive time covers reading the body, which the recorder does in full.
+// Exchanges that went over the network carry their traced DNS, connect, TLS,
+// send, and wait times too.
+type HARRecorder struct {
+	Next Transport
+
+	// Source of time for timestamps and timings; nil uses the real clock
+	Clock Clock
+
+	// Replace the values of secret headers, such as Authorization and
+	// cookies, as the VCR recorder does, so the archive can be shared safely.
+	// Requests read back from it then lack those values.
+	MaskSecrets bool
+
+	mu      sync.Mutex
+	entries []HAREntry
+}
+
+// NewHARRecorder returns a recorder forwarding requests to next
+func NewHARRecorder(next Transport) *HARRecorder {
+	return &HARRecorder{Next: next}
+}
+
+func (recorder *HARRecorder) RoundTrip(req *HttpRequest) (*HttpResponse, error) {
+	clock := clockOrReal(recorder.Clock)
+	started := clock.Now()
+	response, err := recorder.Next.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	headersIn := clock.Now()
+	if _, err := response.ReadBody(); err != nil {
+		return nil, err
+	}
+	done := clock.Now()
+
+	entry := HAREntry{
+		StartedDateTime: started,
+		Time:            milliseconds(done.Sub(started)),
+		Request:         harRequest(req),
+		Response:        harResponse(response),
+		Timings: HARTimings{
+			Blocked: -1,
+			DNS:     -1,
+			Connect: -1,
+			SSL:     -1,
+			Wait:    milliseconds(headersIn.Sub(started)),
+			Receive: milliseconds(done.Sub(headersIn)),
+		},
+	}
+	if timings := response.Timings; timings.TimeToFirstByte > 0 {
+		// Sent over the network, so the connection's phases were traced;
+		// they don't apply to a reused connection
+		entry.Timings.Wait = milliseconds(timings.Wait)
+		entry.Timings.Send = milliseconds(timings.TimeToFirstByte - timings.DNS - timings.Connect - timings.TLSHandshake - timings.Wait)
+		if entry.Timings.Send < 0 {
+			entry.Timings.Send = 0
+		}
+		if !timings.Reused {
+			entry.Timings.DNS = milliseconds(timings.DNS)
+			// HAR counts the TLS handshake as part of connecting
+			entry.Timings.Connect = milliseconds(timings.Connect + timings.TLSHandshake)
+			if timings.TLSHandshake > 0 {
+				entry.Timings.SSL = milliseconds(timings.TLSHandshake)
+			}
+		}
+	}
+	if response.Protocol != "" {
+		entry.Request.HTTPVersion = response.Protocol
+	}
+	if recorder.MaskSecrets {
+		maskHARHeaders(entry.Request.Headers)
+		maskHARHeaders(entry.Response.Headers)
+	}
+	recorder.mu.Lock()
+	recorder.entries = append(recorder.entries, entry)
+	recorder.mu.Unlock()
+	return response, nil
+}
+
+// HAR returns the exchanges recorded so far
+func (recorder *HARRecorder) HAR() *HAR {
+	recorder.mu.Lock()
+	defer recorder.mu.Unlock()
+	return &HAR{Log: HARLog{
+		Version: "1.2",
+		Creator: HARCreator{Name: "httpmodule", Version: "1.0"},
+		Entries: append([]HAREntry{}, recorder.entries...),
+	}}
+}
+
+// Save writes the recorded exchanges to a HAR file at path
+func (recorder *HARRecorder) Save(path string) error {
+	data, err := json.MarshalIndent(recorder.HAR(), "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0o644)
+}
+
+func milliseconds(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+func harRequest(req *HttpRequest) HARRequest {
+	converted := HARRequest{
+		Method:      req.Method,
+		URL:         req.URL,
+		HTTPVersion: "HTTP/1.1",
+		Cookies:     []HARNameValue{},
+		Headers:     harHeaders(req.Headers),
+		QueryString: []HARNameValue{},
+		HeadersSize: -1,
+		BodySize:    len(req.Body),
+	}
+	if parsedURL, err := neturl.Parse(req.URL); err == nil {
+		for key, values := range parsedURL.Query() {
+			for _, v := range values {
+				converted.QueryString = append(converted.QueryString, HARNameValue{key, v})
+			}
+		}
+		sort.Slice(converted.QueryString, func(i, j int) bool {
+			return converted.QueryString[i].Name < converted.QueryString[j].Name
+		})
+	}
+	if req.Body != "" {
+		converted.PostData = &HARPostData{MimeType: headerValue(req.Headers, "Content-Type"), Text: req.Body}
+	}
+	return converted
+}
+
+func harResponse(response *HttpResponse) HARResponse {
+	return HARResponse{
+		Status:      response.StatusCode,
+		StatusText:  response.Status,
+		HTTPVersion: response.Protocol,
+		Cookies:     []HARNameValue{},
+		Headers:     harHeaders(response.Headers),
+		Content: HARContent{
+			Size:     len(response.Body),
+			MimeType: headerValue(response.Headers, "Content-Type"),
+			Text:     response.Body,
+		},
+		RedirectURL: headerValue(response.Headers, "Location"),
+		HeadersSize: -1,
+		BodySize:    len(response.Body),
+	}
+}
+
+// maskHARHeaders replaces the values of secret headers in place
+func maskHARHeaders(headers []HARNameValue) {
+	for i, header := range headers {
+		if isSecretHeader(header.Name) {
+			headers[i].Value = redactedValue
+		}
+	}
+}
+
+// harHeaders converts headers to a list sorted by name
+func harHeaders(headers map[string]string) []HARNameValue {
+	list := make([]HARNameValue, 0, len(headers))
+	for k, v := range headers {
+		list = append(list, HARNameValue{k, v})
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list
+}
+
+// headerValue looks key up in headers, ignoring case
+func headerValue(headers map[string]string, key string) string {
+	v, _ := lookupHeader(headers, key)
+	return v
+}
+
+// lookupHeader looks key up in headers, ignoring case, and reports whether
+// it is there at all
+func lookupHeader(headers map[string]string, key string) (string, bool) {
+	if v, ok := headers[key]; ok {
+		return v, true
+	}
+	for k, v := range headers {
+		if strings.EqualFold(k, key) {
+			return v, true
+		}
+	}
+	return "", false
+}
+
+// ReadHAR decodes a HAR document, such as one exported from a browser
+func ReadHAR(r io.Reader) (*HAR, error) {
+	var har HAR
+	if err := json.NewDecoder(r).Decode(&har); err != nil {
+		return nil, fmt.Errorf("failed to parse HAR: %v", err)
+	}
+	return &har, nil
+}
+
+// LoadHAR reads the HAR file at path
+func LoadHAR(path string) (*HAR, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ReadHAR(f)
+}
+
+// Requests returns the archived requests ready to be sent again. Headers the
+// client sets itself, and the pseudo-headers of HTTP/2 captures, are dropped.
+func (har *HAR) Requests() []*HttpRequest {
+	requests := make([]*HttpRequest, 0, len(har.Log.Entries))
+	for _, entry := range har.Log.Entries {
+		req := &HttpRequest{
+			Method:  entry.Request.Method,
+			URL:     entry.Request.URL,
+			Headers: make(map[string]string, len(entry.Request.Headers)),
+		}
+		for _, header := range entry.Request.Headers {
+			if strings.HasPrefix(header.Name, ":") || strings.EqualFold(header.Name, "Content-Length") || strings.EqualFold(header.Name, "Host") {
+				continue
+			}
+			if existing, ok := req.Headers[header.Name]; ok {
+				req.Headers[header.Name] = existing + ", " + header.Value
+			} else {
+				req.Headers[header.Name] = header.Value
+			}
+		}
+		if entry.Request.PostData != nil {
+			req.Body = entry.Request.PostData.Text
+		}
+		requests = append(requests, req)
+	}
+	return requests
+}
+
+// Responses returns the archived responses, in the same order as Requests
+func (har *HAR) Responses() ([]*HttpResponse, error) {
+	responses := make([]*HttpResponse, 0, len(har.Log.Entries))
+	for _, entry := range har.Log.Entries {
+		response := &HttpResponse{
+			Protocol:   entry.Response.HTTPVersion,
+			StatusCode: entry.Response.Status,
+			Status:     entry.Response.StatusText,
+			Headers:    make(map[string]string, len(entry.Response.Headers)),
+			Body:       entry.Response.Content.Text,
+		}
+		for _, header := range entry.Response.Headers {
+			response.Headers[header.Name] = header.Value
+		}
+		if entry.Response.Content.Encoding == "base64" {
+			body, err := base64.StdEncoding.DecodeString(response.Body)
+			if err != nil {
+				return nil, fmt.Errorf("failed to decode HAR content for %s: %v", entry.Request.URL, err)
+			}
+			response.Body = string(body)
+		}
+		responses = append(responses, response)
+	}
+	return responses, nil
+}
@@ -0,0 +1,123 @@
+package httpmodule
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// TestHARRecorder tests recording exchanges with timings and reading them back.
+func TestHARRecorder(t *testing.T) {
+	clock := NewFakeClock(time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC))
+	recorder := NewHARRecorder(RoundTripFunc(func(req *HttpRequest) (*HttpResponse, error) {
+		clock.Advance(40 * time.Millisecond)
+		return &HttpResponse{
+			Protocol:   "HTTP/1.1",
+			StatusCode: 201,
+			Status:     "Created",
+			Headers:    map[string]string{"Content-Type": "text/plain"},
+			Body:       "made",
+		}, nil
+	}))
+	recorder.Clock = clock
+	client := New()
+	client.Transport = recorder
+
+	if _, err := client.Post("https://example.com/items?tag=a&tag=b", "new item", map[string]string{"Content-Type": "text/plain"}); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "session.har")
+	if err := recorder.Save(path); err != nil {
+		t.Fatal(err)
+	}
+
+	har, err := LoadHAR(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if har.Log.Version != "1.2" || len(har.Log.Entries) != 1 {
+		t.Fatal("Expected one HAR 1.2 entry.", har.Log)
+	}
+	entry := har.Log.Entries[0]
+	if entry.Time != 40 || entry.Timings.Wait != 40 || entry.Timings.DNS != -1 {
+		t.Error("Expected the measured timings.", entry.Time, entry.Timings)
+	}
+	if !entry.StartedDateTime.Equal(time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)) {
+		t.Error("Expected the start time, got", entry.StartedDateTime)
+	}
+	if len(entry.Request.QueryString) != 2 || entry.Request.PostData == nil || entry.Request.PostData.MimeType != "text/plain" {
+		t.Error("Expected query and post data.", entry.Request)
+	}
+	if entry.Response.Status != 201 || entry.Response.Content.Text != "made" {
+		t.Error("Expected the response.", entry.Response)
+	}
+
+	requests := har.Requests()
+	if len(requests) != 1 || requests[0].Method != "POST" || requests[0].Body != "new item" {
+		t.Error("Expected the request to be reproducible.", requests)
+	}
+}
+
+// TestHARImport tests loading a browser-captured HAR.
+func TestHARImport(t *testing.T) {
+	har, err := LoadHAR("testdata/har/browser.har")
+	if err != nil {
+		t.Fatal(err)
+	}
+	requests := har.Requests()
+	if len(requests) != 1 {
+		t.Fatal("Expected one request, got", len(requests))
+	}
+	req := requests[0]
+	if req.URL != "https://api.example.com/v1/search?q=go" || req.Body != `{"page":1}` {
+		t.Error("Expected URL and body.", req.URL, req.Body)
+	}
+	if _, ok := req.Headers[":authority"]; ok {
+		t.Error("Expected pseudo-headers to be dropped.")
+	}
+	if _, ok := req.Headers["content-length"]; ok {
+		t.Error("Expected Content-Length to be dropped.")
+	}
+	if req.Headers["accept"] != "application/json" {
+		t.Error("Expected ordinary headers to be kept.", req.Headers)
+	}
+
+	responses, err := har.Responses()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if responses[0].Body != `{"ok":1}` {
+		t.Error("Expected the base64 content to be decoded, got", responses[0].Body)
+	}
+}
+
+// TestHARRecorderTimings tests recording the traced phases of network exchanges.
+func TestHARRecorderTimings(t *testing.T) {
+	ts := NewTLSTestServer(HandlerFunc(func(w ResponseWriter, req *ServerRequest) {
+		w.Write([]byte("ok"))
+	}))
+	defer ts.Close()
+	client := ts.Client()
+	recorder := NewHARRecorder(client.NetworkTransport())
+	client.Transport = recorder
+
+	for i := 0; i < 2; i++ {
+		if _, err := client.Get(ts.URL+"/", nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	entries := recorder.HAR().Log.Entries
+	if len(entries) != 2 {
+		t.Fatal("Expected two entries, got", len(entries))
+	}
+	first, second := entries[0].Timings, entries[1].Timings
+	if first.DNS < 0 || first.Connect <= 0 || first.SSL <= 0 || first.SSL > first.Connect || first.Wait <= 0 || first.Send < 0 {
+		t.Error("Expected the phases of a new connection, got", first)
+	}
+	if second.DNS != -1 || second.Connect != -1 || second.SSL != -1 || second.Wait <= 0 {
+		t.Error("Expected only the wait on a reused connection, got", second)
+	}
+	if entries[0].Request.HTTPVersion != "HTTP/1.1" {
+		t.Error("Expected the protocol used, got", entries[0].Request.HTTPVersion)
+	}
+}
@@ -0,0 +1,100 @@
+package httpmodule
+
+import (
+	"net/textproto"
+	"strings"
+)
+
+// Header holds header fields by canonical name, such as "Content-Type", with
+// every value each was sent with, in order
+type Header map[string][]string
+
+// Get returns the first value of key, in any case, or "" when it is absent
+func (h Header) Get(key string) string {
+	if values := h[textproto.CanonicalMIMEHeaderKey(key)]; len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
+
+// Values returns every value of key, in any case
+func (h Header) Values(key string) []string {
+	return h[textproto.CanonicalMIMEHeaderKey(key)]
+}
+
+// Has reports whether key, in any case, is present
+func (h Header) Has(key string) bool {
+	_, ok := h[textproto.CanonicalMIMEHeaderKey(key)]
+	return ok
+}
+
+// Add appends value to those of key
+func (h Header) Add(key, value string) {
+	key = textproto.CanonicalMIMEHeaderKey(key)
+	h[key] = append(h[key], value)
+}
+
+// Set replaces the values of key with value
+func (h Header) Set(key, value string) {
+	h[textproto.CanonicalMIMEHeaderKey(key)] = []string{value}
+}
+
+// Del removes key
+func (h Header) Del(key string) {
+	delete(h, textproto.CanonicalMIMEHeaderKey(key))
+}
+
+// hasToken reports whether token is among the comma-separated values of key,
+// ignoring case
+func (h Header) hasToken(key, token string) bool {
+	for _, value := range h.Values(key) {
+		for _, part := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(part), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Header returns the response's headers with every value they were received
+// with, looked up in any case. Headers is the same set of fields as it was
+// before Header existed, keeping only the last of a repeated field, so a
+// response setting several cookies has them all only here. Changes made to
+// Headers, such as by middleware, show up here; a Set-Cookie value set there
+// may hold several cookies, one per line, as in a ResponseWriter.
+//
+// The Header is built anew on each call, so it is a read-only copy: changes
+// made to it are lost, and Headers is where to change the response.
+func (response *HttpResponse) Header() Header {
+	h := make(Header, len(response.Headers))
+	// Fields still as they were received keep all their values
+	kept := make(map[string]bool)
+	for k, v := range response.Headers {
+		key := textproto.CanonicalMIMEHeaderKey(k)
+		if values, ok := response.header[key]; ok && rendersAs(values, v) {
+			h[key] = values
+			kept[key] = true
+		}
+	}
+	for k, v := range response.Headers {
+		key := textproto.CanonicalMIMEHeaderKey(k)
+		switch {
+		case kept[key]:
+		case key == "Set-Cookie":
+			h[key] = append(h[key], strings.Split(v, "\n")...)
+		default:
+			h[key] = append(h[key], v)
+		}
+	}
+	return h
+}
+
+// rendersAs reports whether v is how values appear in a single-valued map:
+// the last of them, or all of them joined by commas or newlines
+func rendersAs(values []string, v string) bool {
+	if len(values) == 0 {
+		return false
+	}
+	return values[len(values)-1] == v || strings.Join(values, "\n") == v || strings.Join(values, ", ") == v
+}
@@ -0,0 +1,119 @@
+package httpmodule
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// TestHeader tests case-insensitive lookups of repeated fields in a response.
+func TestHeader(t *testing.T) {
+	raw := "HTTP/1.1 200 OK\r\ncontent-type: text/plain\r\nVary: Accept\r\nvary: Cookie\r\n" +
+		"Set-Cookie: a=1; Expires=Wed, 21 Oct 2026 07:28:00 GMT\r\nSet-Cookie: b=2\r\nContent-Length: 0\r\n\r\n"
+	response, _, err := readResponseHead(bufio.NewReader(strings.NewReader(raw)), "GET", ParseOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	header := response.Header()
+	if header.Get("Content-Type") != "text/plain" || !header.Has("CONTENT-TYPE") || header.Has("X-Missing") {
+		t.Error("Expected lookups in any case, got", header)
+	}
+	if values := header.Values("vary"); !reflect.DeepEqual(values, []string{"Accept", "Cookie"}) {
+		t.Error("Expected both Vary values, got", values)
+	}
+	if values := header.Values("Set-Cookie"); len(values) != 2 || values[1] != "b=2" {
+		t.Error("Expected each cookie apart, got", values)
+	}
+	// Headers keeps the last of a repeated field, cookies included, as it
+	// always has
+	if response.Headers["content-type"] != "text/plain" || response.Headers["Set-Cookie"] != "b=2" {
+		t.Error("Expected Headers to be unchanged, got", response.Headers)
+	}
+
+	// Changes to Headers replace what was received
+	delete(response.Headers, "content-type")
+	response.Headers["Set-Cookie"] = "c=3"
+	header = response.Header()
+	if header.Has("Content-Type") || !reflect.DeepEqual(header.Values("Set-Cookie"), []string{"c=3"}) || len(header.Values("Vary")) != 2 {
+		t.Error("Expected Header to follow Headers, got", header)
+	}
+
+	// Responses not read off the wire work too
+	built := &HttpResponse{Headers: map[string]string{"x-id": "7", "Set-Cookie": "a=1\nb=2"}}
+	if built.Header().Get("X-Id") != "7" || len(built.Header().Values("set-cookie")) != 2 {
+		t.Error("Expected Header from Headers, got", built.Header())
+	}
+	converted, err := FromHTTPResponse(&http.Response{StatusCode: 200, Header: http.Header{"Vary": {"Accept", "Cookie"}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if values := converted.Header().Values("Vary"); len(values) != 2 {
+		t.Error("Expected values kept apart from net/http, got", values)
+	}
+}
+
+// TestHeaderFraming tests that responses are framed, kept alive, and decoded by
+// headers sent in lowercase.
+func TestHeaderFraming(t *testing.T) {
+	var gzipped bytes.Buffer
+	zw := gzip.NewWriter(&gzipped)
+	zw.Write([]byte("decoded"))
+	zw.Close()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	var accepted atomic.Int32
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			accepted.Add(1)
+			go func() {
+				defer conn.Close()
+				reader := bufio.NewReader(conn)
+				for {
+					req, err := http.ReadRequest(reader)
+					if err != nil {
+						return
+					}
+					if req.URL.Path == "/gzip" {
+						io.WriteString(conn, "HTTP/1.1 200 OK\r\ncontent-encoding: gzip\r\ncontent-length: "+strconv.Itoa(gzipped.Len())+"\r\n\r\n"+gzipped.String())
+						continue
+					}
+					io.WriteString(conn, "HTTP/1.1 200 OK\r\ncontent-length: 2\r\nconnection: keep-alive\r\n\r\nok")
+				}
+			}()
+		}
+	}()
+
+	client := New()
+	client.Timeout = 2 * time.Second
+	for i := 0; i < 2; i++ {
+		if response, err := client.Get("http://"+listener.Addr().String()+"/", nil); err != nil || response.Body != "ok" {
+			t.Fatal("Expected the body framed by content-length, got", response, err)
+		}
+	}
+	if n := accepted.Load(); n != 1 {
+		t.Error("Expected the connection to be reused, got", n, "connections")
+	}
+
+	client.NetHTTPCompatible = true
+	response, err := client.Get("http://"+listener.Addr().String()+"/gzip", nil)
+	if err != nil || response.Body != "decoded" || response.Header().Has("Content-Encoding") || response.Header().Has("Content-Length") {
+		t.Error("Expected the gzip body decoded, got", response, err)
+	}
+}
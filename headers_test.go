@@ -0,0 +1,87 @@
+package httpmodule
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// referenceReadHeaders is the original ReadString/SplitN/TrimSpace header
+// parser, kept to check that readHeaders behaves exactly the same.
+func referenceReadHeaders(reader *bufio.Reader) (map[string]string, error) {
+	headers := make(map[string]string)
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil && err != io.EOF {
+			return nil, errors.New("failed to read header line")
+		}
+		if line == "\r\n" || err == io.EOF {
+			break
+		}
+		if !strings.HasSuffix(line, "\r\n") {
+			return nil, errors.New("malformed header line: missing CR LF at the end")
+		}
+		parts := strings.SplitN(strings.TrimSpace(line), ":", 2)
+		if len(parts) != 2 {
+			return nil, errors.New("malformed header line: " + line)
+		}
+		headers[strings.TrimSpace(parts[0])] = strings.TrimSpace(parts[1])
+	}
+	return headers, nil
+}
+
+// TestReadHeaders tests parsing a typical header block.
+func TestReadHeaders(t *testing.T) {
+	raw := "Content-Type: text/html\r\nX-Custom:  padded value \r\nEmpty:\r\n\r\nbody"
+	reader := bufio.NewReader(strings.NewReader(raw))
+	budget := defaultMaxHeaderBytes
+	headers, err := readHeaders(reader, false, &budget, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]string{"Content-Type": "text/html", "X-Custom": "padded value", "Empty": ""}
+	if !reflect.DeepEqual(headers, expected) {
+		t.Errorf("Expected %v, got %v.", expected, headers)
+	}
+	if rest, _ := io.ReadAll(reader); string(rest) != "body" {
+		t.Errorf("Expected reader to stop at the body, got %q.", rest)
+	}
+}
+
+// FuzzReadHeaders checks that lenient readHeaders matches referenceReadHeaders
+// on arbitrary input, including lines longer than the reader's buffer.
+func FuzzReadHeaders(f *testing.F) {
+	f.Add([]byte("Content-Type: text/html\r\nContent-Length: 5\r\n\r\nhello"))
+	f.Add([]byte("A:b\r\n\r\n"))
+	f.Add([]byte("No colon here\r\n\r\n"))
+	f.Add([]byte("Bare-LF: x\n\r\n"))
+	f.Add([]byte("Key: " + strings.Repeat("v", 100) + "\r\n\r\n"))
+	f.Add([]byte("Unterminated: header"))
+	f.Add([]byte("  Spaced  : \u0085value\u0085 \r\n\r\n"))
+
+	f.Fuzz(func(t *testing.T, raw []byte) {
+		// A tiny buffer forces the long-line fallback in readHeaders
+		got := bufio.NewReaderSize(bytes.NewReader(raw), 16)
+		want := bufio.NewReaderSize(bytes.NewReader(raw), 16)
+
+		budget := defaultMaxHeaderBytes
+		gotHeaders, gotErr := readHeaders(got, false, &budget, nil)
+		wantHeaders, wantErr := referenceReadHeaders(want)
+
+		if (gotErr == nil) != (wantErr == nil) || (gotErr != nil && gotErr.Error() != wantErr.Error()) {
+			t.Fatalf("error mismatch: got %v, want %v", gotErr, wantErr)
+		}
+		if !reflect.DeepEqual(gotHeaders, wantHeaders) {
+			t.Fatalf("headers mismatch: got %q, want %q", gotHeaders, wantHeaders)
+		}
+		gotRest, _ := io.ReadAll(got)
+		wantRest, _ := io.ReadAll(want)
+		if !bytes.Equal(gotRest, wantRest) {
+			t.Fatalf("reader position mismatch: got %q, want %q", gotRest, wantRest)
+		}
+	})
+}
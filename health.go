@@ -0,0 +1,219 @@
+package httpmodule
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Time a health check gets when HealthChecker doesn't set one
+const defaultHealthCheckTimeout = 5 * time.Second
+
+// HealthCheck reports whether one part of a service works, returning nil if
+// it does. It should give up when ctx is done.
+type HealthCheck func(ctx context.Context) error
+
+type namedCheck struct {
+	name  string
+	check HealthCheck
+}
+
+// HealthChecker answers liveness (/healthz) and readiness (/readyz) probes by
+// running the checks registered for each. Responses are 200 "ok" when every
+// check passes and 503 otherwise; "?verbose" lists each check's result.
+type HealthChecker struct {
+	// Time each check gets before it counts as failed; zero means 5 seconds
+	Timeout time.Duration
+
+	mu           sync.RWMutex
+	liveness     []namedCheck
+	readiness    []namedCheck
+	shuttingDown bool
+}
+
+// NewHealthChecker returns a HealthChecker with no checks, whose probes pass
+// until checks are added
+func NewHealthChecker() *HealthChecker {
+	return &HealthChecker{}
+}
+
+// AddLiveness registers a check that must pass for the process to count as
+// alive. Failing it usually gets the process restarted, so it should only
+// cover problems a restart fixes.
+func (health *HealthChecker) AddLiveness(name string, check HealthCheck) {
+	health.mu.Lock()
+	defer health.mu.Unlock()
+	health.liveness = append(health.liveness, namedCheck{name, check})
+}
+
+// AddReadiness registers a check that must pass for the service to be sent
+// traffic, such as reaching its database
+func (health *HealthChecker) AddReadiness(name string, check HealthCheck) {
+	health.mu.Lock()
+	defer health.mu.Unlock()
+	health.readiness = append(health.readiness, namedCheck{name, check})
+}
+
+// SetShuttingDown makes readiness fail, so load balancers stop sending
+// traffic before Server.Shutdown is called
+func (health *HealthChecker) SetShuttingDown(shuttingDown bool) {
+	health.mu.Lock()
+	defer health.mu.Unlock()
+	health.shuttingDown = shuttingDown
+}
+
+// Live runs the liveness checks, returning the failures by name
+func (health *HealthChecker) Live(ctx context.Context) map[string]error {
+	_, failures := health.probe(ctx, false)
+	return failures
+}
+
+// Ready runs the liveness and readiness checks, returning the failures by name
+func (health *HealthChecker) Ready(ctx context.Context) map[string]error {
+	_, failures := health.probe(ctx, true)
+	return failures
+}
+
+// LivenessHandler returns the Handler for /healthz
+func (health *HealthChecker) LivenessHandler() Handler {
+	return health.handler(false)
+}
+
+// ReadinessHandler returns the Handler for /readyz
+func (health *HealthChecker) ReadinessHandler() Handler {
+	return health.handler(true)
+}
+
+// probe runs the liveness checks, and the readiness ones if ready is set,
+// returning the names it ran and which failed
+func (health *HealthChecker) probe(ctx context.Context, ready bool) ([]string, map[string]error) {
+	health.mu.RLock()
+	checks := health.liveness[:len(health.liveness):len(health.liveness)]
+	shuttingDown := false
+	if ready {
+		checks = append(checks, health.readiness...)
+		shuttingDown = health.shuttingDown
+	}
+	health.mu.RUnlock()
+
+	failures := health.run(ctx, checks)
+	names := make([]string, 0, len(checks)+1)
+	for _, c := range checks {
+		names = append(names, c.name)
+	}
+	if shuttingDown {
+		names = append(names, "shutdown")
+		failures["shutdown"] = errors.New("shutting down")
+	}
+	return names, failures
+}
+
+// handler answers a liveness or readiness probe
+func (health *HealthChecker) handler(ready bool) Handler {
+	return HandlerFunc(func(w ResponseWriter, req *ServerRequest) {
+		if req.Method != "GET" && req.Method != "HEAD" {
+			w.Header()["Allow"] = "GET, HEAD"
+			w.WriteHeader(405)
+			return
+		}
+		names, failures := health.probe(context.Background(), ready)
+
+		headers := w.Header()
+		headers["Content-Type"] = "text/plain; charset=utf-8"
+		headers["Cache-Control"] = "no-store"
+		if len(failures) > 0 {
+			w.WriteHeader(503)
+		} else {
+			w.WriteHeader(200)
+		}
+
+		verbose, _ := req.QueryBool("verbose", false)
+		if !verbose {
+			if len(failures) > 0 {
+				w.Write([]byte("failed\n"))
+			} else {
+				w.Write([]byte("ok\n"))
+			}
+			return
+		}
+
+		var b strings.Builder
+		for _, name := range names {
+			if err := failures[name]; err != nil {
+				fmt.Fprintf(&b, "[-] %s failed: %v\n", name, err)
+			} else {
+				fmt.Fprintf(&b, "[+] %s ok\n", name)
+			}
+		}
+		if len(failures) > 0 {
+			b.WriteString("failed\n")
+		} else {
+			b.WriteString("ok\n")
+		}
+		w.Write([]byte(b.String()))
+	})
+}
+
+// run runs checks concurrently, each with its own timeout, and collects the
+// failures. A check that panics counts as failed.
+func (health *HealthChecker) run(ctx context.Context, checks []namedCheck) map[string]error {
+	timeout := health.Timeout
+	if timeout <= 0 {
+		timeout = defaultHealthCheckTimeout
+	}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	failures := map[string]error{}
+	for _, c := range checks {
+		wg.Add(1)
+		go func(c namedCheck) {
+			defer wg.Done()
+			err := runCheck(ctx, c.check, timeout)
+			if err != nil {
+				mu.Lock()
+				failures[c.name] = err
+				mu.Unlock()
+			}
+		}(c)
+	}
+	wg.Wait()
+	return failures
+}
+
+// runCheck runs check, giving up on it once timeout passes
+func runCheck(ctx context.Context, check HealthCheck, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	result := make(chan error, 1)
+	go func() {
+		defer func() {
+			if err := recover(); err != nil {
+				result <- fmt.Errorf("panic: %v", err)
+			}
+		}()
+		result <- check(ctx)
+	}()
+	select {
+	case err := <-result:
+		return err
+	case <-ctx.Done():
+		return fmt.Errorf("timed out after %v", timeout)
+	}
+}
+
+// HandleOperational mounts GET /healthz and /readyz from health and /metrics
+// from metrics on router. Either may be nil to leave its endpoints out.
+func HandleOperational(router *Router, health *HealthChecker, metrics *Metrics) {
+	if health != nil {
+		router.Handle("GET", "/healthz", health.LivenessHandler())
+		router.Handle("GET", "/readyz", health.ReadinessHandler())
+	}
+	if metrics != nil {
+		router.Handle("GET", "/metrics", metrics)
+	}
+}
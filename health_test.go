@@ -0,0 +1,86 @@
+package httpmodule
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestHealthChecker tests liveness and readiness probes and their verbose output.
+func TestHealthChecker(t *testing.T) {
+	health := NewHealthChecker()
+	router := NewRouter()
+	HandleOperational(router, health, nil)
+
+	if rec := serve(router, "GET", "/healthz"); rec.status != 200 || string(rec.body) != "ok\n" {
+		t.Error("Expected a checker without checks to pass, got", rec.status, string(rec.body))
+	}
+
+	dbErr := errors.New("connection refused")
+	var dbDown bool
+	health.AddLiveness("goroutines", func(ctx context.Context) error { return nil })
+	health.AddReadiness("database", func(ctx context.Context) error {
+		if dbDown {
+			return dbErr
+		}
+		return nil
+	})
+	if rec := serve(router, "GET", "/readyz"); rec.status != 200 {
+		t.Error("Expected ready, got", rec.status)
+	}
+
+	dbDown = true
+	if rec := serve(router, "GET", "/healthz"); rec.status != 200 {
+		t.Error("Expected liveness to ignore readiness checks, got", rec.status)
+	}
+	rec := serveWith(router, "GET", "/readyz", map[string]string{})
+	if rec.status != 503 || string(rec.body) != "failed\n" {
+		t.Error("Expected a failing readiness probe, got", rec.status, string(rec.body))
+	}
+	if failures := health.Ready(context.Background()); failures["database"] != dbErr {
+		t.Error("Expected the database failure, got", failures)
+	}
+
+	verbose := &ServerRequest{Method: "GET", Path: "/readyz", Query: map[string][]string{"verbose": {""}}, Headers: map[string]string{}}
+	rec = newResponseRecorder()
+	router.ServeHTTP(rec, verbose)
+	want := "[+] goroutines ok\n[-] database failed: connection refused\nfailed\n"
+	if string(rec.body) != want {
+		t.Errorf("Expected %q, got %q.", want, rec.body)
+	}
+
+	dbDown = false
+	health.SetShuttingDown(true)
+	if failures := health.Ready(context.Background()); len(failures) != 1 || failures["shutdown"] == nil {
+		t.Error("Expected readiness to fail while shutting down, got", failures)
+	}
+	if len(health.Live(context.Background())) != 0 {
+		t.Error("Expected liveness to pass while shutting down.")
+	}
+}
+
+// TestHealthCheckTimeout tests that slow and panicking checks count as failed.
+func TestHealthCheckTimeout(t *testing.T) {
+	health := &HealthChecker{Timeout: 10 * time.Millisecond}
+	health.AddLiveness("slow", func(ctx context.Context) error {
+		time.Sleep(time.Second)
+		return nil
+	})
+	health.AddLiveness("broken", func(ctx context.Context) error {
+		panic("oops")
+	})
+
+	start := time.Now()
+	failures := health.Live(context.Background())
+	if time.Since(start) > 500*time.Millisecond {
+		t.Error("Expected the probe to give up on the slow check.")
+	}
+	if failures["slow"] == nil || !strings.Contains(failures["slow"].Error(), "timed out") {
+		t.Error("Expected the slow check to time out, got", failures["slow"])
+	}
+	if failures["broken"] == nil || !strings.Contains(failures["broken"].Error(), "oops") {
+		t.Error("Expected the panic to be reported, got", failures["broken"])
+	}
+}
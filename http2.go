@@ -0,0 +1,211 @@
+package httpmodule
+
+import (
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Headers that only mean something to a single HTTP/1 connection, which
+// HTTP/2 forbids in responses
+var connectionSpecificHeaders = []string{"Connection", "Keep-Alive", "Proxy-Connection", "Transfer-Encoding", "Upgrade"}
+
+// serveHTTP2 serves a TLS connection that negotiated h2 through ALPN, or a
+// cleartext one switching to h2c, whose client preface and anything after it
+// are read from reader. The framing, HPACK, and flow control are left to the
+// standard library's HTTP/2 server, which hands each stream to srv's handler
+// as a ServerRequest, so handlers, middleware, and streaming work the same on
+// both protocols.
+func (srv *Server) serveHTTP2(conn net.Conn, reader io.Reader) {
+	var once sync.Once
+	done := make(chan struct{})
+	h2 := &http.Server{
+		Handler:           http.HandlerFunc(srv.serveHTTP2Stream),
+		ErrorLog:          srv.ErrorLog,
+		ReadHeaderTimeout: srv.ReadHeaderTimeout,
+		ReadTimeout:       srv.ReadTimeout,
+		WriteTimeout:      srv.WriteTimeout,
+		IdleTimeout:       srv.IdleTimeout,
+		MaxHeaderBytes:    srv.maxHeaderBytes(),
+		ConnState: func(_ net.Conn, state http.ConnState) {
+			if state == http.StateClosed || state == http.StateHijacked {
+				once.Do(func() { close(done) })
+			}
+		},
+	}
+	allowH2C(h2)
+	if !srv.trackHTTP2(h2, true) {
+		conn.Close()
+		return
+	}
+	defer srv.trackHTTP2(h2, false)
+
+	// Streams come and go without the connection ever being idle between
+	// requests, so Shutdown leaves it to the HTTP/2 server to drain
+	srv.setConnState(conn, stateActive)
+	listener := &connListener{conn: conn, addr: conn.LocalAddr(), closed: make(chan struct{})}
+	if reader != nil {
+		listener.conn = &readerConn{Conn: conn, reader: reader}
+	}
+	go func() {
+		h2.Serve(listener)
+		// Shutdown may have come before the connection was accepted
+		if listener.take() != nil {
+			once.Do(func() { close(done) })
+		}
+	}()
+	<-done
+	listener.Close()
+}
+
+// serveHTTP2Stream answers one HTTP/2 request with srv's handler
+func (srv *Server) serveHTTP2Stream(rw http.ResponseWriter, r *http.Request) {
+	if srv.MaxRequestBodySize > 0 && r.ContentLength > srv.MaxRequestBodySize {
+		rw.WriteHeader(413)
+		return
+	}
+	headers := make(map[string]string, len(r.Header)+1)
+	for k, v := range r.Header {
+		if k == "Cookie" {
+			// Cookie is the one header HTTP/2 splits into separate fields
+			headers[k] = strings.Join(v, "; ")
+		} else {
+			headers[k] = strings.Join(v, ", ")
+		}
+	}
+	headers["Host"] = r.Host
+
+	req := &ServerRequest{
+		Method:     r.Method,
+		Target:     r.RequestURI,
+		Path:       r.URL.Path,
+		Query:      r.URL.Query(),
+		Protocol:   "HTTP/2.0",
+		Host:       r.Host,
+		Headers:    headers,
+		Body:       limitBody(r.Body, srv.MaxRequestBodySize),
+		RemoteAddr: r.RemoteAddr,
+		TLS:        r.TLS,
+		ctx:        r.Context(),
+	}
+	w := &http2Response{rw: rw, headers: make(map[string]string)}
+
+	defer func() {
+		if req.MultipartForm != nil {
+			req.MultipartForm.RemoveAll()
+		}
+		if err := recover(); err != nil {
+			if err != ErrAbortHandler {
+				srv.logf("httpmodule: panic serving %s: %v", r.RemoteAddr, err)
+			}
+			// Resets the stream, so the client can tell the response is
+			// incomplete, without the standard library logging it again
+			panic(http.ErrAbortHandler)
+		}
+	}()
+	srv.handler().ServeHTTP(w, req)
+	w.WriteHeader(200)
+}
+
+// http2Response is the ResponseWriter given to handlers for HTTP/2 requests,
+// passing the response on to the standard library's
+type http2Response struct {
+	rw          http.ResponseWriter
+	headers     map[string]string
+	wroteHeader bool
+}
+
+func (w *http2Response) Header() map[string]string {
+	return w.headers
+}
+
+func (w *http2Response) WriteHeader(statusCode int) {
+	if w.wroteHeader {
+		return
+	}
+	if statusCode < 100 || statusCode > 999 {
+		panic("httpmodule: invalid status code " + strconv.Itoa(statusCode))
+	}
+	w.wroteHeader = true
+
+	for _, name := range connectionSpecificHeaders {
+		deleteHeader(w.headers, name)
+	}
+	out := w.rw.Header()
+	for k, v := range w.headers {
+		out.Set(k, v)
+	}
+	w.rw.WriteHeader(statusCode)
+}
+
+func (w *http2Response) Write(p []byte) (int, error) {
+	w.WriteHeader(200)
+	return w.rw.Write(p)
+}
+
+// Flush sends the headers and anything written so far to the client
+func (w *http2Response) Flush() {
+	w.WriteHeader(200)
+	if flusher, ok := w.rw.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// trackHTTP2 adds or removes an HTTP/2 connection's server, so Shutdown can
+// ask it to drain, reporting false when adding to a closed server
+func (srv *Server) trackHTTP2(h2 *http.Server, add bool) bool {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	if !add {
+		delete(srv.http2Servers, h2)
+		return true
+	}
+	if srv.closed {
+		return false
+	}
+	if srv.http2Servers == nil {
+		srv.http2Servers = make(map[*http.Server]struct{})
+	}
+	srv.http2Servers[h2] = struct{}{}
+	return true
+}
+
+// connListener is a net.Listener that accepts a single connection, then
+// blocks until it is closed
+type connListener struct {
+	mu     sync.Mutex
+	conn   net.Conn
+	addr   net.Addr
+	closed chan struct{}
+	once   sync.Once
+}
+
+func (l *connListener) Accept() (net.Conn, error) {
+	if conn := l.take(); conn != nil {
+		return conn, nil
+	}
+	<-l.closed
+	return nil, errors.New("listener closed")
+}
+
+// take returns the connection if it hasn't been accepted yet, or nil
+func (l *connListener) take() net.Conn {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	conn := l.conn
+	l.conn = nil
+	return conn
+}
+
+func (l *connListener) Close() error {
+	l.once.Do(func() { close(l.closed) })
+	return nil
+}
+
+func (l *connListener) Addr() net.Addr {
+	return l.addr
+}
@@ -0,0 +1,168 @@
+package httpmodule
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// http2Client returns a standard library client that trusts any certificate
+// and prefers h2.
+func http2Client() *http.Client {
+	return &http.Client{Transport: &http.Transport{
+		TLSClientConfig:   &tls.Config{InsecureSkipVerify: true},
+		ForceAttemptHTTP2: true,
+	}}
+}
+
+// TestServeHTTP2 tests that h2 is negotiated and requests reach the handler intact.
+func TestServeHTTP2(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	writeTestCert(t, certFile, keyFile, "server", "localhost")
+
+	addr := startTLSServer(t, HandlerFunc(func(w ResponseWriter, req *ServerRequest) {
+		body, _ := io.ReadAll(req.Body)
+		w.Header()["X-Seen"] = fmt.Sprintf("%s %s %s q=%s cookie=%s", req.Protocol, req.Method, req.Path, req.Query.Get("q"), headerValue(req.Headers, "Cookie"))
+		w.Header()["Connection"] = "keep-alive"
+		w.WriteHeader(201)
+		w.Write(body)
+	}), nil, certFile, keyFile)
+
+	req, _ := http.NewRequest("POST", "https://"+addr+"/echo?q=go", strings.NewReader("hello"))
+	req.AddCookie(&http.Cookie{Name: "a", Value: "1"})
+	req.AddCookie(&http.Cookie{Name: "b", Value: "2"})
+	resp, err := http2Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+
+	if resp.Proto != "HTTP/2.0" {
+		t.Error("Expected HTTP/2, got", resp.Proto)
+	}
+	if resp.StatusCode != 201 || string(body) != "hello" {
+		t.Error("Expected the body echoed with 201, got", resp.StatusCode, string(body))
+	}
+	if want := "HTTP/2.0 POST /echo q=go cookie=a=1; b=2"; resp.Header.Get("X-Seen") != want {
+		t.Errorf("Expected %q, got %q.", want, resp.Header.Get("X-Seen"))
+	}
+}
+
+// TestServeHTTP2Streaming tests that flushed writes reach the client before the handler returns.
+func TestServeHTTP2Streaming(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	writeTestCert(t, certFile, keyFile, "server", "localhost")
+
+	release := make(chan struct{})
+	addr := startTLSServer(t, HandlerFunc(func(w ResponseWriter, req *ServerRequest) {
+		w.Write([]byte("first\n"))
+		w.(Flusher).Flush()
+		<-release
+		w.Write([]byte("second\n"))
+	}), nil, certFile, keyFile)
+
+	resp, err := http2Client().Get("https://" + addr + "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	buf := make([]byte, 6)
+	if _, err := io.ReadFull(resp.Body, buf); err != nil || string(buf) != "first\n" {
+		t.Error("Expected the flushed part before the handler finished, got", string(buf), err)
+	}
+	close(release)
+	rest, _ := io.ReadAll(resp.Body)
+	if string(rest) != "second\n" {
+		t.Error("Expected the rest of the body, got", string(rest))
+	}
+}
+
+// TestServeHTTP2Disabled tests that DisableHTTP2 keeps TLS clients on HTTP/1.1.
+func TestServeHTTP2Disabled(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	writeTestCert(t, certFile, keyFile, "server", "localhost")
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := &Server{DisableHTTP2: true, Handler: HandlerFunc(func(w ResponseWriter, req *ServerRequest) {
+		w.Write([]byte(req.Protocol))
+	})}
+	go srv.ServeTLS(listener, certFile, keyFile)
+	defer srv.Close()
+
+	resp, err := http2Client().Get("https://" + listener.Addr().String() + "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	if resp.Proto != "HTTP/1.1" || string(body) != "HTTP/1.1" {
+		t.Error("Expected HTTP/1.1, got", resp.Proto, string(body))
+	}
+}
+
+// TestServeHTTP2Shutdown tests that Shutdown lets an HTTP/2 stream in progress finish.
+func TestServeHTTP2Shutdown(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	writeTestCert(t, certFile, keyFile, "server", "localhost")
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	started := make(chan struct{})
+	release := make(chan struct{})
+	srv := &Server{Handler: HandlerFunc(func(w ResponseWriter, req *ServerRequest) {
+		close(started)
+		<-release
+		w.Write([]byte("finished"))
+	})}
+	go srv.ServeTLS(listener, certFile, keyFile)
+
+	result := make(chan string, 1)
+	go func() {
+		resp, err := http2Client().Get("https://" + listener.Addr().String() + "/")
+		if err != nil {
+			result <- err.Error()
+			return
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		result <- resp.Proto + " " + string(body)
+	}()
+	<-started
+
+	shutdown := make(chan error, 1)
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		shutdown <- srv.Shutdown(ctx)
+	}()
+	select {
+	case err := <-shutdown:
+		t.Fatal("Expected Shutdown to wait for the stream, got", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(release)
+	if got := <-result; got != "HTTP/2.0 finished" {
+		t.Error("Expected the stream to finish, got", got)
+	}
+	if err := <-shutdown; err != nil {
+		t.Error("Expected a clean shutdown, got", err)
+	}
+}
@@ -0,0 +1,269 @@
+package httpmodule
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	neturl "net/url"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// useHTTP2Error is returned by dial when the server chose HTTP/2 for a new
+// connection, which can't carry an HTTP/1.1 request
+type useHTTP2Error struct {
+	conn *tls.Conn
+	addr string
+}
+
+func (e *useHTTP2Error) Error() string {
+	return "server at " + e.addr + " negotiated HTTP/2"
+}
+
+// http2Transport sends requests to servers that chose HTTP/2. The client
+// doesn't speak HTTP/2 itself: the framing, HPACK, flow control, and
+// multiplexing are left to the standard library's HTTP/2 client, as the
+// server leaves them to its HTTP/2 server. It runs over connections the
+// client dials itself, so HostOverrides, the resolver, TLSConfig, and the
+// dial and handshake timeouts apply as they do to HTTP/1.1, and
+// ResponseHeaderTimeout is passed on. Redirects, retries, cookies, the
+// cache, middleware, and the wire log all wrap the transport, so they work
+// the same on both protocols. The standard library keeps its own pool of
+// HTTP/2 connections, one per server carrying every request to it, which
+// CloseIdleConnections closes along with the client's.
+type http2Transport struct {
+	once sync.Once
+
+	mu        sync.Mutex
+	transport *http.Transport
+	// Hosts, as host:port, known to speak HTTP/2
+	hosts map[string]bool
+	// Connections dialed for HTTP/1.1 on which the server chose HTTP/2,
+	// waiting for the transport to take them
+	pending map[string][]net.Conn
+}
+
+type http1OnlyKey struct{}
+
+// withoutHTTP2 returns a copy of ctx whose dials don't offer HTTP/2, for
+// connections that have to speak HTTP/1.1, such as WebSocket ones
+func withoutHTTP2(ctx context.Context) context.Context {
+	return context.WithValue(ctx, http1OnlyKey{}, true)
+}
+
+// nextProtos returns the protocols to offer servers through ALPN on a
+// connection dialed with ctx
+func (client *HttpClient) nextProtos(ctx context.Context) []string {
+	if client.HTTP2 && ctx.Value(http1OnlyKey{}) == nil {
+		return []string{"h2", "http/1.1"}
+	}
+	return nil
+}
+
+// knows reports whether url's server has already chosen HTTP/2
+func (h2 *http2Transport) knows(url string) bool {
+	addr, ok := http2Addr(url)
+	if !ok {
+		return false
+	}
+	h2.mu.Lock()
+	defer h2.mu.Unlock()
+	return h2.hosts[addr]
+}
+
+// handOver keeps conn, a connection to addr on which HTTP/2 was negotiated,
+// for the transport's next dial to addr
+func (h2 *http2Transport) handOver(addr string, conn net.Conn) {
+	h2.mu.Lock()
+	defer h2.mu.Unlock()
+	if h2.hosts == nil {
+		h2.hosts = make(map[string]bool)
+		h2.pending = make(map[string][]net.Conn)
+	}
+	h2.hosts[addr] = true
+	h2.pending[addr] = append(h2.pending[addr], conn)
+}
+
+// take returns a connection handed over for addr, or nil
+func (h2 *http2Transport) take(addr string) net.Conn {
+	h2.mu.Lock()
+	defer h2.mu.Unlock()
+	conns := h2.pending[addr]
+	if len(conns) == 0 {
+		return nil
+	}
+	conn := conns[len(conns)-1]
+	h2.pending[addr] = conns[:len(conns)-1]
+	return conn
+}
+
+// closeIdle closes the transport's idle connections and any not yet taken
+func (h2 *http2Transport) closeIdle() {
+	h2.mu.Lock()
+	pending, transport := h2.pending, h2.transport
+	h2.pending = make(map[string][]net.Conn)
+	h2.mu.Unlock()
+	for _, conns := range pending {
+		for _, conn := range conns {
+			conn.Close()
+		}
+	}
+	if transport != nil {
+		transport.CloseIdleConnections()
+	}
+}
+
+// usesHTTP2 reports whether req goes straight to a server already known to
+// have chosen HTTP/2, and so will be sent over it
+func (client *HttpClient) usesHTTP2(req *HttpRequest) bool {
+	if !client.h2.knows(req.URL) {
+		return false
+	}
+	proxy, err := client.proxyFor(req)
+	return err == nil && proxy == nil
+}
+
+// http2Addr returns the host:port a URL's requests go to over HTTPS
+func http2Addr(url string) (string, bool) {
+	parsedURL, err := neturl.Parse(url)
+	if err != nil || parsedURL.Scheme != "https" || parsedURL.Host == "" {
+		return "", false
+	}
+	hostname, port := splitHostPort(parsedURL.Host, true)
+	return net.JoinHostPort(hostname, port), true
+}
+
+// http2Transport returns the standard library transport HTTP/2 requests go
+// through, dialing with the client
+func (client *HttpClient) http2Transport() *http.Transport {
+	h2 := &client.h2
+	h2.once.Do(func() {
+		transport := &http.Transport{
+			ForceAttemptHTTP2:   true,
+			MaxIdleConnsPerHost: client.maxIdleConnsPerHost(),
+			// Bodies are decoded as for HTTP/1.1, according to the client's settings
+			DisableCompression:    true,
+			ResponseHeaderTimeout: client.ResponseHeaderTimeout,
+			DialTLSContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+				if conn := h2.take(addr); conn != nil {
+					return conn, nil
+				}
+				pc, err := client.dial(ctx, true, addr)
+				if useH2, ok := err.(*useHTTP2Error); ok {
+					return useH2.conn, nil
+				}
+				if err != nil {
+					return nil, err
+				}
+				// The server has stopped offering HTTP/2; the transport
+				// speaks HTTP/1.1 on the connection itself
+				putReader(pc.reader)
+				return pc.conn, nil
+			},
+		}
+		h2.mu.Lock()
+		h2.transport = transport
+		h2.mu.Unlock()
+	})
+	h2.mu.Lock()
+	defer h2.mu.Unlock()
+	return h2.transport
+}
+
+// roundTripHTTP2 sends req over HTTP/2 and returns as soon as the response
+// headers are in, with the same headers an HTTP/1.1 request would carry
+func (client *HttpClient) roundTripHTTP2(req *HttpRequest) (*HttpResponse, error) {
+	ctx := req.Context()
+	if req.Method == "" || !validMethod(req.Method) {
+		return nil, fmt.Errorf("invalid method %q", req.Method)
+	}
+	parsedURL, err := neturl.Parse(req.URL)
+	if err != nil {
+		return nil, err
+	}
+
+	converted := &http.Request{
+		Method:     req.Method,
+		URL:        parsedURL,
+		Proto:      "HTTP/2.0",
+		ProtoMajor: 2,
+		Header:     make(http.Header),
+		Host:       parsedURL.Host,
+	}
+	client.eachRequestHeader(parsedURL.Host, req.Headers, func(k, v string) {
+		switch http.CanonicalHeaderKey(k) {
+		case "Host":
+			converted.Host = v
+		case "Connection", "Keep-Alive", "Proxy-Connection", "Transfer-Encoding", "Upgrade", "Content-Length":
+			// HTTP/2 frames messages itself and has no connection headers
+		default:
+			converted.Header.Add(k, v)
+		}
+	})
+	if req.BodyReader != nil {
+		converted.Body = io.NopCloser(req.BodyReader)
+		converted.ContentLength = req.ContentLength
+		if converted.ContentLength == 0 {
+			converted.ContentLength = -1
+		}
+	} else if req.Body != "" {
+		body := req.Body
+		converted.Body = io.NopCloser(strings.NewReader(body))
+		converted.ContentLength = int64(len(body))
+		converted.GetBody = func() (io.ReadCloser, error) {
+			return io.NopCloser(strings.NewReader(body)), nil
+		}
+	}
+	trace := traceFrom(ctx)
+	if trace == nil {
+		ctx, trace = startTrace(ctx)
+	}
+	converted = converted.WithContext(httptrace.WithClientTrace(ctx, &httptrace.ClientTrace{
+		GotConn: func(info httptrace.GotConnInfo) {
+			trace.gotConn(info.Reused)
+		},
+		WroteRequest: func(info httptrace.WroteRequestInfo) {
+			trace.wroteRequest(info.Err)
+		},
+		GotFirstResponseByte: trace.gotFirstByte,
+	}))
+
+	response, err := client.http2Transport().RoundTrip(converted)
+	if err != nil {
+		return nil, contextError(ctx, err)
+	}
+
+	headers := make(map[string]string, len(response.Header))
+	for k, v := range response.Header {
+		if k == "Set-Cookie" {
+			// Cookies can't be joined with commas, which their dates contain,
+			// so only the last is kept, as on HTTP/1.1; Header has them all
+			headers[k] = v[len(v)-1]
+		} else {
+			headers[k] = strings.Join(v, ", ")
+		}
+	}
+	reader := getReader(response.Body)
+	return &HttpResponse{
+		Protocol:   response.Proto,
+		StatusCode: response.StatusCode,
+		Status:     strings.TrimSpace(strings.TrimPrefix(response.Status, strconv.Itoa(response.StatusCode))),
+		Headers:    headers,
+		header:     Header(response.Header),
+		Timings:    trace.result(),
+		body: &deferredBody{
+			bodyReader: &bodyReader{reader: reader, remaining: -1},
+			release: func(bool) {
+				response.Body.Close()
+				putReader(reader)
+			},
+			limits: client.bandwidthLimits(req),
+			ctx:    ctx,
+		},
+	}, nil
+}
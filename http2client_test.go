@@ -0,0 +1,168 @@
+package httpmodule
+
+import (
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// TestClientHTTP2 tests negotiating HTTP/2 and sending several requests over one connection.
+func TestClientHTTP2(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	writeTestCert(t, certFile, keyFile, "server", "localhost")
+
+	addr := startTLSServer(t, HandlerFunc(func(w ResponseWriter, req *ServerRequest) {
+		body, _ := io.ReadAll(req.Body)
+		w.Header()["X-Remote"] = req.RemoteAddr
+		fmt.Fprintf(w, "%s %s %s %s %s", req.Protocol, req.Method, req.Path, headerValue(req.Headers, "User-Agent"), body)
+	}), nil, certFile, keyFile)
+	client := New()
+	client.HTTP2 = true
+	client.TLSConfig = &tls.Config{InsecureSkipVerify: true}
+
+	response, err := client.Post("https://"+addr+"/first", "hello", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response.Protocol != "HTTP/2.0" || response.Body != "HTTP/2.0 POST /first CustomHttpClient/1.0 hello" {
+		t.Errorf("Expected an HTTP/2 exchange, got %s %q", response.Protocol, response.Body)
+	}
+	remote := response.Header().Get("X-Remote")
+	if remote == "" {
+		t.Error("Expected the response headers, got", response.Headers)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			response, err := client.Get(fmt.Sprintf("https://%s/%d", addr, i), nil)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			if response.Protocol != "HTTP/2.0" || response.Headers["X-Remote"] != remote {
+				t.Errorf("Expected the request on the first connection, got %s from %s", response.Protocol, response.Headers["X-Remote"])
+			}
+		}(i)
+	}
+	wg.Wait()
+}
+
+// TestClientHTTP2Fallback tests speaking HTTP/1.1 to a server that doesn't offer HTTP/2.
+func TestClientHTTP2Fallback(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	writeTestCert(t, certFile, keyFile, "server", "localhost")
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := &Server{DisableHTTP2: true, Handler: HandlerFunc(func(w ResponseWriter, req *ServerRequest) {
+		w.Write([]byte(req.Protocol))
+	})}
+	go srv.ServeTLS(listener, certFile, keyFile)
+	defer srv.Close()
+
+	client := New()
+	client.HTTP2 = true
+	client.TLSConfig = &tls.Config{InsecureSkipVerify: true}
+	for i := 0; i < 2; i++ {
+		response, err := client.Get("https://"+listener.Addr().String()+"/", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if response.Protocol != "HTTP/1.1" || response.Body != "HTTP/1.1" {
+			t.Error("Expected HTTP/1.1, got", response.Protocol, response.Body)
+		}
+	}
+}
+
+// TestClientHTTP2Features tests that redirects, retries, cookies, the cache,
+// and the wire log work the same over HTTP/2 as over HTTP/1.1, as they wrap
+// the transport either protocol is spoken through.
+func TestClientHTTP2Features(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	writeTestCert(t, certFile, keyFile, "server", "localhost")
+
+	var mu sync.Mutex
+	hits := map[string]int{}
+	addr := startTLSServer(t, HandlerFunc(func(w ResponseWriter, req *ServerRequest) {
+		mu.Lock()
+		hits[req.Path]++
+		hit := hits[req.Path]
+		mu.Unlock()
+		switch req.Path {
+		case "/redirect":
+			w.Header()["Location"] = "/login"
+			w.WriteHeader(302)
+		case "/login":
+			w.Header()["Set-Cookie"] = "session=abc; Path=/"
+			io.WriteString(w, "logged in")
+		case "/whoami":
+			io.WriteString(w, headerValue(req.Headers, "Cookie"))
+		case "/flaky":
+			if hit == 1 {
+				w.WriteHeader(503)
+				return
+			}
+			io.WriteString(w, "recovered")
+		case "/cached":
+			w.Header()["Cache-Control"] = "max-age=60"
+			fmt.Fprintf(w, "hit %d", hit)
+		}
+	}), nil, certFile, keyFile)
+
+	for _, http2 := range []bool{false, true} {
+		mu.Lock()
+		hits = map[string]int{}
+		mu.Unlock()
+		logger := &recordingLogger{}
+		client := New()
+		client.HTTP2 = http2
+		client.TLSConfig = &tls.Config{InsecureSkipVerify: true}
+		client.Jar = NewCookieJar()
+		client.Retry = &RetryPolicy{BaseDelay: time.Millisecond}
+		client.Cache = NewResponseCache(NewMemoryCacheStore(10))
+		client.Logger = logger
+		client.LogVerbose = true
+		protocol := "HTTP/1.1"
+		if http2 {
+			protocol = "HTTP/2.0"
+		}
+
+		var got []string
+		for _, path := range []string{"/redirect", "/whoami", "/flaky", "/cached", "/cached"} {
+			response, err := client.Get("https://"+addr+path, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if response.Protocol != protocol {
+				t.Errorf("Expected %s for %s, got %s", protocol, path, response.Protocol)
+			}
+			got = append(got, fmt.Sprintf("%d %s", response.StatusCode, response.Body))
+		}
+		want := []string{"200 logged in", "200 session=abc", "200 recovered", "200 hit 1", "200 hit 1"}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("Expected %q over %s, got %q", want, protocol, got)
+		}
+
+		logged := strings.Join(logger.lines, "\n")
+		for _, line := range []string{"DEBUG > GET /whoami " + protocol, "DEBUG > Cookie: REDACTED", "DEBUG < " + protocol + " 302 Found", "DEBUG < Set-Cookie: REDACTED"} {
+			if !strings.Contains(logged, line) {
+				t.Errorf("Expected %q in the wire log over %s, got:\n%s", line, protocol, logged)
+			}
+		}
+	}
+}
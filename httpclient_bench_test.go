@@ -0,0 +1,112 @@
+package httpmodule
+
+import (
+	"bufio"
+	"bytes"
+	"net"
+	neturl "net/url"
+	"strings"
+	"testing"
+)
+
+const benchResponse = "HTTP/1.1 200 OK\r\n" +
+	"Content-Type: text/plain\r\n" +
+	"Content-Length: 5\r\n" +
+	"\r\n" +
+	"hello"
+
+// BenchmarkConstructRequest measures serializing a small GET request.
+func BenchmarkConstructRequest(b *testing.B) {
+	client := New()
+	headers := map[string]string{"X-Request-Id": "42"}
+	url, _ := neturl.Parse("http://example.com/index.html")
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		buf := getBuffer()
+		err := client.writeRequestHead(buf, "GET", url, 0, headers)
+		if err != nil {
+			b.Fatal(err)
+		}
+		putBuffer(buf)
+	}
+}
+
+// BenchmarkParseHTTPResponse measures parsing a small 200 response.
+func BenchmarkParseHTTPResponse(b *testing.B) {
+	reader := strings.NewReader(benchResponse)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		reader.Reset(benchResponse)
+		_, err := ParseResponse(reader, "GET")
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkExchange measures a full GET/200 cycle over a loopback connection to
+// an in-process server.
+func BenchmarkExchange(b *testing.B) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer listener.Close()
+	go serveBenchConn(listener)
+
+	netConn, err := net.Dial("tcp", listener.Addr().String())
+	if err != nil {
+		b.Fatal(err)
+	}
+	conn := newPersistConn(netConn)
+	defer conn.close()
+
+	client := New()
+	url, _ := neturl.Parse("http://" + listener.Addr().String() + "/")
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		head := getBuffer()
+		err := client.writeRequestHead(head, "GET", url, 0, nil)
+		if err != nil {
+			b.Fatal(err)
+		}
+		response, _, err := conn.exchange(head, nil, ParseOptions{})
+		putBuffer(head)
+		if err != nil {
+			b.Fatal(err)
+		}
+		if _, err := response.ReadBody(); err != nil {
+			b.Fatal(err)
+		}
+		if response.StatusCode != 200 {
+			b.Fatalf("unexpected status %d", response.StatusCode)
+		}
+	}
+}
+
+// serveBenchConn answers every request on the first accepted connection with
+// benchResponse until the client hangs up.
+func serveBenchConn(listener net.Listener) {
+	conn, err := listener.Accept()
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+	for {
+		// Requests in the benchmark have no body, so the head is the whole request
+		for {
+			line, err := reader.ReadSlice('\n')
+			if err != nil {
+				return
+			}
+			if bytes.Equal(line, []byte("\r\n")) {
+				break
+			}
+		}
+		if _, err := conn.Write([]byte(benchResponse)); err != nil {
+			return
+		}
+	}
+}
@@ -1,8 +1,17 @@
 package httpmodule
 
 import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"fmt"
+	"net"
+	neturl "net/url"
+	"os"
+	"path/filepath"
 	"testing"
+	"time"
 )
 
 // Create a global instance of our HTTP client.
@@ -11,9 +20,33 @@ var hc *HttpClient
 var bold = "\033[1m"
 var reset = "\033[0m"
 
+// Create a client that answers from memory, so tests don't depend on the network.
+var fake *fakeTransport
+var fc *HttpClient
+
 // Create an init function that will be called before any tests are run and creates the HTTP client.
 func init() {
 	hc = New()
+
+	fake = &fakeTransport{}
+	fc = New()
+	fc.Transport = fake
+}
+
+// fakeTransport answers every request with a canned response and remembers the last request.
+type fakeTransport struct {
+	last *HttpRequest
+}
+
+func (f *fakeTransport) RoundTrip(req *HttpRequest) (*HttpResponse, error) {
+	f.last = req
+	return &HttpResponse{
+		Protocol:   "HTTP/1.1",
+		StatusCode: 200,
+		Status:     "OK",
+		Headers:    map[string]string{"Content-Type": "text/plain"},
+		Body:       req.Method + " " + req.URL,
+	}, nil
 }
 
 // TestNew tests the New function.
@@ -25,18 +58,21 @@ func TestNew(t *testing.T) {
 
 // TestConstructRequest tests the constructRequest function.
 func TestConstructRequest(t *testing.T) {
-	request, err := hc.constructRequest("GET", "/", "", nil)
+	request, err := hc.constructRequest("GET", "/", nil, nil)
 	if err != nil {
 		t.Error("Expected nil error.")
 	}
-	if request != "GET / HTTP/1.1\r\nContent-Length: 0\r\n\r\n" {
+	if string(request) != "GET / HTTP/1.1\r\nContent-Length: 0\r\n\r\n" {
 		t.Error("Expected different request string.")
 	}
 }
 
 // TestSendRequest tests the sendRequest function.
 func TestSendRequest(t *testing.T) {
-	response, err := hc.sendRequest("GET / HTTP/1.1\r\nContent-Length: 0\r\n\r\n", "https://", "google.com")
+	ts := NewTLSTestServer(HandlerFunc(func(w ResponseWriter, req *ServerRequest) {}))
+	defer ts.Close()
+	head := bytes.NewBufferString("GET / HTTP/1.1\r\nContent-Length: 0\r\n\r\n")
+	response, err := ts.Client().sendRequest(head, nil, "https://", ts.Addr())
 	if err != nil {
 		t.Error("Expected nil error.")
 	}
@@ -47,7 +83,7 @@ func TestSendRequest(t *testing.T) {
 
 // TestGet tests the Get function.
 func TestGet(t *testing.T) {
-	response, err := hc.Get("https://www.google.com", nil)
+	response, err := fc.Get("https://www.google.com", nil)
 	if err != nil {
 		t.Error("Expected nil error.", err)
 	}
@@ -71,7 +107,7 @@ func TestGet(t *testing.T) {
 
 // TestPost tests the Post function.
 func TestPost(t *testing.T) {
-	response, err := hc.Post("google.com", "", nil)
+	response, err := fc.Post("google.com", "", nil)
 	if err != nil {
 		t.Error("Expected nil error.")
 	}
@@ -79,3 +115,275 @@ func TestPost(t *testing.T) {
 		t.Error("Expected non-nil HttpResponse instance.")
 	}
 }
+
+// TestTransport tests that requests reach the client's transport intact.
+func TestTransport(t *testing.T) {
+	headers := map[string]string{"X-Test": "1"}
+	response, err := fc.Post("https://example.com/items", "payload", headers)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fake.last.Method != "POST" || fake.last.URL != "https://example.com/items" {
+		t.Error("Expected method and URL to be passed through.", fake.last)
+	}
+	if fake.last.Body != "payload" || fake.last.Headers["X-Test"] != "1" {
+		t.Error("Expected body and headers to be passed through.", fake.last)
+	}
+	if response.Body != "POST https://example.com/items" {
+		t.Error("Expected the transport's response.", response.Body)
+	}
+}
+
+// TestDo tests sending requests with any method.
+func TestDo(t *testing.T) {
+	purge := &HttpRequest{Method: "PURGE", URL: "https://example.com/a"}
+	calls := []struct {
+		method string
+		send   func() (*HttpResponse, error)
+	}{
+		{"PUT", func() (*HttpResponse, error) { return fc.Put("https://example.com/a", "x", nil) }},
+		{"PATCH", func() (*HttpResponse, error) { return fc.Patch("https://example.com/a", "x", nil) }},
+		{"DELETE", func() (*HttpResponse, error) { return fc.Delete("https://example.com/a", nil) }},
+		{"HEAD", func() (*HttpResponse, error) { return fc.Head("https://example.com/a", nil) }},
+		{"PROPFIND", func() (*HttpResponse, error) { return fc.Request("PROPFIND", "https://example.com/a", "", nil) }},
+		{"PURGE", func() (*HttpResponse, error) { return fc.Do(purge) }},
+	}
+	for _, call := range calls {
+		if _, err := call.send(); err != nil {
+			t.Fatal(err)
+		}
+		if fake.last.Method != call.method {
+			t.Errorf("Expected a %s request, got %s.", call.method, fake.last.Method)
+		}
+	}
+
+	for _, method := range []string{"GET /admin", "GET\r\n", "BAD:METHOD"} {
+		if _, err := BuildRequest(&HttpRequest{Method: method, URL: "http://example.com/"}); err == nil {
+			t.Errorf("Expected the method %q to be rejected.", method)
+		}
+	}
+}
+
+// TestBuildRequest tests that the exported builder round trips through the parser's counterpart.
+func TestBuildRequest(t *testing.T) {
+	client := New()
+	client.DefaultHeaders["X-Client"] = "1"
+	req := &HttpRequest{Method: "PUT", URL: "http://example.com/a", Body: "data"}
+
+	withDefaults, err := client.BuildRequest(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bare, err := BuildRequest(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasPrefix(bare, []byte("PUT /a HTTP/1.1\r\nHost: example.com\r\n")) || !bytes.HasSuffix(bare, []byte("\r\n\r\ndata")) {
+		t.Error("Expected a complete request.", string(bare))
+	}
+	if !bytes.Contains(withDefaults, []byte("X-Client: 1\r\n")) || bytes.Contains(bare, []byte("X-Client")) {
+		t.Error("Expected only the client's builder to add its default headers.")
+	}
+	if _, err := BuildRequest(&HttpRequest{Method: "GET"}); err == nil {
+		t.Error("Expected an error without a URL.")
+	}
+}
+
+// TestHostOverrides tests connecting to an overridden address under the original name.
+func TestHostOverrides(t *testing.T) {
+	_, addr := startServer(t, HandlerFunc(func(w ResponseWriter, req *ServerRequest) {
+		w.Write([]byte(req.Host))
+	}))
+	client := New()
+	client.HostOverrides = map[string]string{"staging.test": addr}
+	response, err := client.Get("http://staging.test/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response.Body != "staging.test" {
+		t.Error("Expected the original Host header, got", response.Body)
+	}
+
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	writeTestCert(t, certFile, keyFile, "secure", "secure.test")
+	serverNames := make(chan string, 1)
+	config := &tls.Config{GetConfigForClient: func(hello *tls.ClientHelloInfo) (*tls.Config, error) {
+		serverNames <- hello.ServerName
+		return nil, nil
+	}}
+	tlsAddr := startTLSServer(t, echoHandler, config, certFile, keyFile)
+	client.HostOverrides["secure.test"] = tlsAddr
+
+	// The test certificate isn't trusted, but the handshake shows the name sent
+	client.Get("https://secure.test/", nil)
+	if name := <-serverNames; name != "secure.test" {
+		t.Error("Expected the original TLS server name, got", name)
+	}
+}
+
+// TestDoContext tests that a request's context cancels it and bounds its time.
+func TestDoContext(t *testing.T) {
+	release := make(chan struct{})
+	t.Cleanup(func() { close(release) })
+	_, addr := startServer(t, HandlerFunc(func(w ResponseWriter, req *ServerRequest) {
+		if req.Path == "/partial" {
+			w.Header()["Content-Length"] = "10"
+			w.Write([]byte("hello"))
+			w.(Flusher).Flush()
+		}
+		<-release
+	}))
+	client := New()
+	client.HostOverrides = map[string]string{"slow.test": addr}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err := client.DoContext(ctx, &HttpRequest{Method: "GET", URL: "http://slow.test/"})
+	if err != context.DeadlineExceeded {
+		t.Error("Expected the deadline to be exceeded, got", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Error("Expected the request to stop at its deadline, took", elapsed)
+	}
+
+	// Cancelling while the body is being read stops the read
+	client.DeferBody = true
+	ctx, cancel = context.WithCancel(context.Background())
+	response, err := client.DoContext(ctx, &HttpRequest{Method: "GET", URL: "http://slow.test/partial"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.AfterFunc(50*time.Millisecond, cancel)
+	if _, err := response.ReadBody(); err != context.Canceled {
+		t.Error("Expected the body to stop at the cancel, got", err)
+	}
+	response.Close()
+
+	// A request already cancelled isn't sent
+	_, err = client.DoContext(ctx, &HttpRequest{Method: "GET", URL: "http://" + deadAddr(t) + "/"})
+	if err != context.Canceled {
+		t.Error("Expected the cancel error, got", err)
+	}
+}
+
+// TestClientTLSConfig tests trusting a private CA and presenting a client certificate.
+func TestClientTLSConfig(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	writeTestCert(t, certFile, keyFile, "server", "private.test")
+	clientCertFile, clientKeyFile := filepath.Join(dir, "client.pem"), filepath.Join(dir, "client-key.pem")
+	writeTestCert(t, clientCertFile, clientKeyFile, "client", "client")
+
+	config := &tls.Config{ClientAuth: tls.RequireAnyClientCert}
+	addr := startTLSServer(t, HandlerFunc(func(w ResponseWriter, req *ServerRequest) {
+		w.Write([]byte(req.TLS.PeerCertificates[0].Subject.CommonName))
+	}), config, certFile, keyFile)
+	client := New()
+	client.HostOverrides = map[string]string{"private.test": addr}
+
+	if _, err := client.Get("https://private.test/", nil); err == nil {
+		t.Error("Expected an untrusted certificate to be refused.")
+	}
+
+	pem, err := os.ReadFile(certFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	roots := x509.NewCertPool()
+	roots.AppendCertsFromPEM(pem)
+	clientCert, err := tls.LoadX509KeyPair(clientCertFile, clientKeyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.TLSConfig = &tls.Config{RootCAs: roots, Certificates: []tls.Certificate{clientCert}, MinVersion: tls.VersionTLS12}
+	response, err := client.Get("https://private.test/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response.Body != "client" {
+		t.Error("Expected the server to see the client certificate, got", response.Body)
+	}
+	if client.TLSConfig.ServerName != "" {
+		t.Error("Expected the client's config to be left unchanged.")
+	}
+}
+
+// TestURLPort tests that the port in a URL is dialed and sent in the Host header.
+func TestURLPort(t *testing.T) {
+	_, addr := startServer(t, HandlerFunc(func(w ResponseWriter, req *ServerRequest) {
+		w.Write([]byte(req.Host))
+	}))
+	_, port, _ := net.SplitHostPort(addr)
+	client := New()
+	for _, host := range []string{addr, "localhost:" + port} {
+		response, err := client.Get("http://"+host+"/api", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if response.Body != host {
+			t.Errorf("Expected Host %q, got %q", host, response.Body)
+		}
+	}
+
+	if name, port := splitHostPort("[::1]", true); name != "::1" || port != "443" {
+		t.Error("Expected the scheme's port for a bare IPv6 address, got", name, port)
+	}
+}
+
+// TestPostForm tests that form values are encoded and labelled as a URL-encoded form.
+func TestPostForm(t *testing.T) {
+	_, addr := startServer(t, HandlerFunc(func(w ResponseWriter, req *ServerRequest) {
+		if err := req.ParseForm(); err != nil {
+			w.WriteHeader(400)
+			return
+		}
+		fmt.Fprintf(w, "%s|%s|%s", req.Headers["Content-Type"], req.FormValue("q"), req.FormValue("tag"))
+	}))
+	client := New()
+
+	form := neturl.Values{"q": {"a b&c=d"}, "tag": {"x/y"}}
+	response, err := client.PostForm("http://"+addr+"/", form, map[string]string{"content-type": "text/plain"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response.Body != "application/x-www-form-urlencoded|a b&c=d|x/y" {
+		t.Errorf("Expected the form to be decoded by the server, got %q", response.Body)
+	}
+}
+
+// TestRequestTarget tests that the path and query are sent as the URL spells them.
+func TestRequestTarget(t *testing.T) {
+	tests := []struct {
+		url, target string
+	}{
+		{"http://example.com/search?q=go", "/search?q=go"},
+		{"http://example.com?q=go", "/?q=go"},
+		{"http://example.com/a%20b/c%2Fd?q=a%26b&q=c+d", "/a%20b/c%2Fd?q=a%26b&q=c+d"},
+		{"http://example.com/a?tag=x&tag=y&tag=z", "/a?tag=x&tag=y&tag=z"},
+		{"http://example.com/page#section", "/page"},
+		{"http://example.com/page?#section", "/page?"},
+		{"http://example.com", "/"},
+	}
+	for _, test := range tests {
+		request, err := BuildRequest(&HttpRequest{Method: "GET", URL: test.url})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if line := "GET " + test.target + " HTTP/1.1\r\n"; !bytes.HasPrefix(request, []byte(line)) {
+			t.Errorf("Expected %q for %s, got %q", line, test.url, request)
+		}
+	}
+
+	_, addr := startServer(t, HandlerFunc(func(w ResponseWriter, req *ServerRequest) {
+		fmt.Fprintf(w, "%s %q", req.Path, req.Query["q"])
+	}))
+	response, err := New().Get("http://"+addr+"/find%3F?q=a%26b&q=%E2%9C%93", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response.Body != `/find? ["a&b" "✓"]` {
+		t.Errorf("Expected the server to see the decoded path and query, got %s", response.Body)
+	}
+}
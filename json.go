@@ -0,0 +1,51 @@
+package httpmodule
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// GetJSON fetches url and decodes its JSON body into out. See DoJSON.
+func (client *HttpClient) GetJSON(url string, out any, headers map[string]string) (*HttpResponse, error) {
+	return client.DoJSON("GET", url, nil, out, headers)
+}
+
+// PostJSON posts in as JSON and decodes the JSON response into out. See DoJSON.
+func (client *HttpClient) PostJSON(url string, in, out any, headers map[string]string) (*HttpResponse, error) {
+	return client.DoJSON("POST", url, in, out, headers)
+}
+
+// DoJSON sends a request whose body is in marshaled as JSON, unless in is
+// nil, and decodes the response body into out, unless out is nil or the body
+// is empty. Responses outside 2xx are returned with an *APIError holding the
+// body, which its Decode method can unmarshal.
+func (client *HttpClient) DoJSON(method, url string, in, out any, headers map[string]string) (*HttpResponse, error) {
+	headers = withHeader(headers, "Accept", "application/json")
+	var body string
+	if in != nil {
+		data, err := json.Marshal(in)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode request body: %v", err)
+		}
+		body = string(data)
+		headers = withHeader(headers, "Content-Type", "application/json")
+	}
+
+	response, err := client.Request(method, url, body, headers)
+	if err != nil {
+		return nil, err
+	}
+	// Clients that defer bodies still get this one read
+	if _, err := response.ReadBody(); err != nil {
+		return response, err
+	}
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		return response, &APIError{Operation: method + " " + url, StatusCode: response.StatusCode, Status: response.Status, Body: response.Body}
+	}
+	if out != nil && response.Body != "" {
+		if err := json.Unmarshal([]byte(response.Body), out); err != nil {
+			return response, fmt.Errorf("failed to decode response body: %v", err)
+		}
+	}
+	return response, nil
+}
@@ -0,0 +1,70 @@
+package httpmodule
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+type jsonItem struct {
+	Name  string `json:"name"`
+	Count int    `json:"count"`
+}
+
+// TestJSON tests sending and receiving JSON bodies, and the error for a failed status.
+func TestJSON(t *testing.T) {
+	_, addr := startServer(t, HandlerFunc(func(w ResponseWriter, req *ServerRequest) {
+		w.Header()["Content-Type"] = "application/json"
+		if req.Headers["Accept"] != "application/json" {
+			w.WriteHeader(406)
+			return
+		}
+		switch req.Method {
+		case "GET":
+			if req.Path == "/missing" {
+				w.WriteHeader(404)
+				w.Write([]byte(`{"error":"no such item"}`))
+				return
+			}
+			w.Write([]byte(`{"name":"widget","count":3}`))
+		case "POST":
+			var item jsonItem
+			if req.Headers["Content-Type"] != "application/json" || req.DecodeJSON(&item, 1<<10) != nil {
+				w.WriteHeader(400)
+				return
+			}
+			item.Count++
+			w.WriteHeader(201)
+			fmt.Fprintf(w, `{"name":%q,"count":%d}`, item.Name, item.Count)
+		}
+	}))
+	client := New()
+	client.DeferBody = true
+
+	var got jsonItem
+	if _, err := client.GetJSON("http://"+addr+"/item", &got, nil); err != nil {
+		t.Fatal(err)
+	}
+	if got != (jsonItem{"widget", 3}) {
+		t.Error("Expected the body to be decoded, got", got)
+	}
+
+	got = jsonItem{}
+	response, err := client.PostJSON("http://"+addr+"/item", jsonItem{"gadget", 4}, &got, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response.StatusCode != 201 || got != (jsonItem{"gadget", 5}) {
+		t.Error("Expected the posted item back, got", response.StatusCode, got)
+	}
+
+	_, err = client.GetJSON("http://"+addr+"/missing", &got, nil)
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != 404 {
+		t.Fatal("Expected an APIError for 404, got", err)
+	}
+	var detail struct{ Error string }
+	if apiErr.Decode(&detail) != nil || detail.Error != "no such item" {
+		t.Error("Expected the error body to decode, got", apiErr.Body)
+	}
+}
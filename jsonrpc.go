@@ -0,0 +1,169 @@
+package httpmodule
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"sync/atomic"
+)
+
+// JSONRPCClient makes JSON-RPC 2.0 calls over HTTP POST
+type JSONRPCClient struct {
+	Client   *HttpClient
+	Endpoint string
+
+	// Headers sent with every call, such as Authorization
+	Headers map[string]string
+
+	nextID int64
+}
+
+// RPCError is the error object of a JSON-RPC response
+type RPCError struct {
+	Code    int             `json:"code"`
+	Message string          `json:"message"`
+	Data    json.RawMessage `json:"data,omitempty"`
+}
+
+func (e *RPCError) Error() string {
+	return fmt.Sprintf("jsonrpc: %s (code %d)", e.Message, e.Code)
+}
+
+// RPCCall is one call in a batch. Result, when not nil, receives the decoded
+// result; Err is set when the call failed.
+type RPCCall struct {
+	Method string
+	Params any
+	Result any
+	Err    error
+}
+
+type rpcRequest struct {
+	JSONRPC string `json:"jsonrpc"`
+	ID      *int64 `json:"id,omitempty"`
+	Method  string `json:"method"`
+	Params  any    `json:"params,omitempty"`
+}
+
+type rpcResponse struct {
+	ID     json.RawMessage `json:"id"`
+	Result json.RawMessage `json:"result"`
+	Error  *RPCError       `json:"error"`
+}
+
+// NewJSONRPCClient returns a JSON-RPC client posting to endpoint
+func NewJSONRPCClient(client *HttpClient, endpoint string) *JSONRPCClient {
+	return &JSONRPCClient{Client: client, Endpoint: endpoint}
+}
+
+// Call invokes method and decodes its result into out, when not nil. A
+// JSON-RPC error comes back as an *RPCError.
+func (rpc *JSONRPCClient) Call(ctx context.Context, method string, params, out any) error {
+	calls := []*RPCCall{{Method: method, Params: params, Result: out}}
+	if err := rpc.send(ctx, calls, false); err != nil {
+		return err
+	}
+	return calls[0].Err
+}
+
+// Notify sends a notification, a call without an id that gets no response
+func (rpc *JSONRPCClient) Notify(ctx context.Context, method string, params any) error {
+	body, err := json.Marshal(rpcRequest{JSONRPC: "2.0", Method: method, Params: params})
+	if err != nil {
+		return fmt.Errorf("jsonrpc: failed to encode request: %v", err)
+	}
+	_, err = rpc.post(ctx, body)
+	return err
+}
+
+// Batch sends calls in a single request. Responses are matched to calls by id,
+// whatever order the server returns them in, and each call's Result and Err
+// are filled in. The returned error covers failures of the batch as a whole.
+func (rpc *JSONRPCClient) Batch(ctx context.Context, calls []*RPCCall) error {
+	if len(calls) == 0 {
+		return nil
+	}
+	return rpc.send(ctx, calls, true)
+}
+
+func (rpc *JSONRPCClient) send(ctx context.Context, calls []*RPCCall, batch bool) error {
+	requests := make([]rpcRequest, len(calls))
+	byID := make(map[string]*RPCCall, len(calls))
+	for i, call := range calls {
+		id := atomic.AddInt64(&rpc.nextID, 1)
+		requests[i] = rpcRequest{JSONRPC: "2.0", ID: &id, Method: call.Method, Params: call.Params}
+		byID[strconv.FormatInt(id, 10)] = call
+	}
+
+	var payload any = requests
+	if !batch {
+		payload = requests[0]
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("jsonrpc: failed to encode request: %v", err)
+	}
+	response, err := rpc.post(ctx, body)
+	if err != nil {
+		return err
+	}
+
+	var responses []rpcResponse
+	if batch {
+		err = json.Unmarshal([]byte(response.Body), &responses)
+	} else {
+		responses = make([]rpcResponse, 1)
+		err = json.Unmarshal([]byte(response.Body), &responses[0])
+	}
+	if err != nil {
+		// A server that can't parse the batch answers with a single error object
+		var single rpcResponse
+		if json.Unmarshal([]byte(response.Body), &single) == nil && single.Error != nil {
+			return single.Error
+		}
+		return fmt.Errorf("jsonrpc: failed to decode response: %v", err)
+	}
+
+	for _, r := range responses {
+		call, ok := byID[string(r.ID)]
+		if !ok {
+			if r.Error != nil {
+				return r.Error
+			}
+			return fmt.Errorf("jsonrpc: response with unknown id %s", r.ID)
+		}
+		delete(byID, string(r.ID))
+		switch {
+		case r.Error != nil:
+			call.Err = r.Error
+		case call.Result != nil:
+			if err := json.Unmarshal(r.Result, call.Result); err != nil {
+				call.Err = fmt.Errorf("jsonrpc: failed to decode result of %s: %v", call.Method, err)
+			}
+		}
+	}
+	for id, call := range byID {
+		call.Err = fmt.Errorf("jsonrpc: no response for %s (id %s)", call.Method, id)
+	}
+	return nil
+}
+
+// post sends a JSON-RPC payload and checks the HTTP status
+func (rpc *JSONRPCClient) post(ctx context.Context, body []byte) (*HttpResponse, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	headers := map[string]string{"Content-Type": "application/json", "Accept": "application/json"}
+	for k, v := range rpc.Headers {
+		headers[k] = v
+	}
+	response, err := rpc.Client.do(&HttpRequest{Method: "POST", URL: rpc.Endpoint, Headers: headers, Body: string(body)})
+	if err != nil {
+		return nil, err
+	}
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		return nil, fmt.Errorf("jsonrpc: unexpected status %d %s", response.StatusCode, response.Status)
+	}
+	return response, nil
+}
@@ -0,0 +1,95 @@
+package httpmodule
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"testing"
+)
+
+// jsonRPCHandler serves "add" and "fail" calls, answering batches in reverse order.
+func jsonRPCHandler(w http.ResponseWriter, r *http.Request) {
+	type request struct {
+		ID     json.RawMessage `json:"id"`
+		Method string          `json:"method"`
+		Params []int           `json:"params"`
+	}
+	answer := func(req request) map[string]any {
+		response := map[string]any{"jsonrpc": "2.0", "id": req.ID}
+		switch req.Method {
+		case "add":
+			sum := 0
+			for _, p := range req.Params {
+				sum += p
+			}
+			response["result"] = sum
+		default:
+			response["error"] = map[string]any{"code": -32601, "message": "Method not found", "data": req.Method}
+		}
+		return response
+	}
+
+	body, _ := io.ReadAll(r.Body)
+	var batch []request
+	if json.Unmarshal(body, &batch) == nil {
+		responses := make([]map[string]any, 0, len(batch))
+		for i := len(batch) - 1; i >= 0; i-- {
+			responses = append(responses, answer(batch[i]))
+		}
+		json.NewEncoder(w).Encode(responses)
+		return
+	}
+	var single request
+	json.Unmarshal(body, &single)
+	if single.ID == nil {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	json.NewEncoder(w).Encode(answer(single))
+}
+
+// TestJSONRPCCall tests single calls, errors, and notifications.
+func TestJSONRPCCall(t *testing.T) {
+	client := newPipeClient(t, http.HandlerFunc(jsonRPCHandler))
+	rpc := NewJSONRPCClient(client, "http://rpc.example.com/")
+
+	var sum int
+	if err := rpc.Call(context.Background(), "add", []int{2, 3}, &sum); err != nil || sum != 5 {
+		t.Error("Expected 5, got", sum, err)
+	}
+
+	err := rpc.Call(context.Background(), "subtract", []int{1}, nil)
+	var rpcErr *RPCError
+	if !errors.As(err, &rpcErr) || rpcErr.Code != -32601 || string(rpcErr.Data) != `"subtract"` {
+		t.Error("Expected a method not found error, got", err)
+	}
+
+	if err := rpc.Notify(context.Background(), "add", []int{1}); err != nil {
+		t.Error("Expected the notification to be accepted.", err)
+	}
+}
+
+// TestJSONRPCBatch tests correlating batch responses by id.
+func TestJSONRPCBatch(t *testing.T) {
+	client := newPipeClient(t, http.HandlerFunc(jsonRPCHandler))
+	rpc := NewJSONRPCClient(client, "http://rpc.example.com/")
+
+	var first, second int
+	calls := []*RPCCall{
+		{Method: "add", Params: []int{1, 1}, Result: &first},
+		{Method: "missing"},
+		{Method: "add", Params: []int{10, 20}, Result: &second},
+	}
+	if err := rpc.Batch(context.Background(), calls); err != nil {
+		t.Fatal(err)
+	}
+	if first != 2 || second != 30 || calls[0].Err != nil || calls[2].Err != nil {
+		t.Error("Expected results in call order.", first, second, calls[0].Err, calls[2].Err)
+	}
+	var rpcErr *RPCError
+	if !errors.As(calls[1].Err, &rpcErr) {
+		t.Error("Expected the failing call to carry its error, got", calls[1].Err)
+	}
+}
@@ -0,0 +1,116 @@
+package httpmodule
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// First file descriptor systemd passes listeners on, after stdin, stdout, and stderr
+var listenFDsStart = 3
+
+// ListenUnix listens on a Unix domain socket at path and sets its permissions
+// to mode, such as 0660 to let a group connect. A socket left at path by a
+// process that is no longer listening is removed first; one still in use is
+// an error. The socket file is removed when the listener is closed.
+func ListenUnix(path string, mode os.FileMode) (net.Listener, error) {
+	if info, err := os.Lstat(path); err == nil {
+		if info.Mode()&os.ModeSocket == 0 {
+			return nil, fmt.Errorf("%s exists and is not a socket", path)
+		}
+		if conn, err := net.Dial("unix", path); err == nil {
+			conn.Close()
+			return nil, fmt.Errorf("%s is in use by another process", path)
+		}
+		if err := os.Remove(path); err != nil {
+			return nil, fmt.Errorf("failed to remove stale socket: %v", err)
+		}
+	}
+
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(path, mode); err != nil {
+		listener.Close()
+		return nil, fmt.Errorf("failed to set socket permissions: %v", err)
+	}
+	return listener, nil
+}
+
+// ListenAndServeUnix listens on a Unix domain socket at path with permissions
+// mode and serves connections until the server is closed
+func (srv *Server) ListenAndServeUnix(path string, mode os.FileMode) error {
+	listener, err := ListenUnix(path, mode)
+	if err != nil {
+		return err
+	}
+	return srv.Serve(listener)
+}
+
+// SystemdListeners returns the listeners systemd passed to the process for
+// socket activation, in the order of the unit's ListenStream= lines, and
+// their names from FileDescriptorName=, or nil if there are none. Each is
+// returned once; later calls get nil.
+func SystemdListeners() ([]net.Listener, []string, error) {
+	if os.Getenv("LISTEN_PID") != strconv.Itoa(os.Getpid()) {
+		// Meant for another process, such as the parent that exec'd this one
+		return nil, nil, nil
+	}
+	count, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	if err != nil || count < 0 {
+		return nil, nil, errors.New("malformed LISTEN_FDS")
+	}
+	names := strings.Split(os.Getenv("LISTEN_FDNAMES"), ":")
+	if len(names) != count {
+		names = make([]string, count)
+	}
+
+	// Child processes mustn't take them too
+	os.Unsetenv("LISTEN_PID")
+	os.Unsetenv("LISTEN_FDS")
+	os.Unsetenv("LISTEN_FDNAMES")
+
+	listeners := make([]net.Listener, 0, count)
+	for i := 0; i < count; i++ {
+		listener, err := ListenerFromFD(uintptr(listenFDsStart+i), names[i])
+		if err != nil {
+			for _, l := range listeners {
+				l.Close()
+			}
+			return nil, nil, err
+		}
+		listeners = append(listeners, listener)
+	}
+	return listeners, names, nil
+}
+
+// ListenerFromFD adopts a listening socket inherited as file descriptor fd,
+// such as one passed by a parent process restarting without dropping
+// connections. The descriptor is closed; the listener holds a copy.
+func ListenerFromFD(fd uintptr, name string) (net.Listener, error) {
+	file := os.NewFile(fd, name)
+	if file == nil {
+		return nil, fmt.Errorf("invalid file descriptor %d", fd)
+	}
+	defer file.Close()
+	listener, err := net.FileListener(file)
+	if err != nil {
+		return nil, fmt.Errorf("file descriptor %d is not a listening socket: %v", fd, err)
+	}
+	return listener, nil
+}
+
+// ListenerFile returns a copy of listener's file descriptor, to be passed to
+// a new process, for example in exec.Cmd's ExtraFiles, which can adopt it
+// with ListenerFromFD
+func ListenerFile(listener net.Listener) (*os.File, error) {
+	filer, ok := listener.(interface{ File() (*os.File, error) })
+	if !ok {
+		return nil, errors.New("listener has no file descriptor")
+	}
+	return filer.File()
+}
@@ -0,0 +1,121 @@
+package httpmodule
+
+import (
+	"bufio"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// getOver sends a GET over conn and returns the status line.
+func getOver(t *testing.T, conn net.Conn) string {
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	conn.Write([]byte("GET / HTTP/1.1\r\nHost: x\r\nConnection: close\r\n\r\n"))
+	line, err := bufio.NewReader(conn).ReadString('\n')
+	if err != nil {
+		t.Fatal(err)
+	}
+	return strings.TrimSpace(line)
+}
+
+// TestListenUnix tests serving on a Unix socket with permissions and stale socket cleanup.
+func TestListenUnix(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "http.sock")
+
+	// A socket left behind by a process that died
+	stale, err := net.Listen("unix", path)
+	if err != nil {
+		t.Skip("Unix sockets unavailable:", err)
+	}
+	stale.(*net.UnixListener).SetUnlinkOnClose(false)
+	stale.Close()
+
+	listener, err := ListenUnix(path, 0660)
+	if err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(path)
+	if err != nil || info.Mode().Perm() != 0660 {
+		t.Error("Expected permissions 0660, got", info.Mode().Perm(), err)
+	}
+	if _, err := ListenUnix(path, 0660); err == nil {
+		t.Error("Expected an error for a socket in use.")
+	}
+
+	srv := &Server{Handler: echoHandler}
+	go srv.Serve(listener)
+	conn, err := net.Dial("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if line := getOver(t, conn); line != "HTTP/1.1 200 OK" {
+		t.Error("Expected a response over the socket, got", line)
+	}
+
+	srv.Close()
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Error("Expected the socket file to be removed on close, got", err)
+	}
+
+	regular := filepath.Join(t.TempDir(), "file")
+	os.WriteFile(regular, nil, 0600)
+	if _, err := ListenUnix(regular, 0600); err == nil {
+		t.Error("Expected an error for a path that isn't a socket.")
+	}
+}
+
+// TestSystemdListeners tests adopting listeners passed by socket activation.
+func TestSystemdListeners(t *testing.T) {
+	parent, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer parent.Close()
+	file, err := ListenerFile(parent)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	defer func(start int) { listenFDsStart = start }(listenFDsStart)
+	listenFDsStart = int(file.Fd())
+	t.Setenv("LISTEN_PID", strconv.Itoa(os.Getpid()))
+	t.Setenv("LISTEN_FDS", "1")
+	t.Setenv("LISTEN_FDNAMES", "web")
+
+	listeners, names, err := SystemdListeners()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(listeners) != 1 || names[0] != "web" || listeners[0].Addr().String() != parent.Addr().String() {
+		t.Fatal("Expected the inherited listener named web, got", listeners, names)
+	}
+	if os.Getenv("LISTEN_FDS") != "" {
+		t.Error("Expected the environment to be cleared for child processes.")
+	}
+	if again, _, _ := SystemdListeners(); again != nil {
+		t.Error("Expected the listeners to be handed out once.")
+	}
+
+	srv := &Server{Handler: echoHandler}
+	go srv.Serve(listeners[0])
+	defer srv.Close()
+	conn, err := net.Dial("tcp", parent.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if line := getOver(t, conn); line != "HTTP/1.1 200 OK" {
+		t.Error("Expected the adopted listener to serve, got", line)
+	}
+
+	t.Setenv("LISTEN_PID", "1")
+	t.Setenv("LISTEN_FDS", "1")
+	if listeners, _, err := SystemdListeners(); listeners != nil || err != nil {
+		t.Error("Expected listeners meant for another process to be ignored.")
+	}
+}
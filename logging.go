@@ -0,0 +1,130 @@
+package httpmodule
+
+import (
+	neturl "net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Logger receives a client's log messages, each with pairs of keys and
+// values after it, as log/slog takes them, so a *slog.Logger can be used
+// as one directly
+type Logger interface {
+	Debug(msg string, keysAndValues ...any)
+	Info(msg string, keysAndValues ...any)
+	Warn(msg string, keysAndValues ...any)
+}
+
+// logRequestStart logs req being sent
+func (client *HttpClient) logRequestStart(req *HttpRequest) {
+	if client.Logger == nil {
+		return
+	}
+	client.Logger.Debug("sending request", "method", req.Method, "url", logURL(req.URL))
+}
+
+// logRequestDone logs req finishing with response or failing with err after
+// taking duration
+func (client *HttpClient) logRequestDone(req *HttpRequest, response *HttpResponse, err error, duration time.Duration) {
+	if client.Logger == nil {
+		return
+	}
+	if err != nil {
+		client.Logger.Warn("request failed", "method", req.Method, "url", logURL(req.URL), "error", err, "duration", duration)
+		return
+	}
+	client.Logger.Info("request finished", "method", req.Method, "url", logURL(req.URL), "status", response.StatusCode,
+		"duration", duration, "attempts", response.Attempts)
+}
+
+// logRetry logs req being tried again after the given attempt ended in
+// response or err
+func (client *HttpClient) logRetry(req *HttpRequest, attempt int, wait time.Duration, response *HttpResponse, err error) {
+	if client.Logger == nil {
+		return
+	}
+	reason := any(err)
+	if err == nil {
+		reason = response.StatusCode
+	}
+	client.Logger.Warn("retrying request", "method", req.Method, "url", logURL(req.URL), "attempt", attempt, "reason", reason, "wait", wait)
+}
+
+// withWireLog wraps transport to log the head of each request it sends and
+// of each response it receives at debug level, one line per message, as
+// curl's verbose mode shows them. Requests are logged before the protocol is
+// negotiated, so one opening a connection on which the server then chooses
+// HTTP/2 is shown as HTTP/1.1.
+func (client *HttpClient) withWireLog(transport Transport) Transport {
+	return RoundTripFunc(func(req *HttpRequest) (*HttpResponse, error) {
+		if u, err := neturl.Parse(req.URL); err == nil {
+			http2 := client.Transport == nil && client.usesHTTP2(req)
+			if http2 {
+				client.Logger.Debug("> " + req.Method + " " + originForm(u) + " HTTP/2.0")
+			} else {
+				client.Logger.Debug("> " + req.Method + " " + originForm(u) + " HTTP/1.1")
+			}
+			var lines []string
+			client.eachRequestHeader(u.Host, req.Headers, func(k, v string) {
+				if http2 && isConnectionSpecific(k) {
+					// Not sent, as HTTP/2 has no connection headers
+					return
+				}
+				lines = append(lines, "> "+k+": "+client.logHeaderValue(k, v))
+			})
+			sort.Strings(lines)
+			for _, line := range lines {
+				client.Logger.Debug(line)
+			}
+		}
+		response, err := transport.RoundTrip(req)
+		if err != nil {
+			return response, err
+		}
+		protocol := response.Protocol
+		if protocol == "" {
+			protocol = "HTTP/1.1"
+		}
+		client.Logger.Debug("< " + protocol + " " + strconv.Itoa(response.StatusCode) + " " + response.Status)
+		keys := make([]string, 0, len(response.Headers))
+		for k := range response.Headers {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			values := []string{response.Headers[k]}
+			if strings.EqualFold(k, "Set-Cookie") {
+				values = response.Header().Values(k)
+			}
+			for _, v := range values {
+				client.Logger.Debug("< " + k + ": " + client.logHeaderValue(k, v))
+			}
+		}
+		return response, nil
+	})
+}
+
+// logHeaderValue returns the value to log for header key: value itself, or
+// a mask for secrets
+func (client *HttpClient) logHeaderValue(key, value string) string {
+	if isSecretHeader(key) {
+		return redactedValue
+	}
+	for _, name := range client.LogRedactHeaders {
+		if strings.EqualFold(key, name) {
+			return redactedValue
+		}
+	}
+	return value
+}
+
+// logURL returns url with any password in it masked
+func logURL(url string) string {
+	u, err := neturl.Parse(url)
+	if err != nil {
+		return url
+	}
+	return u.Redacted()
+}
@@ -0,0 +1,231 @@
+package httpmodule
+
+import (
+	"encoding/json"
+	"fmt"
+	neturl "net/url"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Matcher decides whether a request has some property. Matchers built here
+// compose with And, Or, and Not, and are accepted by MockTransport,
+// Recorder, and FaultInjector wherever they select requests.
+type Matcher interface {
+	Match(req *HttpRequest) bool
+}
+
+// MatcherFunc adapts an ordinary function to the Matcher interface
+type MatcherFunc func(req *HttpRequest) bool
+
+func (f MatcherFunc) Match(req *HttpRequest) bool {
+	return f(req)
+}
+
+// matcher is a Matcher with a description, used in test failure messages
+type matcher struct {
+	desc  string
+	match func(req *HttpRequest) bool
+}
+
+func (m matcher) Match(req *HttpRequest) bool {
+	return m.match(req)
+}
+
+func (m matcher) String() string {
+	return m.desc
+}
+
+// describe returns a readable description of m
+func describe(m Matcher) string {
+	if s, ok := m.(fmt.Stringer); ok {
+		return s.String()
+	}
+	return "func"
+}
+
+// And matches requests matched by every one of matchers
+func And(matchers ...Matcher) Matcher {
+	return matcher{
+		desc: join("and", matchers),
+		match: func(req *HttpRequest) bool {
+			for _, m := range matchers {
+				if !m.Match(req) {
+					return false
+				}
+			}
+			return true
+		},
+	}
+}
+
+// Or matches requests matched by at least one of matchers
+func Or(matchers ...Matcher) Matcher {
+	return matcher{
+		desc: join("or", matchers),
+		match: func(req *HttpRequest) bool {
+			for _, m := range matchers {
+				if m.Match(req) {
+					return true
+				}
+			}
+			return false
+		},
+	}
+}
+
+// Not matches requests m doesn't match
+func Not(m Matcher) Matcher {
+	return matcher{
+		desc:  "not(" + describe(m) + ")",
+		match: func(req *HttpRequest) bool { return !m.Match(req) },
+	}
+}
+
+func join(op string, matchers []Matcher) string {
+	parts := make([]string, len(matchers))
+	for i, m := range matchers {
+		parts[i] = describe(m)
+	}
+	return op + "(" + strings.Join(parts, ", ") + ")"
+}
+
+// MatchMethod matches requests with the given method, ignoring case
+func MatchMethod(method string) Matcher {
+	return matcher{
+		desc:  "method " + method,
+		match: func(req *HttpRequest) bool { return strings.EqualFold(req.Method, method) },
+	}
+}
+
+// MatchURL matches requests for exactly url
+func MatchURL(url string) Matcher {
+	return matcher{
+		desc:  "url " + url,
+		match: func(req *HttpRequest) bool { return req.URL == url },
+	}
+}
+
+// MatchHost matches requests to host, ignoring case. A host without a port
+// matches any port.
+func MatchHost(host string) Matcher {
+	return matcher{
+		desc: "host " + host,
+		match: func(req *HttpRequest) bool {
+			parsedURL, err := neturl.Parse(req.URL)
+			if err != nil {
+				return false
+			}
+			if strings.Contains(host, ":") {
+				return strings.EqualFold(parsedURL.Host, host)
+			}
+			return strings.EqualFold(parsedURL.Hostname(), host)
+		},
+	}
+}
+
+// MatchPath matches requests whose URL path matches the regular expression
+// pattern. It panics if the pattern doesn't compile.
+func MatchPath(pattern string) Matcher {
+	re := regexp.MustCompile(pattern)
+	return matcher{
+		desc: "path " + pattern,
+		match: func(req *HttpRequest) bool {
+			parsedURL, err := neturl.Parse(req.URL)
+			return err == nil && re.MatchString(parsedURL.Path)
+		},
+	}
+}
+
+// MatchQuery matches requests whose query string has key set to value
+func MatchQuery(key, value string) Matcher {
+	return matcher{
+		desc: "query " + key + "=" + value,
+		match: func(req *HttpRequest) bool {
+			parsedURL, err := neturl.Parse(req.URL)
+			if err != nil {
+				return false
+			}
+			for _, v := range parsedURL.Query()[key] {
+				if v == value {
+					return true
+				}
+			}
+			return false
+		},
+	}
+}
+
+// MatchHeader matches requests carrying header key with exactly value. Header
+// names are compared case-insensitively.
+func MatchHeader(key, value string) Matcher {
+	return matcher{
+		desc: "header " + key + ": " + value,
+		match: func(req *HttpRequest) bool {
+			for k, v := range req.Headers {
+				if strings.EqualFold(k, key) && v == value {
+					return true
+				}
+			}
+			return false
+		},
+	}
+}
+
+// MatchBody matches requests whose body is exactly body
+func MatchBody(body string) Matcher {
+	return matcher{
+		desc:  "body " + strconv.Quote(body),
+		match: func(req *HttpRequest) bool { return req.Body == body },
+	}
+}
+
+// MatchJSON matches requests whose body is JSON with value at path. The path
+// is a dot-separated list of object keys and array indexes, such as
+// "items.0.id"; value is compared after a round trip through JSON, so 1 and
+// 1.0 are the same.
+func MatchJSON(path string, value any) Matcher {
+	var want any
+	if data, err := json.Marshal(value); err == nil {
+		json.Unmarshal(data, &want)
+	}
+	return matcher{
+		desc: "json " + path,
+		match: func(req *HttpRequest) bool {
+			var doc any
+			if err := json.Unmarshal([]byte(req.Body), &doc); err != nil {
+				return false
+			}
+			got, ok := jsonPath(doc, path)
+			return ok && reflect.DeepEqual(got, want)
+		},
+	}
+}
+
+// jsonPath walks doc along a dot-separated path
+func jsonPath(doc any, path string) (any, bool) {
+	if path == "" {
+		return doc, true
+	}
+	for _, part := range strings.Split(path, ".") {
+		switch node := doc.(type) {
+		case map[string]any:
+			next, ok := node[part]
+			if !ok {
+				return nil, false
+			}
+			doc = next
+		case []any:
+			i, err := strconv.Atoi(part)
+			if err != nil || i < 0 || i >= len(node) {
+				return nil, false
+			}
+			doc = node[i]
+		default:
+			return nil, false
+		}
+	}
+	return doc, true
+}
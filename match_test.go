@@ -0,0 +1,56 @@
+package httpmodule
+
+import (
+	"testing"
+)
+
+// TestMatchers tests each matcher and their combinations.
+func TestMatchers(t *testing.T) {
+	req := &HttpRequest{
+		Method:  "POST",
+		URL:     "https://api.example.com:8443/v1/users?role=admin&page=2",
+		Headers: map[string]string{"Content-Type": "application/json"},
+		Body:    `{"user":{"name":"alice","tags":["a","b"]},"age":30}`,
+	}
+
+	tests := []struct {
+		name    string
+		matcher Matcher
+		want    bool
+	}{
+		{"method", MatchMethod("post"), true},
+		{"other method", MatchMethod("GET"), false},
+		{"host", MatchHost("API.example.com"), true},
+		{"host and port", MatchHost("api.example.com:8443"), true},
+		{"wrong port", MatchHost("api.example.com:443"), false},
+		{"path", MatchPath(`^/v1/users$`), true},
+		{"other path", MatchPath(`^/v2/`), false},
+		{"query", MatchQuery("role", "admin"), true},
+		{"other query", MatchQuery("role", "guest"), false},
+		{"header", MatchHeader("content-type", "application/json"), true},
+		{"missing header", MatchHeader("Accept", "*/*"), false},
+		{"json string", MatchJSON("user.name", "alice"), true},
+		{"json index", MatchJSON("user.tags.1", "b"), true},
+		{"json number", MatchJSON("age", 30), true},
+		{"json mismatch", MatchJSON("user.name", "bob"), false},
+		{"json missing", MatchJSON("user.email", "x"), false},
+		{"and", And(MatchMethod("POST"), MatchPath("users")), true},
+		{"and failing", And(MatchMethod("POST"), MatchPath("orders")), false},
+		{"or", Or(MatchMethod("GET"), MatchQuery("page", "2")), true},
+		{"not", Not(MatchMethod("GET")), true},
+		{"func", MatcherFunc(func(req *HttpRequest) bool { return len(req.Body) > 10 }), true},
+	}
+	for _, test := range tests {
+		if got := test.matcher.Match(req); got != test.want {
+			t.Errorf("Expected %s (%s) to be %v, got %v", test.name, describe(test.matcher), test.want, got)
+		}
+	}
+}
+
+// TestMatcherDescription tests the descriptions used in failure messages.
+func TestMatcherDescription(t *testing.T) {
+	m := And(MatchMethod("GET"), Not(MatchHost("example.com")))
+	if got := describe(m); got != "and(method GET, not(host example.com))" {
+		t.Error("Expected a readable description, got", got)
+	}
+}
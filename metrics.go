@@ -0,0 +1,317 @@
+package httpmodule
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Histogram buckets for request durations in seconds when none are given
+var DefaultDurationBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// Metrics is a registry of counters, gauges, and histograms, served as a
+// Handler in the Prometheus text exposition format
+type Metrics struct {
+	mu       sync.Mutex
+	families []*metricFamily
+	byName   map[string]*metricFamily
+}
+
+// NewMetrics returns an empty registry
+func NewMetrics() *Metrics {
+	return &Metrics{byName: make(map[string]*metricFamily)}
+}
+
+// metricFamily is one named metric and its series, one per set of label values
+type metricFamily struct {
+	name    string
+	help    string
+	kind    string
+	labels  []string
+	buckets []float64
+
+	mu     sync.Mutex
+	series map[string]*metricSeries
+}
+
+type metricSeries struct {
+	labelValues []string
+	value       float64
+	counts      []uint64 // per bucket, not cumulative; histograms only
+	count       uint64
+}
+
+// Counter is a value that only goes up, such as requests served
+type Counter struct{ family *metricFamily }
+
+// Gauge is a value that goes up and down, such as requests in flight
+type Gauge struct{ family *metricFamily }
+
+// Histogram counts observations, such as latencies, into buckets
+type Histogram struct{ family *metricFamily }
+
+// Counter registers a counter, or returns the one already registered under
+// name. Values are recorded with one label value per label name.
+func (m *Metrics) Counter(name, help string, labels ...string) *Counter {
+	return &Counter{m.register(name, help, "counter", labels, nil)}
+}
+
+// Gauge registers a gauge, or returns the one already registered under name
+func (m *Metrics) Gauge(name, help string, labels ...string) *Gauge {
+	return &Gauge{m.register(name, help, "gauge", labels, nil)}
+}
+
+// Histogram registers a histogram with the given upper bucket bounds, or
+// DefaultDurationBuckets if nil, or returns the one already registered
+// under name
+func (m *Metrics) Histogram(name, help string, buckets []float64, labels ...string) *Histogram {
+	if buckets == nil {
+		buckets = DefaultDurationBuckets
+	}
+	buckets = append([]float64(nil), buckets...)
+	sort.Float64s(buckets)
+	return &Histogram{m.register(name, help, "histogram", labels, buckets)}
+}
+
+func (m *Metrics) register(name, help, kind string, labels []string, buckets []float64) *metricFamily {
+	if !validMetricName(name) {
+		panic(fmt.Sprintf("httpmodule: invalid metric name %q", name))
+	}
+	for _, label := range labels {
+		if !validMetricName(label) || strings.Contains(label, ":") || label == "le" {
+			panic(fmt.Sprintf("httpmodule: invalid label name %q", label))
+		}
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if family, ok := m.byName[name]; ok {
+		if family.kind != kind || len(family.labels) != len(labels) {
+			panic(fmt.Sprintf("httpmodule: metric %q registered twice with different kinds or labels", name))
+		}
+		return family
+	}
+	family := &metricFamily{
+		name:    name,
+		help:    help,
+		kind:    kind,
+		labels:  append([]string(nil), labels...),
+		buckets: buckets,
+		series:  make(map[string]*metricSeries),
+	}
+	m.families = append(m.families, family)
+	m.byName[name] = family
+	return family
+}
+
+// Inc adds one to the counter
+func (c *Counter) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+// Add adds delta, which must not be negative, to the counter
+func (c *Counter) Add(delta float64, labelValues ...string) {
+	if delta < 0 {
+		panic("httpmodule: counters cannot decrease")
+	}
+	c.family.update(labelValues, func(s *metricSeries) { s.value += delta })
+}
+
+// Set sets the gauge
+func (g *Gauge) Set(value float64, labelValues ...string) {
+	g.family.update(labelValues, func(s *metricSeries) { s.value = value })
+}
+
+// Add adds delta, which may be negative, to the gauge
+func (g *Gauge) Add(delta float64, labelValues ...string) {
+	g.family.update(labelValues, func(s *metricSeries) { s.value += delta })
+}
+
+// Inc adds one to the gauge
+func (g *Gauge) Inc(labelValues ...string) {
+	g.Add(1, labelValues...)
+}
+
+// Dec subtracts one from the gauge
+func (g *Gauge) Dec(labelValues ...string) {
+	g.Add(-1, labelValues...)
+}
+
+// Observe records one value in the histogram
+func (h *Histogram) Observe(value float64, labelValues ...string) {
+	buckets := h.family.buckets
+	h.family.update(labelValues, func(s *metricSeries) {
+		if s.counts == nil {
+			s.counts = make([]uint64, len(buckets))
+		}
+		if i := sort.SearchFloat64s(buckets, value); i < len(buckets) {
+			s.counts[i]++
+		}
+		s.count++
+		s.value += value
+	})
+}
+
+// update applies change to the series for labelValues, creating it if needed
+func (family *metricFamily) update(labelValues []string, change func(s *metricSeries)) {
+	if len(labelValues) != len(family.labels) {
+		panic(fmt.Sprintf("httpmodule: metric %q takes %d label values, got %d", family.name, len(family.labels), len(labelValues)))
+	}
+	key := strings.Join(labelValues, "\xff")
+
+	family.mu.Lock()
+	defer family.mu.Unlock()
+	s, ok := family.series[key]
+	if !ok {
+		s = &metricSeries{labelValues: append([]string(nil), labelValues...)}
+		family.series[key] = s
+	}
+	change(s)
+}
+
+// ServeHTTP serves the registry in the Prometheus text format
+func (m *Metrics) ServeHTTP(w ResponseWriter, req *ServerRequest) {
+	var buf bytes.Buffer
+	m.WriteTo(&buf)
+	headers := w.Header()
+	headers["Content-Type"] = "text/plain; version=0.0.4; charset=utf-8"
+	headers["Cache-Control"] = "no-store"
+	w.WriteHeader(200)
+	w.Write(buf.Bytes())
+}
+
+// WriteTo writes the registry in the Prometheus text format, families in the
+// order they were registered and series sorted by label values
+func (m *Metrics) WriteTo(w io.Writer) (int64, error) {
+	m.mu.Lock()
+	families := m.families
+	m.mu.Unlock()
+
+	var buf bytes.Buffer
+	for _, family := range families {
+		family.write(&buf)
+	}
+	n, err := w.Write(buf.Bytes())
+	return int64(n), err
+}
+
+func (family *metricFamily) write(buf *bytes.Buffer) {
+	family.mu.Lock()
+	defer family.mu.Unlock()
+	if family.help != "" {
+		fmt.Fprintf(buf, "# HELP %s %s\n", family.name, escapeMetricHelp(family.help))
+	}
+	fmt.Fprintf(buf, "# TYPE %s %s\n", family.name, family.kind)
+
+	keys := make([]string, 0, len(family.series))
+	for key := range family.series {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		s := family.series[key]
+		if family.kind != "histogram" {
+			fmt.Fprintf(buf, "%s%s %s\n", family.name, family.labelSet(s.labelValues, ""), formatMetricValue(s.value))
+			continue
+		}
+		var cumulative uint64
+		for i, bound := range family.buckets {
+			cumulative += s.counts[i]
+			fmt.Fprintf(buf, "%s_bucket%s %d\n", family.name, family.labelSet(s.labelValues, formatMetricValue(bound)), cumulative)
+		}
+		fmt.Fprintf(buf, "%s_bucket%s %d\n", family.name, family.labelSet(s.labelValues, "+Inf"), s.count)
+		fmt.Fprintf(buf, "%s_sum%s %s\n", family.name, family.labelSet(s.labelValues, ""), formatMetricValue(s.value))
+		fmt.Fprintf(buf, "%s_count%s %d\n", family.name, family.labelSet(s.labelValues, ""), s.count)
+	}
+}
+
+// labelSet formats labels as {name="value",...}, adding le for a histogram
+// bucket, or "" if there are none
+func (family *metricFamily) labelSet(values []string, le string) string {
+	var pairs []string
+	for i, name := range family.labels {
+		pairs = append(pairs, name+`="`+escapeLabelValue(values[i])+`"`)
+	}
+	if le != "" {
+		pairs = append(pairs, `le="`+le+`"`)
+	}
+	if len(pairs) == 0 {
+		return ""
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+func formatMetricValue(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+var metricHelpEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+var labelValueEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+
+func escapeMetricHelp(s string) string { return metricHelpEscaper.Replace(s) }
+func escapeLabelValue(s string) string { return labelValueEscaper.Replace(s) }
+
+// validMetricName reports whether name matches [a-zA-Z_:][a-zA-Z0-9_:]*
+func validMetricName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for i, c := range name {
+		letter := c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c == '_' || c == ':'
+		if !letter && (i == 0 || c < '0' || c > '9') {
+			return false
+		}
+	}
+	return true
+}
+
+// Middleware returns middleware that records every request in the registry:
+// http_requests_total by method and status, http_request_duration_seconds by
+// method, and http_requests_in_flight. clock times requests; nil uses the
+// real clock.
+func (m *Metrics) Middleware(clock Clock) Middleware {
+	clock = clockOrReal(clock)
+	total := m.Counter("http_requests_total", "Requests handled, by method and status.", "method", "code")
+	duration := m.Histogram("http_request_duration_seconds", "Time taken to handle requests, by method.", nil, "method")
+	inFlight := m.Gauge("http_requests_in_flight", "Requests being handled.")
+	return func(next Handler) Handler {
+		return HandlerFunc(func(w ResponseWriter, req *ServerRequest) {
+			inFlight.Inc()
+			defer inFlight.Dec()
+			start := clock.Now()
+			sw := &statusWriter{ResponseWriter: w}
+			next.ServeHTTP(sw, req)
+
+			status := sw.status
+			if status == 0 {
+				status = 200
+			}
+			method := metricMethod(req.Method)
+			total.Inc(method, strconv.Itoa(status))
+			duration.Observe(clock.Now().Sub(start).Seconds(), method)
+		})
+	}
+}
+
+// metricMethod returns method, or "OTHER" for nonstandard ones, so clients
+// can't create series without bound
+func metricMethod(method string) string {
+	switch method {
+	case "GET", "HEAD", "POST", "PUT", "PATCH", "DELETE", "OPTIONS", "CONNECT", "TRACE":
+		return method
+	}
+	return "OTHER"
+}
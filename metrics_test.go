@@ -0,0 +1,102 @@
+package httpmodule
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestMetricsExposition tests the Prometheus text format for each metric kind.
+func TestMetricsExposition(t *testing.T) {
+	metrics := NewMetrics()
+	jobs := metrics.Counter("jobs_total", "Jobs run.\nBy queue.", "queue")
+	jobs.Inc("emails")
+	jobs.Add(2, `say "hi"`)
+	jobs.Inc("emails")
+	metrics.Gauge("workers", "").Set(3)
+	latency := metrics.Histogram("job_seconds", "Job latency.", []float64{1, 0.1})
+	latency.Observe(0.05)
+	latency.Observe(0.1)
+	latency.Observe(5)
+
+	if metrics.Counter("jobs_total", "", "queue") == nil {
+		t.Error("Expected re-registering to return the counter.")
+	}
+
+	var b strings.Builder
+	metrics.WriteTo(&b)
+	want := `# HELP jobs_total Jobs run.\nBy queue.
+# TYPE jobs_total counter
+jobs_total{queue="emails"} 2
+jobs_total{queue="say \"hi\""} 2
+# TYPE workers gauge
+workers 3
+# HELP job_seconds Job latency.
+# TYPE job_seconds histogram
+job_seconds_bucket{le="0.1"} 2
+job_seconds_bucket{le="1"} 2
+job_seconds_bucket{le="+Inf"} 3
+job_seconds_sum 5.15
+job_seconds_count 3
+`
+	if b.String() != want {
+		t.Errorf("Expected:\n%s\ngot:\n%s", want, b.String())
+	}
+
+	rec := serve(metrics, "GET", "/metrics")
+	if !strings.HasPrefix(rec.headers["Content-Type"], "text/plain; version=0.0.4") || string(rec.body) != want {
+		t.Error("Expected the registry to be served, got", rec.headers)
+	}
+}
+
+// TestMetricsMisuse tests that bad names and label counts are caught.
+func TestMetricsMisuse(t *testing.T) {
+	metrics := NewMetrics()
+	panics := func(name string, f func()) {
+		defer func() {
+			if recover() == nil {
+				t.Error("Expected a panic for", name)
+			}
+		}()
+		f()
+	}
+	panics("a bad name", func() { metrics.Counter("9lives", "") })
+	panics("a bad label", func() { metrics.Counter("ok", "", "le") })
+	panics("a kind clash", func() {
+		metrics.Gauge("clash", "")
+		metrics.Counter("clash", "")
+	})
+	panics("missing label values", func() { metrics.Counter("labelled", "", "a").Inc() })
+	panics("a decreasing counter", func() { metrics.Counter("down", "").Add(-1) })
+}
+
+// TestMetricsMiddleware tests the request counters and latency histogram.
+func TestMetricsMiddleware(t *testing.T) {
+	clock := NewFakeClock(time.Unix(0, 0))
+	metrics := NewMetrics()
+	router := NewRouter()
+	router.Use(metrics.Middleware(clock))
+	router.HandleFunc("GET", "/slow", func(w ResponseWriter, req *ServerRequest) {
+		clock.Advance(300 * time.Millisecond)
+		w.Write([]byte("done"))
+	})
+	serve(router, "GET", "/slow")
+	serve(router, "GET", "/missing")
+	serve(router, "BREW", "/slow")
+
+	var b strings.Builder
+	metrics.WriteTo(&b)
+	out := b.String()
+	for _, line := range []string{
+		`http_requests_total{method="GET",code="200"} 1`,
+		`http_requests_total{method="GET",code="404"} 1`,
+		`http_requests_total{method="OTHER",code="405"} 1`,
+		`http_request_duration_seconds_bucket{method="GET",le="0.25"} 1`,
+		`http_request_duration_seconds_bucket{method="GET",le="0.5"} 2`,
+		`http_requests_in_flight 0`,
+	} {
+		if !strings.Contains(out, line+"\n") {
+			t.Errorf("Expected %q in:\n%s", line, out)
+		}
+	}
+}
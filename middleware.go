@@ -0,0 +1,93 @@
+package httpmodule
+
+import (
+	"bufio"
+	"errors"
+	"log"
+	"net"
+	"runtime/debug"
+)
+
+// Middleware wraps a Handler with behaviour that runs around it, such as
+// logging or authentication
+type Middleware func(next Handler) Handler
+
+// Chain combines middleware into one, the first being the outermost
+func Chain(middleware ...Middleware) Middleware {
+	return func(next Handler) Handler {
+		for i := len(middleware) - 1; i >= 0; i-- {
+			next = middleware[i](next)
+		}
+		return next
+	}
+}
+
+// statusWriter is a ResponseWriter that remembers the status and how much of
+// the body has been written, for middleware that needs to know
+type statusWriter struct {
+	ResponseWriter
+	status  int
+	written int64
+}
+
+func (w *statusWriter) WriteHeader(statusCode int) {
+	if w.status == 0 {
+		w.status = statusCode
+	}
+	w.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (w *statusWriter) Write(p []byte) (int, error) {
+	if w.status == 0 {
+		w.status = 200
+	}
+	n, err := w.ResponseWriter.Write(p)
+	w.written += int64(n)
+	return n, err
+}
+
+func (w *statusWriter) Flush() {
+	if flusher, ok := w.ResponseWriter.(Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+func (w *statusWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := w.ResponseWriter.(Hijacker)
+	if !ok {
+		return nil, nil, errors.New("response does not support hijacking")
+	}
+	return hijacker.Hijack()
+}
+
+// Recovery returns middleware that turns a panicking handler into a 500
+// response, logging the panic and its stack to logger, or the standard logger
+// if nil. If the handler had already started its response, the panic is
+// passed on so the server drops the connection instead of sending a
+// truncated body as if it were complete. ErrAbortHandler is always passed on.
+func Recovery(logger *log.Logger) Middleware {
+	return func(next Handler) Handler {
+		return HandlerFunc(func(w ResponseWriter, req *ServerRequest) {
+			sw := &statusWriter{ResponseWriter: w}
+			defer func() {
+				err := recover()
+				if err == nil {
+					return
+				}
+				if err == ErrAbortHandler {
+					panic(err)
+				}
+				if logger != nil {
+					logger.Printf("httpmodule: panic serving %s %s: %v\n%s", req.Method, req.Path, err, debug.Stack())
+				} else {
+					log.Printf("httpmodule: panic serving %s %s: %v\n%s", req.Method, req.Path, err, debug.Stack())
+				}
+				if sw.status != 0 {
+					panic(err)
+				}
+				w.WriteHeader(500)
+			}()
+			next.ServeHTTP(sw, req)
+		})
+	}
+}
@@ -0,0 +1,113 @@
+package httpmodule
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// tag returns middleware that records its name before and after the handler.
+func tag(name string, trace *[]string) Middleware {
+	return func(next Handler) Handler {
+		return HandlerFunc(func(w ResponseWriter, req *ServerRequest) {
+			*trace = append(*trace, name)
+			next.ServeHTTP(w, req)
+			*trace = append(*trace, "/"+name)
+		})
+	}
+}
+
+// TestChain tests that middleware runs in order, the first outermost.
+func TestChain(t *testing.T) {
+	var trace []string
+	handler := Chain(tag("a", &trace), tag("b", &trace))(HandlerFunc(func(w ResponseWriter, req *ServerRequest) {
+		trace = append(trace, "handler")
+	}))
+	serve(handler, "GET", "/")
+	if strings.Join(trace, " ") != "a b handler /b /a" {
+		t.Error("Expected nested middleware, got", trace)
+	}
+}
+
+// TestRouterMiddleware tests router, group, and per-route middleware.
+func TestRouterMiddleware(t *testing.T) {
+	var trace []string
+	router := NewRouter()
+	router.Use(tag("router", &trace))
+	admin := router.Group("/admin")
+	admin.Use(tag("group", &trace))
+	admin.HandleFunc("GET", "/stats", func(w ResponseWriter, req *ServerRequest) {
+		trace = append(trace, "stats")
+	}, tag("route", &trace))
+	router.HandleFunc("GET", "/open", func(w ResponseWriter, req *ServerRequest) {
+		trace = append(trace, "open")
+	})
+
+	serve(router, "GET", "/admin/stats")
+	if strings.Join(trace, " ") != "router group route stats /route /group /router" {
+		t.Error("Expected router, group, then route middleware, got", trace)
+	}
+
+	trace = nil
+	serve(router, "GET", "/open")
+	if strings.Join(trace, " ") != "router open /router" {
+		t.Error("Expected only router middleware, got", trace)
+	}
+
+	trace = nil
+	if rec := serve(router, "GET", "/missing"); rec.status != 404 || strings.Join(trace, " ") != "router /router" {
+		t.Error("Expected router middleware around 404s, got", rec.status, trace)
+	}
+}
+
+// TestRecovery tests turning a panic into a 500 response.
+func TestRecovery(t *testing.T) {
+	var logs bytes.Buffer
+	handler := Recovery(log.New(&logs, "", 0))(HandlerFunc(func(w ResponseWriter, req *ServerRequest) {
+		panic("boom")
+	}))
+	if rec := serve(handler, "GET", "/"); rec.status != 500 {
+		t.Error("Expected a 500 response, got", rec.status)
+	}
+	if !strings.Contains(logs.String(), "panic serving GET /: boom") || !strings.Contains(logs.String(), "goroutine") {
+		t.Error("Expected the panic and stack to be logged, got", logs.String())
+	}
+
+	// Once the response has started, the panic must reach the server
+	handler = Recovery(log.New(&logs, "", 0))(HandlerFunc(func(w ResponseWriter, req *ServerRequest) {
+		fmt.Fprint(w, "partial")
+		panic("late")
+	}))
+	defer func() {
+		if recover() != "late" {
+			t.Error("Expected the panic to be passed on.")
+		}
+	}()
+	serve(handler, "GET", "/")
+}
+
+// TestServerUse tests server-wide middleware over the wire.
+func TestServerUse(t *testing.T) {
+	srv, addr := startServer(t, HandlerFunc(func(w ResponseWriter, req *ServerRequest) {
+		panic("boom")
+	}))
+	srv.ErrorLog = log.New(&bytes.Buffer{}, "", 0)
+	srv.Use(Recovery(srv.ErrorLog), func(next Handler) Handler {
+		return HandlerFunc(func(w ResponseWriter, req *ServerRequest) {
+			w.Header()["X-Served-By"] = "httpmodule"
+			next.ServeHTTP(w, req)
+		})
+	})
+
+	response, err := http.Get("http://" + addr + "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	response.Body.Close()
+	if response.StatusCode != 500 || response.Header.Get("X-Served-By") != "httpmodule" {
+		t.Error("Expected a recovered 500 with the middleware header, got", response.StatusCode, response.Header)
+	}
+}
@@ -0,0 +1,105 @@
+package httpmodule
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// Time DownloadMirrors waits for mirrors to answer its probe when Downloader
+// doesn't set one
+const defaultMirrorProbeTimeout = 5 * time.Second
+
+// mirrorProbe is how a mirror answered a HEAD request
+type mirrorProbe struct {
+	index   int
+	latency time.Duration
+	ok      bool
+}
+
+// DownloadMirrors fetches a file available from several mirrors into dest.
+// The mirrors are probed at once and tried fastest first; if one fails,
+// part way through or not, the download carries on from the next one
+// without losing what is already on disk. The mirrors must serve identical
+// files: progress moves between them when the sizes match, since their
+// validators can't be compared, so pass the expected digest to be certain.
+// Digests are checked as by Download, and a file that fails the check is
+// fetched again from the next mirror. The checkpoint is recorded under the
+// first URL, so calling again with the same list resumes.
+func (d *Downloader) DownloadMirrors(urls []string, dest string, expected ...Digest) (*DownloadResult, error) {
+	if len(urls) == 0 {
+		return nil, errors.New("download failed: no mirrors given")
+	}
+	var lastErr error
+	for _, url := range d.rankMirrors(urls) {
+		result, err := d.download(urls[0], url, dest, expected)
+		if err == nil {
+			return result, nil
+		}
+		lastErr = err
+	}
+	if len(urls) == 1 {
+		return nil, lastErr
+	}
+	return nil, fmt.Errorf("download failed from all %d mirrors, last: %v", len(urls), lastErr)
+}
+
+// rankMirrors sends each mirror a HEAD request at once and orders them by how
+// quickly they answered. Mirrors that failed, or that haven't answered by
+// the probe timeout, go last in their original order, as a last resort.
+func (d *Downloader) rankMirrors(urls []string) []string {
+	if len(urls) == 1 {
+		return urls
+	}
+	timeout := d.MirrorProbeTimeout
+	if timeout <= 0 {
+		timeout = defaultMirrorProbeTimeout
+	}
+	clock := clockOrReal(d.Clock)
+
+	// Buffered so probes still running after the timeout don't block
+	results := make(chan mirrorProbe, len(urls))
+	start := clock.Now()
+	for i, url := range urls {
+		go func(i int, url string) {
+			response, err := d.send("HEAD", url, "", "")
+			probe := mirrorProbe{index: i, latency: clock.Now().Sub(start)}
+			if err == nil {
+				response.Close()
+				probe.ok = response.StatusCode < 400
+			}
+			results <- probe
+		}(i, url)
+	}
+
+	var answered []mirrorProbe
+	deadline := clock.After(timeout)
+collect:
+	for range urls {
+		select {
+		case probe := <-results:
+			if probe.ok {
+				answered = append(answered, probe)
+			}
+		case <-deadline:
+			break collect
+		}
+	}
+	sort.SliceStable(answered, func(i, j int) bool {
+		return answered[i].latency < answered[j].latency
+	})
+
+	ranked := make([]string, 0, len(urls))
+	seen := make(map[int]bool, len(answered))
+	for _, probe := range answered {
+		ranked = append(ranked, urls[probe.index])
+		seen[probe.index] = true
+	}
+	for i, url := range urls {
+		if !seen[i] {
+			ranked = append(ranked, url)
+		}
+	}
+	return ranked
+}
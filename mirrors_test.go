@@ -0,0 +1,122 @@
+package httpmodule
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+// hostTransport sends requests to the host in their URL, port included.
+func hostTransport(t *testing.T, client *HttpClient) Transport {
+	pool := &connPool{}
+	t.Cleanup(pool.closeAll)
+	dial := func(ctx context.Context, useTLS bool, host string) (*persistConn, error) {
+		conn, err := net.Dial("tcp", host)
+		if err != nil {
+			return nil, err
+		}
+		return newPersistConn(conn), nil
+	}
+	return RoundTripFunc(func(req *HttpRequest) (*HttpResponse, error) {
+		return client.roundTripVia(req, dial, pool)
+	})
+}
+
+// mirrorDownloader returns a Downloader that can reach any loopback server.
+func mirrorDownloader(t *testing.T) *Downloader {
+	d := NewDownloader(nil)
+	d.Client.Transport = hostTransport(t, d.Client)
+	return d
+}
+
+// deadAddr returns a loopback address nothing is listening on.
+func deadAddr(t *testing.T) string {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := listener.Addr().String()
+	listener.Close()
+	return addr
+}
+
+// TestDownloadMirrorsFailover tests carrying a download over to another mirror.
+func TestDownloadMirrorsFailover(t *testing.T) {
+	payload := testPayload(200 << 10)
+	files := fstest.MapFS{"pkg.bin": {Data: payload, ModTime: time.Unix(1700000000, 0)}}
+	fast := startDownloadServer(t, files)
+	slow := startDownloadServer(t, files)
+	slow.headDelay = 100 * time.Millisecond
+	fast.cutNext(80 << 10)
+
+	d := mirrorDownloader(t)
+	d.CheckpointInterval = 16 << 10
+	dest := filepath.Join(t.TempDir(), "pkg.bin")
+	urls := []string{"http://" + slow.addr + "/pkg.bin", "http://" + fast.addr + "/pkg.bin"}
+	result, err := d.DownloadMirrors(urls, dest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Source != urls[0] || result.Resumed < 64<<10 {
+		t.Error("Expected the slow mirror to finish what the fast one started, got", result.Source, result.Resumed)
+	}
+	if len(fast.ranges) != 1 || len(slow.ranges) != 1 || !strings.HasPrefix(slow.ranges[0], "bytes=") {
+		t.Error("Expected the fast mirror first and a range from the slow one, got", fast.ranges, slow.ranges)
+	}
+	if data, _ := os.ReadFile(dest); !bytes.Equal(data, payload) {
+		t.Error("Expected the file to match.")
+	}
+	if _, err := os.Stat(dest + checkpointSuffix); !os.IsNotExist(err) {
+		t.Error("Expected the checkpoint to be removed, got", err)
+	}
+}
+
+// TestDownloadMirrorsUnreachable tests skipping mirrors that can't be reached.
+func TestDownloadMirrorsUnreachable(t *testing.T) {
+	payload := testPayload(10 << 10)
+	ds := startDownloadServer(t, fstest.MapFS{"pkg.bin": {Data: payload}})
+	d := mirrorDownloader(t)
+	dir := t.TempDir()
+
+	dead := "http://" + deadAddr(t) + "/pkg.bin"
+	good := "http://" + ds.addr + "/pkg.bin"
+	result, err := d.DownloadMirrors([]string{dead, good}, filepath.Join(dir, "pkg.bin"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Source != good {
+		t.Error("Expected the reachable mirror, got", result.Source)
+	}
+
+	missing := "http://" + ds.addr + "/missing.bin"
+	if _, err := d.DownloadMirrors([]string{dead, missing}, filepath.Join(dir, "other.bin")); err == nil || !strings.Contains(err.Error(), "all 2 mirrors") {
+		t.Error("Expected an error when every mirror fails, got", err)
+	}
+	if _, err := d.DownloadMirrors(nil, filepath.Join(dir, "none.bin")); err == nil {
+		t.Error("Expected an error without mirrors.")
+	}
+}
+
+// TestRankMirrors tests ordering mirrors by how quickly they answer.
+func TestRankMirrors(t *testing.T) {
+	files := fstest.MapFS{"pkg.bin": {Data: []byte("x")}}
+	slow := startDownloadServer(t, files)
+	slow.headDelay = 100 * time.Millisecond
+	fast := startDownloadServer(t, files)
+	hung := startDownloadServer(t, files)
+	hung.headDelay = time.Second
+
+	d := mirrorDownloader(t)
+	d.MirrorProbeTimeout = 300 * time.Millisecond
+	urls := []string{"http://" + hung.addr + "/pkg.bin", "http://" + slow.addr + "/pkg.bin", "http://" + fast.addr + "/pkg.bin"}
+	ranked := d.rankMirrors(urls)
+	if ranked[0] != urls[2] || ranked[1] != urls[1] || ranked[2] != urls[0] {
+		t.Error("Expected fast, slow, then hung, got", ranked)
+	}
+}
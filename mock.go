@@ -0,0 +1,210 @@
+package httpmodule
+
+import (
+	"fmt"
+	"regexp"
+	"sync"
+)
+
+// TestingT is the part of testing.TB that MockTransport reports failures through
+type TestingT interface {
+	Helper()
+	Errorf(format string, args ...any)
+}
+
+// MockTransport answers requests with canned responses registered through On.
+// Each request is matched against the expectations in the order they were
+// registered; the first one that matches and hasn't used up its calls answers.
+//
+// In strict mode a request that matches nothing fails the test, and every
+// expectation must be called exactly as often as declared. In loose mode
+// unmatched requests get a 404 and expectations only need to be called once.
+type MockTransport struct {
+	Strict bool
+
+	t            TestingT
+	mu           sync.Mutex
+	expectations []*Expectation
+}
+
+// NewMockTransport returns a loose mock reporting to t. When t supports Cleanup,
+// as *testing.T does, unmet expectations are checked when the test finishes.
+func NewMockTransport(t TestingT) *MockTransport {
+	mock := &MockTransport{t: t}
+	if cleaner, ok := t.(interface{ Cleanup(func()) }); ok {
+		cleaner.Cleanup(mock.AssertExpectations)
+	}
+	return mock
+}
+
+// Expectation is a request pattern and the response given to requests matching it
+type Expectation struct {
+	method     string
+	urlPattern *regexp.Regexp
+	headers    map[string]string
+	body       func(body string) bool
+	matchers   []Matcher
+
+	response *HttpResponse
+	err      error
+
+	// Number of calls expected; zero means any number, at least one
+	times int
+	calls int
+}
+
+// On registers an expectation for requests with the given method (or "" for any
+// method) whose URL matches the regular expression urlPattern. It panics if the
+// pattern doesn't compile, as a test can't meaningfully continue then.
+func (mock *MockTransport) On(method, urlPattern string) *Expectation {
+	expectation := &Expectation{
+		method:     method,
+		urlPattern: regexp.MustCompile(urlPattern),
+		response:   &HttpResponse{Protocol: "HTTP/1.1", StatusCode: 200, Status: "OK"},
+	}
+	mock.mu.Lock()
+	mock.expectations = append(mock.expectations, expectation)
+	mock.mu.Unlock()
+	return expectation
+}
+
+// OnMatch registers an expectation for requests matching m
+func (mock *MockTransport) OnMatch(m Matcher) *Expectation {
+	return mock.On("", "").Where(m)
+}
+
+// Where additionally requires the request to match m
+func (expectation *Expectation) Where(m Matcher) *Expectation {
+	expectation.matchers = append(expectation.matchers, m)
+	return expectation
+}
+
+// WithHeader requires the request to carry header key with exactly value
+func (expectation *Expectation) WithHeader(key, value string) *Expectation {
+	if expectation.headers == nil {
+		expectation.headers = make(map[string]string)
+	}
+	expectation.headers[key] = value
+	return expectation
+}
+
+// WithBody requires the request body to satisfy match
+func (expectation *Expectation) WithBody(match func(body string) bool) *Expectation {
+	expectation.body = match
+	return expectation
+}
+
+// Respond sets the status code and body of the canned response
+func (expectation *Expectation) Respond(statusCode int, body string) *Expectation {
+	expectation.response.StatusCode = statusCode
+	expectation.response.Status = statusText(statusCode)
+	expectation.response.Body = body
+	return expectation
+}
+
+// RespondHeader adds a header to the canned response
+func (expectation *Expectation) RespondHeader(key, value string) *Expectation {
+	if expectation.response.Headers == nil {
+		expectation.response.Headers = make(map[string]string)
+	}
+	expectation.response.Headers[key] = value
+	return expectation
+}
+
+// RespondError makes matching requests fail with err instead of getting a response
+func (expectation *Expectation) RespondError(err error) *Expectation {
+	expectation.err = err
+	return expectation
+}
+
+// Times sets how many requests the expectation answers. Once used up, later
+// requests fall through to the next matching expectation.
+func (expectation *Expectation) Times(n int) *Expectation {
+	expectation.times = n
+	return expectation
+}
+
+func (expectation *Expectation) matches(req *HttpRequest) bool {
+	if expectation.times > 0 && expectation.calls >= expectation.times {
+		return false
+	}
+	if expectation.method != "" && expectation.method != req.Method {
+		return false
+	}
+	if !expectation.urlPattern.MatchString(req.URL) {
+		return false
+	}
+	for k, v := range expectation.headers {
+		if req.Headers[k] != v {
+			return false
+		}
+	}
+	for _, m := range expectation.matchers {
+		if !m.Match(req) {
+			return false
+		}
+	}
+	return expectation.body == nil || expectation.body(req.Body)
+}
+
+func (expectation *Expectation) String() string {
+	method := expectation.method
+	if method == "" {
+		method = "*"
+	}
+	desc := fmt.Sprintf("%s %s", method, expectation.urlPattern)
+	for _, m := range expectation.matchers {
+		desc += " where " + describe(m)
+	}
+	return desc
+}
+
+func (mock *MockTransport) RoundTrip(req *HttpRequest) (*HttpResponse, error) {
+	mock.mu.Lock()
+	var matched *Expectation
+	for _, expectation := range mock.expectations {
+		if expectation.matches(req) {
+			matched = expectation
+			matched.calls++
+			break
+		}
+	}
+	mock.mu.Unlock()
+
+	if matched == nil {
+		if mock.Strict {
+			mock.t.Helper()
+			mock.t.Errorf("mock: unexpected request %s %s", req.Method, req.URL)
+			return nil, fmt.Errorf("mock: no expectation matches %s %s", req.Method, req.URL)
+		}
+		return &HttpResponse{Protocol: "HTTP/1.1", StatusCode: 404, Status: statusText(404)}, nil
+	}
+	if matched.err != nil {
+		return nil, matched.err
+	}
+
+	// Hand out a copy so callers can't change the canned response
+	response := *matched.response
+	response.Headers = make(map[string]string, len(matched.response.Headers))
+	for k, v := range matched.response.Headers {
+		response.Headers[k] = v
+	}
+	return &response, nil
+}
+
+// AssertExpectations reports expectations that were never called or, in strict
+// mode, weren't called exactly as many times as declared
+func (mock *MockTransport) AssertExpectations() {
+	mock.t.Helper()
+	mock.mu.Lock()
+	defer mock.mu.Unlock()
+
+	for _, expectation := range mock.expectations {
+		switch {
+		case expectation.calls == 0:
+			mock.t.Errorf("mock: expected request %s was never made", expectation)
+		case mock.Strict && expectation.times > 0 && expectation.calls != expectation.times:
+			mock.t.Errorf("mock: expected %d requests for %s, got %d", expectation.times, expectation, expectation.calls)
+		}
+	}
+}
@@ -0,0 +1,111 @@
+package httpmodule
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// recordingT collects failures instead of failing the surrounding test.
+type recordingT struct {
+	failures []string
+}
+
+func (r *recordingT) Helper() {}
+
+func (r *recordingT) Errorf(format string, args ...any) {
+	r.failures = append(r.failures, fmt.Sprintf(format, args...))
+}
+
+// TestMockTransport tests matching on method, URL, headers, and body.
+func TestMockTransport(t *testing.T) {
+	mock := NewMockTransport(t)
+	mock.On("GET", `^https://api\.example\.com/users/\d+$`).
+		WithHeader("Authorization", "Bearer token").
+		Respond(200, `{"id":1}`).
+		RespondHeader("Content-Type", "application/json")
+	mock.On("POST", `/users$`).
+		WithBody(func(body string) bool { return strings.Contains(body, "alice") }).
+		Respond(201, "")
+
+	client := New()
+	client.Transport = mock
+
+	response, err := client.Get("https://api.example.com/users/1", map[string]string{"Authorization": "Bearer token"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response.StatusCode != 200 || response.Body != `{"id":1}` || response.Headers["Content-Type"] != "application/json" {
+		t.Error("Expected the canned response.", response)
+	}
+
+	response, err = client.Post("https://api.example.com/users", `{"name":"alice"}`, nil)
+	if err != nil || response.StatusCode != 201 || response.Status != "Created" {
+		t.Error("Expected 201 Created.", response, err)
+	}
+
+	// Loose mode answers anything else with 404
+	response, err = client.Get("https://api.example.com/users/1", nil)
+	if err != nil || response.StatusCode != 404 {
+		t.Error("Expected 404 for an unmatched request.", response, err)
+	}
+}
+
+// TestMockTransportStrict tests that strict mode reports unexpected and unmet requests.
+func TestMockTransportStrict(t *testing.T) {
+	recorder := &recordingT{}
+	mock := NewMockTransport(recorder)
+	mock.Strict = true
+	mock.On("GET", `/once$`).Times(2)
+	mock.On("DELETE", `/never$`)
+
+	client := New()
+	client.Transport = mock
+
+	client.Get("https://example.com/once", nil)
+	if _, err := client.Get("https://example.com/other", nil); err == nil {
+		t.Error("Expected an error for an unexpected request.")
+	}
+	mock.AssertExpectations()
+
+	if len(recorder.failures) != 3 {
+		t.Errorf("Expected 3 failures, got %q.", recorder.failures)
+	}
+}
+
+// TestMockTransportError tests expectations that fail the request.
+func TestMockTransportError(t *testing.T) {
+	mock := NewMockTransport(t)
+	failure := errors.New("connection refused")
+	mock.On("", ".").RespondError(failure)
+
+	client := New()
+	client.Transport = mock
+	if _, err := client.Get("https://example.com", nil); !errors.Is(err, failure) {
+		t.Error("Expected the configured error.", err)
+	}
+}
+
+// TestMockTransportMatcher tests expectations selected by matchers.
+func TestMockTransportMatcher(t *testing.T) {
+	mock := NewMockTransport(t)
+	mock.OnMatch(And(MatchMethod("POST"), MatchJSON("name", "alice"))).Respond(201, "")
+	mock.On("GET", `/users`).Where(MatchQuery("page", "2")).Respond(200, "page two")
+
+	client := New()
+	client.Transport = mock
+
+	response, err := client.Post("https://api.example.com/users", `{"name":"alice"}`, nil)
+	if err != nil || response.StatusCode != 201 {
+		t.Error("Expected 201 for a matching body.", response, err)
+	}
+	response, err = client.Get("https://api.example.com/users?page=1", nil)
+	if err != nil || response.StatusCode != 404 {
+		t.Error("Expected 404 when a matcher fails.", response, err)
+	}
+	response, err = client.Get("https://api.example.com/users?page=2", nil)
+	if err != nil || response.Body != "page two" {
+		t.Error("Expected the second page.", response, err)
+	}
+}
@@ -0,0 +1,77 @@
+package httpmodule
+
+import (
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/textproto"
+	"sort"
+	"strings"
+)
+
+// FilePart is a file uploaded in a multipart/form-data request
+type FilePart struct {
+	// Form field the file is sent in
+	FieldName string
+
+	// Name the server is told the file has
+	FileName string
+
+	// Media type of the file; empty means application/octet-stream
+	ContentType string
+
+	// Contents, read as the request is sent
+	Reader io.Reader
+}
+
+// Escapes quotes in Content-Disposition parameters, as mime/multipart does
+var quoteEscaper = strings.NewReplacer("\\", "\\\\", `"`, "\\\"")
+
+// PostMultipart sends a multipart/form-data POST with fields, in name order,
+// followed by files. The body is built as it is sent, so files are streamed
+// from their readers rather than held in memory, and it goes out chunked.
+func (client *HttpClient) PostMultipart(url string, fields map[string]string, files []FilePart, headers map[string]string) (*HttpResponse, error) {
+	pr, pw := io.Pipe()
+	mw := multipart.NewWriter(pw)
+	go func() {
+		pw.CloseWithError(writeMultipart(mw, fields, files))
+	}()
+	// Stops the writer if the request ends before reading the whole body
+	defer pr.Close()
+
+	withType := withHeader(headers, "Content-Type", mw.FormDataContentType())
+	return client.Do(&HttpRequest{Method: "POST", URL: url, Headers: withType, BodyReader: pr})
+}
+
+// writeMultipart writes the parts of a form to mw and closes it
+func writeMultipart(mw *multipart.Writer, fields map[string]string, files []FilePart) error {
+	names := make([]string, 0, len(fields))
+	for name := range fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if err := mw.WriteField(name, fields[name]); err != nil {
+			return err
+		}
+	}
+
+	for _, file := range files {
+		contentType := file.ContentType
+		if contentType == "" {
+			contentType = "application/octet-stream"
+		}
+		header := make(textproto.MIMEHeader)
+		header.Set("Content-Disposition", fmt.Sprintf(`form-data; name="%s"; filename="%s"`,
+			quoteEscaper.Replace(file.FieldName), quoteEscaper.Replace(file.FileName)))
+		header.Set("Content-Type", contentType)
+		part, err := mw.CreatePart(header)
+		if err != nil {
+			return err
+		}
+		if _, err := io.Copy(part, file.Reader); err != nil {
+			return fmt.Errorf("failed to read %s: %v", file.FileName, err)
+		}
+	}
+	return mw.Close()
+}
@@ -0,0 +1,39 @@
+package httpmodule
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+)
+
+// TestPostMultipart tests uploading fields and streamed files as a multipart form.
+func TestPostMultipart(t *testing.T) {
+	_, addr := startServer(t, HandlerFunc(func(w ResponseWriter, req *ServerRequest) {
+		if err := req.ParseMultipartForm(1<<20, 0); err != nil {
+			w.WriteHeader(400)
+			return
+		}
+		file, header, err := req.FormFile("upload")
+		if err != nil {
+			w.WriteHeader(400)
+			return
+		}
+		defer file.Close()
+		data, _ := io.ReadAll(file)
+		fmt.Fprintf(w, "%s|%s|%s|%s|%d|%s", req.FormValue("title"), req.FormValue("tags"),
+			header.Filename, header.Header.Get("Content-Type"), len(data), data[:5])
+	}))
+	client := New()
+
+	contents := "hello" + strings.Repeat("x", 200<<10)
+	files := []FilePart{{FieldName: "upload", FileName: `report "final".txt`, ContentType: "text/plain", Reader: strings.NewReader(contents)}}
+	response, err := client.PostMultipart("http://"+addr+"/", map[string]string{"title": "Q3", "tags": "a,b"}, files, map[string]string{"Content-Type": "ignored"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := fmt.Sprintf(`Q3|a,b|report "final".txt|text/plain|%d|hello`, len(contents))
+	if response.StatusCode != 200 || response.Body != want {
+		t.Errorf("Expected the form to arrive whole, got %d %q", response.StatusCode, response.Body)
+	}
+}
@@ -0,0 +1,233 @@
+package httpmodule
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	neturl "net/url"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// OpenAPIClient calls the operations of an OpenAPI 3 service by operationId,
+// building the path, query, and headers from the parameters the spec declares
+// and decoding responses by status. Specs must be in JSON.
+type OpenAPIClient struct {
+	Client *HttpClient
+
+	// Base URL operation paths are appended to; defaults to the spec's first server
+	BaseURL string
+
+	operations map[string]*openAPIOperation
+}
+
+// APIError is returned by OpenAPIClient.Call and DoJSON for responses
+// outside 2xx
+type APIError struct {
+	Operation  string
+	StatusCode int
+	Status     string
+	Body       string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("%s: %d %s", e.Operation, e.StatusCode, e.Status)
+}
+
+// Decode unmarshals the JSON error body into v
+func (e *APIError) Decode(v any) error {
+	return json.Unmarshal([]byte(e.Body), v)
+}
+
+type openAPIOperation struct {
+	method      string
+	path        string
+	OperationID string             `json:"operationId"`
+	Parameters  []openAPIParameter `json:"parameters"`
+	RequestBody *struct {
+		Required bool `json:"required"`
+	} `json:"requestBody"`
+}
+
+type openAPIParameter struct {
+	Name     string `json:"name"`
+	In       string `json:"in"`
+	Required bool   `json:"required"`
+}
+
+var openAPIMethods = []string{"get", "put", "post", "delete", "options", "head", "patch", "trace"}
+
+// LoadOpenAPIClient reads the JSON OpenAPI spec at path. See NewOpenAPIClient.
+func LoadOpenAPIClient(client *HttpClient, path string) (*OpenAPIClient, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return NewOpenAPIClient(client, f)
+}
+
+// NewOpenAPIClient returns a client for the operations in the JSON OpenAPI 3
+// spec read from r. Operations without an operationId can't be called.
+func NewOpenAPIClient(client *HttpClient, spec io.Reader) (*OpenAPIClient, error) {
+	var doc struct {
+		OpenAPI string `json:"openapi"`
+		Servers []struct {
+			URL string `json:"url"`
+		} `json:"servers"`
+		Paths map[string]map[string]json.RawMessage `json:"paths"`
+	}
+	if err := json.NewDecoder(spec).Decode(&doc); err != nil {
+		return nil, fmt.Errorf("failed to parse OpenAPI spec: %v", err)
+	}
+	if !strings.HasPrefix(doc.OpenAPI, "3.") {
+		return nil, fmt.Errorf("unsupported OpenAPI version %q", doc.OpenAPI)
+	}
+
+	api := &OpenAPIClient{Client: client, operations: make(map[string]*openAPIOperation)}
+	if len(doc.Servers) > 0 {
+		api.BaseURL = strings.TrimSuffix(doc.Servers[0].URL, "/")
+	}
+	for path, item := range doc.Paths {
+		// Parameters on the path item apply to all of its operations
+		var shared []openAPIParameter
+		if raw, ok := item["parameters"]; ok {
+			if err := json.Unmarshal(raw, &shared); err != nil {
+				return nil, fmt.Errorf("invalid parameters for %s: %v", path, err)
+			}
+		}
+		for _, method := range openAPIMethods {
+			raw, ok := item[method]
+			if !ok {
+				continue
+			}
+			op := &openAPIOperation{method: strings.ToUpper(method), path: path}
+			if err := json.Unmarshal(raw, op); err != nil {
+				return nil, fmt.Errorf("invalid operation %s %s: %v", method, path, err)
+			}
+			if op.OperationID == "" {
+				continue
+			}
+			op.Parameters = mergeParameters(shared, op.Parameters)
+			api.operations[op.OperationID] = op
+		}
+	}
+	return api, nil
+}
+
+// mergeParameters adds the path item's parameters that the operation doesn't redefine
+func mergeParameters(shared, own []openAPIParameter) []openAPIParameter {
+	merged := append([]openAPIParameter{}, own...)
+	for _, p := range shared {
+		redefined := false
+		for _, o := range own {
+			if o.Name == p.Name && o.In == p.In {
+				redefined = true
+				break
+			}
+		}
+		if !redefined {
+			merged = append(merged, p)
+		}
+	}
+	return merged
+}
+
+// Operations returns the operationIds that can be called, sorted
+func (api *OpenAPIClient) Operations() []string {
+	ids := make([]string, 0, len(api.operations))
+	for id := range api.operations {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// Call invokes operationID. params holds path, query, and header parameters by
+// name; slices become repeated query parameters. body, when not nil, is sent
+// as JSON. A 2xx response's JSON body is decoded into out, when not nil; other
+// statuses return an *APIError.
+func (api *OpenAPIClient) Call(operationID string, params map[string]any, body, out any) error {
+	op, ok := api.operations[operationID]
+	if !ok {
+		return fmt.Errorf("unknown operation %q", operationID)
+	}
+	if api.BaseURL == "" || !strings.Contains(api.BaseURL, "://") {
+		return fmt.Errorf("%s: BaseURL must be an absolute URL, got %q", operationID, api.BaseURL)
+	}
+
+	path := op.path
+	query := neturl.Values{}
+	headers := map[string]string{"Accept": "application/json"}
+	used := 0
+	for _, p := range op.Parameters {
+		value, ok := params[p.Name]
+		if !ok {
+			if p.Required || p.In == "path" {
+				return fmt.Errorf("%s: missing required %s parameter %q", operationID, p.In, p.Name)
+			}
+			continue
+		}
+		used++
+		switch p.In {
+		case "path":
+			path = strings.ReplaceAll(path, "{"+p.Name+"}", neturl.PathEscape(fmt.Sprint(value)))
+		case "query":
+			for _, v := range parameterValues(value) {
+				query.Add(p.Name, v)
+			}
+		case "header":
+			headers[p.Name] = strings.Join(parameterValues(value), ",")
+		default:
+			return fmt.Errorf("%s: unsupported parameter location %q", operationID, p.In)
+		}
+	}
+	if used != len(params) {
+		return fmt.Errorf("%s: unknown parameters in %v", operationID, params)
+	}
+
+	req := &HttpRequest{Method: op.method, URL: api.BaseURL + path, Headers: headers}
+	if len(query) > 0 {
+		req.URL += "?" + query.Encode()
+	}
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return fmt.Errorf("%s: failed to encode body: %v", operationID, err)
+		}
+		req.Body = string(data)
+		headers["Content-Type"] = "application/json"
+	} else if op.RequestBody != nil && op.RequestBody.Required {
+		return fmt.Errorf("%s: request body is required", operationID)
+	}
+
+	response, err := api.Client.do(req)
+	if err != nil {
+		return err
+	}
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		return &APIError{Operation: operationID, StatusCode: response.StatusCode, Status: response.Status, Body: response.Body}
+	}
+	if out == nil || response.Body == "" {
+		return nil
+	}
+	if err := json.Unmarshal([]byte(response.Body), out); err != nil {
+		return fmt.Errorf("%s: failed to decode response: %v", operationID, err)
+	}
+	return nil
+}
+
+// parameterValues formats a parameter value, expanding slices
+func parameterValues(value any) []string {
+	v := reflect.ValueOf(value)
+	if v.Kind() != reflect.Slice && v.Kind() != reflect.Array {
+		return []string{fmt.Sprint(value)}
+	}
+	values := make([]string, v.Len())
+	for i := range values {
+		values[i] = fmt.Sprint(v.Index(i).Interface())
+	}
+	return values
+}
@@ -0,0 +1,89 @@
+package httpmodule
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+type testPet struct {
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+}
+
+// newPetstoreClient returns an OpenAPI client for the test spec backed by mock.
+func newPetstoreClient(t *testing.T, mock *MockTransport) *OpenAPIClient {
+	client := New()
+	client.Transport = mock
+	api, err := LoadOpenAPIClient(client, "testdata/openapi/petstore.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return api
+}
+
+// TestOpenAPIClient tests building requests from the spec and decoding responses.
+func TestOpenAPIClient(t *testing.T) {
+	mock := NewMockTransport(t)
+	mock.On("GET", `^https://petstore\.example\.com/v1/pets\?limit=2&tag=a&tag=b$`).Respond(200, `[{"id":1,"name":"Rex"}]`)
+	mock.On("GET", `/pets/a%20b$`).WithHeader("X-Request-Id", "r1").Respond(200, `{"id":2,"name":"Tom"}`)
+	mock.On("POST", `/v1/pets$`).WithBody(func(body string) bool { return body == `{"id":0,"name":"Kit"}` }).Respond(201, "")
+	mock.On("GET", `/pets/404$`).Respond(404, `{"message":"no such pet"}`)
+	api := newPetstoreClient(t, mock)
+
+	if got := strings.Join(api.Operations(), ","); got != "createPet,getPet,listPets" {
+		t.Error("Expected operations with ids only, got", got)
+	}
+
+	var pets []testPet
+	if err := api.Call("listPets", map[string]any{"limit": 2, "tag": []string{"a", "b"}}, nil, &pets); err != nil {
+		t.Fatal(err)
+	}
+	if len(pets) != 1 || pets[0].Name != "Rex" {
+		t.Error("Expected the decoded list, got", pets)
+	}
+
+	var pet testPet
+	if err := api.Call("getPet", map[string]any{"petId": "a b", "X-Request-Id": "r1"}, nil, &pet); err != nil {
+		t.Fatal(err)
+	}
+	if pet.Name != "Tom" {
+		t.Error("Expected the decoded pet, got", pet)
+	}
+
+	if err := api.Call("createPet", nil, testPet{Name: "Kit"}, nil); err != nil {
+		t.Error("Expected the pet to be created.", err)
+	}
+
+	err := api.Call("getPet", map[string]any{"petId": 404}, nil, &pet)
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != 404 {
+		t.Fatal("Expected an APIError, got", err)
+	}
+	var message struct{ Message string }
+	if apiErr.Decode(&message); message.Message != "no such pet" {
+		t.Error("Expected the decoded error body, got", message)
+	}
+}
+
+// TestOpenAPIClientValidation tests parameter and body checks.
+func TestOpenAPIClientValidation(t *testing.T) {
+	api := newPetstoreClient(t, NewMockTransport(t))
+
+	tests := []struct {
+		operation string
+		params    map[string]any
+		want      string
+	}{
+		{"getPet", nil, "missing required path parameter"},
+		{"listPets", map[string]any{"color": "red"}, "unknown parameters"},
+		{"createPet", nil, "request body is required"},
+		{"deletePet", nil, "unknown operation"},
+	}
+	for _, test := range tests {
+		err := api.Call(test.operation, test.params, nil, nil)
+		if err == nil || !strings.Contains(err.Error(), test.want) {
+			t.Errorf("Expected %q for %s, got %v", test.want, test.operation, err)
+		}
+	}
+}
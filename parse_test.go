@@ -0,0 +1,149 @@
+package httpmodule
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+)
+
+// TestParseResponse tests parsing a complete response from a reader.
+func TestParseResponse(t *testing.T) {
+	raw := "HTTP/1.1 404 Not Found\r\nContent-Length: 4\r\n\r\nnope"
+	response, err := ParseResponse(strings.NewReader(raw), "GET")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response.StatusCode != 404 || response.Status != "Not Found" || response.Body != "nope" {
+		t.Error("Expected the parsed response.", response)
+	}
+}
+
+// TestParseResponseNoBody tests statuses that never carry a body.
+func TestParseResponseNoBody(t *testing.T) {
+	raw := "HTTP/1.1 304 Not Modified\r\nETag: \"v1\"\r\n\r\nHTTP/1.1 200 OK\r\n"
+	response, err := ParseResponse(strings.NewReader(raw), "GET")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response.StatusCode != 304 || response.Body != "" {
+		t.Error("Expected an empty 304 response.", response)
+	}
+
+	// The length of a HEAD response describes the body a GET would get
+	raw = "HTTP/1.1 200 OK\r\nContent-Length: 1000\r\n\r\n"
+	response, err = ParseResponse(strings.NewReader(raw), "HEAD")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response.Headers["Content-Length"] != "1000" || response.Body != "" {
+		t.Error("Expected an empty HEAD response.", response)
+	}
+}
+
+// TestParseResponseModes tests inputs that only lenient parsing accepts.
+func TestParseResponseModes(t *testing.T) {
+	tests := []struct {
+		name string
+		raw  string
+	}{
+		{"no reason phrase", "HTTP/1.1 204\r\n\r\n"},
+		{"headers cut off", "HTTP/1.1 200 OK\r\nContent-Type: text/plain\r\n"},
+		{"bare LF after chunk size", "HTTP/1.1 200 OK\r\nTransfer-Encoding: chunked\r\n\r\n3\nabc\r\n0\r\n\r\n"},
+		{"missing CRLF after chunk", "HTTP/1.1 200 OK\r\nTransfer-Encoding: chunked\r\n\r\n3\r\nabcX\r\n0\r\n\r\n"},
+	}
+	for _, test := range tests {
+		if _, err := ParseResponse(strings.NewReader(test.raw), "GET"); err != nil {
+			t.Errorf("%s: expected lenient parsing to accept, got %v.", test.name, err)
+		}
+		if _, err := (ParseOptions{Strict: true}).ParseResponse(strings.NewReader(test.raw), "GET"); err == nil {
+			t.Errorf("%s: expected strict parsing to reject.", test.name)
+		}
+	}
+}
+
+// TestParseResponseLimits tests inputs that both modes must reject.
+func TestParseResponseLimits(t *testing.T) {
+	tests := []struct {
+		name string
+		raw  string
+	}{
+		{"oversized chunk", "HTTP/1.1 200 OK\r\nTransfer-Encoding: chunked\r\n\r\nffffffffffffffffff\r\n"},
+		{"negative length", "HTTP/1.1 200 OK\r\nContent-Length: -1\r\n\r\n"},
+		{"huge header", "HTTP/1.1 200 OK\r\nX-Big: " + strings.Repeat("a", 2<<20) + "\r\n\r\n"},
+		{"short body", "HTTP/1.1 200 OK\r\nContent-Length: 999999999999\r\n\r\nabc"},
+	}
+	for _, test := range tests {
+		for _, strict := range []bool{false, true} {
+			if _, err := (ParseOptions{Strict: strict}).ParseResponse(strings.NewReader(test.raw), "GET"); err == nil {
+				t.Errorf("%s: expected an error (strict=%v).", test.name, strict)
+			}
+		}
+	}
+}
+
+// TestChunkExtensions tests that chunk extensions are ignored.
+func TestChunkExtensions(t *testing.T) {
+	raw := "HTTP/1.1 200 OK\r\nTransfer-Encoding: gzip, Chunked\r\n\r\n3;name=value\r\nabc\r\n0\r\n\r\n"
+	response, err := (ParseOptions{Strict: true}).ParseResponse(strings.NewReader(raw), "GET")
+	if err != nil || response.Body != "abc" {
+		t.Error("Expected chunk extensions to be skipped.", response, err)
+	}
+}
+
+// FuzzParseStatusLine checks that the status line parser never panics and that
+// whatever strict parsing accepts, lenient parsing accepts with the same
+// protocol and code. Lenient parsing trims the reason phrase, so it may differ.
+func FuzzParseStatusLine(f *testing.F) {
+	f.Add([]byte("HTTP/1.1 200 OK\r\n"))
+	f.Add([]byte("HTTP/1.0 404 \r\n"))
+	f.Add([]byte("HTTP/1.1 200\r\n"))
+	f.Add([]byte("HTTP/1.1 99999999999 Big\r\n"))
+	f.Fuzz(func(t *testing.T, line []byte) {
+		protocol, code, _, err := parseStatusLine(line, true)
+		lenientProtocol, lenientCode, _, lenientErr := parseStatusLine(line, false)
+		if err == nil && (lenientErr != nil || lenientProtocol != protocol || lenientCode != code) {
+			t.Fatalf("strict accepted %q but lenient gave %q %d %v", line, lenientProtocol, lenientCode, lenientErr)
+		}
+	})
+}
+
+// FuzzChunkedBody checks that chunked decoding never panics or produces more
+// bytes than it was given, and that strict and lenient decoding agree whenever
+// strict decoding succeeds.
+func FuzzChunkedBody(f *testing.F) {
+	f.Add([]byte("5\r\nhello\r\n0\r\n\r\n"))
+	f.Add([]byte("3;ext\r\nabc\r\n0\r\nTrailer: x\r\n\r\n"))
+	f.Add([]byte("7fffffffffffffff\r\nabc"))
+	f.Add([]byte("3\nabc0\n\n"))
+	f.Fuzz(func(t *testing.T, raw []byte) {
+		decode := func(strict bool) ([]byte, error) {
+			headers := map[string]string{"Transfer-Encoding": "chunked"}
+			body, err := newBodyReader(bufio.NewReaderSize(bytes.NewReader(raw), 16), headers, strict)
+			if err != nil {
+				return nil, err
+			}
+			return io.ReadAll(body)
+		}
+		strictBody, strictErr := decode(true)
+		lenientBody, lenientErr := decode(false)
+		if len(lenientBody) > len(raw) {
+			t.Fatalf("decoded %d bytes from %d bytes of input", len(lenientBody), len(raw))
+		}
+		if strictErr == nil && (lenientErr != nil || !bytes.Equal(strictBody, lenientBody)) {
+			t.Fatalf("strict decoded %q but lenient gave %q, %v", strictBody, lenientBody, lenientErr)
+		}
+	})
+}
+
+// FuzzParseResponse checks that parsing arbitrary input terminates without panicking.
+func FuzzParseResponse(f *testing.F) {
+	f.Add([]byte("HTTP/1.1 200 OK\r\nContent-Length: 5\r\n\r\nhello"))
+	f.Add([]byte("HTTP/1.1 200 OK\r\nTransfer-Encoding: chunked\r\n\r\n5\r\nhello\r\n0\r\n\r\n"))
+	f.Add([]byte("HTTP/1.0 301 Moved\r\nLocation: /\r\n\r\n"))
+	f.Fuzz(func(t *testing.T, raw []byte) {
+		ParseResponse(bytes.NewReader(raw), "GET")
+		(ParseOptions{Strict: true, MaxHeaderBytes: 256}).ParseResponse(bytes.NewReader(raw), "GET")
+	})
+}
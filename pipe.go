@@ -0,0 +1,99 @@
+package httpmodule
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"sync"
+)
+
+var errPipeClosed = errors.New("pipe transport closed")
+
+// PipeTransport sends requests to an in-process http.Handler over net.Pipe.
+// Requests are serialized and responses parsed exactly as they are over the
+// network, but no sockets are opened, which keeps tests hermetic. https URLs
+// are served in plain text, since there is no TLS on the pipe.
+type PipeTransport struct {
+	client   *HttpClient
+	listener *pipeListener
+	server   *http.Server
+	pool     connPool
+}
+
+// PipeTransport returns a transport that connects the client to handler over
+// in-memory pipes. Close it to stop the handler's server once done.
+func (client *HttpClient) PipeTransport(handler http.Handler) *PipeTransport {
+	t := &PipeTransport{
+		client:   client,
+		listener: newPipeListener(),
+		server:   &http.Server{Handler: handler},
+	}
+	go t.server.Serve(t.listener)
+	return t
+}
+
+func (t *PipeTransport) RoundTrip(req *HttpRequest) (*HttpResponse, error) {
+	return t.client.roundTripVia(req, t.dial, &t.pool)
+}
+
+// dial hands one end of a new pipe to the server and keeps the other
+func (t *PipeTransport) dial(ctx context.Context, useTLS bool, host string) (*persistConn, error) {
+	clientConn, serverConn := net.Pipe()
+	select {
+	case t.listener.conns <- serverConn:
+		return newPersistConn(clientConn), nil
+	case <-t.listener.closed:
+		clientConn.Close()
+		serverConn.Close()
+		return nil, errPipeClosed
+	case <-ctx.Done():
+		clientConn.Close()
+		serverConn.Close()
+		return nil, ctx.Err()
+	}
+}
+
+// Close drops idle connections and shuts the handler's server down
+func (t *PipeTransport) Close() error {
+	t.pool.closeAll()
+	return t.server.Close()
+}
+
+// pipeListener is a net.Listener that accepts connections handed to it by dial
+type pipeListener struct {
+	conns  chan net.Conn
+	closed chan struct{}
+	once   sync.Once
+}
+
+func newPipeListener() *pipeListener {
+	return &pipeListener{
+		conns:  make(chan net.Conn),
+		closed: make(chan struct{}),
+	}
+}
+
+func (l *pipeListener) Accept() (net.Conn, error) {
+	select {
+	case conn := <-l.conns:
+		return conn, nil
+	case <-l.closed:
+		return nil, net.ErrClosed
+	}
+}
+
+func (l *pipeListener) Close() error {
+	l.once.Do(func() { close(l.closed) })
+	return nil
+}
+
+func (l *pipeListener) Addr() net.Addr {
+	return pipeAddr{}
+}
+
+// pipeAddr is the address of both ends of a pipe
+type pipeAddr struct{}
+
+func (pipeAddr) Network() string { return "pipe" }
+func (pipeAddr) String() string  { return "pipe" }
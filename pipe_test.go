@@ -0,0 +1,107 @@
+package httpmodule
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+// newPipeClient returns a client whose requests are answered by handler over pipes
+func newPipeClient(t *testing.T, handler http.Handler) *HttpClient {
+	client := New()
+	transport := client.PipeTransport(handler)
+	t.Cleanup(func() { transport.Close() })
+	client.Transport = transport
+	return client
+}
+
+// TestPipeTransport tests a request and response round trip over net.Pipe.
+func TestPipeTransport(t *testing.T) {
+	client := newPipeClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		w.Header().Set("X-Seen", r.Header.Get("X-Test"))
+		w.WriteHeader(http.StatusCreated)
+		fmt.Fprintf(w, "%s %s %s %s", r.Method, r.Host, r.URL.Path, body)
+	}))
+
+	response, err := client.Post("https://example.com/items", "payload", map[string]string{"X-Test": "yes"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response.StatusCode != 201 {
+		t.Error("Expected status 201, got", response.StatusCode)
+	}
+	if response.Headers["X-Seen"] != "yes" {
+		t.Error("Expected request header to reach the handler, got", response.Headers["X-Seen"])
+	}
+	if response.Body != "POST example.com /items payload" {
+		t.Error("Expected echoed request, got", response.Body)
+	}
+}
+
+// TestPipeTransportChunked tests reading a chunked response from the handler.
+func TestPipeTransportChunked(t *testing.T) {
+	client := newPipeClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for i := 0; i < 3; i++ {
+			fmt.Fprintf(w, "part%d;", i)
+			w.(http.Flusher).Flush()
+		}
+	}))
+
+	response, err := client.Get("http://example.com/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response.Headers["Transfer-Encoding"] != "chunked" {
+		t.Error("Expected a chunked response, got", response.Headers)
+	}
+	if response.Body != "part0;part1;part2;" {
+		t.Error("Expected all chunks, got", response.Body)
+	}
+}
+
+// TestPipeTransportReuse tests that keep-alive connections are reused.
+func TestPipeTransportReuse(t *testing.T) {
+	var conns int32
+	client := New()
+	transport := client.PipeTransport(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "ok")
+	}))
+	transport.server.ConnState = func(_ net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			atomic.AddInt32(&conns, 1)
+		}
+	}
+	defer transport.Close()
+	client.Transport = transport
+
+	for i := 0; i < 3; i++ {
+		response, err := client.Get("http://example.com/", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if response.Body != "ok" {
+			t.Error("Expected body ok, got", response.Body)
+		}
+	}
+	if n := atomic.LoadInt32(&conns); n != 1 {
+		t.Error("Expected a single reused connection, got", n)
+	}
+}
+
+// TestPipeTransportClosed tests that requests fail once the transport is closed.
+func TestPipeTransportClosed(t *testing.T) {
+	client := New()
+	transport := client.PipeTransport(http.NotFoundHandler())
+	client.Transport = transport
+	transport.Close()
+
+	_, err := client.Get("http://example.com/", nil)
+	if err == nil || !strings.Contains(err.Error(), "closed") {
+		t.Error("Expected a closed transport error, got", err)
+	}
+}
@@ -0,0 +1,54 @@
+package httpmodule
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"sync"
+)
+
+// Buffers larger than this are dropped instead of being returned to the pool,
+// so a single huge request doesn't pin its memory for the life of the process.
+const maxPooledBufferSize = 64 << 10
+
+// Size of the bufio.Readers used to read responses
+const readerBufferSize = 4096
+
+var bufferPool = sync.Pool{
+	New: func() any {
+		return new(bytes.Buffer)
+	},
+}
+
+var readerPool sync.Pool
+
+// getBuffer returns an empty buffer from the pool
+func getBuffer() *bytes.Buffer {
+	buf := bufferPool.Get().(*bytes.Buffer)
+	buf.Reset()
+	return buf
+}
+
+// putBuffer returns a buffer to the pool once the caller is done with its contents
+func putBuffer(buf *bytes.Buffer) {
+	if buf.Cap() > maxPooledBufferSize {
+		return
+	}
+	bufferPool.Put(buf)
+}
+
+// getReader returns a pooled bufio.Reader reading from r
+func getReader(r io.Reader) *bufio.Reader {
+	if v := readerPool.Get(); v != nil {
+		reader := v.(*bufio.Reader)
+		reader.Reset(r)
+		return reader
+	}
+	return bufio.NewReaderSize(r, readerBufferSize)
+}
+
+// putReader returns a reader to the pool, dropping its reference to the underlying connection
+func putReader(reader *bufio.Reader) {
+	reader.Reset(nil)
+	readerPool.Put(reader)
+}
@@ -0,0 +1,219 @@
+package httpmodule
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	neturl "net/url"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// PostmanRequest is a request loaded from a Postman collection. Name is the
+// item's name prefixed by the folders it sits in, separated by slashes.
+type PostmanRequest struct {
+	Name    string
+	Request *HttpRequest
+}
+
+// postmanCollection is the part of the v2.1 collection format that is loaded
+type postmanCollection struct {
+	Item     []postmanItem     `json:"item"`
+	Variable []postmanVariable `json:"variable"`
+	Auth     *postmanAuth      `json:"auth"`
+}
+
+type postmanItem struct {
+	Name    string          `json:"name"`
+	Item    []postmanItem   `json:"item"`
+	Request *postmanRequest `json:"request"`
+	Auth    *postmanAuth    `json:"auth"`
+}
+
+type postmanRequest struct {
+	Method string            `json:"method"`
+	Header []postmanVariable `json:"header"`
+	URL    json.RawMessage   `json:"url"`
+	Body   *postmanBody      `json:"body"`
+	Auth   *postmanAuth      `json:"auth"`
+}
+
+type postmanBody struct {
+	Mode       string            `json:"mode"`
+	Raw        string            `json:"raw"`
+	URLEncoded []postmanVariable `json:"urlencoded"`
+}
+
+type postmanAuth struct {
+	Type   string            `json:"type"`
+	Bearer []postmanVariable `json:"bearer"`
+	Basic  []postmanVariable `json:"basic"`
+}
+
+type postmanVariable struct {
+	Key      string `json:"key"`
+	Value    string `json:"value"`
+	Disabled bool   `json:"disabled"`
+}
+
+// Postman variable reference, {{name}}
+var postmanVariablePattern = regexp.MustCompile(`\{\{\s*([^{}]+?)\s*\}\}`)
+
+// LoadPostmanCollection reads the Postman v2.1 collection at path. See
+// ReadPostmanCollection.
+func LoadPostmanCollection(path string, vars map[string]string) ([]PostmanRequest, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ReadPostmanCollection(f, vars)
+}
+
+// ReadPostmanCollection decodes a Postman v2.1 collection into requests, in
+// the order they appear, with folders flattened. {{name}} references are
+// substituted from vars, then from the collection's own variables; unknown
+// ones are left as they are. Bearer and basic auth become Authorization
+// headers. Raw and urlencoded bodies are supported.
+func ReadPostmanCollection(r io.Reader, vars map[string]string) ([]PostmanRequest, error) {
+	var collection postmanCollection
+	if err := json.NewDecoder(r).Decode(&collection); err != nil {
+		return nil, fmt.Errorf("failed to parse Postman collection: %v", err)
+	}
+
+	values := make(map[string]string, len(collection.Variable)+len(vars))
+	for _, v := range collection.Variable {
+		if !v.Disabled {
+			values[v.Key] = v.Value
+		}
+	}
+	for k, v := range vars {
+		values[k] = v
+	}
+	substitute := func(s string) string {
+		return postmanVariablePattern.ReplaceAllStringFunc(s, func(ref string) string {
+			name := postmanVariablePattern.FindStringSubmatch(ref)[1]
+			if v, ok := values[name]; ok {
+				return v
+			}
+			return ref
+		})
+	}
+
+	var requests []PostmanRequest
+	var walk func(items []postmanItem, prefix string, auth *postmanAuth) error
+	walk = func(items []postmanItem, prefix string, auth *postmanAuth) error {
+		for _, item := range items {
+			itemAuth := auth
+			if item.Auth != nil {
+				itemAuth = item.Auth
+			}
+			if item.Request == nil {
+				if err := walk(item.Item, prefix+item.Name+"/", itemAuth); err != nil {
+					return err
+				}
+				continue
+			}
+			req, err := item.Request.convert(substitute, itemAuth)
+			if err != nil {
+				return fmt.Errorf("postman item %q: %v", prefix+item.Name, err)
+			}
+			requests = append(requests, PostmanRequest{Name: prefix + item.Name, Request: req})
+		}
+		return nil
+	}
+	if err := walk(collection.Item, "", collection.Auth); err != nil {
+		return nil, err
+	}
+	return requests, nil
+}
+
+// convert builds the HttpRequest for a collection item
+func (request *postmanRequest) convert(substitute func(string) string, auth *postmanAuth) (*HttpRequest, error) {
+	url, err := request.url()
+	if err != nil {
+		return nil, err
+	}
+	req := &HttpRequest{
+		Method:  strings.ToUpper(request.Method),
+		URL:     substitute(url),
+		Headers: make(map[string]string, len(request.Header)),
+	}
+	if req.Method == "" {
+		req.Method = "GET"
+	}
+	for _, h := range request.Header {
+		if !h.Disabled {
+			req.Headers[substitute(h.Key)] = substitute(h.Value)
+		}
+	}
+
+	if request.Auth != nil {
+		auth = request.Auth
+	}
+	if auth != nil {
+		switch auth.Type {
+		case "bearer":
+			req.Headers["Authorization"] = "Bearer " + substitute(postmanLookup(auth.Bearer, "token"))
+		case "basic":
+			credentials := substitute(postmanLookup(auth.Basic, "username")) + ":" + substitute(postmanLookup(auth.Basic, "password"))
+			req.Headers["Authorization"] = "Basic " + base64.StdEncoding.EncodeToString([]byte(credentials))
+		case "noauth", "":
+		default:
+			return nil, fmt.Errorf("unsupported auth type %q", auth.Type)
+		}
+	}
+
+	if request.Body != nil {
+		switch request.Body.Mode {
+		case "raw":
+			req.Body = substitute(request.Body.Raw)
+		case "urlencoded":
+			form := neturl.Values{}
+			for _, field := range request.Body.URLEncoded {
+				if !field.Disabled {
+					form.Add(substitute(field.Key), substitute(field.Value))
+				}
+			}
+			req.Body = form.Encode()
+			if _, ok := req.Headers["Content-Type"]; !ok {
+				req.Headers["Content-Type"] = "application/x-www-form-urlencoded"
+			}
+		case "":
+		default:
+			return nil, fmt.Errorf("unsupported body mode %q", request.Body.Mode)
+		}
+	}
+	return req, nil
+}
+
+// url returns the request URL, which collections store either as a string or
+// as an object with the string in raw
+func (request *postmanRequest) url() (string, error) {
+	if len(request.URL) == 0 {
+		return "", fmt.Errorf("request has no url")
+	}
+	var raw string
+	if err := json.Unmarshal(request.URL, &raw); err == nil {
+		return raw, nil
+	}
+	var object struct {
+		Raw string `json:"raw"`
+	}
+	if err := json.Unmarshal(request.URL, &object); err != nil {
+		return "", fmt.Errorf("invalid url: %v", err)
+	}
+	return object.Raw, nil
+}
+
+// postmanLookup returns the value stored under key in an auth parameter list
+func postmanLookup(params []postmanVariable, key string) string {
+	for _, p := range params {
+		if p.Key == key {
+			return p.Value
+		}
+	}
+	return ""
+}
@@ -0,0 +1,55 @@
+package httpmodule
+
+import (
+	"strings"
+	"testing"
+)
+
+// TestLoadPostmanCollection tests folders, variables, auth, and bodies.
+func TestLoadPostmanCollection(t *testing.T) {
+	requests, err := LoadPostmanCollection("testdata/postman/collection.json", map[string]string{"userId": "42", "token": "override"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(requests) != 3 {
+		t.Fatal("Expected three requests, got", len(requests))
+	}
+
+	get := requests[0]
+	if get.Name != "Users/Get user" || get.Request.URL != "https://api.example.com/users/42" {
+		t.Error("Expected the substituted URL.", get.Name, get.Request.URL)
+	}
+	if get.Request.Headers["Authorization"] != "Bearer override" {
+		t.Error("Expected caller variables to win over the collection's.", get.Request.Headers)
+	}
+	if _, ok := get.Request.Headers["X-Debug"]; ok {
+		t.Error("Expected disabled headers to be skipped.")
+	}
+
+	create := requests[1]
+	if create.Request.Method != "POST" || create.Request.Body != `{"name": "{{name}}"}` {
+		t.Error("Expected unknown variables to be left alone.", create.Request.Body)
+	}
+
+	login := requests[2]
+	if login.Request.Method != "POST" || login.Request.Body != "remember=true" {
+		t.Error("Expected an urlencoded body.", login.Request.Method, login.Request.Body)
+	}
+	if login.Request.Headers["Authorization"] != "Basic YWxpY2U6c2VjcmV0" {
+		t.Error("Expected basic auth from the request.", login.Request.Headers)
+	}
+	if login.Request.Headers["Content-Type"] != "application/x-www-form-urlencoded" {
+		t.Error("Expected the form content type.", login.Request.Headers)
+	}
+}
+
+// TestReadPostmanCollectionErrors tests unsupported collection content.
+func TestReadPostmanCollectionErrors(t *testing.T) {
+	_, err := ReadPostmanCollection(strings.NewReader(`{"item":[{"name":"upload","request":{"url":"http://x","body":{"mode":"file"}}}]}`), nil)
+	if err == nil || !strings.Contains(err.Error(), "upload") {
+		t.Error("Expected an error naming the item, got", err)
+	}
+	if _, err := ReadPostmanCollection(strings.NewReader(`not json`), nil); err == nil {
+		t.Error("Expected an error for invalid JSON.")
+	}
+}
@@ -0,0 +1,77 @@
+package httpmodule
+
+import (
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// TransferProgress is a snapshot of a body going over the wire, passed to an
+// HttpRequest's Progress callback
+type TransferProgress struct {
+	// Set for the request body being sent, clear for the response body
+	// being read
+	Upload bool
+
+	// Bytes sent or read so far, as they go over the wire, so before a
+	// compressed response body is decoded
+	Transferred int64
+
+	// Length of the whole body, or -1 if unknown
+	Total int64
+
+	// Time since the transfer started
+	Elapsed time.Duration
+}
+
+// transferMeter counts the bytes of one body and reports them
+type transferMeter struct {
+	report func(TransferProgress)
+	clock  Clock
+	start  time.Time
+	upload bool
+	total  int64
+	done   int64
+}
+
+func newTransferMeter(report func(TransferProgress), clock Clock, upload bool, total int64) *transferMeter {
+	clock = clockOrReal(clock)
+	return &transferMeter{report: report, clock: clock, start: clock.Now(), upload: upload, total: total}
+}
+
+// add counts n more bytes and reports the progress
+func (m *transferMeter) add(n int) {
+	if m == nil || n <= 0 {
+		return
+	}
+	m.done += int64(n)
+	m.report(TransferProgress{
+		Upload:      m.upload,
+		Transferred: m.done,
+		Total:       m.total,
+		Elapsed:     m.clock.Now().Sub(m.start),
+	})
+}
+
+// progressReader counts the bytes read through it
+type progressReader struct {
+	reader io.Reader
+	meter  *transferMeter
+}
+
+func (r *progressReader) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+	r.meter.add(n)
+	return n, err
+}
+
+// responseLength returns the length of response's body from Content-Length,
+// or -1 if it doesn't give one
+func responseLength(response *HttpResponse) int64 {
+	n, err := strconv.ParseInt(strings.TrimSpace(headerValue(response.Headers, "Content-Length")), 10, 64)
+	if err != nil || n < 0 {
+		return -1
+	}
+	return n
+}
@@ -0,0 +1,77 @@
+package httpmodule
+
+import (
+	"bytes"
+	"io"
+	"strconv"
+	"testing"
+)
+
+// TestProgress tests reporting a streamed upload and a download as they go.
+func TestProgress(t *testing.T) {
+	payload := testPayload(200 << 10)
+	_, addr := startServer(t, HandlerFunc(func(w ResponseWriter, req *ServerRequest) {
+		received, _ := io.Copy(io.Discard, req.Body)
+		w.Header()["X-Received"] = strconv.FormatInt(received, 10)
+		w.Header()["Content-Length"] = strconv.Itoa(len(payload))
+		w.Write(payload)
+	}))
+	client := New()
+
+	var uploads, downloads []TransferProgress
+	req := &HttpRequest{
+		Method:        "PUT",
+		URL:           "http://" + addr + "/",
+		BodyReader:    bytes.NewReader(payload),
+		ContentLength: int64(len(payload)),
+		Progress: func(p TransferProgress) {
+			if p.Upload {
+				uploads = append(uploads, p)
+			} else {
+				downloads = append(downloads, p)
+			}
+		},
+	}
+	response, err := client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(response.Body) != len(payload) || response.Headers["X-Received"] != strconv.Itoa(len(payload)) {
+		t.Fatal("Expected the payload both ways, got", len(response.Body), response.Headers["X-Received"])
+	}
+
+	for name, reports := range map[string][]TransferProgress{"upload": uploads, "download": downloads} {
+		if len(reports) < 2 {
+			t.Errorf("Expected the %s reported in pieces, got %v", name, reports)
+			continue
+		}
+		last := reports[len(reports)-1]
+		if last.Transferred != int64(len(payload)) || last.Total != int64(len(payload)) {
+			t.Errorf("Expected the %s complete in the last report, got %+v", name, last)
+		}
+		for i := 1; i < len(reports); i++ {
+			if reports[i].Transferred <= reports[i-1].Transferred || reports[i].Elapsed < reports[i-1].Elapsed {
+				t.Errorf("Expected the %s reports to grow, got %+v then %+v", name, reports[i-1], reports[i])
+			}
+		}
+	}
+}
+
+// TestProgressBuffered tests reporting bodies held in memory in one go.
+func TestProgressBuffered(t *testing.T) {
+	client := New()
+	client.Transport = RoundTripFunc(func(req *HttpRequest) (*HttpResponse, error) {
+		return &HttpResponse{StatusCode: 200, Headers: map[string]string{}, Body: "response"}, nil
+	})
+	var reports []TransferProgress
+	_, err := client.Do(&HttpRequest{Method: "POST", URL: "http://example.com/", Body: "request", Progress: func(p TransferProgress) {
+		reports = append(reports, p)
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(reports) != 2 || !reports[0].Upload || reports[0].Transferred != 7 || reports[0].Total != 7 ||
+		reports[1].Upload || reports[1].Transferred != 8 || reports[1].Total != -1 {
+		t.Errorf("Expected one report each way, got %+v", reports)
+	}
+}
@@ -0,0 +1,128 @@
+package httpmodule
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"io"
+	"log"
+	"net"
+	neturl "net/url"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestClientProxy tests sending http requests to a proxy and tunnelling https ones.
+func TestClientProxy(t *testing.T) {
+	_, upstream := startServer(t, HandlerFunc(func(w ResponseWriter, req *ServerRequest) {
+		io.WriteString(w, req.Method+" "+req.Target)
+	}))
+
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	writeTestCert(t, certFile, keyFile, "secure", "secure.test")
+	secure := startTLSServer(t, HandlerFunc(func(w ResponseWriter, req *ServerRequest) {
+		io.WriteString(w, "secure "+req.Target)
+	}), nil, certFile, keyFile)
+
+	forward := &ForwardProxy{
+		Allow:    []string{"127.0.0.1", "secure.test"},
+		ErrorLog: log.New(io.Discard, "", 0),
+		Dial: func(network, addr string) (net.Conn, error) {
+			return net.Dial(network, secure)
+		},
+	}
+	seen := make(chan string, 3)
+	_, proxyAddr := startServer(t, HandlerFunc(func(w ResponseWriter, req *ServerRequest) {
+		seen <- req.Method + " " + req.Target + " " + req.Headers["Proxy-Authorization"]
+		forward.ServeHTTP(w, req)
+	}))
+
+	pem, err := os.ReadFile(certFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	roots := x509.NewCertPool()
+	roots.AppendCertsFromPEM(pem)
+	client := New()
+	client.TLSConfig = &tls.Config{RootCAs: roots}
+	proxyURL, _ := neturl.Parse("http://user:secret@" + proxyAddr)
+	client.Proxy = ProxyURL(proxyURL)
+
+	response, err := client.Get("http://"+upstream+"/plain", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response.Body != "GET /plain" {
+		t.Error("Expected the request forwarded by the proxy, got", response.Body)
+	}
+
+	response, err = client.Get("https://secure.test/tunnelled", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response.Body != "secure /tunnelled" {
+		t.Error("Expected the request through the tunnel, got", response.Body)
+	}
+
+	auth := "Basic dXNlcjpzZWNyZXQ="
+	for _, want := range []string{"GET http://" + upstream + "/plain " + auth, "CONNECT secure.test:443 " + auth} {
+		if got := <-seen; got != want {
+			t.Errorf("Expected the proxy to see %q, got %q", want, got)
+		}
+	}
+
+	if _, err := client.Get("https://other.test/", nil); err == nil {
+		t.Error("Expected a refused tunnel to fail.")
+	}
+}
+
+// TestProxyFromEnvironment tests choosing proxies from the standard variables.
+func TestProxyFromEnvironment(t *testing.T) {
+	t.Setenv("HTTP_PROXY", "proxy.corp:3128")
+	t.Setenv("HTTPS_PROXY", "https://user:pw@secure-proxy.corp")
+	t.Setenv("NO_PROXY", "internal.corp, .svc.local,10.0.0.0/8 api.example.com:8443,192.168.1.5")
+	t.Setenv("REQUEST_METHOD", "")
+
+	tests := []struct {
+		url   string
+		proxy string
+	}{
+		{"http://example.com/", "http://proxy.corp:3128"},
+		{"https://example.com/", "https://user:pw@secure-proxy.corp"},
+		{"http://internal.corp/", ""},
+		{"http://build.internal.corp/", ""},
+		{"http://svc.local/", "http://proxy.corp:3128"},
+		{"http://db.svc.local/", ""},
+		{"http://10.1.2.3/", ""},
+		{"http://192.168.1.5/", ""},
+		{"http://192.168.1.6/", "http://proxy.corp:3128"},
+		{"https://api.example.com:8443/", ""},
+		{"https://api.example.com/", "https://user:pw@secure-proxy.corp"},
+		{"http://localhost:8080/", ""},
+		{"http://127.0.0.1/", ""},
+	}
+	for _, test := range tests {
+		proxy, err := ProxyFromEnvironment(&HttpRequest{URL: test.url})
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := ""
+		if proxy != nil {
+			got = proxy.String()
+		}
+		if got != test.proxy {
+			t.Errorf("Expected proxy %q for %s, got %q", test.proxy, test.url, got)
+		}
+	}
+
+	t.Setenv("NO_PROXY", "*")
+	if proxy, _ := ProxyFromEnvironment(&HttpRequest{URL: "http://example.com/"}); proxy != nil {
+		t.Error("Expected NO_PROXY=* to bypass the proxy.")
+	}
+	t.Setenv("NO_PROXY", "")
+	t.Setenv("REQUEST_METHOD", "GET")
+	if proxy, _ := ProxyFromEnvironment(&HttpRequest{URL: "http://example.com/"}); proxy != nil {
+		t.Error("Expected HTTP_PROXY to be ignored under CGI.")
+	}
+}
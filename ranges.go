@@ -0,0 +1,148 @@
+package httpmodule
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"strconv"
+	"strings"
+)
+
+// ByteRange is a span of a resource's bytes for GetRanges, from Start to End
+// inclusive. An End of -1 runs to the end of the resource, and a Start of -1
+// asks for the last End bytes.
+type ByteRange struct {
+	Start, End int64
+}
+
+// String returns the range as a Range header lists it, such as "0-499"
+func (r ByteRange) String() string {
+	switch {
+	case r.Start < 0:
+		return "-" + strconv.FormatInt(r.End, 10)
+	case r.End < 0:
+		return strconv.FormatInt(r.Start, 10) + "-"
+	}
+	return strconv.FormatInt(r.Start, 10) + "-" + strconv.FormatInt(r.End, 10)
+}
+
+// RangePart is one span of a resource a server sent, from First to Last
+// inclusive
+type RangePart struct {
+	First, Last int64
+
+	// Length of the whole resource, or -1 if the server didn't say
+	Total int64
+
+	// Type of the resource, as given for the part
+	ContentType string
+
+	Data []byte
+}
+
+// GetRanges gets the given ranges of url, returning the parts the server
+// sent in the order it sent them. A server may merge overlapping ranges, and
+// one that ignores Range sends the whole resource as a single part. A 416
+// or any other status but 200 and 206 is returned as a *StatusError.
+func (client *HttpClient) GetRanges(url string, headers map[string]string, ranges ...ByteRange) ([]RangePart, error) {
+	if len(ranges) == 0 {
+		return nil, errors.New("no ranges to get")
+	}
+	specs := make([]string, len(ranges))
+	for i, r := range ranges {
+		if r.Start < 0 && r.End <= 0 || r.Start >= 0 && r.End >= 0 && r.End < r.Start {
+			return nil, fmt.Errorf("invalid range %s", r)
+		}
+		specs[i] = r.String()
+	}
+	headers = withHeader(headers, "Range", "bytes="+strings.Join(specs, ","))
+	// Ranges count the bytes of the resource as it is, not compressed
+	headers = withHeader(headers, "Accept-Encoding", "identity")
+
+	response, err := client.Get(url, headers)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := response.ReadBody(); err != nil {
+		return nil, err
+	}
+	if response.StatusCode == 200 {
+		size := int64(len(response.Body))
+		return []RangePart{{
+			First:       0,
+			Last:        size - 1,
+			Total:       size,
+			ContentType: headerValue(response.Headers, "Content-Type"),
+			Data:        []byte(response.Body),
+		}}, nil
+	}
+	if response.StatusCode != 206 {
+		return nil, &StatusError{Response: response}
+	}
+	return ParseRanges(response)
+}
+
+// ParseRanges returns the parts of a 206 Partial Content response: its
+// body, placed by Content-Range, or each part of a multipart/byteranges
+// body. Each part's Content-Range has to be well formed and match the
+// length of its data.
+func ParseRanges(response *HttpResponse) ([]RangePart, error) {
+	if response.StatusCode != 206 {
+		return nil, fmt.Errorf("expected 206 Partial Content, got %d", response.StatusCode)
+	}
+	body, err := response.ReadBody()
+	if err != nil {
+		return nil, err
+	}
+	contentType := headerValue(response.Headers, "Content-Type")
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil || mediaType != "multipart/byteranges" {
+		part, err := rangePart(headerValue(response.Headers, "Content-Range"), contentType, []byte(body))
+		if err != nil {
+			return nil, err
+		}
+		return []RangePart{part}, nil
+	}
+
+	if params["boundary"] == "" {
+		return nil, protocolError("multipart/byteranges response without a boundary")
+	}
+	reader := multipart.NewReader(strings.NewReader(body), params["boundary"])
+	var parts []RangePart
+	for {
+		p, err := reader.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, &ProtocolError{Err: fmt.Errorf("malformed multipart/byteranges body: %v", err)}
+		}
+		data, err := io.ReadAll(p)
+		if err != nil {
+			return nil, &ProtocolError{Err: fmt.Errorf("malformed multipart/byteranges body: %v", err)}
+		}
+		part, err := rangePart(p.Header.Get("Content-Range"), p.Header.Get("Content-Type"), data)
+		if err != nil {
+			return nil, err
+		}
+		parts = append(parts, part)
+	}
+	if len(parts) == 0 {
+		return nil, protocolError("multipart/byteranges response without parts")
+	}
+	return parts, nil
+}
+
+// rangePart returns the part placed by contentRange holding data
+func rangePart(contentRange, contentType string, data []byte) (RangePart, error) {
+	first, last, total, ok := parseContentRange(contentRange)
+	if !ok || first < 0 {
+		return RangePart{}, &ProtocolError{Err: fmt.Errorf("invalid Content-Range %q", contentRange)}
+	}
+	if int64(len(data)) != last-first+1 {
+		return RangePart{}, &ProtocolError{Err: fmt.Errorf("Content-Range %q doesn't match the %d bytes sent", contentRange, len(data))}
+	}
+	return RangePart{First: first, Last: last, Total: total, ContentType: contentType, Data: data}, nil
+}
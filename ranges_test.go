@@ -0,0 +1,82 @@
+package httpmodule
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+// TestGetRanges tests single, suffix, and multipart range responses.
+func TestGetRanges(t *testing.T) {
+	ds := startDownloadServer(t, fstest.MapFS{"f.txt": {Data: []byte("0123456789"), ModTime: time.Unix(1700000000, 0)}})
+	client := New()
+	url := "http://" + ds.addr + "/f.txt"
+
+	describe := func(parts []RangePart) string {
+		var described []string
+		for _, part := range parts {
+			described = append(described, ByteRange{part.First, part.Last}.String()+" "+string(part.Data))
+		}
+		return strings.Join(described, ", ")
+	}
+	for _, test := range []struct {
+		ranges []ByteRange
+		want   string
+	}{
+		{[]ByteRange{{2, 4}}, "2-4 234"},
+		{[]ByteRange{{7, -1}}, "7-9 789"},
+		{[]ByteRange{{-1, 2}}, "8-9 89"},
+		{[]ByteRange{{0, 1}, {8, -1}}, "0-1 01, 8-9 89"},
+	} {
+		parts, err := client.GetRanges(url, nil, test.ranges...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := describe(parts); got != test.want || parts[0].Total != 10 {
+			t.Errorf("Expected %q for %v, got %q", test.want, test.ranges, got)
+		}
+	}
+
+	var statusErr *StatusError
+	if _, err := client.GetRanges(url, nil, ByteRange{20, 30}); !errors.As(err, &statusErr) || statusErr.Response.StatusCode != 416 {
+		t.Error("Expected a 416 StatusError, got", err)
+	}
+	if _, err := client.GetRanges(url, nil, ByteRange{5, 2}); err == nil {
+		t.Error("Expected an invalid range to be refused")
+	}
+
+	ds.mu.Lock()
+	ds.noRanges = true
+	ds.mu.Unlock()
+	parts, err := client.GetRanges(url, nil, ByteRange{2, 4})
+	if err != nil || describe(parts) != "0-9 0123456789" {
+		t.Error("Expected the whole file from a server ignoring ranges, got", describe(parts), err)
+	}
+}
+
+// TestParseRanges tests that bad Content-Range values are refused.
+func TestParseRanges(t *testing.T) {
+	for _, test := range []struct {
+		headers map[string]string
+		body    string
+	}{
+		{map[string]string{"Content-Range": "bytes 0-4/10"}, "0123"},
+		{map[string]string{"Content-Range": "bytes 4-2/10"}, ""},
+		{map[string]string{"Content-Range": "bytes 0-10/10"}, "0123456789"},
+		{map[string]string{}, "0123"},
+		{map[string]string{"Content-Type": "multipart/byteranges; boundary=b"}, "--b\r\nContent-Range: bytes 0-1/10\r\n\r\n012\r\n--b--\r\n"},
+	} {
+		var protoErr *ProtocolError
+		_, err := ParseRanges(&HttpResponse{StatusCode: 206, Headers: test.headers, Body: test.body})
+		if !errors.As(err, &protoErr) {
+			t.Errorf("Expected a ProtocolError for %v %q, got %v", test.headers, test.body, err)
+		}
+	}
+
+	parts, err := ParseRanges(&HttpResponse{StatusCode: 206, Headers: map[string]string{"Content-Range": "bytes 5-7/*"}, Body: "567"})
+	if err != nil || parts[0].First != 5 || parts[0].Total != -1 {
+		t.Error("Expected a part of unknown total, got", parts, err)
+	}
+}
@@ -0,0 +1,164 @@
+package httpmodule
+
+import (
+	"math"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// RateLimitStore holds the token buckets RateLimit draws from. The memory
+// store suits a single server; an implementation backed by a shared database
+// lets several servers enforce one limit.
+type RateLimitStore interface {
+	// Take removes a token from key's bucket, which refills at rate tokens
+	// a second up to burst. When the bucket is empty it reports how long
+	// until a token is available instead.
+	Take(key string, now time.Time, rate float64, burst int) (ok bool, retryAfter time.Duration, err error)
+}
+
+// RateLimitOptions controls RateLimit
+type RateLimitOptions struct {
+	// Requests allowed per second, on average
+	Rate float64
+
+	// Requests allowed at once after a quiet period; zero means Rate rounded up
+	Burst int
+
+	// Picks the bucket a request draws from; nil uses ClientIP
+	Key func(req *ServerRequest) string
+
+	// Where buckets are kept; nil keeps them in memory
+	Store RateLimitStore
+
+	// Source of time for refilling buckets; nil uses the real clock
+	Clock Clock
+}
+
+// RateLimit returns middleware that limits how often each key, by default
+// each client address, can make requests, answering the excess with 429 Too
+// Many Requests and a Retry-After header. If the store fails, requests are let
+// through rather than taking the service down with it.
+func RateLimit(options RateLimitOptions) Middleware {
+	if options.Burst <= 0 {
+		options.Burst = int(math.Ceil(options.Rate))
+		if options.Burst < 1 {
+			options.Burst = 1
+		}
+	}
+	if options.Key == nil {
+		options.Key = ClientIP
+	}
+	if options.Store == nil {
+		options.Store = NewMemoryRateLimitStore()
+	}
+	clock := clockOrReal(options.Clock)
+
+	return func(next Handler) Handler {
+		return HandlerFunc(func(w ResponseWriter, req *ServerRequest) {
+			ok, retryAfter, err := options.Store.Take(options.Key(req), clock.Now(), options.Rate, options.Burst)
+			if err == nil && !ok {
+				seconds := int(math.Ceil(retryAfter.Seconds()))
+				if seconds < 1 {
+					seconds = 1
+				}
+				w.Header()["Retry-After"] = strconv.Itoa(seconds)
+				w.WriteHeader(429)
+				return
+			}
+			next.ServeHTTP(w, req)
+		})
+	}
+}
+
+// ClientIP returns the address a request came from, without its port
+func ClientIP(req *ServerRequest) string {
+	if host, _, err := net.SplitHostPort(req.RemoteAddr); err == nil {
+		return host
+	}
+	return req.RemoteAddr
+}
+
+// KeyByHeader returns a RateLimit key function that uses a header, such as an
+// API key, falling back to the client address for requests without it
+func KeyByHeader(name string) func(req *ServerRequest) string {
+	return func(req *ServerRequest) string {
+		if value := headerValue(req.Headers, name); value != "" {
+			return name + ":" + value
+		}
+		return ClientIP(req)
+	}
+}
+
+// Number of Take calls between sweeps of full buckets from a memory store
+const rateLimitSweepInterval = 1024
+
+// MemoryRateLimitStore is a RateLimitStore held in the process's memory
+type MemoryRateLimitStore struct {
+	mu      sync.Mutex
+	buckets map[string]*tokenBucket
+	takes   int
+}
+
+// tokenBucket keeps the rate and burst it was last taken from with, which
+// can differ from key to key, so a sweep can tell when it is full
+type tokenBucket struct {
+	tokens  float64
+	updated time.Time
+	rate    float64
+	burst   int
+}
+
+// NewMemoryRateLimitStore returns an empty in-memory store
+func NewMemoryRateLimitStore() *MemoryRateLimitStore {
+	return &MemoryRateLimitStore{buckets: make(map[string]*tokenBucket)}
+}
+
+func (store *MemoryRateLimitStore) Take(key string, now time.Time, rate float64, burst int) (bool, time.Duration, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	store.takes++
+	if store.takes%rateLimitSweepInterval == 0 {
+		store.sweep(now)
+	}
+
+	bucket, ok := store.buckets[key]
+	if !ok {
+		bucket = &tokenBucket{tokens: float64(burst), updated: now}
+		store.buckets[key] = bucket
+	}
+	bucket.rate, bucket.burst = rate, burst
+	bucket.refill(now)
+	if bucket.tokens >= 1 {
+		bucket.tokens--
+		return true, 0, nil
+	}
+	if rate <= 0 {
+		return false, time.Hour, nil
+	}
+	return false, time.Duration((1 - bucket.tokens) / rate * float64(time.Second)), nil
+}
+
+// sweep forgets buckets that have refilled completely, as a new bucket would
+// be the same
+func (store *MemoryRateLimitStore) sweep(now time.Time) {
+	for key, bucket := range store.buckets {
+		bucket.refill(now)
+		if bucket.tokens >= float64(bucket.burst) {
+			delete(store.buckets, key)
+		}
+	}
+}
+
+// refill adds the tokens earned since the bucket was last updated
+func (bucket *tokenBucket) refill(now time.Time) {
+	if elapsed := now.Sub(bucket.updated); elapsed > 0 {
+		bucket.tokens += elapsed.Seconds() * bucket.rate
+		if bucket.tokens > float64(bucket.burst) {
+			bucket.tokens = float64(bucket.burst)
+		}
+		bucket.updated = now
+	}
+}
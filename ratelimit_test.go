@@ -0,0 +1,95 @@
+package httpmodule
+
+import (
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// failingStore is a RateLimitStore that is always unavailable.
+type failingStore struct{}
+
+func (failingStore) Take(key string, now time.Time, rate float64, burst int) (bool, time.Duration, error) {
+	return false, 0, errors.New("store unavailable")
+}
+
+// TestRateLimit tests limiting requests per client address.
+func TestRateLimit(t *testing.T) {
+	clock := NewFakeClock(time.Unix(0, 0))
+	handler := RateLimit(RateLimitOptions{Rate: 0.5, Burst: 2, Clock: clock})(HandlerFunc(func(w ResponseWriter, req *ServerRequest) {}))
+	request := func(addr string) *responseRecorder {
+		rec := newResponseRecorder()
+		handler.ServeHTTP(rec, &ServerRequest{Method: "GET", Path: "/", RemoteAddr: addr, Headers: map[string]string{}})
+		return rec
+	}
+
+	for i := 0; i < 2; i++ {
+		if rec := request("192.0.2.1:1000"); rec.status != 0 {
+			t.Fatal("Expected the burst to be allowed, got", rec.status)
+		}
+	}
+	rec := request("192.0.2.1:2000")
+	if rec.status != 429 || rec.headers["Retry-After"] != "2" {
+		t.Error("Expected 429 with Retry-After, got", rec.status, rec.headers)
+	}
+	if rec := request("192.0.2.2:1000"); rec.status != 0 {
+		t.Error("Expected other clients to have their own bucket, got", rec.status)
+	}
+
+	clock.Advance(2 * time.Second)
+	if rec := request("192.0.2.1:1000"); rec.status != 0 {
+		t.Error("Expected a token after refilling, got", rec.status)
+	}
+	if rec := request("192.0.2.1:1000"); rec.status != 429 {
+		t.Error("Expected the refilled token to be used up, got", rec.status)
+	}
+}
+
+// TestRateLimitKeys tests keying by header and failing open.
+func TestRateLimitKeys(t *testing.T) {
+	handler := RateLimit(RateLimitOptions{Rate: 1, Key: KeyByHeader("X-API-Key"), Clock: NewFakeClock(time.Unix(0, 0))})(HandlerFunc(func(w ResponseWriter, req *ServerRequest) {}))
+	status := func(key string) int {
+		rec := newResponseRecorder()
+		handler.ServeHTTP(rec, &ServerRequest{RemoteAddr: "192.0.2.1:1000", Headers: map[string]string{"X-API-Key": key}})
+		return rec.status
+	}
+	if status("a") != 0 || status("b") != 0 || status("a") != 429 || status("") != 0 || status("") != 429 {
+		t.Error("Expected one bucket per API key, and one for the address without a key.")
+	}
+
+	handler = RateLimit(RateLimitOptions{Rate: 1, Store: failingStore{}})(HandlerFunc(func(w ResponseWriter, req *ServerRequest) {}))
+	for i := 0; i < 3; i++ {
+		if rec := serve(handler, "GET", "/"); rec.status != 200 {
+			t.Error("Expected requests through when the store fails, got", rec.status)
+		}
+	}
+}
+
+// TestMemoryRateLimitStoreSweep tests that refilled buckets are forgotten.
+func TestMemoryRateLimitStoreSweep(t *testing.T) {
+	store := NewMemoryRateLimitStore()
+	now := time.Unix(0, 0)
+	for i := 0; i < rateLimitSweepInterval-1; i++ {
+		store.Take(strconv.Itoa(i), now, 1, 1)
+	}
+	store.Take("last", now.Add(time.Minute), 1, 1)
+	if len(store.buckets) != 1 {
+		t.Error("Expected only the newest bucket to be kept, got", len(store.buckets))
+	}
+}
+
+// TestMemoryRateLimitStoreSweepLimits tests that a sweep judges each bucket
+// by its own rate and burst, not those of the request that started it.
+func TestMemoryRateLimitStoreSweepLimits(t *testing.T) {
+	store := NewMemoryRateLimitStore()
+	now := time.Unix(0, 0)
+	store.Take("strict", now, 1.0/3600, 5)
+	for i := 0; i < rateLimitSweepInterval-2; i++ {
+		store.Take(strconv.Itoa(i), now, 100, 1)
+	}
+	store.Take("generous", now.Add(time.Minute), 100, 1)
+	if _, ok := store.buckets["strict"]; !ok || len(store.buckets) != 2 {
+		t.Error("Expected the strict bucket, still refilling, to be kept, got", len(store.buckets))
+	}
+}
@@ -0,0 +1,60 @@
+package httpmodule
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Redirects a request follows when the client doesn't set MaxRedirects
+const defaultMaxRedirects = 10
+
+// ErrUseLastResponse can be returned by CheckRedirect to stop following
+// redirects and return the redirect response itself, unread body included
+var ErrUseLastResponse = errors.New("httpmodule: use last response")
+
+// followRedirects sends req with send and follows the redirects it gets back.
+// 301, 302, and 303 drop the body and turn any method but GET and HEAD into
+// GET; 307 and 308 resend the request as it was. Credentials and cookies are
+// dropped once the chain leaves the original host and its subdomains, and
+// Referer names the previous URL.
+func (client *HttpClient) followRedirects(req *HttpRequest, send func(*HttpRequest) (*HttpResponse, error)) (*HttpResponse, error) {
+	limit := client.MaxRedirects
+	if limit == 0 {
+		limit = defaultMaxRedirects
+	}
+
+	current := req
+	var via []*HttpRequest
+	stripSensitive := false
+	for {
+		response, err := send(current)
+		if err != nil || limit < 0 {
+			return response, err
+		}
+		next, err := compatRedirect(req, current, response, &stripSensitive)
+		if err != nil {
+			response.Close()
+			return nil, err
+		}
+		if next == nil {
+			return response, nil
+		}
+
+		via = append(via, current)
+		if len(via) > limit {
+			response.Close()
+			return nil, fmt.Errorf("%s %s: stopped after %d redirects", req.Method, current.URL, limit)
+		}
+		if client.CheckRedirect != nil {
+			if err := client.CheckRedirect(next, via); err != nil {
+				if err == ErrUseLastResponse {
+					return response, nil
+				}
+				response.Close()
+				return nil, err
+			}
+		}
+		response.Close()
+		current = next
+	}
+}
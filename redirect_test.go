@@ -0,0 +1,97 @@
+package httpmodule
+
+import (
+	"errors"
+	"io"
+	"testing"
+)
+
+// redirectHandler redirects /NNN to /final with status NNN, loops on /loop,
+// and answers everything else with the method and body it got.
+var redirectHandler = HandlerFunc(func(w ResponseWriter, req *ServerRequest) {
+	body, _ := io.ReadAll(req.Body)
+	switch req.Path {
+	case "/301", "/302", "/303", "/307", "/308":
+		w.Header()["Location"] = "/final"
+		w.WriteHeader(map[string]int{"/301": 301, "/302": 302, "/303": 303, "/307": 307, "/308": 308}[req.Path])
+	case "/loop":
+		w.Header()["Location"] = "/loop"
+		w.WriteHeader(302)
+	default:
+		w.Write([]byte(req.Method + " " + req.Path + " " + string(body)))
+	}
+})
+
+// TestRedirects tests that redirects are followed with the right method and body.
+func TestRedirects(t *testing.T) {
+	_, addr := startServer(t, redirectHandler)
+	client := New()
+	client.HostOverrides = map[string]string{"redirect.test": addr}
+
+	tests := []struct {
+		path string
+		want string
+	}{
+		{"/301", "GET /final "},
+		{"/302", "GET /final "},
+		{"/303", "GET /final "},
+		{"/307", "POST /final data"},
+		{"/308", "POST /final data"},
+	}
+	for _, test := range tests {
+		response, err := client.Post("http://redirect.test"+test.path, "data", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if response.StatusCode != 200 || response.Body != test.want {
+			t.Errorf("Expected %q after %s, got %d %q", test.want, test.path, response.StatusCode, response.Body)
+		}
+	}
+
+	if _, err := client.Get("http://redirect.test/loop", nil); err == nil {
+		t.Error("Expected a redirect loop to fail.")
+	}
+
+	client.MaxRedirects = -1
+	response, err := client.Get("http://redirect.test/301", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response.StatusCode != 301 {
+		t.Error("Expected the redirect itself with following disabled, got", response.StatusCode)
+	}
+}
+
+// TestCheckRedirect tests that CheckRedirect sees the chain and can stop it.
+func TestCheckRedirect(t *testing.T) {
+	_, addr := startServer(t, redirectHandler)
+	client := New()
+	client.HostOverrides = map[string]string{"redirect.test": addr}
+
+	var hops int
+	client.CheckRedirect = func(req *HttpRequest, via []*HttpRequest) error {
+		hops = len(via)
+		if len(via) == 3 {
+			return ErrUseLastResponse
+		}
+		return nil
+	}
+	response, err := client.Get("http://redirect.test/loop", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response.StatusCode != 302 || hops != 3 {
+		t.Errorf("Expected the third redirect to be returned, got %d after %d", response.StatusCode, hops)
+	}
+
+	stop := errors.New("stop")
+	client.CheckRedirect = func(req *HttpRequest, via []*HttpRequest) error {
+		if req.URL != "http://redirect.test/final" || via[0].URL != "http://redirect.test/307" {
+			t.Error("Expected the next request and the chain so far, got", req.URL, via[0].URL)
+		}
+		return stop
+	}
+	if _, err := client.Get("http://redirect.test/307", nil); err != stop {
+		t.Error("Expected CheckRedirect's error, got", err)
+	}
+}
@@ -0,0 +1,122 @@
+package httpmodule
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	neturl "net/url"
+)
+
+// RequestBuilder puts a request together step by step, as in
+//
+//	client.NewRequest("GET", url).Query("page", "2").Header("X-Api-Key", key).Send(ctx)
+//
+// The first problem found, such as an invalid method or URL, is kept and
+// returned by Build and Send.
+type RequestBuilder struct {
+	client  *HttpClient
+	method  string
+	url     *neturl.URL
+	query   neturl.Values
+	headers map[string]string
+	body    string
+	err     error
+}
+
+// NewRequest starts building a request with method to url
+func (client *HttpClient) NewRequest(method, url string) *RequestBuilder {
+	b := &RequestBuilder{client: client, method: method, headers: make(map[string]string)}
+	if method == "" || !validMethod(method) {
+		b.err = fmt.Errorf("invalid method %q", method)
+		return b
+	}
+	parsedURL, err := neturl.Parse(url)
+	if err != nil {
+		b.err = fmt.Errorf("failed to parse URL: %v", err)
+		return b
+	}
+	if parsedURL.Scheme != "http" && parsedURL.Scheme != "https" {
+		b.err = fmt.Errorf("unsupported URL scheme %q", parsedURL.Scheme)
+		return b
+	}
+	if parsedURL.Host == "" {
+		b.err = errors.New("URL has no host")
+		return b
+	}
+	b.url = parsedURL
+	return b
+}
+
+// Query adds value to the query parameter key, after any the URL has
+func (b *RequestBuilder) Query(key, value string) *RequestBuilder {
+	if b.query == nil {
+		b.query = make(neturl.Values)
+	}
+	b.query.Add(key, value)
+	return b
+}
+
+// Header sets the header key, replacing it in whatever case it was set before
+func (b *RequestBuilder) Header(key, value string) *RequestBuilder {
+	deleteHeader(b.headers, key)
+	b.headers[key] = value
+	return b
+}
+
+// Body sets the request body
+func (b *RequestBuilder) Body(body string) *RequestBuilder {
+	b.body = body
+	return b
+}
+
+// BodyJSON sets the body to v marshaled as JSON and labels it as such
+func (b *RequestBuilder) BodyJSON(v any) *RequestBuilder {
+	data, err := json.Marshal(v)
+	if err != nil {
+		if b.err == nil {
+			b.err = fmt.Errorf("failed to encode request body: %v", err)
+		}
+		return b
+	}
+	b.body = string(data)
+	return b.Header("Content-Type", "application/json")
+}
+
+// BodyForm sets the body to form URL-encoded and labels it as such
+func (b *RequestBuilder) BodyForm(form neturl.Values) *RequestBuilder {
+	b.body = form.Encode()
+	return b.Header("Content-Type", "application/x-www-form-urlencoded")
+}
+
+// Build returns the request built so far. Each call returns a new request,
+// which the builder doesn't touch again, so it can be kept and sent any
+// number of times; use Clone to make changed copies of it.
+func (b *RequestBuilder) Build() (*HttpRequest, error) {
+	if b.err != nil {
+		return nil, b.err
+	}
+	u := *b.url
+	if len(b.query) > 0 {
+		query := u.Query()
+		for k, values := range b.query {
+			query[k] = append(query[k], values...)
+		}
+		u.RawQuery = query.Encode()
+	}
+	req := &HttpRequest{Method: b.method, URL: u.String(), Body: b.body}
+	req.Headers = make(map[string]string, len(b.headers))
+	for k, v := range b.headers {
+		req.Headers[k] = v
+	}
+	return req, nil
+}
+
+// Send builds the request and sends it, abandoning it when ctx is done
+func (b *RequestBuilder) Send(ctx context.Context) (*HttpResponse, error) {
+	req, err := b.Build()
+	if err != nil {
+		return nil, err
+	}
+	return b.client.DoContext(ctx, req)
+}
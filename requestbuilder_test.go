@@ -0,0 +1,63 @@
+package httpmodule
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"testing"
+)
+
+// TestRequestBuilder tests building a request and sending it more than once.
+func TestRequestBuilder(t *testing.T) {
+	_, addr := startServer(t, HandlerFunc(func(w ResponseWriter, req *ServerRequest) {
+		body, _ := io.ReadAll(req.Body)
+		fmt.Fprintf(w, "%s %s %q %s %s %s", req.Method, req.Path, req.Query["page"], req.Headers["X-Api-Key"], req.Headers["Content-Type"], body)
+	}))
+	client := New()
+
+	builder := client.NewRequest("POST", "http://"+addr+"/items?page=1").
+		Query("page", "2").
+		Header("x-api-key", "old").
+		Header("X-Api-Key", "secret").
+		BodyJSON(map[string]int{"n": 1})
+	req, err := builder.Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `POST /items ["1" "2"] secret application/json {"n":1}`
+	for i := 0; i < 2; i++ {
+		response, err := client.DoContext(context.Background(), req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if response.Body != want {
+			t.Errorf("Expected %q, got %q", want, response.Body)
+		}
+	}
+
+	// Later changes to the builder or a clone leave the built request alone
+	builder.Header("X-Api-Key", "changed")
+	clone := req.Clone()
+	clone.Headers["X-Api-Key"] = "cloned"
+	if req.Headers["X-Api-Key"] != "secret" {
+		t.Error("Expected the built request to be unchanged, got", req.Headers)
+	}
+	response, err := builder.Send(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response.Body != `POST /items ["1" "2"] changed application/json {"n":1}` {
+		t.Error("Expected Send to use the builder's current state, got", response.Body)
+	}
+
+	for _, b := range []*RequestBuilder{
+		client.NewRequest("GET BAD", "http://example.com"),
+		client.NewRequest("GET", "ftp://example.com"),
+		client.NewRequest("GET", "http://"),
+		client.NewRequest("GET", "http://example.com").BodyJSON(func() {}),
+	} {
+		if _, err := b.Send(context.Background()); err == nil {
+			t.Error("Expected an error from an invalid request.")
+		}
+	}
+}
@@ -0,0 +1,294 @@
+package httpmodule
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DNS record types and response codes the resolvers deal with
+const (
+	dnsTypeA    = 1
+	dnsTypeAAAA = 28
+
+	dnsRcodeNameError = 3
+)
+
+// Resolver looks up the addresses of host names for a client's dials.
+// *DNSCache, *DoHResolver, and *DoTResolver are Resolvers.
+type Resolver interface {
+	LookupHost(ctx context.Context, host string) ([]string, error)
+}
+
+// DoHResolver resolves names with DNS over HTTPS (RFC 8484), sending queries
+// through an HttpClient, for networks whose DNS is broken, filtered, or
+// watched. Set its Resolve method as a client's or DNSCache's Resolve.
+type DoHResolver struct {
+	// Query endpoint, such as "https://1.1.1.1/dns-query"
+	URL string
+
+	// Sends the queries; nil uses a new client. It must not resolve through
+	// this resolver, or looking up the endpoint's own name would never end.
+	Client *HttpClient
+}
+
+// Resolve looks up the IPv4 and IPv6 addresses of host, reporting the
+// shortest TTL among them
+func (r *DoHResolver) Resolve(ctx context.Context, host string) ([]string, time.Duration, error) {
+	client := r.Client
+	if client == nil {
+		client = New()
+	}
+	return resolveBoth(ctx, host, func(query []byte) ([]byte, error) {
+		response, err := client.do(&HttpRequest{
+			Method: "POST",
+			URL:    r.URL,
+			Headers: map[string]string{
+				"Content-Type": "application/dns-message",
+				"Accept":       "application/dns-message",
+			},
+			Body: string(query),
+		})
+		if err != nil {
+			return nil, err
+		}
+		if response.StatusCode != 200 {
+			return nil, fmt.Errorf("DNS over HTTPS query failed: %d %s", response.StatusCode, response.Status)
+		}
+		return []byte(response.Body), nil
+	})
+}
+
+// LookupHost looks up host like Resolve, dropping the TTL
+func (r *DoHResolver) LookupHost(ctx context.Context, host string) ([]string, error) {
+	addrs, _, err := r.Resolve(ctx, host)
+	return addrs, err
+}
+
+// DoTResolver resolves names with DNS over TLS (RFC 7858), opening a
+// connection to the server for each lookup. Set its Resolve method as a
+// client's or DNSCache's Resolve.
+type DoTResolver struct {
+	// Server address, such as "1.1.1.1:853"
+	Addr string
+
+	// Verifies the server; ServerName must be set when Addr is an IP address
+	TLSConfig *tls.Config
+
+	// Limit on each lookup when ctx has no deadline; zero means five seconds
+	Timeout time.Duration
+}
+
+// Resolve looks up the IPv4 and IPv6 addresses of host, reporting the
+// shortest TTL among them
+func (r *DoTResolver) Resolve(ctx context.Context, host string) ([]string, time.Duration, error) {
+	timeout := r.Timeout
+	if timeout <= 0 {
+		timeout = 5 * time.Second
+	}
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	return resolveBoth(ctx, host, func(query []byte) ([]byte, error) {
+		dialer := &tls.Dialer{Config: r.TLSConfig}
+		conn, err := dialer.DialContext(ctx, "tcp", r.Addr)
+		if err != nil {
+			return nil, err
+		}
+		defer conn.Close()
+		if deadline, ok := ctx.Deadline(); ok {
+			conn.SetDeadline(deadline)
+		}
+
+		// Messages over a stream are prefixed with their length
+		framed := make([]byte, 2+len(query))
+		binary.BigEndian.PutUint16(framed, uint16(len(query)))
+		copy(framed[2:], query)
+		if _, err := conn.Write(framed); err != nil {
+			return nil, err
+		}
+		var length [2]byte
+		if _, err := io.ReadFull(conn, length[:]); err != nil {
+			return nil, err
+		}
+		answer := make([]byte, binary.BigEndian.Uint16(length[:]))
+		if _, err := io.ReadFull(conn, answer); err != nil {
+			return nil, err
+		}
+		return answer, nil
+	})
+}
+
+// LookupHost looks up host like Resolve, dropping the TTL
+func (r *DoTResolver) LookupHost(ctx context.Context, host string) ([]string, error) {
+	addrs, _, err := r.Resolve(ctx, host)
+	return addrs, err
+}
+
+// resolveBoth asks exchange for host's A and AAAA records at once and merges
+// the answers, IPv4 first
+func resolveBoth(ctx context.Context, host string, exchange func(query []byte) ([]byte, error)) ([]string, time.Duration, error) {
+	if net.ParseIP(host) != nil {
+		return []string{host}, 0, nil
+	}
+	types := []uint16{dnsTypeA, dnsTypeAAAA}
+	addrs := make([][]string, len(types))
+	ttls := make([]time.Duration, len(types))
+	errs := make([]error, len(types))
+
+	var wg sync.WaitGroup
+	for i, qtype := range types {
+		wg.Add(1)
+		go func(i int, qtype uint16) {
+			defer wg.Done()
+			query, err := buildDNSQuery(host, qtype)
+			if err == nil {
+				var answer []byte
+				if answer, err = exchange(query); err == nil {
+					addrs[i], ttls[i], err = parseDNSAnswer(answer, qtype)
+				}
+			}
+			errs[i] = err
+		}(i, qtype)
+	}
+	wg.Wait()
+	if ctx.Err() != nil {
+		return nil, 0, ctx.Err()
+	}
+
+	var all []string
+	var ttl time.Duration
+	for i := range types {
+		if errs[i] != nil || len(addrs[i]) == 0 {
+			continue
+		}
+		all = append(all, addrs[i]...)
+		if ttl == 0 || ttls[i] < ttl {
+			ttl = ttls[i]
+		}
+	}
+	if len(all) > 0 {
+		return all, ttl, nil
+	}
+	for _, err := range errs {
+		if err != nil && err != errNoSuchHost {
+			return nil, 0, &net.DNSError{Err: err.Error(), Name: host}
+		}
+	}
+	return nil, 0, &net.DNSError{Err: errNoSuchHost.Error(), Name: host, IsNotFound: true}
+}
+
+// buildDNSQuery encodes a recursive query for name's records of qtype. The ID
+// is zero, as RFC 8484 recommends, which lets HTTP caches share answers.
+func buildDNSQuery(name string, qtype uint16) ([]byte, error) {
+	msg := []byte{
+		0, 0, // ID
+		1, 0, // Recursion desired
+		0, 1, // One question
+		0, 0, 0, 0, 0, 0,
+	}
+	name = strings.TrimSuffix(name, ".")
+	if name == "" || len(name) > 253 {
+		return nil, fmt.Errorf("invalid DNS name %q", name)
+	}
+	for _, label := range strings.Split(name, ".") {
+		if label == "" || len(label) > 63 {
+			return nil, fmt.Errorf("invalid DNS name %q", name)
+		}
+		msg = append(msg, byte(len(label)))
+		msg = append(msg, label...)
+	}
+	msg = append(msg, 0)
+	msg = binary.BigEndian.AppendUint16(msg, qtype)
+	msg = binary.BigEndian.AppendUint16(msg, 1) // Internet class
+	return msg, nil
+}
+
+var (
+	errMalformedDNS = errors.New("malformed DNS response")
+	errNoSuchHost   = errors.New("no such host")
+)
+
+// parseDNSAnswer returns the addresses in the answer to a query for qtype and
+// the shortest of their TTLs. Other records, such as the CNAMEs leading to
+// them, are skipped.
+func parseDNSAnswer(msg []byte, qtype uint16) ([]string, time.Duration, error) {
+	if len(msg) < 12 || msg[2]&0x80 == 0 {
+		return nil, 0, errMalformedDNS
+	}
+	switch rcode := msg[3] & 0x0f; rcode {
+	case 0:
+	case dnsRcodeNameError:
+		return nil, 0, errNoSuchHost
+	default:
+		return nil, 0, fmt.Errorf("DNS server failed with code %d", rcode)
+	}
+	questions := int(binary.BigEndian.Uint16(msg[4:]))
+	answers := int(binary.BigEndian.Uint16(msg[6:]))
+
+	off := 12
+	for i := 0; i < questions; i++ {
+		var ok bool
+		if off, ok = skipDNSName(msg, off); !ok || off+4 > len(msg) {
+			return nil, 0, errMalformedDNS
+		}
+		off += 4
+	}
+
+	var addrs []string
+	var ttl time.Duration
+	for i := 0; i < answers; i++ {
+		var ok bool
+		if off, ok = skipDNSName(msg, off); !ok || off+10 > len(msg) {
+			return nil, 0, errMalformedDNS
+		}
+		rtype := binary.BigEndian.Uint16(msg[off:])
+		recordTTL := time.Duration(binary.BigEndian.Uint32(msg[off+4:])) * time.Second
+		length := int(binary.BigEndian.Uint16(msg[off+8:]))
+		off += 10
+		if off+length > len(msg) {
+			return nil, 0, errMalformedDNS
+		}
+		data := msg[off : off+length]
+		off += length
+
+		if rtype != qtype || (rtype == dnsTypeA && length != 4) || (rtype == dnsTypeAAAA && length != 16) {
+			continue
+		}
+		addrs = append(addrs, net.IP(data).String())
+		if ttl == 0 || recordTTL < ttl {
+			ttl = recordTTL
+		}
+	}
+	return addrs, ttl, nil
+}
+
+// skipDNSName returns the offset just past the name at off, which may end in
+// a pointer to one earlier in the message
+func skipDNSName(msg []byte, off int) (int, bool) {
+	for off < len(msg) {
+		length := int(msg[off])
+		switch {
+		case length == 0:
+			return off + 1, true
+		case length&0xc0 == 0xc0:
+			if off+2 > len(msg) {
+				return 0, false
+			}
+			return off + 2, true
+		case length&0xc0 != 0:
+			return 0, false
+		}
+		off += 1 + length
+	}
+	return 0, false
+}
@@ -0,0 +1,168 @@
+package httpmodule
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// dnsRecord is an answer for dnsAnswer to encode.
+type dnsRecord struct {
+	rtype uint16
+	ttl   uint32
+	data  []byte
+}
+
+// dnsAnswer answers query with records, each named by a pointer to the question.
+func dnsAnswer(query []byte, rcode byte, records []dnsRecord) []byte {
+	msg := append([]byte(nil), query...)
+	msg[2] |= 0x80
+	msg[3] = 0x80 | rcode
+	binary.BigEndian.PutUint16(msg[6:], uint16(len(records)))
+	for _, record := range records {
+		msg = append(msg, 0xc0, 12)
+		msg = binary.BigEndian.AppendUint16(msg, record.rtype)
+		msg = binary.BigEndian.AppendUint16(msg, 1)
+		msg = binary.BigEndian.AppendUint32(msg, record.ttl)
+		msg = binary.BigEndian.AppendUint16(msg, uint16(len(record.data)))
+		msg = append(msg, record.data...)
+	}
+	return msg
+}
+
+// testDNSAnswer answers example.com with a CNAME and both kinds of address, and
+// anything else with a name error.
+func testDNSAnswer(query []byte) []byte {
+	if !strings.Contains(string(query), "\x07example\x03com\x00") {
+		return dnsAnswer(query, dnsRcodeNameError, nil)
+	}
+	cname := dnsRecord{5, 30, []byte{3, 'w', 'w', 'w', 0xc0, 12}}
+	if binary.BigEndian.Uint16(query[len(query)-4:]) == dnsTypeA {
+		return dnsAnswer(query, 0, []dnsRecord{cname, {dnsTypeA, 300, []byte{10, 0, 0, 1}}, {dnsTypeA, 120, []byte{10, 0, 0, 2}}})
+	}
+	return dnsAnswer(query, 0, []dnsRecord{{dnsTypeAAAA, 600, net.ParseIP("fd00::1")}})
+}
+
+// TestDNSMessages tests encoding queries and decoding answers.
+func TestDNSMessages(t *testing.T) {
+	query, err := buildDNSQuery("example.com.", dnsTypeA)
+	if err != nil {
+		t.Fatal(err)
+	}
+	addrs, ttl, err := parseDNSAnswer(testDNSAnswer(query), dnsTypeA)
+	if err != nil || len(addrs) != 2 || addrs[0] != "10.0.0.1" || addrs[1] != "10.0.0.2" || ttl != 120*time.Second {
+		t.Error("Expected both IPv4 addresses with the shorter TTL, got", addrs, ttl, err)
+	}
+
+	for _, name := range []string{"", "a..b", strings.Repeat("x", 64) + ".com"} {
+		if _, err := buildDNSQuery(name, dnsTypeA); err == nil {
+			t.Errorf("Expected an error for the name %q.", name)
+		}
+	}
+	if _, _, err := parseDNSAnswer(query, dnsTypeA); err == nil {
+		t.Error("Expected an error for a message that isn't a response.")
+	}
+	truncated := testDNSAnswer(query)
+	if _, _, err := parseDNSAnswer(truncated[:len(truncated)-2], dnsTypeA); err != errMalformedDNS {
+		t.Error("Expected a truncated answer to be malformed, got", err)
+	}
+}
+
+// TestDoHResolver tests resolving names over HTTPS.
+func TestDoHResolver(t *testing.T) {
+	_, addr := startServer(t, HandlerFunc(func(w ResponseWriter, req *ServerRequest) {
+		query, _ := io.ReadAll(req.Body)
+		if req.Method != "POST" || headerValue(req.Headers, "Content-Type") != "application/dns-message" {
+			w.WriteHeader(415)
+			return
+		}
+		w.Header()["Content-Type"] = "application/dns-message"
+		w.Write(testDNSAnswer(query))
+	}))
+	client := New()
+	client.Transport = loopbackTransport(t, client, addr)
+	resolver := &DoHResolver{URL: "http://" + addr + "/dns-query", Client: client}
+
+	addrs, ttl, err := resolver.Resolve(context.Background(), "example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(addrs, " ") != "10.0.0.1 10.0.0.2 fd00::1" || ttl != 120*time.Second {
+		t.Error("Expected IPv4 then IPv6 addresses with the shortest TTL, got", addrs, ttl)
+	}
+
+	_, _, err = resolver.Resolve(context.Background(), "missing.test")
+	var dnsErr *net.DNSError
+	if !errors.As(err, &dnsErr) || !dnsErr.IsNotFound {
+		t.Error("Expected a not found error, got", err)
+	}
+
+	if addrs, _, _ := resolver.Resolve(context.Background(), "192.0.2.1"); len(addrs) != 1 || addrs[0] != "192.0.2.1" {
+		t.Error("Expected an IP literal as it is, got", addrs)
+	}
+}
+
+// TestDoTResolver tests resolving names over TLS.
+func TestDoTResolver(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	writeTestCert(t, certFile, keyFile, "dns", "dns.test")
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	listener, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{Certificates: []tls.Certificate{cert}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				var length [2]byte
+				if _, err := io.ReadFull(conn, length[:]); err != nil {
+					return
+				}
+				query := make([]byte, binary.BigEndian.Uint16(length[:]))
+				if _, err := io.ReadFull(conn, query); err != nil {
+					return
+				}
+				answer := testDNSAnswer(query)
+				conn.Write(binary.BigEndian.AppendUint16(nil, uint16(len(answer))))
+				conn.Write(answer)
+			}()
+		}
+	}()
+
+	resolver := &DoTResolver{Addr: listener.Addr().String(), TLSConfig: &tls.Config{ServerName: "dns.test", InsecureSkipVerify: true}}
+	addrs, _, err := resolver.Resolve(context.Background(), "example.com")
+	if err != nil || len(addrs) != 3 {
+		t.Error("Expected three addresses, got", addrs, err)
+	}
+}
+
+// TestClientResolve tests that the client dials through a custom resolver.
+func TestClientResolve(t *testing.T) {
+	client := New()
+	var asked string
+	client.Resolve = func(ctx context.Context, host string) ([]string, time.Duration, error) {
+		asked = host
+		return nil, 0, errors.New("resolver unavailable")
+	}
+	_, err := client.Get("http://internal.test/", nil)
+	if asked != "internal.test" || err == nil || !strings.Contains(err.Error(), "resolver unavailable") {
+		t.Error("Expected the custom resolver's error, got", asked, err)
+	}
+}
@@ -0,0 +1,317 @@
+package httpmodule
+
+import (
+	"bufio"
+	"errors"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// Size of the buffer a response is collected in before its head is sent. A
+// response that fits is sent with a Content-Length; larger ones are chunked.
+const responseBufferSize = 4096
+
+// ResponseWriter is how a Handler answers a request
+type ResponseWriter interface {
+	// Header returns the headers to send, which can be changed until the
+	// first call to WriteHeader or Write
+	Header() map[string]string
+
+	// WriteHeader sends the status line and headers. Only the first call has
+	// any effect.
+	WriteHeader(statusCode int)
+
+	// Write sends part of the body, first calling WriteHeader(200) if needed
+	Write(p []byte) (int, error)
+}
+
+// Flusher is implemented by ResponseWriters that can send buffered data to the
+// client before the handler returns, for streaming responses
+type Flusher interface {
+	Flush()
+}
+
+// Hijacker is implemented by ResponseWriters that can hand the underlying
+// connection over to the handler, for protocols such as CONNECT tunnels and
+// WebSockets that take over once the HTTP exchange is done. The reader may
+// hold bytes the client has already sent. The server no longer manages the
+// connection afterwards; the handler must close it.
+type Hijacker interface {
+	Hijack() (net.Conn, *bufio.ReadWriter, error)
+}
+
+// errHijacked is returned when using a response after its connection was hijacked
+var errHijacked = errors.New("connection has been hijacked")
+
+// errBodyNotAllowed is returned when writing a body the response can't have
+var errBodyNotAllowed = errors.New("response status does not allow a body")
+
+// response is the ResponseWriter given to handlers. Writes are buffered until
+// the buffer fills, the handler flushes, or the handler returns, so that short
+// responses can be sent with a Content-Length.
+type response struct {
+	writer *bufio.Writer
+	req    *ServerRequest
+	clock  Clock
+
+	// Reports whether the server is shutting down, so the connection should
+	// close after this response
+	shuttingDown func() bool
+
+	// Connection the response is written to, and its reader, for Hijack
+	conn     net.Conn
+	reader   *bufio.Reader
+	hijacked bool
+	onHijack func()
+
+	headers     map[string]string
+	status      int
+	wroteHeader bool
+	headSent    bool
+	buf         []byte
+
+	// Framing chosen when the head was sent
+	chunked  bool
+	noBody   bool
+	close    bool
+	declared int64
+	written  int64
+	err      error
+}
+
+func newResponse(writer *bufio.Writer, req *ServerRequest, clock Clock) *response {
+	w := &response{writer: writer, req: req, clock: clock, headers: make(map[string]string), declared: -1}
+	if req.Protocol != "HTTP/1.1" || headerContainsToken(req.Headers, "Connection", "close") {
+		w.close = true
+	}
+	if body, ok := req.Body.(*serverBody); ok && req.Protocol == "HTTP/1.1" && strings.EqualFold(headerValue(req.Headers, "Expect"), "100-continue") {
+		body.sendContinue = func() {
+			if !w.headSent {
+				w.writer.WriteString("HTTP/1.1 100 Continue\r\n\r\n")
+				w.writer.Flush()
+			}
+		}
+	}
+	return w
+}
+
+func (w *response) Header() map[string]string {
+	return w.headers
+}
+
+func (w *response) WriteHeader(statusCode int) {
+	if w.wroteHeader {
+		return
+	}
+	if statusCode < 100 || statusCode > 999 {
+		panic("httpmodule: invalid status code " + strconv.Itoa(statusCode))
+	}
+	w.wroteHeader = true
+	w.status = statusCode
+	w.noBody = w.req.Method == "HEAD" || statusCode/100 == 1 || statusCode == 204 || statusCode == 304
+	if v, ok := w.headers["Content-Length"]; ok {
+		if n, err := strconv.ParseInt(v, 10, 64); err == nil && n >= 0 {
+			w.declared = n
+		} else {
+			delete(w.headers, "Content-Length")
+		}
+	}
+}
+
+func (w *response) Write(p []byte) (int, error) {
+	if w.hijacked {
+		return 0, errHijacked
+	}
+	if !w.wroteHeader {
+		w.WriteHeader(200)
+	}
+	if w.err != nil {
+		return 0, w.err
+	}
+	if w.noBody {
+		if w.req.Method == "HEAD" {
+			// Counted so the Content-Length matches what GET would send
+			w.written += int64(len(p))
+			return len(p), nil
+		}
+		return 0, errBodyNotAllowed
+	}
+	if w.declared >= 0 && w.written+int64(len(p)) > w.declared {
+		return 0, errors.New("wrote more than the declared Content-Length")
+	}
+	w.written += int64(len(p))
+
+	if !w.headSent {
+		if len(w.buf)+len(p) <= responseBufferSize {
+			w.buf = append(w.buf, p...)
+			return len(p), nil
+		}
+		w.sendHead(false)
+	}
+	w.writeBody(p)
+	if w.err != nil {
+		return 0, w.err
+	}
+	return len(p), nil
+}
+
+// Hijack takes the connection over from the server. Anything already written
+// to the response is sent first.
+func (w *response) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	if w.hijacked {
+		return nil, nil, errHijacked
+	}
+	if w.conn == nil {
+		return nil, nil, errors.New("response does not support hijacking")
+	}
+	if w.wroteHeader {
+		w.Flush()
+	} else if err := w.writer.Flush(); err != nil {
+		return nil, nil, err
+	}
+	w.hijacked = true
+	if w.onHijack != nil {
+		w.onHijack()
+	}
+	return w.conn, bufio.NewReadWriter(w.reader, bufio.NewWriter(w.conn)), nil
+}
+
+// Flush sends the head and anything buffered to the client
+func (w *response) Flush() {
+	if w.hijacked {
+		return
+	}
+	if !w.wroteHeader {
+		w.WriteHeader(200)
+	}
+	if !w.headSent {
+		w.sendHead(false)
+	}
+	if w.err == nil {
+		w.err = w.writer.Flush()
+	}
+}
+
+// sendHead writes the status line and headers, choosing how the body is
+// framed. final is set when the handler has returned, so the whole body is in
+// the buffer and its length is known.
+func (w *response) sendHead(final bool) {
+	w.headSent = true
+	headers := w.headers
+
+	switch {
+	case w.noBody:
+		if w.status == 204 || w.status/100 == 1 {
+			delete(headers, "Content-Length")
+		} else if final && w.declared < 0 && w.written > 0 {
+			headers["Content-Length"] = strconv.FormatInt(w.written, 10)
+		}
+	case w.declared >= 0:
+	case final:
+		headers["Content-Length"] = strconv.Itoa(len(w.buf))
+	case w.req.Protocol == "HTTP/1.1":
+		w.chunked = true
+		headers["Transfer-Encoding"] = "chunked"
+	default:
+		// HTTP/1.0 clients can only be told the body ends by closing
+		w.close = true
+	}
+	if w.shuttingDown != nil && w.shuttingDown() {
+		w.close = true
+	}
+	if headerContainsToken(headers, "Connection", "close") {
+		w.close = true
+	} else if w.close {
+		headers["Connection"] = "close"
+	}
+	if _, ok := headers["Date"]; !ok {
+		headers["Date"] = clockOrReal(w.clock).Now().UTC().Format(httpDateFormat)
+	}
+
+	w.writer.WriteString("HTTP/1.1 ")
+	w.writer.WriteString(strconv.Itoa(w.status))
+	w.writer.WriteByte(' ')
+	w.writer.WriteString(statusText(w.status))
+	w.writer.WriteString("\r\n")
+	for k, v := range headers {
+		// A value of several lines, such as a few Set-Cookie headers, is
+		// sent as one field per line
+		for {
+			line, rest, more := strings.Cut(v, "\n")
+			w.writer.WriteString(k)
+			w.writer.WriteString(": ")
+			w.writer.WriteString(line)
+			w.writer.WriteString("\r\n")
+			if !more {
+				break
+			}
+			v = rest
+		}
+	}
+	w.writer.WriteString("\r\n")
+
+	if len(w.buf) > 0 {
+		buf := w.buf
+		w.buf = nil
+		w.writeBody(buf)
+	}
+}
+
+// writeBody writes p with the framing chosen in sendHead
+func (w *response) writeBody(p []byte) {
+	if w.err != nil || len(p) == 0 || w.noBody {
+		return
+	}
+	if w.chunked {
+		w.writer.WriteString(strconv.FormatInt(int64(len(p)), 16))
+		w.writer.WriteString("\r\n")
+	}
+	if _, err := w.writer.Write(p); err != nil {
+		w.err = err
+		return
+	}
+	if w.chunked {
+		w.writer.WriteString("\r\n")
+	}
+}
+
+// finish completes the response once the handler has returned
+func (w *response) finish() error {
+	if w.hijacked {
+		return errHijacked
+	}
+	if !w.wroteHeader {
+		w.WriteHeader(200)
+	}
+	if !w.headSent {
+		w.sendHead(true)
+	}
+	if w.chunked && w.err == nil {
+		w.writer.WriteString("0\r\n\r\n")
+	}
+	if w.declared >= 0 && !w.noBody && w.written < w.declared {
+		// The client would wait for the rest of the body forever
+		w.close = true
+	}
+	if w.err != nil {
+		return w.err
+	}
+	return w.writer.Flush()
+}
+
+// keepAlive reports whether the connection can serve another request
+func (w *response) keepAlive() bool {
+	if w.close {
+		return false
+	}
+	// A client still waiting to be told to send its body can't be trusted to
+	// send the next request at a known position
+	if body, ok := w.req.Body.(*serverBody); ok && body.sendContinue != nil {
+		return false
+	}
+	return true
+}
+
+// Format of the Date header
+const httpDateFormat = "Mon, 02 Jan 2006 15:04:05 GMT"
@@ -0,0 +1,201 @@
+package httpmodule
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math"
+	"math/rand"
+	"net"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// Defaults for the RetryPolicy fields left zero
+const (
+	defaultRetryAttempts  = 3
+	defaultRetryBaseDelay = 100 * time.Millisecond
+	defaultRetryMaxDelay  = 10 * time.Second
+	defaultMaxRetryAfter  = time.Minute
+)
+
+// RetryPolicy controls how failed requests are tried again. Failures to
+// connect, connections dropped or reset before the response was read, client
+// timeouts, 5xx responses other than 501, and 429 are retried, waiting longer
+// after each attempt. Only idempotent requests are retried unless the policy
+// says otherwise: GET, HEAD, OPTIONS, TRACE, PUT, and DELETE, and requests
+// carrying an Idempotency-Key header. Streamed bodies are never retried, as
+// they can't be sent twice.
+type RetryPolicy struct {
+	// Attempts in all, the first included; zero means 3 and one disables
+	// retries
+	MaxAttempts int
+
+	// Wait before the first retry, doubling for each one after, with random
+	// jitter of up to half of it; zero means 100 milliseconds
+	BaseDelay time.Duration
+
+	// Longest wait between attempts; zero means 10 seconds
+	MaxDelay time.Duration
+
+	// Retry POST, PATCH, and other requests that aren't idempotent, for
+	// servers known to handle repeats safely
+	RetryNonIdempotent bool
+
+	// Longest wait a Retry-After header on a 429 or 503 can ask for, which
+	// is used in place of the backoff; zero means one minute. A longer one
+	// ends the retries and returns the response.
+	MaxRetryAfter time.Duration
+}
+
+// retry sends req with send, trying again as the request's or the client's
+// retry policy allows, and records on the response how many attempts it took
+func (client *HttpClient) retry(req *HttpRequest, send func(*HttpRequest) (*HttpResponse, error)) (*HttpResponse, error) {
+	policy := req.Retry
+	if policy == nil {
+		policy = client.Retry
+	}
+	if policy == nil || !policy.allows(req) {
+		response, err := send(req)
+		if err == nil {
+			response.Attempts = 1
+		}
+		return response, err
+	}
+
+	attempts := policy.MaxAttempts
+	if attempts <= 0 {
+		attempts = defaultRetryAttempts
+	}
+	ctx := req.Context()
+	clock := clockOrReal(client.Clock)
+	for attempt := 1; ; attempt++ {
+		response, err := send(req)
+		if attempt == attempts || ctx.Err() != nil || !retryable(response, err) {
+			if err == nil {
+				response.Attempts = attempt
+			}
+			return response, err
+		}
+		wait := policy.backoff(attempt)
+		if response != nil {
+			if after, ok := retryAfter(response, clock.Now()); ok {
+				if after > policy.maxRetryAfter() {
+					response.Attempts = attempt
+					return response, nil
+				}
+				wait = after
+			}
+			response.Close()
+		}
+		client.logRetry(req, attempt, wait, response, err)
+
+		select {
+		case <-clock.After(wait):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		client.collectRetry(req)
+	}
+}
+
+// allows reports whether req may be retried under the policy
+func (policy *RetryPolicy) allows(req *HttpRequest) bool {
+	if policy.MaxAttempts == 1 || req.BodyReader != nil {
+		return false
+	}
+	if policy.RetryNonIdempotent {
+		return true
+	}
+	switch req.Method {
+	case "GET", "HEAD", "OPTIONS", "TRACE", "PUT", "DELETE":
+		return true
+	}
+	return headerValue(req.Headers, "Idempotency-Key") != "" || headerValue(req.Headers, "X-Idempotency-Key") != ""
+}
+
+// backoff returns how long to wait after the given failed attempt
+func (policy *RetryPolicy) backoff(attempt int) time.Duration {
+	base, limit := policy.BaseDelay, policy.MaxDelay
+	if base <= 0 {
+		base = defaultRetryBaseDelay
+	}
+	if limit <= 0 {
+		limit = defaultRetryMaxDelay
+	}
+	delay := base
+	for i := 1; i < attempt && delay < limit; i++ {
+		delay *= 2
+	}
+	if delay > limit {
+		delay = limit
+	}
+	// Jitter keeps clients that failed together from retrying together
+	return delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1))
+}
+
+func (policy *RetryPolicy) maxRetryAfter() time.Duration {
+	if policy.MaxRetryAfter > 0 {
+		return policy.MaxRetryAfter
+	}
+	return defaultMaxRetryAfter
+}
+
+// retryAfter returns the wait a 429 or 503 response asks for in Retry-After,
+// given as seconds or as an HTTP date
+func retryAfter(response *HttpResponse, now time.Time) (time.Duration, bool) {
+	if response.StatusCode != 429 && response.StatusCode != 503 {
+		return 0, false
+	}
+	value := strings.TrimSpace(headerValue(response.Headers, "Retry-After"))
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.ParseInt(value, 10, 64); err == nil {
+		if seconds < 0 {
+			return 0, false
+		}
+		if seconds > int64(math.MaxInt64/time.Second) {
+			seconds = int64(math.MaxInt64 / time.Second)
+		}
+		return time.Duration(seconds) * time.Second, true
+	}
+	date, ok := parseHTTPDate(value)
+	if !ok {
+		return 0, false
+	}
+	if wait := date.Sub(now); wait > 0 {
+		return wait, true
+	}
+	return 0, true
+}
+
+// retryable reports whether an attempt that ended in response or err is
+// worth repeating
+func retryable(response *HttpResponse, err error) bool {
+	if err != nil {
+		return retryableError(err)
+	}
+	return response.StatusCode == 429 || response.StatusCode >= 500 && response.StatusCode != 501
+}
+
+// retryableError reports whether err is a failure to connect or a connection
+// lost along the way. Malformed responses and failed TLS handshakes would only
+// fail the same way again, and errors such as a redirect CheckRedirect refused
+// are the caller's own choice.
+func retryableError(err error) bool {
+	var protoErr *ProtocolError
+	var tlsErr *TLSError
+	if errors.As(err, &protoErr) || errors.As(err, &tlsErr) {
+		return false
+	}
+	var dialErr *DialError
+	var timeoutErr *TimeoutError
+	var netErr net.Error
+	return errors.As(err, &dialErr) || errors.As(err, &timeoutErr) ||
+		errors.Is(err, errConnDropped) || errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.EPIPE) ||
+		errors.As(err, &netErr) && !errors.Is(err, context.DeadlineExceeded)
+}
@@ -0,0 +1,211 @@
+package httpmodule
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// flakyTransport fails with each of its outcomes in turn, then answers 200.
+// An outcome of 0 is a connection error.
+type flakyTransport struct {
+	outcomes []int
+	sent     int
+}
+
+func (f *flakyTransport) RoundTrip(req *HttpRequest) (*HttpResponse, error) {
+	f.sent++
+	if f.sent > len(f.outcomes) {
+		return &HttpResponse{StatusCode: 200, Headers: map[string]string{}}, nil
+	}
+	if code := f.outcomes[f.sent-1]; code != 0 {
+		return &HttpResponse{StatusCode: code, Headers: map[string]string{}}, nil
+	}
+	return nil, fmt.Errorf("connection reset: %w", syscall.ECONNRESET)
+}
+
+// TestRetry tests retrying failed attempts up to the limit.
+func TestRetry(t *testing.T) {
+	flaky := &flakyTransport{outcomes: []int{503, 0, 429}}
+	client := New()
+	client.Transport = flaky
+	client.Retry = &RetryPolicy{MaxAttempts: 4, BaseDelay: time.Millisecond}
+
+	response, err := client.Get("http://example.com/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response.StatusCode != 200 || response.Attempts != 4 {
+		t.Errorf("Expected success on the fourth attempt, got %d after %d", response.StatusCode, response.Attempts)
+	}
+
+	flaky.outcomes, flaky.sent = []int{500, 502, 504, 500}, 0
+	response, err = client.Get("http://example.com/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response.StatusCode != 500 || flaky.sent != 4 {
+		t.Errorf("Expected the last failure after 4 attempts, got %d after %d", response.StatusCode, flaky.sent)
+	}
+
+	flaky.outcomes, flaky.sent = []int{0, 0, 0, 0}, 0
+	if _, err := client.Get("http://example.com/", nil); err == nil || flaky.sent != 4 {
+		t.Error("Expected the last connection error after 4 attempts, got", err, flaky.sent)
+	}
+
+	// Client errors and 501 aren't worth repeating
+	for _, code := range []int{404, 501} {
+		flaky.outcomes, flaky.sent = []int{code}, 0
+		if response, _ := client.Get("http://example.com/", nil); response.StatusCode != code || flaky.sent != 1 {
+			t.Errorf("Expected %d not to be retried, sent %d times", code, flaky.sent)
+		}
+	}
+
+	// A request's own policy wins
+	flaky.outcomes, flaky.sent = []int{503}, 0
+	response, _ = client.Do(&HttpRequest{Method: "GET", URL: "http://example.com/", Retry: &RetryPolicy{MaxAttempts: 1}})
+	if response.StatusCode != 503 || response.Attempts != 1 {
+		t.Error("Expected retries disabled for the request, got", response.StatusCode, response.Attempts)
+	}
+}
+
+// TestRetryErrors tests that only connection failures are retried, and not
+// errors the caller chose, such as a refused redirect.
+func TestRetryErrors(t *testing.T) {
+	for _, tt := range []struct {
+		err  error
+		want bool
+	}{
+		{&DialError{Host: "example.com", Err: errors.New("refused")}, true},
+		{&TimeoutError{Op: "dial"}, true},
+		{fmt.Errorf("failed to send request: %w", errConnDropped), true},
+		{fmt.Errorf("failed to read response: %w", syscall.ECONNRESET), true},
+		{&ProtocolError{Err: errors.New("malformed status line")}, false},
+		{&TLSError{Host: "example.com", Err: errors.New("untrusted")}, false},
+		{errors.New("redirect refused"), false},
+	} {
+		if got := retryable(nil, tt.err); got != tt.want {
+			t.Errorf("Expected retryable(%v) to be %v", tt.err, tt.want)
+		}
+	}
+
+	var hits int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&hits, 1)
+		http.Redirect(w, r, "/again", http.StatusFound)
+	}))
+	defer server.Close()
+
+	client := New()
+	client.Retry = &RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond}
+	client.CheckRedirect = func(req *HttpRequest, via []*HttpRequest) error {
+		return errors.New("redirect refused")
+	}
+	if _, err := client.Get(server.URL+"/", nil); err == nil || atomic.LoadInt32(&hits) != 1 {
+		t.Error("Expected a refused redirect to end the request after one hit, got", err, atomic.LoadInt32(&hits))
+	}
+
+	atomic.StoreInt32(&hits, 0)
+	client.CheckRedirect = nil
+	client.MaxRedirects = 2
+	if _, err := client.Get(server.URL+"/", nil); err == nil || atomic.LoadInt32(&hits) != 3 {
+		t.Error("Expected the redirect limit to end the request after three hits, got", err, atomic.LoadInt32(&hits))
+	}
+}
+
+// TestRetryIdempotency tests that only idempotent requests are retried by default.
+func TestRetryIdempotency(t *testing.T) {
+	flaky := &flakyTransport{outcomes: []int{503}}
+	client := New()
+	client.Transport = flaky
+	client.Retry = &RetryPolicy{BaseDelay: time.Millisecond}
+
+	response, _ := client.Post("http://example.com/", "data", nil)
+	if response.StatusCode != 503 || flaky.sent != 1 {
+		t.Error("Expected a POST not to be retried, sent", flaky.sent)
+	}
+
+	flaky.sent = 0
+	response, _ = client.Post("http://example.com/", "data", map[string]string{"Idempotency-Key": "abc"})
+	if response.StatusCode != 200 || flaky.sent != 2 {
+		t.Error("Expected a POST with an idempotency key to be retried, sent", flaky.sent)
+	}
+
+	flaky.sent = 0
+	client.Retry.RetryNonIdempotent = true
+	response, _ = client.Patch("http://example.com/", "data", nil)
+	if response.StatusCode != 200 || flaky.sent != 2 {
+		t.Error("Expected a PATCH to be retried when allowed, sent", flaky.sent)
+	}
+}
+
+// TestRetryBackoff tests that waits grow exponentially, with jitter, up to the cap.
+func TestRetryBackoff(t *testing.T) {
+	policy := &RetryPolicy{BaseDelay: 100 * time.Millisecond, MaxDelay: time.Second}
+	for attempt, full := range []time.Duration{100, 200, 400, 800, 1000, 1000} {
+		full *= time.Millisecond
+		for i := 0; i < 20; i++ {
+			if delay := policy.backoff(attempt + 1); delay < full/2 || delay > full {
+				t.Fatalf("Expected a wait between %v and %v after attempt %d, got %v", full/2, full, attempt+1, delay)
+			}
+		}
+	}
+}
+
+// TestRetryAfter tests waiting as long as Retry-After asks, within the limit.
+func TestRetryAfter(t *testing.T) {
+	clock := NewFakeClock(time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC))
+	var retryAfter string
+	sent := 0
+	client := New()
+	client.Clock = clock
+	client.Retry = &RetryPolicy{BaseDelay: time.Millisecond, MaxRetryAfter: time.Minute}
+	client.Transport = RoundTripFunc(func(req *HttpRequest) (*HttpResponse, error) {
+		sent++
+		if sent == 1 {
+			return &HttpResponse{StatusCode: 429, Headers: map[string]string{"Retry-After": retryAfter}}, nil
+		}
+		return &HttpResponse{StatusCode: 200, Headers: map[string]string{}}, nil
+	})
+
+	for _, date := range []bool{false, true} {
+		value := "2"
+		if date {
+			value = clock.Now().Add(2 * time.Second).Format(httpDateFormat)
+		}
+		retryAfter, sent = value, 0
+		done := make(chan *HttpResponse)
+		go func() {
+			response, _ := client.Get("http://example.com/", nil)
+			done <- response
+		}()
+		for clock.Waiters() == 0 {
+			time.Sleep(time.Millisecond)
+		}
+		clock.Advance(1900 * time.Millisecond)
+		select {
+		case <-done:
+			t.Fatalf("Expected Retry-After %q to be waited out.", value)
+		case <-time.After(20 * time.Millisecond):
+		}
+		clock.Advance(100 * time.Millisecond)
+		if response := <-done; response.StatusCode != 200 || response.Attempts != 2 {
+			t.Errorf("Expected the retry to succeed, got %d after %d", response.StatusCode, response.Attempts)
+		}
+	}
+
+	// A wait beyond the limit returns the response instead
+	retryAfter, sent = "3600", 0
+	response, err := client.Get("http://example.com/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response.StatusCode != 429 || response.Attempts != 1 {
+		t.Error("Expected the 429 back without waiting an hour, got", response.StatusCode, response.Attempts)
+	}
+}
@@ -0,0 +1,270 @@
+package httpmodule
+
+import (
+	"errors"
+	"io"
+	"log"
+	"net"
+	neturl "net/url"
+	"strings"
+)
+
+// Headers that describe a single connection rather than the message, which a
+// proxy must not pass on
+var hopHeaders = []string{
+	"Connection",
+	"Proxy-Connection",
+	"Keep-Alive",
+	"Proxy-Authenticate",
+	"Proxy-Authorization",
+	"Te",
+	"Trailer",
+	"Transfer-Encoding",
+	"Upgrade",
+}
+
+// ReverseProxy is a Handler that forwards requests to an upstream server
+// through an HttpClient and copies the responses back. Response bodies are
+// streamed; request bodies are read in full before forwarding.
+type ReverseProxy struct {
+	// Upstream to forward to. Request paths are appended to its path, and
+	// its query merged with the request's.
+	Target *neturl.URL
+
+	// Client requests are sent with; its Transport, if set, is used in
+	// place of the network
+	Client *HttpClient
+
+	// Send the Host the client asked for rather than the upstream's
+	PreserveHost bool
+
+	// Adjusts each outgoing request after the standard rewriting, such as to
+	// add credentials or drop headers
+	Rewrite func(out *HttpRequest, in *ServerRequest)
+
+	// Adjusts each upstream response before it is copied back. An error is
+	// passed to ErrorHandler.
+	ModifyResponse func(response *HttpResponse) error
+
+	// Answers requests that couldn't be forwarded; nil sends 502, or 504 when
+	// the upstream timed out
+	ErrorHandler func(w ResponseWriter, req *ServerRequest, err error)
+
+	// Destination for forwarding errors; nil uses the standard logger
+	ErrorLog *log.Logger
+}
+
+// NewReverseProxy returns a proxy that forwards to target using client, or a
+// new client if nil
+func NewReverseProxy(target string, client *HttpClient) (*ReverseProxy, error) {
+	parsedURL, err := neturl.Parse(target)
+	if err != nil {
+		return nil, err
+	}
+	if parsedURL.Host == "" {
+		return nil, errors.New("invalid upstream URL: " + target)
+	}
+	if client == nil {
+		client = New()
+	}
+	return &ReverseProxy{Target: parsedURL, Client: client}, nil
+}
+
+func (proxy *ReverseProxy) ServeHTTP(w ResponseWriter, req *ServerRequest) {
+	out, err := proxy.outgoingRequest(req)
+	if err != nil {
+		proxy.fail(w, req, err)
+		return
+	}
+	proxy.forward(w, req, out)
+}
+
+// forward sends out, the upstream version of req, and copies the response to w
+func (proxy *ReverseProxy) forward(w ResponseWriter, req *ServerRequest, out *HttpRequest) {
+	transport := proxy.Client.Transport
+	if transport == nil {
+		transport = proxy.Client.NetworkTransport()
+	}
+	response, err := transport.RoundTrip(out)
+	if err != nil {
+		proxy.fail(w, req, err)
+		return
+	}
+	defer response.Close()
+
+	if proxy.ModifyResponse != nil {
+		if err := proxy.ModifyResponse(response); err != nil {
+			proxy.fail(w, req, err)
+			return
+		}
+	}
+
+	headers := w.Header()
+	for k, v := range response.Headers {
+		headers[k] = v
+	}
+	// Headers keeps the last cookie only; the writer sends each line of a
+	// value as a field of its own
+	if cookies := response.Header().Values("Set-Cookie"); len(cookies) > 1 {
+		deleteHeader(headers, "Set-Cookie")
+		headers["Set-Cookie"] = strings.Join(cookies, "\n")
+	}
+	removeHopHeaders(headers)
+	w.WriteHeader(response.StatusCode)
+
+	if response.body == nil {
+		io.WriteString(w, response.Body)
+		return
+	}
+	if err := copyResponse(w, response.body, response.Headers); err != nil {
+		// The status has gone out, so all that's left is to make sure the
+		// client can tell the body is incomplete
+		proxy.logf("httpmodule: reverse proxy copying body of %s %s: %v", req.Method, out.URL, err)
+		panic(ErrAbortHandler)
+	}
+}
+
+// outgoingRequest builds the request sent upstream for req
+func (proxy *ReverseProxy) outgoingRequest(req *ServerRequest) (*HttpRequest, error) {
+	target := *proxy.Target
+	target.Path = singleJoiningSlash(target.Path, req.Path)
+	target.RawPath = ""
+	query := req.Query.Encode()
+	if target.RawQuery == "" || query == "" {
+		target.RawQuery += query
+	} else {
+		target.RawQuery += "&" + query
+	}
+
+	headers := make(map[string]string, len(req.Headers)+4)
+	for k, v := range req.Headers {
+		headers[k] = v
+	}
+	removeHopHeaders(headers)
+	deleteHeader(headers, "Content-Length")
+	deleteHeader(headers, "Host")
+	if proxy.PreserveHost && req.Host != "" {
+		headers["Host"] = req.Host
+	}
+	// Keep the client's built-in header from asking for an encoding the
+	// caller can't decode
+	if headerValue(headers, "Accept-Encoding") == "" {
+		headers["Accept-Encoding"] = "identity"
+	}
+
+	if ip, _, err := net.SplitHostPort(req.RemoteAddr); err == nil {
+		if prior := headerValue(headers, "X-Forwarded-For"); prior != "" {
+			ip = prior + ", " + ip
+		}
+		deleteHeader(headers, "X-Forwarded-For")
+		headers["X-Forwarded-For"] = ip
+	}
+	if headerValue(headers, "X-Forwarded-Host") == "" && req.Host != "" {
+		headers["X-Forwarded-Host"] = req.Host
+	}
+	if headerValue(headers, "X-Forwarded-Proto") == "" {
+		headers["X-Forwarded-Proto"] = "http"
+		if req.TLS != nil {
+			headers["X-Forwarded-Proto"] = "https"
+		}
+	}
+
+	out := &HttpRequest{Method: req.Method, URL: target.String(), Headers: headers}
+	if req.Body != nil {
+		body, err := io.ReadAll(req.Body)
+		if err != nil {
+			return nil, err
+		}
+		out.Body = string(body)
+	}
+	if proxy.Rewrite != nil {
+		proxy.Rewrite(out, req)
+	}
+	return out, nil
+}
+
+// fail answers a request that couldn't be forwarded
+func (proxy *ReverseProxy) fail(w ResponseWriter, req *ServerRequest, err error) {
+	if proxy.ErrorHandler != nil {
+		proxy.ErrorHandler(w, req, err)
+		return
+	}
+	proxy.logf("httpmodule: reverse proxy error for %s %s: %v", req.Method, req.Path, err)
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		w.WriteHeader(504)
+		return
+	}
+	w.WriteHeader(502)
+}
+
+func (proxy *ReverseProxy) logf(format string, args ...any) {
+	if proxy.ErrorLog != nil {
+		proxy.ErrorLog.Printf(format, args...)
+		return
+	}
+	log.Printf(format, args...)
+}
+
+// copyResponse copies an upstream body to w. Bodies of unknown length may be
+// streams, such as server-sent events, so each read is flushed straight away.
+func copyResponse(w ResponseWriter, body io.Reader, headers map[string]string) error {
+	flusher, _ := w.(Flusher)
+	if headerValue(headers, "Content-Length") != "" {
+		flusher = nil
+	}
+
+	buf := make([]byte, 32<<10)
+	for {
+		n, err := body.Read(buf)
+		if n > 0 {
+			if _, werr := w.Write(buf[:n]); werr != nil {
+				return werr
+			}
+			if flusher != nil {
+				flusher.Flush()
+			}
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// removeHopHeaders deletes hop-by-hop headers, including any the Connection
+// header names
+func removeHopHeaders(headers map[string]string) {
+	for _, name := range strings.Split(headerValue(headers, "Connection"), ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			deleteHeader(headers, name)
+		}
+	}
+	for _, name := range hopHeaders {
+		deleteHeader(headers, name)
+	}
+}
+
+// deleteHeader removes key from headers regardless of case
+func deleteHeader(headers map[string]string, key string) {
+	for k := range headers {
+		if strings.EqualFold(k, key) {
+			delete(headers, k)
+		}
+	}
+}
+
+// singleJoiningSlash joins two paths with exactly one slash between them
+func singleJoiningSlash(a, b string) string {
+	aslash := strings.HasSuffix(a, "/")
+	bslash := strings.HasPrefix(b, "/")
+	switch {
+	case aslash && bslash:
+		return a + b[1:]
+	case !aslash && !bslash:
+		return a + "/" + b
+	}
+	return a + b
+}
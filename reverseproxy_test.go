@@ -0,0 +1,182 @@
+package httpmodule
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+// loopbackTransport sends requests over the client's connection handling to
+// addr, whatever host their URL names.
+func loopbackTransport(t *testing.T, client *HttpClient, addr string) Transport {
+	pool := &connPool{}
+	t.Cleanup(pool.closeAll)
+	dial := func(ctx context.Context, useTLS bool, host string) (*persistConn, error) {
+		conn, err := net.Dial("tcp", addr)
+		if err != nil {
+			return nil, err
+		}
+		return newPersistConn(conn), nil
+	}
+	return RoundTripFunc(func(req *HttpRequest) (*HttpResponse, error) {
+		return client.roundTripVia(req, dial, pool)
+	})
+}
+
+// startProxy serves a reverse proxy to the server at upstream and returns its address.
+func startProxy(t *testing.T, upstream, path string, configure func(proxy *ReverseProxy)) string {
+	proxy, err := NewReverseProxy("http://"+upstream+path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	proxy.Client.Transport = loopbackTransport(t, proxy.Client, upstream)
+	proxy.ErrorLog = log.New(io.Discard, "", 0)
+	if configure != nil {
+		configure(proxy)
+	}
+	_, addr := startServer(t, proxy)
+	return addr
+}
+
+// TestReverseProxy tests forwarding requests and rewriting their headers.
+func TestReverseProxy(t *testing.T) {
+	_, upstream := startServer(t, HandlerFunc(func(w ResponseWriter, req *ServerRequest) {
+		body, _ := io.ReadAll(req.Body)
+		var lines []string
+		for k, v := range req.Headers {
+			lines = append(lines, k+": "+v)
+		}
+		sort.Strings(lines)
+		w.Header()["Connection"] = "X-Upstream-Hop"
+		w.Header()["X-Upstream-Hop"] = "drop me"
+		w.Header()["X-Upstream"] = "kept"
+		w.Header()["Set-Cookie"] = "a=1\nb=2"
+		fmt.Fprintf(w, "%s %s %s\n%s", req.Method, req.Path, body, strings.Join(lines, "\n"))
+	}))
+	addr := startProxy(t, upstream, "/base", nil)
+
+	req, _ := http.NewRequest("POST", "http://"+addr+"/items/1", strings.NewReader("payload"))
+	req.Header.Set("Connection", "X-Client-Hop")
+	req.Header.Set("X-Client-Hop", "drop me")
+	req.Header.Set("X-Forwarded-For", "10.0.0.1")
+	req.Header.Set("X-Custom", "kept")
+	response, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := io.ReadAll(response.Body)
+	response.Body.Close()
+	got := string(data)
+
+	if !strings.HasPrefix(got, "POST /base/items/1 payload\n") {
+		t.Error("Expected the request forwarded under the target path, got", got)
+	}
+	for _, want := range []string{"X-Custom: kept", "X-Forwarded-For: 10.0.0.1, 127.0.0.1", "X-Forwarded-Host: " + addr, "X-Forwarded-Proto: http", "Host: " + upstream} {
+		if !strings.Contains(got, want+"\n") && !strings.HasSuffix(got, want) {
+			t.Errorf("Expected the upstream to see %q, got %s", want, got)
+		}
+	}
+	if strings.Contains(got, "X-Client-Hop") {
+		t.Error("Expected hop-by-hop headers to be stripped, got", got)
+	}
+	if response.Header.Get("X-Upstream") != "kept" || response.Header.Get("X-Upstream-Hop") != "" {
+		t.Error("Expected the response headers copied without hop-by-hop ones, got", response.Header)
+	}
+	if cookies := response.Header.Values("Set-Cookie"); len(cookies) != 2 || cookies[0] != "a=1" || cookies[1] != "b=2" {
+		t.Error("Expected every cookie passed on, got", cookies)
+	}
+}
+
+// TestReverseProxyStreaming tests that response bodies reach the client as they arrive.
+func TestReverseProxyStreaming(t *testing.T) {
+	release := make(chan struct{})
+	_, upstream := startServer(t, HandlerFunc(func(w ResponseWriter, req *ServerRequest) {
+		io.WriteString(w, "first\n")
+		w.(Flusher).Flush()
+		<-release
+		io.WriteString(w, "second\n")
+	}))
+	addr := startProxy(t, upstream, "", nil)
+
+	response, err := http.Get("http://" + addr + "/events")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer response.Body.Close()
+	reader := bufio.NewReader(response.Body)
+	done := make(chan string, 1)
+	go func() {
+		line, _ := reader.ReadString('\n')
+		done <- line
+	}()
+	select {
+	case line := <-done:
+		if line != "first\n" {
+			t.Error("Expected the first line, got", line)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected the first line before the upstream finished.")
+	}
+	close(release)
+	if rest, _ := io.ReadAll(reader); string(rest) != "second\n" {
+		t.Error("Expected the rest of the body, got", string(rest))
+	}
+}
+
+// TestReverseProxyErrors tests answering when the upstream can't be reached.
+func TestReverseProxyErrors(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	unreachable := listener.Addr().String()
+	listener.Close()
+
+	var logs bytes.Buffer
+	addr := startProxy(t, unreachable, "", func(proxy *ReverseProxy) {
+		proxy.ErrorLog = log.New(&logs, "", 0)
+	})
+	response, err := http.Get("http://" + addr + "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	response.Body.Close()
+	if response.StatusCode != 502 || !strings.Contains(logs.String(), "reverse proxy error for GET /") {
+		t.Error("Expected a logged 502, got", response.StatusCode, logs.String())
+	}
+
+	addr = startProxy(t, "upstream.test", "", func(proxy *ReverseProxy) {
+		proxy.Client.Transport = RoundTripFunc(func(req *HttpRequest) (*HttpResponse, error) {
+			return &HttpResponse{StatusCode: 200, Status: "OK", Headers: map[string]string{}, Body: "from memory"}, nil
+		})
+		proxy.ModifyResponse = func(response *HttpResponse) error {
+			if response.Body == "from memory" {
+				return errors.New("rejected")
+			}
+			return nil
+		}
+		proxy.ErrorHandler = func(w ResponseWriter, req *ServerRequest, err error) {
+			w.WriteHeader(503)
+			io.WriteString(w, err.Error())
+		}
+	})
+	response, err = http.Get("http://" + addr + "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(response.Body)
+	response.Body.Close()
+	if response.StatusCode != 503 || string(body) != "rejected" {
+		t.Error("Expected the custom error handler, got", response.StatusCode, string(body))
+	}
+}
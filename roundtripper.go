@@ -0,0 +1,56 @@
+package httpmodule
+
+import (
+	"io"
+	"net/http"
+)
+
+// RoundTripper returns an http.RoundTripper that sends requests through the
+// client, so an *http.Client, or a library that insists on one, can use this
+// client's connections, transport, and settings. Set it as http.Client.Transport.
+//
+// Unless the request sets Accept-Encoding itself, bodies are requested
+// uncompressed, as net/http callers expect to read them as they are.
+func (client *HttpClient) RoundTripper() http.RoundTripper {
+	return httpRoundTripper{client}
+}
+
+type httpRoundTripper struct {
+	client *HttpClient
+}
+
+func (rt httpRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	converted, err := FromHTTPRequest(req)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := converted.Headers["Accept-Encoding"]; !ok {
+		converted.Headers["Accept-Encoding"] = "identity"
+	}
+
+	transport := rt.client.Transport
+	if transport == nil {
+		transport = rt.client.NetworkTransport()
+	}
+	response, err := transport.RoundTrip(converted)
+	if err != nil {
+		return nil, err
+	}
+	return ToHTTPResponse(response, req), nil
+}
+
+// responseBody reads a deferred body and hands its connection back on Close
+type responseBody struct {
+	response *HttpResponse
+}
+
+func (body *responseBody) Read(p []byte) (int, error) {
+	if body.response.body == nil {
+		return 0, io.EOF
+	}
+	return body.response.body.Read(p)
+}
+
+func (body *responseBody) Close() error {
+	return body.response.Close()
+}
@@ -0,0 +1,92 @@
+package httpmodule
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// TestRoundTripper tests using the client as the transport of an http.Client.
+func TestRoundTripper(t *testing.T) {
+	client := newPipeClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		w.Header().Set("X-Encoding", r.Header.Get("Accept-Encoding"))
+		w.Header().Set("X-Tags", r.Header.Get("X-Tag"))
+		w.WriteHeader(http.StatusAccepted)
+		fmt.Fprintf(w, "%s %s %s", r.Method, r.Host, body)
+	}))
+	httpClient := &http.Client{Transport: client.RoundTripper()}
+
+	req, _ := http.NewRequest("PUT", "http://example.com/items/1", strings.NewReader("data"))
+	req.Header.Add("X-Tag", "a")
+	req.Header.Add("X-Tag", "b")
+	req.Host = "virtual.example.com"
+	response, err := httpClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer response.Body.Close()
+	body, err := io.ReadAll(response.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if response.StatusCode != 202 || response.Status != "202 Accepted" || response.ProtoMajor != 1 {
+		t.Error("Expected 202 Accepted over HTTP/1.x, got", response.Status, response.Proto)
+	}
+	if string(body) != "PUT virtual.example.com data" {
+		t.Error("Expected the echoed request, got", string(body))
+	}
+	if response.ContentLength != int64(len(body)) {
+		t.Error("Expected Content-Length to be set, got", response.ContentLength)
+	}
+	if response.Header.Get("X-Encoding") != "identity" {
+		t.Error("Expected an uncompressed body to be requested, got", response.Header.Get("X-Encoding"))
+	}
+	if response.Header.Get("X-Tags") != "a, b" {
+		t.Error("Expected repeated headers to be joined, got", response.Header.Get("X-Tags"))
+	}
+}
+
+// TestRoundTripperStreaming tests that chunked bodies are streamed.
+func TestRoundTripperStreaming(t *testing.T) {
+	client := newPipeClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "first;")
+		w.(http.Flusher).Flush()
+		io.WriteString(w, "second")
+	}))
+	httpClient := &http.Client{Transport: client.RoundTripper()}
+
+	response, err := httpClient.Get("http://example.com/stream")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer response.Body.Close()
+	if response.ContentLength != -1 || len(response.TransferEncoding) != 1 {
+		t.Error("Expected a chunked response of unknown length.", response.ContentLength, response.TransferEncoding)
+	}
+	body, err := io.ReadAll(response.Body)
+	if err != nil || string(body) != "first;second" {
+		t.Error("Expected the whole stream, got", string(body), err)
+	}
+}
+
+// TestRoundTripperMock tests that the client's transport is used.
+func TestRoundTripperMock(t *testing.T) {
+	mock := NewMockTransport(t)
+	mock.On("GET", `/ping$`).Respond(200, "pong")
+	client := New()
+	client.Transport = mock
+
+	response, err := (&http.Client{Transport: client.RoundTripper()}).Get("https://example.com/ping")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(response.Body)
+	response.Body.Close()
+	if string(body) != "pong" {
+		t.Error("Expected the mocked body, got", string(body))
+	}
+}
@@ -0,0 +1,230 @@
+package httpmodule
+
+import (
+	"sort"
+	"strings"
+)
+
+// Router dispatches requests to handlers by method and path. Patterns are
+// slash-separated segments, each one of:
+//
+//   - a literal, matched exactly
+//   - {name}, matching any single segment, available as req.Param("name")
+//   - {name...}, only last, matching the rest of the path, possibly empty
+//   - *, only last, the same as {*...}
+//
+// When several routes match, literals win over parameters and parameters
+// over wildcards, segment by segment from the left. A path that matches only
+// routes for other methods gets 405 with an Allow header; HEAD requests fall
+// back to GET routes.
+type Router struct {
+	// Answer requests no route matches; nil sends a plain 404
+	NotFound Handler
+
+	routes     []*route
+	middleware []Middleware
+}
+
+type route struct {
+	method   string
+	pattern  string
+	segments []string
+	handler  Handler
+}
+
+// NewRouter returns an empty router
+func NewRouter() *Router {
+	return &Router{}
+}
+
+// Handle registers handler for requests with method (or "" for any method)
+// whose path matches pattern, wrapped in any middleware given for this route
+// alone. It panics on malformed patterns.
+func (router *Router) Handle(method, pattern string, handler Handler, middleware ...Middleware) {
+	segments := splitPath(pattern)
+	for i, segment := range segments {
+		last := i == len(segments)-1
+		if (segment == "*" || strings.HasSuffix(segment, "...}")) && !last {
+			panic("httpmodule: wildcard must be the last segment in " + pattern)
+		}
+		if strings.HasPrefix(segment, "{") != strings.HasSuffix(segment, "}") {
+			panic("httpmodule: malformed parameter in " + pattern)
+		}
+	}
+	handler = Chain(middleware...)(handler)
+	router.routes = append(router.routes, &route{method: method, pattern: pattern, segments: segments, handler: handler})
+}
+
+// HandleFunc registers a function as the handler for method and pattern
+func (router *Router) HandleFunc(method, pattern string, f func(w ResponseWriter, req *ServerRequest), middleware ...Middleware) {
+	router.Handle(method, pattern, HandlerFunc(f), middleware...)
+}
+
+// Use adds middleware around every request the router handles, including
+// those that end in 404 or 405
+func (router *Router) Use(middleware ...Middleware) {
+	router.middleware = append(router.middleware, middleware...)
+}
+
+// Group returns a group whose routes are registered under prefix
+func (router *Router) Group(prefix string) *RouteGroup {
+	return &RouteGroup{router: router, prefix: strings.TrimSuffix(prefix, "/")}
+}
+
+func (router *Router) ServeHTTP(w ResponseWriter, req *ServerRequest) {
+	if len(router.middleware) > 0 {
+		Chain(router.middleware...)(HandlerFunc(router.dispatch)).ServeHTTP(w, req)
+		return
+	}
+	router.dispatch(w, req)
+}
+
+// dispatch finds the route for req and calls it
+func (router *Router) dispatch(w ResponseWriter, req *ServerRequest) {
+	path := splitPath(req.Path)
+
+	var best *route
+	var bestRank []int
+	var bestParams map[string]string
+	allowed := map[string]bool{}
+	for _, method := range []string{req.Method, "GET"} {
+		for _, r := range router.routes {
+			params, rank, ok := r.match(path)
+			if !ok {
+				continue
+			}
+			if r.method != "" && r.method != method {
+				allowed[r.method] = true
+				continue
+			}
+			if best == nil || betterRank(rank, bestRank) {
+				best, bestRank, bestParams = r, rank, params
+			}
+		}
+		if best != nil || req.Method != "HEAD" {
+			break
+		}
+	}
+
+	if best != nil {
+		req.Params = bestParams
+		best.handler.ServeHTTP(w, req)
+		return
+	}
+	if len(allowed) > 0 {
+		if allowed["GET"] {
+			allowed["HEAD"] = true
+		}
+		methods := make([]string, 0, len(allowed))
+		for method := range allowed {
+			methods = append(methods, method)
+		}
+		sort.Strings(methods)
+		w.Header()["Allow"] = strings.Join(methods, ", ")
+		w.WriteHeader(405)
+		return
+	}
+	if router.NotFound != nil {
+		router.NotFound.ServeHTTP(w, req)
+		return
+	}
+	w.WriteHeader(404)
+}
+
+// match reports whether path matches the route, with the parameters it binds
+// and a rank per segment: 0 for literals, 1 for parameters, 2 for wildcards
+func (r *route) match(path []string) (map[string]string, []int, bool) {
+	var params map[string]string
+	rank := make([]int, 0, len(r.segments))
+	bind := func(name, value string) {
+		if params == nil {
+			params = make(map[string]string)
+		}
+		params[name] = value
+	}
+
+	for i, segment := range r.segments {
+		if segment == "*" || strings.HasSuffix(segment, "...}") {
+			name := "*"
+			if segment != "*" {
+				name = segment[1 : len(segment)-4]
+			}
+			rest := ""
+			if i < len(path) {
+				rest = strings.Join(path[i:], "/")
+			}
+			bind(name, rest)
+			return params, append(rank, 2), true
+		}
+		if i >= len(path) {
+			return nil, nil, false
+		}
+		if strings.HasPrefix(segment, "{") {
+			bind(segment[1:len(segment)-1], path[i])
+			rank = append(rank, 1)
+			continue
+		}
+		if segment != path[i] {
+			return nil, nil, false
+		}
+		rank = append(rank, 0)
+	}
+	if len(path) != len(r.segments) {
+		return nil, nil, false
+	}
+	return params, rank, true
+}
+
+// betterRank reports whether rank a is more specific than b
+func betterRank(a, b []int) bool {
+	for i := 0; i < len(a) && i < len(b); i++ {
+		if a[i] != b[i] {
+			return a[i] < b[i]
+		}
+	}
+	return len(a) > len(b)
+}
+
+// splitPath splits a path into its segments, ignoring the leading slash
+func splitPath(path string) []string {
+	path = strings.TrimPrefix(path, "/")
+	if path == "" {
+		return nil
+	}
+	return strings.Split(path, "/")
+}
+
+// RouteGroup registers routes on a router under a shared prefix and
+// middleware
+type RouteGroup struct {
+	router     *Router
+	prefix     string
+	middleware []Middleware
+}
+
+// Handle registers handler for method and the group's prefix followed by
+// pattern, inside the group's middleware and then any given for this route
+func (group *RouteGroup) Handle(method, pattern string, handler Handler, middleware ...Middleware) {
+	handler = Chain(middleware...)(handler)
+	group.router.Handle(method, group.prefix+pattern, handler, group.middleware...)
+}
+
+// HandleFunc registers a function as the handler for method and pattern
+func (group *RouteGroup) HandleFunc(method, pattern string, f func(w ResponseWriter, req *ServerRequest), middleware ...Middleware) {
+	group.Handle(method, pattern, HandlerFunc(f), middleware...)
+}
+
+// Use adds middleware around the routes registered on the group from now on
+func (group *RouteGroup) Use(middleware ...Middleware) {
+	group.middleware = append(group.middleware, middleware...)
+}
+
+// Group returns a nested group under the group's prefix followed by prefix,
+// starting with the group's middleware
+func (group *RouteGroup) Group(prefix string) *RouteGroup {
+	return &RouteGroup{
+		router:     group.router,
+		prefix:     group.prefix + strings.TrimSuffix(prefix, "/"),
+		middleware: append([]Middleware(nil), group.middleware...),
+	}
+}
@@ -0,0 +1,168 @@
+package httpmodule
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+)
+
+// responseRecorder is a ResponseWriter that keeps what a handler sends.
+type responseRecorder struct {
+	headers map[string]string
+	status  int
+	body    []byte
+	flushes int
+}
+
+func newResponseRecorder() *responseRecorder {
+	return &responseRecorder{headers: make(map[string]string)}
+}
+
+func (rec *responseRecorder) Header() map[string]string {
+	return rec.headers
+}
+
+func (rec *responseRecorder) WriteHeader(statusCode int) {
+	if rec.status == 0 {
+		rec.status = statusCode
+	}
+}
+
+func (rec *responseRecorder) Write(p []byte) (int, error) {
+	rec.WriteHeader(200)
+	rec.body = append(rec.body, p...)
+	return len(p), nil
+}
+
+func (rec *responseRecorder) Flush() {
+	rec.flushes++
+}
+
+// serve runs handler on a request for method and path and returns the recording.
+func serve(handler Handler, method, path string) *responseRecorder {
+	return serveWith(handler, method, path, map[string]string{})
+}
+
+// serveWith is serve for a request with headers.
+func serveWith(handler Handler, method, path string, headers map[string]string) *responseRecorder {
+	rec := newResponseRecorder()
+	handler.ServeHTTP(rec, &ServerRequest{Method: method, Path: path, Protocol: "HTTP/1.1", Headers: headers})
+	if rec.status == 0 {
+		rec.status = 200
+	}
+	return rec
+}
+
+// TestRouter tests dispatching on method, literals, parameters, and wildcards.
+func TestRouter(t *testing.T) {
+	router := NewRouter()
+	named := func(name string) HandlerFunc {
+		return func(w ResponseWriter, req *ServerRequest) {
+			fmt.Fprintf(w, "%s %v", name, req.Params)
+		}
+	}
+	router.Handle("GET", "/users", named("list"))
+	router.Handle("POST", "/users", named("create"))
+	router.Handle("GET", "/users/me", named("me"))
+	router.Handle("GET", "/users/{id}", named("user"))
+	router.Handle("DELETE", "/users/{id}", named("delete"))
+	router.Handle("GET", "/users/{id}/posts/{post}", named("post"))
+	router.Handle("GET", "/static/{file...}", named("static"))
+	router.Handle("", "/any/*", named("any"))
+
+	tests := []struct {
+		method, path, want string
+	}{
+		{"GET", "/users", "list map[]"},
+		{"POST", "/users", "create map[]"},
+		{"GET", "/users/me", "me map[]"},
+		{"GET", "/users/42", "user map[id:42]"},
+		{"HEAD", "/users/42", "user map[id:42]"},
+		{"DELETE", "/users/42", "delete map[id:42]"},
+		{"GET", "/users/42/posts/7", "post map[id:42 post:7]"},
+		{"GET", "/static/css/site.css", "static map[file:css/site.css]"},
+		{"GET", "/static/", "static map[file:]"},
+		{"PATCH", "/any/thing", "any map[*:thing]"},
+	}
+	for _, test := range tests {
+		rec := serve(router, test.method, test.path)
+		if rec.status != 200 || string(rec.body) != test.want {
+			t.Errorf("%s %s: expected %q, got %d %q.", test.method, test.path, test.want, rec.status, rec.body)
+		}
+	}
+}
+
+// TestRouterNotFound tests 404 and 405 responses.
+func TestRouterNotFound(t *testing.T) {
+	router := NewRouter()
+	router.HandleFunc("GET", "/users/{id}", func(w ResponseWriter, req *ServerRequest) {})
+	router.HandleFunc("DELETE", "/users/{id}", func(w ResponseWriter, req *ServerRequest) {})
+
+	if rec := serve(router, "GET", "/users/1/extra"); rec.status != 404 {
+		t.Error("Expected 404 for an unknown path, got", rec.status)
+	}
+	rec := serve(router, "PUT", "/users/1")
+	if rec.status != 405 || rec.headers["Allow"] != "DELETE, GET, HEAD" {
+		t.Error("Expected 405 with an Allow header, got", rec.status, rec.headers)
+	}
+
+	router.NotFound = HandlerFunc(func(w ResponseWriter, req *ServerRequest) {
+		w.WriteHeader(404)
+		fmt.Fprint(w, "custom")
+	})
+	if rec := serve(router, "GET", "/nothing"); rec.status != 404 || string(rec.body) != "custom" {
+		t.Error("Expected the custom not found handler, got", rec.status, string(rec.body))
+	}
+}
+
+// TestRouterGroups tests routes registered under shared prefixes.
+func TestRouterGroups(t *testing.T) {
+	router := NewRouter()
+	api := router.Group("/api/")
+	v1 := api.Group("/v1")
+	v1.HandleFunc("GET", "/items/{id}", func(w ResponseWriter, req *ServerRequest) {
+		fmt.Fprint(w, "v1 item ", req.Param("id"))
+	})
+	api.HandleFunc("GET", "/health", func(w ResponseWriter, req *ServerRequest) {
+		fmt.Fprint(w, "ok")
+	})
+
+	if rec := serve(router, "GET", "/api/v1/items/9"); string(rec.body) != "v1 item 9" {
+		t.Error("Expected the nested group route, got", string(rec.body))
+	}
+	if rec := serve(router, "GET", "/api/health"); string(rec.body) != "ok" {
+		t.Error("Expected the group route, got", string(rec.body))
+	}
+}
+
+// TestRouterServer tests a router behind a Server.
+func TestRouterServer(t *testing.T) {
+	router := NewRouter()
+	router.HandleFunc("GET", "/hello/{name}", func(w ResponseWriter, req *ServerRequest) {
+		fmt.Fprint(w, "hello ", req.Param("name"))
+	})
+	_, addr := startServer(t, router)
+
+	response, err := http.Post("http://"+addr+"/hello/go", "text/plain", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	response.Body.Close()
+	if response.StatusCode != 405 || response.Header.Get("Allow") != "GET, HEAD" {
+		t.Error("Expected 405 over the wire, got", response.StatusCode, response.Header)
+	}
+}
+
+// TestRouterBadPattern tests that malformed patterns are rejected.
+func TestRouterBadPattern(t *testing.T) {
+	for _, pattern := range []string{"/files/*/edit", "/users/{id"} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Error("Expected a panic for", pattern)
+				}
+			}()
+			NewRouter().Handle("GET", pattern, HandlerFunc(func(w ResponseWriter, req *ServerRequest) {}))
+		}()
+	}
+}
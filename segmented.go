@@ -0,0 +1,261 @@
+package httpmodule
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"sync"
+)
+
+// Smallest range worth a connection of its own in a segmented download
+const minSegmentSize = 64 << 10
+
+// errSegmentsUnusable means a file can't be fetched in ranges, so the
+// download falls back to a single stream
+var errSegmentsUnusable = errors.New("download cannot be segmented")
+
+// errFileChanged means the server sent the whole file instead of a range,
+// because it no longer matches the validator or has stopped taking ranges
+var errFileChanged = errors.New("download failed: the file changed on the server")
+
+// segment is one range of a segmented download
+type segment struct {
+	// First and last byte of the range, inclusive
+	Start int64 `json:"start"`
+	End   int64 `json:"end"`
+
+	// Bytes of the range known to be on disk
+	Written int64 `json:"written"`
+}
+
+// downloadSegmented fetches url in up to d.Segments ranges at once, each
+// written at its own offset, or resumes the ranges state recorded. It
+// returns errSegmentsUnusable if the server doesn't accept ranges, doesn't
+// say how big the file is, or the file is too small to be worth splitting.
+func (d *Downloader) downloadSegmented(url, dest string, state *checkpoint, verifier *digestVerifier) (*DownloadResult, error) {
+	var headers map[string]string
+	if len(state.Segments) == 0 {
+		var err error
+		if state, headers, err = d.planSegments(state.URL, url); err != nil {
+			return nil, err
+		}
+		verifier.expect(headerDigests(&HttpResponse{StatusCode: 200, Headers: headers}))
+	}
+
+	file, err := os.OpenFile(dest+partialSuffix, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	resumed := int64(0)
+	for _, seg := range state.Segments {
+		resumed += seg.Written
+	}
+	if info, err := file.Stat(); err != nil || (resumed > 0 && info.Size() != state.Size) {
+		// The file isn't the one the checkpoint describes
+		os.Remove(dest + checkpointSuffix)
+		return nil, errSegmentsUnusable
+	}
+	if resumed == 0 {
+		if err := file.Truncate(state.Size); err != nil {
+			return nil, err
+		}
+	}
+
+	var (
+		mu    sync.Mutex
+		wg    sync.WaitGroup
+		first error
+	)
+	fail := func(err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		if first == nil {
+			first = err
+		}
+	}
+	failed := func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return first != nil
+	}
+	meter := d.newProgressMeter(resumed, state.Size)
+	progress := &segmentProgress{d: d, file: file, state: state, dest: dest, mu: &mu, meter: meter}
+	for _, seg := range state.Segments {
+		if seg.Written > seg.End-seg.Start {
+			continue
+		}
+		wg.Add(1)
+		go func(seg *segment) {
+			defer wg.Done()
+			response, err := d.fetchSegment(url, state, seg, &mu)
+			if err != nil {
+				fail(err)
+				return
+			}
+			defer response.Close()
+			if h := response.Headers; h != nil {
+				mu.Lock()
+				headers = h
+				mu.Unlock()
+			}
+			if err := progress.copy(seg, responseStream(response), failed); err != nil {
+				fail(err)
+			}
+		}(seg)
+	}
+	wg.Wait()
+
+	if first == errFileChanged {
+		// Start again in a single stream, which takes whatever version the
+		// server has now
+		os.Remove(dest + checkpointSuffix)
+		return nil, errSegmentsUnusable
+	}
+	if first != nil {
+		d.saveCheckpoint(file, state, dest)
+		return nil, first
+	}
+	os.Remove(dest + checkpointSuffix)
+	meter.finish()
+	return &DownloadResult{Size: state.Size, Resumed: resumed, Segments: len(state.Segments), Headers: headers}, nil
+}
+
+// planSegments asks the server about url and splits it into ranges, to be
+// checkpointed under key
+func (d *Downloader) planSegments(key, url string) (*checkpoint, map[string]string, error) {
+	response, err := d.send("HEAD", url, "", "")
+	if err != nil {
+		return nil, nil, err
+	}
+	response.Close()
+	size, err := strconv.ParseInt(headerValue(response.Headers, "Content-Length"), 10, 64)
+	if response.StatusCode != 200 || err != nil || !headerContainsToken(response.Headers, "Accept-Ranges", "bytes") {
+		return nil, nil, errSegmentsUnusable
+	}
+
+	state := &checkpoint{
+		URL:          key,
+		ETag:         headerValue(response.Headers, "ETag"),
+		LastModified: headerValue(response.Headers, "Last-Modified"),
+		Size:         size,
+	}
+	if url != key {
+		state.Source = url
+	}
+	count := int64(d.Segments)
+	if size/minSegmentSize < count {
+		count = size / minSegmentSize
+	}
+	// Without a validator, ranges could come from different versions
+	if count < 2 || state.validator() == "" {
+		return nil, nil, errSegmentsUnusable
+	}
+
+	length := size / count
+	for i := int64(0); i < count; i++ {
+		end := (i+1)*length - 1
+		if i == count-1 {
+			end = size - 1
+		}
+		state.Segments = append(state.Segments, &segment{Start: i * length, End: end})
+	}
+	return state, response.Headers, nil
+}
+
+// fetchSegment requests the part of seg not yet written
+func (d *Downloader) fetchSegment(url string, state *checkpoint, seg *segment, mu *sync.Mutex) (*HttpResponse, error) {
+	mu.Lock()
+	from := seg.Start + seg.Written
+	mu.Unlock()
+	validator, _ := state.resumable(url)
+	response, err := d.send("GET", url, fmt.Sprintf("bytes=%d-%d", from, seg.End), validator)
+	if err != nil {
+		return nil, err
+	}
+	switch response.StatusCode {
+	case 206:
+		first, last, total, ok := parseContentRange(headerValue(response.Headers, "Content-Range"))
+		if ok && first == from && last == seg.End && (total < 0 || total == state.Size) {
+			return response, nil
+		}
+		response.Close()
+		return nil, fmt.Errorf("download failed: server sent an unexpected range %q", headerValue(response.Headers, "Content-Range"))
+	case 200:
+		// The whole file, because it no longer matches the validator
+		response.Close()
+		return nil, errFileChanged
+	}
+	response.Close()
+	return nil, fmt.Errorf("download failed: %d %s", response.StatusCode, response.Status)
+}
+
+// segmentProgress writes the ranges of a segmented download, checkpointing
+// every interval bytes across all of them
+type segmentProgress struct {
+	d     *Downloader
+	file  *os.File
+	state *checkpoint
+	dest  string
+	meter *progressMeter
+
+	// Guards the segments' Written and sinceCheckpoint
+	mu              *sync.Mutex
+	sinceCheckpoint int64
+}
+
+// copy writes body to seg's place in the file until the range is complete,
+// the body ends, or stop reports another segment failed
+func (p *segmentProgress) copy(seg *segment, body io.Reader, stop func() bool) error {
+	interval := p.d.CheckpointInterval
+	if interval <= 0 {
+		interval = defaultCheckpointInterval
+	}
+	p.mu.Lock()
+	offset := seg.Start + seg.Written
+	p.mu.Unlock()
+
+	buf := make([]byte, 32<<10)
+	for offset <= seg.End {
+		if stop() {
+			return nil
+		}
+		if rest := seg.End - offset + 1; rest < int64(len(buf)) {
+			buf = buf[:rest]
+		}
+		n, err := body.Read(buf)
+		if n > 0 {
+			if _, werr := p.file.WriteAt(buf[:n], offset); werr != nil {
+				return werr
+			}
+			offset += int64(n)
+
+			p.mu.Lock()
+			seg.Written += int64(n)
+			p.sinceCheckpoint += int64(n)
+			var cerr error
+			if p.sinceCheckpoint >= interval {
+				p.sinceCheckpoint = 0
+				cerr = p.d.saveCheckpoint(p.file, p.state, p.dest)
+			}
+			p.mu.Unlock()
+			p.meter.add(int64(n))
+			if cerr != nil {
+				return cerr
+			}
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if offset <= seg.End {
+		return fmt.Errorf("download failed: range %d-%d ended at %d", seg.Start, seg.End, offset)
+	}
+	return nil
+}
@@ -0,0 +1,744 @@
+package httpmodule
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime/multipart"
+	"net"
+	"net/http"
+	neturl "net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Handler responds to a request received by a Server
+type Handler interface {
+	ServeHTTP(w ResponseWriter, req *ServerRequest)
+}
+
+// HandlerFunc adapts an ordinary function to the Handler interface
+type HandlerFunc func(w ResponseWriter, req *ServerRequest)
+
+func (f HandlerFunc) ServeHTTP(w ResponseWriter, req *ServerRequest) {
+	f(w, req)
+}
+
+// ServerRequest is a request received by a Server. Body streams straight from
+// the connection and is only valid until the handler returns.
+type ServerRequest struct {
+	Method string
+
+	// Request target exactly as sent, such as "/search?q=go"
+	Target string
+
+	// Target split into its path, unescaped, and query
+	Path  string
+	Query neturl.Values
+
+	Protocol string
+	Host     string
+	Headers  map[string]string
+	Body     io.Reader
+
+	// Address of the client, as reported by the connection
+	RemoteAddr string
+
+	// Path parameters bound by the Router
+	Params map[string]string
+
+	// State of the TLS connection the request arrived on, or nil
+	TLS *tls.ConnectionState
+
+	// Query and body form fields, filled by ParseForm and ParseMultipartForm;
+	// PostForm has the body's fields alone
+	Form     neturl.Values
+	PostForm neturl.Values
+
+	// Parsed multipart body, filled by ParseMultipartForm
+	MultipartForm *multipart.Form
+
+	ctx context.Context
+}
+
+// Param returns the path parameter name bound by the Router, or ""
+func (req *ServerRequest) Param(name string) string {
+	return req.Params[name]
+}
+
+// Context returns the request's context, where middleware leaves values for
+// the handlers after it
+func (req *ServerRequest) Context() context.Context {
+	if req.ctx == nil {
+		return context.Background()
+	}
+	return req.ctx
+}
+
+// WithContext returns a shallow copy of req with its context replaced
+func (req *ServerRequest) WithContext(ctx context.Context) *ServerRequest {
+	if ctx == nil {
+		panic("httpmodule: nil context")
+	}
+	copied := *req
+	copied.ctx = ctx
+	return &copied
+}
+
+// Server serves HTTP/1.1 on connections it accepts, parsing requests with the
+// same primitives the client parses responses with. TLS connections that
+// negotiate h2 are served HTTP/2 instead.
+type Server struct {
+	// TCP address to listen on, such as ":8080"; empty means ":http"
+	Addr string
+
+	Handler Handler
+
+	// How tolerant request parsing is; the zero value is lenient
+	Parsing ParseOptions
+
+	// Source of time for Date headers; nil uses the real clock
+	Clock Clock
+
+	// Destination for errors that can't be reported to a client, such as
+	// panics in handlers; nil uses the standard logger
+	ErrorLog *log.Logger
+
+	// Configuration for ServeTLS and ListenAndServeTLS; nil uses the defaults
+	TLSConfig *tls.Config
+
+	// Time allowed to read a request's line and headers, and for a new
+	// connection to send them; zero means ReadTimeout. Bounds clients that
+	// trickle headers to hold connections open.
+	ReadHeaderTimeout time.Duration
+
+	// Time allowed to read a whole request, body included, from when its
+	// first byte arrives; zero means no limit
+	ReadTimeout time.Duration
+
+	// Time allowed to write a response, from when its request's headers have
+	// been read; zero means no limit
+	WriteTimeout time.Duration
+
+	// Time a kept-alive connection may wait for its next request; zero means
+	// ReadTimeout
+	IdleTimeout time.Duration
+
+	// Upper bound on the size of a request line and headers together,
+	// answered with 431 when exceeded; zero means Parsing.MaxHeaderBytes
+	MaxHeaderBytes int
+
+	// Largest request body accepted; zero means no limit. Bodies declared
+	// larger are answered with 413 without running the handler, and reading
+	// past the limit of one that isn't fails with ErrBodyTooLarge.
+	MaxRequestBodySize int64
+
+	// Serve only HTTP/1.1, rather than offering h2 on TLS listeners and
+	// switching cleartext connections to h2c, for clients that ask with
+	// Upgrade: h2c or open with the HTTP/2 preface. Serving h2c needs the
+	// module built with Go 1.24 or later, as it relies on the standard
+	// library's http.Protocols; built with an earlier Go, cleartext
+	// connections stay on HTTP/1.1, and the first client to ask for h2c is
+	// logged to ErrorLog.
+	DisableHTTP2 bool
+
+	middleware []Middleware
+
+	mu        sync.Mutex
+	listeners map[net.Listener]struct{}
+	conns     map[net.Conn]connState
+	closed    bool
+
+	// Per-connection servers for HTTP/2, asked to drain on Shutdown
+	http2Servers map[*http.Server]struct{}
+
+	// Logs that h2c was asked for but can't be served, the first time
+	h2cWarning sync.Once
+
+	// Signalled when a connection goes idle or away, for Shutdown
+	changed chan struct{}
+}
+
+// connState is whether a connection is in the middle of a request
+type connState int
+
+const (
+	// Waiting for the first byte of a request
+	stateIdle connState = iota
+	// Reading a request or writing its response
+	stateActive
+)
+
+// ErrAbortHandler can be passed to panic to abandon a response part way
+// through. The connection is closed, so the client can tell the response is
+// incomplete, and unlike other panics it is not logged.
+var ErrAbortHandler = errors.New("abort handler")
+
+// ErrServerClosed is returned by Serve and ListenAndServe after Close or Shutdown
+var ErrServerClosed = errors.New("server closed")
+
+// ListenAndServe listens on srv.Addr and serves connections until the server
+// is closed
+func (srv *Server) ListenAndServe() error {
+	addr := srv.Addr
+	if addr == "" {
+		addr = ":http"
+	}
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	return srv.Serve(listener)
+}
+
+// Serve accepts connections on listener and serves each on its own goroutine.
+// It always returns a non-nil error, ErrServerClosed once Close is called.
+func (srv *Server) Serve(listener net.Listener) error {
+	if !srv.trackListener(listener, true) {
+		listener.Close()
+		return ErrServerClosed
+	}
+	defer srv.trackListener(listener, false)
+
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			if srv.isClosed() {
+				return ErrServerClosed
+			}
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() {
+				continue
+			}
+			return err
+		}
+		go srv.ServeConn(conn)
+	}
+}
+
+// ServeConn serves requests on a single connection until either side closes
+// it, then closes it
+func (srv *Server) ServeConn(conn net.Conn) {
+	if !srv.trackConn(conn, true) {
+		conn.Close()
+		return
+	}
+	if tlsConn, ok := conn.(*tls.Conn); ok {
+		// The protocol to speak is only known once the handshake is done
+		setReadDeadline(conn, srv.readHeaderTimeout())
+		err := tlsConn.Handshake()
+		conn.SetReadDeadline(time.Time{})
+		if err != nil {
+			conn.Close()
+			srv.trackConn(conn, false)
+			return
+		}
+		if tlsConn.ConnectionState().NegotiatedProtocol == "h2" {
+			srv.serveHTTP2(tlsConn, nil)
+			conn.Close()
+			srv.trackConn(conn, false)
+			return
+		}
+	}
+	reader := getReader(conn)
+	writer := bufio.NewWriterSize(conn, responseBufferSize)
+
+	// A hijacked connection, and its reader, belong to the handler
+	hijacked := false
+	defer func() {
+		if !hijacked {
+			conn.Close()
+			putReader(reader)
+		}
+		srv.trackConn(conn, false)
+	}()
+
+	defer func() {
+		if err := recover(); err != nil && err != ErrAbortHandler {
+			srv.logf("httpmodule: panic serving %s: %v", conn.RemoteAddr(), err)
+		}
+	}()
+
+	for first := true; ; first = false {
+		// A new connection gets as long to send its first request as its
+		// headers; later requests may be a while coming
+		if first {
+			setReadDeadline(conn, srv.readHeaderTimeout())
+		} else {
+			setReadDeadline(conn, srv.idleTimeout())
+		}
+		conn.SetWriteDeadline(time.Time{})
+		if _, err := reader.Peek(1); err != nil {
+			return
+		}
+		// Clients that know the server speaks h2c may start with HTTP/2
+		if first && srv.offersH2C(conn) && hasHTTP2Preface(reader) && srv.canServeH2C(conn) {
+			conn.SetReadDeadline(time.Time{})
+			srv.serveHTTP2(conn, reader)
+			return
+		}
+		srv.setConnState(conn, stateActive)
+
+		start := time.Now()
+		headerDeadline := setReadDeadline(conn, srv.readHeaderTimeout())
+		req, err := srv.readRequest(reader, conn)
+		if err != nil {
+			if err != io.EOF {
+				if !headerDeadline.IsZero() && !time.Now().Before(headerDeadline) {
+					err = &requestError{status: 408, msg: "timed out reading request headers"}
+				}
+				srv.rejectRequest(writer, err)
+			}
+			return
+		}
+		if srv.ReadTimeout > 0 {
+			conn.SetReadDeadline(start.Add(srv.ReadTimeout))
+		} else {
+			conn.SetReadDeadline(time.Time{})
+		}
+		if srv.WriteTimeout > 0 {
+			conn.SetWriteDeadline(time.Now().Add(srv.WriteTimeout))
+		}
+		if srv.offersH2C(conn) && wantsH2C(req) && srv.canServeH2C(conn) {
+			srv.upgradeH2C(conn, reader, writer, req)
+			return
+		}
+
+		w := newResponse(writer, req, srv.Clock)
+		w.shuttingDown = srv.isClosed
+		w.conn, w.reader = conn, reader
+		w.onHijack = func() {
+			hijacked = true
+			srv.trackConn(conn, false)
+			// The handler decides how long the connection lasts now
+			conn.SetDeadline(time.Time{})
+		}
+		srv.handler().ServeHTTP(w, req)
+		if req.MultipartForm != nil {
+			req.MultipartForm.RemoveAll()
+		}
+		if err := w.finish(); err != nil || !w.keepAlive() {
+			return
+		}
+
+		// The next request can only be found once this one's body is consumed
+		body := req.Body.(*serverBody)
+		if _, err := io.CopyN(io.Discard, body, maxDrainSize); err != io.EOF {
+			return
+		}
+
+		srv.setConnState(conn, stateIdle)
+		if srv.isClosed() {
+			return
+		}
+	}
+}
+
+// Close stops the server's listeners and closes all of its connections,
+// including those with requests in progress
+func (srv *Server) Close() error {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	err := srv.closeListeners()
+	for conn := range srv.conns {
+		conn.Close()
+	}
+	return err
+}
+
+// Shutdown stops the server's listeners, closes idle connections, and waits
+// for requests in progress to finish, closing each connection once its
+// response is sent. If ctx ends first, the remaining connections are closed
+// and ctx's error returned.
+func (srv *Server) Shutdown(ctx context.Context) error {
+	srv.mu.Lock()
+	err := srv.closeListeners()
+	if srv.changed == nil {
+		srv.changed = make(chan struct{}, 1)
+	}
+	changed := srv.changed
+	for h2 := range srv.http2Servers {
+		go h2.Shutdown(ctx)
+	}
+	srv.mu.Unlock()
+
+	for {
+		if srv.closeIdleConns() {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			srv.Close()
+			return ctx.Err()
+		case <-changed:
+		}
+	}
+}
+
+// closeListeners marks the server closed and closes its listeners. It must be
+// called with srv.mu held.
+func (srv *Server) closeListeners() error {
+	srv.closed = true
+	var err error
+	for listener := range srv.listeners {
+		if cerr := listener.Close(); cerr != nil && err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
+
+// closeIdleConns closes connections between requests, reporting whether
+// there were no others left
+func (srv *Server) closeIdleConns() bool {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	for conn, state := range srv.conns {
+		if state == stateIdle {
+			conn.Close()
+			delete(srv.conns, conn)
+		}
+	}
+	return len(srv.conns) == 0
+}
+
+// Use adds middleware around every request the server handles, in order, the
+// first being the outermost. It must be called before serving.
+func (srv *Server) Use(middleware ...Middleware) {
+	srv.middleware = append(srv.middleware, middleware...)
+}
+
+func (srv *Server) handler() Handler {
+	handler := srv.Handler
+	if handler == nil {
+		handler = HandlerFunc(func(w ResponseWriter, req *ServerRequest) {
+			w.WriteHeader(404)
+		})
+	}
+	return Chain(srv.middleware...)(handler)
+}
+
+func (srv *Server) isClosed() bool {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	return srv.closed
+}
+
+// trackListener adds or removes listener, reporting false when adding to a closed server
+func (srv *Server) trackListener(listener net.Listener, add bool) bool {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	if !add {
+		delete(srv.listeners, listener)
+		return true
+	}
+	if srv.closed {
+		return false
+	}
+	if srv.listeners == nil {
+		srv.listeners = make(map[net.Listener]struct{})
+	}
+	srv.listeners[listener] = struct{}{}
+	return true
+}
+
+// trackConn adds or removes conn, reporting false when adding to a closed server
+func (srv *Server) trackConn(conn net.Conn, add bool) bool {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	if !add {
+		delete(srv.conns, conn)
+		srv.notifyChanged()
+		return true
+	}
+	if srv.closed {
+		return false
+	}
+	if srv.conns == nil {
+		srv.conns = make(map[net.Conn]connState)
+	}
+	srv.conns[conn] = stateIdle
+	return true
+}
+
+// setConnState records whether conn is in the middle of a request
+func (srv *Server) setConnState(conn net.Conn, state connState) {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	if _, ok := srv.conns[conn]; ok {
+		srv.conns[conn] = state
+	}
+	if state == stateIdle {
+		srv.notifyChanged()
+	}
+}
+
+// notifyChanged wakes Shutdown, if it is waiting. It must be called with
+// srv.mu held.
+func (srv *Server) notifyChanged() {
+	select {
+	case srv.changed <- struct{}{}:
+	default:
+	}
+}
+
+func (srv *Server) logf(format string, args ...any) {
+	if srv.ErrorLog != nil {
+		srv.ErrorLog.Printf(format, args...)
+		return
+	}
+	log.Printf(format, args...)
+}
+
+// requestError is a malformed request, answered with status before the
+// connection is closed
+type requestError struct {
+	status int
+	msg    string
+}
+
+func (e *requestError) Error() string {
+	return e.msg
+}
+
+func badRequest(msg string) error {
+	return &requestError{status: 400, msg: msg}
+}
+
+// rejectRequest answers a request that couldn't be parsed
+func (srv *Server) rejectRequest(writer *bufio.Writer, err error) {
+	status := 400
+	var reqErr *requestError
+	if errors.As(err, &reqErr) {
+		status = reqErr.status
+	} else if err == errHeaderTooLarge {
+		status = 431
+	}
+	fmt.Fprintf(writer, "HTTP/1.1 %d %s\r\nContent-Type: text/plain; charset=utf-8\r\nConnection: close\r\nContent-Length: %d\r\n\r\n%s",
+		status, statusText(status), len(err.Error()), err.Error())
+	writer.Flush()
+}
+
+// readRequest reads the request line and headers of the next request on conn.
+// It returns io.EOF when the connection closes cleanly between requests.
+func (srv *Server) readRequest(reader *bufio.Reader, conn net.Conn) (*ServerRequest, error) {
+	budget := srv.maxHeaderBytes()
+
+	// Browsers may send a stray CRLF after a request body
+	var line []byte
+	var err error
+	for {
+		line, err = readLine(reader, &budget)
+		if err == errHeaderTooLarge {
+			return nil, err
+		}
+		if err != nil {
+			if len(line) == 0 {
+				return nil, io.EOF
+			}
+			return nil, badRequest("malformed request line")
+		}
+		if srv.Parsing.Strict || string(line) != "\r\n" {
+			break
+		}
+	}
+	method, target, protocol, err := parseRequestLine(line, srv.Parsing.Strict)
+	if err != nil {
+		return nil, err
+	}
+
+	headers, err := readHeaders(reader, srv.Parsing.Strict, &budget, nil)
+	if err != nil {
+		if err == errHeaderTooLarge {
+			return nil, err
+		}
+		return nil, badRequest(err.Error())
+	}
+
+	req := &ServerRequest{
+		Method:     method,
+		Target:     target,
+		Protocol:   protocol,
+		Host:       headerValue(headers, "Host"),
+		Headers:    headers,
+		RemoteAddr: conn.RemoteAddr().String(),
+	}
+	if tlsConn, ok := conn.(*tls.Conn); ok {
+		state := tlsConn.ConnectionState()
+		req.TLS = &state
+	}
+	if protocol == "HTTP/1.1" && req.Host == "" && srv.Parsing.Strict {
+		return nil, badRequest("missing Host header")
+	}
+
+	// Origin-form targets are the norm; absolute-form ones come from proxies
+	// and CONNECT names only a host and port
+	switch {
+	case method == "CONNECT":
+		if _, _, err := net.SplitHostPort(target); err != nil {
+			return nil, badRequest("malformed CONNECT target")
+		}
+		req.Host = target
+		req.Query = neturl.Values{}
+	case target == "*":
+		req.Path = target
+		req.Query = neturl.Values{}
+	default:
+		parsedURL, err := neturl.ParseRequestURI(target)
+		if err != nil {
+			return nil, badRequest("malformed request target")
+		}
+		req.Path = parsedURL.Path
+		req.Query = parsedURL.Query()
+		if parsedURL.Host != "" {
+			req.Host = parsedURL.Host
+		}
+	}
+
+	body, err := newRequestBody(reader, headers, srv.Parsing.Strict)
+	if err != nil {
+		return nil, err
+	}
+	if srv.MaxRequestBodySize > 0 {
+		if !body.chunked && body.remaining > srv.MaxRequestBodySize {
+			return nil, &requestError{status: 413, msg: ErrBodyTooLarge.Error()}
+		}
+		body.limit = srv.MaxRequestBodySize
+	}
+	req.Body = body
+	return req, nil
+}
+
+// parseRequestLine splits "METHOD target HTTP/1.1\r\n" into its parts
+func parseRequestLine(line []byte, strict bool) (method, target, protocol string, err error) {
+	if !bytes.HasSuffix(line, []byte("\r\n")) {
+		if strict || !bytes.HasSuffix(line, []byte("\n")) {
+			return "", "", "", badRequest("malformed request line: missing CR LF at the end")
+		}
+	}
+	line = bytes.TrimRight(line, "\r\n")
+
+	parts := bytes.Split(line, []byte(" "))
+	if len(parts) != 3 || len(parts[0]) == 0 || len(parts[1]) == 0 {
+		return "", "", "", badRequest("malformed request line")
+	}
+	if !isHTTPVersion(parts[2]) {
+		return "", "", "", badRequest("unsupported protocol " + strconv.Quote(string(parts[2])))
+	}
+	if parts[2][5] != '1' {
+		return "", "", "", &requestError{status: 505, msg: "unsupported protocol version"}
+	}
+	for _, c := range parts[0] {
+		if c <= ' ' || c >= 0x7f || strings.IndexByte(`()<>@,;:\"/[]?={}`, c) >= 0 {
+			return "", "", "", badRequest("malformed method")
+		}
+	}
+	return internString(parts[0]), string(parts[1]), internString(parts[2]), nil
+}
+
+// newRequestBody returns the body of a request. Unlike responses, a request
+// without Content-Length or chunked coding has no body.
+func newRequestBody(reader *bufio.Reader, headers map[string]string, strict bool) (*serverBody, error) {
+	_, hasLength := lookupHeader(headers, "Content-Length")
+	if codings, ok := lookupHeader(headers, "Transfer-Encoding"); ok {
+		if !isChunked(headers) {
+			return nil, &requestError{status: 501, msg: "unsupported transfer encoding " + strconv.Quote(codings)}
+		}
+		// Servers and proxies that go by different fields would disagree on
+		// where the body ends, which is how requests are smuggled
+		if hasLength {
+			return nil, badRequest("both Transfer-Encoding and Content-Length set")
+		}
+	} else if !hasLength {
+		return &serverBody{bodyReader: &bodyReader{reader: reader}}, nil
+	}
+	body, err := newBodyReader(reader, headers, strict)
+	if err != nil {
+		return nil, badRequest(err.Error())
+	}
+	return &serverBody{bodyReader: body}, nil
+}
+
+// serverBody is a request body, which asks for the rest of it with a
+// 100 Continue response the first time it is read, when the client expects one
+type serverBody struct {
+	*bodyReader
+	sendContinue func()
+
+	// Most bytes the body may have, or zero for no limit, and the number read
+	limit int64
+	read  int64
+}
+
+func (body *serverBody) Read(p []byte) (int, error) {
+	if body.sendContinue != nil {
+		body.sendContinue()
+		body.sendContinue = nil
+	}
+	if body.limit <= 0 {
+		return body.bodyReader.Read(p)
+	}
+	if body.read >= body.limit {
+		// Only an error if there was more to read
+		var probe [1]byte
+		if n, err := body.bodyReader.Read(probe[:]); n == 0 {
+			return 0, err
+		}
+		return 0, ErrBodyTooLarge
+	}
+	if int64(len(p)) > body.limit-body.read {
+		p = p[:body.limit-body.read]
+	}
+	n, err := body.bodyReader.Read(p)
+	body.read += int64(n)
+	return n, err
+}
+
+func (srv *Server) readHeaderTimeout() time.Duration {
+	if srv.ReadHeaderTimeout > 0 {
+		return srv.ReadHeaderTimeout
+	}
+	return srv.ReadTimeout
+}
+
+func (srv *Server) idleTimeout() time.Duration {
+	if srv.IdleTimeout > 0 {
+		return srv.IdleTimeout
+	}
+	return srv.ReadTimeout
+}
+
+func (srv *Server) maxHeaderBytes() int {
+	if srv.MaxHeaderBytes > 0 {
+		return srv.MaxHeaderBytes
+	}
+	return srv.Parsing.maxHeaderBytes()
+}
+
+// setReadDeadline sets conn's read deadline timeout from now, or clears it if
+// timeout is zero, returning the deadline
+func setReadDeadline(conn net.Conn, timeout time.Duration) time.Time {
+	var deadline time.Time
+	if timeout > 0 {
+		deadline = time.Now().Add(timeout)
+	}
+	conn.SetReadDeadline(deadline)
+	return deadline
+}
+
+// headerContainsToken reports whether a comma-separated header includes token
+func headerContainsToken(headers map[string]string, key, token string) bool {
+	for _, part := range strings.Split(headerValue(headers, key), ",") {
+		if strings.EqualFold(strings.TrimSpace(part), token) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,461 @@
+package httpmodule
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// startServer serves handler on a loopback port and returns its address.
+func startServer(t *testing.T, handler Handler) (*Server, string) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := &Server{Handler: handler}
+	go srv.Serve(listener)
+	t.Cleanup(func() { srv.Close() })
+	return srv, listener.Addr().String()
+}
+
+// echoHandler answers with the request's method, path, query, and body.
+var echoHandler = HandlerFunc(func(w ResponseWriter, req *ServerRequest) {
+	body, _ := io.ReadAll(req.Body)
+	w.Header()["Content-Type"] = "text/plain"
+	fmt.Fprintf(w, "%s %s %s %s", req.Method, req.Path, req.Query.Get("q"), body)
+})
+
+// rawExchange writes raw to a new connection and returns everything read until the server closes it.
+func rawExchange(t *testing.T, addr, raw string) string {
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	io.WriteString(conn, raw)
+	data, _ := io.ReadAll(conn)
+	return string(data)
+}
+
+// TestServe tests serving requests to net/http's client.
+func TestServe(t *testing.T) {
+	_, addr := startServer(t, echoHandler)
+
+	response, err := http.Post("http://"+addr+"/items?q=go", "text/plain", strings.NewReader("payload"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(response.Body)
+	response.Body.Close()
+	if response.StatusCode != 200 || string(body) != "POST /items go payload" {
+		t.Error("Expected the echoed request, got", response.StatusCode, string(body))
+	}
+	if response.ContentLength != int64(len(body)) || response.Header.Get("Date") == "" {
+		t.Error("Expected Content-Length and Date headers.", response.Header)
+	}
+}
+
+// TestServerKeepAlive tests several requests, including a chunked one, on one connection.
+func TestServerKeepAlive(t *testing.T) {
+	_, addr := startServer(t, echoHandler)
+
+	raw := "GET /a HTTP/1.1\r\nHost: x\r\n\r\n" +
+		"POST /b HTTP/1.1\r\nHost: x\r\nTransfer-Encoding: chunked\r\n\r\n3\r\nabc\r\n0\r\n\r\n" +
+		"POST /c HTTP/1.1\r\nHost: x\r\nContent-Length: 5\r\nConnection: close\r\n\r\nhello"
+	got := rawExchange(t, addr, raw)
+
+	reader := bufio.NewReader(strings.NewReader(got))
+	for _, want := range []string{"GET /a  ", "POST /b  abc", "POST /c  hello"} {
+		response, err := ParseResponse(reader, "GET")
+		if err != nil {
+			t.Fatal(err, got)
+		}
+		if response.Body != want {
+			t.Errorf("Expected %q, got %q", want, response.Body)
+		}
+	}
+}
+
+// TestServerStreaming tests chunked responses for bodies bigger than the buffer and flushed ones.
+func TestServerStreaming(t *testing.T) {
+	big := strings.Repeat("x", 3*responseBufferSize)
+	_, addr := startServer(t, HandlerFunc(func(w ResponseWriter, req *ServerRequest) {
+		if req.Path == "/flush" {
+			io.WriteString(w, "early")
+			w.(Flusher).Flush()
+			io.WriteString(w, "late")
+			return
+		}
+		io.WriteString(w, big)
+	}))
+
+	for path, want := range map[string]string{"/big": big, "/flush": "earlylate"} {
+		response, err := http.Get("http://" + addr + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := io.ReadAll(response.Body)
+		response.Body.Close()
+		if string(body) != want || len(response.TransferEncoding) != 1 {
+			t.Errorf("%s: expected a chunked body of %d bytes, got %d bytes, %v", path, len(want), len(body), response.TransferEncoding)
+		}
+	}
+}
+
+// TestServerBodylessResponses tests HEAD, 204, and 304 responses.
+func TestServerBodylessResponses(t *testing.T) {
+	_, addr := startServer(t, HandlerFunc(func(w ResponseWriter, req *ServerRequest) {
+		switch req.Path {
+		case "/empty":
+			w.WriteHeader(204)
+		default:
+			io.WriteString(w, "twelve bytes")
+		}
+	}))
+
+	got := rawExchange(t, addr, "HEAD / HTTP/1.1\r\nHost: x\r\n\r\nGET /empty HTTP/1.1\r\nHost: x\r\nConnection: close\r\n\r\n")
+	reader := bufio.NewReader(strings.NewReader(got))
+	head, err := ParseResponse(reader, "HEAD")
+	if err != nil || head.Headers["Content-Length"] != "12" || head.Body != "" {
+		t.Error("Expected a HEAD response with GET's length.", head, err)
+	}
+	empty, err := ParseResponse(reader, "GET")
+	if err != nil || empty.StatusCode != 204 {
+		t.Error("Expected a 204 response.", empty, err)
+	}
+	if _, ok := empty.Headers["Content-Length"]; ok {
+		t.Error("Expected no Content-Length on 204.")
+	}
+}
+
+// TestServerExpectContinue tests that the interim response is sent when the body is read.
+func TestServerExpectContinue(t *testing.T) {
+	_, addr := startServer(t, echoHandler)
+
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	io.WriteString(conn, "PUT /up HTTP/1.1\r\nHost: x\r\nExpect: 100-continue\r\nContent-Length: 4\r\n\r\n")
+
+	reader := bufio.NewReader(conn)
+	line, _ := reader.ReadString('\n')
+	if line != "HTTP/1.1 100 Continue\r\n" {
+		t.Fatal("Expected 100 Continue, got", line)
+	}
+	reader.ReadString('\n')
+	io.WriteString(conn, "data")
+	response, err := ParseResponse(reader, "PUT")
+	if err != nil || response.Body != "PUT /up  data" {
+		t.Error("Expected the final response.", response, err)
+	}
+}
+
+// TestServerMalformedRequests tests the errors sent for requests that can't be served.
+func TestServerMalformedRequests(t *testing.T) {
+	_, addr := startServer(t, echoHandler)
+
+	tests := []struct {
+		raw    string
+		status string
+	}{
+		{"GARBAGE\r\n\r\n", "HTTP/1.1 400 "},
+		{"GET / HTTP/2.0\r\nHost: x\r\n\r\n", "HTTP/1.1 505 "},
+		{"GET / HTTP/1.1\r\nHost: x\r\nTransfer-Encoding: gzip\r\n\r\n", "HTTP/1.1 501 "},
+		{"GET / HTTP/1.1\r\nX-Big: " + strings.Repeat("a", 2<<20) + "\r\n\r\n", "HTTP/1.1 431 "},
+		{"POST / HTTP/1.1\r\nHost: x\r\nContent-Length: 1\r\ncontent-length: 2\r\n\r\nab", "HTTP/1.1 400 "},
+		{"POST / HTTP/1.1\r\nHost: x\r\nContent-Length: 1\r\nContent-Length: 2\r\n\r\nab", "HTTP/1.1 400 "},
+		{"POST / HTTP/1.1\r\nHost: x\r\ncontent-length: 2\r\ntransfer-encoding: chunked\r\n\r\n0\r\n\r\n", "HTTP/1.1 400 "},
+		{"GET / HTTP/1.1\r\nHost: x\r\nhost: y\r\n\r\n", "HTTP/1.1 400 "},
+	}
+	for _, test := range tests {
+		got := rawExchange(t, addr, test.raw)
+		if !strings.HasPrefix(got, test.status) {
+			t.Errorf("Expected %q, got %q", test.status, strings.SplitN(got, "\r\n", 2)[0])
+		}
+	}
+}
+
+// TestServerLowercaseFraming tests that framing headers are honoured in any case,
+// so a body can't be read as a second, smuggled request.
+func TestServerLowercaseFraming(t *testing.T) {
+	var mu sync.Mutex
+	var seen []string
+	_, addr := startServer(t, HandlerFunc(func(w ResponseWriter, req *ServerRequest) {
+		body, _ := io.ReadAll(req.Body)
+		mu.Lock()
+		seen = append(seen, req.Method+" "+req.Path+" "+req.Host+" "+string(body))
+		mu.Unlock()
+	}))
+
+	smuggled := "GET /smuggled HTTP/1.1\r\nHost: x\r\n\r\n"
+	rawExchange(t, addr, "POST /a HTTP/1.1\r\nhost: x\r\ncontent-length: "+strconv.Itoa(len(smuggled))+"\r\n\r\n"+smuggled+
+		"POST /b HTTP/1.1\r\nHOST: x\r\ntransfer-encoding: chunked\r\nConnection: close\r\n\r\n3\r\nabc\r\n0\r\n\r\n")
+	mu.Lock()
+	defer mu.Unlock()
+	if len(seen) != 2 || seen[0] != "POST /a x "+smuggled || seen[1] != "POST /b x abc" {
+		t.Errorf("Expected the bodies read as bodies, got %q", seen)
+	}
+}
+
+// TestServerHTTP10 tests that HTTP/1.0 connections close after streamed responses.
+func TestServerHTTP10(t *testing.T) {
+	_, addr := startServer(t, HandlerFunc(func(w ResponseWriter, req *ServerRequest) {
+		io.WriteString(w, "part")
+		w.(Flusher).Flush()
+		io.WriteString(w, "rest")
+	}))
+
+	got := rawExchange(t, addr, "GET / HTTP/1.0\r\n\r\n")
+	if !strings.Contains(got, "Connection: close\r\n") || !strings.HasSuffix(got, "\r\n\r\npartrest") {
+		t.Error("Expected a close-delimited body, got", got)
+	}
+}
+
+// TestServerClose tests that Serve returns once the server is closed.
+func TestServerClose(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := &Server{Handler: echoHandler}
+	done := make(chan error, 1)
+	go func() { done <- srv.Serve(listener) }()
+	time.Sleep(10 * time.Millisecond)
+	srv.Close()
+
+	select {
+	case err := <-done:
+		if err != ErrServerClosed {
+			t.Error("Expected ErrServerClosed, got", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected Serve to return after Close.")
+	}
+}
+
+// TestServerShutdown tests that Shutdown closes idle connections and waits for busy ones.
+func TestServerShutdown(t *testing.T) {
+	started, release := make(chan struct{}), make(chan struct{})
+	srv, addr := startServer(t, HandlerFunc(func(w ResponseWriter, req *ServerRequest) {
+		close(started)
+		<-release
+		io.WriteString(w, "done")
+	}))
+
+	idle, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer idle.Close()
+
+	busy, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer busy.Close()
+	busy.SetDeadline(time.Now().Add(5 * time.Second))
+	io.WriteString(busy, "GET / HTTP/1.1\r\nHost: x\r\n\r\n")
+	<-started
+
+	done := make(chan error, 1)
+	go func() { done <- srv.Shutdown(context.Background()) }()
+
+	// The idle connection is closed straight away
+	idle.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if _, err := idle.Read(make([]byte, 1)); err != io.EOF {
+		t.Error("Expected the idle connection to be closed, got", err)
+	}
+	select {
+	case <-done:
+		t.Fatal("Expected Shutdown to wait for the request in progress.")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(release)
+	data, _ := io.ReadAll(busy)
+	if !strings.Contains(string(data), "Connection: close") || !strings.HasSuffix(string(data), "done") {
+		t.Error("Expected the response to finish and close the connection, got", string(data))
+	}
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Error("Expected a clean shutdown, got", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected Shutdown to return once the request finished.")
+	}
+}
+
+// TestServerShutdownDeadline tests that Shutdown gives up when its context ends.
+func TestServerShutdownDeadline(t *testing.T) {
+	started, release := make(chan struct{}), make(chan struct{})
+	defer close(release)
+	srv, addr := startServer(t, HandlerFunc(func(w ResponseWriter, req *ServerRequest) {
+		close(started)
+		<-release
+	}))
+
+	errs := make(chan error, 1)
+	go func() {
+		_, err := http.Get("http://" + addr + "/")
+		errs <- err
+	}()
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := srv.Shutdown(ctx); err != context.DeadlineExceeded {
+		t.Error("Expected the deadline to be exceeded, got", err)
+	}
+	if err := <-errs; err == nil {
+		t.Error("Expected the request to be cut off.")
+	}
+}
+
+// startLimitedServer starts srv, configured by the caller, on a loopback port.
+func startLimitedServer(t *testing.T, srv *Server) string {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go srv.Serve(listener)
+	t.Cleanup(func() { srv.Close() })
+	return listener.Addr().String()
+}
+
+// TestServerTimeouts tests that slow and idle clients are disconnected.
+func TestServerTimeouts(t *testing.T) {
+	addr := startLimitedServer(t, &Server{
+		Handler:           echoHandler,
+		ReadHeaderTimeout: 100 * time.Millisecond,
+		IdleTimeout:       100 * time.Millisecond,
+	})
+
+	// Trickling the headers in runs out the header timeout
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	conn.Write([]byte("GET / HTTP/1.1\r\nHost: x\r\n"))
+	start := time.Now()
+	reply, _ := io.ReadAll(conn)
+	if !strings.HasPrefix(string(reply), "HTTP/1.1 408 ") || time.Since(start) > 2*time.Second {
+		t.Errorf("Expected 408 once the header timeout passed, got %q.", reply)
+	}
+
+	// A connection that never sends anything is dropped too
+	silent, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer silent.Close()
+	silent.SetDeadline(time.Now().Add(5 * time.Second))
+	if reply, _ := io.ReadAll(silent); len(reply) != 0 {
+		t.Errorf("Expected a silent close, got %q.", reply)
+	}
+
+	// A kept-alive connection is closed once idle too long
+	idle, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer idle.Close()
+	idle.SetDeadline(time.Now().Add(5 * time.Second))
+	idle.Write([]byte("GET /a HTTP/1.1\r\nHost: x\r\n\r\n"))
+	reply, _ = io.ReadAll(idle)
+	if !strings.HasPrefix(string(reply), "HTTP/1.1 200 ") || !strings.HasSuffix(string(reply), "GET /a  ") {
+		t.Errorf("Expected one response before the idle close, got %q.", reply)
+	}
+}
+
+// TestServerWriteTimeout tests that a response stalled past WriteTimeout fails.
+func TestServerWriteTimeout(t *testing.T) {
+	result := make(chan error, 1)
+	addr := startLimitedServer(t, &Server{
+		WriteTimeout: 100 * time.Millisecond,
+		Handler: HandlerFunc(func(w ResponseWriter, req *ServerRequest) {
+			// The client never reads, so the socket buffers eventually fill
+			chunk := make([]byte, 64<<10)
+			for i := 0; i < 1000; i++ {
+				if _, err := w.Write(chunk); err != nil {
+					result <- err
+					return
+				}
+			}
+			result <- nil
+		}),
+	})
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.Write([]byte("GET / HTTP/1.1\r\nHost: x\r\n\r\n"))
+
+	select {
+	case err := <-result:
+		if err == nil {
+			t.Error("Expected writing to a stalled client to time out.")
+		}
+	case <-time.After(5 * time.Second):
+		t.Error("Expected the write to give up.")
+	}
+}
+
+// TestServerRequestLimits tests MaxHeaderBytes and MaxRequestBodySize.
+func TestServerRequestLimits(t *testing.T) {
+	handled := make(chan string, 4)
+	addr := startLimitedServer(t, &Server{
+		MaxHeaderBytes:     256,
+		MaxRequestBodySize: 10,
+		Handler: HandlerFunc(func(w ResponseWriter, req *ServerRequest) {
+			body, err := io.ReadAll(req.Body)
+			if errors.Is(err, ErrBodyTooLarge) {
+				handled <- "too large"
+				w.WriteHeader(413)
+				return
+			}
+			handled <- string(body)
+		}),
+	})
+
+	reply := rawExchange(t, addr, "GET / HTTP/1.1\r\nHost: x\r\nX-Big: "+strings.Repeat("a", 300)+"\r\n\r\n")
+	if !strings.HasPrefix(reply, "HTTP/1.1 431 ") {
+		t.Errorf("Expected 431 for oversized headers, got %q.", reply)
+	}
+
+	reply = rawExchange(t, addr, "POST / HTTP/1.1\r\nHost: x\r\nContent-Length: 11\r\nConnection: close\r\n\r\nhello world")
+	if !strings.HasPrefix(reply, "HTTP/1.1 413 ") {
+		t.Errorf("Expected 413 for a declared oversized body, got %q.", reply)
+	}
+	select {
+	case got := <-handled:
+		t.Error("Expected the handler not to run, got", got)
+	default:
+	}
+
+	reply = rawExchange(t, addr, "POST / HTTP/1.1\r\nHost: x\r\nTransfer-Encoding: chunked\r\nConnection: close\r\n\r\n6\r\nhello \r\n5\r\nworld\r\n0\r\n\r\n")
+	if !strings.HasPrefix(reply, "HTTP/1.1 413 ") || <-handled != "too large" {
+		t.Errorf("Expected the chunked body to fail past the limit, got %q.", reply)
+	}
+
+	reply = rawExchange(t, addr, "POST / HTTP/1.1\r\nHost: x\r\nContent-Length: 10\r\nConnection: close\r\n\r\n0123456789")
+	if !strings.HasPrefix(reply, "HTTP/1.1 200 ") || <-handled != "0123456789" {
+		t.Errorf("Expected a body at the limit to be accepted, got %q.", reply)
+	}
+}
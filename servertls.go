@@ -0,0 +1,278 @@
+package httpmodule
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ListenAndServeTLS listens on srv.Addr and serves HTTPS with the certificate
+// in certFile and keyFile, or with srv.TLSConfig's certificates when they are empty
+func (srv *Server) ListenAndServeTLS(certFile, keyFile string) error {
+	addr := srv.Addr
+	if addr == "" {
+		addr = ":https"
+	}
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	return srv.ServeTLS(listener, certFile, keyFile)
+}
+
+// ServeTLS is Serve with TLS terminated on each accepted connection
+func (srv *Server) ServeTLS(listener net.Listener, certFile, keyFile string) error {
+	config := &tls.Config{}
+	if srv.TLSConfig != nil {
+		config = srv.TLSConfig.Clone()
+	}
+	if certFile != "" || keyFile != "" {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			listener.Close()
+			return fmt.Errorf("failed to load certificate: %v", err)
+		}
+		config.Certificates = append(config.Certificates, cert)
+	}
+	if len(config.Certificates) == 0 && config.GetCertificate == nil && config.GetConfigForClient == nil {
+		listener.Close()
+		return errors.New("no TLS certificate configured")
+	}
+	if len(config.NextProtos) == 0 {
+		config.NextProtos = []string{"h2", "http/1.1"}
+		if srv.DisableHTTP2 {
+			config.NextProtos = []string{"http/1.1"}
+		}
+	}
+	return srv.Serve(tls.NewListener(listener, config))
+}
+
+// CertStore holds the server certificates of a TLS listener, picking one by
+// the name the client asks for (SNI) and reloading them from disk when they
+// change. Certificates are only consulted during handshakes, so reloading
+// never affects connections already established.
+type CertStore struct {
+	// Source of time for Watch; nil uses the real clock
+	Clock Clock
+
+	// Destination for reload failures in Watch and ReloadOnSignal; nil uses
+	// the standard logger
+	ErrorLog *log.Logger
+
+	mu     sync.RWMutex
+	pairs  []*certPair
+	byName map[string]*tls.Certificate
+}
+
+// certPair is a certificate and key loaded from a pair of files
+type certPair struct {
+	certFile, keyFile string
+	modTime           time.Time
+	cert              *tls.Certificate
+}
+
+// NewCertStore returns an empty certificate store
+func NewCertStore() *CertStore {
+	return &CertStore{}
+}
+
+// Add loads a certificate and its key. The first one added answers clients
+// that send no name, or one no certificate covers.
+func (store *CertStore) Add(certFile, keyFile string) error {
+	pair := &certPair{certFile: certFile, keyFile: keyFile}
+	if err := pair.load(); err != nil {
+		return err
+	}
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	store.pairs = append(store.pairs, pair)
+	store.index()
+	return nil
+}
+
+// Reload loads every certificate again. If any fails to load, none of them
+// are replaced and the error is returned.
+func (store *CertStore) Reload() error {
+	return store.reload(true)
+}
+
+// reload loads the certificates whose files changed, or all of them if force is set
+func (store *CertStore) reload(force bool) error {
+	store.mu.RLock()
+	pairs := make([]certPair, len(store.pairs))
+	for i, pair := range store.pairs {
+		pairs[i] = *pair
+	}
+	store.mu.RUnlock()
+
+	changed := false
+	for i := range pairs {
+		if !force && !pairs[i].changed() {
+			continue
+		}
+		if err := pairs[i].load(); err != nil {
+			return err
+		}
+		changed = true
+	}
+	if !changed {
+		return nil
+	}
+
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	for i, pair := range pairs {
+		// Pairs added while reloading stay as they are
+		*store.pairs[i] = pair
+	}
+	store.index()
+	return nil
+}
+
+// Watch checks the certificate files for changes every interval and reloads
+// them, until stop is closed. Failures are logged and the old certificates
+// kept, so a half-written file is simply picked up on the next check.
+func (store *CertStore) Watch(interval time.Duration, stop <-chan struct{}) {
+	clock := clockOrReal(store.Clock)
+	for {
+		select {
+		case <-stop:
+			return
+		case <-clock.After(interval):
+			if err := store.reload(false); err != nil {
+				store.logf("httpmodule: failed to reload certificates: %v", err)
+			}
+		}
+	}
+}
+
+// ReloadOnSignal reloads the certificates whenever the process receives one
+// of signals, such as SIGHUP, until the returned function is called
+func (store *CertStore) ReloadOnSignal(signals ...os.Signal) (stop func()) {
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, signals...)
+	done := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case <-done:
+				return
+			case <-ch:
+				if err := store.Reload(); err != nil {
+					store.logf("httpmodule: failed to reload certificates: %v", err)
+				}
+			}
+		}
+	}()
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			signal.Stop(ch)
+			close(done)
+		})
+	}
+}
+
+// GetCertificate picks the certificate for a handshake, for use as
+// tls.Config.GetCertificate
+func (store *CertStore) GetCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+	if len(store.pairs) == 0 {
+		return nil, errors.New("no certificates loaded")
+	}
+
+	name := strings.TrimSuffix(strings.ToLower(hello.ServerName), ".")
+	if cert, ok := store.byName[name]; ok {
+		return cert, nil
+	}
+	if i := strings.IndexByte(name, '.'); i > 0 {
+		if cert, ok := store.byName["*"+name[i:]]; ok {
+			return cert, nil
+		}
+	}
+	return store.pairs[0].cert, nil
+}
+
+// TLSConfig returns a server configuration that takes its certificates from
+// the store
+func (store *CertStore) TLSConfig() *tls.Config {
+	return &tls.Config{GetCertificate: store.GetCertificate}
+}
+
+// index maps every name the certificates cover to the first that covers it
+func (store *CertStore) index() {
+	store.byName = make(map[string]*tls.Certificate)
+	for _, pair := range store.pairs {
+		leaf := pair.cert.Leaf
+		names := leaf.DNSNames
+		if len(names) == 0 && leaf.Subject.CommonName != "" {
+			names = []string{leaf.Subject.CommonName}
+		}
+		for _, name := range names {
+			name = strings.ToLower(name)
+			if _, ok := store.byName[name]; !ok {
+				store.byName[name] = pair.cert
+			}
+		}
+	}
+}
+
+func (store *CertStore) logf(format string, args ...any) {
+	if store.ErrorLog != nil {
+		store.ErrorLog.Printf(format, args...)
+		return
+	}
+	log.Printf(format, args...)
+}
+
+// load reads the pair's files, parsing the leaf so its names are known
+func (pair *certPair) load() error {
+	modTime, err := pair.modified()
+	if err != nil {
+		return fmt.Errorf("failed to load certificate: %v", err)
+	}
+	cert, err := tls.LoadX509KeyPair(pair.certFile, pair.keyFile)
+	if err != nil {
+		return fmt.Errorf("failed to load certificate: %v", err)
+	}
+	if cert.Leaf == nil {
+		cert.Leaf, err = x509.ParseCertificate(cert.Certificate[0])
+		if err != nil {
+			return fmt.Errorf("failed to parse certificate: %v", err)
+		}
+	}
+	pair.cert = &cert
+	pair.modTime = modTime
+	return nil
+}
+
+// modified returns when either of the pair's files was last modified
+func (pair *certPair) modified() (time.Time, error) {
+	var latest time.Time
+	for _, file := range []string{pair.certFile, pair.keyFile} {
+		info, err := os.Stat(file)
+		if err != nil {
+			return time.Time{}, err
+		}
+		if info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+	return latest, nil
+}
+
+// changed reports whether the files were modified since they were loaded.
+// Missing files count as unchanged, as they are usually being replaced.
+func (pair *certPair) changed() bool {
+	modTime, err := pair.modified()
+	return err == nil && !modTime.Equal(pair.modTime)
+}
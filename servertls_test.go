@@ -0,0 +1,214 @@
+package httpmodule
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeTestCert writes a self-signed certificate for names, with label as its
+// common name, to certFile and keyFile.
+func writeTestCert(t *testing.T, certFile, keyFile, label string, names ...string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: label},
+		DNSNames:     names,
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// startTLSServer serves handler over TLS with config on a loopback port.
+func startTLSServer(t *testing.T, handler Handler, config *tls.Config, certFile, keyFile string) string {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := &Server{Handler: handler, TLSConfig: config}
+	go srv.ServeTLS(listener, certFile, keyFile)
+	t.Cleanup(func() { srv.Close() })
+	return listener.Addr().String()
+}
+
+// peerName connects with serverName and returns the common name of the certificate presented.
+func peerName(t *testing.T, addr, serverName string) string {
+	conn, err := tls.Dial("tcp", addr, &tls.Config{ServerName: serverName, InsecureSkipVerify: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	return conn.ConnectionState().PeerCertificates[0].Subject.CommonName
+}
+
+// TestServeTLS tests serving HTTPS from a certificate on disk.
+func TestServeTLS(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	writeTestCert(t, certFile, keyFile, "server", "localhost")
+
+	addr := startTLSServer(t, HandlerFunc(func(w ResponseWriter, req *ServerRequest) {
+		fmt.Fprintf(w, "tls=%v name=%s", req.TLS != nil, req.TLS.ServerName)
+	}), nil, certFile, keyFile)
+
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}}}
+	defer client.CloseIdleConnections()
+	_, port, _ := net.SplitHostPort(addr)
+	response, err := client.Get("https://localhost:" + port + "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(response.Body)
+	response.Body.Close()
+	if string(body) != "tls=true name=localhost" {
+		t.Error("Expected the request's TLS state, got", string(body))
+	}
+
+	listener, _ := net.Listen("tcp", "127.0.0.1:0")
+	if err := (&Server{}).ServeTLS(listener, "", ""); err == nil {
+		t.Error("Expected an error without a certificate.")
+	}
+}
+
+// TestCertStoreSNI tests picking certificates by server name.
+func TestCertStoreSNI(t *testing.T) {
+	dir := t.TempDir()
+	store := NewCertStore()
+	for _, cert := range []struct {
+		label string
+		names []string
+	}{
+		{"default", []string{"a.test"}},
+		{"wildcard", []string{"*.b.test"}},
+		{"exact", []string{"www.b.test"}},
+	} {
+		certFile, keyFile := filepath.Join(dir, cert.label+".pem"), filepath.Join(dir, cert.label+".key")
+		writeTestCert(t, certFile, keyFile, cert.label, cert.names...)
+		if err := store.Add(certFile, keyFile); err != nil {
+			t.Fatal(err)
+		}
+	}
+	addr := startTLSServer(t, echoHandler, store.TLSConfig(), "", "")
+
+	tests := map[string]string{
+		"a.test":     "default",
+		"API.B.TEST": "wildcard",
+		"www.b.test": "exact",
+		"x.y.b.test": "default",
+		"other.test": "default",
+		"":           "default",
+	}
+	for name, want := range tests {
+		if got := peerName(t, addr, name); got != want {
+			t.Errorf("%q: expected the %s certificate, got %s.", name, want, got)
+		}
+	}
+}
+
+// TestCertStoreReload tests replacing certificates without dropping connections.
+func TestCertStoreReload(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	writeTestCert(t, certFile, keyFile, "old", "localhost")
+	store := NewCertStore()
+	if err := store.Add(certFile, keyFile); err != nil {
+		t.Fatal(err)
+	}
+	addr := startTLSServer(t, echoHandler, store.TLSConfig(), "", "")
+
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}}}
+	defer client.CloseIdleConnections()
+	get := func() *http.Response {
+		response, err := client.Get("https://" + addr + "/")
+		if err != nil {
+			t.Fatal(err)
+		}
+		io.ReadAll(response.Body)
+		response.Body.Close()
+		return response
+	}
+	if name := get().TLS.PeerCertificates[0].Subject.CommonName; name != "old" {
+		t.Fatal("Expected the old certificate, got", name)
+	}
+
+	// A broken file leaves the loaded certificate in place
+	os.WriteFile(certFile, []byte("garbage"), 0o600)
+	if err := store.Reload(); err == nil {
+		t.Error("Expected an error reloading a broken certificate.")
+	}
+	if name := peerName(t, addr, "localhost"); name != "old" {
+		t.Error("Expected the old certificate to be kept, got", name)
+	}
+
+	writeTestCert(t, certFile, keyFile, "new", "localhost")
+	if err := store.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	if name := peerName(t, addr, "localhost"); name != "new" {
+		t.Error("Expected the new certificate, got", name)
+	}
+	// The pooled connection from before the reload keeps working
+	if name := get().TLS.PeerCertificates[0].Subject.CommonName; name != "old" {
+		t.Error("Expected the existing connection to be reused, got", name)
+	}
+}
+
+// TestCertStoreWatch tests reloading certificates when their files change.
+func TestCertStoreWatch(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	writeTestCert(t, certFile, keyFile, "old", "localhost")
+	store := NewCertStore()
+	if err := store.Add(certFile, keyFile); err != nil {
+		t.Fatal(err)
+	}
+	stop := make(chan struct{})
+	defer close(stop)
+	go store.Watch(10*time.Millisecond, stop)
+
+	writeTestCert(t, certFile, keyFile, "new", "localhost")
+	later := time.Now().Add(time.Minute)
+	os.Chtimes(certFile, later, later)
+
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		cert, _ := store.GetCertificate(&tls.ClientHelloInfo{ServerName: "localhost"})
+		if cert.Leaf.Subject.CommonName == "new" {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Error("Expected the changed certificate to be picked up.")
+}
@@ -0,0 +1,32 @@
+package httpmodule
+
+// Signer authenticates a request by adding to it, typically a signature over
+// its method, URL, headers, and body in an Authorization header. SigV4Signer
+// signs for AWS; other schemes, such as GCP or a service's own HMAC, plug in
+// the same way.
+type Signer interface {
+	Sign(req *HttpRequest) error
+}
+
+// SignerFunc lets an ordinary function be used as a Signer
+type SignerFunc func(req *HttpRequest) error
+
+func (f SignerFunc) Sign(req *HttpRequest) error {
+	return f(req)
+}
+
+// SignRequests returns middleware that has signer sign each request, or a
+// copy of it, so the caller's request is left as it was. Install it with Use
+// after any middleware that changes requests, so the signature covers them.
+// Redirects and retries are signed again as they go out.
+func SignRequests(signer Signer) ClientMiddleware {
+	return func(next Transport) Transport {
+		return RoundTripFunc(func(req *HttpRequest) (*HttpResponse, error) {
+			signed := req.Clone()
+			if err := signer.Sign(signed); err != nil {
+				return nil, err
+			}
+			return next.RoundTrip(signed)
+		})
+	}
+}
@@ -0,0 +1,157 @@
+package httpmodule
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	neturl "net/url"
+	"strconv"
+)
+
+// Port SOCKS proxies listen on when their URL doesn't give one
+const defaultSOCKSPort = "1080"
+
+// Reasons a SOCKS5 server gives for refusing a connection, by reply code
+var socksReplies = map[byte]string{
+	1: "general failure",
+	2: "connection not allowed by ruleset",
+	3: "network unreachable",
+	4: "host unreachable",
+	5: "connection refused",
+	6: "TTL expired",
+	7: "command not supported",
+	8: "address type not supported",
+}
+
+// socksDial returns a dial that connects to hosts through the SOCKS5 proxy,
+// which dial connects to. Host names are resolved by the proxy, so names only
+// it can resolve, such as .onion ones, work too.
+func (client *HttpClient) socksDial(dial dialFunc, proxy *neturl.URL) dialFunc {
+	return func(ctx context.Context, useTLS bool, host string) (*persistConn, error) {
+		proxyAddr := proxy.Host
+		if proxy.Port() == "" {
+			proxyAddr = net.JoinHostPort(proxy.Hostname(), defaultSOCKSPort)
+		}
+		pc, err := dial(ctx, false, proxyAddr)
+		if err != nil {
+			return nil, err
+		}
+		hostname, port := splitHostPort(host, useTLS)
+
+		stop := pc.watch(ctx)
+		err = socksConnect(pc.conn, hostname, port, proxy.User)
+		if stop() {
+			err = ctx.Err()
+		}
+		if err != nil {
+			pc.close()
+			return nil, &DialError{Host: host, Err: fmt.Errorf("failed to connect through SOCKS proxy: %v", err)}
+		}
+		putReader(pc.reader)
+		return client.startTLS(ctx, pc.conn, hostname, useTLS, nil)
+	}
+}
+
+// socksConnect asks the SOCKS5 server on conn to connect to hostname:port,
+// authenticating with user's name and password when it has any (RFC 1928,
+// RFC 1929)
+func socksConnect(conn net.Conn, hostname, port string, user *neturl.Userinfo) error {
+	portNumber, err := strconv.ParseUint(port, 10, 16)
+	if err != nil {
+		return fmt.Errorf("invalid port %q", port)
+	}
+
+	methods := []byte{0}
+	if user != nil {
+		methods = []byte{2}
+	}
+	greeting := append([]byte{5, byte(len(methods))}, methods...)
+	if _, err := conn.Write(greeting); err != nil {
+		return err
+	}
+	var choice [2]byte
+	if _, err := io.ReadFull(conn, choice[:]); err != nil {
+		return err
+	}
+	if choice[0] != 5 {
+		return errors.New("not a SOCKS5 server")
+	}
+	switch choice[1] {
+	case 0:
+	case 2:
+		name := user.Username()
+		password, _ := user.Password()
+		if len(name) > 255 || len(password) > 255 {
+			return errors.New("SOCKS username or password too long")
+		}
+		auth := []byte{1, byte(len(name))}
+		auth = append(auth, name...)
+		auth = append(auth, byte(len(password)))
+		auth = append(auth, password...)
+		if _, err := conn.Write(auth); err != nil {
+			return err
+		}
+		var status [2]byte
+		if _, err := io.ReadFull(conn, status[:]); err != nil {
+			return err
+		}
+		if status[1] != 0 {
+			return errors.New("SOCKS authentication failed")
+		}
+	default:
+		return errors.New("SOCKS server accepts none of the offered authentication methods")
+	}
+
+	request := []byte{5, 1, 0}
+	if ip := net.ParseIP(hostname); ip == nil {
+		if len(hostname) > 255 {
+			return fmt.Errorf("host name %q too long for SOCKS", hostname)
+		}
+		request = append(request, 3, byte(len(hostname)))
+		request = append(request, hostname...)
+	} else if ip4 := ip.To4(); ip4 != nil {
+		request = append(request, 1)
+		request = append(request, ip4...)
+	} else {
+		request = append(request, 4)
+		request = append(request, ip...)
+	}
+	request = binary.BigEndian.AppendUint16(request, uint16(portNumber))
+	if _, err := conn.Write(request); err != nil {
+		return err
+	}
+
+	// The reply ends with the address the server bound, whose length
+	// depends on its type
+	var reply [4]byte
+	if _, err := io.ReadFull(conn, reply[:]); err != nil {
+		return err
+	}
+	if reply[1] != 0 {
+		reason, ok := socksReplies[reply[1]]
+		if !ok {
+			reason = "code " + strconv.Itoa(int(reply[1]))
+		}
+		return fmt.Errorf("SOCKS server refused connection to %s: %s", net.JoinHostPort(hostname, port), reason)
+	}
+	var skip int
+	switch reply[3] {
+	case 1:
+		skip = net.IPv4len
+	case 4:
+		skip = net.IPv6len
+	case 3:
+		var length [1]byte
+		if _, err := io.ReadFull(conn, length[:]); err != nil {
+			return err
+		}
+		skip = int(length[0])
+	default:
+		return errors.New("malformed SOCKS reply")
+	}
+	_, err = io.CopyN(io.Discard, conn, int64(skip+2))
+	return err
+}
@@ -0,0 +1,142 @@
+package httpmodule
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/binary"
+	"io"
+	"net"
+	neturl "net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+)
+
+// startSOCKSServer runs a SOCKS5 server that requires user and password when
+// user is set, sends each address it is asked for to requested, and connects
+// to the address route gives for it.
+func startSOCKSServer(t *testing.T, user, password string, route func(addr string) string, requested chan<- string) string {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go serveSOCKS(conn, user, password, route, requested)
+		}
+	}()
+	return listener.Addr().String()
+}
+
+func serveSOCKS(conn net.Conn, user, password string, route func(addr string) string, requested chan<- string) {
+	defer conn.Close()
+	buf := make([]byte, 512)
+	if _, err := io.ReadFull(conn, buf[:2]); err != nil {
+		return
+	}
+	io.ReadFull(conn, buf[:buf[1]])
+	if user == "" {
+		conn.Write([]byte{5, 0})
+	} else {
+		conn.Write([]byte{5, 2})
+		io.ReadFull(conn, buf[:2])
+		name := make([]byte, buf[1])
+		io.ReadFull(conn, name)
+		io.ReadFull(conn, buf[:1])
+		pass := make([]byte, buf[0])
+		io.ReadFull(conn, pass)
+		if string(name) != user || string(pass) != password {
+			conn.Write([]byte{1, 1})
+			return
+		}
+		conn.Write([]byte{1, 0})
+	}
+
+	io.ReadFull(conn, buf[:4])
+	var host string
+	switch buf[3] {
+	case 1:
+		io.ReadFull(conn, buf[:4])
+		host = net.IP(buf[:4]).String()
+	case 3:
+		io.ReadFull(conn, buf[:1])
+		name := make([]byte, buf[0])
+		io.ReadFull(conn, name)
+		host = string(name)
+	}
+	io.ReadFull(conn, buf[:2])
+	addr := net.JoinHostPort(host, strconv.Itoa(int(binary.BigEndian.Uint16(buf[:2]))))
+	requested <- addr
+
+	upstream, err := net.Dial("tcp", route(addr))
+	if err != nil {
+		conn.Write([]byte{5, 5, 0, 1, 0, 0, 0, 0, 0, 0})
+		return
+	}
+	defer upstream.Close()
+	conn.Write([]byte{5, 0, 0, 1, 127, 0, 0, 1, 0, 0})
+	go io.Copy(upstream, conn)
+	io.Copy(conn, upstream)
+}
+
+// TestSOCKSProxy tests sending http and https requests through a SOCKS5 proxy.
+func TestSOCKSProxy(t *testing.T) {
+	_, upstream := startServer(t, HandlerFunc(func(w ResponseWriter, req *ServerRequest) {
+		io.WriteString(w, "plain "+req.Target)
+	}))
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	writeTestCert(t, certFile, keyFile, "hidden", "hidden.onion")
+	secure := startTLSServer(t, HandlerFunc(func(w ResponseWriter, req *ServerRequest) {
+		io.WriteString(w, "secure "+req.Target)
+	}), nil, certFile, keyFile)
+
+	requested := make(chan string, 4)
+	proxyAddr := startSOCKSServer(t, "user", "secret", func(addr string) string {
+		if addr == "hidden.onion:443" {
+			return secure
+		}
+		return addr
+	}, requested)
+
+	pem, err := os.ReadFile(certFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	roots := x509.NewCertPool()
+	roots.AppendCertsFromPEM(pem)
+	client := New()
+	client.TLSConfig = &tls.Config{RootCAs: roots}
+	proxyURL, _ := neturl.Parse("socks5://user:secret@" + proxyAddr)
+	client.Proxy = ProxyURL(proxyURL)
+
+	response, err := client.Get("http://"+upstream+"/a", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response.Body != "plain /a" || <-requested != upstream {
+		t.Error("Expected the request relayed to the server, got", response.Body)
+	}
+
+	// The name goes to the proxy unresolved
+	response, err = client.Get("https://hidden.onion/b", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response.Body != "secure /b" || <-requested != "hidden.onion:443" {
+		t.Error("Expected the https request relayed by name, got", response.Body)
+	}
+
+	wrong, _ := neturl.Parse("socks5://user:wrong@" + proxyAddr)
+	client = New()
+	client.Proxy = ProxyURL(wrong)
+	if _, err := client.Get("http://"+upstream+"/c", nil); err == nil {
+		t.Error("Expected wrong credentials to be refused.")
+	}
+}
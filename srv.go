@@ -0,0 +1,132 @@
+package httpmodule
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"net"
+	"sort"
+	"sync"
+	"time"
+)
+
+// SRVResolver finds a service's servers through DNS SRV records, as Consul
+// and Kubernetes publish them, remembering the answer for its TTL. Set it in
+// HttpClient's Services to send a host's requests to the servers found.
+type SRVResolver struct {
+	// Record name, such as "_http._tcp.payments.service.consul"
+	Name string
+
+	// Looks up the records and reports how long they may be cached. When nil
+	// the system resolver is used; it doesn't expose TTLs, so its answers
+	// are kept for DefaultTTL.
+	Lookup func(ctx context.Context, name string) (records []*net.SRV, ttl time.Duration, err error)
+
+	// TTL used when Lookup doesn't report one; zero means 30 seconds
+	DefaultTTL time.Duration
+
+	// Source of time for expiring records; nil uses the real clock
+	Clock Clock
+
+	mu      sync.Mutex
+	records []*net.SRV
+	expires time.Time
+}
+
+// NewSRVResolver returns a resolver for the SRV records at name
+func NewSRVResolver(name string) *SRVResolver {
+	return &SRVResolver{Name: name}
+}
+
+// Targets returns the service's servers in the order to try them: by
+// priority, and within a priority in a random order weighted by the records'
+// weights (RFC 2782), so load spreads as the weights say. Records are looked
+// up again once their TTL passes; if that fails, the old ones are used until
+// a lookup succeeds.
+func (r *SRVResolver) Targets(ctx context.Context) ([]*net.SRV, error) {
+	records, err := r.current(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return orderSRV(records, rand.Int63n), nil
+}
+
+// current returns the cached records, looking them up if they have expired
+func (r *SRVResolver) current(ctx context.Context) ([]*net.SRV, error) {
+	now := clockOrReal(r.Clock).Now()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.records != nil && now.Before(r.expires) {
+		return r.records, nil
+	}
+
+	records, ttl, err := r.lookup(ctx)
+	if err == nil && len(records) == 0 {
+		err = errors.New("no SRV records for " + r.Name)
+	}
+	if err != nil {
+		if r.records != nil {
+			return r.records, nil
+		}
+		return nil, err
+	}
+	if ttl <= 0 {
+		ttl = r.DefaultTTL
+		if ttl <= 0 {
+			ttl = 30 * time.Second
+		}
+	}
+	r.records = records
+	r.expires = now.Add(ttl)
+	return records, nil
+}
+
+func (r *SRVResolver) lookup(ctx context.Context) ([]*net.SRV, time.Duration, error) {
+	if r.Lookup != nil {
+		return r.Lookup(ctx, r.Name)
+	}
+	_, records, err := net.DefaultResolver.LookupSRV(ctx, "", "", r.Name)
+	return records, 0, err
+}
+
+// orderSRV sorts records by priority, then orders each priority by weighted
+// random selection, drawing numbers in [0, n) from random
+func orderSRV(records []*net.SRV, random func(n int64) int64) []*net.SRV {
+	sorted := append([]*net.SRV(nil), records...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Priority < sorted[j].Priority
+	})
+
+	ordered := make([]*net.SRV, 0, len(sorted))
+	for start := 0; start < len(sorted); {
+		end := start
+		for end < len(sorted) && sorted[end].Priority == sorted[start].Priority {
+			end++
+		}
+		group := sorted[start:end]
+		for len(group) > 0 {
+			total := int64(0)
+			for _, record := range group {
+				total += int64(record.Weight)
+			}
+			// Records without weight go after the rest of their priority
+			pick := 0
+			if total > 0 {
+				n := random(total)
+				for i, record := range group {
+					if n < int64(record.Weight) {
+						pick = i
+						break
+					}
+					n -= int64(record.Weight)
+				}
+			} else {
+				pick = int(random(int64(len(group))))
+			}
+			ordered = append(ordered, group[pick])
+			group = append(group[:pick:pick], group[pick+1:]...)
+		}
+		start = end
+	}
+	return ordered
+}
@@ -0,0 +1,96 @@
+package httpmodule
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"net"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// TestOrderSRV tests ordering records by priority and weight.
+func TestOrderSRV(t *testing.T) {
+	records := []*net.SRV{
+		{Target: "backup", Priority: 20, Weight: 1},
+		{Target: "light", Priority: 10, Weight: 1},
+		{Target: "idle", Priority: 10, Weight: 0},
+		{Target: "heavy", Priority: 10, Weight: 3},
+	}
+	first := map[string]int{}
+	for i := 0; i < 4000; i++ {
+		ordered := orderSRV(records, rand.Int63n)
+		if ordered[2].Target != "idle" || ordered[3].Target != "backup" {
+			t.Fatal("Expected weightless then lower priority records last, got", ordered[2].Target, ordered[3].Target)
+		}
+		first[ordered[0].Target]++
+	}
+	if first["heavy"] < 2700 || first["heavy"] > 3300 {
+		t.Error("Expected the record with three times the weight first about 3 times in 4, got", first)
+	}
+}
+
+// TestSRVResolverCaching tests refreshing records after their TTL.
+func TestSRVResolverCaching(t *testing.T) {
+	clock := NewFakeClock(time.Unix(1700000000, 0))
+	lookups := 0
+	var fail bool
+	resolver := &SRVResolver{Name: "_http._tcp.api.test", Clock: clock}
+	resolver.Lookup = func(ctx context.Context, name string) ([]*net.SRV, time.Duration, error) {
+		lookups++
+		if fail {
+			return nil, 0, errors.New("DNS down")
+		}
+		return []*net.SRV{{Target: "a.test.", Port: 8080, Weight: 1}}, time.Minute, nil
+	}
+
+	for i := 0; i < 3; i++ {
+		if targets, err := resolver.Targets(context.Background()); err != nil || len(targets) != 1 {
+			t.Fatal("Expected the record, got", targets, err)
+		}
+	}
+	if lookups != 1 {
+		t.Error("Expected one lookup within the TTL, got", lookups)
+	}
+
+	clock.Advance(time.Minute)
+	fail = true
+	if targets, err := resolver.Targets(context.Background()); err != nil || len(targets) != 1 {
+		t.Error("Expected the old records when a refresh fails, got", targets, err)
+	}
+	if lookups != 2 {
+		t.Error("Expected a lookup after the TTL, got", lookups)
+	}
+
+	empty := &SRVResolver{Name: "_http._tcp.none.test", Lookup: resolver.Lookup}
+	if _, err := empty.Targets(context.Background()); err == nil {
+		t.Error("Expected an error without records to fall back on.")
+	}
+}
+
+// TestClientServices tests sending requests to servers found through SRV records.
+func TestClientServices(t *testing.T) {
+	_, addr := startServer(t, echoHandler)
+	_, port, _ := net.SplitHostPort(addr)
+	livePort, _ := strconv.Atoi(port)
+	_, deadPort, _ := net.SplitHostPort(deadAddr(t))
+	unreachable, _ := strconv.Atoi(deadPort)
+
+	resolver := NewSRVResolver("_http._tcp.payments.test")
+	resolver.Lookup = func(ctx context.Context, name string) ([]*net.SRV, time.Duration, error) {
+		return []*net.SRV{
+			{Target: "127.0.0.1.", Port: uint16(unreachable), Priority: 1, Weight: 1},
+			{Target: "127.0.0.1.", Port: uint16(livePort), Priority: 2, Weight: 1},
+		}, 0, nil
+	}
+	client := New()
+	client.Services = map[string]*SRVResolver{"payments": resolver}
+	response, err := client.Get("http://payments/charges", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response.StatusCode != 200 {
+		t.Error("Expected the request to fail over to the second server, got", response.StatusCode)
+	}
+}
@@ -0,0 +1,111 @@
+// Package testhelpers provides an in-process HTTP server for tests, so code
+// using httpmodule can be exercised without network access.
+package testhelpers
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"net/http"
+
+	"httpmodule/internal/testcert"
+)
+
+// Server is a local HTTP server listening on a random loopback port. Handlers
+// can be registered before or after it starts.
+type Server struct {
+	// Base URL of the server, e.g. "http://127.0.0.1:41234"
+	URL string
+
+	// Self-signed certificate served by TLS servers; nil for plain HTTP
+	Certificate *x509.Certificate
+
+	listener net.Listener
+	mux      *http.ServeMux
+	server   *http.Server
+}
+
+// NewServer starts a plain HTTP server
+func NewServer() *Server {
+	server, err := newServer(nil)
+	if err != nil {
+		panic(fmt.Sprintf("testhelpers: failed to start server: %v", err))
+	}
+	return server
+}
+
+// NewTLSServer starts an HTTPS server with a freshly generated self-signed
+// certificate valid for 127.0.0.1, ::1, and localhost. Clients need TLSConfig
+// or CertPool to trust it.
+func NewTLSServer() *Server {
+	certificate, err := testcert.Generate()
+	if err != nil {
+		panic(fmt.Sprintf("testhelpers: failed to generate certificate: %v", err))
+	}
+	server, err := newServer(&certificate)
+	if err != nil {
+		panic(fmt.Sprintf("testhelpers: failed to start server: %v", err))
+	}
+	return server
+}
+
+func newServer(certificate *tls.Certificate) (*Server, error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+
+	server := &Server{
+		listener: listener,
+		mux:      http.NewServeMux(),
+	}
+	server.server = &http.Server{Handler: server.mux}
+
+	scheme := "http"
+	if certificate != nil {
+		scheme = "https"
+		server.Certificate = certificate.Leaf
+		server.listener = tls.NewListener(listener, &tls.Config{Certificates: []tls.Certificate{*certificate}})
+	}
+	server.URL = scheme + "://" + listener.Addr().String()
+
+	go server.server.Serve(server.listener)
+	return server, nil
+}
+
+// Handle registers handler for requests matching pattern, as http.ServeMux does
+func (server *Server) Handle(pattern string, handler http.Handler) {
+	server.mux.Handle(pattern, handler)
+}
+
+// HandleFunc registers a handler function for requests matching pattern
+func (server *Server) HandleFunc(pattern string, handler func(http.ResponseWriter, *http.Request)) {
+	server.mux.HandleFunc(pattern, handler)
+}
+
+// Addr returns the host:port the server listens on
+func (server *Server) Addr() string {
+	return server.listener.Addr().String()
+}
+
+// CertPool returns a pool containing the server's certificate, or nil for
+// plain HTTP servers
+func (server *Server) CertPool() *x509.CertPool {
+	if server.Certificate == nil {
+		return nil
+	}
+	pool := x509.NewCertPool()
+	pool.AddCert(server.Certificate)
+	return pool
+}
+
+// TLSConfig returns a client configuration that trusts the server
+func (server *Server) TLSConfig() *tls.Config {
+	return &tls.Config{RootCAs: server.CertPool()}
+}
+
+// Close stops the server and closes any open connections
+func (server *Server) Close() {
+	server.server.Close()
+}
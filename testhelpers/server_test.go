@@ -0,0 +1,51 @@
+package testhelpers
+
+import (
+	"io"
+	"net/http"
+	"testing"
+)
+
+// TestServer tests serving a registered handler over plain HTTP.
+func TestServer(t *testing.T) {
+	server := NewServer()
+	defer server.Close()
+	server.HandleFunc("/hello", func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "hello")
+	})
+
+	response, err := http.Get(server.URL + "/hello")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer response.Body.Close()
+	body, _ := io.ReadAll(response.Body)
+	if string(body) != "hello" {
+		t.Errorf("Expected hello, got %q.", body)
+	}
+}
+
+// TestTLSServer tests that clients using TLSConfig trust the generated certificate.
+func TestTLSServer(t *testing.T) {
+	server := NewTLSServer()
+	defer server.Close()
+	server.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "secure")
+	})
+
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: server.TLSConfig()}}
+	response, err := client.Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer response.Body.Close()
+	body, _ := io.ReadAll(response.Body)
+	if string(body) != "secure" {
+		t.Errorf("Expected secure, got %q.", body)
+	}
+
+	// Without the pool the certificate must be rejected
+	if _, err := http.Get(server.URL); err == nil {
+		t.Error("Expected an untrusted certificate error.")
+	}
+}
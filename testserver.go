@@ -0,0 +1,108 @@
+package httpmodule
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"sync"
+
+	"httpmodule/internal/testcert"
+)
+
+// TestServer is a Server on a random loopback port, for testing code that
+// makes requests without touching the network
+type TestServer struct {
+	// Base URL of the server, such as "http://127.0.0.1:41234"
+	URL string
+
+	// Self-signed certificate of a TLS server; nil for plain HTTP
+	Certificate *x509.Certificate
+
+	Server *Server
+
+	listener net.Listener
+
+	mu     sync.Mutex
+	client *HttpClient
+}
+
+// NewTestServer starts serving handler over plain HTTP. It panics if it
+// can't listen, as there is no test to run without it.
+func NewTestServer(handler Handler) *TestServer {
+	ts, err := newTestServer(handler, nil)
+	if err != nil {
+		panic(fmt.Sprintf("httpmodule: failed to start test server: %v", err))
+	}
+	return ts
+}
+
+// NewTLSTestServer starts serving handler over HTTPS, with a freshly
+// generated self-signed certificate for 127.0.0.1, ::1, and localhost. The
+// server's Client trusts it.
+func NewTLSTestServer(handler Handler) *TestServer {
+	certificate, err := testcert.Generate()
+	if err != nil {
+		panic(fmt.Sprintf("httpmodule: failed to generate certificate: %v", err))
+	}
+	ts, err := newTestServer(handler, &certificate)
+	if err != nil {
+		panic(fmt.Sprintf("httpmodule: failed to start test server: %v", err))
+	}
+	return ts
+}
+
+func newTestServer(handler Handler, certificate *tls.Certificate) (*TestServer, error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+	ts := &TestServer{
+		Server:   &Server{Handler: handler},
+		listener: listener,
+		URL:      "http://" + listener.Addr().String(),
+	}
+	if certificate == nil {
+		go ts.Server.Serve(listener)
+		return ts, nil
+	}
+
+	ts.URL = "https://" + listener.Addr().String()
+	ts.Certificate = certificate.Leaf
+	ts.Server.TLSConfig = &tls.Config{Certificates: []tls.Certificate{*certificate}}
+	go ts.Server.ServeTLS(listener, "", "")
+	return ts, nil
+}
+
+// Addr returns the host:port the server listens on
+func (ts *TestServer) Addr() string {
+	return ts.listener.Addr().String()
+}
+
+// Client returns a client for the server, which trusts its certificate if
+// it has one. Each call returns the same client, whose idle connections are
+// closed along with the server.
+func (ts *TestServer) Client() *HttpClient {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	if ts.client == nil {
+		ts.client = New()
+		if ts.Certificate != nil {
+			pool := x509.NewCertPool()
+			pool.AddCert(ts.Certificate)
+			ts.client.TLSConfig = &tls.Config{RootCAs: pool}
+		}
+	}
+	return ts.client
+}
+
+// Close stops the server, closing its connections and those of its client
+func (ts *TestServer) Close() {
+	ts.Server.Close()
+	ts.mu.Lock()
+	client := ts.client
+	ts.mu.Unlock()
+	if client != nil {
+		client.CloseIdleConnections()
+	}
+}
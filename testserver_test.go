@@ -0,0 +1,36 @@
+package httpmodule
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+// TestTestServer tests serving the client over plain HTTP and trusted HTTPS.
+func TestTestServer(t *testing.T) {
+	handler := HandlerFunc(func(w ResponseWriter, req *ServerRequest) {
+		w.Write([]byte(req.Method + " " + req.Path))
+	})
+	for _, ts := range []*TestServer{NewTestServer(handler), NewTLSTestServer(handler)} {
+		response, err := ts.Client().Get(ts.URL+"/hello", nil)
+		if err != nil || response.Body != "GET /hello" {
+			t.Errorf("Expected %s to answer, got %v %v", ts.URL, response, err)
+		}
+		ts.Close()
+		if _, err := ts.Client().Get(ts.URL+"/hello", nil); err == nil {
+			t.Errorf("Expected %s to be closed", ts.URL)
+		}
+	}
+
+	ts := NewTLSTestServer(handler)
+	defer ts.Close()
+	if !strings.HasPrefix(ts.URL, "https://127.0.0.1:") || ts.Certificate == nil {
+		t.Error("Expected an HTTPS URL and certificate, got", ts.URL, ts.Certificate)
+	}
+	// Other clients don't trust the certificate
+	_, err := New().Get(ts.URL, nil)
+	var tlsErr *TLSError
+	if !errors.As(err, &tlsErr) {
+		t.Error("Expected an untrusted certificate error, got", err)
+	}
+}
@@ -0,0 +1,49 @@
+package httpmodule
+
+import (
+	"context"
+	"time"
+)
+
+// Limit on TLS handshakes when TLSHandshakeTimeout is zero
+const defaultTLSHandshakeTimeout = 10 * time.Second
+
+// requestTimeout returns the limit on the whole of req, or zero for none
+func (client *HttpClient) requestTimeout(req *HttpRequest) time.Duration {
+	if req.Timeout > 0 {
+		return req.Timeout
+	}
+	return client.Timeout
+}
+
+// withTimeout returns a copy of req whose context ends after timeout, and the
+// function that releases it. Running out is reported as a *TimeoutError for
+// op, rather than as the context.DeadlineExceeded of the caller's own context.
+func withTimeout(req *HttpRequest, timeout time.Duration) (*HttpRequest, context.CancelFunc) {
+	parent := req.Context()
+	ctx, cancel := context.WithTimeout(parent, timeout)
+	return req.WithContext(&timeoutContext{Context: ctx, parent: parent, op: "request"}), cancel
+}
+
+// timeoutContext is a context with a deadline the client set, whose error
+// tells it apart from one the caller's context reached
+type timeoutContext struct {
+	context.Context
+	parent context.Context
+	op     string
+}
+
+func (ctx *timeoutContext) Err() error {
+	err := ctx.Context.Err()
+	if err == context.DeadlineExceeded && ctx.parent.Err() == nil {
+		return &TimeoutError{Op: ctx.op, Err: err}
+	}
+	return err
+}
+
+func (client *HttpClient) tlsHandshakeTimeout() time.Duration {
+	if client.TLSHandshakeTimeout > 0 {
+		return client.TLSHandshakeTimeout
+	}
+	return defaultTLSHandshakeTimeout
+}
@@ -0,0 +1,93 @@
+package httpmodule
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+)
+
+// startStallingServer accepts connections, answers each request with reply,
+// and then leaves it open without sending anything more. Without a reply the
+// server sends nothing at all, not even its part of a TLS handshake.
+func startStallingServer(t *testing.T, reply string) string {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan struct{})
+	t.Cleanup(func() {
+		close(done)
+		listener.Close()
+	})
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				buf := make([]byte, 4096)
+				if reply != "" {
+					conn.Read(buf)
+					conn.Write([]byte(reply))
+				}
+				<-done
+			}()
+		}
+	}()
+	return listener.Addr().String()
+}
+
+// TestTimeouts tests that each phase's limit ends a request that stalls in it.
+func TestTimeouts(t *testing.T) {
+	tests := []struct {
+		name   string
+		reply  string
+		scheme string
+		set    func(*HttpClient)
+		op     string
+	}{
+		{"handshake", "", "https", func(c *HttpClient) { c.TLSHandshakeTimeout = 50 * time.Millisecond }, "TLS handshake"},
+		{"headers", "", "http", func(c *HttpClient) { c.ResponseHeaderTimeout = 50 * time.Millisecond }, "awaiting response headers"},
+		{"partial headers", "HTTP/1.1 200 OK\r\nContent-", "http", func(c *HttpClient) { c.ResponseHeaderTimeout = 50 * time.Millisecond }, "awaiting response headers"},
+		{"body", "HTTP/1.1 200 OK\r\nContent-Length: 10\r\n\r\nab", "http", func(c *HttpClient) { c.Timeout = 100 * time.Millisecond }, "request"},
+	}
+	for _, test := range tests {
+		addr := startStallingServer(t, test.reply)
+		client := New()
+		test.set(client)
+
+		start := time.Now()
+		_, err := client.Get(test.scheme+"://"+addr+"/", nil)
+		var timeoutErr *TimeoutError
+		if !errors.As(err, &timeoutErr) || timeoutErr.Op != test.op {
+			t.Errorf("%s: Expected a %s timeout, got %v", test.name, test.op, err)
+		}
+		if elapsed := time.Since(start); elapsed > 5*time.Second {
+			t.Errorf("%s: Expected the request to end promptly, took %v", test.name, elapsed)
+		}
+	}
+}
+
+// TestRequestTimeout tests a request's own timeout and the caller's context deadline.
+func TestRequestTimeout(t *testing.T) {
+	addr := startStallingServer(t, "HTTP/1.1 200 OK\r\nContent-Length: 10\r\n\r\n")
+	client := New()
+	client.Timeout = time.Hour
+
+	_, err := client.Do(&HttpRequest{Method: "GET", URL: "http://" + addr + "/", Timeout: 50 * time.Millisecond})
+	var timeoutErr *TimeoutError
+	if !errors.As(err, &timeoutErr) || !errors.Is(err, context.DeadlineExceeded) {
+		t.Error("Expected the request's timeout to apply, got", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err = client.DoContext(ctx, &HttpRequest{Method: "GET", URL: "http://" + addr + "/"})
+	if err != context.DeadlineExceeded {
+		t.Error("Expected the caller's deadline to be reported as it is, got", err)
+	}
+}
@@ -0,0 +1,231 @@
+package httpmodule
+
+import (
+	"context"
+	"crypto/tls"
+	"sync"
+	"time"
+)
+
+// ClientTrace holds functions called at points in a request's life, for
+// measuring where its time goes, as net/http/httptrace does. Any of them may
+// be nil. Attach it to a request's context with WithClientTrace. Connecting
+// may try addresses in parallel, so the DNS and connect hooks can be called
+// from several goroutines at once.
+type ClientTrace struct {
+	// Around looking up the server's address, when it is a name
+	DNSStart func(host string)
+	DNSDone  func(addrs []string, err error)
+
+	// ConnectStart is called for each address a TCP connection is attempted
+	// to, ConnectDone once a connection to one is open or the attempts for
+	// a resolved name have failed
+	ConnectStart func(addr string)
+	ConnectDone  func(addr string, err error)
+
+	// Around the TLS handshake of HTTPS connections
+	TLSHandshakeStart func()
+	TLSHandshakeDone  func(state tls.ConnectionState, err error)
+
+	// Once there's a connection for the request, new or kept alive
+	GotConn func(reused bool)
+
+	// Once the request has been sent, or failed to be
+	WroteRequest func(err error)
+
+	// When the first byte of the response arrives
+	GotFirstResponseByte func()
+}
+
+type traceContextKey struct{}
+
+// WithClientTrace returns a copy of ctx that reports the progress of requests
+// made with it to trace
+func WithClientTrace(ctx context.Context, trace *ClientTrace) context.Context {
+	return context.WithValue(ctx, traceContextKey{}, trace)
+}
+
+// ContextClientTrace returns the ClientTrace attached to ctx, or nil
+func ContextClientTrace(ctx context.Context) *ClientTrace {
+	trace, _ := ctx.Value(traceContextKey{}).(*ClientTrace)
+	return trace
+}
+
+// Timings says how long each part of a round trip took. Redirects and
+// retries each have their own; a response has those of its own round trip.
+type Timings struct {
+	// Looking up the server's address, opening the connection, and the TLS
+	// handshake; all zero when a kept-alive connection was reused
+	DNS          time.Duration
+	Connect      time.Duration
+	TLSHandshake time.Duration
+	Reused       bool
+
+	// From the request being sent to the first byte of the response
+	Wait time.Duration
+
+	// From the start of the round trip to the first byte of the response
+	TimeToFirstByte time.Duration
+}
+
+type roundTripTraceKey struct{}
+
+// roundTripTrace follows one round trip, recording its timings and passing
+// events on to the caller's ClientTrace
+type roundTripTrace struct {
+	hooks *ClientTrace
+
+	mu           sync.Mutex
+	start        time.Time
+	dnsStart     time.Time
+	dnsEnded     bool
+	connectStart time.Time
+	tlsStart     time.Time
+	wrote        time.Time
+	timings      Timings
+}
+
+// startTrace returns a copy of ctx carrying a new trace for a round trip
+func startTrace(ctx context.Context) (context.Context, *roundTripTrace) {
+	trace := &roundTripTrace{hooks: ContextClientTrace(ctx), start: time.Now()}
+	return context.WithValue(ctx, roundTripTraceKey{}, trace), trace
+}
+
+// traceFrom returns the round trip trace in ctx; the methods of a nil one do
+// nothing
+func traceFrom(ctx context.Context) *roundTripTrace {
+	trace, _ := ctx.Value(roundTripTraceKey{}).(*roundTripTrace)
+	return trace
+}
+
+func (trace *roundTripTrace) dnsStarted(host string) {
+	if trace == nil {
+		return
+	}
+	trace.mu.Lock()
+	trace.dnsStart = time.Now()
+	trace.dnsEnded = false
+	trace.mu.Unlock()
+	if trace.hooks != nil && trace.hooks.DNSStart != nil {
+		trace.hooks.DNSStart(host)
+	}
+}
+
+// dnsDone ends the lookup, if one was started and hasn't ended yet
+func (trace *roundTripTrace) dnsDone(addrs []string, err error) {
+	if trace == nil {
+		return
+	}
+	trace.mu.Lock()
+	pending := !trace.dnsStart.IsZero() && !trace.dnsEnded
+	if pending {
+		trace.timings.DNS = time.Since(trace.dnsStart)
+		trace.dnsEnded = true
+	}
+	trace.mu.Unlock()
+	if pending && trace.hooks != nil && trace.hooks.DNSDone != nil {
+		trace.hooks.DNSDone(addrs, err)
+	}
+}
+
+func (trace *roundTripTrace) connectStarted(addr string) {
+	if trace == nil {
+		return
+	}
+	trace.mu.Lock()
+	if trace.connectStart.IsZero() {
+		trace.connectStart = time.Now()
+	}
+	trace.mu.Unlock()
+	if trace.hooks != nil && trace.hooks.ConnectStart != nil {
+		trace.hooks.ConnectStart(addr)
+	}
+}
+
+func (trace *roundTripTrace) connectDone(addr string, err error) {
+	if trace == nil {
+		return
+	}
+	trace.mu.Lock()
+	if err == nil && !trace.connectStart.IsZero() {
+		trace.timings.Connect = time.Since(trace.connectStart)
+	}
+	trace.mu.Unlock()
+	if trace.hooks != nil && trace.hooks.ConnectDone != nil {
+		trace.hooks.ConnectDone(addr, err)
+	}
+}
+
+func (trace *roundTripTrace) tlsStarted() {
+	if trace == nil {
+		return
+	}
+	trace.mu.Lock()
+	trace.tlsStart = time.Now()
+	trace.mu.Unlock()
+	if trace.hooks != nil && trace.hooks.TLSHandshakeStart != nil {
+		trace.hooks.TLSHandshakeStart()
+	}
+}
+
+func (trace *roundTripTrace) tlsDone(state tls.ConnectionState, err error) {
+	if trace == nil {
+		return
+	}
+	trace.mu.Lock()
+	trace.timings.TLSHandshake = time.Since(trace.tlsStart)
+	trace.mu.Unlock()
+	if trace.hooks != nil && trace.hooks.TLSHandshakeDone != nil {
+		trace.hooks.TLSHandshakeDone(state, err)
+	}
+}
+
+func (trace *roundTripTrace) gotConn(reused bool) {
+	if trace == nil {
+		return
+	}
+	trace.mu.Lock()
+	trace.timings.Reused = reused
+	trace.mu.Unlock()
+	if trace.hooks != nil && trace.hooks.GotConn != nil {
+		trace.hooks.GotConn(reused)
+	}
+}
+
+func (trace *roundTripTrace) wroteRequest(err error) {
+	if trace == nil {
+		return
+	}
+	trace.mu.Lock()
+	trace.wrote = time.Now()
+	trace.mu.Unlock()
+	if trace.hooks != nil && trace.hooks.WroteRequest != nil {
+		trace.hooks.WroteRequest(err)
+	}
+}
+
+func (trace *roundTripTrace) gotFirstByte() {
+	if trace == nil {
+		return
+	}
+	now := time.Now()
+	trace.mu.Lock()
+	if !trace.wrote.IsZero() {
+		trace.timings.Wait = now.Sub(trace.wrote)
+	}
+	trace.timings.TimeToFirstByte = now.Sub(trace.start)
+	trace.mu.Unlock()
+	if trace.hooks != nil && trace.hooks.GotFirstResponseByte != nil {
+		trace.hooks.GotFirstResponseByte()
+	}
+}
+
+// result returns the timings recorded so far
+func (trace *roundTripTrace) result() Timings {
+	if trace == nil {
+		return Timings{}
+	}
+	trace.mu.Lock()
+	defer trace.mu.Unlock()
+	return trace.timings
+}
@@ -0,0 +1,108 @@
+package httpmodule
+
+import (
+	"context"
+	"crypto/tls"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// recordTrace returns a ClientTrace that appends the name of each event to events
+func recordTrace(mu *sync.Mutex, events *[]string) *ClientTrace {
+	record := func(event string) {
+		mu.Lock()
+		*events = append(*events, event)
+		mu.Unlock()
+	}
+	return &ClientTrace{
+		DNSStart:          func(string) { record("DNSStart") },
+		DNSDone:           func([]string, error) { record("DNSDone") },
+		ConnectStart:      func(string) { record("ConnectStart") },
+		ConnectDone:       func(string, error) { record("ConnectDone") },
+		TLSHandshakeStart: func() { record("TLSHandshakeStart") },
+		TLSHandshakeDone:  func(tls.ConnectionState, error) { record("TLSHandshakeDone") },
+		GotConn: func(reused bool) {
+			if reused {
+				record("GotConn reused")
+			} else {
+				record("GotConn")
+			}
+		},
+		WroteRequest:         func(error) { record("WroteRequest") },
+		GotFirstResponseByte: func() { record("GotFirstResponseByte") },
+	}
+}
+
+// TestClientTrace tests the trace hooks and timings of new and reused connections.
+func TestClientTrace(t *testing.T) {
+	_, addr := startServer(t, HandlerFunc(func(w ResponseWriter, req *ServerRequest) {
+		w.Write([]byte("ok"))
+	}))
+	_, port, _ := strings.Cut(addr, ":")
+	client := New()
+
+	var mu sync.Mutex
+	var events []string
+	ctx := WithClientTrace(context.Background(), recordTrace(&mu, &events))
+	req := (&HttpRequest{Method: "GET", URL: "http://localhost:" + port + "/"}).WithContext(ctx)
+
+	response, err := client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := strings.Join(events, ",")
+	want := "DNSStart,DNSDone,ConnectStart,ConnectDone,GotConn,WroteRequest,GotFirstResponseByte"
+	if got != want && got != strings.Replace(want, "ConnectStart", "ConnectStart,ConnectStart", 1) {
+		t.Errorf("Expected events %s, got %s", want, got)
+	}
+	timings := response.Timings
+	if timings.Reused || timings.Connect <= 0 || timings.TimeToFirstByte < timings.Wait || timings.TimeToFirstByte <= 0 {
+		t.Errorf("Expected the timings of a new connection, got %+v", timings)
+	}
+
+	events = nil
+	response, err = client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(events, ","); got != "GotConn reused,WroteRequest,GotFirstResponseByte" {
+		t.Error("Expected the kept-alive connection to be reused, got", got)
+	}
+	if timings := response.Timings; !timings.Reused || timings.DNS != 0 || timings.Connect != 0 || timings.TimeToFirstByte <= 0 {
+		t.Errorf("Expected the timings of a reused connection, got %+v", timings)
+	}
+}
+
+// TestClientTraceTLS tests tracing the TLS handshake over HTTP/1.1 and HTTP/2.
+func TestClientTraceTLS(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	writeTestCert(t, certFile, keyFile, "server", "localhost")
+	addr := startTLSServer(t, HandlerFunc(func(w ResponseWriter, req *ServerRequest) {
+		w.Write([]byte(req.Protocol))
+	}), nil, certFile, keyFile)
+
+	for _, http2 := range []bool{false, true} {
+		client := New()
+		client.HTTP2 = http2
+		client.TLSConfig = &tls.Config{InsecureSkipVerify: true}
+
+		var mu sync.Mutex
+		var events []string
+		ctx := WithClientTrace(context.Background(), recordTrace(&mu, &events))
+		response, err := client.Do((&HttpRequest{Method: "GET", URL: "https://" + addr + "/"}).WithContext(ctx))
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := strings.Join(events, ",")
+		want := "ConnectStart,ConnectDone,TLSHandshakeStart,TLSHandshakeDone,GotConn,WroteRequest,GotFirstResponseByte"
+		if got != want {
+			t.Errorf("Expected events %s over %s, got %s", want, response.Body, got)
+		}
+		if response.Timings.TLSHandshake <= 0 || response.Timings.TimeToFirstByte < response.Timings.TLSHandshake {
+			t.Errorf("Expected the handshake timed over %s, got %+v", response.Body, response.Timings)
+		}
+	}
+}
@@ -0,0 +1,22 @@
+package httpmodule
+
+// Transport sends a single request and returns its response. Setting one on
+// HttpClient replaces the network layer, which lets tests answer requests from
+// memory and lets wrappers observe or alter traffic.
+type Transport interface {
+	RoundTrip(req *HttpRequest) (*HttpResponse, error)
+}
+
+// RoundTripFunc adapts an ordinary function to the Transport interface
+type RoundTripFunc func(req *HttpRequest) (*HttpResponse, error)
+
+func (f RoundTripFunc) RoundTrip(req *HttpRequest) (*HttpResponse, error) {
+	return f(req)
+}
+
+// NetworkTransport returns the transport that sends requests over the network
+// using the client's own connection settings, whatever client.Transport is set
+// to. Wrapping transports use it as the next hop to reach real servers.
+func (client *HttpClient) NetworkTransport() Transport {
+	return RoundTripFunc(client.roundTrip)
+}
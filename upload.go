@@ -0,0 +1,63 @@
+package httpmodule
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// Largest piece of a streamed request body read and sent at once
+const uploadChunkSize = 32 << 10
+
+// bodyStream is a request body read as it is sent. Without a known length it
+// is sent with chunked transfer coding.
+type bodyStream struct {
+	reader io.Reader
+	length int64
+}
+
+func (s *bodyStream) chunked() bool {
+	return s.length <= 0
+}
+
+// writeTo sends the body to w, framed as the request head announced
+func (s *bodyStream) writeTo(w io.Writer) error {
+	if !s.chunked() {
+		n, err := io.CopyN(w, s.reader, s.length)
+		if err == io.EOF {
+			return fmt.Errorf("request body is %d bytes, ContentLength says %d", n, s.length)
+		}
+		return err
+	}
+
+	// Each chunk goes out in a single write: size line, data, and CRLF
+	bw := bufio.NewWriterSize(w, uploadChunkSize+32)
+	data := make([]byte, uploadChunkSize)
+	var size [16]byte
+	for {
+		n, readErr := io.ReadFull(s.reader, data)
+		if n > 0 {
+			bw.Write(strconv.AppendInt(size[:0], int64(n), 16))
+			bw.WriteString("\r\n")
+			bw.Write(data[:n])
+			bw.WriteString("\r\n")
+			if err := bw.Flush(); err != nil {
+				return err
+			}
+		}
+		if readErr == io.EOF || readErr == io.ErrUnexpectedEOF {
+			bw.WriteString("0\r\n\r\n")
+			return bw.Flush()
+		}
+		if readErr != nil {
+			return fmt.Errorf("failed to read request body: %v", readErr)
+		}
+	}
+}
+
+// PostReader sends a POST whose body is streamed from body rather than held
+// in memory. Pass the body's length if known, or zero to send it chunked.
+func (client *HttpClient) PostReader(url string, body io.Reader, length int64, headers map[string]string) (*HttpResponse, error) {
+	return client.Do(&HttpRequest{Method: "POST", URL: url, Headers: headers, BodyReader: body, ContentLength: length})
+}
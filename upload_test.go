@@ -0,0 +1,60 @@
+package httpmodule
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"hash"
+	"io"
+	"strings"
+	"testing"
+)
+
+// TestPostReader tests streaming request bodies of known and unknown length.
+func TestPostReader(t *testing.T) {
+	_, addr := startServer(t, HandlerFunc(func(w ResponseWriter, req *ServerRequest) {
+		body, _ := io.ReadAll(req.Body)
+		if req.Path == "/moved" {
+			w.Header()["Location"] = "/"
+			w.WriteHeader(307)
+			return
+		}
+		fmt.Fprintf(w, "%s|%s|%d|%s", req.Headers["Transfer-Encoding"], req.Headers["Content-Length"], len(body), body[:5])
+	}))
+	client := New()
+	client.HostOverrides = map[string]string{"upload.test": addr}
+	payload := "hello" + strings.Repeat("x", 100<<10)
+
+	response, err := client.PostReader("http://upload.test/", strings.NewReader(payload), 0, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := fmt.Sprintf("chunked||%d|hello", len(payload)); response.Body != want {
+		t.Errorf("Expected a chunked upload, got %q", response.Body)
+	}
+
+	response, err = client.PostReader("http://upload.test/", strings.NewReader(payload), int64(len(payload)), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := fmt.Sprintf("|%d|%d|hello", len(payload), len(payload)); response.Body != want {
+		t.Errorf("Expected an upload with Content-Length, got %q", response.Body)
+	}
+
+	if _, err := client.PostReader("http://upload.test/", strings.NewReader("short"), 10, nil); err == nil {
+		t.Error("Expected a body shorter than its length to fail.")
+	}
+
+	// Hashes see the streamed body, and a redirect that would resend it isn't followed
+	sum := sha256.New()
+	response, err = client.Do(&HttpRequest{Method: "PUT", URL: "http://upload.test/moved", BodyReader: strings.NewReader(payload), BodyHashes: []hash.Hash{sum}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response.StatusCode != 307 {
+		t.Error("Expected the 307 to be returned, got", response.StatusCode)
+	}
+	if want := sha256.Sum256([]byte(payload)); !bytes.Equal(sum.Sum(nil), want[:]) {
+		t.Error("Expected the hash of the streamed body.")
+	}
+}
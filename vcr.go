@@ -0,0 +1,318 @@
+package httpmodule
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// RecorderMode selects whether a Recorder talks to the network
+type RecorderMode int
+
+const (
+	// ModeReplay answers only from the cassette and fails on unknown requests
+	ModeReplay RecorderMode = iota
+
+	// ModeRecord sends every request to the next transport and records it
+	ModeRecord
+
+	// ModeAuto replays when the cassette file exists and records otherwise
+	ModeAuto
+)
+
+// Value recorded in place of redacted header values
+const redactedValue = "REDACTED"
+
+// Headers redacted from cassettes unless the recorder is told otherwise
+var defaultRedactedHeaders = []string{"Authorization", "Proxy-Authorization", "Cookie", "Set-Cookie"}
+
+// isSecretHeader reports whether key is one of the headers masked by default
+func isSecretHeader(key string) bool {
+	for _, name := range defaultRedactedHeaders {
+		if strings.EqualFold(key, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// Cassette is the on-disk record of a series of exchanges
+type Cassette struct {
+	Interactions []Interaction `json:"interactions"`
+}
+
+type Interaction struct {
+	Request  RecordedRequest  `json:"request"`
+	Response RecordedResponse `json:"response"`
+}
+
+type RecordedRequest struct {
+	Method  string            `json:"method"`
+	URL     string            `json:"url"`
+	Headers map[string]string `json:"headers,omitempty"`
+	Body    string            `json:"body,omitempty"`
+}
+
+type RecordedResponse struct {
+	Protocol   string            `json:"protocol"`
+	StatusCode int               `json:"status_code"`
+	Status     string            `json:"status"`
+	Headers    map[string]string `json:"headers,omitempty"`
+	Body       string            `json:"body,omitempty"`
+}
+
+// Recorder is a Transport that records real exchanges to a JSON cassette and
+// replays them later without touching the network. In replay mode requests are
+// matched on method, URL, and body, and each recorded interaction is used once,
+// in order, so repeated identical requests replay their responses in sequence.
+// A cassette path ending in .har is read and written as an HTTP Archive
+// instead, so recordings open in browser tools and captures exported from a
+// browser can be replayed, and one ending in .yaml or .yml is kept as YAML,
+// with bodies of several lines written as blocks that read well in review.
+type Recorder struct {
+	// Header names whose values are replaced before anything is written to the
+	// cassette. Matching is case-insensitive.
+	RedactHeaders []string
+
+	// Builds the matcher a live request must satisfy to replay recorded; nil
+	// matches on method, URL, and body
+	MatchOn func(recorded RecordedRequest) Matcher
+
+	path      string
+	recording bool
+	next      Transport
+
+	mu       sync.Mutex
+	cassette Cassette
+	used     []bool
+}
+
+// NewRecorder returns a recorder for the cassette at path. In replay mode, and
+// in auto mode when the file exists, the cassette is loaded right away. next is
+// the transport used while recording, normally client.NetworkTransport().
+func NewRecorder(path string, mode RecorderMode, next Transport) (*Recorder, error) {
+	recorder := &Recorder{
+		RedactHeaders: append([]string(nil), defaultRedactedHeaders...),
+		path:          path,
+		next:          next,
+	}
+
+	switch mode {
+	case ModeRecord:
+		recorder.recording = true
+	case ModeAuto:
+		_, err := os.Stat(path)
+		if errors.Is(err, os.ErrNotExist) {
+			recorder.recording = true
+		} else if err != nil {
+			return nil, err
+		}
+	}
+	if recorder.recording {
+		return recorder, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read cassette: %v", err)
+	}
+	if isHARPath(path) {
+		har, err := ReadHAR(bytes.NewReader(data))
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse cassette %s: %v", path, err)
+		}
+		if recorder.cassette, err = cassetteFromHAR(har); err != nil {
+			return nil, err
+		}
+	} else if isYAMLPath(path) {
+		if recorder.cassette, err = readYAMLCassette(data); err != nil {
+			return nil, fmt.Errorf("failed to parse cassette %s: %v", path, err)
+		}
+	} else if err := json.Unmarshal(data, &recorder.cassette); err != nil {
+		return nil, fmt.Errorf("failed to parse cassette %s: %v", path, err)
+	}
+	recorder.used = make([]bool, len(recorder.cassette.Interactions))
+	return recorder, nil
+}
+
+// Recording reports whether the recorder is sending requests to the network
+func (recorder *Recorder) Recording() bool {
+	return recorder.recording
+}
+
+func (recorder *Recorder) RoundTrip(req *HttpRequest) (*HttpResponse, error) {
+	if recorder.recording {
+		return recorder.record(req)
+	}
+	return recorder.replay(req)
+}
+
+func (recorder *Recorder) record(req *HttpRequest) (*HttpResponse, error) {
+	response, err := recorder.next.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	// The whole body is needed for the cassette
+	if _, err := response.ReadBody(); err != nil {
+		return nil, err
+	}
+
+	interaction := Interaction{
+		Request: RecordedRequest{
+			Method:  req.Method,
+			URL:     req.URL,
+			Headers: recorder.redact(req.Headers),
+			Body:    req.Body,
+		},
+		Response: RecordedResponse{
+			Protocol:   response.Protocol,
+			StatusCode: response.StatusCode,
+			Status:     response.Status,
+			Headers:    recorder.redact(response.Headers),
+			Body:       response.Body,
+		},
+	}
+	recorder.mu.Lock()
+	recorder.cassette.Interactions = append(recorder.cassette.Interactions, interaction)
+	recorder.mu.Unlock()
+	return response, nil
+}
+
+func (recorder *Recorder) replay(req *HttpRequest) (*HttpResponse, error) {
+	recorder.mu.Lock()
+	defer recorder.mu.Unlock()
+
+	for i, interaction := range recorder.cassette.Interactions {
+		if recorder.used[i] || !recorder.matcherFor(interaction.Request).Match(req) {
+			continue
+		}
+		recorder.used[i] = true
+
+		headers := make(map[string]string, len(interaction.Response.Headers))
+		for k, v := range interaction.Response.Headers {
+			headers[k] = v
+		}
+		return &HttpResponse{
+			Protocol:   interaction.Response.Protocol,
+			StatusCode: interaction.Response.StatusCode,
+			Status:     interaction.Response.Status,
+			Headers:    headers,
+			Body:       interaction.Response.Body,
+		}, nil
+	}
+	return nil, fmt.Errorf("cassette %s has no interaction for %s %s", recorder.path, req.Method, req.URL)
+}
+
+// matcherFor returns the matcher live requests are compared to recorded with
+func (recorder *Recorder) matcherFor(recorded RecordedRequest) Matcher {
+	if recorder.MatchOn != nil {
+		return recorder.MatchOn(recorded)
+	}
+	return MatcherFunc(func(req *HttpRequest) bool {
+		return recorded.Method == req.Method && recorded.URL == req.URL && recorded.Body == req.Body
+	})
+}
+
+// redact returns a copy of headers with the values of RedactHeaders replaced
+func (recorder *Recorder) redact(headers map[string]string) map[string]string {
+	if len(headers) == 0 {
+		return nil
+	}
+	redacted := make(map[string]string, len(headers))
+	for k, v := range headers {
+		redacted[k] = v
+		for _, name := range recorder.RedactHeaders {
+			if strings.EqualFold(k, name) {
+				redacted[k] = redactedValue
+				break
+			}
+		}
+	}
+	return redacted
+}
+
+// Save writes the recorded interactions to the cassette file. It does nothing
+// when replaying.
+func (recorder *Recorder) Save() error {
+	if !recorder.recording {
+		return nil
+	}
+	recorder.mu.Lock()
+	if isYAMLPath(recorder.path) {
+		data := recorder.cassette.yaml()
+		recorder.mu.Unlock()
+		return os.WriteFile(recorder.path, data, 0o644)
+	}
+	var document any = recorder.cassette
+	if isHARPath(recorder.path) {
+		document = recorder.cassette.har()
+	}
+	data, err := json.MarshalIndent(document, "", "  ")
+	recorder.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(recorder.path, append(data, '\n'), 0o644)
+}
+
+// isHARPath reports whether the cassette at path is kept as a HAR file
+func isHARPath(path string) bool {
+	return strings.EqualFold(filepath.Ext(path), ".har")
+}
+
+// har converts the cassette to an HTTP Archive. Timings aren't recorded, so
+// entries carry none, which keeps the file the same from one run to the next.
+func (cassette Cassette) har() *HAR {
+	entries := make([]HAREntry, len(cassette.Interactions))
+	for i, interaction := range cassette.Interactions {
+		entries[i] = HAREntry{
+			Request: harRequest(&HttpRequest{
+				Method:  interaction.Request.Method,
+				URL:     interaction.Request.URL,
+				Headers: interaction.Request.Headers,
+				Body:    interaction.Request.Body,
+			}),
+			Response: harResponse(&HttpResponse{
+				Protocol:   interaction.Response.Protocol,
+				StatusCode: interaction.Response.StatusCode,
+				Status:     interaction.Response.Status,
+				Headers:    interaction.Response.Headers,
+				Body:       interaction.Response.Body,
+			}),
+			Timings: HARTimings{Blocked: -1, DNS: -1, Connect: -1, SSL: -1},
+		}
+	}
+	return &HAR{Log: HARLog{
+		Version: "1.2",
+		Creator: HARCreator{Name: "httpmodule", Version: "1.0"},
+		Entries: entries,
+	}}
+}
+
+// cassetteFromHAR converts the entries of har to interactions
+func cassetteFromHAR(har *HAR) (Cassette, error) {
+	responses, err := har.Responses()
+	if err != nil {
+		return Cassette{}, err
+	}
+	var cassette Cassette
+	for i, req := range har.Requests() {
+		response := responses[i]
+		cassette.Interactions = append(cassette.Interactions, Interaction{
+			Request: RecordedRequest{Method: req.Method, URL: req.URL, Headers: req.Headers, Body: req.Body},
+			Response: RecordedResponse{
+				Protocol:   response.Protocol,
+				StatusCode: response.StatusCode,
+				Status:     response.Status,
+				Headers:    response.Headers,
+				Body:       response.Body,
+			},
+		})
+	}
+	return cassette, nil
+}
@@ -0,0 +1,204 @@
+package httpmodule
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// TestRecorderRoundTrip tests recording a cassette and replaying it.
+func TestRecorderRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cassette.json")
+
+	mock := NewMockTransport(t)
+	mock.On("GET", `/profile$`).Respond(200, "first").RespondHeader("Set-Cookie", "session=secret")
+
+	recorder, err := NewRecorder(path, ModeAuto, mock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !recorder.Recording() {
+		t.Fatal("Expected auto mode to record when the cassette is missing.")
+	}
+	client := New()
+	client.Transport = recorder
+	if _, err := client.Get("https://example.com/profile", map[string]string{"Authorization": "Bearer secret"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := recorder.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	data, _ := os.ReadFile(path)
+	if strings.Contains(string(data), "secret") {
+		t.Error("Expected secrets to be redacted from the cassette.", string(data))
+	}
+
+	// Replay without any transport behind the recorder
+	replayer, err := NewRecorder(path, ModeAuto, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if replayer.Recording() {
+		t.Fatal("Expected auto mode to replay an existing cassette.")
+	}
+	client.Transport = replayer
+	response, err := client.Get("https://example.com/profile", nil)
+	if err != nil || response.Body != "first" || response.Headers["Set-Cookie"] != "REDACTED" {
+		t.Error("Expected the recorded response.", response, err)
+	}
+
+	// Each interaction is replayed once
+	if _, err := client.Get("https://example.com/profile", nil); err == nil {
+		t.Error("Expected an error once the cassette is used up.")
+	}
+}
+
+// TestRecorderMatchOn tests replaying with a custom matcher.
+func TestRecorderMatchOn(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cassette.json")
+
+	mock := NewMockTransport(t)
+	mock.On("GET", `/search`).Respond(200, "results")
+	recorder, err := NewRecorder(path, ModeRecord, mock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := New()
+	client.Transport = recorder
+	if _, err := client.Get("https://example.com/search?q=go&nonce=1", nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := recorder.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Ignore the nonce by matching on the path and search term only
+	replayer, err := NewRecorder(path, ModeReplay, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	replayer.MatchOn = func(recorded RecordedRequest) Matcher {
+		return And(MatchMethod(recorded.Method), MatchPath(`^/search$`), MatchQuery("q", "go"))
+	}
+	client.Transport = replayer
+	response, err := client.Get("https://example.com/search?q=go&nonce=2", nil)
+	if err != nil || response.Body != "results" {
+		t.Error("Expected the recorded response.", response, err)
+	}
+}
+
+// TestRecorderHAR tests keeping a cassette as a HAR file.
+func TestRecorderHAR(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "session.har")
+
+	mock := NewMockTransport(t)
+	mock.On("POST", `/items$`).Respond(201, "created").RespondHeader("Content-Type", "text/plain")
+	recorder, err := NewRecorder(path, ModeRecord, mock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := New()
+	client.Transport = recorder
+	if _, err := client.Post("https://example.com/items", "new item", map[string]string{"Authorization": "Bearer secret"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := recorder.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	har, err := LoadHAR(path)
+	if err != nil || len(har.Log.Entries) != 1 || har.Log.Entries[0].Response.Status != 201 {
+		t.Fatal("Expected a HAR with the exchange, got", har, err)
+	}
+	if data, _ := os.ReadFile(path); strings.Contains(string(data), "secret") {
+		t.Error("Expected secrets to be redacted from the HAR.", string(data))
+	}
+
+	replayer, err := NewRecorder(path, ModeReplay, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.Transport = replayer
+	response, err := client.Post("https://example.com/items", "new item", nil)
+	if err != nil || response.StatusCode != 201 || response.Body != "created" || response.Headers["Content-Type"] != "text/plain" {
+		t.Error("Expected the response replayed from the HAR.", response, err)
+	}
+}
+
+// TestRecorderYAML tests recording to and replaying from a YAML cassette,
+// including one written by hand.
+func TestRecorderYAML(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "session.yaml")
+
+	mock := NewMockTransport(t)
+	mock.On("POST", `/items$`).Respond(201, "line one\nline two\n").RespondHeader("Content-Type", "text/plain")
+	mock.On("GET", `/odd$`).Respond(200, "  \"quoted\"\r\n\ttab: #not a comment\x01 ")
+	recorder, err := NewRecorder(path, ModeRecord, mock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := New()
+	client.Transport = recorder
+	if _, err := client.Post("https://example.com/items", "new item", map[string]string{"Authorization": "Bearer secret"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.Get("https://example.com/odd", nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := recorder.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	data, _ := os.ReadFile(path)
+	if strings.Contains(string(data), "secret") || !strings.HasPrefix(string(data), "interactions:\n") {
+		t.Error("Expected a redacted YAML cassette.", string(data))
+	}
+	if !strings.Contains(string(data), "body: |\n        line one\n        line two\n") {
+		t.Error("Expected a body of several lines written as a block.", string(data))
+	}
+	replayer, err := NewRecorder(path, ModeReplay, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(replayer.cassette, recorder.cassette) {
+		t.Errorf("Expected the cassette back as recorded.\ngot:  %#v\nwant: %#v", replayer.cassette, recorder.cassette)
+	}
+	client.Transport = replayer
+	response, err := client.Post("https://example.com/items", "new item", nil)
+	if err != nil || response.StatusCode != 201 || response.Body != "line one\nline two\n" || response.Headers["Content-Type"] != "text/plain" {
+		t.Error("Expected the response replayed from the YAML cassette.", response, err)
+	}
+
+	path = filepath.Join(t.TempDir(), "handwritten.yml")
+	os.WriteFile(path, []byte(`# Written by hand
+interactions:
+- request:
+    method: GET
+    url: 'https://example.com/hello'
+  response:
+    status_code: 200
+    status: 200 OK
+    headers:
+      Content-Type: application/json  # a comment
+    body: >-
+      {"greeting":
+      "hello"}
+`), 0o644)
+	replayer, err = NewRecorder(path, ModeReplay, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.Transport = replayer
+	response, err = client.Get("https://example.com/hello", nil)
+	if err != nil || response.StatusCode != 200 || response.Body != `{"greeting": "hello"}` || response.Headers["Content-Type"] != "application/json" {
+		t.Error("Expected the response replayed from the hand-written cassette.", response, err)
+	}
+
+	os.WriteFile(path, []byte("interactions:\n  - request: {method: GET}\n"), 0o644)
+	if _, err := NewRecorder(path, ModeReplay, nil); err == nil {
+		t.Error("Expected unsupported YAML to be rejected.")
+	}
+}
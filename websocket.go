@@ -0,0 +1,435 @@
+package httpmodule
+
+import (
+	"bufio"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	neturl "net/url"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// GUID appended to the client's key to prove the server understood the handshake
+const websocketGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+// Largest message a WebSocketConn reads when no limit is set
+const defaultMaxMessageSize = 32 << 20
+
+// MessageType is the kind of data a WebSocket message carries
+type MessageType int
+
+const (
+	TextMessage   MessageType = 1
+	BinaryMessage MessageType = 2
+)
+
+// Frame opcodes of RFC 6455
+const (
+	opContinuation = 0
+	opText         = 1
+	opBinary       = 2
+	opClose        = 8
+	opPing         = 9
+	opPong         = 10
+)
+
+// Close codes of RFC 6455
+const (
+	CloseNormal          = 1000
+	CloseGoingAway       = 1001
+	CloseProtocolError   = 1002
+	CloseUnsupportedData = 1003
+	CloseNoStatus        = 1005
+	CloseInvalidPayload  = 1007
+	CloseMessageTooBig   = 1009
+)
+
+// WebSocketCloseError is returned by ReadMessage once the peer has closed the
+// connection, with the code and reason it gave
+type WebSocketCloseError struct {
+	Code   int
+	Reason string
+}
+
+func (e *WebSocketCloseError) Error() string {
+	if e.Reason == "" {
+		return fmt.Sprintf("websocket closed: %d", e.Code)
+	}
+	return fmt.Sprintf("websocket closed: %d %s", e.Code, e.Reason)
+}
+
+// WebSocketUpgrader turns HTTP requests into WebSocket connections on the
+// server side
+type WebSocketUpgrader struct {
+	// Subprotocols the server speaks, in order of preference
+	Subprotocols []string
+
+	// Decides whether to accept a request given its Origin header; nil
+	// accepts requests without one and those whose origin is the host asked for
+	CheckOrigin func(req *ServerRequest) bool
+
+	// Largest message accepted; zero means 32 MB
+	MaxMessageSize int64
+}
+
+// Upgrade completes the WebSocket handshake for req and takes the connection
+// over from the server. If the request isn't a valid handshake, it answers
+// with an error status and returns an error.
+func (u *WebSocketUpgrader) Upgrade(w ResponseWriter, req *ServerRequest) (*WebSocketConn, error) {
+	fail := func(status int, msg string) (*WebSocketConn, error) {
+		w.Header()["Content-Type"] = "text/plain; charset=utf-8"
+		w.WriteHeader(status)
+		io.WriteString(w, msg)
+		return nil, errors.New("websocket: " + msg)
+	}
+
+	if req.Method != "GET" {
+		return fail(405, "handshake must be a GET request")
+	}
+	if !headerContainsToken(req.Headers, "Connection", "upgrade") || !headerContainsToken(req.Headers, "Upgrade", "websocket") {
+		return fail(400, "not a websocket handshake")
+	}
+	if headerValue(req.Headers, "Sec-WebSocket-Version") != "13" {
+		w.Header()["Sec-WebSocket-Version"] = "13"
+		return fail(426, "unsupported websocket version")
+	}
+	key := headerValue(req.Headers, "Sec-WebSocket-Key")
+	if decoded, err := base64.StdEncoding.DecodeString(key); err != nil || len(decoded) != 16 {
+		return fail(400, "malformed Sec-WebSocket-Key")
+	}
+	checkOrigin := u.CheckOrigin
+	if checkOrigin == nil {
+		checkOrigin = sameOrigin
+	}
+	if !checkOrigin(req) {
+		return fail(403, "origin not allowed")
+	}
+
+	hijacker, ok := w.(Hijacker)
+	if !ok {
+		return fail(500, "response does not support hijacking")
+	}
+	subprotocol := u.selectSubprotocol(headerValue(req.Headers, "Sec-WebSocket-Protocol"))
+
+	conn, rw, err := hijacker.Hijack()
+	if err != nil {
+		return nil, err
+	}
+	var b strings.Builder
+	b.WriteString("HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n")
+	b.WriteString("Sec-WebSocket-Accept: " + websocketAccept(key) + "\r\n")
+	if subprotocol != "" {
+		b.WriteString("Sec-WebSocket-Protocol: " + subprotocol + "\r\n")
+	}
+	b.WriteString("\r\n")
+	if _, err := io.WriteString(conn, b.String()); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	ws := newWebSocketConn(conn, rw.Reader, false)
+	ws.Subprotocol = subprotocol
+	if u.MaxMessageSize > 0 {
+		ws.MaxMessageSize = u.MaxMessageSize
+	}
+	return ws, nil
+}
+
+func (u *WebSocketUpgrader) selectSubprotocol(offered string) string {
+	for _, supported := range u.Subprotocols {
+		for _, candidate := range strings.Split(offered, ",") {
+			if strings.TrimSpace(candidate) == supported {
+				return supported
+			}
+		}
+	}
+	return ""
+}
+
+// sameOrigin accepts requests without an Origin or from the host they are for
+func sameOrigin(req *ServerRequest) bool {
+	origin := headerValue(req.Headers, "Origin")
+	if origin == "" {
+		return true
+	}
+	parsedURL, err := neturl.Parse(origin)
+	return err == nil && strings.EqualFold(parsedURL.Host, req.Host)
+}
+
+// websocketAccept is the Sec-WebSocket-Accept value for key
+func websocketAccept(key string) string {
+	sum := sha1.Sum([]byte(key + websocketGUID))
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
+
+// WebSocketConn is an open WebSocket connection. One goroutine may read while
+// others write; pings are answered and close frames acknowledged as part of
+// reading, so a connection needs a reader for its whole life.
+type WebSocketConn struct {
+	// Subprotocol agreed in the handshake, if any
+	Subprotocol string
+
+	// Largest message ReadMessage accepts before closing the connection
+	MaxMessageSize int64
+
+	conn   net.Conn
+	reader *bufio.Reader
+
+	// Clients mask what they send and expect unmasked frames; servers the reverse
+	client bool
+
+	writeMu    sync.Mutex
+	closeSent  bool
+	readClosed error
+}
+
+func newWebSocketConn(conn net.Conn, reader *bufio.Reader, client bool) *WebSocketConn {
+	if reader == nil {
+		reader = bufio.NewReader(conn)
+	}
+	return &WebSocketConn{conn: conn, reader: reader, client: client, MaxMessageSize: defaultMaxMessageSize}
+}
+
+// ReadMessage returns the next complete message, reassembling fragments.
+// Once the peer closes, it returns a *WebSocketCloseError.
+func (ws *WebSocketConn) ReadMessage() (MessageType, []byte, error) {
+	if ws.readClosed != nil {
+		return 0, nil, ws.readClosed
+	}
+	var messageType MessageType
+	var message []byte
+	for {
+		fin, opcode, payload, err := ws.readFrame()
+		if err != nil {
+			return 0, nil, ws.failRead(err)
+		}
+
+		switch opcode {
+		case opPing:
+			if err := ws.writeFrame(opPong, payload); err != nil {
+				return 0, nil, err
+			}
+			continue
+		case opPong:
+			continue
+		case opClose:
+			// A close payload is empty or starts with a two-byte code
+			if len(payload) == 1 {
+				return 0, nil, ws.failRead(&WebSocketCloseError{Code: CloseProtocolError, Reason: "malformed close frame"})
+			}
+			closeErr := &WebSocketCloseError{Code: CloseNoStatus}
+			if len(payload) >= 2 {
+				closeErr.Code = int(binary.BigEndian.Uint16(payload))
+				closeErr.Reason = string(payload[2:])
+			}
+			ws.readClosed = closeErr
+			ws.Close(closeErr.Code, "")
+			return 0, nil, closeErr
+		case opText, opBinary:
+			if messageType != 0 {
+				return 0, nil, ws.failRead(&WebSocketCloseError{Code: CloseProtocolError, Reason: "expected a continuation frame"})
+			}
+			messageType = MessageType(opcode)
+		case opContinuation:
+			if messageType == 0 {
+				return 0, nil, ws.failRead(&WebSocketCloseError{Code: CloseProtocolError, Reason: "unexpected continuation frame"})
+			}
+		default:
+			return 0, nil, ws.failRead(&WebSocketCloseError{Code: CloseProtocolError, Reason: "unknown opcode"})
+		}
+
+		if int64(len(message))+int64(len(payload)) > ws.MaxMessageSize {
+			return 0, nil, ws.failRead(&WebSocketCloseError{Code: CloseMessageTooBig, Reason: "message too big"})
+		}
+		message = append(message, payload...)
+		if !fin {
+			continue
+		}
+		if messageType == TextMessage && !utf8.Valid(message) {
+			return 0, nil, ws.failRead(&WebSocketCloseError{Code: CloseInvalidPayload, Reason: "invalid UTF-8"})
+		}
+		return messageType, message, nil
+	}
+}
+
+// failRead closes the connection after a read error, telling the peer why if
+// the error was its fault
+func (ws *WebSocketConn) failRead(err error) error {
+	var closeErr *WebSocketCloseError
+	if errors.As(err, &closeErr) {
+		ws.Close(closeErr.Code, closeErr.Reason)
+	} else {
+		ws.conn.Close()
+	}
+	ws.readClosed = err
+	return err
+}
+
+// readFrame reads one frame, unmasking its payload
+func (ws *WebSocketConn) readFrame() (fin bool, opcode byte, payload []byte, err error) {
+	var head [2]byte
+	if _, err := io.ReadFull(ws.reader, head[:]); err != nil {
+		return false, 0, nil, err
+	}
+	fin = head[0]&0x80 != 0
+	opcode = head[0] & 0x0f
+	masked := head[1]&0x80 != 0
+	length := int64(head[1] & 0x7f)
+
+	if head[0]&0x70 != 0 {
+		return false, 0, nil, &WebSocketCloseError{Code: CloseProtocolError, Reason: "reserved bits set"}
+	}
+	if masked == ws.client {
+		return false, 0, nil, &WebSocketCloseError{Code: CloseProtocolError, Reason: "wrong masking"}
+	}
+	isControl := opcode >= opClose
+	if isControl && (!fin || length > 125) {
+		return false, 0, nil, &WebSocketCloseError{Code: CloseProtocolError, Reason: "malformed control frame"}
+	}
+
+	switch length {
+	case 126:
+		var ext [2]byte
+		if _, err := io.ReadFull(ws.reader, ext[:]); err != nil {
+			return false, 0, nil, err
+		}
+		length = int64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		if _, err := io.ReadFull(ws.reader, ext[:]); err != nil {
+			return false, 0, nil, err
+		}
+		length = int64(binary.BigEndian.Uint64(ext[:]))
+		if length < 0 {
+			return false, 0, nil, &WebSocketCloseError{Code: CloseProtocolError, Reason: "malformed length"}
+		}
+	}
+	if length > ws.MaxMessageSize {
+		return false, 0, nil, &WebSocketCloseError{Code: CloseMessageTooBig, Reason: "message too big"}
+	}
+
+	var mask [4]byte
+	if masked {
+		if _, err := io.ReadFull(ws.reader, mask[:]); err != nil {
+			return false, 0, nil, err
+		}
+	}
+	payload = make([]byte, length)
+	if _, err := io.ReadFull(ws.reader, payload); err != nil {
+		return false, 0, nil, err
+	}
+	if masked {
+		maskBytes(mask, payload)
+	}
+	return fin, opcode, payload, nil
+}
+
+// WriteMessage sends data as a single message
+func (ws *WebSocketConn) WriteMessage(messageType MessageType, data []byte) error {
+	if messageType != TextMessage && messageType != BinaryMessage {
+		return errors.New("websocket: unknown message type")
+	}
+	return ws.writeFrame(byte(messageType), data)
+}
+
+// Ping sends a ping, which the peer answers with a pong carrying data
+func (ws *WebSocketConn) Ping(data []byte) error {
+	if len(data) > 125 {
+		return errors.New("websocket: ping payload too long")
+	}
+	return ws.writeFrame(opPing, data)
+}
+
+// Close sends a close frame with code and reason, unless one was sent
+// already, and closes the connection
+func (ws *WebSocketConn) Close(code int, reason string) error {
+	ws.writeMu.Lock()
+	sent := ws.closeSent
+	ws.writeMu.Unlock()
+
+	var err error
+	if !sent {
+		// 1005 stands for a close frame with no code, so it is never sent
+		var payload []byte
+		if code != CloseNoStatus {
+			payload = make([]byte, 2, 2+len(reason))
+			binary.BigEndian.PutUint16(payload, uint16(code))
+			payload = append(payload, reason...)
+			// A reason too long for a control frame is cut short, on a
+			// rune boundary so it stays valid UTF-8
+			if len(payload) > 125 {
+				end := 125
+				for end > 2 && !utf8.RuneStart(payload[end]) {
+					end--
+				}
+				payload = payload[:end]
+			}
+		}
+		err = ws.writeFrame(opClose, payload)
+	}
+	ws.writeMu.Lock()
+	ws.closeSent = true
+	ws.writeMu.Unlock()
+	if cerr := ws.conn.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// writeFrame sends a single unfragmented frame
+func (ws *WebSocketConn) writeFrame(opcode byte, payload []byte) error {
+	ws.writeMu.Lock()
+	defer ws.writeMu.Unlock()
+	if ws.closeSent {
+		return errors.New("websocket: connection closed")
+	}
+
+	frame := make([]byte, 0, 14+len(payload))
+	frame = append(frame, 0x80|opcode)
+	maskBit := byte(0)
+	if ws.client {
+		maskBit = 0x80
+	}
+	switch {
+	case len(payload) <= 125:
+		frame = append(frame, maskBit|byte(len(payload)))
+	case len(payload) <= 0xffff:
+		frame = append(frame, maskBit|126)
+		frame = binary.BigEndian.AppendUint16(frame, uint16(len(payload)))
+	default:
+		frame = append(frame, maskBit|127)
+		frame = binary.BigEndian.AppendUint64(frame, uint64(len(payload)))
+	}
+	if ws.client {
+		var mask [4]byte
+		if _, err := rand.Read(mask[:]); err != nil {
+			return err
+		}
+		frame = append(frame, mask[:]...)
+		start := len(frame)
+		frame = append(frame, payload...)
+		maskBytes(mask, frame[start:])
+	} else {
+		frame = append(frame, payload...)
+	}
+
+	if opcode == opClose {
+		ws.closeSent = true
+	}
+	_, err := ws.conn.Write(frame)
+	return err
+}
+
+// maskBytes applies the masking of RFC 6455 section 5.3, which is its own inverse
+func maskBytes(mask [4]byte, b []byte) {
+	for i := range b {
+		b[i] ^= mask[i&3]
+	}
+}
@@ -0,0 +1,183 @@
+package httpmodule
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Handshake from RFC 6455 section 1.3
+const testHandshake = "GET /chat HTTP/1.1\r\nHost: server.example.com\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n" +
+	"Sec-WebSocket-Key: dGhlIHNhbXBsZSBub25jZQ==\r\nSec-WebSocket-Version: 13\r\nSec-WebSocket-Protocol: chat, superchat\r\n\r\n"
+
+// startWebSocketServer serves an upgrader that echoes every message back.
+func startWebSocketServer(t *testing.T) string {
+	upgrader := &WebSocketUpgrader{Subprotocols: []string{"superchat"}, MaxMessageSize: 1 << 20}
+	_, addr := startServer(t, HandlerFunc(func(w ResponseWriter, req *ServerRequest) {
+		ws, err := upgrader.Upgrade(w, req)
+		if err != nil {
+			return
+		}
+		for {
+			messageType, data, err := ws.ReadMessage()
+			if err != nil {
+				return
+			}
+			ws.WriteMessage(messageType, data)
+		}
+	}))
+	return addr
+}
+
+// dialWebSocket performs the handshake with the server at addr and returns
+// the client end along with the response head.
+func dialWebSocket(t *testing.T, addr string) (*WebSocketConn, string) {
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	io.WriteString(conn, testHandshake)
+
+	reader := bufio.NewReader(conn)
+	var head strings.Builder
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			t.Fatal(err)
+		}
+		head.WriteString(line)
+		if line == "\r\n" {
+			break
+		}
+	}
+	return newWebSocketConn(conn, reader, true), head.String()
+}
+
+// TestWebSocketHandshake tests the handshake of RFC 6455.
+func TestWebSocketHandshake(t *testing.T) {
+	addr := startWebSocketServer(t)
+	_, head := dialWebSocket(t, addr)
+	for _, want := range []string{"HTTP/1.1 101 Switching Protocols\r\n", "Sec-WebSocket-Accept: s3pPLMBiTxaQ9kYGzzhZRbK+xOo=\r\n", "Sec-WebSocket-Protocol: superchat\r\n"} {
+		if !strings.Contains(head, want) {
+			t.Errorf("Expected %q in the response, got %s", want, head)
+		}
+	}
+
+	tests := []struct {
+		name, from, to, status string
+	}{
+		{"not an upgrade", "Upgrade: websocket\r\n", "", "400"},
+		{"old version", "Version: 13", "Version: 8", "426"},
+		{"bad key", "dGhlIHNhbXBsZSBub25jZQ==", "c2hvcnQ=", "400"},
+		{"foreign origin", "Host: server.example.com\r\n", "Host: server.example.com\r\nOrigin: https://evil.example\r\n", "403"},
+		{"post", "GET /chat", "POST /chat", "405"},
+	}
+	for _, test := range tests {
+		raw := strings.Replace(testHandshake, "Connection: Upgrade", "Connection: Upgrade, close", 1)
+		raw = strings.Replace(raw, test.from, test.to, 1)
+		if got := rawExchange(t, addr, raw); !strings.HasPrefix(got, "HTTP/1.1 "+test.status+" ") {
+			t.Errorf("%s: expected %s, got %s", test.name, test.status, got)
+		}
+	}
+}
+
+// TestWebSocketMessages tests exchanging messages of each length encoding.
+func TestWebSocketMessages(t *testing.T) {
+	ws, _ := dialWebSocket(t, startWebSocketServer(t))
+	messages := []struct {
+		messageType MessageType
+		data        []byte
+	}{
+		{TextMessage, []byte("hello")},
+		{BinaryMessage, bytes.Repeat([]byte{0xff}, 300)},
+		{TextMessage, bytes.Repeat([]byte("x"), 70000)},
+	}
+	for _, message := range messages {
+		if err := ws.WriteMessage(message.messageType, message.data); err != nil {
+			t.Fatal(err)
+		}
+		messageType, data, err := ws.ReadMessage()
+		if err != nil || messageType != message.messageType || !bytes.Equal(data, message.data) {
+			t.Errorf("Expected the %d byte message echoed, got %d %d bytes %v.", len(message.data), messageType, len(data), err)
+		}
+	}
+
+	if err := ws.Close(CloseNormal, "bye"); err != nil {
+		t.Error("Expected a clean close, got", err)
+	}
+}
+
+// TestWebSocketFrames tests fragmentation, control frames, and protocol errors.
+func TestWebSocketFrames(t *testing.T) {
+	ws, _ := dialWebSocket(t, startWebSocketServer(t))
+	masked := func(head byte, payload string) []byte {
+		frame := []byte{head, 0x80 | byte(len(payload)), 1, 2, 3, 4}
+		data := []byte(payload)
+		maskBytes([4]byte{1, 2, 3, 4}, data)
+		return append(frame, data...)
+	}
+
+	// A fragmented message with a ping in the middle
+	var frames []byte
+	frames = append(frames, masked(0x01, "frag")...)
+	frames = append(frames, masked(0x89, "are you there")...)
+	frames = append(frames, masked(0x80, "mented")...)
+	ws.conn.Write(frames)
+
+	fin, opcode, payload, err := ws.readFrame()
+	if err != nil || !fin || opcode != opPong || string(payload) != "are you there" {
+		t.Error("Expected a pong for the ping, got", opcode, string(payload), err)
+	}
+	if _, data, err := ws.ReadMessage(); err != nil || string(data) != "fragmented" {
+		t.Error("Expected the reassembled message, got", string(data), err)
+	}
+
+	// Unmasked frames from a client are a protocol error
+	ws.conn.Write([]byte{0x81, 0x02, 'h', 'i'})
+	_, _, err = ws.ReadMessage()
+	var closeErr *WebSocketCloseError
+	if !errors.As(err, &closeErr) || closeErr.Code != CloseProtocolError {
+		t.Error("Expected the server to close with a protocol error, got", err)
+	}
+}
+
+// TestWebSocketInvalidText tests that text messages must be UTF-8.
+func TestWebSocketInvalidText(t *testing.T) {
+	ws, _ := dialWebSocket(t, startWebSocketServer(t))
+	ws.WriteMessage(TextMessage, []byte{0xff, 0xfe})
+	_, _, err := ws.ReadMessage()
+	var closeErr *WebSocketCloseError
+	if !errors.As(err, &closeErr) || closeErr.Code != CloseInvalidPayload {
+		t.Error("Expected the server to close with 1007, got", err)
+	}
+}
+
+// TestWebSocketClose tests malformed close frames and long close reasons.
+func TestWebSocketClose(t *testing.T) {
+	// A close payload of a single byte can't hold a code
+	ws, _ := dialWebSocket(t, startWebSocketServer(t))
+	ws.conn.Write([]byte{0x88, 0x81, 1, 2, 3, 4, 0x03 ^ 1})
+	_, _, err := ws.ReadMessage()
+	var closeErr *WebSocketCloseError
+	if !errors.As(err, &closeErr) || closeErr.Code != CloseProtocolError {
+		t.Error("Expected the server to close with a protocol error, got", err)
+	}
+
+	// A reason cut to fit the frame loses whole runes only
+	client, server := net.Pipe()
+	defer server.Close()
+	ws = newWebSocketConn(client, bufio.NewReader(client), true)
+	go ws.Close(CloseNormal, strings.Repeat("é", 100))
+	peer := newWebSocketConn(server, bufio.NewReader(server), false)
+	_, _, err = peer.ReadMessage()
+	if !errors.As(err, &closeErr) || closeErr.Code != CloseNormal || closeErr.Reason != strings.Repeat("é", 61) {
+		t.Errorf("Expected the reason trimmed to 61 runes, got %v", err)
+	}
+}
@@ -0,0 +1,136 @@
+package httpmodule
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	neturl "net/url"
+	"strings"
+)
+
+// DialWebSocket opens a WebSocket connection to url, a ws:// or wss:// URL,
+// with the HTTP/1.1 Upgrade handshake. The connection is made as the
+// client's requests are: its dialing, TLS settings, proxies, default
+// headers, and cookie jar all apply. headers go with the handshake, such as
+// Sec-WebSocket-Protocol to offer subprotocols. ctx bounds the handshake
+// only. A server that refuses the upgrade gives a *StatusError carrying its
+// response.
+func (client *HttpClient) DialWebSocket(ctx context.Context, url string, headers map[string]string) (*WebSocketConn, error) {
+	parsedURL, err := neturl.Parse(url)
+	if err != nil {
+		return nil, err
+	}
+	httpURL := *parsedURL
+	switch parsedURL.Scheme {
+	case "ws", "http":
+		httpURL.Scheme = "http"
+	case "wss", "https":
+		httpURL.Scheme = "https"
+	default:
+		return nil, fmt.Errorf("websocket: unsupported scheme %q", parsedURL.Scheme)
+	}
+	if parsedURL.Host == "" {
+		return nil, fmt.Errorf("invalid URL format: %s", url)
+	}
+	useTLS := httpURL.Scheme == "https"
+
+	var nonce [16]byte
+	if _, err := rand.Read(nonce[:]); err != nil {
+		return nil, err
+	}
+	key := base64.StdEncoding.EncodeToString(nonce[:])
+	headers = withHeader(headers, "Upgrade", "websocket")
+	headers = withHeader(headers, "Connection", "Upgrade")
+	headers = withHeader(headers, "Sec-WebSocket-Key", key)
+	headers = withHeader(headers, "Sec-WebSocket-Version", "13")
+	if client.Jar != nil {
+		if cookies := client.Jar.Cookies(&httpURL); len(cookies) > 0 {
+			pairs := make([]string, len(cookies))
+			for i, cookie := range cookies {
+				pairs[i] = cookie.Name + "=" + cookie.Value
+			}
+			headers = withHeader(headers, "Cookie", strings.Join(pairs, "; "))
+		}
+	}
+
+	// WebSocket needs an HTTP/1.1 connection of its own, so proxies are
+	// always tunnelled through rather than sent the request
+	dial := dialFunc(client.dial)
+	proxy, err := client.proxyFor(&HttpRequest{Method: "GET", URL: httpURL.String(), Headers: headers})
+	if err != nil {
+		return nil, err
+	}
+	if proxy != nil {
+		if proxy.Scheme == "socks5" || proxy.Scheme == "socks5h" {
+			dial = client.socksDial(dial, proxy)
+		} else {
+			dial = client.tunnelDial(dial, proxy)
+		}
+	}
+	ctx = withoutHTTP2(ctx)
+	pc, err := dial(ctx, useTLS, parsedURL.Host)
+	if err != nil {
+		var useH2 *useHTTP2Error
+		if errors.As(err, &useH2) {
+			useH2.conn.Close()
+			return nil, errors.New("websocket: server chose HTTP/2 for the connection")
+		}
+		return nil, contextError(ctx, err)
+	}
+
+	head := getBuffer()
+	defer putBuffer(head)
+	writeRequestLine(head, "GET", originForm(parsedURL))
+	client.eachRequestHeader(parsedURL.Host, headers, func(k, v string) {
+		writeHeader(head, k, v)
+	})
+	head.WriteString("\r\n")
+
+	stop := pc.watch(ctx)
+	response, err := connect(pc, head.Bytes(), client.Parsing)
+	if err == nil && response.StatusCode != 101 {
+		_, err = response.ReadBody()
+		if err == nil {
+			err = &StatusError{Response: response}
+		}
+	}
+	if stop() {
+		err = ctx.Err()
+	}
+	if err == nil {
+		err = checkWebSocketHandshake(response, key, headerValue(headers, "Sec-WebSocket-Protocol"))
+	}
+	if err != nil {
+		pc.close()
+		return nil, err
+	}
+
+	ws := newWebSocketConn(pc.conn, pc.reader, true)
+	ws.Subprotocol = headerValue(response.Headers, "Sec-WebSocket-Protocol")
+	return ws, nil
+}
+
+// checkWebSocketHandshake checks that response accepts the upgrade asked for
+// with key, choosing one of the offered subprotocols if any
+func checkWebSocketHandshake(response *HttpResponse, key, offered string) error {
+	if !headerContainsToken(response.Headers, "Upgrade", "websocket") || !headerContainsToken(response.Headers, "Connection", "upgrade") {
+		return protocolError("websocket: server didn't upgrade the connection")
+	}
+	if headerValue(response.Headers, "Sec-WebSocket-Accept") != websocketAccept(key) {
+		return protocolError("websocket: mismatched Sec-WebSocket-Accept")
+	}
+	if extensions := headerValue(response.Headers, "Sec-WebSocket-Extensions"); extensions != "" {
+		return protocolError("websocket: server chose extensions that weren't offered: " + extensions)
+	}
+	if chosen := headerValue(response.Headers, "Sec-WebSocket-Protocol"); chosen != "" {
+		for _, candidate := range strings.Split(offered, ",") {
+			if strings.TrimSpace(candidate) == chosen {
+				return nil
+			}
+		}
+		return protocolError("websocket: server chose a subprotocol that wasn't offered: " + chosen)
+	}
+	return nil
+}
@@ -0,0 +1,107 @@
+package httpmodule
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"errors"
+	"net"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestDialWebSocket tests dialing a WebSocket server and exchanging messages.
+func TestDialWebSocket(t *testing.T) {
+	addr := startWebSocketServer(t)
+	client := New()
+	ws, err := client.DialWebSocket(context.Background(), "ws://"+addr+"/chat", map[string]string{"Sec-WebSocket-Protocol": "chat, superchat"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ws.Subprotocol != "superchat" {
+		t.Error("Expected the superchat subprotocol, got", ws.Subprotocol)
+	}
+	if err := ws.WriteMessage(TextMessage, []byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+	if messageType, data, err := ws.ReadMessage(); err != nil || messageType != TextMessage || string(data) != "hello" {
+		t.Error("Expected the message echoed, got", messageType, string(data), err)
+	}
+	if err := ws.Close(CloseNormal, "bye"); err != nil {
+		t.Error("Expected a clean close, got", err)
+	}
+
+	_, plain := startServer(t, HandlerFunc(func(w ResponseWriter, req *ServerRequest) {
+		w.WriteHeader(404)
+	}))
+	_, err = client.DialWebSocket(context.Background(), "ws://"+plain+"/", nil)
+	var statusErr *StatusError
+	if !errors.As(err, &statusErr) || statusErr.Response.StatusCode != 404 {
+		t.Error("Expected a StatusError for the refused upgrade, got", err)
+	}
+
+	if _, err := client.DialWebSocket(context.Background(), "ftp://"+addr+"/", nil); err == nil {
+		t.Error("Expected an error for a non-WebSocket URL")
+	}
+}
+
+// TestDialWebSocketBadAccept tests rejecting a server that answers with the wrong accept key.
+func TestDialWebSocketBadAccept(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		reader := bufio.NewReader(conn)
+		for {
+			line, err := reader.ReadString('\n')
+			if err != nil || line == "\r\n" {
+				break
+			}
+		}
+		conn.Write([]byte("HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n" +
+			"Sec-WebSocket-Accept: s3pPLMBiTxaQ9kYGzzhZRbK+xOo=\r\n\r\n"))
+		reader.ReadByte()
+	}()
+
+	_, err = New().DialWebSocket(context.Background(), "ws://"+listener.Addr().String()+"/", nil)
+	var protocolErr *ProtocolError
+	if !errors.As(err, &protocolErr) || !strings.Contains(err.Error(), "Sec-WebSocket-Accept") {
+		t.Error("Expected a ProtocolError for the accept key, got", err)
+	}
+}
+
+// TestDialWebSocketTLS tests that wss:// keeps to HTTP/1.1 on a client that negotiates HTTP/2.
+func TestDialWebSocketTLS(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	writeTestCert(t, certFile, keyFile, "server", "localhost")
+	upgrader := &WebSocketUpgrader{}
+	addr := startTLSServer(t, HandlerFunc(func(w ResponseWriter, req *ServerRequest) {
+		ws, err := upgrader.Upgrade(w, req)
+		if err != nil {
+			return
+		}
+		ws.WriteMessage(TextMessage, []byte(req.Protocol))
+		ws.ReadMessage()
+	}), nil, certFile, keyFile)
+	client := New()
+	client.HTTP2 = true
+	client.TLSConfig = &tls.Config{InsecureSkipVerify: true}
+
+	ws, err := client.DialWebSocket(context.Background(), "wss://"+addr+"/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ws.Close(CloseNormal, "")
+	if _, data, err := ws.ReadMessage(); err != nil || string(data) != "HTTP/1.1" {
+		t.Error("Expected the upgrade over HTTP/1.1, got", string(data), err)
+	}
+}
@@ -0,0 +1,601 @@
+package httpmodule
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// A cassette path ending in .yaml or .yml is kept as YAML, laid out as other
+// VCR libraries lay theirs out, so it reads and diffs well in review. Only
+// the YAML a cassette needs is handled: block mappings and sequences, plain,
+// quoted, and block scalars, and comments. Anchors, tags, flow collections
+// other than an empty {} or [], and multi-line quoted scalars are rejected.
+
+// isYAMLPath reports whether the cassette at path is kept as YAML
+func isYAMLPath(path string) bool {
+	ext := strings.ToLower(filepath.Ext(path))
+	return ext == ".yaml" || ext == ".yml"
+}
+
+// yaml encodes the cassette as YAML
+func (cassette Cassette) yaml() []byte {
+	var b bytes.Buffer
+	if len(cassette.Interactions) == 0 {
+		b.WriteString("interactions: []\n")
+		return b.Bytes()
+	}
+	b.WriteString("interactions:\n")
+	for _, interaction := range cassette.Interactions {
+		req, response := interaction.Request, interaction.Response
+		b.WriteString("  - request:\n")
+		writeYAMLField(&b, 6, "method", req.Method)
+		writeYAMLField(&b, 6, "url", req.URL)
+		writeYAMLHeaders(&b, 6, req.Headers)
+		if req.Body != "" {
+			writeYAMLField(&b, 6, "body", req.Body)
+		}
+		b.WriteString("    response:\n")
+		writeYAMLField(&b, 6, "protocol", response.Protocol)
+		fmt.Fprintf(&b, "      status_code: %d\n", response.StatusCode)
+		writeYAMLField(&b, 6, "status", response.Status)
+		writeYAMLHeaders(&b, 6, response.Headers)
+		if response.Body != "" {
+			writeYAMLField(&b, 6, "body", response.Body)
+		}
+	}
+	return b.Bytes()
+}
+
+func writeYAMLHeaders(b *bytes.Buffer, indent int, headers map[string]string) {
+	if len(headers) == 0 {
+		return
+	}
+	keys := make([]string, 0, len(headers))
+	for k := range headers {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	b.WriteString(strings.Repeat(" ", indent) + "headers:\n")
+	for _, k := range keys {
+		writeYAMLField(b, indent+2, yamlQuote(k), headers[k])
+	}
+}
+
+// writeYAMLField writes key: value, with a value of several lines as a
+// literal block when it can be written as one exactly
+func writeYAMLField(b *bytes.Buffer, indent int, key, value string) {
+	prefix := strings.Repeat(" ", indent)
+	if !yamlLiteralSafe(value) {
+		b.WriteString(prefix + key + ": " + yamlQuote(value) + "\n")
+		return
+	}
+	content, chomp := strings.TrimSuffix(value, "\n"), ""
+	if content == value {
+		chomp = "-"
+	}
+	b.WriteString(prefix + key + ": |" + chomp + "\n")
+	for _, line := range strings.Split(content, "\n") {
+		if line == "" {
+			b.WriteString("\n")
+		} else {
+			b.WriteString(prefix + "  " + line + "\n")
+		}
+	}
+}
+
+// yamlLiteralSafe reports whether value has several lines and comes back
+// the same from a literal block: at most one trailing newline, no carriage
+// returns or other control characters, no blank or indented first line, and
+// no trailing spaces, which a block would keep but readers would never see
+func yamlLiteralSafe(value string) bool {
+	content := strings.TrimSuffix(value, "\n")
+	if !strings.Contains(content, "\n") || strings.HasSuffix(content, "\n") || !utf8.ValidString(value) ||
+		strings.HasPrefix(value, "\n") || strings.HasPrefix(value, " ") || strings.HasPrefix(value, "\t") {
+		return false
+	}
+	for _, r := range value {
+		if r < 0x20 && r != '\n' && r != '\t' || r == 0x7f || r == 0x85 || r == 0xfeff || r == 0x2028 || r == 0x2029 {
+			return false
+		}
+	}
+	for _, line := range strings.Split(value, "\n") {
+		if strings.TrimRight(line, " \t") != line {
+			return false
+		}
+	}
+	return true
+}
+
+// yamlQuote returns s as a double-quoted YAML scalar. Bytes that aren't
+// valid UTF-8 become U+FFFD, as they do in JSON cassettes.
+func yamlQuote(s string) string {
+	var b strings.Builder
+	b.WriteByte('"')
+	for _, r := range s {
+		switch {
+		case r == '"':
+			b.WriteString(`\"`)
+		case r == '\\':
+			b.WriteString(`\\`)
+		case r == '\n':
+			b.WriteString(`\n`)
+		case r == '\r':
+			b.WriteString(`\r`)
+		case r == '\t':
+			b.WriteString(`\t`)
+		case r < 0x20 || r == 0x7f:
+			fmt.Fprintf(&b, `\x%02x`, r)
+		case r == 0x85 || r == 0xfeff || r == 0x2028 || r == 0x2029:
+			fmt.Fprintf(&b, `\u%04x`, r)
+		default:
+			b.WriteRune(r)
+		}
+	}
+	b.WriteByte('"')
+	return b.String()
+}
+
+// yamlNode is a parsed YAML value: a mapping, in the order of its keys, a
+// sequence, or a scalar, kept as text
+type yamlNode struct {
+	keys   []string
+	values map[string]*yamlNode
+	items  []*yamlNode
+	scalar string
+	kind   int
+}
+
+const (
+	yamlScalar = iota
+	yamlMapping
+	yamlSequence
+)
+
+// yamlLine is a line of the document without its indentation
+type yamlLine struct {
+	number int
+	indent int
+	text   string
+}
+
+// yamlParser reads the YAML subset cassettes use
+type yamlParser struct {
+	lines []string
+	// Lines that aren't blank or comments, with their indentation
+	content []yamlLine
+	pos     int
+}
+
+func (p *yamlParser) errorf(line int, format string, args ...any) error {
+	return fmt.Errorf("yaml: line %d: %s", line, fmt.Sprintf(format, args...))
+}
+
+// parseYAML parses data into a node
+func parseYAML(data []byte) (*yamlNode, error) {
+	p := &yamlParser{lines: strings.Split(strings.ReplaceAll(string(data), "\r\n", "\n"), "\n")}
+	for i, raw := range p.lines {
+		text := strings.TrimLeft(raw, " ")
+		if text == "" || strings.HasPrefix(text, "#") || text == "---" || text == "..." {
+			continue
+		}
+		p.content = append(p.content, yamlLine{number: i + 1, indent: len(raw) - len(text), text: strings.TrimRight(text, " ")})
+	}
+	if len(p.content) == 0 {
+		return &yamlNode{kind: yamlMapping, values: map[string]*yamlNode{}}, nil
+	}
+	node, err := p.parseNode(p.content[0].indent)
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.content) {
+		return nil, p.errorf(p.content[p.pos].number, "unexpected indentation")
+	}
+	return node, nil
+}
+
+// parseNode parses the collection or scalar starting at the current line,
+// indented by indent
+func (p *yamlParser) parseNode(indent int) (*yamlNode, error) {
+	line := p.content[p.pos]
+	if strings.HasPrefix(line.text, "\t") {
+		return nil, p.errorf(line.number, "tabs can't indent YAML")
+	}
+	if line.text == "-" || strings.HasPrefix(line.text, "- ") {
+		return p.parseSequence(indent)
+	}
+	if _, _, ok := splitYAMLKey(line.text); ok {
+		return p.parseMapping(indent)
+	}
+	p.pos++
+	return p.parseScalar(line, line.text)
+}
+
+func (p *yamlParser) parseSequence(indent int) (*yamlNode, error) {
+	node := &yamlNode{kind: yamlSequence}
+	for p.pos < len(p.content) {
+		line := p.content[p.pos]
+		if line.indent < indent {
+			break
+		}
+		if strings.HasPrefix(line.text, "\t") {
+			return nil, p.errorf(line.number, "tabs can't indent YAML")
+		}
+		if line.indent > indent || line.text != "-" && !strings.HasPrefix(line.text, "- ") {
+			return nil, p.errorf(line.number, "unexpected indentation")
+		}
+		rest := strings.TrimLeft(strings.TrimPrefix(line.text, "-"), " ")
+		if rest == "" {
+			p.pos++
+			if p.pos >= len(p.content) || p.content[p.pos].indent <= indent {
+				node.items = append(node.items, &yamlNode{})
+				continue
+			}
+			item, err := p.parseNode(p.content[p.pos].indent)
+			if err != nil {
+				return nil, err
+			}
+			node.items = append(node.items, item)
+			continue
+		}
+		// The item's content starts a node of its own, indented to where it
+		// begins on the line
+		column := indent + len(line.text) - len(rest)
+		p.content[p.pos] = yamlLine{number: line.number, indent: column, text: rest}
+		item, err := p.parseNode(column)
+		if err != nil {
+			return nil, err
+		}
+		node.items = append(node.items, item)
+	}
+	return node, nil
+}
+
+func (p *yamlParser) parseMapping(indent int) (*yamlNode, error) {
+	node := &yamlNode{kind: yamlMapping, values: map[string]*yamlNode{}}
+	for p.pos < len(p.content) {
+		line := p.content[p.pos]
+		if line.indent < indent {
+			break
+		}
+		if strings.HasPrefix(line.text, "\t") {
+			return nil, p.errorf(line.number, "tabs can't indent YAML")
+		}
+		if line.indent > indent {
+			return nil, p.errorf(line.number, "unexpected indentation")
+		}
+		rawKey, value, ok := splitYAMLKey(line.text)
+		if !ok {
+			return nil, p.errorf(line.number, "expected key: value")
+		}
+		keyNode, err := p.parseScalar(line, rawKey)
+		if err != nil {
+			return nil, err
+		}
+		key := keyNode.scalar
+		if _, dup := node.values[key]; dup {
+			return nil, p.errorf(line.number, "duplicate key %q", key)
+		}
+		p.pos++
+
+		var child *yamlNode
+		switch {
+		case value == "" || strings.HasPrefix(value, "#"):
+			// The value is the block below, which a sequence may start at the
+			// key's own indentation
+			if p.pos < len(p.content) {
+				next := p.content[p.pos]
+				if next.indent > indent || next.indent == indent && (next.text == "-" || strings.HasPrefix(next.text, "- ")) {
+					child, err = p.parseNode(next.indent)
+					break
+				}
+			}
+			child = &yamlNode{}
+		case value[0] == '|' || value[0] == '>':
+			child, err = p.parseBlockScalar(line, value, indent)
+		default:
+			child, err = p.parseScalar(line, value)
+		}
+		if err != nil {
+			return nil, err
+		}
+		node.keys = append(node.keys, key)
+		node.values[key] = child
+	}
+	return node, nil
+}
+
+// splitYAMLKey splits "key: value" at the first colon followed by a space or
+// the end of the line, outside quotes
+func splitYAMLKey(text string) (key, value string, ok bool) {
+	if text == "" || text[0] == '#' {
+		return "", "", false
+	}
+	i := 0
+	if text[0] == '"' || text[0] == '\'' {
+		end, err := quotedEnd(text)
+		if err != nil {
+			return "", "", false
+		}
+		i = end
+	}
+	for ; i < len(text); i++ {
+		if text[i] == ':' && (i+1 == len(text) || text[i+1] == ' ') {
+			return strings.TrimRight(text[:i], " "), strings.TrimSpace(text[i+1:]), true
+		}
+		if text[i] == '#' && i > 0 && text[i-1] == ' ' {
+			break
+		}
+	}
+	return "", "", false
+}
+
+// quotedEnd returns the index just past the quoted scalar text starts with
+func quotedEnd(text string) (int, error) {
+	quote := text[0]
+	for i := 1; i < len(text); i++ {
+		switch {
+		case quote == '"' && text[i] == '\\':
+			i++
+		case text[i] == quote && quote == '\'' && i+1 < len(text) && text[i+1] == '\'':
+			i++
+		case text[i] == quote:
+			return i + 1, nil
+		}
+	}
+	return 0, errors.New("unterminated quoted scalar")
+}
+
+// parseScalar parses a plain or quoted scalar on a single line
+func (p *yamlParser) parseScalar(line yamlLine, text string) (*yamlNode, error) {
+	switch {
+	case text == "":
+		return &yamlNode{}, nil
+	case text[0] == '"' || text[0] == '\'':
+		end, err := quotedEnd(text)
+		if err != nil {
+			return nil, p.errorf(line.number, "%v; quoted scalars must fit on one line", err)
+		}
+		if rest := strings.TrimSpace(text[end:]); rest != "" && !strings.HasPrefix(rest, "#") {
+			return nil, p.errorf(line.number, "unexpected text after quoted scalar")
+		}
+		value, err := unquoteYAML(text[:end])
+		if err != nil {
+			return nil, p.errorf(line.number, "%v", err)
+		}
+		return &yamlNode{scalar: value}, nil
+	case text == "{}":
+		return &yamlNode{kind: yamlMapping, values: map[string]*yamlNode{}}, nil
+	case text == "[]":
+		return &yamlNode{kind: yamlSequence}, nil
+	case strings.ContainsRune("&*!{[|>@`%", rune(text[0])):
+		return nil, p.errorf(line.number, "unsupported YAML %q", text)
+	}
+	if i := strings.Index(text, " #"); i >= 0 {
+		text = strings.TrimRight(text[:i], " ")
+	}
+	if text == "~" || text == "null" {
+		text = ""
+	}
+	return &yamlNode{scalar: text}, nil
+}
+
+// parseBlockScalar parses a literal (|) or folded (>) block, whose lines are
+// indented further than the key at indent
+func (p *yamlParser) parseBlockScalar(line yamlLine, header string, indent int) (*yamlNode, error) {
+	if i := strings.Index(header, " #"); i >= 0 {
+		header = strings.TrimRight(header[:i], " ")
+	}
+	folded := header[0] == '>'
+	chomp := byte(0)
+	for _, c := range []byte(header[1:]) {
+		switch c {
+		case '-', '+':
+			chomp = c
+		default:
+			return nil, p.errorf(line.number, "unsupported block scalar header %q", header)
+		}
+	}
+
+	// The block runs over every raw line, blank ones included, until one
+	// indented no further than the key
+	var lines []string
+	blockIndent := -1
+	i := line.number
+	for ; i < len(p.lines); i++ {
+		raw := p.lines[i]
+		text := strings.TrimLeft(raw, " ")
+		if text == "" {
+			lines = append(lines, "")
+			continue
+		}
+		width := len(raw) - len(text)
+		if width <= indent {
+			break
+		}
+		if blockIndent < 0 {
+			blockIndent = width
+		}
+		if width < blockIndent {
+			return nil, p.errorf(i+1, "block scalar line less indented than the first")
+		}
+		lines = append(lines, raw[blockIndent:])
+	}
+	for p.pos < len(p.content) && p.content[p.pos].number <= i {
+		p.pos++
+	}
+
+	// Trailing blank lines belong to the chomping, not the content
+	content := len(lines)
+	for content > 0 && lines[content-1] == "" {
+		content--
+	}
+	var value string
+	if folded {
+		var b strings.Builder
+		for j, l := range lines[:content] {
+			switch {
+			case j == 0:
+			case l == "" || lines[j-1] == "":
+				b.WriteByte('\n')
+			default:
+				b.WriteByte(' ')
+			}
+			b.WriteString(l)
+		}
+		value = b.String()
+	} else {
+		value = strings.Join(lines[:content], "\n")
+	}
+	switch {
+	case content == 0:
+	case chomp == '-':
+	case chomp == '+':
+		value += "\n" + strings.Repeat("\n", len(lines)-content)
+		if i >= len(p.lines) && len(lines) > content {
+			// The document's final newline isn't a blank line of the block
+			value = value[:len(value)-1]
+		}
+	default:
+		value += "\n"
+	}
+	return &yamlNode{scalar: value}, nil
+}
+
+// The single-character escapes of double-quoted YAML scalars
+var yamlEscapes = map[byte]string{
+	'0': "\x00", 'a': "\a", 'b': "\b", 't': "\t", '\t': "\t", 'n': "\n", 'v': "\v", 'f': "\f",
+	'r': "\r", 'e': "\x1b", ' ': " ", '"': "\"", '/': "/", '\\': "\\",
+	'N': "\u0085", '_': "\u00a0", 'L': "\u2028", 'P': "\u2029",
+}
+
+// unquoteYAML decodes a single- or double-quoted scalar
+func unquoteYAML(quoted string) (string, error) {
+	body := quoted[1 : len(quoted)-1]
+	if quoted[0] == '\'' {
+		return strings.ReplaceAll(body, "''", "'"), nil
+	}
+	var b strings.Builder
+	for i := 0; i < len(body); i++ {
+		c := body[i]
+		if c != '\\' {
+			b.WriteByte(c)
+			continue
+		}
+		i++
+		if i == len(body) {
+			return "", errors.New("quoted scalar ends in a backslash")
+		}
+		if s, ok := yamlEscapes[body[i]]; ok {
+			b.WriteString(s)
+			continue
+		}
+		digits := map[byte]int{'x': 2, 'u': 4, 'U': 8}[body[i]]
+		if digits == 0 || i+digits >= len(body) {
+			return "", fmt.Errorf("invalid escape \\%c", body[i])
+		}
+		code, err := strconv.ParseUint(body[i+1:i+1+digits], 16, 32)
+		if err != nil || !utf8.ValidRune(rune(code)) {
+			return "", fmt.Errorf("invalid escape \\%s", body[i:i+1+digits])
+		}
+		b.WriteRune(rune(code))
+		i += digits
+	}
+	return b.String(), nil
+}
+
+// readYAMLCassette decodes a cassette written by Cassette.yaml, or by hand in
+// the same layout
+func readYAMLCassette(data []byte) (Cassette, error) {
+	root, err := parseYAML(data)
+	if err != nil {
+		return Cassette{}, err
+	}
+	var cassette Cassette
+	if root.kind != yamlMapping {
+		return cassette, errors.New("yaml: cassette isn't a mapping")
+	}
+	list := root.values["interactions"]
+	if list == nil || list.kind == yamlScalar && list.scalar == "" {
+		return cassette, nil
+	}
+	if list.kind != yamlSequence {
+		return cassette, errors.New("yaml: interactions isn't a list")
+	}
+	for i, item := range list.items {
+		req, response := item.field("request"), item.field("response")
+		if item.kind != yamlMapping || req == nil || response == nil {
+			return cassette, fmt.Errorf("yaml: interaction %d needs a request and a response", i+1)
+		}
+		status := 0
+		if code := response.text("status_code"); code != "" {
+			if status, err = strconv.Atoi(code); err != nil {
+				return cassette, fmt.Errorf("yaml: interaction %d: invalid status_code %q", i+1, code)
+			}
+		}
+		requestHeaders, err := req.headers()
+		if err != nil {
+			return cassette, fmt.Errorf("yaml: interaction %d: %v", i+1, err)
+		}
+		responseHeaders, err := response.headers()
+		if err != nil {
+			return cassette, fmt.Errorf("yaml: interaction %d: %v", i+1, err)
+		}
+		cassette.Interactions = append(cassette.Interactions, Interaction{
+			Request: RecordedRequest{
+				Method:  req.text("method"),
+				URL:     req.text("url"),
+				Headers: requestHeaders,
+				Body:    req.text("body"),
+			},
+			Response: RecordedResponse{
+				Protocol:   response.text("protocol"),
+				StatusCode: status,
+				Status:     response.text("status"),
+				Headers:    responseHeaders,
+				Body:       response.text("body"),
+			},
+		})
+	}
+	return cassette, nil
+}
+
+// field returns the value of key in a mapping, or nil
+func (node *yamlNode) field(key string) *yamlNode {
+	if node.kind != yamlMapping {
+		return nil
+	}
+	return node.values[key]
+}
+
+// text returns the scalar value of key in a mapping, or ""
+func (node *yamlNode) text(key string) string {
+	if value := node.field(key); value != nil && value.kind == yamlScalar {
+		return value.scalar
+	}
+	return ""
+}
+
+// headers returns the headers mapping of a recorded request or response
+func (node *yamlNode) headers() (map[string]string, error) {
+	value := node.field("headers")
+	if value == nil || value.kind == yamlScalar && value.scalar == "" {
+		return nil, nil
+	}
+	if value.kind != yamlMapping {
+		return nil, errors.New("headers isn't a mapping")
+	}
+	if len(value.keys) == 0 {
+		return nil, nil
+	}
+	headers := make(map[string]string, len(value.keys))
+	for _, k := range value.keys {
+		headers[k] = value.text(k)
+	}
+	return headers, nil
+}